@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/events"
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/mediaserver"
+	"sonarr-autoimport/internal/notify"
+	"sonarr-autoimport/internal/qbittorrent"
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/report"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/state"
+)
+
+// newLogger creates the logger selected by the global flags.
+func (g *globals) newLogger() (*logging.Logger, error) {
+	level := logging.LevelInfo
+	if g.verbose {
+		level = logging.LevelDebug
+	}
+	if g.logLevel != "" {
+		var err error
+		if level, err = logging.ParseLevel(g.logLevel); err != nil {
+			return nil, fmt.Errorf("invalid -log-level: %w", err)
+		}
+	}
+	jsonFormat, err := logging.ParseFormat(g.logFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -log-format: %w", err)
+	}
+
+	logger := logging.New(os.Stderr, level)
+	logger.SetJSON(jsonFormat)
+	return logger, nil
+}
+
+// load creates the logger and loads the configuration. The config's log
+// level applies unless one was given on the command line.
+func (g *globals) load() (*logging.Logger, *config.Config, error) {
+	logger, err := g.newLogger()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g.configPath = config.Locate(g.configPath)
+	cfg, err := config.Load(g.configPath, logger)
+	if errors.Is(err, config.ErrDefaultCreated) {
+		return logger, nil, err
+	}
+	if err != nil {
+		return logger, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := g.applyLogLevel(logger, cfg); err != nil {
+		return logger, nil, err
+	}
+	return logger, cfg, nil
+}
+
+// applyLogLevel sets the log level of cfg on logger unless one was given on
+// the command line.
+func (g *globals) applyLogLevel(logger *logging.Logger, cfg *config.Config) error {
+	if cfg.LogLevel == "" || g.logLevel != "" || g.verbose {
+		return nil
+	}
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid logLevel in config: %w", err)
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
+// fatal reports err on logger, or on stderr when there is no logger yet, and
+// returns exitFatal, or exitFirstRun when the default config was just
+// created.
+func fatal(logger *logging.Logger, err error) int {
+	if errors.Is(err, config.ErrDefaultCreated) {
+		logger.Warnf("%v; edit it with your Sonarr settings and run again", err)
+		return exitFirstRun
+	}
+	if logger == nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		logger.Errorf("%v", err)
+	}
+	return exitFatal
+}
+
+// importFlags are the flags shared by scan and daemon.
+type importFlags struct {
+	force  bool
+	report string
+	limit  int
+	yes    bool
+	events string
+	// missingOnly imports only the episodes Sonarr misses.
+	missingOnly bool
+	noDedupe    bool
+	// crossCheck compares every file with Sonarr's manual import preview.
+	crossCheck bool
+	// allowOverlap scans a downloads folder that overlaps a root folder.
+	allowOverlap bool
+	// noRescan skips the second pass over files that appeared mid-scan.
+	noRescan bool
+	// since leaves the files modified before it out of full scans.
+	since sinceFlag
+	overrides
+}
+
+// session holds what scan and daemon need to import files.
+type session struct {
+	log          *logging.Logger
+	cfg          *config.Config
+	imp          *importer.Importer
+	notifier     *notify.Dispatcher
+	refresher    *mediaserver.Refresher
+	retry        *history.Queue
+	ignore       *history.IgnoreList
+	unmatched    *history.Unmatched
+	misses       *history.LookupMisses
+	events       *events.Stream
+	lock         *state.Lock
+	drainTimeout time.Duration
+}
+
+// openSession loads the configuration, takes the state directory lock and
+// builds the importer with its observers.
+func openSession(g *globals, f importFlags) (*session, error) {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return &session{log: logger}, err
+	}
+	s := &session{log: logger, cfg: cfg}
+
+	if s.notifier, err = notify.New(cfg.Notifications, logger); err != nil {
+		return s, fmt.Errorf("invalid notification configuration: %w", err)
+	}
+	if s.refresher, err = mediaserver.New(cfg.MediaServers, logger); err != nil {
+		return s, fmt.Errorf("invalid media server configuration: %w", err)
+	}
+	if s.drainTimeout, err = cfg.Daemon.DrainTimeoutDuration(); err != nil {
+		return s, fmt.Errorf("invalid daemon configuration: %w", err)
+	}
+
+	// Only one instance may import from the same state directory at a time
+	s.lock, err = state.AcquireLock(stateDir(g, cfg))
+	switch {
+	case err == nil:
+	case errors.Is(err, state.ErrLocked) && f.force:
+		logger.Warnf("Ignoring lock because of -force: %v", err)
+	case errors.Is(err, state.ErrLocked):
+		return s, fmt.Errorf("%w; use -force to run anyway", err)
+	default:
+		return s, fmt.Errorf("failed to lock state directory: %w", err)
+	}
+
+	var changed map[string]bool
+	if s.imp, changed, err = s.newImporter(g, f, cfg); err != nil {
+		return s, err
+	}
+	store := history.Open(stateDir(g, cfg))
+	fingerprints := history.NewFingerprints(store, logger)
+	s.imp.Fingerprints = fingerprints
+	s.imp.Observers = append(s.imp.Observers, s.notifier, s.refresher,
+		history.NewRecorder(store, logger), fingerprints, history.OpenStats(stateDir(g, cfg), logger))
+	if cfg.Retry.MaxAttempts > 0 {
+		if s.retry, err = openRetryQueue(stateDir(g, cfg), cfg.Retry, logger); err != nil {
+			return s, err
+		}
+		s.imp.Retry = s.retry
+		s.imp.Observers = append(s.imp.Observers, s.retry)
+	}
+	if s.ignore, err = history.OpenIgnoreList(stateDir(g, cfg), cfg.Ignore.AutoAfter, logger); err != nil {
+		return s, err
+	}
+	s.imp.Ignore = s.ignore
+	s.unmatched = history.OpenUnmatched(stateDir(g, cfg), logger)
+	s.unmatched.OnPending = func(f importer.FileResult) {
+		s.notifier.Send(notify.Event{Type: notify.EventApprovalPending, File: &f})
+	}
+	s.imp.Aliases = history.OpenAliases(stateDir(g, cfg), logger)
+	s.misses = history.OpenLookupMisses(stateDir(g, cfg), logger)
+	s.imp.LookupMisses = s.misses
+	s.imp.Observers = append(s.imp.Observers, s.ignore, s.unmatched)
+	if g.dryRun.json {
+		s.imp.Observers = append(s.imp.Observers, &planWriter{w: os.Stdout})
+	}
+	if f.report != "" {
+		s.imp.Observers = append(s.imp.Observers, report.NewFile(f.report, logger))
+	}
+	if f.events != "" {
+		if g.dryRun.json && events.Stdout(f.events) {
+			return s, fmt.Errorf("-events %s and -dry-run=json cannot both write to stdout", f.events)
+		}
+		if s.events, err = events.Open(f.events, logger); err != nil {
+			return s, err
+		}
+		s.imp.Observers = append(s.imp.Observers, s.events)
+	}
+
+	logger.Infof("SonarrAutoImport Go Edition - Anime Workflow")
+	logger.Infof("=============================================")
+	logger.Infof("Config: %s", g.configPath)
+	logger.Infof("Dry run: %t", g.dryRun.enabled)
+	logger.Infof("Log level: %s", logger.Level())
+	logSources(logger, cfg)
+	logEffectiveConfig(logger, cfg, changed)
+	logger.Infof("")
+	return s, nil
+}
+
+// newImporter builds the Sonarr clients and the importer for cfg after
+// applying the command line overrides, which it returns. The overrides only
+// apply to the instance of the sonarr section.
+func (s *session) newImporter(g *globals, f importFlags, cfg *config.Config) (*importer.Importer, map[string]bool, error) {
+	client := sonarr.NewClient(cfg.Sonarr.URL, cfg.Sonarr.APIKey, nil, s.log)
+	client.SetHeaders(cfg.Sonarr.Headers)
+	if g.dryRun.enabled {
+		client.SetReadOnly()
+	}
+	changed, err := f.apply(context.Background(), cfg, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	imp := importer.New(cfg, client, s.log, importer.Options{
+		DryRun:         g.dryRun.enabled,
+		DrainTimeout:   s.drainTimeout,
+		Limit:          f.limit,
+		IgnoreMaxFiles: f.yes,
+		MissingOnly:    f.missingOnly,
+		NoDedupe:       f.noDedupe,
+		CrossCheck:     f.crossCheck,
+		AllowOverlap:   f.allowOverlap,
+		NoRescan:       f.noRescan,
+		Since:          f.since.Time,
+	})
+	for _, inst := range cfg.Instances {
+		instCfg := cfg.InstanceSonarr(inst)
+		instClient := sonarr.NewClient(instCfg.URL, instCfg.APIKey, nil, s.log)
+		instClient.SetHeaders(instCfg.Headers)
+		if g.dryRun.enabled {
+			instClient.SetReadOnly()
+		}
+		imp.AddInstance(inst.Name, instCfg, instClient)
+	}
+	if cfg.Radarr.URL != "" {
+		imp.Radarr = radarr.NewClient(cfg.Radarr.URL, cfg.Radarr.APIKey, nil, s.log)
+		imp.Radarr.SetHeaders(cfg.Radarr.Headers)
+		if g.dryRun.enabled {
+			imp.Radarr.SetReadOnly()
+		}
+	}
+	if cfg.QBittorrent.URL != "" {
+		imp.Torrents = qbittorrent.NewChecker(cfg.QBittorrent, s.log)
+	}
+	if err := imp.ResolveFolderTags(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	if err := imp.CheckQualityProfiles(ctx); err != nil {
+		return nil, nil, err
+	}
+	if err := imp.CheckRootFolders(ctx); err != nil {
+		return nil, nil, err
+	}
+	return imp, changed, nil
+}
+
+// close waits for pending notifications and refreshes, ends the event stream
+// and releases the lock.
+func (s *session) close() {
+	if s.refresher != nil {
+		s.refresher.Wait(s.drainTimeout)
+	}
+	if s.notifier != nil {
+		s.notifier.Close(s.drainTimeout)
+	}
+	if s.events != nil {
+		s.events.Close()
+	}
+	if s.lock != nil {
+		s.lock.Release()
+	}
+}
+
+// logSources logs where each top-level setting came from. Only variable names
+// are logged, never their values.
+func logSources(logger *logging.Logger, cfg *config.Config) {
+	keys := make([]string, 0, len(cfg.Sources))
+	for key := range cfg.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	logger.Infof("Settings loaded from:")
+	for _, key := range keys {
+		logger.Infof("  %s: %s", key, cfg.Sources[key])
+	}
+}
+
+// stateDir returns the directory for the lock and other state files.
+func stateDir(g *globals, cfg *config.Config) string {
+	if cfg.StateDir != "" {
+		return cfg.StateDir
+	}
+	return filepath.Dir(g.configPath)
+}
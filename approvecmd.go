@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/logging"
+)
+
+func approveCommand() *command {
+	return &command{
+		name:    "approve",
+		args:    "[title]...",
+		summary: "List the new series waiting for approval, or approve or reject them",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			f.registerScan(fs)
+			var opts approveFlags
+			fs.BoolVar(&opts.reject, "reject", false, "Reject the series of the titles instead, ignoring their files")
+			fs.BoolVar(&opts.all, "all", false, "Approve (or with -reject, reject) every waiting series")
+			fs.BoolVar(&opts.interactive, "i", false, "Ask for every waiting series whether to approve or reject it")
+			fs.BoolVar(&opts.noImport, "no-import", false, "Only approve, leaving the files to the next scan")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the titles, as in "approve 'Some Title' -reject"
+				var titles []string
+				for len(args) > 0 {
+					titles = append(titles, args[0])
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = fs.Args()
+				}
+				switch {
+				case opts.interactive && (opts.all || opts.reject || len(titles) > 0):
+					fmt.Fprintln(os.Stderr, "-i cannot be combined with titles, -all or -reject")
+					return exitFatal
+				case opts.all && len(titles) > 0:
+					fmt.Fprintln(os.Stderr, "-all cannot be combined with titles")
+					return exitFatal
+				}
+				return runApprove(g, f, titles, opts)
+			}
+		},
+	}
+}
+
+type approveFlags struct {
+	reject      bool
+	all         bool
+	interactive bool
+	noImport    bool
+}
+
+// runApprove lists the waiting series, or approves or rejects those of titles,
+// of all of them or of those picked interactively.
+func runApprove(g *globals, f importFlags, titles []string, opts approveFlags) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	unmatched := history.OpenUnmatched(stateDir(g, cfg), logger)
+	pending, err := unmatched.Pending()
+	if err != nil {
+		return fatal(logger, err)
+	}
+
+	var approve, reject []history.UnmatchedTitle
+	switch {
+	case opts.interactive:
+		if approve, reject, err = askApprovals(pending); err != nil {
+			return fatal(logger, err)
+		}
+	case opts.all:
+		approve = pending
+	case len(titles) > 0:
+		if approve, err = pendingTitles(pending, titles); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFatal
+		}
+	default:
+		return printPending(pending)
+	}
+	if opts.reject {
+		approve, reject = nil, approve
+	}
+	if len(approve) == 0 && len(reject) == 0 {
+		fmt.Println("No new series waiting for approval")
+		return exitOK
+	}
+
+	if len(reject) > 0 {
+		if err := rejectSeries(g, logger, unmatched, reject); err != nil {
+			return fatal(logger, err)
+		}
+	}
+	if len(approve) == 0 {
+		return exitOK
+	}
+	return approveSeries(g, f, approve, opts.noImport)
+}
+
+// printPending lists the waiting series with the files that need them.
+func printPending(pending []history.UnmatchedTitle) int {
+	if len(pending) == 0 {
+		fmt.Println("No new series waiting for approval")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TITLE\tNEW SERIES\tFILES\tWAITING SINCE\tEXAMPLES")
+	for _, t := range pending {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", t.Title, candidateName(*t.Pending), len(t.Files), t.FirstSeen.Local().Format("2006-01-02 15:04"), examples(t.Files))
+	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println(`Run "approve <title>" to add the series and import its files, "approve <title> -reject" to ignore them,`)
+	fmt.Println(`or "approve -i" to decide for each; "resolve <title>" maps a title to another series`)
+	return exitOK
+}
+
+// examples names the first few of files.
+func examples(files []string) string {
+	var names []string
+	for _, path := range files[:min(len(files), 3)] {
+		names = append(names, logging.Escape(filepath.Base(path)))
+	}
+	return strings.Join(names, ", ")
+}
+
+// pendingTitles returns the waiting series of titles, which are matched
+// ignoring case.
+func pendingTitles(pending []history.UnmatchedTitle, titles []string) ([]history.UnmatchedTitle, error) {
+	var found []history.UnmatchedTitle
+	for _, title := range titles {
+		i := -1
+		for j, t := range pending {
+			if strings.EqualFold(strings.TrimSpace(title), t.Title) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("no new series for %q is waiting for approval; run \"approve\" to list them", title)
+		}
+		found = append(found, pending[i])
+	}
+	return found, nil
+}
+
+// askApprovals asks for every waiting series whether to approve, reject or
+// skip it.
+func askApprovals(pending []history.UnmatchedTitle) (approve, reject []history.UnmatchedTitle, err error) {
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	for i, t := range pending {
+		fmt.Fprintf(p.out, "\n%d/%d: %s would be added for %s\n", i+1, len(pending), candidateName(*t.Pending), t.Title)
+		fmt.Fprintf(p.out, "  %d file(s): %s\n", len(t.Files), examples(t.Files))
+		for {
+			answer, err := p.ask("Approve, reject or skip (a/r/s)", "s")
+			if err != nil {
+				return nil, nil, err
+			}
+			switch strings.ToLower(answer) {
+			case "a", "approve":
+				approve = append(approve, t)
+			case "r", "reject":
+				reject = append(reject, t)
+			case "s", "skip":
+			default:
+				fmt.Fprintln(p.out, "Answer a, r or s")
+				continue
+			}
+			break
+		}
+	}
+	return approve, reject, nil
+}
+
+// rejectSeries ignores the files of titles and forgets the titles, so scans
+// stop asking for their series.
+func rejectSeries(g *globals, logger *logging.Logger, unmatched *history.Unmatched, titles []history.UnmatchedTitle) error {
+	if g.dryRun.enabled {
+		for _, t := range titles {
+			logger.Infof("Would reject %s for %s and ignore its %d file(s)", candidateName(*t.Pending), t.Title, len(t.Files))
+		}
+		return nil
+	}
+	ignore, _, err := openIgnoreList(g)
+	if err != nil {
+		return err
+	}
+	for _, t := range titles {
+		reason := fmt.Sprintf("new series %s rejected", candidateName(*t.Pending))
+		for _, path := range t.Files {
+			if _, err := ignore.Add(path, reason, false); err != nil {
+				return fmt.Errorf("failed to ignore %s: %w", path, err)
+			}
+		}
+		if err := unmatched.Remove(t.Title); err != nil {
+			return fmt.Errorf("failed to save unmatched titles: %w", err)
+		}
+		logger.Infof("Rejected %s for %s, ignoring its %d file(s)", candidateName(*t.Pending), t.Title, len(t.Files))
+	}
+	return nil
+}
+
+// approveSeries maps every title to its waiting series, which titles with an
+// alias are added with, and imports their files again.
+func approveSeries(g *globals, f importFlags, titles []history.UnmatchedTitle, noImport bool) int {
+	// The session is only needed, and its lock only taken, to import
+	var s *session
+	var err error
+	if noImport {
+		s = &session{}
+		s.log, s.cfg, err = g.load()
+	} else {
+		s, err = openSession(g, f)
+		defer s.close()
+	}
+	if err != nil {
+		return fatal(s.log, err)
+	}
+
+	aliases := history.OpenAliases(stateDir(g, s.cfg), s.log)
+	planned := dryRunAliases{}
+	var files []string
+	for _, t := range titles {
+		if g.dryRun.enabled {
+			s.log.Infof("Would approve %s for %s", candidateName(*t.Pending), t.Title)
+			planned.add(t.Title, t.Pending.TvdbID)
+		} else {
+			if err := aliases.Set(t.Title, t.Pending.TvdbID); err != nil {
+				return fatal(s.log, fmt.Errorf("failed to save title alias: %w", err))
+			}
+			s.log.Infof("Approved %s for %s", candidateName(*t.Pending), t.Title)
+		}
+		files = append(files, t.Files...)
+	}
+	if noImport || len(files) == 0 {
+		return exitOK
+	}
+	if g.dryRun.enabled {
+		s.imp.Aliases = planned
+	}
+
+	s.log.Infof("Importing %d file(s) of the approved series", len(files))
+	ctx, stop := signalContext()
+	defer stop()
+	result, err := s.imp.ProcessPaths(ctx, files)
+	return exitStatus(result, err, false)
+}
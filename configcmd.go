@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/mediaserver"
+	"sonarr-autoimport/internal/notify"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+func configCommand() *command {
+	return &command{
+		name:    "config",
+		args:    "init|validate|convert <file>",
+		summary: "Create, check or convert the configuration",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var initOpts initFlags
+			initOpts.register(fs)
+			online := fs.Bool("online", false, "validate: also check profiles and the root folder against Sonarr")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "config init -force"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				if len(args) == 0 {
+					fmt.Fprintln(os.Stderr, "config needs one of init, validate or convert")
+					return exitFatal
+				}
+
+				action, args := args[0], args[1:]
+				switch {
+				case action == "init" && len(args) == 0:
+					return runConfigInit(g, initOpts)
+				case action == "validate" && len(args) == 0:
+					return runConfigValidate(g, *online)
+				case action == "convert" && len(args) == 1:
+					return runConfigConvert(g, args[0], initOpts.force)
+				case action == "convert":
+					fmt.Fprintln(os.Stderr, "config convert needs the file to write, such as Settings.yaml")
+					return exitFatal
+				}
+				fmt.Fprintf(os.Stderr, "Unknown config command %q\n", strings.Join(append([]string{action}, args...), " "))
+				return exitFatal
+			}
+		},
+	}
+}
+
+// runConfigConvert writes the configuration to output in the format of its
+// extension. Environment variables are left unexpanded.
+func runConfigConvert(g *globals, output string, force bool) int {
+	logger, err := g.newLogger()
+	if err != nil {
+		return fatal(nil, err)
+	}
+	input := config.Locate(g.configPath)
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if _, err := os.Stat(output); err == nil && !force {
+		return fatal(logger, fmt.Errorf("%s already exists; use -force to overwrite it", output))
+	}
+
+	converted, err := config.Convert(data, config.FormatOf(input), config.FormatOf(output))
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if err := os.WriteFile(output, converted, 0644); err != nil {
+		return fatal(logger, err)
+	}
+	logger.Infof("Converted %s to %s", input, output)
+	return exitOK
+}
+
+func runConfigValidate(g *globals, online bool) int {
+	logger, err := g.newLogger()
+	if err != nil {
+		return fatal(nil, err)
+	}
+	g.configPath = config.Locate(g.configPath)
+	cfg, issues, err := checkConfig(g.configPath)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if cfg != nil {
+		if _, err := notify.New(cfg.Notifications, logger); err != nil {
+			issues = append(issues, config.Issue{Severity: config.SeverityError, Path: "notifications", Message: err.Error()})
+		}
+		if _, err := mediaserver.New(cfg.MediaServers, logger); err != nil {
+			issues = append(issues, config.Issue{Severity: config.SeverityError, Path: "mediaServers", Message: err.Error()})
+		}
+		if online && cfg.Sonarr.URL != "" {
+			issues = append(issues, onlineIssues(cfg, logger)...)
+		}
+	}
+
+	if cfg != nil {
+		// The effective configuration after the environment layer, secret
+		// files and migrations, so what a scan would use is visible
+		effective, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+		if err != nil {
+			return fatal(logger, err)
+		}
+		fmt.Printf("Effective configuration:\n%s\n\n", effective)
+	}
+
+	errorCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if issue.Severity == config.SeverityError {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		fmt.Printf("%s: %d error(s), %d warning(s)\n", g.configPath, errorCount, len(issues)-errorCount)
+		return exitFatal
+	}
+	fmt.Printf("%s is valid (%d warning(s))\n", g.configPath, len(issues))
+	return exitOK
+}
+
+// checkConfig reads the configuration at path and returns it with the
+// problems found in it. The config is nil when it could not be decoded at all.
+// A missing file is not created but stands for the defaults when the
+// environment layer is set.
+func checkConfig(path string) (*config.Config, []config.Issue, error) {
+	data, source := config.DefaultData(), config.SourceDefault
+	if _, err := os.Stat(path); err == nil || !config.HasEnv(os.Environ()) {
+		if data, err = config.ReadFile(path); err != nil {
+			return nil, nil, err
+		}
+		source = config.SourceFile
+	}
+
+	issues, err := config.CheckKeys(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not valid JSON: %w", path, err)
+	}
+	cfg, err := config.Merge(data, source)
+	var unknown *config.UnknownKeysError
+	switch {
+	case errors.As(err, &unknown):
+		// CheckKeys already reported them
+		return nil, issues, nil
+	case err != nil:
+		return nil, append(issues, config.Issue{Severity: config.SeverityError, Message: err.Error()}), nil
+	}
+	if err := cfg.LoadRules(path); err != nil {
+		return nil, append(issues, config.Issue{Severity: config.SeverityError, Path: "rulesFile", Message: err.Error()}), nil
+	}
+	if err := cfg.LoadPresets(path, nil); err != nil {
+		// The error names the entry of parsing.presetFiles
+		return nil, append(issues, config.Issue{Severity: config.SeverityError, Message: err.Error()}), nil
+	}
+	return cfg, append(issues, cfg.Validate()...), nil
+}
+
+// onlineIssues checks the settings that refer to things in Sonarr.
+func onlineIssues(cfg *config.Config, logger *logging.Logger) []config.Issue {
+	var issues []config.Issue
+	add := func(severity config.Severity, path, format string, args ...any) {
+		issues = append(issues, config.Issue{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	client := sonarr.NewClient(cfg.Sonarr.URL, cfg.Sonarr.APIKey, nil, logger)
+	client.SetHeaders(cfg.Sonarr.Headers)
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+
+	if _, err := client.SystemStatus(ctx); err != nil {
+		add(config.SeverityError, "sonarr.url", "cannot reach Sonarr: %v", err)
+		return issues
+	}
+
+	if profiles, err := client.QualityProfiles(ctx); err != nil {
+		add(config.SeverityError, "sonarr.qualityProfile", "failed to read quality profiles: %v", err)
+	} else {
+		has := func(id int) bool {
+			return slices.ContainsFunc(profiles, func(p sonarr.QualityProfile) bool { return p.ID == id })
+		}
+		if !has(cfg.Sonarr.QualityProfile) {
+			add(config.SeverityError, "sonarr.qualityProfile", "Sonarr has no quality profile %d; valid profiles are %s", cfg.Sonarr.QualityProfile, importer.QualityProfileList(profiles))
+		}
+		for i, f := range cfg.Folders {
+			if f.QualityProfile != 0 && !has(f.QualityProfile) {
+				add(config.SeverityError, fmt.Sprintf("folders[%d].qualityProfile", i), "Sonarr has no quality profile %d; valid profiles are %s", f.QualityProfile, importer.QualityProfileList(profiles))
+			}
+		}
+	}
+
+	// Sonarr v4 dropped language profiles, so their absence is not an error
+	if profiles, err := client.LanguageProfiles(ctx); err == nil && len(profiles) > 0 &&
+		!slices.ContainsFunc(profiles, func(p sonarr.LanguageProfile) bool { return p.ID == cfg.Sonarr.LanguageProfile }) {
+		add(config.SeverityError, "sonarr.languageProfile", "Sonarr has no language profile %d", cfg.Sonarr.LanguageProfile)
+	}
+
+	if folders, err := client.RootFolders(ctx); err != nil {
+		add(config.SeverityError, "sonarr.rootFolder", "failed to read root folders: %v", err)
+	} else {
+		i := slices.IndexFunc(folders, func(f sonarr.RootFolder) bool {
+			return strings.TrimRight(f.Path, "/\\") == strings.TrimRight(cfg.Sonarr.RootFolder, "/\\")
+		})
+		switch {
+		case i < 0:
+			add(config.SeverityError, "sonarr.rootFolder", "%s is not a root folder in Sonarr", cfg.Sonarr.RootFolder)
+		case !folders[i].Accessible:
+			add(config.SeverityWarning, "sonarr.rootFolder", "Sonarr reports %s as inaccessible", cfg.Sonarr.RootFolder)
+		}
+	}
+
+	for i, inst := range cfg.Instances {
+		path := fmt.Sprintf("instances[%d].qualityProfile", i)
+		s := cfg.InstanceSonarr(inst)
+		instClient := sonarr.NewClient(s.URL, s.APIKey, nil, logger)
+		instClient.SetHeaders(s.Headers)
+		profiles, err := instClient.QualityProfiles(ctx)
+		switch {
+		case err != nil:
+			add(config.SeverityWarning, path, "cannot read the quality profiles of instance %s: %v", inst.Name, err)
+		case !slices.ContainsFunc(profiles, func(p sonarr.QualityProfile) bool { return p.ID == s.QualityProfile }):
+			add(config.SeverityError, path, "instance %s has no quality profile %d; valid profiles are %s", inst.Name, s.QualityProfile, importer.QualityProfileList(profiles))
+		}
+	}
+	return issues
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// initFlags are the flags of config init.
+type initFlags struct {
+	force          bool
+	nonInteractive bool
+	url            string
+	apiKey         string
+	qualityProfile string
+	rootFolder     string
+	downloads      string
+	format         string
+}
+
+func (f *initFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.force, "force", false, "init: overwrite an existing configuration file")
+	fs.BoolVar(&f.nonInteractive, "non-interactive", false, "init: don't prompt; use the flags below and keep ${...} placeholders for the rest")
+	fs.StringVar(&f.url, "url", "", "init: Sonarr URL")
+	fs.StringVar(&f.apiKey, "api-key", "", "init: Sonarr API key")
+	fs.StringVar(&f.qualityProfile, "quality-profile", "", "init: quality profile ID or name")
+	fs.StringVar(&f.rootFolder, "root-folder", "", "init: Sonarr root folder for new series")
+	fs.StringVar(&f.downloads, "downloads", "", "init: downloads folder to scan")
+	fs.StringVar(&f.format, "format", "", "init: file format, json, yaml or toml; replaces the extension of -c")
+}
+
+func runConfigInit(g *globals, f initFlags) int {
+	logger, err := g.newLogger()
+	if err != nil {
+		return fatal(nil, err)
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	format := config.FormatOf(g.configPath)
+	if f.format != "" {
+		if format, err = config.ParseFormat(f.format); err != nil {
+			return fatal(logger, err)
+		}
+	} else if !f.nonInteractive {
+		if format, err = p.chooseFormat(format); err != nil {
+			return fatal(logger, err)
+		}
+	}
+	path := strings.TrimSuffix(g.configPath, filepath.Ext(g.configPath)) + format.Ext()
+	if _, err := os.Stat(path); err == nil && !f.force {
+		return fatal(logger, fmt.Errorf("%s already exists; use -force to overwrite it", path))
+	}
+
+	cfg := config.Default()
+	if f.nonInteractive {
+		err = f.apply(&cfg, logger)
+	} else {
+		err = runWizard(&cfg, f, p, logger)
+	}
+	if err != nil {
+		return fatal(logger, err)
+	}
+	g.configPath = path
+
+	if err := config.Write(g.configPath, cfg); err != nil {
+		return fatal(logger, err)
+	}
+	logger.Infof("Wrote %s", g.configPath)
+	return exitOK
+}
+
+// apply copies the values given on the command line into cfg. Quality profile
+// names are resolved against Sonarr, which needs the URL and API key.
+func (f *initFlags) apply(cfg *config.Config, logger *logging.Logger) error {
+	if f.url != "" {
+		cfg.Sonarr.URL = f.url
+	}
+	if f.apiKey != "" {
+		cfg.Sonarr.APIKey = f.apiKey
+	}
+	if f.rootFolder != "" {
+		cfg.Sonarr.RootFolder = f.rootFolder
+	}
+	if f.downloads != "" {
+		cfg.Sonarr.DownloadsFolder = f.downloads
+	}
+	if f.qualityProfile != "" {
+		url, err := config.Expand(cfg.Sonarr.URL, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		apiKey, err := config.Expand(cfg.Sonarr.APIKey, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		client := sonarr.NewClient(url, apiKey, nil, logger)
+		id, err := resolveQualityProfile(context.Background(), client, f.qualityProfile)
+		if err != nil {
+			return fmt.Errorf("invalid -quality-profile: %w", err)
+		}
+		cfg.Sonarr.QualityProfile = id
+	}
+	return nil
+}
+
+// runWizard asks for the Sonarr connection, profile and folders, checking each
+// answer before moving on. Flags that were given are used as the defaults.
+func runWizard(cfg *config.Config, f initFlags, p *prompter, logger *logging.Logger) error {
+	fmt.Fprintln(p.out, "Setting up SonarrAutoImport. Press enter to accept the value in brackets.")
+
+	url := firstNonEmpty(f.url, os.Getenv("SONARR_URL"), "http://localhost:8989")
+	apiKey := firstNonEmpty(f.apiKey, os.Getenv("SONARR_API_KEY"))
+	var client *sonarr.Client
+	for {
+		var err error
+		if url, err = p.ask("Sonarr URL", url); err != nil {
+			return err
+		}
+		if apiKey, err = p.ask("Sonarr API key (Settings > General)", apiKey); err != nil {
+			return err
+		}
+		client = sonarr.NewClient(url, apiKey, nil, logger)
+		ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+		status, err := client.SystemStatus(ctx)
+		cancel()
+		if err == nil {
+			fmt.Fprintf(p.out, "Connected to %s %s\n", status.AppName, status.Version)
+			break
+		}
+		fmt.Fprintf(p.out, "Cannot connect: %v\n", err)
+	}
+	cfg.Sonarr.URL = url
+	cfg.Sonarr.APIKey = apiKey
+
+	ctx := context.Background()
+	profiles, err := client.QualityProfiles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read quality profiles: %w", err)
+	}
+	names := make([]string, len(profiles))
+	for i, profile := range profiles {
+		names[i] = profile.Name
+	}
+	i, err := p.choose("Quality profile for new series", names)
+	if err != nil {
+		return err
+	}
+	cfg.Sonarr.QualityProfile = profiles[i].ID
+
+	folders, err := client.RootFolders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read root folders: %w", err)
+	}
+	paths := make([]string, len(folders))
+	for i, folder := range folders {
+		paths[i] = folder.Path
+	}
+	if i, err = p.choose("Root folder for new series", paths); err != nil {
+		return err
+	}
+	cfg.Sonarr.RootFolder = folders[i].Path
+
+	downloads := firstNonEmpty(f.downloads, cfg.Sonarr.DownloadsFolder)
+	for {
+		if downloads, err = p.ask("Downloads folder to scan", downloads); err != nil {
+			return err
+		}
+		if info, err := os.Stat(downloads); err != nil {
+			fmt.Fprintf(p.out, "Cannot use it: %v\n", err)
+		} else if !info.IsDir() {
+			fmt.Fprintf(p.out, "Cannot use it: %s is not a directory\n", downloads)
+		} else {
+			break
+		}
+	}
+	cfg.Sonarr.DownloadsFolder = downloads
+	return nil
+}
+
+// chooseFormat asks for the file format, offering def first.
+func (p *prompter) chooseFormat(def config.Format) (config.Format, error) {
+	for {
+		answer, err := p.ask("Config format (json, yaml or toml; yaml and toml allow comments)", string(def))
+		if err != nil {
+			return "", err
+		}
+		format, err := config.ParseFormat(answer)
+		if err == nil {
+			return format, nil
+		}
+		fmt.Fprintln(p.out, err)
+	}
+}
+
+// prompter asks questions on a terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer to question, or def when the answer is empty.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("no answer to %q: %w", question, err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// choose lists options and returns the index of the one picked.
+func (p *prompter) choose(question string, options []string) (int, error) {
+	if len(options) == 0 {
+		return 0, fmt.Errorf("%s: Sonarr has none configured", question)
+	}
+	fmt.Fprintf(p.out, "%s:\n", question)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, option)
+	}
+	for {
+		answer, err := p.ask("Choice", "1")
+		if err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(p.out, "Enter a number between 1 and %d\n", len(options))
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
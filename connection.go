@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/notify"
+	"sonarr-autoimport/internal/qbittorrent"
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// connectionTimeout bounds the Sonarr status request of test-connection.
+const connectionTimeout = 15 * time.Second
+
+func testConnectionCommand() *command {
+	return &command{
+		name:    "test-connection",
+		summary: "Check that Sonarr is reachable and the API key is valid",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			notifications := fs.Bool("notifications", false, "Also send a sample event to every notification target")
+			return func(g *globals, args []string) int {
+				return runTestConnection(g, *notifications)
+			}
+		},
+	}
+}
+
+func runTestConnection(g *globals, notifications bool) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	if err := testSonarr(ctx, "", cfg.Sonarr, logger); err != nil {
+		return fatal(logger, err)
+	}
+	for _, inst := range cfg.Instances {
+		if err := testSonarr(ctx, inst.Name, cfg.InstanceSonarr(inst), logger); err != nil {
+			return fatal(logger, err)
+		}
+	}
+	if cfg.Radarr.URL != "" {
+		client := radarr.NewClient(cfg.Radarr.URL, cfg.Radarr.APIKey, nil, logger)
+		client.SetHeaders(cfg.Radarr.Headers)
+		status, err := client.SystemStatus(ctx)
+		if err != nil {
+			return fatal(logger, fmt.Errorf("cannot reach Radarr at %s: %w", client.BaseURL(), err))
+		}
+		fmt.Printf("Connected to %s %s at %s\n", status.AppName, status.Version, client.BaseURL())
+	}
+	if q := cfg.QBittorrent; q.URL != "" {
+		client := qbittorrent.NewClient(q.URL, q.Username, q.Password, logger)
+		version, err := client.Version(ctx)
+		if err != nil {
+			return fatal(logger, fmt.Errorf("cannot reach qBittorrent at %s: %w", client.BaseURL(), err))
+		}
+		fmt.Printf("Connected to qBittorrent %s at %s\n", version, client.BaseURL())
+	}
+
+	if !notifications {
+		return exitOK
+	}
+	return testNotifications(logger, cfg)
+}
+
+// testSonarr checks that the Sonarr instance of s answers with its API key.
+// name is empty for the instance of the sonarr section.
+func testSonarr(ctx context.Context, name string, s config.SonarrConfig, logger *logging.Logger) error {
+	client := sonarr.NewClient(s.URL, s.APIKey, nil, logger)
+	client.SetHeaders(s.Headers)
+	label := "Sonarr"
+	if name != "" {
+		label = fmt.Sprintf("Sonarr instance %s", name)
+	}
+	status, err := client.SystemStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot reach %s at %s: %w", label, client.BaseURL(), err)
+	}
+	fmt.Printf("Connected to %s %s at %s\n", status.AppName, status.Version, client.BaseURL())
+	return nil
+}
+
+// testNotifications sends a sample event to every notification target.
+func testNotifications(logger *logging.Logger, cfg *config.Config) int {
+	notifier, err := notify.New(cfg.Notifications, logger)
+	if err != nil {
+		return fatal(logger, fmt.Errorf("invalid notification configuration: %w", err))
+	}
+	if notifier.Len() == 0 {
+		return fatal(logger, errors.New("no notification targets configured"))
+	}
+	if failed := notifier.Test(context.Background()); failed > 0 {
+		return fatal(logger, fmt.Errorf("%d of %d notification targets failed", failed, notifier.Len()))
+	}
+	fmt.Printf("Sent a sample event to %d notification target(s)\n", notifier.Len())
+	return exitOK
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"sonarr-autoimport/internal/importer"
+)
+
+// dryRunFlag is -dry-run, which takes no value for the logged plan or
+// -dry-run=json to also print the plan as JSON.
+type dryRunFlag struct {
+	enabled bool
+	json    bool
+}
+
+func (d *dryRunFlag) IsBoolFlag() bool { return true }
+
+func (d *dryRunFlag) String() string {
+	if d == nil || !d.enabled {
+		return "false"
+	}
+	if d.json {
+		return "json"
+	}
+	return "true"
+}
+
+func (d *dryRunFlag) Set(value string) error {
+	if value == "json" {
+		d.enabled, d.json = true, true
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("want true, false or json")
+	}
+	d.enabled, d.json = enabled, false
+	return nil
+}
+
+// planWriter prints the files of every dry-run scan, with their plans, as
+// JSON.
+type planWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *planWriter) FileProcessed(importer.FileResult) {}
+
+func (p *planWriter) ScanFinished(r *importer.ScanResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.Files)
+}
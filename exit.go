@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"sonarr-autoimport/internal/daemon"
+	"sonarr-autoimport/internal/importer"
+)
+
+// Exit statuses of a one-shot run.
+const (
+	exitOK          = 0
+	exitFatal       = 1
+	exitFailed      = 2
+	exitSkipped     = 3
+	exitFirstRun    = 4
+	exitInterrupted = 130
+)
+
+var exitCodes = []struct {
+	code        int
+	description string
+}{
+	{exitOK, "every file was imported, or there was nothing to process"},
+	{exitFatal, "fatal error, such as an invalid config or Sonarr being unreachable"},
+	{exitFailed, "some files failed to import"},
+	{exitSkipped, "some files were skipped because no series matched them (only with -fail-on-skip)"},
+	{exitFirstRun, "no config file was found, so a default one was created to be edited"},
+	{exitInterrupted, "interrupted by SIGINT or SIGTERM"},
+}
+
+// exitStatus derives the exit status of a one-shot run from its result.
+// Unmatched files only count against the run when failOnSkip is set.
+func exitStatus(result *importer.ScanResult, err error, failOnSkip bool) int {
+	switch {
+	case result != nil && result.Interrupted:
+		return exitInterrupted
+	case daemon.CycleFailed(result, err):
+		return exitFatal
+	case result.Failed > result.Unmatched():
+		return exitFailed
+	case failOnSkip && result.Unmatched() > 0:
+		return exitSkipped
+	}
+	return exitOK
+}
+
+// printExitCodes writes the exit status table for the usage text.
+func printExitCodes(w io.Writer) {
+	fmt.Fprintf(w, "\nExit status:\n")
+	for _, c := range exitCodes {
+		fmt.Fprintf(w, "  %-5d %s\n", c.code, c.description)
+	}
+}
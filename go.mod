@@ -1,3 +1,10 @@
 module sonarr-autoimport
 
 go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/sys v0.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
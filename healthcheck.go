@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/daemon"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/state"
+)
+
+// defaultHealthTimeout bounds each check of healthcheck, well within the
+// timeout of a Docker HEALTHCHECK.
+const defaultHealthTimeout = 5 * time.Second
+
+func healthcheckCommand() *command {
+	return &command{
+		name:    "healthcheck",
+		summary: "Exit 0 only when the importer can do its job, for container healthchecks",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var opts healthOptions
+			fs.BoolVar(&opts.daemon, "daemon", false, "Also check that the running daemon keeps finishing scans")
+			fs.DurationVar(&opts.timeout, "timeout", defaultHealthTimeout, "How long each check may take")
+			fs.DurationVar(&opts.maxAge, "max-age", 0, "With -daemon, how old the last finished scan cycle may be (default three scan periods)")
+			return func(g *globals, args []string) int {
+				return runHealthcheck(g, opts)
+			}
+		},
+	}
+}
+
+type healthOptions struct {
+	daemon  bool
+	timeout time.Duration
+	maxAge  time.Duration
+}
+
+// runHealthcheck prints "ok" and returns exitOK when every check passes, and
+// otherwise prints the reason of the first failed check.
+func runHealthcheck(g *globals, opts healthOptions) int {
+	logger, cfg, err := g.load()
+	if err == nil {
+		// The reason is the only output, so warnings do not clutter it
+		logger.SetLevel(logging.LevelError)
+		err = checkHealth(g, cfg, logger, opts)
+	}
+	if err != nil {
+		fmt.Printf("unhealthy: %v\n", err)
+		return exitFatal
+	}
+	fmt.Println("ok")
+	return exitOK
+}
+
+// checkHealth returns why the importer cannot do its job, if it cannot.
+func checkHealth(g *globals, cfg *config.Config, logger *logging.Logger, opts healthOptions) error {
+	if err := checkReadable(cfg.Sonarr.DownloadsFolder); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	client := sonarr.NewClient(cfg.Sonarr.URL, cfg.Sonarr.APIKey, nil, logger)
+	client.SetHeaders(cfg.Sonarr.Headers)
+	if _, err := client.SystemStatus(ctx); err != nil {
+		return fmt.Errorf("Sonarr at %s did not answer: %w", client.BaseURL(), err)
+	}
+
+	if !opts.daemon {
+		return nil
+	}
+	if cfg.Daemon.ListenAddr != "" {
+		return checkHealthz(cfg.Daemon.ListenAddr, opts.timeout)
+	}
+	return checkHeartbeat(state.HeartbeatPath(stateDir(g, cfg)), cfg, logger, opts.maxAge)
+}
+
+// checkReadable checks that the downloads folder can be listed.
+func checkReadable(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("downloads folder: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("downloads folder %s is not readable: %w", dir, err)
+	}
+	return nil
+}
+
+// checkHealthz asks the /healthz endpoint of the daemon listening on addr,
+// which also detects a stuck scan loop.
+func checkHealthz(addr string, timeout time.Duration) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid daemon.listenAddr: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/healthz")
+	if err != nil {
+		return fmt.Errorf("daemon status endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon reports %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkHeartbeat checks the heartbeat the daemon writes after every scan
+// cycle, for daemons without a status listener.
+func checkHeartbeat(path string, cfg *config.Config, logger *logging.Logger, maxAge time.Duration) error {
+	hb, err := state.ReadHeartbeat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no daemon heartbeat in %s yet", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read daemon heartbeat: %w", err)
+	}
+	if maxAge == 0 {
+		period, err := scanPeriod(cfg, logger)
+		if err != nil {
+			return fmt.Errorf("invalid daemon configuration: %w", err)
+		}
+		maxAge = daemon.MaxCycleAge(period)
+	}
+	if age := time.Since(hb.Time); age > maxAge {
+		return fmt.Errorf("the daemon finished no scan cycle for %v, its scan loop is stuck or it is not running", age.Round(time.Second))
+	}
+	return nil
+}
+
+// scanPeriod returns the longest time between the scheduled scans of the
+// daemon: the rescan interval in watch and snapshot mode, which falls back
+// to the scan interval when those modes fail.
+func scanPeriod(cfg *config.Config, logger *logging.Logger) (time.Duration, error) {
+	period, err := daemonInterval(cfg, logger)
+	if err != nil || cfg.Daemon.ScanMode() == config.ScanPoll {
+		return period, err
+	}
+	rescan, err := cfg.Daemon.RescanIntervalDuration()
+	return max(period, rescan), err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/logging"
+)
+
+func historyCommand() *command {
+	return &command{
+		name:    "history",
+		args:    "[list|failures|prune]",
+		summary: "Show what earlier runs imported or failed to import",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var opts historyFlags
+			fs.IntVar(&opts.limit, "n", 50, "list: show at most `N` records, newest last (0 for all)")
+			fs.StringVar(&opts.series, "series", "", "list, failures: only records whose title contains `text`")
+			fs.BoolVar(&opts.json, "json", false, "list, failures: print the records as JSON")
+			fs.StringVar(&opts.olderThan, "older-than", "", "prune: remove records older than `age`, such as 720h or 30d")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "history prune -older-than 30d"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				action := "list"
+				if len(args) > 0 {
+					action, args = args[0], args[1:]
+				}
+				if len(args) > 0 {
+					fmt.Fprintf(os.Stderr, "Unexpected arguments %q\n", strings.Join(args, " "))
+					return exitFatal
+				}
+				switch action {
+				case "list", "failures":
+					return runHistoryList(g, opts, action == "failures")
+				case "prune":
+					return runHistoryPrune(g, opts.olderThan)
+				}
+				fmt.Fprintf(os.Stderr, "Unknown history command %q\n", action)
+				return exitFatal
+			}
+		},
+	}
+}
+
+type historyFlags struct {
+	limit     int
+	series    string
+	json      bool
+	olderThan string
+}
+
+// openHistory returns the history in the state directory of the
+// configuration.
+func openHistory(g *globals) (*history.Store, *logging.Logger, error) {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return nil, logger, err
+	}
+	return history.Open(stateDir(g, cfg)), logger, nil
+}
+
+// runHistoryList prints the history, or with failuresOnly the files whose
+// last attempt failed.
+func runHistoryList(g *globals, opts historyFlags, failuresOnly bool) int {
+	store, logger, err := openHistory(g)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	records, err := store.Records()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if failuresOnly {
+		records = history.Pending(records)
+	}
+	if opts.series != "" {
+		filtered := records[:0]
+		for _, r := range records {
+			if strings.Contains(strings.ToLower(r.Title), strings.ToLower(opts.series)) {
+				filtered = append(filtered, r)
+			}
+		}
+		records = filtered
+	}
+	if !failuresOnly && opts.limit > 0 && len(records) > opts.limit {
+		records = records[len(records)-opts.limit:]
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if records == nil {
+			records = []history.Record{}
+		}
+		if err := enc.Encode(records); err != nil {
+			return fatal(logger, err)
+		}
+		return exitOK
+	}
+	if len(records) == 0 {
+		fmt.Println("No matching history")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tTITLE\tFILE\tDETAILS")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format("2006-01-02 15:04"), r.Action, recordTitle(r), logging.Escape(filepath.Base(r.Path)), recordDetails(r))
+	}
+	w.Flush()
+	return exitOK
+}
+
+// recordTitle names the episode or movie of r.
+func recordTitle(r history.Record) string {
+	switch {
+	case r.Title == "":
+		return "-"
+	case r.MovieID != 0 || r.Year != 0 && r.Episode == 0:
+		return fmt.Sprintf("%s (%d)", r.Title, r.Year)
+	}
+	return fmt.Sprintf("%s S%02dE%02d", r.Title, r.Season, r.Episode)
+}
+
+// recordDetails describes the outcome of r.
+func recordDetails(r history.Record) string {
+	if r.Failed() {
+		return fmt.Sprintf("%s: %s", r.Category, r.Error)
+	}
+	var details []string
+	if r.Quality != "" {
+		details = append(details, r.Quality)
+	}
+	if r.Instance != "" {
+		details = append(details, "on "+r.Instance)
+	}
+	if r.Latency > 0 {
+		details = append(details, "after "+r.Latency.Round(time.Second).String())
+	}
+	return strings.Join(details, ", ")
+}
+
+func runHistoryPrune(g *globals, olderThan string) int {
+	if olderThan == "" {
+		fmt.Fprintln(os.Stderr, "history prune needs -older-than, such as -older-than 30d")
+		return exitFatal
+	}
+	age, err := parseAge(olderThan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -older-than: %v\n", err)
+		return exitFatal
+	}
+	store, logger, err := openHistory(g)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	removed, err := store.Prune(time.Now().Add(-age))
+	if err != nil {
+		return fatal(logger, err)
+	}
+	fmt.Printf("Removed %d record(s) older than %s from %s\n", removed, olderThan, store.Path())
+	return exitOK
+}
+
+// parseAge parses a duration that may also be given in days, such as 30d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
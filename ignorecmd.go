@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/logging"
+)
+
+func ignoreCommand() *command {
+	return &command{
+		name:    "ignore",
+		args:    "add|remove <path>... | list",
+		summary: "Manage the files that scans skip",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			reason := fs.String("reason", "", "add: why the files are ignored")
+			exact := fs.Bool("exact", false, "add: only while the file keeps its size and modification time, so a replaced file is imported")
+			jsonOut := fs.Bool("json", false, "list: print the entries as JSON")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "ignore add -exact file.mkv"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				if len(args) == 0 {
+					fmt.Fprintln(os.Stderr, "ignore needs one of add, remove or list")
+					return exitFatal
+				}
+				action, paths := args[0], args[1:]
+				switch {
+				case action == "list" && len(paths) == 0:
+					return runIgnoreList(g, *jsonOut)
+				case (action == "add" || action == "remove") && len(paths) == 0:
+					fmt.Fprintf(os.Stderr, "ignore %s needs at least one path\n", action)
+					return exitFatal
+				case action == "add":
+					return runIgnoreAdd(g, paths, *reason, *exact)
+				case action == "remove":
+					return runIgnoreRemove(g, paths)
+				}
+				fmt.Fprintf(os.Stderr, "Unknown ignore command %q\n", strings.Join(args, " "))
+				return exitFatal
+			}
+		},
+	}
+}
+
+// openIgnoreList returns the ignore list in the state directory of the
+// configuration.
+func openIgnoreList(g *globals) (*history.IgnoreList, *logging.Logger, error) {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return nil, logger, err
+	}
+	list, err := history.OpenIgnoreList(stateDir(g, cfg), 0, logger)
+	return list, logger, err
+}
+
+func runIgnoreAdd(g *globals, paths []string, reason string, exact bool) int {
+	list, logger, err := openIgnoreList(g)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	status := exitOK
+	for _, path := range paths {
+		entry, err := list.Add(path, reason, exact)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to ignore %s: %v\n", path, err)
+			status = exitFatal
+			continue
+		}
+		fmt.Printf("Ignoring %s\n", logging.Escape(entry.Path))
+	}
+	return status
+}
+
+func runIgnoreRemove(g *globals, paths []string) int {
+	list, logger, err := openIgnoreList(g)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	status := exitOK
+	for _, path := range paths {
+		found, err := list.Remove(path)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", path, err)
+			status = exitFatal
+		case !found:
+			fmt.Printf("%s was not ignored\n", path)
+		default:
+			fmt.Printf("No longer ignoring %s\n", path)
+		}
+	}
+	return status
+}
+
+func runIgnoreList(g *globals, jsonOut bool) int {
+	list, logger, err := openIgnoreList(g)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	entries, err := list.Entries()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return fatal(logger, err)
+		}
+		return exitOK
+	}
+	if len(entries) == 0 {
+		fmt.Println("No files are ignored")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tADDED\tMATCH\tREASON")
+	for _, e := range entries {
+		match := "path"
+		if e.Exact() {
+			match = "this version"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", logging.Escape(e.Path), e.Added.Local().Format("2006-01-02 15:04"), match, e.Reason)
+	}
+	w.Flush()
+	return exitOK
+}
@@ -0,0 +1,1122 @@
+// Package config loads the tool's configuration, written in JSON, YAML or
+// TOML.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+// Config is the top-level configuration file.
+//
+// Credentials such as Sonarr's API key have a companion setting with a File
+// suffix, apikeyFile for apikey, that names a file holding the value instead.
+// Docker and Kubernetes secrets are mounted that way. The file is read when
+// the configuration is loaded and takes precedence over the plain setting.
+type Config struct {
+	Sonarr SonarrConfig `json:"sonarr"`
+	// Instances are further Sonarr instances that Routes send files to.
+	Instances []InstanceConfig `json:"instances"`
+	// Routes pick the instance of each file. Files no route matches go to
+	// the instance of the sonarr section.
+	Routes []RouteConfig `json:"routes"`
+	// Folders override the series settings for files below them.
+	Folders []FolderConfig `json:"folders"`
+	// Radarr receives the files recognised as movies.
+	Radarr RadarrConfig `json:"radarr"`
+	// QBittorrent is asked whether files are still downloading or seeding.
+	QBittorrent QBittorrentConfig `json:"qbittorrent"`
+	Parsing     ParsingConfig     `json:"parsing"`
+	// Groups adjust parsing and importing for the files of the release
+	// groups they are keyed by, which are matched ignoring case.
+	Groups     map[string]GroupConfig `json:"groups"`
+	Transforms []parser.Transform     `json:"transforms"`
+	// RulesFile is a rules file, relative to the config file unless it is
+	// absolute, whose aliases, transforms and groups are merged into these.
+	RulesFile string       `json:"rulesFile"`
+	Daemon    DaemonConfig `json:"daemon"`
+	// Retry controls the retries of files that failed for a reason that may
+	// go away by itself.
+	Retry RetryConfig `json:"retry"`
+	// Ignore controls the ignore list managed by the ignore command.
+	Ignore IgnoreConfig `json:"ignore"`
+	// Dedupe controls the skipping of files whose content was imported
+	// before.
+	Dedupe DedupeConfig `json:"dedupe"`
+	// IO limits the local file reads, such as fingerprinting.
+	IO IOConfig `json:"io"`
+	// Notifications lists where import events are sent.
+	Notifications NotificationsConfig `json:"notifications"`
+	// MediaServers are refreshed after a scan that imported something.
+	MediaServers []MediaServerConfig `json:"mediaServers"`
+	// LogLevel is "error", "warn", "info", "debug" or "trace". The -log-level
+	// and -v flags take precedence.
+	LogLevel string `json:"logLevel"`
+	// StateDir holds the lock file and other files the tool maintains. It
+	// defaults to the directory of the config file.
+	StateDir string `json:"stateDir"`
+
+	// Sources tells for each top-level key whether it came from the file,
+	// the defaults or environment variables.
+	Sources map[string]string `json:"-"`
+	// Migrated warns about the legacy settings that were moved to their
+	// current keys or dropped while loading.
+	Migrated []Issue `json:"-"`
+	// Rules is the rules file LoadRules merged from RulesPath, if any.
+	Rules     *Rules `json:"-"`
+	RulesPath string `json:"-"`
+	// Presets are the presets of parsing.presetFiles that LoadPresets read.
+	Presets []LoadedPreset `json:"-"`
+
+	// ownTransforms is the number of transforms that were not merged from
+	// Rules, and ruleGroups names the groups that were.
+	ownTransforms int
+	ruleGroups    []string
+}
+
+// SonarrConfig describes the Sonarr instance and how new series are added.
+type SonarrConfig struct {
+	URL             string `json:"url"`
+	APIKey          string `json:"apikey"`
+	APIKeyFile      string `json:"apikeyFile,omitempty"`
+	DownloadsFolder string `json:"downloadsFolder"`
+	QualityProfile  int    `json:"qualityProfile"`
+	LanguageProfile int    `json:"languageProfile"`
+	RootFolder      string `json:"rootFolder"`
+	// SeriesType is the type of added series: "standard", "daily" or
+	// "anime". Sonarr's default applies when it is empty.
+	SeriesType string `json:"seriesType"`
+	// PathSeparator is the separator of the paths on Sonarr's system, "/"
+	// or "\\". It is detected from RootFolder when it is empty.
+	PathSeparator string `json:"pathSeparator,omitempty"`
+	// Headers are sent with every request to Sonarr, such as for a reverse
+	// proxy in front of it, and may replace the User-Agent.
+	Headers map[string]string `json:"headers,omitempty"`
+	// ConfirmNewSeries parks the files whose series is not in the library
+	// yet until the approve command approves the series, instead of adding
+	// it. Titles mapped by an alias are added without approval.
+	ConfirmNewSeries bool `json:"confirmNewSeries"`
+	// RollbackNewSeries deletes a series added for a file again when the
+	// import of that file fails and no other file was imported into it, so
+	// a wrong match does not stay in the library. Files are never deleted.
+	RollbackNewSeries bool `json:"rollbackNewSeries"`
+	// FailOnDuplicateSeries fails the files whose title, alias or pin
+	// matches more than one library series instead of picking one of them,
+	// so the duplicates get removed from Sonarr.
+	FailOnDuplicateSeries bool `json:"failOnDuplicateSeries"`
+	// InferSeason picks the season of the files whose name has no season
+	// from the episodes of their series, instead of season 1: the only
+	// season with their episode number or, for a series that is still
+	// airing, its latest monitored season when the episode has no file
+	// there yet.
+	InferSeason bool `json:"inferSeason"`
+	// SkipImportVerification trusts Sonarr's answer to a manual import
+	// instead of checking that its episodes have a file afterwards, for
+	// setups where moving the file takes longer than the check waits.
+	SkipImportVerification bool `json:"skipImportVerification"`
+	// LookupCache is how long a lookup that found no series for a title
+	// keeps the files with the same title from looking it up again,
+	// DefaultLookupCache when empty. "0s" turns the cache off.
+	LookupCache string `json:"lookupCache"`
+	// AdoptExistingFolders adds a series at the folder of the root folder
+	// that Sonarr lists as unmapped and whose name matches its title or
+	// slug, instead of a new folder named after the slug, so series that
+	// were organized by hand keep their folder.
+	AdoptExistingFolders bool `json:"adoptExistingFolders"`
+	// CheckFreeSpace defers the imports that would not fit in the free space
+	// Sonarr reports for their root folder, less FreeSpaceMargin, such as
+	// "10GB".
+	CheckFreeSpace  bool   `json:"checkFreeSpace"`
+	FreeSpaceMargin string `json:"freeSpaceMargin"`
+	// MonitorSeasons picks the seasons an added series monitors: "all", as
+	// the lookup returns them, "file" for only the season of the file that
+	// adds the series, or "fileAndFuture" for that season and the later
+	// ones. "all" applies when it is empty.
+	MonitorSeasons string `json:"monitorSeasons"`
+	// AddOptions tell Sonarr what to do right after adding a series.
+	AddOptions AddOptionsConfig `json:"addOptions"`
+}
+
+// AddOptionsConfig are the add options of Sonarr's series API.
+type AddOptionsConfig struct {
+	// SearchForMissingEpisodes searches for the missing episodes of the
+	// monitored seasons once the series is added.
+	SearchForMissingEpisodes   bool `json:"searchForMissingEpisodes"`
+	IgnoreEpisodesWithFiles    bool `json:"ignoreEpisodesWithFiles"`
+	IgnoreEpisodesWithoutFiles bool `json:"ignoreEpisodesWithoutFiles"`
+}
+
+// MonitorSeasonsModes are the valid values of SonarrConfig.MonitorSeasons.
+var MonitorSeasonsModes = []string{"all", "file", "fileAndFuture"}
+
+// normalizeURLs strips the trailing slashes of the Sonarr and Radarr URLs,
+// which would double the slash before every API path.
+func (c *Config) normalizeURLs() {
+	c.Sonarr.URL = strings.TrimRight(c.Sonarr.URL, "/")
+	for i := range c.Instances {
+		c.Instances[i].URL = strings.TrimRight(c.Instances[i].URL, "/")
+	}
+	c.Radarr.URL = strings.TrimRight(c.Radarr.URL, "/")
+}
+
+// checkURLs returns an error for the first Sonarr or Radarr URL that is not
+// an absolute HTTP or HTTPS URL, so no command starts with one that cannot
+// work. Empty URLs are left to Validate.
+func (c *Config) checkURLs() error {
+	var err error
+	add := func(_ Severity, path, format string, args ...any) {
+		if err == nil {
+			err = fmt.Errorf("invalid URL: %s: %s", path, fmt.Sprintf(format, args...))
+		}
+	}
+	check := func(path, raw string) {
+		if raw != "" {
+			checkURL(add, path, raw)
+		}
+	}
+	check("sonarr.url", c.Sonarr.URL)
+	for i, inst := range c.Instances {
+		check(fmt.Sprintf("instances[%d].url", i), inst.URL)
+	}
+	check("radarr.url", c.Radarr.URL)
+	return err
+}
+
+// SeriesPath returns the path in Sonarr of a series added in folder below the
+// root folder.
+func (c SonarrConfig) SeriesPath(folder string) string {
+	return JoinRemote(c.PathSeparator, c.RootFolder, folder)
+}
+
+// FreeSpaceMarginBytes parses FreeSpaceMargin, returning 0 when it is empty.
+func (c SonarrConfig) FreeSpaceMarginBytes() (int64, error) {
+	if c.FreeSpaceMargin == "" {
+		return 0, nil
+	}
+	return ParseSize(c.FreeSpaceMargin)
+}
+
+// RadarrConfig describes the Radarr instance that files recognised as movies
+// are handed to. Movie detection is off when URL is empty.
+type RadarrConfig struct {
+	URL            string `json:"url"`
+	APIKey         string `json:"apikey"`
+	APIKeyFile     string `json:"apikeyFile,omitempty"`
+	QualityProfile int    `json:"qualityProfile"`
+	RootFolder     string `json:"rootFolder"`
+	// Headers are sent with every request to Radarr, like sonarr.headers.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// QBittorrentConfig describes the qBittorrent instance whose torrents must
+// keep their files. The check is off when URL is empty.
+type QBittorrentConfig struct {
+	URL          string `json:"url"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+	// Categories limits the check to the torrents of these categories. Every
+	// torrent is checked when it is empty.
+	Categories []string `json:"categories"`
+	// Action is what happens to a file of a torrent that still needs it:
+	// "skip" leaves it for a later scan, "copy" imports a copy. It defaults
+	// to "skip".
+	Action string `json:"action"`
+	// PathMappings translate paths as qBittorrent sees them into local paths.
+	PathMappings []PathMapping `json:"pathMappings"`
+}
+
+// Torrent actions of QBittorrentConfig.
+const (
+	TorrentSkip = "skip"
+	TorrentCopy = "copy"
+)
+
+// TorrentAction returns Action, defaulting to TorrentSkip.
+func (c QBittorrentConfig) TorrentAction() string {
+	if c.Action == "" {
+		return TorrentSkip
+	}
+	return c.Action
+}
+
+// ParsingConfig holds the filename patterns and scanner settings.
+type ParsingConfig struct {
+	AnimePatterns []parser.AnimePattern `json:"animePatterns"`
+	// PresetFiles are shareable sets of anime patterns, each the name of a
+	// built-in preset such as "community-default", the path of a preset
+	// file, relative to the config file, or an http(s) URL.
+	PresetFiles []string `json:"presetFiles,omitempty"`
+	// PresetMerge is "after" (the default) to try the patterns of the
+	// presets after animePatterns, or "before" to try them first.
+	PresetMerge string `json:"presetMerge,omitempty"`
+	// MoviePatterns recognise movies, which go to Radarr when it is
+	// configured.
+	MoviePatterns   []parser.MoviePattern `json:"moviePatterns"`
+	SeasonPatterns  []string              `json:"seasonPatterns"`
+	EpisodePatterns []string              `json:"episodePatterns"`
+	QualityPatterns []string              `json:"qualityPatterns"`
+	GroupPatterns   []string              `json:"groupPatterns"`
+	Concurrency     int                   `json:"concurrency"`
+	FileLimit       int                   `json:"fileLimit"`
+	// Order is "path" (the default) to process files alphabetically,
+	// "mtime" to process the oldest first, so runs with a file limit make
+	// progress through a backlog, "mtime-desc" for the newest first or
+	// "size" for the smallest first.
+	Order string `json:"order"`
+	// NewFilesFirst processes the files modified since the previous full
+	// scan of the process started before the others, so a daemon with a file
+	// limit imports new episodes ahead of a backlog.
+	NewFilesFirst bool `json:"newFilesFirst"`
+	// FollowSymlinks makes scans descend into symlinked directories. Each
+	// directory is scanned once, so symlink loops end the walk.
+	FollowSymlinks bool `json:"followSymlinks"`
+	// SymlinkFiles is "link" (the default) to import symlinked video files by
+	// the path of the link, or "target" to import the file they point to.
+	SymlinkFiles string `json:"symlinkFiles"`
+	// MaxDepth is how many levels of folders below the downloads folder are
+	// scanned; 0 scans every level.
+	MaxDepth int `json:"maxDepth"`
+	// MaxFiles, when positive, refuses scans that find more video files, as
+	// happens when the downloads folder points at a whole library by mistake.
+	MaxFiles int `json:"maxFiles"`
+	// MaxEpisodeSpan is the number of episodes a multi-episode file such as
+	// "Show - 01-03" may hold, parser.DefaultMaxEpisodeSpan when 0. Files
+	// with a wider range are skipped as possible batch files rather than
+	// imported as some of their episodes.
+	MaxEpisodeSpan int `json:"maxEpisodeSpan"`
+	// RequireFullMatch passes over matches of anime patterns without their
+	// own require that capture no episode or a title longer than
+	// parser.DefaultMaxTitleLength, so a loose pattern early in the list does
+	// not keep the stricter ones after it from matching.
+	RequireFullMatch bool `json:"requireFullMatch"`
+	// FileTimeout is a Go duration string bounding how long a single file may
+	// take from parsing to the import, so one hung Sonarr call does not stall
+	// the scan. Files are not timed out when it is empty.
+	FileTimeout string `json:"fileTimeout"`
+	// SkipRescan leaves the video files that appear in the downloads folder
+	// while a scan runs for the next scan, instead of walking the folder once
+	// more at its end and processing those that have settled.
+	SkipRescan bool `json:"skipRescan"`
+}
+
+// GroupConfig is the profile of a release group.
+type GroupConfig struct {
+	// AnimePatterns are tried before parsing.animePatterns for the files of
+	// the group.
+	AnimePatterns []parser.AnimePattern `json:"animePatterns,omitempty"`
+	// Qualities maps the quality found in a filename, such as "1080p", to
+	// the Sonarr quality files of the group are imported with, such as
+	// "WEBRip-1080p". The key "*" applies to every other quality.
+	Qualities map[string]string `json:"qualities,omitempty"`
+	// Language is the Sonarr language files of the group are imported with.
+	Language string `json:"language,omitempty"`
+	// Trust decides between files of different groups for the same episode
+	// in one scan: a file is not imported when the scan has one of a group
+	// with a higher trust. Groups without a profile have a trust of 0.
+	Trust int `json:"trust,omitempty"`
+}
+
+// Quality returns the Sonarr quality name g maps the filename quality to,
+// or "" when g keeps the quality.
+func (g GroupConfig) Quality(quality string) string {
+	for key, name := range g.Qualities {
+		if strings.EqualFold(key, quality) {
+			return name
+		}
+	}
+	return g.Qualities["*"]
+}
+
+// Group returns the profile of the release group, ignoring case.
+func (c *Config) Group(group string) (GroupConfig, bool) {
+	if g, ok := c.Groups[group]; ok {
+		return g, true
+	}
+	for name, g := range c.Groups {
+		if strings.EqualFold(name, group) {
+			return g, true
+		}
+	}
+	return GroupConfig{}, false
+}
+
+// DaemonConfig controls the periodic scanning of daemon mode.
+type DaemonConfig struct {
+	// Interval is a Go duration string such as "5m" or "90s".
+	Interval string `json:"interval"`
+	// DrainTimeout is how long files that are mid-import may keep running
+	// after a shutdown signal. It applies to one-shot runs as well.
+	DrainTimeout string `json:"drainTimeout"`
+	// Mode is how the daemon finds new files: ScanPoll, ScanWatch or
+	// ScanSnapshot. It follows Watch when it is empty.
+	Mode string `json:"mode"`
+	// Watch processes new files as soon as they appear using filesystem
+	// notifications instead of waiting for the next interval.
+	Watch bool `json:"watch"`
+	// WatchDebounce is how long a directory must be quiet before its new
+	// files are checked, and how long a file must keep its size to count as
+	// finished.
+	WatchDebounce string `json:"watchDebounce"`
+	// RescanInterval is the period of the full safety-net scan in watch mode.
+	RescanInterval string `json:"rescanInterval"`
+	// ListenAddr is the address of the /healthz and /status endpoints, for
+	// example ":8090". The listener is disabled when it is empty.
+	ListenAddr string `json:"listenAddr"`
+	// Webhook configures the download client completion endpoint.
+	Webhook WebhookConfig `json:"webhook"`
+	// PingURL is called after every scan cycle, with "/fail" appended when
+	// the cycle failed, as healthchecks.io and compatible services expect.
+	PingURL     string `json:"pingUrl"`
+	PingURLFile string `json:"pingUrlFile,omitempty"`
+	// PingMethod is the HTTP method of the pings, GET when it is empty or
+	// POST. Both carry the scan summary as their body.
+	PingMethod string `json:"pingMethod"`
+	// PingOneShot also pings after a one-shot run.
+	PingOneShot bool `json:"pingOneShot"`
+	// MaxFilesPerScan limits the files each daemon scan attempts. It takes
+	// precedence over parsing.fileLimit.
+	MaxFilesPerScan int `json:"maxFilesPerScan"`
+	// MaxFileAge is a Go duration string such as "720h". Files modified
+	// longer ago are left out of the full scans of the daemon, so leftovers
+	// that never import are not tried on every scan. Files of any age are
+	// scanned when it is empty.
+	MaxFileAge string `json:"maxFileAge"`
+	// ActiveHours, such as "22:00-08:00", limits scans to a daily window so
+	// imports do not compete with streaming; outside it scans wait for the
+	// window to open. Scans run at any time when it is empty.
+	ActiveHours string `json:"activeHours"`
+	// Timezone is the IANA time zone of ActiveHours, such as
+	// "Europe/Berlin". The local time zone is used when it is empty.
+	Timezone string `json:"timezone"`
+	// LatencyWarning is a Go duration string; a warning is logged after
+	// every scan that imported files that sat in the downloads folder for
+	// longer. It is off when empty.
+	LatencyWarning string `json:"latencyWarning"`
+	// LogRepeatWindow is a Go duration string. Within it a file that keeps
+	// failing with the same kind of error is logged in full once, its
+	// repeats as a short summary. It defaults to DefaultLogRepeatWindow
+	// when empty; "0s" logs every failure in full.
+	LogRepeatWindow string `json:"logRepeatWindow"`
+	// ReportDir receives a timestamped JSON report of every scan.
+	ReportDir string `json:"reportDir"`
+	// ReportRetention is the number of reports kept in ReportDir. Older ones
+	// are deleted; 0 keeps them all.
+	ReportRetention int `json:"reportRetention"`
+	// HistoryRetention is a Go duration string such as "2160h". The daemon
+	// removes older records from the history, checking at most once an
+	// hour. The history is kept whole when it is empty.
+	HistoryRetention string `json:"historyRetention"`
+	// ReloadOnChange reloads the configuration between scans when the file
+	// was modified. SIGHUP reloads it regardless.
+	ReloadOnChange bool `json:"reloadOnChange"`
+	// PauseFile pauses the daemon while the file exists. It is checked
+	// before every scan.
+	PauseFile string `json:"pauseFile"`
+	// EnablePprof serves net/http/pprof and runtime figures below /debug/,
+	// on PprofAddr when it is set and on ListenAddr otherwise. It exposes the
+	// internals of the process and is off by default.
+	EnablePprof bool `json:"enablePprof"`
+	// PprofAddr is a separate address for the profiling endpoints, which
+	// must be a loopback address such as "127.0.0.1:6060".
+	PprofAddr string `json:"pprofAddr"`
+}
+
+// WebhookConfig controls the /webhook endpoint that download clients POST
+// to when a download finishes.
+type WebhookConfig struct {
+	// Token must be sent in the X-Webhook-Token header. The endpoint is
+	// disabled when it is empty.
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Categories limits the calls that trigger a scan to these download
+	// categories. Every category is accepted when it is empty.
+	Categories []string `json:"categories"`
+	// PathMappings translate paths as the download client sees them into
+	// local paths.
+	PathMappings []PathMapping `json:"pathMappings"`
+}
+
+// PathMapping replaces the prefix From of a path with To. Either may be a
+// path of another system, including Windows paths with a drive letter and UNC
+// paths, which are matched ignoring case and separator.
+type PathMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MapPath applies the longest mapping whose From is a prefix of path. The
+// mapped path uses the separator of To.
+func MapPath(mappings []PathMapping, path string) string {
+	var match *PathMapping
+	var rest []string
+	for i := range mappings {
+		m := &mappings[i]
+		if m.From == "" {
+			continue
+		}
+		if rel, ok := remoteRel(path, m.From); ok && (match == nil || len(m.From) > len(match.From)) {
+			match, rest = m, rel
+		}
+	}
+	if match == nil {
+		return path
+	}
+	return JoinRemote("", match.To, rest...)
+}
+
+// hasPathPrefix reports whether path is prefix or lies below it.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = filepath.Clean(prefix)
+	if path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// MediaServerConfig describes a Plex, Jellyfin or Emby server.
+type MediaServerConfig struct {
+	// Type is "plex", "jellyfin" or "emby".
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	// LibrarySection is the Plex library section ID of the series.
+	LibrarySection string `json:"librarySection"`
+	// PathMappings translate Sonarr's series paths into the media server's.
+	PathMappings []PathMapping `json:"pathMappings"`
+}
+
+// NotificationsConfig holds the notification targets. Every target receives
+// the events its filter accepts.
+type NotificationsConfig struct {
+	Webhooks []NotifyWebhookConfig `json:"webhooks"`
+	Ntfy     []NtfyConfig          `json:"ntfy"`
+	Gotify   []GotifyConfig        `json:"gotify"`
+	Email    []EmailConfig         `json:"email"`
+	Telegram []TelegramConfig      `json:"telegram"`
+}
+
+// EventFilter selects the events a notification target receives. Events holds
+// event types such as "file.failed" or patterns such as "file.*"; every event
+// is sent when it is empty.
+type EventFilter struct {
+	Events []string `json:"events"`
+}
+
+// NotifyWebhookConfig is a generic HTTP endpoint that receives each event as
+// a JSON document.
+type NotifyWebhookConfig struct {
+	URL     string `json:"url"`
+	URLFile string `json:"urlFile,omitempty"`
+	// Method defaults to POST.
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	// Retries is the number of extra attempts after a failed delivery.
+	Retries int `json:"retries"`
+	EventFilter
+}
+
+// Priorities maps the level of an event to the push priority of a target.
+// Levels are "failure", "success" and "info"; missing levels keep the
+// target's defaults.
+type Priorities map[string]int
+
+// NtfyConfig is an ntfy topic.
+type NtfyConfig struct {
+	// URL is the topic URL, for example "https://ntfy.sh/my-imports".
+	URL string `json:"url"`
+	// Token is an optional access token.
+	Token      string     `json:"token"`
+	TokenFile  string     `json:"tokenFile,omitempty"`
+	Priorities Priorities `json:"priorities"`
+	Retries    int        `json:"retries"`
+	EventFilter
+}
+
+// GotifyConfig is a Gotify server and application token.
+type GotifyConfig struct {
+	URL        string     `json:"url"`
+	Token      string     `json:"token"`
+	TokenFile  string     `json:"tokenFile,omitempty"`
+	Priorities Priorities `json:"priorities"`
+	Retries    int        `json:"retries"`
+	EventFilter
+}
+
+// TelegramConfig is a Telegram chat that a bot posts events to.
+type TelegramConfig struct {
+	// BotToken is the token BotFather gave the bot.
+	BotToken     string `json:"botToken"`
+	BotTokenFile string `json:"botTokenFile,omitempty"`
+	// ChatID is the user, group or channel the bot posts to, such as
+	// "123456789", "-1001234567890" or "@mychannel".
+	ChatID string `json:"chatId"`
+	// SilentHours is a window such as "22:00-08:00" in which messages
+	// arrive without a sound, in Timezone or the local time zone.
+	SilentHours string `json:"silentHours"`
+	Timezone    string `json:"timezone"`
+	Retries     int    `json:"retries"`
+	EventFilter
+}
+
+// EmailConfig sends scan summaries over SMTP.
+type EmailConfig struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// TLS is "starttls" (the default), "tls" for implicit TLS or "none".
+	TLS          string   `json:"tls"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	PasswordFile string   `json:"passwordFile,omitempty"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+	// Digest is a Go duration such as "24h". When set, daemon mode collects
+	// the scans over that period and sends a single email.
+	Digest string `json:"digest"`
+	// Template is the path of a text/template that replaces the built-in
+	// email body.
+	Template string `json:"template"`
+	Retries  int    `json:"retries"`
+	EventFilter
+}
+
+// RetryConfig controls the retry queue. Files that failed because of Sonarr
+// rather than their name, such as an API error, are left alone until their
+// retry is due and given up on after MaxAttempts.
+type RetryConfig struct {
+	// MaxAttempts is the number of failed attempts after which a file is no
+	// longer retried. 0 disables the queue, so every scan retries every file.
+	MaxAttempts int `json:"maxAttempts"`
+	// Delay is the wait after the first failure. It doubles with every
+	// further failure up to MaxDelay.
+	Delay    string `json:"delay"`
+	MaxDelay string `json:"maxDelay"`
+	// MetadataDelay replaces Delay for files whose episode Sonarr does not
+	// list yet even after refreshing the series, as when a release comes out
+	// before TVDB lists the episode.
+	MetadataDelay string `json:"metadataDelay"`
+}
+
+// IgnoreConfig controls the ignore list.
+type IgnoreConfig struct {
+	// AutoAfter ignores a file once it failed that many scans in a row for a
+	// reason a retry cannot fix, such as a name no pattern matches, until the
+	// file is replaced. 0 never ignores files automatically.
+	AutoAfter int `json:"autoAfter"`
+}
+
+// DedupeConfig controls the skipping of renamed or re-downloaded copies of
+// files that were imported before, which the history knows by a fingerprint
+// of their content.
+type DedupeConfig struct {
+	// Window is how long an import keeps later copies of its file out of the
+	// same episode, DefaultDedupeWindow when empty. "0s" turns the check off.
+	Window string `json:"window"`
+}
+
+// IOConfig limits how hard the tool reads the files of the downloads folder,
+// which share the disks with everything else on a NAS. The limits hold for
+// every scan of the process together.
+type IOConfig struct {
+	// MaxReadRate is the most bytes read per second, a size such as "20MB".
+	// Reads are not limited when it is empty.
+	MaxReadRate string `json:"maxReadRate"`
+	// MaxReaders is the most files read at once; 0 leaves it to
+	// parsing.concurrency.
+	MaxReaders int `json:"maxReaders"`
+	// MaxHashSize, a size such as "20GB", skips fingerprinting larger files,
+	// which are imported without the dedupe check. It is off when empty.
+	MaxHashSize string `json:"maxHashSize"`
+}
+
+// MaxReadRateBytes parses MaxReadRate, returning 0 when it is empty.
+func (c IOConfig) MaxReadRateBytes() (int64, error) {
+	if c.MaxReadRate == "" {
+		return 0, nil
+	}
+	return ParseSize(c.MaxReadRate)
+}
+
+// MaxHashSizeBytes parses MaxHashSize, returning 0 when it is empty.
+func (c IOConfig) MaxHashSizeBytes() (int64, error) {
+	if c.MaxHashSize == "" {
+		return 0, nil
+	}
+	return ParseSize(c.MaxHashSize)
+}
+
+// DelayDuration parses Delay, falling back to DefaultRetryDelay when it is
+// empty.
+func (r RetryConfig) DelayDuration() (time.Duration, error) {
+	return parseDuration("retry delay", r.Delay, DefaultRetryDelay)
+}
+
+// MaxDelayDuration parses MaxDelay, falling back to DefaultRetryMaxDelay when
+// it is empty.
+func (r RetryConfig) MaxDelayDuration() (time.Duration, error) {
+	return parseDuration("retry max delay", r.MaxDelay, DefaultRetryMaxDelay)
+}
+
+// MetadataDelayDuration parses MetadataDelay, falling back to
+// DefaultRetryMetadataDelay when it is empty.
+func (r RetryConfig) MetadataDelayDuration() (time.Duration, error) {
+	return parseDuration("retry metadata delay", r.MetadataDelay, DefaultRetryMetadataDelay)
+}
+
+const (
+	// DefaultInterval is the daemon scan interval when none is configured.
+	DefaultInterval = 5 * time.Minute
+	// MinInterval is the shortest scan interval the daemon accepts.
+	MinInterval = 30 * time.Second
+	// DefaultDrainTimeout fits within the 10 second grace period of docker stop.
+	DefaultDrainTimeout = 8 * time.Second
+	// DefaultWatchDebounce is the watch mode debounce when none is configured.
+	DefaultWatchDebounce = 5 * time.Second
+	// DefaultRescanInterval is the full scan period of watch mode.
+	DefaultRescanInterval = time.Hour
+	// DefaultLogRepeatWindow is how long the daemon summarizes the repeats of
+	// a failure.
+	DefaultLogRepeatWindow = time.Hour
+	// DefaultRetryDelay and DefaultRetryMaxDelay bound the wait before a
+	// failed file is retried.
+	DefaultRetryDelay    = 5 * time.Minute
+	DefaultRetryMaxDelay = 6 * time.Hour
+	// DefaultRetryMetadataDelay is the first wait before a file whose
+	// episode is not listed yet is retried.
+	DefaultRetryMetadataDelay = time.Hour
+	// DefaultDedupeWindow is how long an imported file keeps copies of
+	// itself out of its episode.
+	DefaultDedupeWindow = 30 * 24 * time.Hour
+	// DefaultLookupCache is how long a lookup that found nothing is not
+	// repeated.
+	DefaultLookupCache = time.Hour
+)
+
+// Modes of DaemonConfig.Mode. ScanPoll scans the downloads folder every
+// interval. ScanWatch processes new files as filesystem notifications report
+// them and ScanSnapshot every interval compares the downloads folder with an
+// index of the previous check, which works on network filesystems; both run a
+// full scan every rescan interval.
+const (
+	ScanPoll     = "poll"
+	ScanWatch    = "watch"
+	ScanSnapshot = "snapshot"
+)
+
+// ScanMode returns Mode, or ScanWatch or ScanPoll following Watch when Mode
+// is empty.
+func (d DaemonConfig) ScanMode() string {
+	switch {
+	case d.Mode != "":
+		return d.Mode
+	case d.Watch:
+		return ScanWatch
+	}
+	return ScanPoll
+}
+
+// IntervalDuration parses Interval. It returns 0 when Interval is empty.
+func (d DaemonConfig) IntervalDuration() (time.Duration, error) {
+	return parseDuration("daemon interval", d.Interval, 0)
+}
+
+// WindowDuration parses Window, falling back to DefaultDedupeWindow when it
+// is empty.
+func (d DedupeConfig) WindowDuration() (time.Duration, error) {
+	return parseDuration("dedupe window", d.Window, DefaultDedupeWindow)
+}
+
+// LookupCacheDuration parses LookupCache, falling back to DefaultLookupCache
+// when it is empty.
+func (s SonarrConfig) LookupCacheDuration() (time.Duration, error) {
+	return parseDuration("sonarr lookup cache", s.LookupCache, DefaultLookupCache)
+}
+
+// FileTimeoutDuration parses FileTimeout, returning 0 when it is empty.
+func (p ParsingConfig) FileTimeoutDuration() (time.Duration, error) {
+	return parseDuration("parsing file timeout", p.FileTimeout, 0)
+}
+
+// DrainTimeoutDuration parses DrainTimeout, falling back to
+// DefaultDrainTimeout when it is empty.
+func (d DaemonConfig) DrainTimeoutDuration() (time.Duration, error) {
+	return parseDuration("daemon drain timeout", d.DrainTimeout, DefaultDrainTimeout)
+}
+
+// WatchDebounceDuration parses WatchDebounce, falling back to
+// DefaultWatchDebounce when it is empty.
+func (d DaemonConfig) WatchDebounceDuration() (time.Duration, error) {
+	return parseDuration("daemon watch debounce", d.WatchDebounce, DefaultWatchDebounce)
+}
+
+// ActiveHoursWindow parses ActiveHours in Timezone. It returns nil when
+// ActiveHours is empty.
+func (d DaemonConfig) ActiveHoursWindow() (*Window, error) {
+	w, err := ParseWindow(d.ActiveHours, d.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("daemon active hours: %w", err)
+	}
+	return w, nil
+}
+
+// LatencyWarningDuration parses LatencyWarning. It returns 0 when
+// LatencyWarning is empty.
+func (d DaemonConfig) LatencyWarningDuration() (time.Duration, error) {
+	return parseDuration("daemon latency warning", d.LatencyWarning, 0)
+}
+
+// LogRepeatWindowDuration parses LogRepeatWindow, falling back to
+// DefaultLogRepeatWindow when it is empty.
+func (d DaemonConfig) LogRepeatWindowDuration() (time.Duration, error) {
+	return parseDuration("daemon log repeat window", d.LogRepeatWindow, DefaultLogRepeatWindow)
+}
+
+// RescanIntervalDuration parses RescanInterval, falling back to
+// DefaultRescanInterval when it is empty.
+func (d DaemonConfig) RescanIntervalDuration() (time.Duration, error) {
+	return parseDuration("daemon rescan interval", d.RescanInterval, DefaultRescanInterval)
+}
+
+// MaxFileAgeDuration parses MaxFileAge. It returns 0 when MaxFileAge is
+// empty.
+func (d DaemonConfig) MaxFileAgeDuration() (time.Duration, error) {
+	return parseDuration("daemon max file age", d.MaxFileAge, 0)
+}
+
+// parseDuration parses a duration setting, returning def when value is empty.
+func parseDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
+
+// HistoryRetentionDuration parses HistoryRetention. It returns 0 when
+// HistoryRetention is empty.
+func (d DaemonConfig) HistoryRetentionDuration() (time.Duration, error) {
+	return parseDuration("daemon history retention", d.HistoryRetention, 0)
+}
+
+// ParserConfig returns the subset of the configuration used by the parser.
+func (c *Config) ParserConfig() parser.Config {
+	return parser.Config{
+		AnimePatterns:    c.animePatterns(),
+		MoviePatterns:    c.Parsing.MoviePatterns,
+		SeasonPatterns:   c.Parsing.SeasonPatterns,
+		EpisodePatterns:  c.Parsing.EpisodePatterns,
+		QualityPatterns:  c.Parsing.QualityPatterns,
+		GroupPatterns:    c.Parsing.GroupPatterns,
+		Groups:           c.groupPatterns(),
+		Transforms:       c.Transforms,
+		MaxEpisodeSpan:   c.Parsing.MaxEpisodeSpan,
+		RequireFullMatch: c.Parsing.RequireFullMatch,
+	}
+}
+
+// groupPatterns returns the anime patterns of every group profile, including
+// the profiles without any, so the parser knows every profile.
+func (c *Config) groupPatterns() map[string][]parser.AnimePattern {
+	if len(c.Groups) == 0 {
+		return nil
+	}
+	groups := make(map[string][]parser.AnimePattern, len(c.Groups))
+	for name, g := range c.Groups {
+		groups[name] = g.AnimePatterns
+	}
+	return groups
+}
+
+// DisabledParsing returns the paths of the transforms and anime patterns
+// that are turned off, each followed by its name when it has one.
+func (c *Config) DisabledParsing() []string {
+	var paths []string
+	disabled := func(path, name string) {
+		if name != "" {
+			path += " (" + name + ")"
+		}
+		paths = append(paths, path)
+	}
+	for i, t := range c.Transforms {
+		if t.Disabled() {
+			disabled(c.TransformPath(i), t.Name)
+		}
+	}
+	patterns := func(prefix string, patterns []parser.AnimePattern) {
+		for i, p := range patterns {
+			if p.Disabled() {
+				disabled(fmt.Sprintf("%s[%d]", prefix, i), p.Name)
+			}
+		}
+	}
+	patterns("parsing.animePatterns", c.Parsing.AnimePatterns)
+	for i, preset := range c.Presets {
+		patterns(fmt.Sprintf("parsing.presetFiles[%d].animePatterns", i), preset.AnimePatterns)
+	}
+	for _, name := range sortedKeys(c.Groups) {
+		patterns(c.groupPath(name)+".animePatterns", c.Groups[name].AnimePatterns)
+	}
+	return paths
+}
+
+// Load reads the configuration at path, expanding environment variables, and
+// merges the EnvPrefix variables over it. If the file does not exist the
+// defaults are used when the environment sets any value; otherwise a default
+// configuration is written there and Load fails with ErrDefaultCreated, as
+// the defaults cannot reach Sonarr.
+func Load(path string, log *logging.Logger) (*Config, error) {
+	// Check if config file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if HasEnv(os.Environ()) {
+			log.Infof("No config file at %s, using the defaults and %s variables", path, EnvPrefix)
+			cfg, err := Merge(DefaultData(), SourceDefault)
+			if err != nil {
+				return nil, err
+			}
+			if err := cfg.LoadRules(path); err != nil {
+				return nil, err
+			}
+			if err := cfg.checkTransforms(path, log); err != nil {
+				return nil, err
+			}
+			return cfg, cfg.LoadPresets(path, log)
+		}
+		// Create default config
+		log.Infof("Creating default configuration file...")
+		if err := WriteDefault(path, log); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w at %s", ErrDefaultCreated, path)
+	}
+
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Merge(data, SourceFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range cfg.Migrated {
+		log.Warnf("%s: %s: %s", path, issue.Path, issue.Message)
+	}
+	if err := cfg.LoadRules(path); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkTransforms(path, log); err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadPresets(path, log); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkTransforms checks the replacement of every enabled transform, those
+// of the rules file included, with parser.CheckReplacement. A reference to a
+// group the search does not have fails the load, since it would silently
+// blank part of every name the transform matches; the warnings are logged
+// against path. A search that does not compile is left to Validate, and the
+// parser skips it.
+func (c *Config) checkTransforms(path string, log *logging.Logger) error {
+	for i, t := range c.Transforms {
+		if t.Disabled() {
+			continue
+		}
+		re, err := regexp.Compile(t.Search)
+		if err != nil {
+			continue
+		}
+		errs, warnings := parser.CheckReplacement(re, t.Replace)
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid transform: %s.replace: %s", c.TransformPath(i), strings.Join(errs, "; "))
+		}
+		for _, msg := range warnings {
+			log.Warnf("%s: %s.replace: %s", path, c.TransformPath(i), msg)
+		}
+	}
+	return nil
+}
+
+// ReadFile returns the configuration at path as JSON with environment
+// variables expanded. YAML and TOML files are converted, selected by the
+// extension of path.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Replace environment variables in config, before decoding so every
+	// format behaves the same
+	expanded, err := Expand(string(data), os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return toJSON([]byte(expanded), FormatOf(path))
+}
+
+// Parse decodes a configuration read by ReadFile and reads the secret files
+// it names. Unknown keys are an *UnknownKeysError rather than being ignored.
+func Parse(data []byte) (*Config, error) {
+	issues, err := CheckKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if unknown := unknownKeys(issues); unknown != nil {
+		return nil, unknown
+	}
+
+	cfg := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if err := readSecretFiles(reflect.ValueOf(cfg), ""); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Default returns the configuration written on first run.
+func Default() Config {
+	return Config{
+		Sonarr: SonarrConfig{
+			URL:             "${SONARR_URL:-http://sonarr:8989}",
+			APIKey:          "${SONARR_API_KEY}",
+			DownloadsFolder: "/downloads",
+			QualityProfile:  1,
+			LanguageProfile: 1,
+			RootFolder:      "/tv",
+		},
+		Parsing: ParsingConfig{
+			AnimePatterns: []parser.AnimePattern{},
+			PresetFiles:   []string{"community-default"},
+			MoviePatterns: []parser.MoviePattern{
+				{
+					Pattern:    `^(.+?)\s*\(?((?:19|20)\d{2})\)?(?:\s*\[(?:[^\]]*\D)?\])*$`,
+					TitleGroup: 1,
+					YearGroup:  2,
+				},
+			},
+			SeasonPatterns: []string{
+				`(\d+)(?:nd|rd|th)?\s+Season`,
+				`Season\s+(\d+)`,
+				`S(\d+)`,
+			},
+			EpisodePatterns: []string{
+				`\[(\d+)(?:v\d+)?\]`,
+				`#(\d+)[^#]*$`,
+				`E(\d+)`,
+				`Episode\s+(\d+)`,
+				`Ep\s*(\d+)`,
+			},
+			QualityPatterns: []string{
+				`1080p`,
+				`720p`,
+				`480p`,
+				`WEBRip`,
+				`BluRay`,
+				`DVDRip`,
+			},
+			GroupPatterns: []string{
+				`\[([^\]]+)\]$`,
+				`\(([^)]+)\)$`,
+			},
+			RequireFullMatch: true,
+		},
+		Transforms: []parser.Transform{
+			{Search: `_`, Replace: ` `},
+			{Search: `\.`, Replace: ` `},
+			{Search: `\s+`, Replace: ` `},
+			{Search: `^\s+|\s+$`, Replace: ``},
+		},
+		Daemon: DaemonConfig{
+			Interval: "5m",
+		},
+		Retry: RetryConfig{
+			MaxAttempts:   5,
+			Delay:         "5m",
+			MaxDelay:      "6h",
+			MetadataDelay: "1h",
+		},
+	}
+}
+
+// ErrDefaultCreated is the error of Load when it wrote the default
+// configuration, which needs the Sonarr settings before anything can run.
+var ErrDefaultCreated = errors.New("created a default configuration")
+
+// WriteDefault writes the default configuration to path unless a file is
+// there already. The file appears complete or not at all, so two processes
+// starting at once neither overwrite each other nor read half a file; the
+// one that finds the file of the other returns nil too.
+func WriteDefault(path string, log *logging.Logger) error {
+	data, err := marshal(Default(), FormatOf(path))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Unlike a rename, a link fails when path exists
+		err = os.Link(tmp.Name(), path)
+	}
+	switch {
+	case errors.Is(err, os.ErrExist):
+		log.Infof("Another process created the default config at %s", path)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	log.Infof("Created default config at %s", path)
+	return nil
+}
+
+// Write saves cfg to path in the format of its extension.
+func Write(path string, cfg Config) error {
+	data, err := marshal(cfg, FormatOf(path))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// marshal returns cfg in format f.
+func marshal(cfg Config, f Format) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if data, err = fromJSON(data, f); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+func TestLoadCreatesDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg, err := Load(path, nil)
+	if !errors.Is(err, ErrDefaultCreated) || cfg != nil {
+		t.Fatalf("Load of a missing config = %v, %v; want ErrDefaultCreated", cfg, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("the default config was not written: %v", err)
+	}
+
+	// The next run reads it, and stops at what is left to fill in
+	if _, err := Load(path, nil); err == nil || errors.Is(err, ErrDefaultCreated) {
+		t.Fatalf("Load of the default config = %v, want it to need the API key", err)
+	}
+	t.Setenv("SONARR_API_KEY", "0123456789abcdef")
+	if _, err := Load(path, nil); err != nil {
+		t.Errorf("Load of the default config with its variables set: %v", err)
+	}
+}
+
+func TestWriteDefaultKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"sonarr":{"url":"http://sonarr:8989"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDefault(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"sonarr":{"url":"http://sonarr:8989"}}` {
+		t.Errorf("WriteDefault replaced the existing config with %s", data)
+	}
+}
+
+// TestWriteDefaultConcurrent creates the default config from several
+// goroutines at once, as containers sharing a mounted config folder would:
+// every one succeeds, the file is complete and no temporary file is left.
+func TestWriteDefaultConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	start := make(chan struct{})
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- WriteDefault(path, nil)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("WriteDefault: %v", err)
+		}
+	}
+
+	want, err := marshal(Default(), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != string(want) {
+		t.Errorf("config after the concurrent writes = %q, %v; want the defaults", got, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("files left next to the config: %v", names)
+	}
+}
+
+func TestMergeChecksURLs(t *testing.T) {
+	cfg, err := Merge([]byte(`{"sonarr":{"url":"http://sonarr:8989/"},"radarr":{"url":"https://radarr:7878//"}}`), SourceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sonarr.URL != "http://sonarr:8989" || cfg.Radarr.URL != "https://radarr:7878" {
+		t.Errorf("URLs = %q and %q, want them without trailing slashes", cfg.Sonarr.URL, cfg.Radarr.URL)
+	}
+
+	for _, tt := range []struct{ data, path string }{
+		{`{"sonarr":{"url":"sonarr:8989"}}`, "sonarr.url"},
+		{`{"sonarr":{"url":"ftp://sonarr:8989"}}`, "sonarr.url"},
+		{`{"sonarr":{"url":"http://"}}`, "sonarr.url"},
+		{`{"instances":[{"name":"4k","url":"sonarr-4k:8989"}]}`, "instances[0].url"},
+		{`{"radarr":{"url":"radarr:7878"}}`, "radarr.url"},
+	} {
+		if _, err := Merge([]byte(tt.data), SourceFile); err == nil || !strings.Contains(err.Error(), tt.path) {
+			t.Errorf("Merge(%s) = %v, want an error for %s", tt.data, err, tt.path)
+		}
+	}
+}
+
+func TestLoadChecksTransforms(t *testing.T) {
+	dir := t.TempDir()
+	load := func(transforms string) (string, error) {
+		path := filepath.Join(dir, "config.json")
+		data := `{"sonarr":{"url":"http://sonarr:8989"},"transforms":[` + transforms + `]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		_, err := Load(path, logging.New(&out, logging.LevelDebug))
+		return out.String(), err
+	}
+
+	// The file writes $$ for the $ that Expand would take for a variable
+	_, err := load(`{"search":"^(a)","replace":"$$l"}`)
+	if err == nil || !strings.Contains(err.Error(), "transforms[0].replace: $l refers to group") {
+		t.Errorf("Load with a $l replacement = %v, want it refused", err)
+	}
+	if _, err := load(`{"search":"^(a)","replace":"$2","enabled":false}`); err != nil {
+		t.Errorf("Load with a disabled transform: %v", err)
+	}
+	log, err := load(`{"search":"^(a)","replace":"$1 $ sign"}`)
+	if err != nil {
+		t.Fatalf("Load with a literal $: %v", err)
+	}
+	if !strings.Contains(log, "transforms[0].replace: has a literal $") {
+		t.Errorf("the literal $ is not logged:\n%s", log)
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that set configuration values.
+// Nested keys are separated by a double underscore and matched ignoring case
+// and single underscores, so SONARR_AUTOIMPORT_SONARR__DOWNLOADS_FOLDER sets
+// sonarr.downloadsFolder. Array elements are addressed by index, as in
+// SONARR_AUTOIMPORT_TRANSFORMS__0__SEARCH, or a whole array or object is
+// given as JSON.
+const EnvPrefix = "SONARR_AUTOIMPORT_"
+
+// Setting sources reported in Config.Sources.
+const (
+	SourceFile    = "file"
+	SourceDefault = "default"
+	SourceEnv     = "env"
+)
+
+// HasEnv reports whether environ sets any configuration value.
+func HasEnv(environ []string) bool {
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, EnvPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv sets the values of the EnvPrefix variables in environ on the
+// decoded JSON document doc. It returns the variables that were applied,
+// grouped by top-level key.
+func applyEnv(doc map[string]any, environ []string) (map[string][]string, error) {
+	sort.Strings(environ)
+	applied := make(map[string][]string)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(name, EnvPrefix), "__")
+		path, err := setEnv(doc, reflect.TypeOf(Config{}), segments, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		applied[path[0]] = append(applied[path[0]], name)
+	}
+	return applied, nil
+}
+
+// setEnv stores value at the path named by segments in container, whose Go
+// type is t, and returns the JSON path it resolved to.
+func setEnv(container any, t reflect.Type, segments []string, value string) ([]string, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	segment := segments[0]
+	last := len(segments) == 1
+
+	var key string
+	var elem reflect.Type
+	switch t.Kind() {
+	case reflect.Struct:
+		key, elem = envField(t, segment)
+		if key == "" {
+			return nil, fmt.Errorf("unknown setting %q", segment)
+		}
+	case reflect.Map:
+		key, elem = segment, t.Elem()
+	case reflect.Slice:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("%q is not an array index", segment)
+		}
+		list := container.(*[]any)
+		for len(*list) <= index {
+			*list = append(*list, nil)
+		}
+		if last {
+			v, err := envValue(t.Elem(), value)
+			if err != nil {
+				return nil, err
+			}
+			(*list)[index] = v
+			return []string{segment}, nil
+		}
+		child, err := descend(&(*list)[index], t.Elem(), segments[1:], value)
+		return append([]string{segment}, child...), err
+	default:
+		return nil, fmt.Errorf("%q has no settings below it", segment)
+	}
+
+	obj := container.(map[string]any)
+	if last {
+		v, err := envValue(elem, value)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = v
+		return []string{key}, nil
+	}
+	slot := obj[key]
+	child, err := descend(&slot, elem, segments[1:], value)
+	obj[key] = slot
+	return append([]string{key}, child...), err
+}
+
+// descend continues setEnv in the object or array stored in slot, creating
+// it when needed.
+func descend(slot *any, t reflect.Type, segments []string, value string) ([]string, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		list, _ := (*slot).([]any)
+		path, err := setEnv(&list, t, segments, value)
+		*slot = list
+		return path, err
+	}
+	obj, ok := (*slot).(map[string]any)
+	if !ok {
+		obj = make(map[string]any)
+		*slot = obj
+	}
+	return setEnv(obj, t, segments, value)
+}
+
+// envField returns the JSON name and type of the field of t that segment
+// names, ignoring case and underscores.
+func envField(t reflect.Type, segment string) (string, reflect.Type) {
+	want := normalizeEnv(segment)
+	for name, ft := range jsonFields(t) {
+		if normalizeEnv(name) == want {
+			return name, ft
+		}
+	}
+	return "", nil
+}
+
+func normalizeEnv(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+}
+
+// envValue converts the text of a variable into the JSON value for type t.
+// Arrays, objects and maps are given as JSON.
+func envValue(t reflect.Type, value string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.Atoi(value)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return nil, fmt.Errorf("want a JSON value: %w", err)
+	}
+	return v, nil
+}
+
+// Merge applies the environment variables over the JSON configuration data,
+// which came from source, and parses the result. Config.Sources tells where
+// each top-level setting came from. A Sonarr or Radarr URL that is not HTTP
+// or HTTPS fails it.
+func Merge(data []byte, source string) (*Config, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+	migrated := migrate(doc)
+	fromSource := make(map[string]bool, len(doc))
+	for key := range doc {
+		fromSource[key] = true
+	}
+
+	applied, err := applyEnv(doc, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.normalizeURLs()
+	if err := cfg.checkURLs(); err != nil {
+		return nil, err
+	}
+	cfg.Migrated = migrated
+	cfg.Sources = make(map[string]string)
+	for key := range doc {
+		var parts []string
+		if fromSource[key] {
+			parts = append(parts, source)
+		}
+		if vars := applied[key]; len(vars) > 0 {
+			parts = append(parts, SourceEnv+" "+strings.Join(vars, ", "))
+		}
+		cfg.Sources[key] = strings.Join(parts, " + ")
+	}
+	return cfg, nil
+}
+
+// DefaultData is the default configuration as JSON, with its environment
+// variable references expanded. Unset variables expand to empty strings so
+// the environment layer can still provide the values.
+func DefaultData() []byte {
+	data, _ := json.Marshal(Default())
+	expanded, _ := Expand(string(data), os.LookupEnv)
+	return []byte(expanded)
+}
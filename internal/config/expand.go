@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Expand replaces environment variable references in the configuration text:
+//
+//	${VAR}            the value of VAR, which must be set
+//	${VAR:-default}   the value of VAR, or default when VAR is unset or empty
+//	${VAR:?message}   the value of VAR, or an error with message
+//	$VAR              the same as ${VAR}
+//	$$                a literal $
+//
+// A $ followed by anything else, such as the end-of-line anchor in "mkv$" or
+// the "$1" and "${1}" of a replacement, is kept as it is. Defaults may contain
+// references themselves. Every unset variable is reported, with the config
+// key it appears in.
+func Expand(text string, lookup func(string) (string, bool)) (string, error) {
+	var errs []error
+	out := expand(text, lookup, func(err error, offset int) {
+		if replaceKey.MatchString(text[strings.LastIndexByte(text[:offset], '\n')+1 : offset]) {
+			err = fmt.Errorf("%w; write $%s for a named group of the search", err, groupRef(text[offset:]))
+		}
+		errs = append(errs, fmt.Errorf("%w%s", err, keyAt(text, offset)))
+	})
+	return out, errors.Join(errs...)
+}
+
+// expand does the work of Expand, reporting errors with their offset in text.
+func expand(text string, lookup func(string) (string, bool), fail func(error, int)) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || i+1 == len(text) {
+			b.WriteByte(text[i])
+			continue
+		}
+
+		switch next := text[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+
+		case next == '{' && i+2 < len(text) && '0' <= text[i+2] && text[i+2] <= '9':
+			// A numbered group of a replacement
+			b.WriteByte('$')
+
+		case next == '{':
+			end := closingBrace(text, i+2)
+			if end < 0 {
+				b.WriteByte('$')
+				continue
+			}
+			b.WriteString(expandRef(text[i+2:end], lookup, func(err error, _ int) { fail(err, i) }))
+			i = end
+
+		case isNameStart(next):
+			j := i + 1
+			for j < len(text) && isNameChar(text[j]) {
+				j++
+			}
+			name := text[i+1 : j]
+			value, ok := lookup(name)
+			if !ok {
+				fail(unsetError(name), i)
+			}
+			b.WriteString(value)
+			i = j - 1
+
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String()
+}
+
+// expandRef resolves the inside of a ${...} reference.
+func expandRef(ref string, lookup func(string) (string, bool), fail func(error, int)) string {
+	name, op, arg := ref, "", ""
+	if i := strings.Index(ref, ":"); i >= 0 && i+1 < len(ref) && (ref[i+1] == '-' || ref[i+1] == '?') {
+		name, op, arg = ref[:i], ref[i:i+2], ref[i+2:]
+	}
+
+	value, ok := lookup(name)
+	switch op {
+	case ":-":
+		if !ok || value == "" {
+			return expand(arg, lookup, fail)
+		}
+	case ":?":
+		if !ok || value == "" {
+			if arg == "" {
+				arg = "is not set"
+			}
+			fail(fmt.Errorf("environment variable %s referenced in config: %s", name, arg), 0)
+		}
+	default:
+		if !ok {
+			fail(unsetError(name), 0)
+		}
+	}
+	return value
+}
+
+func unsetError(name string) error {
+	return fmt.Errorf("environment variable %s referenced in config is not set", name)
+}
+
+// closingBrace returns the index of the } closing a reference whose contents
+// start at start, allowing nested references in defaults, or -1.
+func closingBrace(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// keyPattern finds the key a value belongs to in the text of a JSON, YAML or
+// TOML line before the value.
+var keyPattern = regexp.MustCompile(`"?([\w.-]+)"?\s*[:=]\s*"?[^"]*$`)
+
+// replaceKey matches the start of a line up to a value of the replace key of
+// a transform, where references are more likely meant as capture groups.
+var replaceKey = regexp.MustCompile(`"?replace"?\s*[:=]\s*"?[^"]*$`)
+
+// groupRef returns the reference at the start of text, which starts with $.
+func groupRef(text string) string {
+	if end := strings.IndexByte(text, '}'); strings.HasPrefix(text, "${") && end > 0 {
+		return text[:end+1]
+	}
+	end := 1
+	for end < len(text) && isNameChar(text[end]) {
+		end++
+	}
+	return text[:end]
+}
+
+// keyAt describes where offset is in text: its line and, when one can be
+// found, the key it is the value of.
+func keyAt(text string, offset int) string {
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	line := strings.Count(text[:offset], "\n") + 1
+	if m := keyPattern.FindStringSubmatch(text[start:offset]); m != nil {
+		return fmt.Sprintf(" (key %q, line %d)", m[1], line)
+	}
+	return fmt.Sprintf(" (line %d)", line)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{
+		"HOST":  "sonarr",
+		"PORT":  "8989",
+		"EMPTY": "",
+		"INNER": "inner",
+	}
+	tests := []struct {
+		text, want string
+	}{
+		{`"url": "http://${HOST}:$PORT"`, `"url": "http://sonarr:8989"`},
+		{`"key": "${MISSING:-fallback}"`, `"key": "fallback"`},
+		{`"key": "${EMPTY:-fallback}"`, `"key": "fallback"`},
+		{`"key": "${HOST:-fallback}"`, `"key": "sonarr"`},
+
+		// Nested references in defaults
+		{`"key": "${MISSING:-${INNER}}"`, `"key": "inner"`},
+		{`"key": "${MISSING:-${OTHER:-deep}}"`, `"key": "deep"`},
+		{`"key": "${MISSING:-a-${HOST}-b}"`, `"key": "a-sonarr-b"`},
+
+		// Escapes and text that only looks like a reference
+		{`"password": "pa$$word"`, `"password": "pa$word"`},
+		{`"literal": "$${HOST}"`, `"literal": "${HOST}"`},
+		{`"pattern": "\\.mkv$"`, `"pattern": "\\.mkv$"`},
+		{`"replace": "$1 - ${2}"`, `"replace": "$1 - ${2}"`},
+		{`"price": "$ 5"`, `"price": "$ 5"`},
+		{`"open": "${HOST"`, `"open": "${HOST"`},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.text, lookupIn(env))
+		if err != nil {
+			t.Errorf("Expand(%s): %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expand(%s) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExpandUnsetVariables(t *testing.T) {
+	text := strings.Join([]string{
+		`{`,
+		`  "url": "http://${HOST}",`,
+		`  "apiKey": "$API_KEY",`,
+		`  "token": "${TOKEN:?set it in the compose file}",`,
+		`  "fallback": "${MISSING:-${NESTED}}"`,
+		`}`,
+	}, "\n")
+
+	_, err := Expand(text, lookupIn(nil))
+	if err == nil {
+		t.Fatal("Expand succeeded with unset variables")
+	}
+	for _, want := range []string{
+		`environment variable HOST referenced in config is not set (key "url", line 2)`,
+		`environment variable API_KEY referenced in config is not set (key "apiKey", line 3)`,
+		`environment variable TOKEN referenced in config: set it in the compose file (key "token", line 4)`,
+		`environment variable NESTED referenced in config is not set (key "fallback", line 5)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+}
+
+func TestExpandRequiredEmpty(t *testing.T) {
+	_, err := Expand(`"token": "${TOKEN:?}"`, lookupIn(map[string]string{"TOKEN": ""}))
+	if err == nil || !strings.Contains(err.Error(), "TOKEN referenced in config: is not set") {
+		t.Errorf("Expand with an empty required variable: %v", err)
+	}
+}
+
+func TestExpandSuggestsGroupInReplace(t *testing.T) {
+	_, err := Expand(`"replace": "${title} - $ep"`, lookupIn(nil))
+	if err == nil {
+		t.Fatal("Expand succeeded with unset variables")
+	}
+	for _, want := range []string{"write $${title} for a named group", "write $$ep for a named group"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not suggest %q", err, want)
+		}
+	}
+}
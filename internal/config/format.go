@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the file format of a configuration.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// Formats are the supported formats, JSON first.
+var Formats = []Format{FormatJSON, FormatYAML, FormatTOML}
+
+// ParseFormat returns the Format called name.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("unknown config format %q, want json, yaml or toml", name)
+}
+
+// FormatOf returns the format of the file at path from its extension. Unknown
+// extensions are read as JSON.
+func FormatOf(path string) Format {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return FormatJSON
+	}
+	return format
+}
+
+// Ext is the file extension of f.
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// Locate returns path if it exists. Otherwise it returns the first existing
+// file with the same name and a .yaml, .yml or .toml extension, so the
+// default Settings.json also finds Settings.yaml. path is returned when none
+// exists.
+func Locate(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".yaml", ".yml", ".toml"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return path
+}
+
+// toJSON converts a configuration in format f to JSON, keeping the order of
+// the keys where the format allows it.
+func toJSON(data []byte, f Format) ([]byte, error) {
+	switch f {
+	case FormatYAML:
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+		}
+		if len(node.Content) == 0 {
+			return []byte("{}"), nil
+		}
+		var buf bytes.Buffer
+		if err := writeJSON(&buf, node.Content[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+		}
+		return buf.Bytes(), nil
+
+	case FormatTOML:
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config TOML: %w", err)
+		}
+		return json.Marshal(doc)
+	}
+	return data, nil
+}
+
+// writeJSON writes the YAML node n as JSON.
+func writeJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return writeJSON(buf, n.Alias)
+
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(n.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case yaml.ScalarNode:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// fromJSON converts a JSON configuration to format f. YAML keeps the order of
+// the keys; TOML sorts them.
+func fromJSON(data []byte, f Format) ([]byte, error) {
+	switch f {
+	case FormatYAML:
+		// JSON is valid YAML, so decoding it keeps the key order
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		blockStyle(&node)
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case FormatTOML:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(integers(doc)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// integers replaces the json.Numbers in v by int64 or float64, so TOML does
+// not write whole numbers as floats.
+func integers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = integers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = integers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// blockStyle switches the flow style of decoded JSON to YAML's block style
+// and drops quotes the strings don't need. The encoder still quotes strings
+// that would otherwise read as another type.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// Convert translates a configuration from one format to another. Every key
+// is kept, including ones Config does not know.
+func Convert(data []byte, from, to Format) ([]byte, error) {
+	data, err := toJSON(data, from)
+	if err != nil {
+		return nil, err
+	}
+	return fromJSON(data, to)
+}
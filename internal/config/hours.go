@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time window such as "22:00-08:00" in a time zone. A
+// window whose end is before its start runs past midnight.
+type Window struct {
+	// start and end are offsets from midnight.
+	start, end time.Duration
+	loc        *time.Location
+	spec       string
+}
+
+// ParseWindow parses a window of the form "HH:MM-HH:MM" in the time zone
+// timezone, such as "Europe/Berlin", or in the local time zone when timezone
+// is empty. It returns nil for an empty spec.
+func ParseWindow(spec, timezone string) (*Window, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q, use HH:MM-HH:MM such as 22:00-08:00", spec)
+	}
+	w := &Window{loc: time.Local, spec: spec}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid window %q: it starts where it ends", spec)
+	}
+	if timezone != "" {
+		if w.loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// parseClock parses a time of day such as "22:00" into its offset from
+// midnight. "24:00" is midnight at the end of the day.
+func parseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day such as 22:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w *Window) String() string {
+	if w.loc == time.Local {
+		return w.spec
+	}
+	return w.spec + " " + w.loc.String()
+}
+
+// Contains reports whether t is inside w.
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	offset := clock(t)
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// NextStart returns the first start of w after t.
+func (w *Window) NextStart(t time.Time) time.Time {
+	t = t.In(w.loc)
+	hour, minute := int(w.start/time.Hour), int(w.start%time.Hour/time.Minute)
+	for i := 0; i < 2; i++ {
+		// The wall clock time, which DST changes do not shift
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, hour, minute, 0, 0, w.loc)
+		if start.After(t) {
+			return start
+		}
+	}
+	return t
+}
+
+// clock returns the wall clock time of t as an offset from midnight.
+func clock(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultInstance is the name of the Sonarr instance configured in the sonarr
+// section. Files no route matches go to it.
+const DefaultInstance = "default"
+
+// InstanceConfig is an additional Sonarr instance, such as a separate one for
+// anime or for 4K. The downloads folder is shared with the sonarr section,
+// and profiles and the series type left at zero values are taken from it.
+type InstanceConfig struct {
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	APIKey          string `json:"apikey"`
+	APIKeyFile      string `json:"apikeyFile,omitempty"`
+	QualityProfile  int    `json:"qualityProfile"`
+	LanguageProfile int    `json:"languageProfile"`
+	RootFolder      string `json:"rootFolder"`
+	SeriesType      string `json:"seriesType"`
+	// PathSeparator is detected from RootFolder when it is empty, as the
+	// instance may run on another system than the one of the sonarr section.
+	PathSeparator string `json:"pathSeparator,omitempty"`
+}
+
+// RouteConfig sends the files it matches to a Sonarr instance. A route
+// matches when all of its conditions that are set match. Routes are tried in
+// order and the first match wins.
+type RouteConfig struct {
+	// Instance is the name of an entry of instances, or DefaultInstance.
+	Instance string `json:"instance"`
+	// Folder matches files below this subfolder of the downloads folder.
+	Folder string `json:"folder"`
+	// Title is a regular expression matched against the parsed title.
+	Title string `json:"title"`
+	// Quality matches the parsed quality, such as "2160p", ignoring case.
+	Quality string `json:"quality"`
+}
+
+// FolderConfig changes how series are added for the files below a folder of
+// the downloads folder. Settings left at zero values keep those of the
+// instance the file is routed to. When folders are nested the deepest one
+// applies.
+type FolderConfig struct {
+	// Path is the folder, absolute or relative to the downloads folder.
+	Path            string `json:"path"`
+	QualityProfile  int    `json:"qualityProfile"`
+	LanguageProfile int    `json:"languageProfile"`
+	RootFolder      string `json:"rootFolder"`
+	SeriesType      string `json:"seriesType"`
+	// Tags are labels of Sonarr tags given to added series.
+	Tags []string `json:"tags"`
+}
+
+// FolderPath returns the absolute path of f.
+func (c *Config) FolderPath(f FolderConfig) string {
+	if filepath.IsAbs(f.Path) {
+		return filepath.Clean(f.Path)
+	}
+	return filepath.Join(c.Sonarr.DownloadsFolder, f.Path)
+}
+
+// InstanceSonarr returns the settings of instance i, filled in from the sonarr
+// section where i leaves them unset.
+func (c *Config) InstanceSonarr(i InstanceConfig) SonarrConfig {
+	s := SonarrConfig{
+		URL:             i.URL,
+		APIKey:          i.APIKey,
+		DownloadsFolder: c.Sonarr.DownloadsFolder,
+		QualityProfile:  i.QualityProfile,
+		LanguageProfile: i.LanguageProfile,
+		RootFolder:      i.RootFolder,
+		SeriesType:      i.SeriesType,
+		PathSeparator:   i.PathSeparator,
+		// Approval, rollback, duplicates, season inference, verification,
+		// the lookup cache, folder adoption, the free space check, the
+		// monitored seasons, the add options and the headers are a matter
+		// of the user, not of an instance
+		ConfirmNewSeries:       c.Sonarr.ConfirmNewSeries,
+		RollbackNewSeries:      c.Sonarr.RollbackNewSeries,
+		FailOnDuplicateSeries:  c.Sonarr.FailOnDuplicateSeries,
+		InferSeason:            c.Sonarr.InferSeason,
+		SkipImportVerification: c.Sonarr.SkipImportVerification,
+		LookupCache:            c.Sonarr.LookupCache,
+		AdoptExistingFolders:   c.Sonarr.AdoptExistingFolders,
+		CheckFreeSpace:         c.Sonarr.CheckFreeSpace,
+		FreeSpaceMargin:        c.Sonarr.FreeSpaceMargin,
+		MonitorSeasons:         c.Sonarr.MonitorSeasons,
+		AddOptions:             c.Sonarr.AddOptions,
+		Headers:                c.Sonarr.Headers,
+	}
+	if s.QualityProfile == 0 {
+		s.QualityProfile = c.Sonarr.QualityProfile
+	}
+	if s.LanguageProfile == 0 {
+		s.LanguageProfile = c.Sonarr.LanguageProfile
+	}
+	if s.SeriesType == "" {
+		s.SeriesType = c.Sonarr.SeriesType
+	}
+	return s
+}
+
+// validateInstances checks the instances, the folder overrides and the routes
+// that refer to the instances.
+func (c *Config) validateInstances(add func(Severity, string, string, ...any)) {
+	names := map[string]bool{DefaultInstance: true}
+	for i, inst := range c.Instances {
+		path := fmt.Sprintf("instances[%d]", i)
+		switch {
+		case inst.Name == "":
+			add(SeverityError, path+".name", "is empty")
+		case names[inst.Name]:
+			add(SeverityError, path+".name", "%q is used twice or is reserved", inst.Name)
+		}
+		names[inst.Name] = true
+		if inst.URL == "" {
+			add(SeverityError, path+".url", "is empty")
+		} else {
+			checkURL(add, path+".url", inst.URL)
+		}
+		if inst.APIKey == "" {
+			add(SeverityError, path+".apikey", "is empty")
+		}
+		if inst.RootFolder == "" {
+			add(SeverityError, path+".rootFolder", "is empty")
+		}
+		if err := ValidateSeriesType(inst.SeriesType); err != nil {
+			add(SeverityError, path+".seriesType", "%v", err)
+		}
+		if err := ValidatePathSeparator(inst.PathSeparator); err != nil {
+			add(SeverityError, path+".pathSeparator", "%v", err)
+		}
+	}
+
+	paths := make(map[string]bool)
+	for i, f := range c.Folders {
+		path := fmt.Sprintf("folders[%d]", i)
+		if f.Path == "" {
+			add(SeverityError, path+".path", "is empty")
+			continue
+		}
+		dir := c.FolderPath(f)
+		if paths[dir] {
+			add(SeverityError, path+".path", "%s is listed twice", dir)
+		}
+		paths[dir] = true
+		if c.Sonarr.DownloadsFolder != "" && !hasPathPrefix(dir, c.Sonarr.DownloadsFolder) {
+			add(SeverityWarning, path+".path", "%s is outside the downloads folder %s", dir, c.Sonarr.DownloadsFolder)
+		}
+		if err := ValidateSeriesType(f.SeriesType); err != nil {
+			add(SeverityError, path+".seriesType", "%v", err)
+		}
+	}
+
+	for i, r := range c.Routes {
+		path := fmt.Sprintf("routes[%d]", i)
+		if !names[r.Instance] {
+			add(SeverityError, path+".instance", "unknown instance %q", r.Instance)
+		}
+		if r.Folder == "" && r.Title == "" && r.Quality == "" {
+			add(SeverityWarning, path, "has no conditions, so it matches every file")
+		}
+		if _, err := regexp.Compile(r.Title); err != nil {
+			add(SeverityError, path+".title", "%v", err)
+		}
+	}
+}
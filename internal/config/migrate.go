@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// migration moves a setting of an earlier release, or of the original
+// SonarrAutoImport, to its current key. Settings without an equivalent have
+// an empty to and are dropped with the reason in note.
+type migration struct {
+	from, to string
+	note     string
+}
+
+var migrations = []migration{
+	{from: "sonarr.transforms", to: "transforms"},
+	{from: "sonarr.mappingPath", note: "paths are sent to Sonarr as they are found"},
+	{from: "sonarr.importMode", note: "Sonarr's own import mode applies"},
+	{from: "sonarr.timeoutSecs", note: "requests time out with their context"},
+	{from: "sonarr.trimFolders", note: "folders are never trimmed"},
+	{from: "radarr.transforms", note: "the top-level transforms apply to movies too"},
+	{from: "radarr.mappingPath", note: "paths are sent to Radarr as they are found"},
+	{from: "radarr.importMode", note: "Radarr's own import mode applies"},
+	{from: "radarr.timeoutSecs", note: "requests time out with their context"},
+	{from: "radarr.trimFolders", note: "folders are never trimmed"},
+}
+
+// migrate rewrites the legacy settings of the decoded configuration doc in
+// place and returns a warning for each one found. When the current key is
+// already set it wins and the legacy setting is dropped.
+func migrate(doc map[string]any) []Issue {
+	var issues []Issue
+	for _, m := range migrations {
+		parent, key := lookup(doc, m.from)
+		if parent == nil {
+			continue
+		}
+		value := parent[key]
+		delete(parent, key)
+
+		switch {
+		case m.to == "":
+			issues = append(issues, Issue{SeverityWarning, m.from, "is no longer used and was ignored: " + m.note})
+		case set(doc, m.to, value):
+			issues = append(issues, Issue{SeverityWarning, m.from, fmt.Sprintf("is deprecated, use %s instead", m.to)})
+		default:
+			issues = append(issues, Issue{SeverityWarning, m.from, fmt.Sprintf("is deprecated and was ignored because %s is set", m.to)})
+		}
+	}
+	return issues
+}
+
+// lookup returns the object holding the dotted path in doc and the key of
+// the setting in it, matched ignoring case like encoding/json does. The
+// object is nil when the setting is absent.
+func lookup(doc map[string]any, path string) (map[string]any, string) {
+	parts := strings.Split(path, ".")
+	obj := doc
+	for i, part := range parts {
+		key, ok := foldKey(obj, part)
+		if !ok {
+			return nil, ""
+		}
+		if i == len(parts)-1 {
+			return obj, key
+		}
+		if obj, ok = obj[key].(map[string]any); !ok {
+			return nil, ""
+		}
+	}
+	return nil, ""
+}
+
+// set stores value at the dotted path of doc, creating missing objects. It
+// returns false without changing doc when the path is already set.
+func set(doc map[string]any, path string, value any) bool {
+	parts := strings.Split(path, ".")
+	obj := doc
+	for _, part := range parts[:len(parts)-1] {
+		key, ok := foldKey(obj, part)
+		if !ok {
+			key = part
+			obj[key] = make(map[string]any)
+		}
+		next, ok := obj[key].(map[string]any)
+		if !ok {
+			return false
+		}
+		obj = next
+	}
+	last := parts[len(parts)-1]
+	if _, ok := foldKey(obj, last); ok {
+		return false
+	}
+	obj[last] = value
+	return true
+}
+
+// foldKey returns the key of obj that equals name, preferring an exact match
+// over one that only differs in case.
+func foldKey(obj map[string]any, name string) (string, bool) {
+	if _, ok := obj[name]; ok {
+		return name, true
+	}
+	for key := range obj {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Separators of the paths of other machines, such as Sonarr's or the download
+// client's, which need not be the one of the machine the tool runs on.
+const (
+	SlashSeparator     = "/"
+	BackslashSeparator = `\`
+)
+
+// ValidatePathSeparator checks that sep is empty, for detecting it, or one of
+// the separators.
+func ValidatePathSeparator(sep string) error {
+	switch sep {
+	case "", SlashSeparator, BackslashSeparator:
+		return nil
+	}
+	return fmt.Errorf(`unknown path separator %q, want "/" or "\\"`, sep)
+}
+
+// DetectSeparator returns the separator of path: a backslash for paths with a
+// drive letter, UNC paths and paths with backslashes but no slashes, a slash
+// otherwise.
+func DetectSeparator(path string) string {
+	if hasDrive(path) || strings.HasPrefix(path, `\\`) ||
+		strings.Contains(path, `\`) && !strings.Contains(path, "/") {
+		return BackslashSeparator
+	}
+	return SlashSeparator
+}
+
+// hasDrive reports whether path starts with a drive letter, as in C:\.
+func hasDrive(path string) bool {
+	return len(path) >= 2 && path[1] == ':' &&
+		('a' <= path[0] && path[0] <= 'z' || 'A' <= path[0] && path[0] <= 'Z')
+}
+
+// isWindowsPath reports whether path is a Windows path, which is compared
+// ignoring case.
+func isWindowsPath(path string) bool {
+	return DetectSeparator(path) == BackslashSeparator
+}
+
+// JoinRemote joins elem to base with sep, or with the separator of base when
+// sep is empty. Unlike filepath.Join the result does not depend on the system
+// the tool runs on, and separators of either kind inside elem are converted.
+func JoinRemote(sep, base string, elem ...string) string {
+	if sep == "" {
+		sep = DetectSeparator(base)
+	}
+	joined := strings.TrimRight(base, `/\`)
+	for _, e := range elem {
+		for _, part := range splitParts(e) {
+			joined += sep + part
+		}
+	}
+	if joined == "" {
+		return base
+	}
+	if hasDrive(joined) && len(joined) == 2 {
+		joined += sep
+	}
+	return joined
+}
+
+// splitParts splits path at separators of either kind, dropping empty and "."
+// elements.
+func splitParts(path string) []string {
+	var parts []string
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// pathRoot splits path into its root, such as "/", "C:" or the server and
+// share of a UNC path, and the elements below it.
+func pathRoot(path string) (root string, parts []string) {
+	switch {
+	case hasDrive(path):
+		return strings.ToUpper(path[:2]), splitParts(path[2:])
+	case strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//"):
+		parts = splitParts(path)
+		n := min(len(parts), 2)
+		return `\\` + strings.Join(parts[:n], `\`), parts[n:]
+	case strings.HasPrefix(path, "/") || strings.HasPrefix(path, `\`):
+		return "/", splitParts(path)
+	}
+	return "", splitParts(path)
+}
+
+// HasRemotePrefix reports whether the path of another system lies below
+// prefix or is prefix.
+func HasRemotePrefix(path, prefix string) bool {
+	_, ok := remoteRel(path, prefix)
+	return ok
+}
+
+// remoteRel returns the elements of path below prefix, comparing Windows
+// paths ignoring case. ok is false when path does not lie below prefix.
+func remoteRel(path, prefix string) (rel []string, ok bool) {
+	equal := func(a, b string) bool { return a == b }
+	if isWindowsPath(prefix) {
+		equal = strings.EqualFold
+	}
+	root, parts := pathRoot(path)
+	prefixRoot, prefixParts := pathRoot(prefix)
+	if !equal(root, prefixRoot) || len(parts) < len(prefixParts) {
+		return nil, false
+	}
+	for i, part := range prefixParts {
+		if !equal(parts[i], part) {
+			return nil, false
+		}
+	}
+	return parts[len(prefixParts):], true
+}
@@ -0,0 +1,138 @@
+package config
+
+import "testing"
+
+func TestDetectSeparator(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/tv", SlashSeparator},
+		{"/mnt/anime", SlashSeparator},
+		{`C:\TV`, BackslashSeparator},
+		{"D:/Anime", BackslashSeparator},
+		{`\\nas\media\tv`, BackslashSeparator},
+		{`tv\anime`, BackslashSeparator},
+		{`/mnt/odd\name`, SlashSeparator},
+		{"", SlashSeparator},
+	}
+	for _, tt := range tests {
+		if got := DetectSeparator(tt.path); got != tt.want {
+			t.Errorf("DetectSeparator(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePathSeparator(t *testing.T) {
+	for _, sep := range []string{"", "/", `\`} {
+		if err := ValidatePathSeparator(sep); err != nil {
+			t.Errorf("ValidatePathSeparator(%q): %v", sep, err)
+		}
+	}
+	for _, sep := range []string{"//", ":", "auto"} {
+		if err := ValidatePathSeparator(sep); err == nil {
+			t.Errorf("ValidatePathSeparator(%q) succeeded", sep)
+		}
+	}
+}
+
+func TestJoinRemote(t *testing.T) {
+	tests := []struct {
+		sep, base string
+		elem      []string
+		want      string
+	}{
+		{"", "/tv", []string{"Frieren"}, "/tv/Frieren"},
+		{"", "/tv/", []string{"Frieren"}, "/tv/Frieren"},
+		{"", `C:\TV`, []string{"Frieren"}, `C:\TV\Frieren`},
+		{"", `C:\TV\`, []string{"Frieren"}, `C:\TV\Frieren`},
+		{"", `C:\`, []string{"Frieren"}, `C:\Frieren`},
+		{"", "C:", nil, `C:\`},
+		{"", `\\nas\tv`, []string{"Frieren"}, `\\nas\tv\Frieren`},
+
+		// Separators of the other kind in elem are converted
+		{"", `D:\Anime`, []string{"Season 1/Episode.mkv"}, `D:\Anime\Season 1\Episode.mkv`},
+		{"", "/tv", []string{`Frieren\Season 1`}, "/tv/Frieren/Season 1"},
+		{"", "/tv", []string{"./Frieren//", "", "."}, "/tv/Frieren"},
+
+		// An explicit separator wins over the one of base
+		{SlashSeparator, `C:\TV`, []string{"Frieren"}, `C:\TV/Frieren`},
+		{BackslashSeparator, "/tv", []string{"Frieren"}, `/tv\Frieren`},
+
+		{"", "/", []string{"tv"}, "/tv"},
+		{"", "/tv", nil, "/tv"},
+	}
+	for _, tt := range tests {
+		if got := JoinRemote(tt.sep, tt.base, tt.elem...); got != tt.want {
+			t.Errorf("JoinRemote(%q, %q, %q) = %q, want %q", tt.sep, tt.base, tt.elem, got, tt.want)
+		}
+	}
+}
+
+func TestHasRemotePrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"/downloads/anime/x.mkv", "/downloads", true},
+		{"/downloads", "/downloads/", true},
+		{"/downloads2/x.mkv", "/downloads", false},
+		{"/Downloads/x.mkv", "/downloads", false},
+
+		// Windows paths compare ignoring case and either separator
+		{`c:\downloads\x.mkv`, `C:\Downloads`, true},
+		{"C:/Downloads/x.mkv", `C:\Downloads`, true},
+		{`D:\Downloads\x.mkv`, `C:\Downloads`, false},
+		{`\\NAS\Media\x.mkv`, `\\nas\media`, true},
+		{"//nas/media/x.mkv", `\\nas\media`, true},
+		{`\\nas\other\x.mkv`, `\\nas\media`, false},
+		{`C:\Downloads\x.mkv`, "/downloads", false},
+	}
+	for _, tt := range tests {
+		if got := HasRemotePrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("HasRemotePrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestMapPathMixedSeparators(t *testing.T) {
+	mappings := []PathMapping{
+		{From: "/downloads", To: `D:\Downloads`},
+		{From: "/downloads/anime", To: `\\nas\anime`},
+		{From: `C:\Torrents`, To: "/data/torrents"},
+		{From: `\\seedbox\complete`, To: "/mnt/seedbox"},
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"/downloads/Frieren - 05.mkv", `D:\Downloads\Frieren - 05.mkv`},
+		{"/downloads/movies/Suzume.mkv", `D:\Downloads\movies\Suzume.mkv`},
+		{"/downloads/anime/Season 1/Frieren - 05.mkv", `\\nas\anime\Season 1\Frieren - 05.mkv`},
+		{`C:\Torrents\Frieren\Frieren - 05.mkv`, "/data/torrents/Frieren/Frieren - 05.mkv"},
+		{`c:\torrents\Frieren - 05.mkv`, "/data/torrents/Frieren - 05.mkv"},
+		{`\\SEEDBOX\Complete\Frieren - 05.mkv`, "/mnt/seedbox/Frieren - 05.mkv"},
+		{"/other/Frieren - 05.mkv", "/other/Frieren - 05.mkv"},
+		{`E:\Torrents\Frieren - 05.mkv`, `E:\Torrents\Frieren - 05.mkv`},
+	}
+	for _, tt := range tests {
+		if got := MapPath(mappings, tt.path); got != tt.want {
+			t.Errorf("MapPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSeriesPath(t *testing.T) {
+	tests := []struct {
+		sep, root, want string
+	}{
+		{"", "/tv", "/tv/Frieren"},
+		{"", `C:\TV`, `C:\TV\Frieren`},
+		{"", `\\nas\tv`, `\\nas\tv\Frieren`},
+		{BackslashSeparator, "T:/Anime", `T:/Anime\Frieren`},
+	}
+	for _, tt := range tests {
+		c := SonarrConfig{PathSeparator: tt.sep, RootFolder: tt.root}
+		if got := c.SeriesPath("Frieren"); got != tt.want {
+			t.Errorf("SeriesPath with root %q and separator %q = %q, want %q", tt.root, tt.sep, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+// Preset is a shareable set of anime patterns, such as those of the
+// releases of a few fansub groups. A preset file holds one as JSON, YAML or
+// TOML, selected by its extension like a rules file.
+type Preset struct {
+	Name          string                `json:"name,omitempty"`
+	Description   string                `json:"description,omitempty"`
+	AnimePatterns []parser.AnimePattern `json:"animePatterns"`
+}
+
+// Merge policies of parsing.presetMerge.
+const (
+	// PresetsAfter tries the patterns of the presets after those of
+	// parsing.animePatterns.
+	PresetsAfter = "after"
+	// PresetsBefore tries them first.
+	PresetsBefore = "before"
+)
+
+// LoadedPreset is a preset of parsing.presetFiles as LoadPresets read it.
+type LoadedPreset struct {
+	Preset
+	// Source is the entry of parsing.presetFiles: the name of a built-in
+	// preset, a path or a URL.
+	Source string
+	// Stale is set for the preset of a URL that could not be fetched, which
+	// was taken from the cache however old it was.
+	Stale bool
+}
+
+const (
+	// presetCacheTTL is how long the preset of a URL is taken from the
+	// cache before it is fetched again.
+	presetCacheTTL = 24 * time.Hour
+	// presetFetchTimeout bounds fetching one preset.
+	presetFetchTimeout = 15 * time.Second
+	// maxPresetSize is the most bytes of a fetched preset.
+	maxPresetSize = 1 << 20
+)
+
+//go:embed presets/*.json
+var builtinPresets embed.FS
+
+// BuiltinPresets returns the names of the presets embedded in the binary,
+// which parsing.presetFiles selects by name.
+func BuiltinPresets() []string {
+	entries, _ := builtinPresets.ReadDir("presets")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isURL reports whether the preset source is fetched over HTTP.
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// isBuiltin reports whether the preset source names a built-in preset.
+func isBuiltin(source string) bool {
+	if source == "" || strings.ContainsAny(source, `/\.`) {
+		return false
+	}
+	_, err := fs.Stat(builtinPresets, "presets/"+source+".json")
+	return err == nil
+}
+
+// PresetPath returns the path of the preset file of source, taken from the
+// directory of the config file at configPath when it is relative, or ""
+// when source is the name of a built-in preset or a URL.
+func PresetPath(configPath, source string) string {
+	if isURL(source) || isBuiltin(source) {
+		return ""
+	}
+	if filepath.IsAbs(source) {
+		return source
+	}
+	return filepath.Join(filepath.Dir(configPath), source)
+}
+
+// decodePreset decodes the preset in data, in the format of the extension of
+// name. Unknown keys are an error.
+func decodePreset(name string, data []byte) (*Preset, error) {
+	data, err := toJSON(data, FormatOf(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	preset := &Preset{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(preset); err != nil {
+		return nil, fmt.Errorf("failed to parse preset %s: %w", name, err)
+	}
+	return preset, nil
+}
+
+// compile fails when a pattern of p is not a valid regular expression, so
+// a broken preset at a URL does not replace the cached one. Validate reports
+// the other faults of the patterns.
+func (p *Preset) compile() error {
+	for i, pattern := range p.AnimePatterns {
+		if _, err := regexp.Compile(pattern.Pattern); err != nil {
+			return fmt.Errorf("animePatterns[%d].pattern: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// LoadPresets reads the presets of parsing.presetFiles into Presets, which
+// EffectivePatterns merges with parsing.animePatterns. Built-in presets are
+// read from the binary and relative paths from the directory of the config
+// file at configPath. The preset of a URL is cached under the state
+// directory for presetCacheTTL, and an older copy stands in for one that
+// cannot be fetched.
+func (c *Config) LoadPresets(configPath string, log *logging.Logger) error {
+	c.Presets = nil
+	for i, source := range c.Parsing.PresetFiles {
+		preset, err := c.readPreset(configPath, source, log)
+		if err != nil {
+			return fmt.Errorf("parsing.presetFiles[%d]: %w", i, err)
+		}
+		c.Presets = append(c.Presets, *preset)
+	}
+	return nil
+}
+
+// readPreset reads the preset of source, an entry of parsing.presetFiles.
+func (c *Config) readPreset(configPath, source string, log *logging.Logger) (*LoadedPreset, error) {
+	if isURL(source) {
+		return c.fetchPreset(configPath, source, log)
+	}
+	name := PresetPath(configPath, source)
+	var data []byte
+	var err error
+	if name == "" {
+		name = source + ".json"
+		data, err = builtinPresets.ReadFile("presets/" + name)
+	} else if data, err = os.ReadFile(name); err != nil {
+		err = fmt.Errorf("failed to read preset file: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	preset, err := decodePreset(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return &LoadedPreset{Preset: *preset, Source: source}, nil
+}
+
+// presetCachePath returns the file the preset of the URL source is cached
+// in.
+func (c *Config) presetCachePath(configPath, source string) string {
+	dir := c.StateDir
+	if dir == "" {
+		dir = filepath.Dir(configPath)
+	}
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(dir, "presets", hex.EncodeToString(sum[:8])+path.Ext(urlPath(source)))
+}
+
+// urlPath returns the path of the URL source, whose extension tells the
+// format of its preset.
+func urlPath(source string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return source
+	}
+	return u.Path
+}
+
+// fetchPreset returns the preset of the URL source from the cache when it is
+// fresh, or fetches it and caches it when it decodes.
+func (c *Config) fetchPreset(configPath, source string, log *logging.Logger) (*LoadedPreset, error) {
+	cache := c.presetCachePath(configPath, source)
+	name := urlPath(source)
+	cached, cacheErr := os.ReadFile(cache)
+	if info, err := os.Stat(cache); cacheErr == nil && err == nil && time.Since(info.ModTime()) < presetCacheTTL {
+		if preset, err := decodePreset(name, cached); err == nil {
+			return &LoadedPreset{Preset: *preset, Source: source}, nil
+		}
+	}
+
+	data, err := getPreset(source)
+	var preset *Preset
+	if err == nil {
+		preset, err = decodePreset(name, data)
+	}
+	if err == nil {
+		err = preset.compile()
+	}
+	if err != nil {
+		if cacheErr != nil {
+			return nil, err
+		}
+		stale, decodeErr := decodePreset(name, cached)
+		if decodeErr != nil {
+			return nil, err
+		}
+		log.Warnf("Using the cached preset of %s: %v", source, err)
+		return &LoadedPreset{Preset: *stale, Source: source, Stale: true}, nil
+	}
+	err = os.MkdirAll(filepath.Dir(cache), 0o755)
+	if err == nil {
+		err = os.WriteFile(cache, data, 0o644)
+	}
+	if err != nil {
+		log.Warnf("Failed to cache the preset of %s: %v", source, err)
+	}
+	return &LoadedPreset{Preset: *preset, Source: source}, nil
+}
+
+// getPreset fetches the preset at the URL source.
+func getPreset(source string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), presetFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch preset: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch preset: %s returned status %d", source, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPresetSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch preset: %w", err)
+	}
+	if len(data) > maxPresetSize {
+		return nil, fmt.Errorf("preset %s is larger than %d bytes", source, maxPresetSize)
+	}
+	return data, nil
+}
+
+// EffectivePattern is an anime pattern of the effective set, with the path
+// it has in the configuration, as "parsing.animePatterns[0]", or its preset,
+// as "parsing.presetFiles[1].animePatterns[0]".
+type EffectivePattern struct {
+	parser.AnimePattern
+	Path string `json:"path"`
+	// Preset is the source of the preset of the pattern, "" for those of
+	// parsing.animePatterns.
+	Preset string `json:"preset,omitempty"`
+}
+
+// EffectivePatterns returns the anime patterns the parser tries in order:
+// those of parsing.animePatterns and those of the presets, which come after
+// them unless parsing.presetMerge is "before".
+func (c *Config) EffectivePatterns() []EffectivePattern {
+	var own, presets []EffectivePattern
+	for i, p := range c.Parsing.AnimePatterns {
+		own = append(own, EffectivePattern{AnimePattern: p, Path: fmt.Sprintf("parsing.animePatterns[%d]", i)})
+	}
+	for i, preset := range c.Presets {
+		for j, p := range preset.AnimePatterns {
+			presets = append(presets, EffectivePattern{AnimePattern: p, Path: fmt.Sprintf("parsing.presetFiles[%d].animePatterns[%d]", i, j), Preset: preset.Source})
+		}
+	}
+	if c.Parsing.PresetMerge == PresetsBefore {
+		return append(presets, own...)
+	}
+	return append(own, presets...)
+}
+
+// animePatterns returns the patterns of EffectivePatterns for the parser.
+func (c *Config) animePatterns() []parser.AnimePattern {
+	if len(c.Presets) == 0 {
+		return c.Parsing.AnimePatterns
+	}
+	effective := c.EffectivePatterns()
+	patterns := make([]parser.AnimePattern, len(effective))
+	for i, p := range effective {
+		patterns[i] = p.AnimePattern
+	}
+	return patterns
+}
@@ -0,0 +1,48 @@
+package config
+
+import "reflect"
+
+// startupSettings are the settings that are only read when the daemon
+// starts. A reload cannot apply them.
+var startupSettings = []struct {
+	path  string
+	field func(*Config) any
+}{
+	{"daemon.interval", func(c *Config) any { return &c.Daemon.Interval }},
+	{"daemon.drainTimeout", func(c *Config) any { return &c.Daemon.DrainTimeout }},
+	{"daemon.mode", func(c *Config) any { return &c.Daemon.Mode }},
+	{"daemon.watch", func(c *Config) any { return &c.Daemon.Watch }},
+	{"daemon.watchDebounce", func(c *Config) any { return &c.Daemon.WatchDebounce }},
+	{"daemon.rescanInterval", func(c *Config) any { return &c.Daemon.RescanInterval }},
+	{"daemon.listenAddr", func(c *Config) any { return &c.Daemon.ListenAddr }},
+	{"daemon.pingUrl", func(c *Config) any { return &c.Daemon.PingURL }},
+	{"daemon.pingMethod", func(c *Config) any { return &c.Daemon.PingMethod }},
+	{"daemon.reportDir", func(c *Config) any { return &c.Daemon.ReportDir }},
+	{"daemon.reportRetention", func(c *Config) any { return &c.Daemon.ReportRetention }},
+	{"daemon.historyRetention", func(c *Config) any { return &c.Daemon.HistoryRetention }},
+	{"daemon.pauseFile", func(c *Config) any { return &c.Daemon.PauseFile }},
+	{"daemon.activeHours", func(c *Config) any { return &c.Daemon.ActiveHours }},
+	{"daemon.timezone", func(c *Config) any { return &c.Daemon.Timezone }},
+	{"daemon.latencyWarning", func(c *Config) any { return &c.Daemon.LatencyWarning }},
+	{"daemon.logRepeatWindow", func(c *Config) any { return &c.Daemon.LogRepeatWindow }},
+	{"daemon.enablePprof", func(c *Config) any { return &c.Daemon.EnablePprof }},
+	{"daemon.pprofAddr", func(c *Config) any { return &c.Daemon.PprofAddr }},
+	{"stateDir", func(c *Config) any { return &c.StateDir }},
+	{"retry", func(c *Config) any { return &c.Retry }},
+	{"ignore", func(c *Config) any { return &c.Ignore }},
+}
+
+// KeepStartupSettings copies the settings that only take effect on startup
+// from old into c and returns the paths of those that differed.
+func (c *Config) KeepStartupSettings(old *Config) []string {
+	var changed []string
+	for _, s := range startupSettings {
+		cur := reflect.ValueOf(s.field(c)).Elem()
+		prev := reflect.ValueOf(s.field(old)).Elem()
+		if !reflect.DeepEqual(cur.Interface(), prev.Interface()) {
+			changed = append(changed, s.path)
+			cur.Set(prev)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+// Rules are the settings that decide how files are matched, kept apart from
+// URLs and credentials so they can be shared between machines: title
+// aliases, transforms, the profiles of release groups and the settings of
+// single series. A rules file holds
+// them as JSON, YAML or TOML, selected by its extension like a config file,
+// but without environment variables.
+type Rules struct {
+	Aliases    []AliasRule            `json:"aliases,omitempty"`
+	Transforms []parser.Transform     `json:"transforms,omitempty"`
+	Groups     map[string]GroupConfig `json:"groups,omitempty"`
+	Series     []SeriesRule           `json:"series,omitempty"`
+}
+
+// AliasRule maps a parsed title to the TVDB ID of its series, like the
+// aliases the resolve command saves.
+type AliasRule struct {
+	Title  string `json:"title"`
+	TvdbID int    `json:"tvdbId"`
+}
+
+// SeriesRule holds the settings of the series whose files have Title, which
+// is compared in the form of parser.NormalizeTitle.
+type SeriesRule struct {
+	Title string `json:"title"`
+	// Cours split the seasons of the series into parts that releases number
+	// on their own, as "Part 2 - 01" for the 13th episode of a season.
+	Cours []CourRule `json:"cours,omitempty"`
+}
+
+// CourRule is a part of a Sonarr season. A file is renumbered by it when a
+// token after its title names it, such as "Part 2", "Cour 2" or "2nd Cour"
+// for Number 2 or Name itself, or when a file without a token and without a
+// season has an episode from From to To. The episodes of a token count from
+// 1, unless they are from From to To.
+type CourRule struct {
+	Number int    `json:"number,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Season and Start are the Sonarr season and episode of the first
+	// episode of the cour.
+	Season int `json:"season"`
+	Start  int `json:"start"`
+	// From and To are the episodes the cour has in files that continue the
+	// numbering of the earlier cours; both are 0 when there are none.
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+}
+
+// Label names the cour in the log, as in "cour 2".
+func (r CourRule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("cour %d", r.Number)
+}
+
+// ReadRules reads the rules file at path. Unknown keys are an error.
+func ReadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	if data, err = toJSON(data, FormatOf(path)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rules := &Rules{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// WriteRules writes rules to path in the format of its extension.
+func WriteRules(path string, rules *Rules) error {
+	data, err := MarshalRules(rules, FormatOf(path))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write rules file: %w", err)
+	}
+	return nil
+}
+
+// MarshalRules returns rules in format f.
+func MarshalRules(rules *Rules, f Format) ([]byte, error) {
+	data, err := json.Marshal(rules)
+	if err == nil {
+		data, err = fromJSON(data, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rules: %w", err)
+	}
+	return data, nil
+}
+
+// RulesFilePath returns the path of the rules file of c, whose relative
+// rulesFile is taken from the directory of the config file at configPath,
+// or "" when c has none.
+func (c *Config) RulesFilePath(configPath string) string {
+	if c.RulesFile == "" || filepath.IsAbs(c.RulesFile) {
+		return c.RulesFile
+	}
+	return filepath.Join(filepath.Dir(configPath), c.RulesFile)
+}
+
+// LoadRules reads the rules file of c, if any, and merges it: its aliases
+// apply after those the resolve command saved, its transforms run after
+// those of c and its groups are added unless c has a group of the same
+// name. A rules file that does not exist is left out.
+func (c *Config) LoadRules(configPath string) error {
+	path := c.RulesFilePath(configPath)
+	if path == "" {
+		return nil
+	}
+	c.RulesPath = path
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		// Validate warns about it, and rules import creates it
+		return nil
+	}
+	rules, err := ReadRules(path)
+	if err != nil {
+		return err
+	}
+	c.Rules = rules
+	c.ownTransforms = len(c.Transforms)
+	c.Transforms = append(c.Transforms, rules.Transforms...)
+	for name, g := range rules.Groups {
+		if _, ok := c.Groups[name]; ok {
+			continue
+		}
+		if c.Groups == nil {
+			c.Groups = make(map[string]GroupConfig)
+		}
+		c.Groups[name] = g
+		c.ruleGroups = append(c.ruleGroups, name)
+	}
+	return nil
+}
+
+// RuleAlias returns the TVDB ID the rules file maps title to, compared in the
+// form of parser.NormalizeTitle, or 0.
+func (c *Config) RuleAlias(title string) int {
+	if c.Rules == nil {
+		return 0
+	}
+	key := parser.NormalizeTitle(title)
+	for _, a := range c.Rules.Aliases {
+		if parser.NormalizeTitle(a.Title) == key {
+			return a.TvdbID
+		}
+	}
+	return 0
+}
+
+// SeriesRule returns the series rule of the rules file for title, compared
+// in the form of parser.NormalizeTitle, or nil.
+func (c *Config) SeriesRule(title string) *SeriesRule {
+	if c.Rules == nil {
+		return nil
+	}
+	if i := c.Rules.seriesIndex(title); i >= 0 {
+		return &c.Rules.Series[i]
+	}
+	return nil
+}
+
+// TransformPath is the path of transform i of c in issues and output, which
+// names the rules file for the transforms it added.
+func (c *Config) TransformPath(i int) string {
+	if c.Rules != nil && i >= c.ownTransforms {
+		return fmt.Sprintf("rulesFile.transforms[%d]", i-c.ownTransforms)
+	}
+	return fmt.Sprintf("transforms[%d]", i)
+}
+
+// RuleGroup reports whether the group called name was merged from the rules
+// file rather than being one of the groups of the config.
+func (c *Config) RuleGroup(name string) bool {
+	return slices.Contains(c.ruleGroups, name)
+}
+
+// groupPath is the path of the group called name in issues.
+func (c *Config) groupPath(name string) string {
+	if c.RuleGroup(name) {
+		return "rulesFile.groups." + name
+	}
+	return "groups." + name
+}
+
+// validateRules checks the aliases and series rules of the rules file and
+// warns about its groups that groups of c override.
+func (c *Config) validateRules(add func(Severity, string, string, ...any)) {
+	if c.RulesPath != "" && c.Rules == nil {
+		add(SeverityWarning, "rulesFile", "%s does not exist", c.RulesPath)
+	}
+	if c.Rules == nil {
+		return
+	}
+	seen := make(map[string]int)
+	for i, a := range c.Rules.Aliases {
+		path := fmt.Sprintf("rulesFile.aliases[%d]", i)
+		key := parser.NormalizeTitle(a.Title)
+		switch {
+		case key == "":
+			add(SeverityError, path+".title", "is empty")
+		case a.TvdbID <= 0:
+			add(SeverityError, path+".tvdbId", "must be a TVDB ID, not %d", a.TvdbID)
+		case seen[key] != 0 && seen[key] != a.TvdbID:
+			add(SeverityError, path, "maps %q to %d, an earlier alias to %d", a.Title, a.TvdbID, seen[key])
+		}
+		if seen[key] == 0 {
+			seen[key] = a.TvdbID
+		}
+	}
+	names := make([]string, 0, len(c.Rules.Groups))
+	for name := range c.Rules.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !reflect.DeepEqual(c.Groups[name], c.Rules.Groups[name]) {
+			add(SeverityWarning, "rulesFile.groups."+name, "is overridden by groups.%s of the config", name)
+		}
+	}
+	for i, s := range c.Rules.Series {
+		path := fmt.Sprintf("rulesFile.series[%d]", i)
+		key := parser.NormalizeTitle(s.Title)
+		switch {
+		case key == "":
+			add(SeverityError, path+".title", "is empty")
+		case c.Rules.seriesIndex(s.Title) < i:
+			add(SeverityError, path+".title", "%q has an earlier series rule", s.Title)
+		}
+		validateCours(path, s.Cours, add)
+	}
+}
+
+// validateCours checks the cours of the series rule at path: each is named
+// by a number or a name no other cour has, starts at an episode and numbers
+// the files without a token in a range of its own.
+func validateCours(path string, cours []CourRule, add func(Severity, string, string, ...any)) {
+	for i, r := range cours {
+		p := fmt.Sprintf("%s.cours[%d]", path, i)
+		if r.Number <= 0 && parser.NormalizeTitle(r.Name) == "" {
+			add(SeverityError, p, "needs a number or a name")
+		}
+		if r.Number < 0 {
+			add(SeverityError, p+".number", "must be positive, not %d", r.Number)
+		}
+		if r.Season < 1 {
+			add(SeverityError, p+".season", "must be a regular season, not %d", r.Season)
+		}
+		if r.Start < 1 {
+			add(SeverityError, p+".start", "must be an episode, not %d", r.Start)
+		}
+		switch {
+		case r.From == 0 && r.To == 0:
+		case r.From < 1 || r.To < r.From:
+			add(SeverityError, p, "from %d to %d is not a range of episodes", r.From, r.To)
+		}
+		for j, earlier := range cours[:i] {
+			switch {
+			case r.Number > 0 && r.Number == earlier.Number:
+				add(SeverityError, p+".number", "%d is the number of cours[%d]", r.Number, j)
+			case r.Name != "" && parser.NormalizeTitle(r.Name) == parser.NormalizeTitle(earlier.Name):
+				add(SeverityError, p+".name", "%q is the name of cours[%d]", r.Name, j)
+			case r.From > 0 && r.From <= r.To && earlier.From > 0 && earlier.From <= earlier.To && r.From <= earlier.To && earlier.From <= r.To:
+				add(SeverityError, p, "episodes %d-%d overlap those of cours[%d]", r.From, r.To, j)
+			}
+		}
+	}
+}
+
+// Validate checks r as the rules file of a configuration would be checked,
+// with the paths of the issues starting with "rulesFile.".
+func (r *Rules) Validate() []Issue {
+	c := &Config{Rules: r, Transforms: r.Transforms, Groups: r.Groups}
+	for name := range r.Groups {
+		c.ruleGroups = append(c.ruleGroups, name)
+	}
+	var issues []Issue
+	for _, issue := range c.Validate() {
+		if strings.HasPrefix(issue.Path, "rulesFile.") {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// RuleChange is the outcome of merging one rule into a rules file.
+type RuleChange struct {
+	// Kind is "alias", "transform", "group" or "series".
+	Kind string `json:"kind"`
+	// Name is the title of an alias or a series rule, the search of a
+	// transform or the name of a group.
+	Name string `json:"name"`
+	// Outcome is RuleAdded, RuleUnchanged, RuleConflict or RuleReplaced.
+	Outcome string `json:"outcome"`
+	// Detail describes a conflict.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Outcomes of RuleChange.
+const (
+	RuleAdded     = "added"
+	RuleUnchanged = "unchanged"
+	RuleConflict  = "conflict"
+	RuleReplaced  = "replaced"
+)
+
+// Merge adds the rules of in to r and reports what happened to each of
+// them. A rule that differs from the one r has for the same title, search,
+// group name or series title is a conflict, which keeps the rule of r unless replace is set.
+// Transforms are appended in their order.
+func (r *Rules) Merge(in *Rules, replace bool) []RuleChange {
+	var changes []RuleChange
+	conflict := func(kind, name, detail string) RuleChange {
+		if replace {
+			return RuleChange{Kind: kind, Name: name, Outcome: RuleReplaced, Detail: detail}
+		}
+		return RuleChange{Kind: kind, Name: name, Outcome: RuleConflict, Detail: detail}
+	}
+
+	for _, a := range in.Aliases {
+		i := r.aliasIndex(a.Title)
+		switch {
+		case i < 0:
+			r.Aliases = append(r.Aliases, a)
+			changes = append(changes, RuleChange{Kind: "alias", Name: a.Title, Outcome: RuleAdded})
+		case r.Aliases[i].TvdbID == a.TvdbID:
+			changes = append(changes, RuleChange{Kind: "alias", Name: a.Title, Outcome: RuleUnchanged})
+		default:
+			changes = append(changes, conflict("alias", a.Title,
+				fmt.Sprintf("TVDB ID %d, the existing alias maps it to %d", a.TvdbID, r.Aliases[i].TvdbID)))
+			if replace {
+				r.Aliases[i] = a
+			}
+		}
+	}
+
+	for _, t := range in.Transforms {
+		i := -1
+		for j, existing := range r.Transforms {
+			if existing.Search == t.Search {
+				i = j
+				break
+			}
+		}
+		switch {
+		case i < 0:
+			r.Transforms = append(r.Transforms, t)
+			changes = append(changes, RuleChange{Kind: "transform", Name: t.Search, Outcome: RuleAdded})
+		case r.Transforms[i].Replace == t.Replace:
+			changes = append(changes, RuleChange{Kind: "transform", Name: t.Search, Outcome: RuleUnchanged})
+		default:
+			changes = append(changes, conflict("transform", t.Search,
+				fmt.Sprintf("replace %q, the existing transform has %q", t.Replace, r.Transforms[i].Replace)))
+			if replace {
+				r.Transforms[i] = t
+			}
+		}
+	}
+
+	names := make([]string, 0, len(in.Groups))
+	for name := range in.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := in.Groups[name]
+		existing, ok := r.Groups[name]
+		switch {
+		case !ok:
+			if r.Groups == nil {
+				r.Groups = make(map[string]GroupConfig)
+			}
+			r.Groups[name] = g
+			changes = append(changes, RuleChange{Kind: "group", Name: name, Outcome: RuleAdded})
+		case reflect.DeepEqual(existing, g):
+			changes = append(changes, RuleChange{Kind: "group", Name: name, Outcome: RuleUnchanged})
+		default:
+			changes = append(changes, conflict("group", name, "its settings differ from the existing group"))
+			if replace {
+				r.Groups[name] = g
+			}
+		}
+	}
+
+	for _, s := range in.Series {
+		i := r.seriesIndex(s.Title)
+		switch {
+		case i < 0:
+			r.Series = append(r.Series, s)
+			changes = append(changes, RuleChange{Kind: "series", Name: s.Title, Outcome: RuleAdded})
+		case reflect.DeepEqual(r.Series[i], s):
+			changes = append(changes, RuleChange{Kind: "series", Name: s.Title, Outcome: RuleUnchanged})
+		default:
+			changes = append(changes, conflict("series", s.Title, "its settings differ from the existing series rule"))
+			if replace {
+				r.Series[i] = s
+			}
+		}
+	}
+	return changes
+}
+
+// aliasIndex returns the index of the alias of title in r, or -1.
+func (r *Rules) aliasIndex(title string) int {
+	key := parser.NormalizeTitle(title)
+	for i, a := range r.Aliases {
+		if parser.NormalizeTitle(a.Title) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// seriesIndex returns the index of the series rule of title in r, or -1.
+func (r *Rules) seriesIndex(title string) int {
+	key := parser.NormalizeTitle(title)
+	for i, s := range r.Series {
+		if parser.NormalizeTitle(s.Title) == key {
+			return i
+		}
+	}
+	return -1
+}
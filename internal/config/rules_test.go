@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+// fullRules returns rules with every field set, so a field the formats lose
+// fails the round trip.
+func fullRules() *Rules {
+	enabled, disabled := true, false
+	return &Rules{
+		Aliases: []AliasRule{
+			{Title: "Sousou no Frieren", TvdbID: 424536},
+			{Title: "Oshi no Ko", TvdbID: 421069},
+		},
+		Transforms: []parser.Transform{
+			{Search: `\[Hi10\]`, Replace: " ", Comment: "bit depth tag", Name: "hi10", Enabled: &enabled},
+			{Search: "_", Replace: " ", Comment: "underscores", Name: "underscores", Enabled: &disabled},
+		},
+		Groups: map[string]GroupConfig{
+			"ASW": {
+				AnimePatterns: []parser.AnimePattern{{
+					Pattern:      `^\[ASW\]\s+(.+?)\s+-\s+(\d+)(?:\s+S(\d+))?`,
+					TitleGroup:   1,
+					SeasonGroup:  3,
+					EpisodeGroup: 2,
+					SeriesType:   "anime",
+					Require:      &parser.Requirement{Episode: true, Season: true, MinTitleLength: 2, MaxTitleLength: 80},
+					Comment:      "[ASW] Show - 05 [1080p HEVC].mkv",
+					Name:         "asw",
+					Enabled:      &enabled,
+				}},
+				Qualities: map[string]string{"1080p": "WEBDL-1080p", "*": "WEBDL-720p"},
+				Language:  "Japanese",
+				Trust:     5,
+			},
+		},
+		Series: []SeriesRule{{
+			Title: "Frieren",
+			Cours: []CourRule{
+				{Number: 2, Name: "Part 2", Season: 1, Start: 17, From: 17, To: 28},
+				{Number: 3, Name: "Final Part", Season: 2, Start: 1, From: 29, To: 40},
+			},
+		}},
+	}
+}
+
+// checkSet fails the test for every field of v that holds its zero value,
+// descending into structs, slices, maps and the pointers to structs. A
+// pointer to another type only needs to be set, as false is what Enabled is
+// set to.
+func checkSet(t *testing.T, path string, v reflect.Value) {
+	t.Helper()
+	if v.IsZero() {
+		t.Errorf("%s is not set in fullRules", path)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Elem().Kind() == reflect.Struct {
+			checkSet(t, path, v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			checkSet(t, path+"."+v.Type().Field(i).Name, v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			checkSet(t, path+"[]", v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			checkSet(t, path+"[]", v.MapIndex(key))
+		}
+	}
+}
+
+func TestRulesRoundTrip(t *testing.T) {
+	rules := fullRules()
+	checkSet(t, "Rules", reflect.ValueOf(rules))
+
+	for _, f := range Formats {
+		path := filepath.Join(t.TempDir(), "rules."+string(f))
+		if err := WriteRules(path, rules); err != nil {
+			t.Fatalf("%s: WriteRules: %v", f, err)
+		}
+		read, err := ReadRules(path)
+		if err != nil {
+			t.Fatalf("%s: ReadRules: %v", f, err)
+		}
+		if !reflect.DeepEqual(read, rules) {
+			t.Errorf("%s: rules after a round trip = %+v, want %+v", f, read, rules)
+		}
+
+		// Marshalling what was read gives the file back
+		want, err := MarshalRules(rules, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := MarshalRules(read, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: marshalled again:\n%s\nwant:\n%s", f, got, want)
+		}
+		for _, issue := range read.Validate() {
+			if issue.Severity == SeverityError {
+				t.Errorf("%s: rules read back are invalid: %s", f, issue)
+			}
+		}
+	}
+}
+
+func TestRulesMerge(t *testing.T) {
+	rules := &Rules{
+		Aliases:    []AliasRule{{Title: "Sousou no Frieren", TvdbID: 424536}, {Title: "Oshi no Ko", TvdbID: 1}},
+		Transforms: []parser.Transform{{Search: "_", Replace: "-"}},
+	}
+	in := fullRules()
+
+	changes := rules.Merge(in, false)
+	outcomes := make(map[string]string)
+	for _, c := range changes {
+		outcomes[c.Kind+" "+c.Name] = c.Outcome
+	}
+	want := map[string]string{
+		"alias Sousou no Frieren": RuleUnchanged,
+		"alias Oshi no Ko":        RuleConflict,
+		`transform \[Hi10\]`:      RuleAdded,
+		"transform _":             RuleConflict,
+		"group ASW":               RuleAdded,
+		"series Frieren":          RuleAdded,
+	}
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("Merge = %v, want %v", outcomes, want)
+	}
+	if rules.Aliases[1].TvdbID != 1 || rules.Transforms[0].Replace != "-" {
+		t.Error("a conflicting rule replaced the existing one")
+	}
+
+	// Merging the same rules again changes nothing
+	for _, c := range rules.Merge(fullRules(), false) {
+		if c.Outcome == RuleAdded {
+			t.Errorf("second merge added %s %s", c.Kind, c.Name)
+		}
+	}
+
+	for _, c := range rules.Merge(fullRules(), true) {
+		if c.Outcome == RuleConflict {
+			t.Errorf("merge with replace left a conflict for %s %s", c.Kind, c.Name)
+		}
+	}
+	if rules.Aliases[1].TvdbID != 421069 || rules.Transforms[0].Replace != " " {
+		t.Errorf("aliases %+v and transforms %+v after the merge with replace", rules.Aliases, rules.Transforms)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteRules(filepath.Join(dir, "rules.yaml"), fullRules()); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Default()
+	cfg.RulesFile = "rules.yaml"
+	own := GroupConfig{Language: "English"}
+	cfg.Groups = map[string]GroupConfig{"ASW": own}
+	transforms := len(cfg.Transforms)
+	if err := cfg.LoadRules(filepath.Join(dir, "config.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RuleAlias("Sousou no Frieren") != 424536 {
+		t.Error("the alias of the rules file does not apply")
+	}
+	if len(cfg.Transforms) != transforms+2 || cfg.Transforms[transforms].Name != "hi10" {
+		t.Errorf("transforms = %+v, want those of the rules file after the %d of the config", cfg.Transforms, transforms)
+	}
+	if !reflect.DeepEqual(cfg.Groups["ASW"], own) || cfg.RuleGroup("ASW") {
+		t.Error("the group of the rules file replaced the one of the config")
+	}
+	if rule := cfg.SeriesRule("frieren"); rule == nil || len(rule.Cours) != 2 {
+		t.Errorf("SeriesRule(frieren) = %+v, want the two cours", rule)
+	}
+}
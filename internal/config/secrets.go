@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fileSuffix ends the name of a setting that holds the path of a file with
+// the value of the setting without the suffix.
+const fileSuffix = "File"
+
+// readSecretFiles replaces every setting whose File companion is set with the
+// contents of that file, trimmed of surrounding whitespace. It walks the
+// structs, slices and maps of v and returns an error naming the setting and the
+// file for each file that cannot be read.
+func readSecretFiles(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return readSecretFiles(v.Elem(), path)
+
+	case reflect.Struct:
+		t := v.Type()
+		var errs []error
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if f.Anonymous {
+				errs = append(errs, readSecretFiles(v.Field(i), path))
+				continue
+			}
+			name := jsonName(f)
+			if name == "-" {
+				continue
+			}
+			target, ok := secretTarget(t, f)
+			if !ok {
+				errs = append(errs, readSecretFiles(v.Field(i), joinPath(path, name)))
+				continue
+			}
+			file := v.Field(i).String()
+			if file == "" {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", joinPath(path, name), err))
+				continue
+			}
+			v.FieldByIndex(target.Index).SetString(strings.TrimSpace(string(data)))
+		}
+		return errors.Join(errs...)
+
+	case reflect.Slice, reflect.Array:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, readSecretFiles(v.Index(i), fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return errors.Join(errs...)
+
+	case reflect.Map:
+		var errs []error
+		for _, key := range mapKeys(v) {
+			errs = append(errs, updateMapValue(v, key, func(elem reflect.Value) error {
+				return readSecretFiles(elem, joinPath(path, key.String()))
+			}))
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// mapKeys returns the keys of the map v in order, so errors come in the
+// same order on every run.
+func mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+// updateMapValue calls update with a settable copy of the value of key in
+// the map v and stores the copy back, as map values cannot be set in place.
+func updateMapValue(v, key reflect.Value, update func(reflect.Value) error) error {
+	elem := reflect.New(v.Type().Elem()).Elem()
+	elem.Set(v.MapIndex(key))
+	err := update(elem)
+	v.SetMapIndex(key, elem)
+	return err
+}
+
+// secretTarget returns the string field of t that f, a string field named
+// with fileSuffix, provides the value of.
+func secretTarget(t reflect.Type, f reflect.StructField) (reflect.StructField, bool) {
+	if f.Type.Kind() != reflect.String || !strings.HasSuffix(f.Name, fileSuffix) {
+		return reflect.StructField{}, false
+	}
+	target, ok := t.FieldByName(strings.TrimSuffix(f.Name, fileSuffix))
+	if !ok || target.Type.Kind() != reflect.String {
+		return reflect.StructField{}, false
+	}
+	return target, true
+}
+
+// jsonName returns the JSON name of f, or "-" when it is not encoded.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// redacted is shown instead of a credential.
+const redacted = "(redacted)"
+
+// Redacted returns a copy of c with every setting that has a File companion,
+// such as API keys and tokens, replaced by a placeholder when it is set. The
+// values of every headers setting are replaced too, as the headers a proxy
+// needs usually carry credentials.
+func (c *Config) Redacted() *Config {
+	data, _ := json.Marshal(c)
+	cp := &Config{}
+	_ = json.Unmarshal(data, cp)
+	redactSecrets(reflect.ValueOf(cp))
+	return cp
+}
+
+// redactSecrets walks v like readSecretFiles and blanks out the targets of
+// the File settings and the values of the headers settings.
+func redactSecrets(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			redactSecrets(v.Elem())
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if target, ok := secretTarget(t, f); ok {
+				if secret := v.FieldByIndex(target.Index); secret.String() != "" {
+					secret.SetString(redacted)
+				}
+				continue
+			}
+			if headers, ok := v.Field(i).Interface().(map[string]string); ok && jsonName(f) == "headers" {
+				for name := range headers {
+					headers[name] = redacted
+				}
+				continue
+			}
+			redactSecrets(v.Field(i))
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redactSecrets(v.Index(i))
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			_ = updateMapValue(v, key, func(elem reflect.Value) error {
+				redactSecrets(elem)
+				return nil
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tokenSetting struct {
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile"`
+}
+
+func TestReadSecretFilesInMaps(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	if err := os.WriteFile(file, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v := struct {
+		Targets map[string]tokenSetting   `json:"targets"`
+		Shared  map[string]*tokenSetting  `json:"shared"`
+		Nested  map[string][]tokenSetting `json:"nested"`
+		Empty   map[string]tokenSetting   `json:"empty"`
+	}{
+		Targets: map[string]tokenSetting{"push": {TokenFile: file}, "plain": {Token: "inline"}},
+		Shared:  map[string]*tokenSetting{"chat": {TokenFile: file}},
+		Nested:  map[string][]tokenSetting{"hooks": {{TokenFile: file}}},
+	}
+	if err := readSecretFiles(reflect.ValueOf(&v), ""); err != nil {
+		t.Fatal(err)
+	}
+	if v.Targets["push"].Token != "s3cret" || v.Shared["chat"].Token != "s3cret" || v.Nested["hooks"][0].Token != "s3cret" {
+		t.Errorf("the token files in maps were not read: %+v, %+v, %+v", v.Targets, *v.Shared["chat"], v.Nested)
+	}
+	if v.Targets["plain"].Token != "inline" {
+		t.Errorf("the inline token became %q", v.Targets["plain"].Token)
+	}
+
+	v.Targets["push"] = tokenSetting{TokenFile: filepath.Join(dir, "missing")}
+	err := readSecretFiles(reflect.ValueOf(&v), "")
+	if err == nil || !strings.Contains(err.Error(), "targets.push.tokenFile") {
+		t.Errorf("a missing token file in a map = %v, want an error naming targets.push.tokenFile", err)
+	}
+}
+
+func TestRedactedHeaders(t *testing.T) {
+	cfg := Default()
+	cfg.Sonarr.APIKey = "sonarr-key"
+	cfg.Sonarr.Headers = map[string]string{"X-Auth-User": "proxy-user"}
+	cfg.Radarr.Headers = map[string]string{"Proxy-Authorization": "Basic cHJveHk6cGFzcw=="}
+	cfg.Notifications.Webhooks = []NotifyWebhookConfig{{URL: "http://hooks", Headers: map[string]string{"X-Hook-Token": "hook-token"}}}
+
+	data, err := json.Marshal(cfg.Redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"sonarr-key", "proxy-user", "cHJveHk6cGFzcw==", "hook-token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the redacted config shows %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), `"X-Auth-User":"(redacted)"`) {
+		t.Errorf("the redacted config drops the header names: %s", data)
+	}
+	if cfg.Sonarr.Headers["X-Auth-User"] != "proxy-user" {
+		t.Error("Redacted changed the headers of the config")
+	}
+}
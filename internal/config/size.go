@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes ParseSize accepts, longest first so "GiB" is
+// not taken for "B".
+var sizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "500MB", "1.5GB" or "10GiB" into bytes. A
+// plain number is a number of bytes and the units ignore case.
+func ParseSize(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	factor := 1.0
+	for _, u := range sizeUnits {
+		if len(value) >= len(u.suffix) && strings.EqualFold(value[len(value)-len(u.suffix):], u.suffix) {
+			value, factor = strings.TrimSpace(value[:len(value)-len(u.suffix)]), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use a size such as 500MB or 10GB", s)
+	}
+	return int64(n * factor), nil
+}
+
+// FormatSize renders n bytes with the largest decimal unit that keeps the
+// value at or above 1, as in "1.5 GB".
+func FormatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	v := float64(n)
+	i := 0
+	for v >= 1000 && i < len(units)-1 {
+		v /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CheckKeys reports every key in the JSON document data that does not belong
+// to Config, with its JSON path and the closest known key. Keys that only
+// differ from a known key in case still work, because encoding/json ignores
+// case, but are reported as warnings, as are the legacy settings that are
+// migrated. The error reports invalid JSON with its line and column.
+func CheckKeys(data []byte) ([]Issue, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, col := position(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("line %d, column %d: %w", line, col, err)
+		}
+		return nil, err
+	}
+
+	var issues []Issue
+	if obj, ok := doc.(map[string]any); ok {
+		issues = migrate(obj)
+	}
+	checkKeys(doc, reflect.TypeOf(Config{}), "", &issues)
+	return issues, nil
+}
+
+// UnknownKeysError lists the keys of a configuration that do not belong to
+// Config. Decoding it would silently leave their settings at zero.
+type UnknownKeysError struct {
+	Issues []Issue
+}
+
+func (e *UnknownKeysError) Error() string {
+	keys := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		keys[i] = issue.Path + " (" + issue.Message + ")"
+	}
+	return "unknown config key(s): " + strings.Join(keys, ", ")
+}
+
+// unknownKeys returns the errors among issues as an *UnknownKeysError, or
+// nil when there are none.
+func unknownKeys(issues []Issue) error {
+	var unknown []Issue
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			unknown = append(unknown, issue)
+		}
+	}
+	if unknown == nil {
+		return nil
+	}
+	return &UnknownKeysError{unknown}
+}
+
+// checkKeys compares the decoded value v with the type t it will be
+// unmarshalled into.
+func checkKeys(v any, t reflect.Type, path string, issues *[]Issue) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := joinPath(path, key)
+			field, ok := fields[key]
+			if !ok {
+				if known := caseMatch(fields, key); known != "" {
+					*issues = append(*issues, Issue{SeverityWarning, keyPath, fmt.Sprintf("should be spelled %q", known)})
+					field = fields[known]
+				} else {
+					message := "unknown key"
+					if near := nearest(fields, key); near != "" {
+						message += fmt.Sprintf(", did you mean %q?", near)
+					}
+					*issues = append(*issues, Issue{SeverityError, keyPath, message})
+					continue
+				}
+			}
+			checkKeys(obj[key], field, keyPath, issues)
+		}
+
+	case reflect.Slice, reflect.Array:
+		list, ok := v.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), issues)
+		}
+
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		for key, item := range obj {
+			checkKeys(item, t.Elem(), joinPath(path, key), issues)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of t's fields, including those promoted from
+// embedded structs, to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// caseMatch returns the known field that equals key ignoring case.
+func caseMatch(fields map[string]reflect.Type, key string) string {
+	for name := range fields {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// nearest returns the known field closest to key in edit distance, ignoring
+// case, or "" when none is close enough to be a likely misspelling.
+func nearest(fields map[string]reflect.Type, key string) string {
+	best, bestDistance := "", len(key)/3+2
+	for name := range fields {
+		d := editDistance(strings.ToLower(name), strings.ToLower(key))
+		if d < bestDistance || d == bestDistance && best != "" && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
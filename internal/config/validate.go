@@ -0,0 +1,457 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// Severity tells whether an Issue prevents the tool from working.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found in a configuration file. Path is the JSON path of
+// the setting, such as "parsing.animePatterns[2].pattern".
+type Issue struct {
+	Severity Severity
+	Path     string
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// HasErrors reports whether any of issues is an error.
+func HasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the settings that would otherwise only fail once a scan
+// runs. It returns every problem found.
+func (c *Config) Validate() []Issue {
+	var issues []Issue
+	add := func(severity Severity, path, format string, args ...any) {
+		issues = append(issues, Issue{severity, path, fmt.Sprintf(format, args...)})
+	}
+
+	if c.Sonarr.URL == "" {
+		add(SeverityError, "sonarr.url", "is empty")
+	} else {
+		checkURL(add, "sonarr.url", c.Sonarr.URL)
+	}
+	checkHeaders(add, "sonarr.headers", c.Sonarr.Headers)
+	switch {
+	case c.Sonarr.APIKey == "" && c.Sonarr.APIKeyFile != "":
+		add(SeverityError, "sonarr.apikeyFile", "%s is empty", c.Sonarr.APIKeyFile)
+	case c.Sonarr.APIKey == "":
+		add(SeverityError, "sonarr.apikey", "is empty")
+	}
+	if c.Sonarr.DownloadsFolder == "" {
+		add(SeverityError, "sonarr.downloadsFolder", "is empty")
+	} else if info, err := os.Stat(c.Sonarr.DownloadsFolder); err != nil {
+		add(SeverityError, "sonarr.downloadsFolder", "%v", err)
+	} else if !info.IsDir() {
+		add(SeverityError, "sonarr.downloadsFolder", "%s is not a directory", c.Sonarr.DownloadsFolder)
+	}
+	// The root folder is Sonarr's path, which this host may not mount
+	if c.Sonarr.RootFolder == "" {
+		add(SeverityError, "sonarr.rootFolder", "is empty")
+	} else if _, err := os.Stat(c.Sonarr.RootFolder); err != nil {
+		add(SeverityWarning, "sonarr.rootFolder", "%s is not visible here, which is fine if only Sonarr mounts it", c.Sonarr.RootFolder)
+	}
+	if err := ValidateSeriesType(c.Sonarr.SeriesType); err != nil {
+		add(SeverityError, "sonarr.seriesType", "%v", err)
+	}
+	if err := ValidatePathSeparator(c.Sonarr.PathSeparator); err != nil {
+		add(SeverityError, "sonarr.pathSeparator", "%v", err)
+	}
+	if m := c.Sonarr.MonitorSeasons; m != "" && !slices.Contains(MonitorSeasonsModes, m) {
+		add(SeverityError, "sonarr.monitorSeasons", "unknown mode %q, want one of %s", m, strings.Join(MonitorSeasonsModes, ", "))
+	}
+
+	c.validateInstances(add)
+	c.validateRules(add)
+
+	switch c.Parsing.Order {
+	case "", "path", "mtime", "mtime-desc", "size":
+	default:
+		add(SeverityError, "parsing.order", "unknown order %q, want path, mtime, mtime-desc or size", c.Parsing.Order)
+	}
+	switch c.Parsing.SymlinkFiles {
+	case "", "link", "target":
+	default:
+		add(SeverityError, "parsing.symlinkFiles", "unknown value %q, want link or target", c.Parsing.SymlinkFiles)
+	}
+	if c.Parsing.MaxDepth < 0 {
+		add(SeverityError, "parsing.maxDepth", "must not be negative")
+	}
+	if c.Parsing.MaxFiles < 0 {
+		add(SeverityError, "parsing.maxFiles", "must not be negative")
+	}
+	if c.Parsing.MaxEpisodeSpan < 0 {
+		add(SeverityError, "parsing.maxEpisodeSpan", "must not be negative")
+	}
+
+	if err := ValidatePprofAddr(c.Daemon.PprofAddr); err != nil {
+		add(SeverityError, "daemon.pprofAddr", "%v", err)
+	}
+	if c.Daemon.EnablePprof && c.Daemon.ListenAddr == "" && c.Daemon.PprofAddr == "" {
+		add(SeverityWarning, "daemon.enablePprof", "has no effect without daemon.listenAddr or daemon.pprofAddr")
+	}
+
+	// compile reports an invalid pattern and returns nil for it
+	compile := func(path, pattern string) *regexp.Regexp {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			add(SeverityError, path, "%v", err)
+		}
+		return re
+	}
+	animePatterns := func(prefix string, patterns []parser.AnimePattern) {
+		names := make(map[string]bool)
+		for i, p := range patterns {
+			path := fmt.Sprintf("%s[%d]", prefix, i)
+			checkName(add, path+".name", p.Name, names)
+			if p.Disabled() {
+				add(SeverityWarning, path+".enabled", "is false, so the pattern is disabled")
+			}
+			re := compile(path+".pattern", p.Pattern)
+			if re == nil {
+				continue
+			}
+			groups := re.NumSubexp()
+			for _, g := range []struct {
+				name  string
+				index int
+			}{{"titleGroup", p.TitleGroup}, {"seasonGroup", p.SeasonGroup}, {"episodeGroup", p.EpisodeGroup}} {
+				if g.index < 0 || g.index > groups {
+					add(SeverityError, path+"."+g.name, "group %d does not exist, the pattern has %d group(s)", g.index, groups)
+				}
+			}
+			if p.EpisodeGroup == 0 {
+				add(SeverityWarning, path+".episodeGroup", "is 0, so matches never capture an episode")
+			}
+			if err := ValidateSeriesType(p.SeriesType); err != nil {
+				add(SeverityError, path+".seriesType", "%v", err)
+			}
+			if r := p.Require; r != nil {
+				if r.Episode && p.EpisodeGroup == 0 {
+					add(SeverityError, path+".require.episode", "can never be met, episodeGroup is 0")
+				}
+				if r.Season && p.SeasonGroup == 0 {
+					add(SeverityError, path+".require.season", "can never be met, seasonGroup is 0")
+				}
+				if r.MinTitleLength < 0 || r.MaxTitleLength < 0 {
+					add(SeverityError, path+".require", "title lengths cannot be negative")
+				} else if r.MaxTitleLength > 0 && r.MinTitleLength > r.MaxTitleLength {
+					add(SeverityError, path+".require.minTitleLength", "is above maxTitleLength %d", r.MaxTitleLength)
+				}
+			}
+		}
+	}
+	animePatterns("parsing.animePatterns", c.Parsing.AnimePatterns)
+	switch c.Parsing.PresetMerge {
+	case "", PresetsAfter, PresetsBefore:
+	default:
+		add(SeverityError, "parsing.presetMerge", "unknown value %q, want after or before", c.Parsing.PresetMerge)
+	}
+	for i, source := range c.Parsing.PresetFiles {
+		if strings.TrimSpace(source) == "" {
+			add(SeverityError, fmt.Sprintf("parsing.presetFiles[%d]", i), "is empty; use a built-in preset such as %s, a path or a URL", strings.Join(BuiltinPresets(), ", "))
+		}
+	}
+	for i, preset := range c.Presets {
+		path := fmt.Sprintf("parsing.presetFiles[%d]", i)
+		if len(preset.AnimePatterns) == 0 {
+			add(SeverityWarning, path, "preset %s has no anime patterns", preset.Source)
+		}
+		if preset.Stale {
+			add(SeverityWarning, path, "could not be fetched, so the cached copy of %s is used", preset.Source)
+		}
+		animePatterns(path+".animePatterns", preset.AnimePatterns)
+	}
+	for _, name := range sortedKeys(c.Groups) {
+		g := c.Groups[name]
+		path := c.groupPath(name)
+		if strings.TrimSpace(name) == "" {
+			add(SeverityError, "groups", "has a profile without a group name")
+		}
+		animePatterns(path+".animePatterns", g.AnimePatterns)
+		for _, quality := range sortedKeys(g.Qualities) {
+			if _, ok := sonarr.QualityByName(g.Qualities[quality]); !ok {
+				add(SeverityError, path+".qualities."+quality, "%q is not a Sonarr quality, use a name such as WEBRip-1080p", g.Qualities[quality])
+			}
+		}
+		if _, ok := sonarr.LanguageByName(g.Language); g.Language != "" && !ok {
+			add(SeverityError, path+".language", "%q is not a Sonarr language", g.Language)
+		}
+	}
+	for i, p := range c.Parsing.MoviePatterns {
+		path := fmt.Sprintf("parsing.moviePatterns[%d]", i)
+		re := compile(path+".pattern", p.Pattern)
+		if re == nil {
+			continue
+		}
+		if groups := re.NumSubexp(); p.TitleGroup < 1 || p.TitleGroup > groups {
+			add(SeverityError, path+".titleGroup", "group %d does not exist, the pattern has %d group(s)", p.TitleGroup, groups)
+		} else if p.YearGroup < 0 || p.YearGroup > groups {
+			add(SeverityError, path+".yearGroup", "group %d does not exist, the pattern has %d group(s)", p.YearGroup, groups)
+		}
+	}
+	if c.Radarr.URL != "" {
+		checkURL(add, "radarr.url", c.Radarr.URL)
+		checkHeaders(add, "radarr.headers", c.Radarr.Headers)
+		if c.Radarr.APIKey == "" {
+			add(SeverityError, "radarr.apikey", "is empty")
+		}
+		if c.Radarr.RootFolder == "" {
+			add(SeverityError, "radarr.rootFolder", "is empty")
+		}
+		if len(c.Parsing.MoviePatterns) == 0 {
+			add(SeverityWarning, "parsing.moviePatterns", "is empty, so no file is handed to Radarr")
+		}
+	}
+	if c.QBittorrent.URL != "" {
+		if a := c.QBittorrent.TorrentAction(); a != TorrentSkip && a != TorrentCopy {
+			add(SeverityError, "qbittorrent.action", "must be %q or %q, not %q", TorrentSkip, TorrentCopy, a)
+		}
+	}
+	for name, patterns := range map[string][]string{
+		"seasonPatterns":  c.Parsing.SeasonPatterns,
+		"episodePatterns": c.Parsing.EpisodePatterns,
+		"groupPatterns":   c.Parsing.GroupPatterns,
+	} {
+		for i, p := range patterns {
+			path := fmt.Sprintf("parsing.%s[%d]", name, i)
+			if re := compile(path, p); re != nil && re.NumSubexp() == 0 {
+				add(SeverityError, path, "needs a capture group")
+			}
+		}
+	}
+	transformNames := make(map[string]bool)
+	for i, t := range c.Transforms {
+		path := c.TransformPath(i)
+		checkName(add, path+".name", t.Name, transformNames)
+		if t.Disabled() {
+			add(SeverityWarning, path+".enabled", "is false, so the transform is disabled")
+		}
+		re := compile(path+".search", t.Search)
+		if re == nil {
+			continue
+		}
+		errs, warnings := parser.CheckReplacement(re, t.Replace)
+		for _, msg := range errs {
+			add(SeverityError, path+".replace", "%s", msg)
+		}
+		for _, msg := range warnings {
+			add(SeverityWarning, path+".replace", "%s", msg)
+		}
+	}
+
+	if _, err := c.Sonarr.FreeSpaceMarginBytes(); err != nil {
+		add(SeverityError, "sonarr.freeSpaceMargin", "%v", err)
+	}
+	for _, d := range []struct {
+		path, value string
+	}{
+		{"sonarr.lookupCache", c.Sonarr.LookupCache},
+		{"parsing.fileTimeout", c.Parsing.FileTimeout},
+		{"daemon.interval", c.Daemon.Interval},
+		{"daemon.drainTimeout", c.Daemon.DrainTimeout},
+		{"daemon.watchDebounce", c.Daemon.WatchDebounce},
+		{"daemon.rescanInterval", c.Daemon.RescanInterval},
+		{"daemon.maxFileAge", c.Daemon.MaxFileAge},
+		{"daemon.historyRetention", c.Daemon.HistoryRetention},
+		{"daemon.latencyWarning", c.Daemon.LatencyWarning},
+		{"daemon.logRepeatWindow", c.Daemon.LogRepeatWindow},
+		{"retry.delay", c.Retry.Delay},
+		{"retry.maxDelay", c.Retry.MaxDelay},
+		{"retry.metadataDelay", c.Retry.MetadataDelay},
+		{"dedupe.window", c.Dedupe.Window},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			add(SeverityError, d.path, "%v", err)
+		}
+	}
+	if _, err := c.IO.MaxReadRateBytes(); err != nil {
+		add(SeverityError, "io.maxReadRate", "%v", err)
+	}
+	if _, err := c.IO.MaxHashSizeBytes(); err != nil {
+		add(SeverityError, "io.maxHashSize", "%v", err)
+	}
+	if c.IO.MaxReaders < 0 {
+		add(SeverityError, "io.maxReaders", "must not be negative")
+	}
+	if _, err := ParseWindow(c.Daemon.ActiveHours, c.Daemon.Timezone); err != nil {
+		add(SeverityError, "daemon.activeHours", "%v", err)
+	} else if c.Daemon.Timezone != "" && c.Daemon.ActiveHours == "" {
+		add(SeverityWarning, "daemon.timezone", "has no effect without daemon.activeHours")
+	}
+	switch strings.ToUpper(c.Daemon.PingMethod) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		add(SeverityError, "daemon.pingMethod", "must be GET or POST, not %q", c.Daemon.PingMethod)
+	}
+	switch c.Daemon.Mode {
+	case "", ScanPoll, ScanWatch, ScanSnapshot:
+		if c.Daemon.Watch && c.Daemon.ScanMode() != ScanWatch {
+			add(SeverityWarning, "daemon.watch", "is ignored with daemon.mode %q", c.Daemon.Mode)
+		}
+	default:
+		add(SeverityError, "daemon.mode", "must be %q, %q or %q, not %q", ScanPoll, ScanWatch, ScanSnapshot, c.Daemon.Mode)
+	}
+	if interval, err := c.Daemon.IntervalDuration(); err == nil && interval != 0 && interval < MinInterval {
+		add(SeverityWarning, "daemon.interval", "%v is below the minimum, %v is used instead", interval, MinInterval)
+	}
+
+	if c.Retry.MaxAttempts < 0 {
+		add(SeverityError, "retry.maxAttempts", "is negative")
+	}
+	if c.Ignore.AutoAfter < 0 {
+		add(SeverityError, "ignore.autoAfter", "is negative")
+	}
+
+	for i, t := range c.Notifications.Telegram {
+		path := fmt.Sprintf("notifications.telegram[%d]", i)
+		if t.BotToken == "" {
+			add(SeverityError, path+".botToken", "is required")
+		}
+		if t.ChatID == "" {
+			add(SeverityError, path+".chatId", "is required")
+		}
+		if _, err := ParseWindow(t.SilentHours, t.Timezone); err != nil {
+			add(SeverityError, path+".silentHours", "%v", err)
+		}
+	}
+	for i, e := range c.Notifications.Email {
+		if e.Template == "" {
+			continue
+		}
+		if _, err := os.Stat(e.Template); err != nil {
+			add(SeverityError, fmt.Sprintf("notifications.email[%d].template", i), "%v", err)
+		}
+	}
+
+	if c.LogLevel != "" {
+		if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+			add(SeverityError, "logLevel", "%v", err)
+		}
+	}
+	return issues
+}
+
+// ValidatePprofAddr checks that addr is empty or a loopback address, as the
+// profiling endpoints must not be reachable from other machines.
+func ValidatePprofAddr(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); err != nil || host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%q is not a loopback address such as 127.0.0.1:6060", addr)
+	}
+	return nil
+}
+
+// SeriesTypes are the series types Sonarr accepts.
+var SeriesTypes = []string{"standard", "daily", "anime"}
+
+// ValidateSeriesType checks that t is empty or one of SeriesTypes.
+func ValidateSeriesType(t string) error {
+	if t == "" {
+		return nil
+	}
+	for _, valid := range SeriesTypes {
+		if t == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown series type %q, want one of %s", t, strings.Join(SeriesTypes, ", "))
+}
+
+// sortedKeys returns the keys of m in order, so issues are reported in a
+// stable order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkName checks that name, the name of a transform or pattern at path,
+// is not used twice in names, the names of its list so far.
+func checkName(add func(Severity, string, string, ...any), path, name string, names map[string]bool) {
+	if name == "" {
+		return
+	}
+	if names[name] {
+		add(SeverityError, path, "%q is used twice", name)
+	}
+	names[name] = true
+}
+
+// checkURL checks that raw, the URL at path, is an absolute HTTP or HTTPS URL.
+func checkURL(add func(Severity, string, string, ...any), path, raw string) {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		add(SeverityError, path, "%v", err)
+	case u.Scheme != "http" && u.Scheme != "https":
+		add(SeverityError, path, "%q must start with http:// or https://", raw)
+	case u.Host == "":
+		add(SeverityError, path, "%q has no host", raw)
+	}
+}
+
+// checkHeaders adds an issue for every header of headers that cannot be
+// sent, and for one that would replace the API key.
+func checkHeaders(add func(Severity, string, string, ...any), path string, headers map[string]string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := headers[name]
+		invalid := strings.IndexFunc(name, func(r rune) bool {
+			return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+		})
+		switch {
+		case name == "" || invalid >= 0:
+			add(SeverityError, path, "%q is not a valid header name", name)
+		case strings.EqualFold(name, "X-Api-Key"):
+			add(SeverityError, path+"."+name, "is set from the API key")
+		case strings.ContainsAny(value, "\r\n"):
+			add(SeverityError, path+"."+name, "must not contain line breaks")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+const (
+	// minBackoff is the delay before the first retry once Sonarr is
+	// unreachable. It doubles with every failed attempt up to maxBackoff.
+	minBackoff = 30 * time.Second
+	maxBackoff = 30 * time.Minute
+)
+
+// BackoffStatus describes the scans skipped because Sonarr is unreachable.
+type BackoffStatus struct {
+	Failures  int       `json:"failures"`
+	LastError string    `json:"lastError"`
+	RetryAt   time.Time `json:"retryAt"`
+}
+
+// backoffDelay returns the wait after the given number of consecutive
+// failures.
+func backoffDelay(failures int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// backingOff reports whether scans are suspended, logging the skipped scan.
+func (d *Daemon) backingOff(kind string) bool {
+	d.mu.Lock()
+	b := d.backoff
+	d.mu.Unlock()
+
+	if b == nil {
+		return false
+	}
+	wait := time.Until(b.RetryAt)
+	if wait <= 0 {
+		return false
+	}
+	d.log.Warnf("Sonarr unreachable, skipping %s scan (next attempt in %v)", strings.ToLower(kind), wait.Round(time.Second))
+	return true
+}
+
+// checkSonarr verifies that Sonarr answers before a scan. When it does not,
+// the next attempt is scheduled with an exponential delay and false is
+// returned. Errors other than Sonarr being unreachable, such as a wrong API
+// key, let the scan go ahead so they are reported per file.
+func (d *Daemon) checkSonarr(ctx context.Context, kind string) bool {
+	checkCtx, cancel := context.WithTimeout(ctx, healthTimeout)
+	_, err := d.importer().Client.SystemStatus(checkCtx)
+	cancel()
+
+	var redirect *sonarr.RedirectError
+	if errors.As(err, &redirect) {
+		d.log.Warnf("Check the Sonarr URL: %v", err)
+	}
+
+	d.mu.Lock()
+	if !sonarr.IsUnreachable(err) {
+		if d.backoff != nil {
+			d.log.Infof("Sonarr is reachable again after %d failed attempt(s)", d.backoff.Failures)
+			d.backoff = nil
+		}
+		d.mu.Unlock()
+		return true
+	}
+
+	failures := 1
+	if d.backoff != nil {
+		failures = d.backoff.Failures + 1
+	}
+	delay := backoffDelay(failures)
+	d.backoff = &BackoffStatus{
+		Failures:  failures,
+		LastError: err.Error(),
+		RetryAt:   time.Now().Add(delay),
+	}
+	d.log.Warnf("Sonarr unreachable (%v), skipping %s scan (next attempt in %v)", err, strings.ToLower(kind), delay)
+
+	// The retry is a full scan so files skipped in the meantime are picked up
+	if d.retry != nil {
+		d.retry.Stop()
+	}
+	d.retry = time.AfterFunc(delay, func() { d.Trigger(nil) })
+	d.mu.Unlock()
+
+	// ping takes d.mu itself
+	d.ping(true, "Sonarr unreachable: "+err.Error())
+	return false
+}
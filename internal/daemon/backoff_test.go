@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+	"sonarr-autoimport/internal/state"
+)
+
+func TestCycleWithUnreachableSonarrReturns(t *testing.T) {
+	srv := sonarrtest.New()
+	client := srv.Client()
+	srv.Close()
+	cfg := config.Default()
+	cfg.Sonarr.URL = srv.URL
+	cfg.Sonarr.APIKey = sonarrtest.APIKey
+	cfg.Sonarr.DownloadsFolder = t.TempDir()
+	imp := importer.New(&cfg, client, logging.New(io.Discard, logging.LevelDebug), importer.Options{})
+	heartbeat := filepath.Join(t.TempDir(), "heartbeat.json")
+	d := New(imp, Options{HeartbeatFile: heartbeat})
+
+	d.startFullScan(context.Background(), "", "Scheduled")
+	select {
+	case interrupted := <-d.done:
+		if interrupted {
+			t.Error("the cycle reported an interrupted scan")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the cycle did not return with Sonarr unreachable")
+	}
+	d.stopRetry()
+
+	status := d.Status()
+	if status.Backoff == nil || status.Backoff.Failures != 1 {
+		t.Errorf("Backoff = %+v, want the first failure", status.Backoff)
+	}
+	if status.CurrentScan != nil {
+		t.Errorf("CurrentScan = %+v after the cycle", status.CurrentScan)
+	}
+	hb, err := state.ReadHeartbeat(heartbeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hb.Failed {
+		t.Errorf("heartbeat = %+v, want a failed cycle", hb)
+	}
+}
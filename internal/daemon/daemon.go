@@ -0,0 +1,400 @@
+// Package daemon runs the importer continuously, either on a fixed interval
+// or driven by filesystem notifications or snapshots of the downloads folder.
+package daemon
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/metrics"
+	"sonarr-autoimport/internal/watcher"
+)
+
+// Options configure how often the daemon scans.
+type Options struct {
+	// Interval is the period between full scans when polling, and between
+	// the checks of the downloads folder in snapshot mode.
+	Interval time.Duration
+	// Mode is config.ScanPoll, config.ScanWatch, which processes new files as
+	// they appear, or config.ScanSnapshot, which processes those a check
+	// finds.
+	Mode string
+	// WatchDebounce is the quiet period before new files are processed.
+	WatchDebounce time.Duration
+	// RescanInterval is the period of the safety-net full scan in watch and
+	// snapshot mode.
+	RescanInterval time.Duration
+	// SnapshotFile keeps the index of snapshot mode across restarts when not
+	// empty.
+	SnapshotFile string
+	// ListenAddr enables the /healthz, /status, /scan and /metrics endpoints
+	// when not empty.
+	ListenAddr string
+	// PingURL is notified at the end of every scan cycle when not empty,
+	// with PingMethod, GET when it is empty.
+	PingURL    string
+	PingMethod string
+	// Reload builds a new importer from the config file. The daemon calls it
+	// between scans on SIGHUP and, with daemon.reloadOnChange, when ConfigPath
+	// was modified. Reloading is unavailable when it is nil.
+	Reload func() (*importer.Importer, error)
+	// ConfigPath is the file checked for modifications.
+	ConfigPath string
+	// PauseFile pauses scanning while it exists, when not empty.
+	PauseFile string
+	// Pprof serves net/http/pprof and /debug/vars, on PprofAddr when it is
+	// not empty and on ListenAddr otherwise.
+	Pprof     bool
+	PprofAddr string
+	// HeartbeatFile records the end of every scan cycle when not empty.
+	HeartbeatFile string
+	// ActiveHours, when not nil, defers scans outside the window until it
+	// opens.
+	ActiveHours *config.Window
+	// LatencyWarning, when positive, logs a warning after scans that
+	// imported files that waited longer in the downloads folder.
+	LatencyWarning time.Duration
+	// LogRepeatWindow, when positive, summarizes the repeated failures of a
+	// file within the window instead of logging each in full.
+	LogRepeatWindow time.Duration
+	// Metrics, when not nil, writes metrics of its own on /metrics after
+	// those of the daemon.
+	Metrics func(w *metrics.Writer)
+}
+
+// Daemon schedules scans of an Importer. Only one scan runs at a time.
+type Daemon struct {
+	opts Options
+	log  *logging.Logger
+
+	// scanning is set while a scan goroutine is running. Only the Run loop
+	// sets and clears it.
+	scanning atomic.Bool
+	// done receives whether each finished scan was interrupted.
+	done chan bool
+	// wake tells the Run loop that a scan or reload was requested.
+	wake chan struct{}
+	// reloadRequested is set by SIGHUP until the Run loop reloads.
+	reloadRequested atomic.Bool
+	// configModTime is the modification time of ConfigPath when it was last
+	// loaded. Only the Run loop uses it.
+	configModTime time.Time
+	// pauseLogged is set once a skipped scan was logged for the current
+	// pause. Only the Run loop uses it.
+	pauseLogged bool
+
+	// mu guards the fields below, which the status server reads.
+	mu sync.Mutex
+	// imp is replaced when the configuration is reloaded.
+	imp *importer.Importer
+	// queued collects watch batches that arrived while a scan was running.
+	queued []string
+	// triggered is the on-demand scan waiting to start, if any.
+	triggered *pendingScan
+	// current describes the running scan, if any.
+	current *ScanInfo
+	// lastScan describes the most recent finished scan.
+	lastScan *ScanSummary
+	// lastID numbers the scans.
+	lastID uint64
+	// backoff is set while Sonarr is unreachable.
+	backoff *BackoffStatus
+	// retry starts a full scan once the backoff delay has passed.
+	retry *time.Timer
+	// pause is set while the daemon is paused by Pause.
+	pause *PauseStatus
+	// timing sums up the durations of the finished scans.
+	timing scanTiming
+	// bytesRead sums up the bytes the finished scans read from their files.
+	bytesRead int64
+	// sonarrAPI sums up what the finished scans asked of Sonarr.
+	sonarrAPI importer.APIUsage
+	// latency is the latency of the last scan that imported files.
+	latency *importer.LatencyStats
+	// windowWait is set while scans wait for the active hours to open, with
+	// the timer that triggers a full scan then.
+	windowWait *time.Timer
+	// started is when the daemon was created.
+	started time.Time
+	// period is the time between scheduled scans and lastCycle the end of
+	// the latest scan cycle, for detecting a scan loop that stopped.
+	period    time.Duration
+	lastCycle time.Time
+}
+
+// pendingScan is an on-demand scan waiting for the running one to finish.
+// Triggers that arrive in the meantime are merged into it.
+type pendingScan struct {
+	id    string
+	full  bool
+	paths []string
+}
+
+// New returns a Daemon running imp with opts.
+func New(imp *importer.Importer, opts Options) *Daemon {
+	d := &Daemon{
+		imp:     imp,
+		opts:    opts,
+		log:     imp.Logger,
+		done:    make(chan bool),
+		wake:    make(chan struct{}, 1),
+		started: time.Now(),
+	}
+	d.configModTime = d.configFileModTime()
+	if d.log != nil {
+		d.log.SetRepeatWindow(opts.LogRepeatWindow)
+	}
+	return d
+}
+
+// importer returns the importer of the current configuration.
+func (d *Daemon) importer() *importer.Importer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.imp
+}
+
+// Run scans until ctx is cancelled. It reports whether the last scan was cut
+// short by the cancellation.
+func (d *Daemon) Run(ctx context.Context) (interrupted bool) {
+	if d.opts.ListenAddr != "" {
+		shutdown, err := d.serve("Status server", d.opts.ListenAddr, d.handler())
+		if err != nil {
+			d.log.Errorf("Failed to start status server: %v", err)
+		} else {
+			defer shutdown()
+		}
+	}
+	if d.opts.Pprof {
+		if stop := d.servePprof(); stop != nil {
+			defer stop()
+		}
+	}
+
+	var batches chan []string
+	period := d.opts.Interval
+
+	root := d.importer().Config.Sonarr.DownloadsFolder
+	switch d.opts.Mode {
+	case config.ScanWatch:
+		w, err := watcher.New(root, d.opts.WatchDebounce, importer.IsVideoFile, d.log)
+		if err != nil {
+			d.log.Warnf("Watch mode unavailable (%v), falling back to polling", err)
+		} else {
+			defer w.Close()
+			batches = make(chan []string)
+			period = d.opts.RescanInterval
+			go w.Run(ctx, batches)
+			d.log.Infof("Running in daemon mode, watching %s with a full scan every %v", root, period)
+		}
+	case config.ScanSnapshot:
+		s, err := watcher.NewSnapshot(root, d.opts.Interval, importer.IsVideoFile, d.opts.SnapshotFile, d.log)
+		if err != nil {
+			d.log.Warnf("Snapshot mode unavailable (%v), falling back to polling", err)
+		} else {
+			batches = make(chan []string)
+			period = d.opts.RescanInterval
+			go s.Run(ctx, batches)
+			d.log.Infof("Running in daemon mode, checking %s for new files every %v with a full scan every %v", root, d.opts.Interval, period)
+		}
+	}
+	if batches == nil {
+		d.log.Infof("Running in daemon mode, scanning every %v", period)
+	}
+	d.mu.Lock()
+	d.period = period
+	d.mu.Unlock()
+
+	stopSignal := d.notifyTrigger(ctx)
+	defer stopSignal()
+	stopReload := d.notifyReload(ctx)
+	defer stopReload()
+	stopPause := d.notifyPause(ctx)
+	defer stopPause()
+	defer d.stopRetry()
+	defer d.stopWindowWait()
+
+	// Initial scan
+	d.startFullScan(ctx, "", "Initial")
+
+	// Periodic scanning
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.log.Infof("Shutting down")
+			if d.scanning.Load() {
+				return <-d.done
+			}
+			return false
+
+		case interrupted := <-d.done:
+			d.scanning.Store(false)
+			if interrupted {
+				return true
+			}
+			d.reloadIfNeeded()
+			d.startQueued(ctx)
+
+		case <-d.wake:
+			if !d.scanning.Load() {
+				d.reloadIfNeeded()
+				d.startQueued(ctx)
+			}
+
+		case <-ticker.C:
+			if d.scanning.Load() {
+				d.log.Warnf("Skipping scheduled scan, the previous scan is still running")
+				continue
+			}
+			d.reloadIfNeeded()
+			d.startFullScan(ctx, "", "Scheduled")
+
+		case paths := <-batches:
+			d.log.Infof("Detected %d new file(s)", len(paths))
+			if d.scanning.Load() {
+				d.log.Debugf("A scan is running, new files will be processed after it")
+				d.mu.Lock()
+				d.queued = append(d.queued, paths...)
+				d.mu.Unlock()
+				continue
+			}
+			d.reloadIfNeeded()
+			d.startPathScan(ctx, "", "Watch", paths)
+		}
+	}
+}
+
+// Trigger requests a scan of paths, or of the whole downloads folder when
+// paths is empty, and returns the ID of the scan that will handle it. The scan
+// starts as soon as no other scan is running; triggers arriving before that
+// are merged into the same scan and share its ID.
+func (d *Daemon) Trigger(paths []string) string {
+	d.mu.Lock()
+	switch {
+	case d.triggered == nil:
+		d.triggered = &pendingScan{id: d.newID(), full: len(paths) == 0, paths: paths}
+	case len(paths) == 0:
+		d.triggered.full = true
+		d.triggered.paths = nil
+	case !d.triggered.full:
+		d.triggered.paths = append(d.triggered.paths, paths...)
+	}
+	id := d.triggered.id
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return id
+}
+
+// newID returns the next scan ID. d.mu must be held.
+func (d *Daemon) newID() string {
+	d.lastID++
+	return strconv.FormatUint(d.lastID, 10)
+}
+
+// startQueued starts the triggered scan together with the watch batches that
+// arrived during the previous scan. A triggered full scan covers the batches.
+func (d *Daemon) startQueued(ctx context.Context) {
+	d.mu.Lock()
+	triggered, paths := d.triggered, d.queued
+	d.triggered, d.queued = nil, nil
+	d.mu.Unlock()
+
+	switch {
+	case triggered != nil && triggered.full:
+		d.startFullScan(ctx, triggered.id, "Triggered")
+	case triggered != nil:
+		d.startPathScan(ctx, triggered.id, "Triggered", append(paths, triggered.paths...))
+	case len(paths) > 0:
+		d.startPathScan(ctx, "", "Watch", paths)
+	}
+}
+
+// startFullScan scans the whole downloads folder in the background.
+func (d *Daemon) startFullScan(ctx context.Context, id, kind string) {
+	d.start(ctx, id, kind, nil, d.importer().ProcessAnimeFiles)
+}
+
+// startPathScan processes paths in the background.
+func (d *Daemon) startPathScan(ctx context.Context, id, kind string, paths []string) {
+	imp := d.importer()
+	d.start(ctx, id, kind, paths, func(ctx context.Context) (*importer.ScanResult, error) {
+		return imp.ProcessPaths(ctx, paths)
+	})
+}
+
+// start runs scan, which processes paths or the whole downloads folder when
+// paths is empty, in a goroutine and reports its end on d.done. An empty id
+// is replaced by a new one. Nothing is started while the daemon is paused,
+// outside its active hours or while Sonarr is unreachable.
+// Callers must make sure no scan is running.
+func (d *Daemon) start(ctx context.Context, id, kind string, paths []string, scan func(context.Context) (*importer.ScanResult, error)) {
+	if d.skipPaused(kind) || d.skipInactive(kind, paths) || d.backingOff(kind) {
+		return
+	}
+	if kind != "Watch" {
+		d.log.Infof("Starting %s scan...", strings.ToLower(kind))
+	}
+
+	d.scanning.Store(true)
+	d.mu.Lock()
+	if id == "" {
+		id = d.newID()
+	}
+	info := &ScanInfo{ID: id, Kind: kind, StartedAt: time.Now()}
+	d.current = info
+	d.mu.Unlock()
+
+	go func() {
+		if !d.checkSonarr(ctx, kind) {
+			d.mu.Lock()
+			d.current = nil
+			d.mu.Unlock()
+			d.done <- false
+			return
+		}
+
+		result, err := scan(ctx)
+		if err != nil {
+			d.log.Errorf("%s scan failed: %v", kind, err)
+		}
+		summary := newScanSummary(info, result, err)
+		d.mu.Lock()
+		d.current = nil
+		d.lastScan = summary
+		d.timing.add(summary.FinishedAt.Sub(summary.StartedAt))
+		d.bytesRead += summary.BytesRead
+		if summary.SonarrAPI != nil {
+			d.sonarrAPI.Add(*summary.SonarrAPI)
+		}
+		if summary.Latency != nil {
+			d.latency = summary.Latency
+		}
+		d.mu.Unlock()
+		d.checkLatency(result)
+		d.ping(CycleFailed(result, err), PingSummary(result, err))
+		d.done <- result != nil && result.Interrupted
+	}()
+}
+
+// stopRetry cancels a pending backoff retry.
+func (d *Daemon) stopRetry() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.retry != nil {
+		d.retry.Stop()
+	}
+}
@@ -0,0 +1,159 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"sonarr-autoimport/internal/version"
+)
+
+// DebugVars is the JSON document served on /debug/vars when profiling is
+// enabled.
+type DebugVars struct {
+	Version    string         `json:"version"`
+	Uptime     string         `json:"uptime"`
+	Goroutines int            `json:"goroutines"`
+	Memory     MemoryStats    `json:"memory"`
+	Sizes      CacheSizes     `json:"sizes"`
+	Scans      ScanTimings    `json:"scans"`
+	Current    *ScanInfo      `json:"currentScan,omitempty"`
+	Backoff    *BackoffStatus `json:"backoff,omitempty"`
+}
+
+// MemoryStats are the heap and garbage collector figures of runtime.MemStats.
+type MemoryStats struct {
+	HeapAlloc   uint64 `json:"heapAlloc"`
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	Sys         uint64 `json:"sys"`
+	NumGC       uint32 `json:"numGC"`
+	// PauseTotal is the total time the garbage collector stopped the world.
+	PauseTotal string `json:"pauseTotal"`
+}
+
+// CacheSizes counts the entries the daemon keeps in memory or rereads on
+// every scan, which grow without bound when something is wrong.
+type CacheSizes struct {
+	RetryQueue   int `json:"retryQueue"`
+	PendingFiles int `json:"pendingFiles"`
+	QueuedPaths  int `json:"queuedPaths"`
+	Ignored      int `json:"ignored"`
+	Aliases      int `json:"aliases"`
+	LookupMisses int `json:"lookupMisses"`
+}
+
+// ScanTimings sums up the duration of the scans since the daemon started.
+type ScanTimings struct {
+	Count   int    `json:"count"`
+	Last    string `json:"last,omitempty"`
+	Average string `json:"average,omitempty"`
+	Max     string `json:"max,omitempty"`
+	// SinceLast is the time since the last scan finished.
+	SinceLast string `json:"sinceLast,omitempty"`
+}
+
+// scanTiming accumulates the durations of finished scans.
+type scanTiming struct {
+	count      int
+	total, max time.Duration
+	last       time.Duration
+	finishedAt time.Time
+}
+
+// add records a scan that took d.
+func (t *scanTiming) add(d time.Duration) {
+	t.count++
+	t.total += d
+	t.last = d
+	t.max = max(t.max, d)
+	t.finishedAt = time.Now()
+}
+
+// debugHandler serves the profiles of net/http/pprof below /debug/pprof/ and
+// the runtime figures on /debug/vars.
+func (d *Daemon) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.DebugVars())
+	})
+	return mux
+}
+
+// servePprof starts the profiling endpoints, on their own listener when
+// PprofAddr is set, and logs where they are. It returns the function that
+// shuts their listener down, if any.
+func (d *Daemon) servePprof() (shutdown func()) {
+	if d.opts.PprofAddr == "" {
+		if d.opts.ListenAddr == "" {
+			return nil
+		}
+		d.log.Warnf("Profiling enabled: /debug/pprof/ and /debug/vars expose the internals of the process on %s", d.opts.ListenAddr)
+		return nil
+	}
+	shutdown, err := d.serve("Profiling server", d.opts.PprofAddr, d.debugHandler())
+	if err != nil {
+		d.log.Errorf("Failed to start profiling server: %v", err)
+		return nil
+	}
+	d.log.Warnf("Profiling enabled: /debug/pprof/ and /debug/vars expose the internals of the process on %s", d.opts.PprofAddr)
+	return shutdown
+}
+
+// DebugVars returns a snapshot of the runtime figures of the daemon.
+func (d *Daemon) DebugVars() DebugVars {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	imp := d.importer()
+	var sizes CacheSizes
+	if imp.Retry != nil {
+		sizes.RetryQueue = imp.Retry.Len()
+	}
+	if l, ok := imp.Ignore.(interface{ Len() int }); ok {
+		sizes.Ignored = l.Len()
+	}
+	if l, ok := imp.Aliases.(interface{ Len() int }); ok {
+		sizes.Aliases = l.Len()
+	}
+	if l, ok := imp.LookupMisses.(interface{ Len() int }); ok {
+		sizes.LookupMisses = l.Len()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sizes.PendingFiles = len(d.queued)
+	if d.triggered != nil {
+		sizes.QueuedPaths = len(d.triggered.paths)
+	}
+	vars := DebugVars{
+		Version:    version.String(),
+		Uptime:     time.Since(d.started).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			Sys:         mem.Sys,
+			NumGC:       mem.NumGC,
+			PauseTotal:  time.Duration(mem.PauseTotalNs).String(),
+		},
+		Sizes:   sizes,
+		Scans:   ScanTimings{Count: d.timing.count},
+		Current: d.current,
+		Backoff: d.backoff,
+	}
+	if t := d.timing; t.count > 0 {
+		vars.Scans.Last = t.last.Round(time.Millisecond).String()
+		vars.Scans.Average = (t.total / time.Duration(t.count)).Round(time.Millisecond).String()
+		vars.Scans.Max = t.max.Round(time.Millisecond).String()
+		vars.Scans.SinceLast = time.Since(t.finishedAt).Round(time.Second).String()
+	}
+	return vars
+}
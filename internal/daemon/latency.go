@@ -0,0 +1,29 @@
+package daemon
+
+import (
+	"path/filepath"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+)
+
+// checkLatency warns when files of result waited longer than
+// Options.LatencyWarning between their download and their import, which
+// usually means the interval is too long or their series failed to match in
+// earlier scans.
+func (d *Daemon) checkLatency(result *importer.ScanResult) {
+	if d.opts.LatencyWarning <= 0 || result == nil || result.Latency == nil || result.Latency.Max <= d.opts.LatencyWarning {
+		return
+	}
+	slow, slowest := 0, importer.FileResult{}
+	for _, f := range result.Files {
+		if f.Latency > d.opts.LatencyWarning {
+			slow++
+		}
+		if f.Latency > slowest.Latency {
+			slowest = f
+		}
+	}
+	d.log.Warnf("%d file(s) waited longer than %v from download to import, %s the longest with %v; check daemon.interval and the history of the files for failed series matches",
+		slow, d.opts.LatencyWarning, filepath.Base(slowest.Path), slowest.Latency.Round(time.Second))
+}
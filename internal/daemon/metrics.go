@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/metrics"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// handleMetrics serves the metrics of the daemon, followed by those of
+// Options.Metrics, in the Prometheus text format.
+func (d *Daemon) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+	d.writeMetrics(mw)
+	if d.opts.Metrics != nil {
+		d.opts.Metrics(mw)
+	}
+	if err := mw.Flush(); err != nil {
+		d.log.Debugf("Failed to write metrics: %v", err)
+	}
+}
+
+// writeMetrics writes the scan counters and the state of the daemon.
+func (d *Daemon) writeMetrics(w *metrics.Writer) {
+	retryQueue := 0
+	if retry := d.importer().Retry; retry != nil {
+		retryQueue = retry.Len()
+	}
+	paused := d.Paused() != nil
+
+	d.mu.Lock()
+	timing, last, latency, bytesRead := d.timing, d.lastScan, d.latency, d.bytesRead
+	var usage importer.APIUsage
+	usage.Add(d.sonarrAPI)
+	d.mu.Unlock()
+
+	w.Metric("sonarr_autoimport_scans_total", "Scans finished since the daemon started.", metrics.Counter, float64(timing.count))
+	w.Metric("sonarr_autoimport_scanning", "Whether a scan is running.", metrics.Gauge, metrics.Bool(d.scanning.Load()))
+	w.Metric("sonarr_autoimport_paused", "Whether scanning is paused.", metrics.Gauge, metrics.Bool(paused))
+	w.Metric("sonarr_autoimport_retry_queue", "Files waiting for a retry.", metrics.Gauge, float64(retryQueue))
+	w.Metric("sonarr_autoimport_read_bytes_total", "Bytes the finished scans read from their files.", metrics.Counter, float64(bytesRead))
+	if last != nil {
+		w.Metric("sonarr_autoimport_last_scan_duration_seconds", "Duration of the last finished scan.", metrics.Gauge, timing.last.Seconds())
+		w.Metric("sonarr_autoimport_last_scan_timestamp_seconds", "Time the last scan finished, in seconds since the epoch.", metrics.Gauge,
+			float64(last.FinishedAt.UnixNano())/1e9)
+		w.Metric("sonarr_autoimport_last_scan_read_bytes", "Bytes the last finished scan read from its files.", metrics.Gauge, float64(last.BytesRead))
+	}
+	writeAPIUsage(w, usage)
+	if latency != nil {
+		const name = "sonarr_autoimport_import_latency_seconds"
+		w.Family(name, "Time the files of the last scan that imported any sat in the downloads folder, by quantile.", metrics.Gauge)
+		for _, q := range []struct {
+			quantile string
+			value    time.Duration
+		}{{"0.5", latency.P50}, {"0.9", latency.P90}, {"0.99", latency.P99}, {"1", latency.Max}} {
+			w.Sample(name, metrics.Labels{"quantile": q.quantile}, q.value.Seconds())
+		}
+	}
+}
+
+// writeAPIUsage writes what the finished scans asked of Sonarr, by endpoint.
+func writeAPIUsage(w *metrics.Writer, usage importer.APIUsage) {
+	endpoints := make([]string, 0, len(usage.Endpoints))
+	for endpoint := range usage.Endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, f := range []struct {
+		name, help string
+		value      func(sonarr.Counts) float64
+	}{
+		{"sonarr_autoimport_sonarr_requests_total", "Requests the finished scans sent to Sonarr, by endpoint.",
+			func(c sonarr.Counts) float64 { return float64(c.Requests) }},
+		{"sonarr_autoimport_sonarr_request_errors_total", "Requests of the finished scans that failed or got an error status, by endpoint.",
+			func(c sonarr.Counts) float64 { return float64(c.Errors) }},
+		{"sonarr_autoimport_sonarr_sent_bytes_total", "Bytes the finished scans sent to Sonarr, by endpoint.",
+			func(c sonarr.Counts) float64 { return float64(c.BytesSent) }},
+		{"sonarr_autoimport_sonarr_received_bytes_total", "Bytes the finished scans received from Sonarr, by endpoint.",
+			func(c sonarr.Counts) float64 { return float64(c.BytesReceived) }},
+		{"sonarr_autoimport_sonarr_request_seconds_total", "Time the requests of the finished scans to Sonarr took, by endpoint.",
+			func(c sonarr.Counts) float64 { return c.Latency.Seconds() }},
+	} {
+		w.Family(f.name, f.help, metrics.Counter)
+		for _, endpoint := range endpoints {
+			w.Sample(f.name, metrics.Labels{"endpoint": endpoint}, f.value(usage.Endpoints[endpoint]))
+		}
+	}
+	w.Metric("sonarr_autoimport_lookup_cache_hits_total", "Title lookups of the finished scans that sonarr.lookupCache answered.", metrics.Counter, float64(usage.LookupCacheHits))
+}
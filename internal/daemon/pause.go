@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// PauseStatus describes why the daemon is paused.
+type PauseStatus struct {
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	// File is set when the pause file holds the pause, which only removing
+	// it ends.
+	File string `json:"file,omitempty"`
+}
+
+// Pause stops the daemon from starting scans until Resume. The running scan,
+// if any, finishes. Pausing a paused daemon keeps the original pause.
+func (d *Daemon) Pause(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pause != nil {
+		return
+	}
+	if reason == "" {
+		reason = "requested"
+	}
+	d.pause = &PauseStatus{Reason: reason, Since: time.Now()}
+	d.log.Infof("Pausing scans: %s", reason)
+}
+
+// Resume ends a pause started by Pause and triggers a full scan to catch up
+// with the files that arrived meanwhile. It reports whether the daemon was
+// paused; a pause held by the pause file continues until the file is removed.
+func (d *Daemon) Resume() bool {
+	d.mu.Lock()
+	paused := d.pause != nil
+	d.pause = nil
+	d.mu.Unlock()
+	if !paused {
+		return false
+	}
+	if p := d.filePause(); p != nil {
+		d.log.Infof("Resumed, but scans stay paused while %s", p.Reason)
+		return true
+	}
+	d.log.Infof("Resuming scans")
+	d.Trigger(nil)
+	return true
+}
+
+// Paused returns the current pause, or nil when the daemon is not paused.
+func (d *Daemon) Paused() *PauseStatus {
+	d.mu.Lock()
+	pause := d.pause
+	d.mu.Unlock()
+	if pause != nil {
+		p := *pause
+		return &p
+	}
+	return d.filePause()
+}
+
+// filePause returns the pause held by the pause file, if it exists.
+func (d *Daemon) filePause() *PauseStatus {
+	if d.opts.PauseFile == "" {
+		return nil
+	}
+	info, err := os.Stat(d.opts.PauseFile)
+	if err != nil {
+		return nil
+	}
+	return &PauseStatus{Reason: "pause file " + d.opts.PauseFile + " exists", Since: info.ModTime(), File: d.opts.PauseFile}
+}
+
+// skipPaused reports whether scans are paused. Only the first skipped scan of
+// a pause is logged. Skipped scheduled scans still ping, flagged as paused,
+// so monitoring does not take the pause for a hung daemon.
+func (d *Daemon) skipPaused(kind string) bool {
+	pause := d.Paused()
+	if pause == nil {
+		if d.pauseLogged {
+			d.pauseLogged = false
+			d.log.Infof("No longer paused")
+		}
+		return false
+	}
+	if !d.pauseLogged {
+		d.pauseLogged = true
+		d.log.Infof("Paused (%s), skipping scans until resumed", pause.Reason)
+	}
+	if kind == "Initial" || kind == "Scheduled" {
+		d.ping(false, fmt.Sprintf("paused (%s)", pause.Reason))
+	}
+	return true
+}
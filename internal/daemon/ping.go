@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/state"
+)
+
+// pingTimeout bounds a single ping so a slow monitoring service cannot hold up
+// shutdown.
+const pingTimeout = 10 * time.Second
+
+// Ping reports the end of a scan cycle to a healthchecks.io style URL with
+// method, GET when it is empty. A failed cycle is reported on the "/fail"
+// endpoint. The summary is sent as the body, which such services attach to
+// POST pings. Errors are logged.
+func Ping(url, method string, failed bool, summary string, log *logging.Logger) {
+	if failed {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, strings.NewReader(summary))
+	if err != nil {
+		log.Warnf("Invalid ping URL: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Warnf("Ping failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Warnf("Ping returned status %d", resp.StatusCode)
+	}
+}
+
+// CycleFailed reports whether a scan cycle failed as a whole: the scan could
+// not run, or every file failed talking to Sonarr.
+func CycleFailed(result *importer.ScanResult, err error) bool {
+	if err != nil || result == nil {
+		return true
+	}
+	return result.Total > 0 && sonarrFailures(result) == result.Total
+}
+
+// sonarrFailures counts the files that failed because of Sonarr itself.
+func sonarrFailures(result *importer.ScanResult) int {
+	return result.Failures[importer.CategoryAPI] + result.Failures[importer.CategoryUnreachable]
+}
+
+// PingSummary describes a scan result in one line for a ping body.
+func PingSummary(result *importer.ScanResult, err error) string {
+	if result == nil {
+		return fmt.Sprintf("scan failed: %v", err)
+	}
+
+	summary := fmt.Sprintf("%d/%d files imported", result.Succeeded(), result.Total)
+	if result.Failed > 0 {
+		categories := make([]string, 0, len(result.Failures))
+		for category, n := range result.Failures {
+			categories = append(categories, fmt.Sprintf("%s: %d", category, n))
+		}
+		sort.Strings(categories)
+		summary += fmt.Sprintf(", %d failed (%s)", result.Failed, strings.Join(categories, ", "))
+	}
+	if result.Interrupted {
+		summary += ", interrupted"
+	}
+	if err != nil {
+		summary += fmt.Sprintf(", error: %v", err)
+	}
+	return summary
+}
+
+// ping records a finished cycle in the heartbeat file and reports it to the
+// ping URL in the background.
+func (d *Daemon) ping(failed bool, summary string) {
+	now := time.Now()
+	d.mu.Lock()
+	d.lastCycle = now
+	d.mu.Unlock()
+	if d.opts.HeartbeatFile != "" {
+		hb := state.Heartbeat{Time: now, Failed: failed, Summary: summary, PID: os.Getpid()}
+		if err := state.WriteHeartbeat(d.opts.HeartbeatFile, hb); err != nil {
+			d.log.Warnf("Failed to write heartbeat: %v", err)
+		}
+	}
+
+	if d.opts.PingURL == "" {
+		return
+	}
+	go Ping(d.opts.PingURL, d.opts.PingMethod, failed, summary, d.log)
+}
+
+// MaxCycleAge is how long a daemon scanning every period may go without
+// finishing a scan cycle before it counts as stuck.
+func MaxCycleAge(period time.Duration) time.Duration {
+	return 3 * period
+}
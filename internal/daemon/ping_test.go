@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pingRequest is a ping as a fake monitoring service received it.
+type pingRequest struct {
+	method, path, body string
+}
+
+// pingServer starts a fake monitoring service that sends every ping it
+// receives on the returned channel.
+func pingServer(t *testing.T) (*httptest.Server, <-chan pingRequest) {
+	t.Helper()
+	pings := make(chan pingRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pings <- pingRequest{method: r.Method, path: r.URL.Path, body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, pings
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		failed bool
+		want   pingRequest
+	}{
+		{"default", "", false, pingRequest{http.MethodGet, "/uuid", "1/1 files imported"}},
+		{"failed", "", true, pingRequest{http.MethodGet, "/uuid/fail", "1/1 files imported"}},
+		{"post", "post", false, pingRequest{http.MethodPost, "/uuid", "1/1 files imported"}},
+		{"post failed", "POST", true, pingRequest{http.MethodPost, "/uuid/fail", "1/1 files imported"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, pings := pingServer(t)
+			Ping(srv.URL+"/uuid", tt.method, tt.failed, "1/1 files imported", nil)
+			if got := <-pings; got != tt.want {
+				t.Errorf("ping %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"os"
+	"time"
+)
+
+// requestReload asks the Run loop to reload the configuration as soon as no
+// scan is running.
+func (d *Daemon) requestReload() {
+	d.reloadRequested.Store(true)
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// reloadIfNeeded reloads the configuration when a reload was requested or the
+// config file or its rules file changed and daemon.reloadOnChange is set. It must only be called
+// by the Run loop while no scan is running.
+func (d *Daemon) reloadIfNeeded() {
+	if d.opts.Reload == nil {
+		d.reloadRequested.Store(false)
+		return
+	}
+	if d.reloadRequested.Swap(false) {
+		d.reload("SIGHUP")
+		return
+	}
+	if !d.importer().Config.Daemon.ReloadOnChange {
+		return
+	}
+	if modTime := d.configFileModTime(); !modTime.Equal(d.configModTime) {
+		d.reload(d.opts.ConfigPath + " changed")
+	}
+}
+
+// reload swaps in the importer of the new configuration. The current one is
+// kept when the new configuration does not load or validate.
+func (d *Daemon) reload(reason string) {
+	d.log.Infof("Reloading configuration (%s)", reason)
+	// A broken file is not retried until it changes again
+	d.configModTime = d.configFileModTime()
+
+	imp, err := d.opts.Reload()
+	if err != nil {
+		d.log.Errorf("Keeping the current configuration: %v", err)
+		return
+	}
+	d.mu.Lock()
+	d.imp = imp
+	d.mu.Unlock()
+	// The new configuration may name another rules file
+	d.configModTime = d.configFileModTime()
+	d.log.Infof("Configuration reloaded")
+}
+
+// configFileModTime returns the latest modification time of the config file
+// and of its rules file, leaving out those that cannot be read.
+func (d *Daemon) configFileModTime() time.Time {
+	if d.opts.ConfigPath == "" {
+		return time.Time{}
+	}
+	var latest time.Time
+	for _, path := range []string{d.opts.ConfigPath, d.importer().Config.RulesPath} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
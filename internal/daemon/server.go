@@ -0,0 +1,342 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/version"
+)
+
+// healthTimeout bounds the Sonarr reachability check of /healthz.
+const healthTimeout = 5 * time.Second
+
+// Status is the JSON document served on /status.
+type Status struct {
+	Version      string         `json:"version"`
+	Scanning     bool           `json:"scanning"`
+	LastScan     *ScanSummary   `json:"lastScan,omitempty"`
+	PendingFiles []string       `json:"pendingFiles"`
+	CurrentScan  *ScanInfo      `json:"currentScan,omitempty"`
+	QueuedScan   *QueuedScan    `json:"queuedScan,omitempty"`
+	Backoff      *BackoffStatus `json:"backoff,omitempty"`
+	// RetryQueue is the number of files waiting for a retry, of which
+	// AwaitingMetadata wait for their episode to be listed.
+	RetryQueue       int `json:"retryQueue"`
+	AwaitingMetadata int `json:"awaitingMetadata,omitempty"`
+	// Paused is set while scans are paused, and Pause tells why.
+	Paused bool         `json:"paused"`
+	Pause  *PauseStatus `json:"pause,omitempty"`
+	// ActiveHours is set with daemon.activeHours.
+	ActiveHours *ActiveHoursStatus `json:"activeHours,omitempty"`
+	// SonarrAPI sums up what the finished scans asked of Sonarr.
+	SonarrAPI *importer.APIUsage `json:"sonarrApi,omitempty"`
+}
+
+// ScanInfo identifies a running scan.
+type ScanInfo struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// QueuedScan is a triggered scan waiting for the running one to finish.
+type QueuedScan struct {
+	ID    string   `json:"id"`
+	Full  bool     `json:"full"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// ScanSummary describes the most recent finished scan.
+type ScanSummary struct {
+	ID          string                         `json:"id"`
+	Kind        string                         `json:"kind"`
+	StartedAt   time.Time                      `json:"startedAt"`
+	FinishedAt  time.Time                      `json:"finishedAt"`
+	Error       string                         `json:"error,omitempty"`
+	Total       int                            `json:"total"`
+	Imported    int                            `json:"imported"`
+	DryRun      int                            `json:"dryRun"`
+	Failed      int                            `json:"failed"`
+	SeriesAdded int                            `json:"seriesAdded"`
+	Deferred    int                            `json:"deferred,omitempty"`
+	Ignored     int                            `json:"ignored,omitempty"`
+	Failures    map[importer.ErrorCategory]int `json:"failures,omitempty"`
+	Latency     *importer.LatencyStats         `json:"latency,omitempty"`
+	BytesRead   int64                          `json:"bytesRead,omitempty"`
+	SonarrAPI   *importer.APIUsage             `json:"sonarrApi,omitempty"`
+}
+
+// totalFailure reports whether the scan achieved nothing because of an error
+// outside the individual files: it could not run, or every file failed to
+// reach Sonarr.
+func (s *ScanSummary) totalFailure() bool {
+	if s.Error != "" {
+		return true
+	}
+	return s.Total > 0 && s.Failures[importer.CategoryAPI]+s.Failures[importer.CategoryUnreachable] == s.Total
+}
+
+func newScanSummary(info *ScanInfo, result *importer.ScanResult, err error) *ScanSummary {
+	summary := &ScanSummary{
+		ID:         info.ID,
+		Kind:       info.Kind,
+		StartedAt:  info.StartedAt,
+		FinishedAt: time.Now(),
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	if result != nil {
+		summary.StartedAt = result.StartedAt
+		summary.FinishedAt = result.FinishedAt
+		summary.Total = result.Total
+		summary.Imported = result.Imported
+		summary.DryRun = result.DryRun
+		summary.Failed = result.Failed
+		summary.SeriesAdded = result.SeriesAdded
+		summary.Deferred = result.Deferred
+		summary.Ignored = result.Ignored
+		summary.Failures = result.Failures
+		summary.Latency = result.Latency
+		summary.BytesRead = result.BytesRead
+		summary.SonarrAPI = result.SonarrAPI
+	}
+	return summary
+}
+
+// Status returns a snapshot of what the daemon is doing.
+func (d *Daemon) Status() Status {
+	retryQueue, awaiting := 0, 0
+	if retry := d.importer().Retry; retry != nil {
+		retryQueue = retry.Len()
+		awaiting = retry.Count(importer.CategoryAwaitingMetadata)
+	}
+	pause := d.Paused()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := Status{
+		Version:          version.String(),
+		Scanning:         d.scanning.Load(),
+		CurrentScan:      d.current,
+		LastScan:         d.lastScan,
+		PendingFiles:     append([]string{}, d.queued...),
+		Backoff:          d.backoff,
+		RetryQueue:       retryQueue,
+		Paused:           pause != nil,
+		AwaitingMetadata: awaiting,
+		Pause:            pause,
+		ActiveHours:      d.activeHours(time.Now()),
+	}
+	if d.sonarrAPI.Requests > 0 || d.sonarrAPI.LookupCacheHits > 0 {
+		usage := importer.APIUsage{}
+		usage.Add(d.sonarrAPI)
+		status.SonarrAPI = &usage
+	}
+	if t := d.triggered; t != nil {
+		status.QueuedScan = &QueuedScan{
+			ID:    t.id,
+			Full:  t.full,
+			Paths: append([]string(nil), t.paths...),
+		}
+	}
+	return status
+}
+
+// health reports whether the daemon can do its job and why not.
+func (d *Daemon) health(ctx context.Context) (bool, string) {
+	d.mu.Lock()
+	last := d.lastScan
+	lastCycle, period := d.lastCycle, d.period
+	d.mu.Unlock()
+	if lastCycle.IsZero() {
+		lastCycle = d.started
+	}
+
+	if last != nil && last.totalFailure() {
+		if last.Error != "" {
+			return false, "last scan failed: " + last.Error
+		}
+		return false, "last scan could not reach Sonarr for any file"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	if _, err := d.importer().Client.SystemStatus(ctx); err != nil {
+		return false, fmt.Sprintf("Sonarr unreachable: %v", err)
+	}
+	if since := time.Since(lastCycle); period > 0 && since > MaxCycleAge(period) {
+		return false, fmt.Sprintf("no scan cycle finished for %v, the scan loop is stuck", since.Round(time.Second))
+	}
+	if p := d.Paused(); p != nil {
+		return true, "ok, paused: " + p.Reason
+	}
+	if h := d.activeHours(time.Now()); h != nil && !h.Active {
+		return true, "ok, " + waitingForWindow + " at " + h.NextStart.Format(time.RFC3339)
+	}
+	return true, "ok"
+}
+
+func (d *Daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		ok, reason := d.health(r.Context())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, reason)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.Status())
+	})
+	mux.HandleFunc("/scan", d.handleScan)
+	mux.HandleFunc("/pause", d.handlePause)
+	mux.HandleFunc("/resume", d.handlePause)
+	mux.HandleFunc("/webhook", d.handleWebhook)
+	mux.HandleFunc("/metrics", d.handleMetrics)
+	if d.opts.Pprof && d.opts.PprofAddr == "" {
+		mux.Handle("/debug/", d.debugHandler())
+	}
+	return mux
+}
+
+// pauseRequest is the optional body of POST /pause.
+type pauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handlePause pauses or resumes the daemon and answers with the new state.
+func (d *Daemon) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !d.authorized(w, r, strings.TrimPrefix(r.URL.Path, "/")+" request") {
+		return
+	}
+
+	if r.URL.Path == "/resume" {
+		d.Resume()
+		if p := d.Paused(); p != nil {
+			http.Error(w, fmt.Sprintf("still paused: %s", p.Reason), http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+		return
+	}
+
+	var req pauseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "requested over HTTP"
+	}
+	d.Pause(req.Reason)
+	writeJSON(w, http.StatusOK, map[string]any{"paused": true, "pause": d.Paused()})
+}
+
+// scanRequest is the optional body of POST /scan.
+type scanRequest struct {
+	// Path limits the scan to one file or directory below the downloads
+	// folder.
+	Path string `json:"path"`
+}
+
+// handleScan triggers a scan and answers with its ID.
+func (d *Daemon) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !d.authorized(w, r, "scan request") {
+		return
+	}
+
+	var req scanRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var paths []string
+	if req.Path != "" {
+		path, err := d.downloadsPath(req.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		paths = []string{path}
+		d.log.Infof("Scan of %s requested over HTTP", path)
+	} else {
+		d.log.Infof("Scan requested over HTTP")
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": d.Trigger(paths)})
+}
+
+// downloadsPath cleans path and checks that it lies inside the downloads
+// folder.
+func (d *Daemon) downloadsPath(path string) (string, error) {
+	root := filepath.Clean(d.importer().Config.Sonarr.DownloadsFolder)
+	path = filepath.Clean(path)
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %q is not absolute", path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the downloads folder %s", path, root)
+	}
+	return path, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// serve starts a listener on addr serving handler; name describes it in the
+// log. The returned function shuts it down, waiting briefly for in-flight
+// requests.
+func (d *Daemon) serve(name, addr string, handler http.Handler) (shutdown func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.log.Errorf("%s stopped: %v", name, err)
+		}
+	}()
+	d.log.Infof("%s listening on %s", name, ln.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// newTestDaemon returns a daemon, which is not running, of the default
+// configuration with token as daemon.webhook.token, talking to a fake
+// Sonarr.
+func newTestDaemon(t *testing.T, token string) *Daemon {
+	t.Helper()
+	srv := sonarrtest.New()
+	t.Cleanup(srv.Close)
+	cfg := config.Default()
+	cfg.Sonarr.URL = srv.URL
+	cfg.Sonarr.APIKey = sonarrtest.APIKey
+	cfg.Sonarr.DownloadsFolder = t.TempDir()
+	cfg.Daemon.Webhook.Token = token
+	imp := importer.New(&cfg, srv.Client(), logging.New(io.Discard, logging.LevelDebug), importer.Options{})
+	return New(imp, Options{})
+}
+
+// post sends a POST request to path of the handler of d with token in the
+// X-Webhook-Token header, unless it is empty, and returns the status code.
+func post(t *testing.T, d *Daemon, path, token, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(webhookTokenHeader, token)
+	}
+	rec := httptest.NewRecorder()
+	d.handler().ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestScanRequiresToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+		want       int
+	}{
+		{"no token configured", "", "", http.StatusForbidden},
+		{"no token configured, token sent", "", "secret", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "guess", http.StatusUnauthorized},
+		{"valid token", "secret", "secret", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDaemon(t, tt.configured)
+			if got := post(t, d, "/scan", tt.sent, ""); got != tt.want {
+				t.Errorf("POST /scan = %d, want %d", got, tt.want)
+			}
+			if queued := d.Status().QueuedScan != nil; queued != (tt.want == http.StatusAccepted) {
+				t.Errorf("scan queued = %v after status %d", queued, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRequiresToken(t *testing.T) {
+	d := newTestDaemon(t, "secret")
+	if got := post(t, d, "/webhook", "guess", ""); got != http.StatusUnauthorized {
+		t.Errorf("POST /webhook with a wrong token = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := post(t, d, "/webhook", "secret", ""); got != http.StatusAccepted {
+		t.Errorf("POST /webhook = %d, want %d", got, http.StatusAccepted)
+	}
+}
+
+func TestWebhookRequiresPOST(t *testing.T) {
+	d := newTestDaemon(t, "secret")
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/webhook?path=show&category=tv", nil)
+		req.Header.Set(webhookTokenHeader, "secret")
+		rec := httptest.NewRecorder()
+		d.handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s /webhook = %d, Allow %q; want %d, Allow POST", method, rec.Code, rec.Header().Get("Allow"), http.StatusMethodNotAllowed)
+		}
+	}
+	if queued := d.Status().QueuedScan; queued != nil {
+		t.Errorf("a scan was queued by a request other than POST: %+v", queued)
+	}
+}
+
+func TestPauseRequiresToken(t *testing.T) {
+	for _, path := range []string{"/pause", "/resume"} {
+		t.Run(path, func(t *testing.T) {
+			if got := post(t, newTestDaemon(t, ""), path, "secret", ""); got != http.StatusForbidden {
+				t.Errorf("POST %s without a configured token = %d, want %d", path, got, http.StatusForbidden)
+			}
+			d := newTestDaemon(t, "secret")
+			if got := post(t, d, path, "", ""); got != http.StatusUnauthorized {
+				t.Errorf("POST %s without a token = %d, want %d", path, got, http.StatusUnauthorized)
+			}
+			if got := post(t, d, path, "guess", ""); got != http.StatusUnauthorized {
+				t.Errorf("POST %s with a wrong token = %d, want %d", path, got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	d := newTestDaemon(t, "secret")
+	if got := post(t, d, "/pause", "guess", `{"reason":"disk swap"}`); got != http.StatusUnauthorized || d.Paused() != nil {
+		t.Fatalf("POST /pause with a wrong token = %d, paused %v", got, d.Paused())
+	}
+	if got := post(t, d, "/pause", "secret", `{"reason":"disk swap"}`); got != http.StatusOK {
+		t.Fatalf("POST /pause = %d, want %d", got, http.StatusOK)
+	}
+	if p := d.Paused(); p == nil || p.Reason != "disk swap" {
+		t.Fatalf("Paused() = %+v, want the reason of the request", p)
+	}
+	if got := post(t, d, "/resume", "guess", ""); got != http.StatusUnauthorized || d.Paused() == nil {
+		t.Fatalf("POST /resume with a wrong token = %d, paused %v", got, d.Paused())
+	}
+	if got := post(t, d, "/resume", "secret", ""); got != http.StatusOK {
+		t.Fatalf("POST /resume = %d, want %d", got, http.StatusOK)
+	}
+	if p := d.Paused(); p != nil {
+		t.Errorf("Paused() = %+v after resuming", p)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package daemon
+
+import "context"
+
+// notifyTrigger is a no-op where SIGUSR1 does not exist.
+func (d *Daemon) notifyTrigger(ctx context.Context) (stop func()) {
+	return func() {}
+}
+
+// notifyPause is a no-op where SIGUSR2 does not exist.
+func (d *Daemon) notifyPause(ctx context.Context) (stop func()) {
+	return func() {}
+}
+
+// notifyReload is a no-op where SIGHUP does not exist.
+func (d *Daemon) notifyReload(ctx context.Context) (stop func()) {
+	return func() {}
+}
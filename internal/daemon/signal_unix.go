@@ -0,0 +1,89 @@
+//go:build unix
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyTrigger triggers a full scan on every SIGUSR1 until ctx is cancelled
+// or the returned function is called.
+func (d *Daemon) notifyTrigger(ctx context.Context) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				d.log.Infof("Scan requested by SIGUSR1")
+				d.Trigger(nil)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// notifyPause toggles the pause on every SIGUSR2 until ctx is cancelled or
+// the returned function is called.
+func (d *Daemon) notifyPause(ctx context.Context) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				if !d.Resume() {
+					d.Pause("SIGUSR2")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// notifyReload requests a configuration reload on every SIGHUP until ctx is
+// cancelled or the returned function is called.
+func (d *Daemon) notifyReload(ctx context.Context) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				if d.opts.Reload == nil {
+					d.log.Warnf("Ignoring SIGHUP, the configuration cannot be reloaded")
+					continue
+				}
+				d.requestReload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
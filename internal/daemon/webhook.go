@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// webhookTokenHeader carries the shared secret of the webhook endpoint.
+const webhookTokenHeader = "X-Webhook-Token"
+
+// handleWebhook accepts the completion notifications of download clients. The
+// content path and category are read from the query or a form body, so the
+// call fits in a short curl command such as qBittorrent's "run external
+// program on torrent finished":
+//
+//	curl -X POST -H "X-Webhook-Token: secret" \
+//	  --data-urlencode "path=%F" --data-urlencode "category=%L" \
+//	  http://autoimport:8090/webhook
+func (d *Daemon) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	// The token may be set or cleared by a reload, so the route always exists
+	cfg := d.importer().Config.Daemon.Webhook
+	if cfg.Token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Only POST starts an import, so a link that is merely fetched, such as
+	// by a chat preview, cannot
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !d.authorized(w, r, "webhook call") {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// qBittorrent calls it the content path, SABnzbd the final directory
+	path := firstValue(r, "path", "content_path", "dir")
+	category := firstValue(r, "category", "cat")
+
+	if !categoryAllowed(cfg.Categories, category) {
+		d.log.Debugf("Ignoring webhook call for category %q", category)
+		writeJSON(w, http.StatusOK, map[string]any{"ignored": true, "category": category})
+		return
+	}
+
+	var paths []string
+	if path != "" {
+		local := config.MapPath(cfg.PathMappings, filepath.Clean(path))
+		if local, err := d.downloadsPath(local); err == nil {
+			paths = []string{local}
+			d.log.Infof("Download finished: %s", local)
+		} else {
+			d.log.Warnf("Webhook path not usable (%v), scanning the whole downloads folder", err)
+		}
+	} else {
+		d.log.Infof("Download finished, scanning the downloads folder")
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": d.Trigger(paths)})
+}
+
+// authorized reports whether r carries daemon.webhook.token in the
+// X-Webhook-Token header, which every endpoint that changes the state of the
+// daemon requires. Otherwise it answers r and logs the call, described by
+// what. Without a token such endpoints are disabled.
+func (d *Daemon) authorized(w http.ResponseWriter, r *http.Request, what string) bool {
+	want := d.importer().Config.Daemon.Webhook.Token
+	if want == "" {
+		http.Error(w, "disabled, set daemon.webhook.token to enable it", http.StatusForbidden)
+		return false
+	}
+	token := r.Header.Get(webhookTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		d.log.Warnf("Rejected %s from %s: invalid token", what, r.RemoteAddr)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// firstValue returns the first non-empty form value among keys.
+func firstValue(r *http.Request, keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(r.Form.Get(key)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// categoryAllowed reports whether category is in allowed, ignoring case. An
+// empty allowlist accepts every category.
+func categoryAllowed(allowed []string, category string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, c := range allowed {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"time"
+)
+
+// waitingForWindow is why scans do not run outside the active hours.
+const waitingForWindow = "waiting for active window"
+
+// ActiveHoursStatus describes the active hours of the daemon.
+type ActiveHoursStatus struct {
+	Window string `json:"window"`
+	Active bool   `json:"active"`
+	// Reason and NextStart are set outside the window: scans wait for it to
+	// open at NextStart.
+	Reason    string     `json:"reason,omitempty"`
+	NextStart *time.Time `json:"nextStart,omitempty"`
+}
+
+// activeHours returns the state of the active hours at now, or nil when the
+// daemon has none.
+func (d *Daemon) activeHours(now time.Time) *ActiveHoursStatus {
+	w := d.opts.ActiveHours
+	if w == nil {
+		return nil
+	}
+	status := &ActiveHoursStatus{Window: w.String(), Active: w.Contains(now)}
+	if !status.Active {
+		status.Reason = waitingForWindow
+		next := w.NextStart(now)
+		status.NextStart = &next
+	}
+	return status
+}
+
+// skipInactive reports whether scans have to wait because it is outside the
+// active hours. The paths of a skipped scan join the pending files, and a
+// full scan, which covers them and every other file that arrived meanwhile,
+// is triggered when the window opens. Only the first skipped scan of a wait
+// is logged, and skipped scheduled scans still ping, so monitoring does not
+// take the wait for a hung daemon.
+func (d *Daemon) skipInactive(kind string, paths []string) bool {
+	w := d.opts.ActiveHours
+	now := time.Now()
+	if w == nil || w.Contains(now) {
+		return false
+	}
+	next := w.NextStart(now)
+
+	d.mu.Lock()
+	d.queued = append(d.queued, paths...)
+	waiting := d.windowWait != nil
+	if !waiting {
+		// A second late, so the scan does not find the window still closed
+		d.windowWait = time.AfterFunc(time.Until(next)+time.Second, func() {
+			d.mu.Lock()
+			d.windowWait = nil
+			d.mu.Unlock()
+			d.log.Infof("Active hours %s started, scanning the files that arrived meanwhile", w)
+			d.Trigger(nil)
+		})
+	}
+	d.mu.Unlock()
+
+	if !waiting {
+		d.log.Infof("Outside active hours %s, deferring scans until %s", w, next.Local().Format("2006-01-02 15:04"))
+	}
+	if kind == "Initial" || kind == "Scheduled" {
+		d.ping(false, waitingForWindow)
+	}
+	return true
+}
+
+// stopWindowWait cancels the scan waiting for the active hours.
+func (d *Daemon) stopWindowWait() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.windowWait != nil {
+		d.windowWait.Stop()
+		d.windowWait = nil
+	}
+}
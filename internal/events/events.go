@@ -0,0 +1,196 @@
+// Package events streams what the importer does as newline-delimited JSON,
+// one event per line, for scripts that follow scans as they happen.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// SchemaVersion is the version of the event format, raised when a field
+// changes meaning or is removed. New fields and event types may be added
+// without raising it.
+const SchemaVersion = 1
+
+// writeTimeout bounds how long a socket consumer may take to accept an event.
+const writeTimeout = 5 * time.Second
+
+// Type identifies what happened. The names are stable.
+type Type string
+
+const (
+	ScanStarted  Type = "scan.started"
+	FileParsed   Type = "file.parsed"
+	SeriesAdded  Type = "series.added"
+	MovieAdded   Type = "movie.added"
+	FileImported Type = "file.imported"
+	FileDryRun   Type = "file.dry-run"
+	FileFailed   Type = "file.failed"
+	ScanFinished Type = "scan.finished"
+)
+
+// Event is one line of the stream. ScanID and, for file events, Path
+// correlate the events of a file across the stream.
+type Event struct {
+	Schema int       `json:"schema"`
+	Type   Type      `json:"type"`
+	Time   time.Time `json:"time"`
+	ScanID string    `json:"scanId"`
+	Path   string    `json:"path,omitempty"`
+	// File is the file result as far as it is known, for file events.
+	File *importer.FileResult `json:"file,omitempty"`
+	// Scan is set for the scan events.
+	Scan *Summary `json:"scan,omitempty"`
+}
+
+// Summary describes a scan without its per-file results, which were already
+// streamed as file events. The counters are only set by scan.finished.
+type Summary struct {
+	Folder      string                         `json:"folder"`
+	StartedAt   time.Time                      `json:"startedAt"`
+	FinishedAt  *time.Time                     `json:"finishedAt,omitempty"`
+	Total       int                            `json:"total"`
+	Imported    int                            `json:"imported"`
+	DryRun      int                            `json:"dryRun"`
+	Failed      int                            `json:"failed"`
+	SeriesAdded int                            `json:"seriesAdded"`
+	MoviesAdded int                            `json:"moviesAdded"`
+	Failures    map[importer.ErrorCategory]int `json:"failures,omitempty"`
+	Deferred    int                            `json:"deferred"`
+	Ignored     int                            `json:"ignored"`
+	Remaining   int                            `json:"remaining"`
+	Interrupted bool                           `json:"interrupted"`
+	Error       string                         `json:"error,omitempty"`
+}
+
+// Stream writes every event to a writer as soon as it happens. It implements
+// importer.StepObserver. A failed write is logged once and stops the stream,
+// so a consumer that went away never holds up a scan.
+type Stream struct {
+	mu    sync.Mutex
+	w     io.Writer
+	close func() error
+	// conn is set for sockets, whose writes time out after writeTimeout.
+	conn   net.Conn
+	failed bool
+	log    *logging.Logger
+}
+
+// Open opens the stream target: "ndjson" or "-" for stdout, "unix:PATH" for a
+// listening unix socket and anything else, optionally prefixed with "file:",
+// for a file the events are appended to.
+func Open(target string, log *logging.Logger) (*Stream, error) {
+	s := &Stream{log: log}
+	switch {
+	case Stdout(target):
+		s.w, s.close = os.Stdout, func() error { return nil }
+	case strings.HasPrefix(target, "unix:"):
+		conn, err := net.Dial("unix", strings.TrimPrefix(target, "unix:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to event socket: %w", err)
+		}
+		s.w, s.close, s.conn = conn, conn.Close, conn
+	default:
+		file, err := os.OpenFile(strings.TrimPrefix(target, "file:"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open event file: %w", err)
+		}
+		s.w, s.close = file, file.Close
+	}
+	return s, nil
+}
+
+// Stdout reports whether target streams to stdout.
+func Stdout(target string) bool {
+	return target == "ndjson" || target == "-"
+}
+
+// Close closes the target. Events sent afterwards are dropped.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	return s.close()
+}
+
+// ScanStarted implements importer.StepObserver.
+func (s *Stream) ScanStarted(r *importer.ScanResult) {
+	s.send(Event{Type: ScanStarted, ScanID: r.ID, Scan: &Summary{Folder: r.Folder, StartedAt: r.StartedAt}})
+}
+
+// FileStep implements importer.StepObserver.
+func (s *Stream) FileStep(step importer.Step, f importer.FileResult) {
+	var t Type
+	switch step {
+	case importer.StepParsed:
+		t = FileParsed
+	case importer.StepSeriesAdded:
+		t = SeriesAdded
+	case importer.StepMovieAdded:
+		t = MovieAdded
+	default:
+		return
+	}
+	s.send(Event{Type: t, ScanID: f.ScanID, Path: f.Path, File: &f})
+}
+
+// FileProcessed implements importer.Observer.
+func (s *Stream) FileProcessed(f importer.FileResult) {
+	s.send(Event{Type: Type("file." + string(f.Action)), ScanID: f.ScanID, Path: f.Path, File: &f})
+}
+
+// ScanFinished implements importer.Observer.
+func (s *Stream) ScanFinished(r *importer.ScanResult) {
+	finished := r.FinishedAt
+	s.send(Event{Type: ScanFinished, ScanID: r.ID, Scan: &Summary{
+		Folder:      r.Folder,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  &finished,
+		Total:       r.Total,
+		Imported:    r.Imported,
+		DryRun:      r.DryRun,
+		Failed:      r.Failed,
+		SeriesAdded: r.SeriesAdded,
+		MoviesAdded: r.MoviesAdded,
+		Failures:    r.Failures,
+		Deferred:    r.Deferred,
+		Ignored:     r.Ignored,
+		Remaining:   r.Remaining,
+		Interrupted: r.Interrupted,
+		Error:       r.Error,
+	}})
+}
+
+// send writes e as a single line. Each event is written with one call, so
+// nothing is left in a buffer between events.
+func (s *Stream) send(e Event) {
+	e.Schema = SchemaVersion
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		s.log.Errorf("Failed to encode %s event: %v", e.Type, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed {
+		return
+	}
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		s.failed = true
+		s.log.Warnf("Failed to write event stream, no further events are sent: %v", err)
+	}
+}
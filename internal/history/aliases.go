@@ -0,0 +1,77 @@
+package history
+
+import (
+	"path/filepath"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// AliasesFileName is the name of the title aliases inside the state
+// directory.
+const AliasesFileName = "aliases.json"
+
+// TitleAlias maps a parsed title to the TVDB ID of its series, for titles the
+// lookup does not find.
+type TitleAlias struct {
+	Title  string    `json:"title"`
+	TvdbID int       `json:"tvdbId"`
+	Added  time.Time `json:"added"`
+}
+
+// Aliases is the persisted title alias list written by the resolve command.
+// It implements importer.Aliases and picks up changes made while a daemon
+// runs.
+type Aliases struct {
+	file sharedFile[[]TitleAlias]
+	log  *logging.Logger
+}
+
+// OpenAliases returns the title aliases kept in the state directory dir.
+func OpenAliases(dir string, log *logging.Logger) *Aliases {
+	return &Aliases{file: sharedFile[[]TitleAlias]{path: filepath.Join(dir, AliasesFileName)}, log: log}
+}
+
+// TvdbID implements importer.Aliases.
+func (a *Aliases) TvdbID(title string) int {
+	id := 0
+	err := a.file.read(func(aliases *[]TitleAlias) {
+		for _, alias := range *aliases {
+			if titleKey(alias.Title) == titleKey(title) {
+				id = alias.TvdbID
+				return
+			}
+		}
+	})
+	if err != nil {
+		a.log.Errorf("Failed to read title aliases: %v", err)
+	}
+	return id
+}
+
+// List returns the aliases in the order they were added.
+func (a *Aliases) List() ([]TitleAlias, error) {
+	var list []TitleAlias
+	err := a.file.read(func(aliases *[]TitleAlias) { list = append(list, *aliases...) })
+	return list, err
+}
+
+// Len returns the number of aliases.
+func (a *Aliases) Len() int {
+	n := 0
+	a.file.read(func(aliases *[]TitleAlias) { n = len(*aliases) })
+	return n
+}
+
+// Set maps title to tvdbID, replacing an earlier alias of title.
+func (a *Aliases) Set(title string, tvdbID int) error {
+	return a.file.update(func(aliases *[]TitleAlias) {
+		kept := (*aliases)[:0]
+		for _, alias := range *aliases {
+			if titleKey(alias.Title) != titleKey(title) {
+				kept = append(kept, alias)
+			}
+		}
+		*aliases = append(kept, TitleAlias{Title: title, TvdbID: tvdbID, Added: time.Now()})
+	})
+}
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// writeJSON saves v as indented JSON at path. It is written to a temporary
+// file first, so path is never left half written.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// sharedFile is a JSON document that other processes may change, such as the
+// CLI while a daemon runs. Reads pick up their changes, and every change
+// rereads the file first so none is lost.
+type sharedFile[T any] struct {
+	path string
+
+	mu      sync.Mutex
+	data    T
+	modTime time.Time
+}
+
+// load rereads the file when it was modified since it was last read. An
+// absent file holds the zero value. The caller holds f.mu.
+func (f *sharedFile[T]) load() error {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		var zero T
+		f.data, f.modTime = zero, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !f.modTime.IsZero() && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var data T
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.data, f.modTime = data, info.ModTime()
+	return nil
+}
+
+// read calls fn with the current contents of the file.
+func (f *sharedFile[T]) read(fn func(*T)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.load()
+	fn(&f.data)
+	return err
+}
+
+// update applies change to the current contents of the file and saves them.
+func (f *sharedFile[T]) update(change func(*T)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return err
+	}
+	change(&f.data)
+	if err := writeJSON(f.path, f.data); err != nil {
+		return err
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime = info.ModTime()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// Fingerprints answers which file content was imported into which episode
+// from the history. It implements importer.Fingerprints and, to learn about
+// the imports of the running process, importer.Observer. Only the imports
+// since the cutoff of the checks are kept: the history is read when the
+// first file is checked, and again when the cutoff moves back, such as for a
+// longer dedupe.window after a reload. Older imports are dropped after every
+// scan.
+type Fingerprints struct {
+	store *Store
+	log   *logging.Logger
+
+	mu      sync.Mutex
+	loaded  bool
+	since   time.Time
+	cutoff  time.Time
+	imports map[fingerprintKey]fingerprintImport
+}
+
+// fingerprintKey is a file content imported into an episode.
+type fingerprintKey struct {
+	fingerprint string
+	instance    string
+	seriesID    int
+	season      int
+	episode     int
+}
+
+// fingerprintImport is the latest import of a fingerprintKey.
+type fingerprintImport struct {
+	path string
+	at   time.Time
+}
+
+// NewFingerprints returns the fingerprints recorded in store.
+func NewFingerprints(store *Store, log *logging.Logger) *Fingerprints {
+	return &Fingerprints{store: store, log: log}
+}
+
+// Imported implements importer.Fingerprints.
+func (f *Fingerprints) Imported(fingerprint, instance string, seriesID, season, episode int, since time.Time) (string, time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.loaded || since.Before(f.since) {
+		f.load(since)
+	}
+	f.cutoff = since
+	imp, ok := f.imports[fingerprintKey{fingerprint, instance, seriesID, season, episode}]
+	if !ok || imp.at.Before(since) {
+		return "", time.Time{}, false
+	}
+	return imp.path, imp.at, true
+}
+
+// load reads the imports of the history from since on. The caller holds
+// f.mu.
+func (f *Fingerprints) load(since time.Time) {
+	f.loaded, f.since = true, since
+	f.imports = make(map[fingerprintKey]fingerprintImport)
+	records, err := f.store.Since(since)
+	if err != nil {
+		f.log.Warnf("Failed to read the history, duplicates of earlier imports are not detected: %v", err)
+	}
+	for _, r := range records {
+		f.add(r)
+	}
+}
+
+// add records the import of r, if it is one with a fingerprint. The caller
+// holds f.mu.
+func (f *Fingerprints) add(r Record) {
+	if r.Action != importer.ActionImported || r.Fingerprint == "" || r.SeriesID == 0 {
+		return
+	}
+	f.imports[fingerprintKey{r.Fingerprint, r.Instance, r.SeriesID, r.Season, r.Episode}] = fingerprintImport{path: r.Path, at: r.Time}
+}
+
+// FileProcessed implements importer.Observer.
+func (f *Fingerprints) FileProcessed(result importer.FileResult) {
+	if result.Action != importer.ActionImported {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.loaded {
+		f.add(newRecord(result, time.Now()))
+	}
+}
+
+// ScanFinished implements importer.Observer. It drops the imports before
+// the cutoff of the latest check.
+func (f *Fingerprints) ScanFinished(*importer.ScanResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.loaded || !f.since.Before(f.cutoff) {
+		return
+	}
+	for key, imp := range f.imports {
+		if imp.at.Before(f.cutoff) {
+			delete(f.imports, key)
+		}
+	}
+	f.since = f.cutoff
+}
@@ -0,0 +1,55 @@
+package history
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+func imported(path, fingerprint string, at time.Time) Record {
+	return Record{Time: at, Path: path, Action: importer.ActionImported, Fingerprint: fingerprint, SeriesID: 1, Season: 1, Episode: 5}
+}
+
+func TestFingerprintsWithinCutoff(t *testing.T) {
+	store := Open(t.TempDir())
+	now := time.Now()
+	if err := store.Append(imported("old.mkv", "old", now.Add(-72*time.Hour)), imported("new.mkv", "new", now.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFingerprints(store, logging.New(io.Discard, logging.LevelDebug))
+
+	if _, _, ok := f.Imported("old", "", 1, 1, 5, now.Add(-24*time.Hour)); ok {
+		t.Error("an import before the cutoff was found")
+	}
+	if path, _, ok := f.Imported("new", "", 1, 1, 5, now.Add(-24*time.Hour)); !ok || path != "new.mkv" {
+		t.Errorf("Imported(new) = %q, %v; want new.mkv", path, ok)
+	}
+	if len(f.imports) != 1 {
+		t.Errorf("%d imports loaded, want only the one within the cutoff", len(f.imports))
+	}
+
+	// A longer window, such as after a reload, reads the history again
+	if path, _, ok := f.Imported("old", "", 1, 1, 5, now.Add(-96*time.Hour)); !ok || path != "old.mkv" {
+		t.Errorf("Imported(old) with an earlier cutoff = %q, %v; want old.mkv", path, ok)
+	}
+}
+
+func TestFingerprintsDropExpiredImports(t *testing.T) {
+	store := Open(t.TempDir())
+	f := NewFingerprints(store, logging.New(io.Discard, logging.LevelDebug))
+	now := time.Now()
+	f.Imported("none", "", 1, 1, 1, now.Add(-96*time.Hour))
+	f.mu.Lock()
+	f.add(imported("expired.mkv", "expired", now.Add(-72*time.Hour)))
+	f.add(imported("recent.mkv", "recent", now))
+	f.mu.Unlock()
+
+	f.Imported("none", "", 1, 1, 1, now.Add(-24*time.Hour))
+	f.ScanFinished(nil)
+	if len(f.imports) != 1 {
+		t.Errorf("%d imports kept after the scan, want only the recent one", len(f.imports))
+	}
+}
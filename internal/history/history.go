@@ -0,0 +1,339 @@
+// Package history keeps a record of every file the tool imported or failed to
+// import, so it can be looked up after Sonarr has moved the file away.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// FileName is the name of the history inside the state directory.
+const FileName = "history.jsonl"
+
+// Record is one entry of the history.
+type Record struct {
+	Time     time.Time       `json:"time"`
+	Path     string          `json:"path"`
+	Action   importer.Action `json:"action"`
+	Instance string          `json:"instance,omitempty"`
+	Title    string          `json:"title,omitempty"`
+	Season   int             `json:"season,omitempty"`
+	Episode  int             `json:"episode,omitempty"`
+	Quality  string          `json:"quality,omitempty"`
+	SeriesID int             `json:"seriesId,omitempty"`
+	// EpisodeID is set for episodes, MovieID for files handed to Radarr.
+	EpisodeID int                    `json:"episodeId,omitempty"`
+	MovieID   int                    `json:"movieId,omitempty"`
+	Year      int                    `json:"year,omitempty"`
+	Category  importer.ErrorCategory `json:"category,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	// Fingerprint identifies the content of the file, so copies of it under
+	// another name are known.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// ModTime is the modification time of the file when it was processed,
+	// and Latency the time from then to its import, for imported files.
+	ModTime time.Time     `json:"modTime,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// Failed reports whether the file of r was not imported.
+func (r Record) Failed() bool {
+	return r.Action == importer.ActionFailed
+}
+
+// newRecord converts the result of a processed file.
+func newRecord(f importer.FileResult, at time.Time) Record {
+	r := Record{
+		Time:        at,
+		Path:        f.Path,
+		Action:      f.Action,
+		Instance:    f.Instance,
+		SeriesID:    f.SeriesID,
+		EpisodeID:   f.EpisodeID,
+		MovieID:     f.MovieID,
+		Category:    f.Category,
+		Error:       f.Error,
+		Fingerprint: f.Fingerprint,
+		ModTime:     f.ModTime,
+		Latency:     f.Latency,
+	}
+	switch {
+	case f.Parsed != nil:
+		r.Title, r.Season, r.Episode, r.Quality = f.Parsed.Title, f.Parsed.Season, f.Parsed.Episode, f.Parsed.Quality
+		if f.SeriesTitle != "" {
+			r.Title = f.SeriesTitle
+		}
+	case f.Movie != nil:
+		r.Title, r.Year, r.Quality = f.Movie.Title, f.Movie.Year, f.Movie.Quality
+		if f.MovieTitle != "" {
+			r.Title = f.MovieTitle
+		}
+	}
+	return r
+}
+
+// Store is the history file of a state directory. Records are appended one
+// JSON document per line, so a crash loses at most the line being written.
+// Appending and pruning lock a file next to the history, so a prune from the
+// CLI and the appends of a running daemon do not lose each other's changes.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the history kept in the state directory dir. The file is
+// created by the first Append.
+func Open(dir string) *Store {
+	return &Store{path: filepath.Join(dir, FileName)}
+}
+
+// Path returns the location of the history file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds records to the end of the history.
+func (s *Store) Append(records ...Record) error {
+	var b strings.Builder
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	return s.locked(func() error {
+		file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		// A single write keeps the lines of concurrent writers apart
+		if _, err := file.WriteString(b.String()); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+}
+
+// locked calls fn holding s.mu and the lock file of the history, which it
+// creates with the state directory when they are missing.
+func (s *Store) locked(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", lock.Name(), err)
+	}
+	defer unlockFile(lock)
+	return fn()
+}
+
+// Records returns the whole history, oldest first. An absent file is an empty
+// history, and lines that cannot be decoded, such as one cut short by a crash,
+// are skipped.
+func (s *Store) Records() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *Store) read() ([]Record, error) {
+	var records []Record
+	err := s.each(func(r Record) { records = append(records, r) })
+	return records, err
+}
+
+// Since returns the records from since on, oldest first, without holding
+// the older ones in memory.
+func (s *Store) Since(since time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []Record
+	err := s.each(func(r Record) {
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	})
+	return records, err
+}
+
+// each calls fn with every record of the history, oldest first.
+func (s *Store) each(fn func(Record)) error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err == nil {
+			fn(r)
+		}
+	}
+	return scanner.Err()
+}
+
+// Prune removes the records older than before and returns how many were
+// removed. The remaining history is written to a temporary file first, so it
+// is never left half written.
+func (s *Store) Prune(before time.Time) (int, error) {
+	var removed int
+	err := s.locked(func() error {
+		records, err := s.read()
+		if err != nil || len(records) == 0 {
+			return err
+		}
+		kept := records[:0]
+		for _, r := range records {
+			if !r.Time.Before(before) {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == len(records) {
+			return nil
+		}
+		if err := s.rewrite(kept); err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", s.path, err)
+		}
+		removed = len(records) - len(kept)
+		return nil
+	})
+	return removed, err
+}
+
+// rewrite replaces the history with records. The caller holds the lock.
+func (s *Store) rewrite(records []Record) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), FileName+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Pending returns the latest record of every file whose last attempt failed
+// and that was not imported since, oldest first.
+func Pending(records []Record) []Record {
+	latest := make(map[string]int)
+	for i, r := range records {
+		latest[r.Path] = i
+	}
+	var pending []Record
+	for i, r := range records {
+		if latest[r.Path] == i && r.Failed() {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+// Recorder adds the outcome of every file of a real run to a Store. It
+// implements importer.Observer. Dry runs change nothing and are not recorded.
+type Recorder struct {
+	store *Store
+	log   *logging.Logger
+}
+
+// NewRecorder returns a Recorder writing to store.
+func NewRecorder(store *Store, log *logging.Logger) *Recorder {
+	return &Recorder{store: store, log: log}
+}
+
+// FileProcessed implements importer.Observer.
+func (r *Recorder) FileProcessed(f importer.FileResult) {
+	if f.Action == importer.ActionDryRun {
+		return
+	}
+	if err := r.store.Append(newRecord(f, time.Now())); err != nil {
+		r.log.Errorf("Failed to record %s in the history: %v", filepath.Base(f.Path), err)
+	}
+}
+
+// ScanFinished implements importer.Observer.
+func (r *Recorder) ScanFinished(*importer.ScanResult) {}
+
+// pruneInterval is how often a Pruner prunes the history at most.
+const pruneInterval = time.Hour
+
+// Pruner keeps a Store to a retention by pruning it after scans, at most
+// once every pruneInterval. It implements importer.Observer.
+type Pruner struct {
+	store     *Store
+	retention time.Duration
+	log       *logging.Logger
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewPruner returns a Pruner removing the records of store older than
+// retention.
+func NewPruner(store *Store, retention time.Duration, log *logging.Logger) *Pruner {
+	return &Pruner{store: store, retention: retention, log: log}
+}
+
+// FileProcessed implements importer.Observer.
+func (p *Pruner) FileProcessed(importer.FileResult) {}
+
+// ScanFinished implements importer.Observer.
+func (p *Pruner) ScanFinished(*importer.ScanResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if now.Sub(p.last) < pruneInterval {
+		return
+	}
+	p.last = now
+	removed, err := p.store.Prune(now.Add(-p.retention))
+	if err != nil {
+		p.log.Errorf("Failed to prune the history: %v", err)
+		return
+	}
+	if removed > 0 {
+		p.log.Infof("Removed %d history record(s) older than %v", removed, p.retention)
+	}
+}
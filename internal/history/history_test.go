@@ -0,0 +1,121 @@
+package history
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+func record(path string, at time.Time) Record {
+	return Record{Time: at, Path: path, Action: importer.ActionImported}
+}
+
+func TestPrune(t *testing.T) {
+	store := Open(t.TempDir())
+	now := time.Now()
+	if err := store.Append(record("old", now.Add(-48*time.Hour)), record("new", now)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.Prune(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Prune removed %d records, want 1", removed)
+	}
+	records, err := store.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Path != "new" {
+		t.Errorf("records after Prune = %+v, want only new", records)
+	}
+}
+
+// TestPruneKeepsConcurrentAppends appends through one store while another,
+// standing in for the CLI, holds the lock of a prune, as a running daemon
+// and a prune from the command line would. The append must wait for the
+// rewrite, instead of going to the file it replaces.
+func TestPruneKeepsConcurrentAppends(t *testing.T) {
+	dir := t.TempDir()
+	daemon, cli := Open(dir), Open(dir)
+	now := time.Now()
+	if err := daemon.Append(record("old", now.Add(-48*time.Hour)), record("kept", now)); err != nil {
+		t.Fatal(err)
+	}
+
+	appended := make(chan error, 1)
+	err := cli.locked(func() error {
+		records, err := cli.read()
+		if err != nil {
+			return err
+		}
+		go func() { appended <- daemon.Append(record("appended", time.Now())) }()
+		select {
+		case err := <-appended:
+			t.Errorf("Append did not wait for the prune: %v", err)
+			appended <- err
+		case <-time.After(100 * time.Millisecond):
+		}
+		return cli.rewrite(records[1:])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-appended; err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := cli.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range records {
+		paths = append(paths, r.Path)
+	}
+	if len(paths) != 2 || paths[0] != "kept" || paths[1] != "appended" {
+		t.Errorf("history after the prune = %v, want kept and appended", paths)
+	}
+}
+
+func TestPrunerPrunesHourly(t *testing.T) {
+	store := Open(t.TempDir())
+	pruner := NewPruner(store, 24*time.Hour, logging.New(io.Discard, logging.LevelDebug))
+	old := time.Now().Add(-48 * time.Hour)
+
+	if err := store.Append(record("first", old)); err != nil {
+		t.Fatal(err)
+	}
+	pruner.ScanFinished(nil)
+	if records, _ := store.Records(); len(records) != 0 {
+		t.Fatalf("records after the first scan = %+v, want none", records)
+	}
+
+	if err := store.Append(record("second", old)); err != nil {
+		t.Fatal(err)
+	}
+	pruner.ScanFinished(nil)
+	if records, _ := store.Records(); len(records) != 1 {
+		t.Errorf("got %d records after a scan within the hour, want the unpruned one", len(records))
+	}
+}
+
+func TestSince(t *testing.T) {
+	store := Open(t.TempDir())
+	now := time.Now()
+	if err := store.Append(record("a", now.Add(-2*time.Hour)), record("b", now.Add(-time.Hour)), record("c", now)); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.Since(now.Add(-90 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Path != "b" || records[1].Path != "c" {
+		t.Errorf("Since = %+v, want b and c", records)
+	}
+}
@@ -0,0 +1,227 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// IgnoreFileName is the name of the ignore list inside the state directory.
+const IgnoreFileName = "ignore.json"
+
+// IgnoreEntry is a file or directory that scans skip.
+type IgnoreEntry struct {
+	Path   string    `json:"path"`
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+	// Size and ModTime, when set, limit the entry to the file as it was when
+	// it was ignored, so a replaced file is processed again.
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// Exact reports whether e only matches the file with its recorded size and
+// modification time.
+func (e IgnoreEntry) Exact() bool {
+	return e.Size != 0 || !e.ModTime.IsZero()
+}
+
+// matches reports whether e covers the file at path, an absolute path.
+func (e *IgnoreEntry) matches(path string) bool {
+	if e.Exact() {
+		if path != e.Path {
+			return false
+		}
+		info, err := os.Stat(path)
+		return err == nil && info.Size() == e.Size && info.ModTime().Equal(e.ModTime)
+	}
+	return path == e.Path || strings.HasPrefix(path, e.Path+string(filepath.Separator))
+}
+
+// ignoreFile is the JSON document of the ignore list.
+type ignoreFile struct {
+	Entries []*IgnoreEntry `json:"entries"`
+	// Failures counts the permanent failures of files that are not ignored
+	// yet, for ignoring them automatically.
+	Failures map[string]int `json:"failures,omitempty"`
+}
+
+// IgnoreList is the persisted ignore list of a state directory. It
+// implements importer.IgnoreList, and as an importer.Observer it ignores files
+// automatically once they failed permanently AutoAfter times in a row. The CLI
+// may edit the list while a daemon uses it.
+type IgnoreList struct {
+	file      sharedFile[ignoreFile]
+	autoAfter int
+	log       *logging.Logger
+}
+
+// OpenIgnoreList loads the ignore list kept in the state directory dir. With
+// a positive autoAfter, files are ignored after that many permanent failures.
+func OpenIgnoreList(dir string, autoAfter int, log *logging.Logger) (*IgnoreList, error) {
+	l := &IgnoreList{file: sharedFile[ignoreFile]{path: filepath.Join(dir, IgnoreFileName)}, autoAfter: autoAfter, log: log}
+	if err := l.file.read(func(*ignoreFile) {}); err != nil {
+		return nil, fmt.Errorf("failed to read ignore list: %w", err)
+	}
+	return l, nil
+}
+
+// Ignored implements importer.IgnoreList.
+func (l *IgnoreList) Ignored(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	ignored := false
+	err = l.file.read(func(data *ignoreFile) {
+		for _, e := range data.Entries {
+			if e.matches(abs) {
+				ignored = true
+				return
+			}
+		}
+	})
+	if err != nil {
+		l.log.Errorf("Failed to read ignore list: %v", err)
+	}
+	return ignored
+}
+
+// Entries returns the ignored files and directories sorted by path.
+func (l *IgnoreList) Entries() ([]IgnoreEntry, error) {
+	var entries []IgnoreEntry
+	err := l.file.read(func(data *ignoreFile) {
+		for _, e := range data.Entries {
+			entries = append(entries, *e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// Add ignores path, which is made absolute. With exact the entry only holds
+// while the file keeps its current size and modification time. An existing
+// entry for path is replaced.
+func (l *IgnoreList) Add(path, reason string, exact bool) (IgnoreEntry, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return IgnoreEntry{}, err
+	}
+	entry := IgnoreEntry{Path: abs, Reason: reason, Added: time.Now()}
+	if exact {
+		info, err := os.Stat(abs)
+		if err != nil {
+			return IgnoreEntry{}, err
+		}
+		if info.IsDir() {
+			return IgnoreEntry{}, fmt.Errorf("%s is a directory, which cannot be ignored by size and modification time", abs)
+		}
+		entry.Size, entry.ModTime = info.Size(), info.ModTime()
+	}
+	err = l.file.update(func(data *ignoreFile) {
+		data.Entries = withoutPath(data.Entries, abs)
+		data.Entries = append(data.Entries, &entry)
+		delete(data.Failures, abs)
+	})
+	return entry, err
+}
+
+// Remove stops ignoring path. It reports whether path was ignored.
+func (l *IgnoreList) Remove(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	err = l.file.update(func(data *ignoreFile) {
+		before := len(data.Entries)
+		data.Entries = withoutPath(data.Entries, abs)
+		found = len(data.Entries) < before
+		delete(data.Failures, abs)
+	})
+	return found, err
+}
+
+// withoutPath removes the entries for path.
+func withoutPath(entries []*IgnoreEntry, path string) []*IgnoreEntry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Path != path {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// FileProcessed implements importer.Observer.
+func (l *IgnoreList) FileProcessed(f importer.FileResult) {
+	if l.autoAfter <= 0 || f.Action == importer.ActionDryRun {
+		return
+	}
+	abs, err := filepath.Abs(f.Path)
+	if err != nil {
+		return
+	}
+
+	var counted bool
+	l.file.read(func(data *ignoreFile) { _, counted = data.Failures[abs] })
+	// Files awaiting approval are the user's to reject, not the ignore list's,
+	// files that a run with -missing-only skipped did not fail, and files of
+	// a series whose root folder is not mounted import once it is, as do
+	// those of an invalid pin file or of duplicate library series and those
+	// that may not be read or moved once they are fixed
+	permanent := f.Action == importer.ActionFailed && !f.Transient() && f.Category != importer.CategoryAwaitingApproval &&
+		f.Category != importer.CategoryComplete && f.Category != importer.CategoryPathUnavailable &&
+		f.Category != importer.CategoryInvalidPin && f.Category != importer.CategoryDuplicateSeries &&
+		f.Category != importer.CategoryPermission && f.Category != importer.CategoryReadOnly
+	if !permanent && !counted {
+		return
+	}
+
+	err = l.file.update(func(data *ignoreFile) {
+		if !permanent {
+			delete(data.Failures, abs)
+			return
+		}
+		if data.Failures == nil {
+			data.Failures = make(map[string]int)
+		}
+		data.Failures[abs]++
+		if data.Failures[abs] < l.autoAfter {
+			return
+		}
+		delete(data.Failures, abs)
+		entry := &IgnoreEntry{
+			Path:   abs,
+			Reason: fmt.Sprintf("failed %d times: %s", l.autoAfter, f.Category),
+			Added:  time.Now(),
+		}
+		if info, err := os.Stat(abs); err == nil {
+			entry.Size, entry.ModTime = info.Size(), info.ModTime()
+		}
+		data.Entries = append(withoutPath(data.Entries, abs), entry)
+		l.log.Warnf("Ignoring %s from now on after %d failed attempts (%s)", filepath.Base(abs), l.autoAfter, f.Category)
+	})
+	if err != nil {
+		l.log.Errorf("Failed to save ignore list: %v", err)
+	}
+}
+
+// ScanFinished implements importer.Observer.
+func (l *IgnoreList) ScanFinished(*importer.ScanResult) {}
+
+// Len returns the number of ignored files and directories.
+func (l *IgnoreList) Len() int {
+	n := 0
+	l.file.read(func(data *ignoreFile) { n = len(data.Entries) })
+	return n
+}
@@ -0,0 +1,110 @@
+package history
+
+import (
+	"path/filepath"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// LookupMissesFileName is the name of the negative lookup cache inside the
+// state directory.
+const LookupMissesFileName = "lookup-misses.json"
+
+// LookupMiss records that the lookup of a title found no series.
+type LookupMiss struct {
+	Title string `json:"title"`
+	// Instance is the name of the Sonarr instance looked up.
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+	// Until is when the title is looked up again.
+	Until time.Time `json:"until"`
+}
+
+// LookupMisses is the persisted negative lookup cache. It implements
+// importer.LookupMisses and picks up changes made while a daemon runs, such
+// as the resolve command forgetting a title it maps.
+type LookupMisses struct {
+	file sharedFile[map[string]*LookupMiss]
+	log  *logging.Logger
+}
+
+// OpenLookupMisses returns the lookup misses kept in the state directory dir.
+func OpenLookupMisses(dir string, log *logging.Logger) *LookupMisses {
+	return &LookupMisses{file: sharedFile[map[string]*LookupMiss]{path: filepath.Join(dir, LookupMissesFileName)}, log: log}
+}
+
+// lookupMissKey is the key of title on instance.
+func lookupMissKey(instance, title string) string {
+	return instance + "\x00" + titleKey(title)
+}
+
+// Missed implements importer.LookupMisses.
+func (l *LookupMisses) Missed(instance, title string) (at, until time.Time, ok bool) {
+	err := l.file.read(func(data *map[string]*LookupMiss) {
+		if m := (*data)[lookupMissKey(instance, title)]; m != nil && time.Now().Before(m.Until) {
+			at, until, ok = m.Time, m.Until, true
+		}
+	})
+	if err != nil {
+		l.log.Errorf("Failed to read lookup misses: %v", err)
+	}
+	return at, until, ok
+}
+
+// Miss implements importer.LookupMisses. Expired misses are dropped.
+func (l *LookupMisses) Miss(instance, title string, ttl time.Duration) {
+	now := time.Now()
+	err := l.file.update(func(data *map[string]*LookupMiss) {
+		if *data == nil {
+			*data = make(map[string]*LookupMiss)
+		}
+		for key, m := range *data {
+			if !now.Before(m.Until) {
+				delete(*data, key)
+			}
+		}
+		(*data)[lookupMissKey(instance, title)] = &LookupMiss{Title: title, Instance: instance, Time: now, Until: now.Add(ttl)}
+	})
+	if err != nil {
+		l.log.Errorf("Failed to save lookup misses: %v", err)
+	}
+}
+
+// Forget drops the misses of title on every instance, so its next file is
+// looked up again.
+func (l *LookupMisses) Forget(title string) error {
+	var known bool
+	l.file.read(func(data *map[string]*LookupMiss) {
+		for _, m := range *data {
+			known = known || titleKey(m.Title) == titleKey(title)
+		}
+	})
+	if !known {
+		return nil
+	}
+	return l.file.update(func(data *map[string]*LookupMiss) {
+		for key, m := range *data {
+			if titleKey(m.Title) == titleKey(title) {
+				delete(*data, key)
+			}
+		}
+	})
+}
+
+// Clear drops every miss.
+func (l *LookupMisses) Clear() error {
+	var empty bool
+	l.file.read(func(data *map[string]*LookupMiss) { empty = len(*data) == 0 })
+	if empty {
+		return nil
+	}
+	return l.file.update(func(data *map[string]*LookupMiss) { *data = nil })
+}
+
+// Len returns the number of misses, including expired ones.
+func (l *LookupMisses) Len() int {
+	n := 0
+	l.file.read(func(data *map[string]*LookupMiss) { n = len(*data) })
+	return n
+}
@@ -0,0 +1,236 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// RetryFileName is the name of the retry queue inside the state directory.
+const RetryFileName = "retry.json"
+
+// RetryEntry is a file of the retry queue.
+type RetryEntry struct {
+	Path        string                 `json:"path"`
+	Attempts    int                    `json:"attempts"`
+	Category    importer.ErrorCategory `json:"category"`
+	Error       string                 `json:"error"`
+	FirstFailed time.Time              `json:"firstFailed"`
+	LastFailed  time.Time              `json:"lastFailed"`
+	NextAttempt time.Time              `json:"nextAttempt"`
+	// GaveUp is set once the file failed MaxAttempts times. It is no longer
+	// retried until the queue is forced.
+	GaveUp bool `json:"gaveUp,omitempty"`
+}
+
+// RetryPolicy tells how often and how soon a file is retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	// Delay is the wait after the first failure, doubled after every further
+	// failure up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// MetadataDelay replaces Delay for files whose episode is not listed
+	// yet, which takes longer to change than a failure of Sonarr.
+	MetadataDelay time.Duration
+}
+
+// delay returns the wait after the given number of failed attempts, the
+// last of which failed with category.
+func (p RetryPolicy) delay(attempts int, category importer.ErrorCategory) time.Duration {
+	delay, maxDelay := p.Delay, p.MaxDelay
+	if category == importer.CategoryAwaitingMetadata && p.MetadataDelay > 0 {
+		delay, maxDelay = p.MetadataDelay, max(p.MetadataDelay, p.MaxDelay)
+	}
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Queue is the persisted retry queue of a state directory. It implements
+// importer.RetryQueue and importer.Observer: transient failures are queued
+// with an exponential delay, and files that were imported or failed for a
+// reason a retry cannot fix leave the queue.
+type Queue struct {
+	path   string
+	policy RetryPolicy
+	log    *logging.Logger
+
+	mu      sync.Mutex
+	entries map[string]*RetryEntry
+}
+
+// OpenQueue loads the retry queue kept in the state directory dir.
+func OpenQueue(dir string, policy RetryPolicy, log *logging.Logger) (*Queue, error) {
+	q := &Queue{
+		path:    filepath.Join(dir, RetryFileName),
+		policy:  policy,
+		log:     log,
+		entries: make(map[string]*RetryEntry),
+	}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+	var entries []*RetryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read retry queue %s: %w", q.path, err)
+	}
+	for _, e := range entries {
+		q.entries[e.Path] = e
+	}
+	return q, nil
+}
+
+// Due implements importer.RetryQueue.
+func (q *Queue) Due(path string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[path]
+	return !ok || !e.GaveUp && !time.Now().Before(e.NextAttempt)
+}
+
+// Len implements importer.RetryQueue. Files that were given up on are not
+// counted.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, e := range q.entries {
+		if !e.GaveUp {
+			n++
+		}
+	}
+	return n
+}
+
+// Count implements importer.RetryQueue.
+func (q *Queue) Count(category importer.ErrorCategory) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, e := range q.entries {
+		if !e.GaveUp && e.Category == category {
+			n++
+		}
+	}
+	return n
+}
+
+// Entries returns the queued files, the next to be retried first.
+func (q *Queue) Entries() []RetryEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := make([]RetryEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].GaveUp != entries[j].GaveUp {
+			return !entries[i].GaveUp
+		}
+		return entries[i].NextAttempt.Before(entries[j].NextAttempt)
+	})
+	return entries
+}
+
+// Force makes every queued file due now, including those given up on, and
+// returns their paths.
+func (q *Queue) Force() ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	paths := make([]string, 0, len(q.entries))
+	for _, e := range q.entries {
+		e.NextAttempt = time.Time{}
+		e.GaveUp = false
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+	return paths, q.save()
+}
+
+// FileProcessed implements importer.Observer.
+func (q *Queue) FileProcessed(f importer.FileResult) {
+	if f.Action == importer.ActionDryRun {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, queued := q.entries[f.Path]
+	switch {
+	case f.Action != importer.ActionFailed:
+		if !queued {
+			return
+		}
+		delete(q.entries, f.Path)
+	// Sonarr can take a while to refresh a new series, so a queued file
+	// keeps waiting for its episode
+	case !f.Transient() && !(queued && f.Category == importer.CategoryEpisodeNotFound):
+		if !queued {
+			return
+		}
+		delete(q.entries, f.Path)
+	default:
+		now := time.Now()
+		if !queued {
+			e = &RetryEntry{Path: f.Path, FirstFailed: now}
+			q.entries[f.Path] = e
+		}
+		e.Attempts++
+		e.Category, e.Error, e.LastFailed = f.Category, f.Error, now
+		e.NextAttempt = now.Add(q.policy.delay(e.Attempts, f.Category))
+		name := filepath.Base(f.Path)
+		if e.Attempts >= q.policy.MaxAttempts {
+			e.GaveUp = true
+			q.log.Warnf("Giving up on %s after %d failed attempt(s)", name, e.Attempts)
+		} else {
+			q.log.Infof("Will retry %s in %v (attempt %d of %d)", name, e.NextAttempt.Sub(now).Round(time.Second), e.Attempts+1, q.policy.MaxAttempts)
+		}
+	}
+	if err := q.save(); err != nil {
+		q.log.Errorf("Failed to save retry queue: %v", err)
+	}
+}
+
+// ScanFinished implements importer.Observer. Files that disappeared, such as
+// ones imported by hand, leave the queue.
+func (q *Queue) ScanFinished(*importer.ScanResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed := false
+	for path := range q.entries {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(q.entries, path)
+			removed = true
+		}
+	}
+	if !removed {
+		return
+	}
+	if err := q.save(); err != nil {
+		q.log.Errorf("Failed to save retry queue: %v", err)
+	}
+}
+
+// save writes the queue. The caller holds q.mu.
+func (q *Queue) save() error {
+	entries := make([]*RetryEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return writeJSON(q.path, entries)
+}
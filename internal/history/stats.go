@@ -0,0 +1,183 @@
+package history
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/metrics"
+)
+
+// StatsFileName is the name of the per-series statistics inside the state
+// directory.
+const StatsFileName = "stats.json"
+
+// SeriesStats are the counters of one series across runs.
+type SeriesStats struct {
+	SeriesID int `json:"seriesId"`
+	// Instance names the Sonarr instance of the series unless it is the
+	// default one.
+	Instance string `json:"instance,omitempty"`
+	// Title is the title Sonarr last reported, so a renamed series keeps
+	// its counters.
+	Title    string `json:"title"`
+	Imports  int    `json:"imports"`
+	Upgrades int    `json:"upgrades"`
+	Failures int    `json:"failures"`
+	// Bytes is the total size of the imported files.
+	Bytes int64 `json:"bytes"`
+	// WaitSeconds sums, over the WaitCount imports whose modification time
+	// is known, the time from the file appearing to its import.
+	WaitSeconds float64   `json:"waitSeconds"`
+	WaitCount   int       `json:"waitCount"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastImport  time.Time `json:"lastImport"`
+	LastFailure time.Time `json:"lastFailure"`
+}
+
+// FailureRate is the share of the attempts of the series that failed.
+func (s SeriesStats) FailureRate() float64 {
+	if s.Imports+s.Failures == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Imports+s.Failures)
+}
+
+// AverageWait is the average time from a file appearing to its import.
+func (s SeriesStats) AverageWait() time.Duration {
+	if s.WaitCount == 0 {
+		return 0
+	}
+	return time.Duration(s.WaitSeconds / float64(s.WaitCount) * float64(time.Second))
+}
+
+// Stats accumulates the counters of every series files were processed for.
+// It implements importer.Observer. Series are keyed by their Sonarr ID, and
+// files that never got as far as a series, such as movies and files that did
+// not parse, are not counted.
+type Stats struct {
+	file sharedFile[map[string]*SeriesStats]
+	log  *logging.Logger
+}
+
+// OpenStats returns the statistics kept in the state directory dir.
+func OpenStats(dir string, log *logging.Logger) *Stats {
+	return &Stats{file: sharedFile[map[string]*SeriesStats]{path: filepath.Join(dir, StatsFileName)}, log: log}
+}
+
+// statsInstance returns the instance recorded for a file routed to instance.
+func statsInstance(instance string) string {
+	if instance == config.DefaultInstance {
+		return ""
+	}
+	return instance
+}
+
+// statsKey is the key of a series of instance, as statsInstance returns it.
+func statsKey(instance string, seriesID int) string {
+	if instance == "" {
+		return strconv.Itoa(seriesID)
+	}
+	return instance + ":" + strconv.Itoa(seriesID)
+}
+
+// Series returns the statistics of every series, in no particular order.
+func (s *Stats) Series() ([]SeriesStats, error) {
+	var series []SeriesStats
+	err := s.file.read(func(data *map[string]*SeriesStats) {
+		for _, st := range *data {
+			series = append(series, *st)
+		}
+	})
+	return series, err
+}
+
+// FileProcessed implements importer.Observer.
+func (s *Stats) FileProcessed(f importer.FileResult) {
+	if f.SeriesID == 0 || f.Action == importer.ActionDryRun {
+		return
+	}
+	now := time.Now()
+	err := s.file.update(func(data *map[string]*SeriesStats) {
+		if *data == nil {
+			*data = make(map[string]*SeriesStats)
+		}
+		instance := statsInstance(f.Instance)
+		key := statsKey(instance, f.SeriesID)
+		st, ok := (*data)[key]
+		if !ok {
+			st = &SeriesStats{SeriesID: f.SeriesID, Instance: instance, FirstSeen: now}
+			(*data)[key] = st
+		}
+		if f.SeriesTitle != "" {
+			st.Title = f.SeriesTitle
+		}
+		if f.Action == importer.ActionFailed {
+			st.Failures++
+			st.LastFailure = now
+			return
+		}
+		st.Imports++
+		st.LastImport = now
+		st.Bytes += f.Size
+		if f.Upgrade {
+			st.Upgrades++
+		}
+		if f.Latency > 0 {
+			st.WaitSeconds += f.Latency.Seconds()
+			st.WaitCount++
+		}
+	})
+	if err != nil {
+		s.log.Errorf("Failed to save series statistics: %v", err)
+	}
+}
+
+// ScanFinished implements importer.Observer.
+func (s *Stats) ScanFinished(*importer.ScanResult) {}
+
+// WriteMetrics writes the counters of every series as metrics labelled with
+// the series ID, instance and title.
+func (s *Stats) WriteMetrics(w *metrics.Writer) {
+	series, err := s.Series()
+	if err != nil {
+		s.log.Warnf("Failed to read series statistics: %v", err)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Instance != series[j].Instance {
+			return series[i].Instance < series[j].Instance
+		}
+		return series[i].SeriesID < series[j].SeriesID
+	})
+
+	families := []struct {
+		name, help string
+		typ        metrics.Type
+		value      func(SeriesStats) float64
+	}{
+		{"sonarr_autoimport_series_imports_total", "Files imported into the series.", metrics.Counter,
+			func(st SeriesStats) float64 { return float64(st.Imports) }},
+		{"sonarr_autoimport_series_upgrades_total", "Imports that replaced an existing episode file of the series.", metrics.Counter,
+			func(st SeriesStats) float64 { return float64(st.Upgrades) }},
+		{"sonarr_autoimport_series_failures_total", "Files of the series that failed to import.", metrics.Counter,
+			func(st SeriesStats) float64 { return float64(st.Failures) }},
+		{"sonarr_autoimport_series_bytes_total", "Total size of the files imported into the series.", metrics.Counter,
+			func(st SeriesStats) float64 { return float64(st.Bytes) }},
+		{"sonarr_autoimport_series_wait_seconds", "Average time from a file of the series appearing to its import.", metrics.Gauge,
+			func(st SeriesStats) float64 { return st.AverageWait().Seconds() }},
+	}
+	for _, fam := range families {
+		w.Family(fam.name, fam.help, fam.typ)
+		for _, st := range series {
+			labels := metrics.Labels{"series_id": strconv.Itoa(st.SeriesID), "title": st.Title}
+			if st.Instance != "" {
+				labels["instance"] = st.Instance
+			}
+			w.Sample(fam.name, labels, fam.value(st))
+		}
+	}
+}
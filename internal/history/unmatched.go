@@ -0,0 +1,228 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+// UnmatchedFileName is the name of the unmatched titles inside the state
+// directory.
+const UnmatchedFileName = "unmatched.json"
+
+// Candidate is a lookup result offered for an unmatched title.
+type Candidate struct {
+	Title  string `json:"title"`
+	Year   int    `json:"year,omitempty"`
+	TvdbID int    `json:"tvdbId"`
+}
+
+// UnmatchedTitle is a parsed title no series was found for, with the files
+// that carry it.
+type UnmatchedTitle struct {
+	Title     string    `json:"title"`
+	Files     []string  `json:"files"`
+	Error     string    `json:"error,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Candidates are the lookup results last shown by the resolve command.
+	Candidates []Candidate `json:"candidates,omitempty"`
+	// Pending is the new series the files wait for while
+	// sonarr.confirmNewSeries is set, until the approve command approves or
+	// rejects it.
+	Pending *Candidate `json:"pending,omitempty"`
+}
+
+// Unmatched collects the titles of the files that failed because no series
+// matched, across runs. It implements importer.Observer: files leave it once
+// they are imported or disappear.
+type Unmatched struct {
+	file sharedFile[map[string]*UnmatchedTitle]
+	log  *logging.Logger
+	// OnPending, when set, is called with the file result that made a new
+	// series wait for approval, once per title and series.
+	OnPending func(f importer.FileResult)
+}
+
+// OpenUnmatched returns the unmatched titles kept in the state directory dir.
+func OpenUnmatched(dir string, log *logging.Logger) *Unmatched {
+	return &Unmatched{file: sharedFile[map[string]*UnmatchedTitle]{path: filepath.Join(dir, UnmatchedFileName)}, log: log}
+}
+
+// titleKey is the key of title, which is matched in the form of
+// parser.NormalizeTitle.
+func titleKey(title string) string {
+	return parser.NormalizeTitle(title)
+}
+
+// Titles returns the unmatched titles, the most recently seen first.
+func (u *Unmatched) Titles() ([]UnmatchedTitle, error) {
+	var titles []UnmatchedTitle
+	err := u.file.read(func(data *map[string]*UnmatchedTitle) {
+		for _, t := range *data {
+			titles = append(titles, *t)
+		}
+	})
+	sort.Slice(titles, func(i, j int) bool { return titles[i].LastSeen.After(titles[j].LastSeen) })
+	return titles, err
+}
+
+// Get returns the unmatched title equal to title ignoring case.
+func (u *Unmatched) Get(title string) (UnmatchedTitle, bool, error) {
+	var found *UnmatchedTitle
+	err := u.file.read(func(data *map[string]*UnmatchedTitle) {
+		if t, ok := (*data)[titleKey(title)]; ok {
+			cp := *t
+			found = &cp
+		}
+	})
+	if found == nil {
+		return UnmatchedTitle{}, false, err
+	}
+	return *found, true, err
+}
+
+// SetCandidates records the lookup results shown for title.
+func (u *Unmatched) SetCandidates(title string, candidates []Candidate) error {
+	return u.file.update(func(data *map[string]*UnmatchedTitle) {
+		if t, ok := (*data)[titleKey(title)]; ok {
+			t.Candidates = candidates
+		}
+	})
+}
+
+// Pending returns the titles whose new series waits for approval, the most
+// recently seen first.
+func (u *Unmatched) Pending() ([]UnmatchedTitle, error) {
+	titles, err := u.Titles()
+	pending := titles[:0]
+	for _, t := range titles {
+		if t.Pending != nil {
+			pending = append(pending, t)
+		}
+	}
+	return pending, err
+}
+
+// Remove forgets title.
+func (u *Unmatched) Remove(title string) error {
+	return u.file.update(func(data *map[string]*UnmatchedTitle) {
+		delete(*data, titleKey(title))
+	})
+}
+
+// FileProcessed implements importer.Observer.
+func (u *Unmatched) FileProcessed(f importer.FileResult) {
+	if f.Action == importer.ActionDryRun || f.Parsed == nil {
+		return
+	}
+	key := titleKey(f.Parsed.Title)
+	unmatched := f.Category == importer.CategorySeriesNotFound || f.Category == importer.CategoryLookupCached ||
+		f.Category == importer.CategoryAwaitingApproval
+
+	var known bool
+	u.file.read(func(data *map[string]*UnmatchedTitle) { _, known = (*data)[key] })
+	if !unmatched && !known {
+		return
+	}
+
+	var newlyPending bool
+	err := u.file.update(func(data *map[string]*UnmatchedTitle) {
+		if *data == nil {
+			*data = make(map[string]*UnmatchedTitle)
+		}
+		t, ok := (*data)[key]
+		if !unmatched {
+			if ok {
+				t.Files = removePath(t.Files, f.Path)
+				if len(t.Files) == 0 {
+					delete(*data, key)
+				}
+			}
+			return
+		}
+		now := time.Now()
+		if !ok {
+			t = &UnmatchedTitle{Title: f.Parsed.Title, FirstSeen: now}
+			(*data)[key] = t
+		}
+		t.LastSeen, t.Error = now, f.Error
+		var pending *Candidate
+		if p := f.PendingSeries; p != nil {
+			pending = &Candidate{Title: p.Title, Year: p.Year, TvdbID: p.TvdbID}
+		}
+		newlyPending = pending != nil && (t.Pending == nil || *t.Pending != *pending)
+		t.Pending = pending
+		if !contains(t.Files, f.Path) {
+			t.Files = append(t.Files, f.Path)
+			sort.Strings(t.Files)
+		}
+	})
+	if err != nil {
+		u.log.Errorf("Failed to save unmatched titles: %v", err)
+		return
+	}
+	if newlyPending && u.OnPending != nil {
+		u.OnPending(f)
+	}
+}
+
+// ScanFinished implements importer.Observer. Files that disappeared leave
+// their title, and titles without files are forgotten.
+func (u *Unmatched) ScanFinished(*importer.ScanResult) {
+	var gone bool
+	u.file.read(func(data *map[string]*UnmatchedTitle) {
+		for _, t := range *data {
+			for _, path := range t.Files {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					gone = true
+					return
+				}
+			}
+		}
+	})
+	if !gone {
+		return
+	}
+	err := u.file.update(func(data *map[string]*UnmatchedTitle) {
+		for key, t := range *data {
+			kept := t.Files[:0]
+			for _, path := range t.Files {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					kept = append(kept, path)
+				}
+			}
+			t.Files = kept
+			if len(kept) == 0 {
+				delete(*data, key)
+			}
+		}
+	})
+	if err != nil {
+		u.log.Errorf("Failed to save unmatched titles: %v", err)
+	}
+}
+
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func removePath(paths []string, path string) []string {
+	kept := paths[:0]
+	for _, p := range paths {
+		if p != path {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// newSeriesPath returns the path in Sonarr that the series of option is
+// added at. With sonarr.adoptExistingFolders it is the unmapped folder of
+// the root folder whose name matches the title of option, with or without
+// its year, or its slug once normalized, so a series organized by hand is
+// not given a second folder. Otherwise, and when no folder or several match,
+// it is the folder named after the slug. A root folder that cannot be read
+// is logged and falls back to the slug too.
+func (im *Importer) newSeriesPath(ctx context.Context, inst *Instance, option sonarr.SeriesLookup) string {
+	path := inst.Config.SeriesPath(option.TitleSlug)
+	if !inst.Config.AdoptExistingFolders {
+		return path
+	}
+	folders, err := im.unmappedFolders(ctx, inst)
+	if err != nil {
+		im.Logger.Warnf("Adding %s at %s, failed to look for an existing folder: %v", option.Title, path, err)
+		return path
+	}
+
+	names := []string{option.Title, option.TitleSlug}
+	if option.Year > 0 {
+		names = append(names, option.Title+" "+strconv.Itoa(option.Year))
+	}
+	var matches []sonarr.UnmappedFolder
+	for _, f := range folders {
+		key := parser.NormalizeTitle(f.Name)
+		for _, name := range names {
+			if key != "" && key == parser.NormalizeTitle(name) {
+				matches = append(matches, f)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		im.Logger.Debugf("No unmapped folder of %s matches %s, adding it at %s", inst.Config.RootFolder, option.Title, path)
+		return path
+	case 1:
+		adopted := matches[0].Path
+		if adopted == "" {
+			adopted = inst.Config.SeriesPath(matches[0].Name)
+		}
+		im.Logger.Infof("Adopting the existing folder %s for %s", adopted, option.Title)
+		return adopted
+	}
+	im.Logger.Warnf("Adding %s at %s, %d unmapped folders of %s match it: %s and %s", option.Title, path, len(matches), inst.Config.RootFolder, matches[0].Name, matches[1].Name)
+	return path
+}
+
+// unmappedFolders returns the folders of the root folder of inst that no
+// series uses.
+func (im *Importer) unmappedFolders(ctx context.Context, inst *Instance) ([]sonarr.UnmappedFolder, error) {
+	folders, err := inst.Client.RootFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range folders {
+		if !config.HasRemotePrefix(f.Path, inst.Config.RootFolder) || !config.HasRemotePrefix(inst.Config.RootFolder, f.Path) {
+			continue
+		}
+		// Sonarr v4 only lists the unmapped folders of a single root folder
+		folder, err := inst.Client.RootFolder(ctx, f.ID)
+		if err != nil {
+			return nil, err
+		}
+		return folder.UnmappedFolders, nil
+	}
+	return nil, fmt.Errorf("no root folder %s in Sonarr", inst.Config.RootFolder)
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"fmt"
+	"time"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// APIUsage is the load that scans put on Sonarr, across its instances.
+type APIUsage struct {
+	sonarr.Usage
+	// LookupCacheHits is the number of lookups sonarr.lookupCache saved.
+	LookupCacheHits int `json:"lookupCacheHits,omitempty"`
+}
+
+// Add adds the usage of o to u.
+func (u *APIUsage) Add(o APIUsage) {
+	u.Usage.Add(o.Usage)
+	u.LookupCacheHits += o.LookupCacheHits
+}
+
+// LookupCacheRate returns the share of the title lookups that the lookup
+// cache answered, or 0 without any lookup.
+func (u APIUsage) LookupCacheRate() float64 {
+	lookups := u.Endpoints[sonarr.EndpointLookup].Requests + u.LookupCacheHits
+	if lookups == 0 {
+		return 0
+	}
+	return float64(u.LookupCacheHits) / float64(lookups)
+}
+
+// Summary describes u in a line such as "37 request(s), 2 lookup(s), 1
+// series added, 3.1s total".
+func (u APIUsage) Summary() string {
+	s := fmt.Sprintf("%d request(s)", u.Requests)
+	if n := u.Endpoints[sonarr.EndpointLookup].Requests; n > 0 {
+		s += fmt.Sprintf(", %d lookup(s)", n)
+	}
+	if u.LookupCacheHits > 0 {
+		s += fmt.Sprintf(", %d cached lookup(s) (%.0f%%)", u.LookupCacheHits, 100*u.LookupCacheRate())
+	}
+	if n := u.Endpoints[sonarr.EndpointAddSeries].Requests; n > 0 {
+		s += fmt.Sprintf(", %d series added", n)
+	}
+	if u.Errors > 0 {
+		s += fmt.Sprintf(", %d failed", u.Errors)
+	}
+	total := u.Latency.Round(time.Millisecond)
+	if total >= time.Second {
+		total = u.Latency.Round(100 * time.Millisecond)
+	}
+	return s + fmt.Sprintf(", %v total", total)
+}
+
+// apiUsage returns what the importer asked of its Sonarr instances so far.
+// Instances sharing a client count once.
+func (im *Importer) apiUsage() APIUsage {
+	usage := APIUsage{LookupCacheHits: int(im.lookupCacheHits.Load())}
+	seen := make(map[*sonarr.Client]bool)
+	for _, inst := range im.instances {
+		if inst.Client == nil || seen[inst.Client] {
+			continue
+		}
+		seen[inst.Client] = true
+		usage.Usage.Add(inst.Client.Usage())
+	}
+	return usage
+}
+
+// usageSince returns the usage of the importer after before, or nil when
+// Sonarr was not asked anything.
+func (im *Importer) usageSince(before APIUsage) *APIUsage {
+	now := im.apiUsage()
+	usage := APIUsage{Usage: now.Usage.Since(before.Usage), LookupCacheHits: now.LookupCacheHits - before.LookupCacheHits}
+	if usage.Requests == 0 && usage.LookupCacheHits == 0 {
+		return nil
+	}
+	return &usage
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/parser"
+)
+
+// courToken matches a title in the form of parser.NormalizeTitle that ends
+// with the number of a cour, as in "part 2", "cour 2" or "2nd cour".
+var courToken = regexp.MustCompile(`^(.+) (?:(?:part|cour) (\d+)|(\d+)(?:st|nd|rd|th) cour)$`)
+
+// renumberCour renumbers the episodes of anime by the cours of the series
+// rule of its title and returns how, or "" when no cour applies. A token
+// after the title that names a cour wins over the episode falling into the
+// range of another one, and removing the token leaves the title of the
+// series rule.
+func (im *Importer) renumberCour(anime *parser.ParsedAnime) string {
+	rule, cour := im.courOf(anime.Title)
+	token := cour != nil
+	if !token {
+		if rule = im.Config.SeriesRule(anime.Title); rule == nil || !anime.DefaultSeason {
+			// A season in the name numbers the episode as Sonarr does
+			return ""
+		}
+		if cour = courRange(rule.Cours, anime.Episode); cour == nil {
+			return ""
+		}
+	}
+
+	episode := anime.Episode
+	var how string
+	if from := cour.From; from > 0 && episode >= from && episode <= cour.To {
+		// The episode continues the numbering of the earlier cours
+		anime.Episode = cour.Start + episode - from
+		how = fmt.Sprintf("%s numbers episodes %d-%d from S%02dE%02d: %d + %d - %d",
+			cour.Label(), from, cour.To, cour.Season, cour.Start, cour.Start, episode, from)
+	} else {
+		anime.Episode = cour.Start + episode - 1
+		how = fmt.Sprintf("%s starts at S%02dE%02d: %d + %d - 1", cour.Label(), cour.Season, cour.Start, cour.Start, episode)
+	}
+	if anime.EndEpisode > 0 {
+		anime.EndEpisode += anime.Episode - episode
+	}
+	anime.Season = cour.Season
+	anime.DefaultSeason = false
+	anime.Title = rule.Title
+
+	from := "episode " + strconv.Itoa(episode)
+	if token {
+		from = cour.Label() + " " + from
+		if other := courRange(rule.Cours, episode); other != nil && other != cour {
+			how += fmt.Sprintf(", the token wins over the episodes %d-%d of %s", other.From, other.To, other.Label())
+		}
+	}
+	return fmt.Sprintf("%s is %s (%s)", from, anime.Label(), how)
+}
+
+// courOf returns the series rule and the cour that a token at the end of
+// title names, with nil for the cour when there is none.
+func (im *Importer) courOf(title string) (*config.SeriesRule, *config.CourRule) {
+	if im.Config.Rules == nil {
+		return nil, nil
+	}
+	key := parser.NormalizeTitle(title)
+	for i := range im.Config.Rules.Series {
+		rule := &im.Config.Rules.Series[i]
+		base := parser.NormalizeTitle(rule.Title)
+		for j, cour := range rule.Cours {
+			if name := parser.NormalizeTitle(cour.Name); name != "" && key == base+" "+name {
+				return rule, &rule.Cours[j]
+			}
+		}
+	}
+
+	m := courToken.FindStringSubmatch(key)
+	if m == nil {
+		return nil, nil
+	}
+	rule := im.Config.SeriesRule(m[1])
+	if rule == nil {
+		return nil, nil
+	}
+	number, _ := strconv.Atoi(m[2] + m[3])
+	for i, cour := range rule.Cours {
+		if cour.Number == number {
+			return rule, &rule.Cours[i]
+		}
+	}
+	return nil, nil
+}
+
+// courRange returns the one of cours whose range has episode, or nil.
+func courRange(cours []config.CourRule, episode int) *config.CourRule {
+	for i, cour := range cours {
+		if cour.From > 0 && episode >= cour.From && episode <= cour.To {
+			return &cours[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// courRules split the 24 episodes of Show into a first cour of 12 in season
+// 1, a second cour that is season 2 and a "Final Part" that continues it.
+var courRules = &config.Rules{Series: []config.SeriesRule{{
+	Title: "Show",
+	Cours: []config.CourRule{
+		{Number: 2, Season: 2, Start: 1, From: 13, To: 24},
+		{Number: 3, Name: "Final Part", Season: 2, Start: 13, From: 25, To: 36},
+	},
+}}}
+
+func TestRenumberCour(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	im := newTestImporter(t, srv, Options{})
+	im.Config.Rules = courRules
+
+	tests := []struct {
+		name  string
+		label string
+		how   string
+	}{
+		// The same episode with and without the token
+		{"[ASW] Show Part 2 - 02 [1080p].mkv", "S02E02", "cour 2 episode 2 is S02E02 (cour 2 starts at S02E01: 1 + 2 - 1)"},
+		{"[ASW] Show - 14 [1080p].mkv", "S02E02", "episode 14 is S02E02 (cour 2 numbers episodes 13-24 from S02E01: 1 + 14 - 13)"},
+		{"[ASW] Show 2nd Cour - 02 [1080p].mkv", "S02E02", "cour 2 episode 2 is S02E02 (cour 2 starts at S02E01: 1 + 2 - 1)"},
+		{"[ASW] Show Cour 2 - 14 [1080p].mkv", "S02E02", "cour 2 episode 14 is S02E02 (cour 2 numbers episodes 13-24 from S02E01: 1 + 14 - 13)"},
+
+		// A named cour, with and without its name
+		{"[ASW] Show Final Part - 01 [1080p].mkv", "S02E13", "Final Part episode 1 is S02E13 (Final Part starts at S02E13: 13 + 1 - 1)"},
+		{"[ASW] Show - 26 [1080p].mkv", "S02E14", "episode 26 is S02E14 (Final Part numbers episodes 25-36 from S02E13: 13 + 26 - 25)"},
+
+		// The token wins over the range of another cour
+		{"[ASW] Show Part 3 - 14 [1080p].mkv", "S02E26",
+			"Final Part episode 14 is S02E26 (Final Part starts at S02E13: 13 + 14 - 1, the token wins over the episodes 13-24 of cour 2)"},
+
+		{"[ASW] Show - 13-14 [1080p].mkv", "S02E01-E02", "episode 13 is S02E01-E02 (cour 2 numbers episodes 13-24 from S02E01: 1 + 13 - 13)"},
+
+		// Nothing to renumber
+		{"[ASW] Show - 05 [1080p].mkv", "S01E05", ""},
+		{"Show S01E14 [1080p].mkv", "S01E14", ""},
+		{"[ASW] Show Part 5 - 01 [1080p].mkv", "S01E01", ""},
+		{"[ASW] Other Show - 14 [1080p].mkv", "S01E14", ""},
+	}
+	for _, tt := range tests {
+		anime, err := im.Parser.Parse(tt.name)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.name, err)
+		}
+		title := anime.Title
+		how := im.renumberCour(anime)
+		if anime.Label() != tt.label || how != tt.how {
+			t.Errorf("%s: %s, %q; want %s, %q", tt.name, anime.Label(), how, tt.label, tt.how)
+		}
+		if tt.how != "" && anime.Title != "Show" {
+			t.Errorf("%s: title %q after renumbering, want that of the series rule", tt.name, anime.Title)
+		}
+		if tt.how == "" && anime.Title != title {
+			t.Errorf("%s: title changed to %q without renumbering", tt.name, anime.Title)
+		}
+	}
+}
+
+func TestCourScan(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	eps := append(seasonOf(1, 12, 12), seasonOf(2, 24, 0)...)
+	series := srv.AddSeries(sonarr.Series{Title: "Show", TvdbID: 1, Path: "/tv/Show", Monitored: true}, eps...)
+	files := []string{"[ASW] Show Part 2 - 03 [1080p].mkv", "[ASW] Show - 15 [1080p].mkv"}
+
+	// The dry run shows the math
+	dry := newTestImporter(t, srv, Options{DryRun: true})
+	dry.Client.SetReadOnly()
+	dry.Config.Rules = courRules
+	addFiles(t, dry, files...)
+	result := scan(t, dry)
+	for _, name := range files {
+		f := fileResult(t, result, name)
+		if f.Plan == nil || f.Plan.Renumbered == "" || f.Plan.Season != 2 || f.Plan.Episode != 3 {
+			t.Errorf("%s: plan %+v, %v; want S02E03 with the renumbering", name, f.Plan, f.Err)
+		}
+	}
+
+	im := newTestImporter(t, srv, Options{})
+	im.Config.Rules = courRules
+	addFiles(t, im, files...)
+	result = scan(t, im)
+	listed, err := im.Client.GetEpisodes(context.Background(), series.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want int
+	for _, e := range listed {
+		if e.SeasonNumber == 2 && e.EpisodeNumber == 3 {
+			want = e.ID
+		}
+	}
+	for _, name := range files {
+		if f := fileResult(t, result, name); f.Action != ActionImported || f.EpisodeID != want {
+			t.Errorf("%s: %s to episode %d, %v; want an import to S02E03 (%d)", name, f.Action, f.EpisodeID, f.Err, want)
+		}
+	}
+}
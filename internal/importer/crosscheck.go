@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// importPreviews holds, for one scan, Sonarr's manual import preview of the
+// downloads folder for each instance. Every instance's preview is read once,
+// the first time a file needs it. A failed read is logged and leaves the
+// files of that instance unchecked.
+type importPreviews struct {
+	mu        sync.Mutex
+	instances map[string]*importPreview
+}
+
+// importPreview is the preview of one instance, by path and by file name.
+type importPreview struct {
+	mu     sync.Mutex
+	loaded bool
+	paths  map[string]*sonarr.ManualImportItem
+	names  map[string][]*sonarr.ManualImportItem
+}
+
+func newImportPreviews() *importPreviews {
+	return &importPreviews{instances: make(map[string]*importPreview)}
+}
+
+// crossCheck records in result how Sonarr's manual import preview reads its
+// file differently, logging each disagreement, or adding it to the plan of
+// a dry run. It does nothing unless Options.CrossCheck is set. It must run
+// before the file is imported, as the preview lists the files that are in
+// the downloads folder when the first file of the scan needs it.
+func (im *Importer) crossCheck(ctx context.Context, previews *importPreviews, inst *Instance, result *FileResult) {
+	if !im.Options.CrossCheck || previews == nil {
+		return
+	}
+	item, ok := im.previewItem(ctx, previews, inst, result)
+	if !ok {
+		return
+	}
+	name := filepath.Base(result.Path)
+	if item == nil {
+		result.Disagreements = []string{"Sonarr's manual import preview does not list the file"}
+	} else {
+		result.Disagreements = disagreements(result, item)
+	}
+	for _, d := range result.Disagreements {
+		if result.Plan != nil {
+			result.Plan.Warnings = append(result.Plan.Warnings, d)
+		} else {
+			im.Logger.Warnf("%s: %s", name, d)
+		}
+	}
+}
+
+// previewItem returns the item of Sonarr's preview of the downloads folder
+// of inst for the file of result, nil when the preview does not list it. ok
+// is false when there is no preview to compare with, as for files outside
+// the downloads folder.
+func (im *Importer) previewItem(ctx context.Context, previews *importPreviews, inst *Instance, result *FileResult) (item *sonarr.ManualImportItem, ok bool) {
+	folder := im.Config.Sonarr.DownloadsFolder
+	if !hasPathPrefix(result.Path, folder) {
+		im.Logger.Debugf("Not cross-checking %s, it is outside the downloads folder", result.Path)
+		return nil, false
+	}
+	previews.mu.Lock()
+	preview := previews.instances[inst.Name]
+	if preview == nil {
+		preview = &importPreview{}
+		previews.instances[inst.Name] = preview
+	}
+	previews.mu.Unlock()
+
+	preview.mu.Lock()
+	defer preview.mu.Unlock()
+	if !preview.loaded {
+		preview.loaded = true
+		items, err := inst.Client.ManualImportPreview(ctx, folder)
+		if err != nil {
+			im.Logger.Warnf("Not cross-checking the files of this scan%s: %v", instanceSuffix(result.Instance), err)
+			return nil, false
+		}
+		preview.paths = make(map[string]*sonarr.ManualImportItem, len(items))
+		preview.names = make(map[string][]*sonarr.ManualImportItem, len(items))
+		for i := range items {
+			item := &items[i]
+			preview.paths[filepath.Clean(item.Path)] = item
+			name := filepath.Base(item.Path)
+			preview.names[name] = append(preview.names[name], item)
+		}
+		im.Logger.Infof("Sonarr%s previews %d file(s) in %s", instanceSuffix(result.Instance), len(items), folder)
+	}
+	if preview.paths == nil {
+		return nil, false
+	}
+	if item := preview.paths[filepath.Clean(result.Path)]; item != nil {
+		return item, true
+	}
+	// Sonarr may see the downloads folder under another path
+	if items := preview.names[filepath.Base(result.Path)]; len(items) == 1 {
+		return items[0], true
+	}
+	return nil, true
+}
+
+// disagreements returns how item, Sonarr's reading of the file of result,
+// differs from the reading of this tool: the reasons Sonarr would reject the
+// file for, another series or other episodes.
+func disagreements(result *FileResult, item *sonarr.ManualImportItem) []string {
+	var found []string
+	if len(item.Rejections) > 0 {
+		reasons := make([]string, len(item.Rejections))
+		for i, r := range item.Rejections {
+			reasons[i] = r.Reason
+		}
+		found = append(found, "Sonarr rejects the file: "+strings.Join(reasons, "; "))
+	}
+
+	// A series added by this scan may be known to Sonarr or not, depending
+	// on whether the preview was read before it was added
+	switch {
+	case item.Series == nil:
+		if result.SeriesID != 0 && !result.SeriesAdded {
+			found = append(found, fmt.Sprintf("Sonarr finds no series for the file, not %s (ID: %d)", result.SeriesTitle, result.SeriesID))
+		}
+	case item.Series.ID == result.SeriesID:
+	case result.SeriesID == 0 || result.SeriesAdded:
+		found = append(found, fmt.Sprintf("Sonarr reads the file as library series %s (ID: %d), not as new series %s", item.Series.Title, item.Series.ID, result.SeriesTitle))
+	default:
+		found = append(found, fmt.Sprintf("Sonarr reads the file as series %s (ID: %d), not %s (ID: %d)", item.Series.Title, item.Series.ID, result.SeriesTitle, result.SeriesID))
+	}
+
+	anime := result.Parsed
+	if anime == nil || len(item.Episodes) == 0 {
+		return found
+	}
+	var ours []seasonEpisode
+	for _, e := range anime.Episodes() {
+		ours = append(ours, seasonEpisode{anime.Season, e})
+	}
+	theirs := make([]seasonEpisode, len(item.Episodes))
+	for i, e := range item.Episodes {
+		theirs[i] = seasonEpisode{e.SeasonNumber, e.EpisodeNumber}
+	}
+	if a, b := formatEpisodes(theirs), formatEpisodes(ours); a != b {
+		found = append(found, fmt.Sprintf("Sonarr reads the file as %s, not %s", a, b))
+	}
+	return found
+}
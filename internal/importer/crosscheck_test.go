@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// recordedPreview returns the manual import preview of testdata, as recorded
+// from Sonarr for a downloads folder it sees as /downloads.
+func recordedPreview(t *testing.T) []sonarr.ManualImportItem {
+	t.Helper()
+	data, err := os.ReadFile("testdata/manualimport.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []sonarr.ManualImportItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+// newCrossCheckServer returns a fake Sonarr with the series of the recorded
+// preview and the preview itself.
+func newCrossCheckServer(t *testing.T) *sonarrtest.Server {
+	t.Helper()
+	srv := sonarrtest.New()
+	srv.AddSeries(sonarr.Series{ID: 101, Title: "Frieren", TvdbID: 424536, Path: "/tv/Frieren", Monitored: true}, episodes(28)...)
+	srv.AddSeries(sonarr.Series{ID: 102, Title: "Mushishi", TvdbID: 79718, Path: "/tv/Mushishi", Monitored: true}, episodes(26)...)
+	srv.AddSeries(sonarr.Series{ID: 103, Title: "Mushishi Zoku Shou", TvdbID: 282591, Path: "/tv/Mushishi Zoku Shou", Monitored: true}, episodes(20)...)
+	srv.AddLookup("Oshi no Ko", sonarr.SeriesLookup{Title: "Oshi no Ko", TitleSlug: "oshi-no-ko", TvdbID: 421069, Seasons: []sonarr.Season{{SeasonNumber: 1}}}, episodes(11)...)
+	srv.SetPreview(recordedPreview(t)...)
+	return srv
+}
+
+// crossCheckFiles are the files of the recorded preview, with what Sonarr
+// reads differently, and one file the preview does not list.
+var crossCheckFiles = map[string][]string{
+	"[SubsPlease] Frieren - 05 (1080p).mkv":    nil,
+	"[SubsPlease] Frieren - 06 (1080p).mkv":    {"Sonarr reads the file as S01E16, not S01E06"},
+	"[SubsPlease] Frieren - 07 (1080p).mkv":    {"Sonarr rejects the file: Sample"},
+	"[SubsPlease] Mushishi - 02 (1080p).mkv":   {"Sonarr reads the file as series Mushishi Zoku Shou (ID: 103), not Mushishi (ID: 102)"},
+	"[SubsPlease] Oshi no Ko - 03 (1080p).mkv": {"Sonarr rejects the file: Unknown Series"},
+	"[SubsPlease] Frieren - 08 (1080p).mkv":    {"Sonarr's manual import preview does not list the file"},
+}
+
+func TestCrossCheckDryRun(t *testing.T) {
+	srv := newCrossCheckServer(t)
+	defer srv.Close()
+	im := newTestImporter(t, srv, Options{DryRun: true, CrossCheck: true})
+	im.Client.SetReadOnly()
+	for name := range crossCheckFiles {
+		addFiles(t, im, name)
+	}
+
+	result := scan(t, im)
+	for name, want := range crossCheckFiles {
+		f := fileResult(t, result, name)
+		if f.Action != ActionDryRun || f.Plan == nil {
+			t.Errorf("%s: %s, %v; want a plan", name, f.Action, f.Err)
+			continue
+		}
+		if !slices.Equal(f.Disagreements, want) {
+			t.Errorf("%s: disagreements %q, want %q", name, f.Disagreements, want)
+		}
+		for _, d := range want {
+			if !slices.Contains(f.Plan.Warnings, d) {
+				t.Errorf("%s: plan warnings %q lack %q", name, f.Plan.Warnings, d)
+			}
+		}
+	}
+	if result.Disagreements != len(crossCheckFiles)-1 {
+		t.Errorf("%d file(s) with disagreements, want %d", result.Disagreements, len(crossCheckFiles)-1)
+	}
+	if len(srv.Imports()) != 0 || len(srv.Series()) != 3 {
+		t.Error("the dry run changed Sonarr")
+	}
+}
+
+func TestCrossCheckLive(t *testing.T) {
+	srv := newCrossCheckServer(t)
+	defer srv.Close()
+	im := newTestImporter(t, srv, Options{CrossCheck: true})
+	for name := range crossCheckFiles {
+		addFiles(t, im, name)
+	}
+
+	result := scan(t, im)
+	for name, want := range crossCheckFiles {
+		if f := fileResult(t, result, name); !slices.Equal(f.Disagreements, want) {
+			t.Errorf("%s: disagreements %q, want %q", name, f.Disagreements, want)
+		}
+	}
+	if f := fileResult(t, result, "[SubsPlease] Oshi no Ko - 03 (1080p).mkv"); !f.SeriesAdded {
+		t.Errorf("Oshi no Ko was not added: %s, %v", f.Action, f.Err)
+	}
+}
+
+func TestCrossCheckWithoutPreview(t *testing.T) {
+	srv := newCrossCheckServer(t)
+	defer srv.Close()
+	srv.Fail(http.MethodGet, "/api/v3/manualimport", http.StatusInternalServerError, -1)
+	im := newTestImporter(t, srv, Options{DryRun: true, CrossCheck: true})
+	im.Client.SetReadOnly()
+	addFiles(t, im, "[SubsPlease] Frieren - 06 (1080p).mkv")
+
+	if f := fileResult(t, scan(t, im), "[SubsPlease] Frieren - 06 (1080p).mkv"); f.Action != ActionDryRun || len(f.Disagreements) != 0 {
+		t.Errorf("without a preview: %s with disagreements %q, %v; want a plan without any", f.Action, f.Disagreements, f.Err)
+	}
+}
+
+func TestDisagreements(t *testing.T) {
+	frieren := &sonarr.Series{ID: 101, Title: "Frieren"}
+	tests := []struct {
+		desc   string
+		result FileResult
+		item   sonarr.ManualImportItem
+		want   []string
+	}{
+		{
+			desc:   "a new series Sonarr does not know yet",
+			result: FileResult{SeriesID: 104, SeriesTitle: "Oshi no Ko", SeriesAdded: true},
+			item:   sonarr.ManualImportItem{},
+		},
+		{
+			desc:   "a library series Sonarr does not find",
+			result: FileResult{SeriesID: 104, SeriesTitle: "Oshi no Ko"},
+			item:   sonarr.ManualImportItem{},
+			want:   []string{"Sonarr finds no series for the file, not Oshi no Ko (ID: 104)"},
+		},
+		{
+			desc:   "a library series where a new one would be added",
+			result: FileResult{SeriesTitle: "Frieren 2"},
+			item:   sonarr.ManualImportItem{Series: frieren},
+			want:   []string{"Sonarr reads the file as library series Frieren (ID: 101), not as new series Frieren 2"},
+		},
+		{
+			desc: "a range",
+			result: FileResult{SeriesID: 101, SeriesTitle: "Frieren",
+				Parsed: &parser.ParsedAnime{Season: 1, Episode: 5, EndEpisode: 6}},
+			item: sonarr.ManualImportItem{Series: frieren, Episodes: []sonarr.Episode{{SeasonNumber: 1, EpisodeNumber: 5}}},
+			want: []string{"Sonarr reads the file as S01E05, not S01E05-E06"},
+		},
+		{
+			desc: "two rejections",
+			result: FileResult{SeriesID: 101, SeriesTitle: "Frieren",
+				Parsed: &parser.ParsedAnime{Season: 1, Episode: 5}},
+			item: sonarr.ManualImportItem{Series: frieren, Episodes: []sonarr.Episode{{SeasonNumber: 1, EpisodeNumber: 5}},
+				Rejections: []sonarr.Rejection{{Reason: "Sample", Type: "permanent"}, {Reason: "Not an upgrade for existing episode file(s)", Type: "permanent"}}},
+			want: []string{"Sonarr rejects the file: Sample; Not an upgrade for existing episode file(s)"},
+		},
+	}
+	for _, tt := range tests {
+		got := disagreements(&tt.result, &tt.item)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: disagreements = %s, want %s", tt.desc, strings.Join(got, " | "), strings.Join(tt.want, " | "))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+// ErrDuplicate is returned for files of an episode that another file of the
+// scan provides from a release group with a higher trust.
+var ErrDuplicate = errors.New("duplicate episode")
+
+// episodeClaims records, for one scan, the file each episode is imported
+// from, so the trust of the release groups decides between the files of
+// different groups for the same episode.
+type episodeClaims struct {
+	mu     sync.Mutex
+	claims map[episodeKey]*episodeClaim
+}
+
+// episodeKey identifies an episode of a series of a Sonarr instance.
+type episodeKey struct {
+	instance string
+	tvdbID   int
+	season   int
+	episode  int
+}
+
+// episodeClaim is the file an episode is imported from.
+type episodeClaim struct {
+	path  string
+	group string
+	trust int
+}
+
+func newEpisodeClaims() *episodeClaims {
+	return &episodeClaims{claims: make(map[episodeKey]*episodeClaim)}
+}
+
+// claim records that the file of anime provides its episode of the series
+// with tvdbID. It returns an ErrDuplicate error when a file of the scan from
+// a group with a higher trust already provides it; a file from a group with
+// a higher trust takes the episode over, and groups with the same trust are
+// all imported as before. The returned release gives the episode back when
+// the import fails and does nothing after an error.
+func (im *Importer) claim(claims *episodeClaims, inst *Instance, tvdbID int, anime *parser.ParsedAnime) (release func(), err error) {
+	release = func() {}
+	if claims == nil || tvdbID == 0 {
+		return release, nil
+	}
+	key := episodeKey{instance: inst.Name, tvdbID: tvdbID, season: anime.Season, episode: anime.Episode}
+	group, _ := im.Config.Group(anime.Profile)
+	c := &episodeClaim{path: anime.FilePath, group: anime.Group, trust: group.Trust}
+
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+	if prev := claims.claims[key]; prev != nil && prev.path != c.path {
+		switch {
+		case prev.trust > c.trust:
+			return release, fmt.Errorf("%w: S%02dE%02d is imported from %s of release group %s, which has a higher trust than %s",
+				ErrDuplicate, anime.Season, anime.Episode, filepath.Base(prev.path), prev.group, c.group)
+		case prev.trust == c.trust:
+			return release, nil
+		}
+		verb := "Importing"
+		if im.Options.DryRun {
+			verb = "Would import"
+		}
+		im.Logger.Infof("%s %s over %s, release group %s has a higher trust than %s", verb, filepath.Base(c.path), filepath.Base(prev.path), c.group, prev.group)
+	}
+	claims.claims[key] = c
+	return func() {
+		claims.mu.Lock()
+		defer claims.mu.Unlock()
+		if claims.claims[key] == c {
+			delete(claims.claims, key)
+		}
+	}, nil
+}
@@ -0,0 +1,20 @@
+package importer
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+// checkEncoding fails with parser.ErrInvalidEncoding when path is not valid
+// UTF-8. The parser reads such a name as Latin-1, but the JSON of the Sonarr
+// and Radarr APIs turns its bytes into replacement characters, so the path
+// would reach them as another one that does not exist.
+func checkEncoding(path string) error {
+	if utf8.ValidString(path) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s cannot be sent to Sonarr as it is, rename it to UTF-8 (convmv -f latin1 -t utf8 does)", parser.ErrInvalidEncoding, logging.Escape(path))
+}
@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+var (
+	// ErrSeriesNotFound is returned when a parsed title matches neither a
+	// library series nor a lookup result.
+	ErrSeriesNotFound = errors.New("series not found")
+	// ErrEpisodeNotFound is returned when the series has no episode with the
+	// parsed season and episode number.
+	ErrEpisodeNotFound = errors.New("episode not found")
+	// ErrMovieNotFound is returned when Radarr has no lookup result for a
+	// parsed movie title.
+	ErrMovieNotFound = errors.New("movie not found")
+	// ErrTooManyFiles is returned when a scan finds more video files than
+	// parsing.maxFiles allows.
+	ErrTooManyFiles = errors.New("too many video files")
+	// ErrFileTimeout is returned when a file is not finished within
+	// parsing.fileTimeout.
+	ErrFileTimeout = errors.New("file timed out")
+	// ErrAwaitingApproval is returned for files whose series would have to
+	// be added while sonarr.confirmNewSeries is set.
+	ErrAwaitingApproval = errors.New("new series awaits approval")
+	// ErrLookupCached is returned along with ErrSeriesNotFound for a title
+	// whose lookup found no series within sonarr.lookupCache, which is not
+	// looked up again.
+	ErrLookupCached = errors.New("lookup suppressed (cached miss)")
+	// ErrAwaitingMetadata is returned along with ErrEpisodeNotFound for an
+	// episode its season does not list yet even after a refresh of the
+	// series, which is retried with retry.metadataDelay.
+	ErrAwaitingMetadata = errors.New("awaiting metadata")
+)
+
+// approvalError parks a file until the new series it needs is approved.
+type approvalError struct {
+	series NewSeries
+}
+
+func (e *approvalError) Error() string {
+	return fmt.Sprintf("%v: %s (sonarr.confirmNewSeries is set)", ErrAwaitingApproval, e.series)
+}
+
+func (e *approvalError) Unwrap() error {
+	return ErrAwaitingApproval
+}
+
+// ErrorCategory groups file failures for the scan summary.
+type ErrorCategory string
+
+const (
+	CategoryNone             ErrorCategory = ""
+	CategoryParse            ErrorCategory = "parse failed"
+	CategoryBatch            ErrorCategory = "possible batch file"
+	CategoryEncoding         ErrorCategory = "invalid filename encoding"
+	CategorySeriesNotFound   ErrorCategory = "series not found"
+	CategoryLookupCached     ErrorCategory = "lookup suppressed (cached miss)"
+	CategoryInvalidPin       ErrorCategory = "invalid series pin"
+	CategoryDuplicateSeries  ErrorCategory = "duplicate library series"
+	CategoryEpisodeNotFound  ErrorCategory = "episode not found"
+	CategoryAwaitingMetadata ErrorCategory = "awaiting metadata"
+	CategoryMovieNotFound    ErrorCategory = "movie not found"
+	CategoryAPI              ErrorCategory = "sonarr api error"
+	CategoryUnreachable      ErrorCategory = "sonarr unreachable"
+	CategoryTimeout          ErrorCategory = "timed out"
+	CategoryAwaitingApproval ErrorCategory = "awaiting approval"
+	CategoryDiskSpace        ErrorCategory = "insufficient disk space"
+	CategoryPathUnavailable  ErrorCategory = "series path unavailable"
+	CategoryPermission       ErrorCategory = "permission denied"
+	CategoryReadOnly         ErrorCategory = "read-only file system"
+	CategoryDuplicate        ErrorCategory = "duplicate episode"
+	CategoryComplete         ErrorCategory = "library already complete"
+	CategoryNotVerified      ErrorCategory = "import not verified"
+	CategoryRejected         ErrorCategory = "rejected by sonarr"
+	CategoryRejectedTemp     ErrorCategory = "rejected by sonarr (temporary)"
+	CategoryOther            ErrorCategory = "other"
+)
+
+// Categorize returns the category of a file processing error.
+func Categorize(err error) ErrorCategory {
+	var apiErr *sonarr.APIError
+	var rejected *rejectionError
+	switch {
+	case err == nil:
+		return CategoryNone
+	case errors.Is(err, ErrFileTimeout):
+		return CategoryTimeout
+	case errors.Is(err, parser.ErrParseFailed):
+		return CategoryParse
+	case errors.Is(err, parser.ErrPossibleBatch):
+		return CategoryBatch
+	case errors.Is(err, parser.ErrInvalidEncoding):
+		return CategoryEncoding
+	case errors.Is(err, ErrAwaitingApproval):
+		return CategoryAwaitingApproval
+	case errors.Is(err, ErrInsufficientSpace):
+		return CategoryDiskSpace
+	case errors.Is(err, ErrPathUnavailable):
+		return CategoryPathUnavailable
+	case errors.Is(err, ErrPermissionDenied):
+		return CategoryPermission
+	case errors.Is(err, ErrReadOnly):
+		return CategoryReadOnly
+	case errors.Is(err, ErrDuplicate), errors.Is(err, ErrAlreadyImported):
+		return CategoryDuplicate
+	case errors.Is(err, ErrLibraryComplete):
+		return CategoryComplete
+	case errors.As(err, &rejected):
+		if rejected.temporary() {
+			return CategoryRejectedTemp
+		}
+		return CategoryRejected
+	case errors.Is(err, ErrImportNotVerified):
+		return CategoryNotVerified
+	case errors.Is(err, ErrDuplicateSeries):
+		return CategoryDuplicateSeries
+	case errors.Is(err, ErrInvalidPin):
+		return CategoryInvalidPin
+	case errors.Is(err, ErrLookupCached):
+		return CategoryLookupCached
+	case errors.Is(err, ErrSeriesNotFound):
+		return CategorySeriesNotFound
+	case errors.Is(err, ErrAwaitingMetadata):
+		return CategoryAwaitingMetadata
+	case errors.Is(err, ErrEpisodeNotFound):
+		return CategoryEpisodeNotFound
+	case errors.Is(err, ErrMovieNotFound):
+		return CategoryMovieNotFound
+	case sonarr.IsUnreachable(err):
+		return CategoryUnreachable
+	case errors.As(err, &apiErr):
+		return CategoryAPI
+	default:
+		return CategoryOther
+	}
+}
+
+// Unmatched reports whether files of category c were skipped because they
+// could not be matched to a series, which usually needs a new pattern or a
+// manual import rather than a retry. Possible batch files count as
+// unmatched as they need a manual import too. Files awaiting the approval of their
+// new series count as unmatched until it is approved, and so do duplicates
+// of an episode a more trusted release group provides, files whose episode
+// is not listed yet and, with Options.MissingOnly, files of episodes Sonarr
+// already has.
+func (c ErrorCategory) Unmatched() bool {
+	switch c {
+	case CategoryParse, CategoryBatch, CategorySeriesNotFound, CategoryLookupCached, CategoryMovieNotFound, CategoryAwaitingApproval, CategoryDuplicate, CategoryComplete, CategoryAwaitingMetadata:
+		return true
+	}
+	return false
+}
+
+// Transient reports whether the failure of f may go away without a change to
+// the file or the configuration, so a later retry can succeed: Sonarr was
+// unreachable, failed with a server error, answered too slowly or asked to
+// be called again later, its root folder was short of space, it accepted an
+// import it did not carry out or rejected it for a temporary reason, TVDB
+// does not list the episode yet, or a series added moments ago has not been
+// refreshed with its episodes yet. Other API errors and unexpected failures
+// would only fail again.
+func (f FileResult) Transient() bool {
+	switch f.Category {
+	case CategoryUnreachable, CategoryTimeout, CategoryDiskSpace, CategoryNotVerified, CategoryRejectedTemp, CategoryAwaitingMetadata:
+		return true
+	case CategoryAPI:
+		var apiErr *sonarr.APIError
+		return errors.As(f.Err, &apiErr) && (apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests)
+	case CategoryEpisodeNotFound:
+		// A rolled back series was the wrong one, so a retry would only add
+		// it again
+		return f.SeriesAdded && !f.RolledBack
+	}
+	return false
+}
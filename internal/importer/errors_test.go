@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+func TestCategorize(t *testing.T) {
+	apiError := func(status int) error {
+		return &sonarr.APIError{Method: "POST", Path: "/api/v3/series", StatusCode: status, Body: `{"message":"nope"}`}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{"nil", nil, CategoryNone},
+		{"parse", fmt.Errorf("%w: %s", parser.ErrParseFailed, "x.mkv"), CategoryParse},
+		{"batch", fmt.Errorf("%w: episodes 1-12", parser.ErrPossibleBatch), CategoryBatch},
+		{"encoding", fmt.Errorf("%w: \\xff", parser.ErrInvalidEncoding), CategoryEncoding},
+		{"series not found", fmt.Errorf("%w: no lookup results for Foo", ErrSeriesNotFound), CategorySeriesNotFound},
+		{"cached miss", fmt.Errorf("%w: %w", ErrSeriesNotFound, ErrLookupCached), CategoryLookupCached},
+		{"episode not found", fmt.Errorf("%w: S01E99", ErrEpisodeNotFound), CategoryEpisodeNotFound},
+		{"awaiting metadata", fmt.Errorf("%w: %w", ErrEpisodeNotFound, ErrAwaitingMetadata), CategoryAwaitingMetadata},
+		{"approval", &approvalError{series: NewSeries{Title: "Foo", TvdbID: 1}}, CategoryAwaitingApproval},
+		{"client error", fmt.Errorf("failed to add series: %w", apiError(400)), CategoryAPI},
+		{"server error", fmt.Errorf("failed to add series: %w", apiError(503)), CategoryUnreachable},
+		{"connection refused", &url.Error{Op: "Get", URL: "http://sonarr", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, CategoryUnreachable},
+		{"deadline", fmt.Errorf("lookup: %w", context.DeadlineExceeded), CategoryUnreachable},
+		{"timeout", fmt.Errorf("%w after 1m", ErrFileTimeout), CategoryTimeout},
+		{"disk space", fmt.Errorf("%w: 1 GB free", ErrInsufficientSpace), CategoryDiskSpace},
+		{"rejected", &rejectionError{rejections: []sonarr.Rejection{{Reason: "Sample", Type: "permanent"}}}, CategoryRejected},
+		{"rejected temporarily", &rejectionError{rejections: []sonarr.Rejection{{Reason: "Unpacking", Type: "temporary"}}}, CategoryRejectedTemp},
+		{"other", errors.New("something else"), CategoryOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Categorize(tt.err); got != tt.want {
+				t.Errorf("Categorize(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectionErrorIsRejected(t *testing.T) {
+	err := fmt.Errorf("import: %w", &rejectionError{rejections: []sonarr.Rejection{{Reason: "Sample"}, {Reason: "Unknown Series"}}})
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("errors.Is(%v, ErrRejected) = false", err)
+	}
+	if want := "import: Rejected by Sonarr: Sample; Unknown Series"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestScanResultCountsFailuresByCategory(t *testing.T) {
+	r := newScanResult("/downloads")
+	for _, err := range []error{
+		parser.ErrParseFailed,
+		fmt.Errorf("%w: Foo", ErrSeriesNotFound),
+		fmt.Errorf("%w: Bar", ErrSeriesNotFound),
+		&sonarr.APIError{StatusCode: 500},
+	} {
+		var f FileResult
+		f.fail(err)
+		r.add(f)
+	}
+	r.add(FileResult{Action: ActionImported})
+
+	want := map[ErrorCategory]int{CategoryParse: 1, CategorySeriesNotFound: 2, CategoryUnreachable: 1}
+	if len(r.Failures) != len(want) {
+		t.Errorf("Failures = %v, want %v", r.Failures, want)
+	}
+	for category, n := range want {
+		if r.Failures[category] != n {
+			t.Errorf("Failures[%q] = %d, want %d", category, r.Failures[category], n)
+		}
+	}
+	if r.Failed != 4 || r.Imported != 1 {
+		t.Errorf("Failed, Imported = %d, %d, want 4, 1", r.Failed, r.Imported)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	apiError := func(status int) error {
+		return fmt.Errorf("failed to add series: %w", &sonarr.APIError{Method: "POST", Path: "/api/v3/series", StatusCode: status})
+	}
+	tests := []struct {
+		name   string
+		result FileResult
+		want   bool
+	}{
+		{"unreachable", FileResult{Err: &url.Error{Op: "Get", URL: "http://sonarr", Err: errors.New("connection refused")}}, true},
+		{"server error", FileResult{Err: apiError(502)}, true},
+		{"request timeout", FileResult{Err: apiError(408)}, true},
+		{"too many requests", FileResult{Err: apiError(429)}, true},
+		{"file timeout", FileResult{Err: ErrFileTimeout}, true},
+		{"disk space", FileResult{Err: ErrInsufficientSpace}, true},
+		{"rejected temporarily", FileResult{Err: &rejectionError{rejections: []sonarr.Rejection{{Reason: "Unpacking", Type: "temporary"}}}}, true},
+		{"episode of a new series", FileResult{Err: ErrEpisodeNotFound, SeriesAdded: true}, true},
+		{"episode of a rolled back series", FileResult{Err: ErrEpisodeNotFound, SeriesAdded: true, RolledBack: true}, false},
+		{"episode of a library series", FileResult{Err: ErrEpisodeNotFound}, false},
+		{"bad request", FileResult{Err: apiError(400)}, false},
+		{"not found", FileResult{Err: apiError(404)}, false},
+		{"parse", FileResult{Err: parser.ErrParseFailed}, false},
+		{"rejected", FileResult{Err: &rejectionError{rejections: []sonarr.Rejection{{Reason: "Sample", Type: "permanent"}}}}, false},
+		{"other", FileResult{Err: errors.New("something else")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.result
+			f.fail(f.Err)
+			if got := f.Transient(); got != tt.want {
+				t.Errorf("Transient() of %q (%v) = %v, want %v", f.Category, f.Err, got, tt.want)
+			}
+		})
+	}
+}
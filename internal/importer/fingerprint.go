@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"sonarr-autoimport/internal/throttle"
+)
+
+// ErrAlreadyImported is returned for files whose content was imported into
+// the same episode before, within dedupe.window.
+var ErrAlreadyImported = errors.New("duplicate of previously imported file")
+
+// fingerprintBlock is the size of the blocks at the start and the end of a
+// file that its fingerprint hashes.
+const fingerprintBlock = 64 << 10
+
+// Fingerprint identifies the content of the file at path by its size and a
+// hash of its first and last blocks, which is cheap for large video files and
+// survives renames. The middle of the file is not read, so files that differ
+// only there share a fingerprint. The file is read through t, and read is
+// the number of bytes that took.
+func Fingerprint(ctx context.Context, t *throttle.Throttle, path string) (fp string, read int64, err error) {
+	file, err := t.Open(ctx, path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	defer func() { read = file.BytesRead() }()
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	size := info.Size()
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, min(size, fingerprintBlock)); err != nil {
+		return "", 0, err
+	}
+	if tail := size - fingerprintBlock; tail > 0 {
+		if _, err := io.Copy(hash, io.NewSectionReader(file, max(tail, fingerprintBlock), fingerprintBlock)); err != nil {
+			return "", 0, err
+		}
+	}
+	return fmt.Sprintf("%d:%x", size, hash.Sum(nil)[:16]), 0, nil
+}
+
+// checkFingerprint records the fingerprint of the file of result and returns
+// an ErrAlreadyImported error when the same content was imported into its
+// episode within dedupe.window. It does nothing without Fingerprints or
+// with a window of 0, and only records the fingerprint with
+// Options.NoDedupe. A file that cannot be read, or is larger than
+// io.maxHashSize, is imported without the check.
+func (im *Importer) checkFingerprint(ctx context.Context, result *FileResult) error {
+	window, err := im.Config.Dedupe.WindowDuration()
+	if im.Fingerprints == nil || err != nil || window <= 0 {
+		return nil
+	}
+	if limit, _ := im.Config.IO.MaxHashSizeBytes(); limit > 0 && result.Size > limit {
+		im.Logger.Debugf("Importing %s without checking for duplicates, it is larger than io.maxHashSize", filepath.Base(result.Path))
+		return nil
+	}
+	result.step = "fingerprint"
+	fp, read, err := Fingerprint(ctx, im.throttle, result.Path)
+	result.BytesRead += read
+	if err != nil {
+		im.Logger.Debugf("Importing %s without checking for duplicates, failed to fingerprint it: %v", filepath.Base(result.Path), err)
+		return nil
+	}
+	result.Fingerprint = fp
+	if im.Options.NoDedupe || ctx.Err() != nil {
+		return nil
+	}
+
+	anime := result.Parsed
+	prev, at, ok := im.Fingerprints.Imported(fp, result.Instance, result.SeriesID, anime.Season, anime.Episode, time.Now().Add(-window))
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("%w %s, which was imported as S%02dE%02d on %s; use -no-dedupe to import it again",
+		ErrAlreadyImported, filepath.Base(prev), anime.Season, anime.Episode, at.Local().Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/parser"
+)
+
+// folderOverride is a config.FolderConfig with its absolute path and its tag
+// labels resolved for every instance.
+type folderOverride struct {
+	config.FolderConfig
+	dir string
+	// tags holds the tag IDs of the labels by instance name.
+	tags map[string][]int
+}
+
+// newFolderOverrides returns the folder overrides of cfg, deepest first.
+func newFolderOverrides(cfg *config.Config) []*folderOverride {
+	folders := make([]*folderOverride, 0, len(cfg.Folders))
+	for _, f := range cfg.Folders {
+		if f.Path == "" {
+			continue
+		}
+		folders = append(folders, &folderOverride{FolderConfig: f, dir: cfg.FolderPath(f), tags: make(map[string][]int)})
+	}
+	sort.SliceStable(folders, func(i, j int) bool { return len(folders[i].dir) > len(folders[j].dir) })
+	return folders
+}
+
+// ResolveFolderTags looks up the IDs of the tags of the folder overrides in
+// every instance. It fails when an instance has no tag with one of the
+// labels, so a typo is reported at startup rather than for every file.
+func (im *Importer) ResolveFolderTags(ctx context.Context) error {
+	needed := false
+	for _, f := range im.folders {
+		needed = needed || len(f.Tags) > 0
+	}
+	if !needed {
+		return nil
+	}
+
+	for _, inst := range im.instances {
+		tags, err := inst.Client.Tags(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the tags of Sonarr instance %s: %w", inst.Name, err)
+		}
+		ids := make(map[string]int, len(tags))
+		for _, t := range tags {
+			ids[strings.ToLower(t.Label)] = t.ID
+		}
+		for _, f := range im.folders {
+			for _, label := range f.Tags {
+				id, ok := ids[strings.ToLower(label)]
+				if !ok {
+					return fmt.Errorf("folder %s: Sonarr instance %s has no tag %q", f.dir, inst.Name, label)
+				}
+				f.tags[inst.Name] = append(f.tags[inst.Name], id)
+			}
+		}
+	}
+	return nil
+}
+
+// withSeriesType returns inst adding series of the series type of the
+// pattern that parsed anime, or inst itself when the pattern has none. A
+// folder override with a series type of its own still takes precedence.
+func (im *Importer) withSeriesType(inst *Instance, anime *parser.ParsedAnime) *Instance {
+	if anime.SeriesType == "" || anime.SeriesType == inst.Config.SeriesType {
+		return inst
+	}
+	im.Logger.Debugf("Using series type %s, that of the pattern that parsed %s", anime.SeriesType, anime.OriginalFilename)
+	out := *inst
+	out.Config.SeriesType = anime.SeriesType
+	return &out
+}
+
+// withFolder returns inst with the settings of the folder override that
+// covers path applied, and the path of that folder. inst itself is returned
+// when no override applies.
+func (im *Importer) withFolder(inst *Instance, path string) (*Instance, string) {
+	for _, f := range im.folders {
+		if !hasPathPrefix(path, f.dir) {
+			continue
+		}
+		out := *inst
+		if f.QualityProfile != 0 {
+			out.Config.QualityProfile = f.QualityProfile
+		}
+		if f.LanguageProfile != 0 {
+			out.Config.LanguageProfile = f.LanguageProfile
+		}
+		if f.RootFolder != "" {
+			out.Config.RootFolder = f.RootFolder
+		}
+		if f.SeriesType != "" {
+			out.Config.SeriesType = f.SeriesType
+		}
+		out.Tags = f.tags[inst.Name]
+		return &out, f.dir
+	}
+	return inst, ""
+}
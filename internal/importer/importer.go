@@ -0,0 +1,1247 @@
+// Package importer scans the downloads folder and imports the files it finds
+// into Sonarr.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/throttle"
+)
+
+// Options are the per-invocation switches of an Importer.
+type Options struct {
+	// DryRun parses files without changing anything in Sonarr.
+	DryRun bool
+	// DrainTimeout bounds how long files already being processed may keep
+	// talking to Sonarr after the scan context is cancelled.
+	DrainTimeout time.Duration
+	// Limit is the most files a scan attempts. parsing.fileLimit applies
+	// when it is 0.
+	Limit int
+	// IgnoreMaxFiles lets scans go ahead with more files than
+	// parsing.maxFiles.
+	IgnoreMaxFiles bool
+	// MissingOnly imports only the files of episodes that Sonarr misses,
+	// which backfills a library from a folder of old downloads.
+	MissingOnly bool
+	// NoDedupe imports files whose content was imported before.
+	NoDedupe bool
+	// CrossCheck compares the reading of every file with that of Sonarr's
+	// manual import preview of the downloads folder and flags where they
+	// disagree.
+	CrossCheck bool
+	// AllowOverlap scans a downloads folder that is inside a Sonarr root
+	// folder or holds one, skipping the files inside the root folders.
+	AllowOverlap bool
+	// NoRescan leaves the files that appear during a scan for the next one,
+	// like parsing.skipRescan.
+	NoRescan bool
+	// Since, when not zero, leaves the files modified before it out of full
+	// scans.
+	Since time.Time
+	// MaxAge, when positive, leaves the files modified longer than it before
+	// a scan started out of the scan, as daemon.maxFileAge.
+	MaxAge time.Duration
+}
+
+// cutoff returns the time before which the files of a full scan started at
+// now are left alone, the later of Since and MaxAge, or zero for none.
+func (o Options) cutoff(now time.Time) time.Time {
+	cutoff := o.Since
+	if o.MaxAge > 0 && now.Add(-o.MaxAge).After(cutoff) {
+		cutoff = now.Add(-o.MaxAge)
+	}
+	return cutoff
+}
+
+// RetryQueue holds the files that failed transiently. A full scan leaves them
+// alone until their retry is due, while explicit paths are always processed.
+// The queue learns about results as an Observer.
+type RetryQueue interface {
+	// Due reports whether the file at path may be processed now.
+	Due(path string) bool
+	// Len returns the number of files waiting for a retry.
+	Len() int
+	// Count returns the number of files waiting for a retry after failing
+	// with category.
+	Count(category ErrorCategory) int
+}
+
+// IgnoreList holds the files that full scans skip without processing them.
+type IgnoreList interface {
+	Ignored(path string) bool
+}
+
+// Aliases map parsed titles to the TVDB ID of their series.
+type Aliases interface {
+	// TvdbID returns the series of title, or 0 when title has no alias.
+	TvdbID(title string) int
+}
+
+// Fingerprints know the content of the files imported before. The importer
+// sets FileResult.Fingerprint for them to learn about as an Observer.
+type Fingerprints interface {
+	// Imported returns the path and time of the latest import since since
+	// of a file with fingerprint into the episode of series seriesID on
+	// instance, which is empty with a single Sonarr instance.
+	Imported(fingerprint, instance string, seriesID, season, episode int, since time.Time) (path string, at time.Time, ok bool)
+}
+
+// LookupMisses remember the titles whose lookup found no series, so the
+// files that carry them do not repeat it for a while.
+type LookupMisses interface {
+	// Missed returns when the lookup of title on the instance called
+	// instance found no series and until when it is not repeated, ok being
+	// false when it is due.
+	Missed(instance, title string) (at, until time.Time, ok bool)
+	// Miss records that the lookup of title on instance found no series,
+	// which is not repeated within ttl.
+	Miss(instance, title string, ttl time.Duration)
+}
+
+// Torrents knows the files that a download client still downloads or seeds,
+// which must not be moved away from under their torrent.
+type Torrents interface {
+	// Load refreshes what the download client reports. It is called once
+	// per scan, before the first file; a client that cannot be reached must
+	// not hold up the scan.
+	Load(ctx context.Context)
+	// Busy returns why the file at path is still needed, or "" when it is
+	// not.
+	Busy(path string) string
+}
+
+// Observer is told about every processed file and every finished scan.
+// Methods are called from the scan workers and must not block for long.
+type Observer interface {
+	FileProcessed(f FileResult)
+	ScanFinished(r *ScanResult)
+}
+
+// Step is a point a file reaches while it is processed.
+type Step string
+
+const (
+	StepParsed      Step = "parsed"
+	StepSeriesAdded Step = "series-added"
+	StepMovieAdded  Step = "movie-added"
+)
+
+// StepObserver is an Observer that also follows scans as they happen: it is
+// told when a scan starts and about the steps of every file before the file
+// is processed completely.
+type StepObserver interface {
+	Observer
+	ScanStarted(r *ScanResult)
+	// FileStep receives the file result as far as it is known at step.
+	FileStep(step Step, f FileResult)
+}
+
+// Importer runs the scan and import workflow against a Sonarr instance. It
+// holds everything a scan needs, so several importers can run side by side.
+type Importer struct {
+	Config *config.Config
+	Client *sonarr.Client
+	// Radarr receives the files recognised as movies. Movies are not
+	// detected when it is nil.
+	Radarr    *radarr.Client
+	Parser    *parser.Parser
+	Logger    *logging.Logger
+	Options   Options
+	Observers []Observer
+	// Retry defers the files waiting in a retry queue when it is not nil.
+	Retry RetryQueue
+	// Ignore skips the files of an ignore list when it is not nil.
+	Ignore IgnoreList
+	// Aliases, when not nil, pick the series of the titles they know instead
+	// of the title lookup. The aliases of the rules file apply after them.
+	Aliases Aliases
+	// Torrents, when not nil, skips the files of torrents that still need
+	// them or imports copies of them, as qbittorrent.action says.
+	Torrents Torrents
+	// Fingerprints, when not nil, skips the files whose content was
+	// imported into the same episode within dedupe.window.
+	Fingerprints Fingerprints
+	// LookupMisses, when not nil, fails the files of titles whose lookup
+	// found no series within sonarr.lookupCache without looking them up
+	// again.
+	LookupMisses LookupMisses
+	// LastScan is when the previous full scan started, which
+	// parsing.newFilesFirst tells new files by. A reloaded importer takes it
+	// over from the one it replaces.
+	LastScan time.Time
+
+	// throttle limits the file reads of every scan, as io says.
+	throttle *throttle.Throttle
+	// roots are the real paths of the Sonarr root folders, whose files the
+	// scans skip, once CheckRootFolders has run.
+	roots []string
+	// lookupCacheHits counts the lookups that sonarr.lookupCache saved.
+	lookupCacheHits atomic.Int64
+	// instances holds the instance of Config.Sonarr and Client first.
+	instances  []*Instance
+	folders    []*folderOverride
+	routes     []route
+	routesOnce sync.Once
+	// adding serializes the adds of each series.
+	adding seriesLocks
+}
+
+// New returns an Importer for cfg using client to talk to Sonarr.
+func New(cfg *config.Config, client *sonarr.Client, log *logging.Logger, opts Options) *Importer {
+	// Validate reports invalid limits, which leave reads unlimited here
+	rate, _ := cfg.IO.MaxReadRateBytes()
+	return &Importer{
+		Config:    cfg,
+		Client:    client,
+		Parser:    parser.New(cfg.ParserConfig(), log),
+		Logger:    log,
+		Options:   opts,
+		throttle:  throttle.New(rate, cfg.IO.MaxReaders),
+		instances: []*Instance{{Name: config.DefaultInstance, Config: cfg.Sonarr, Client: client}},
+		folders:   newFolderOverrides(cfg),
+	}
+}
+
+// ProcessAnimeFiles scans the downloads folder and imports every video file
+// found in it. The returned ScanResult is nil only when the scan could not
+// start at all. When ctx is cancelled the scan stops early and the result is
+// marked as interrupted.
+func (im *Importer) ProcessAnimeFiles(ctx context.Context) (*ScanResult, error) {
+	cfg := im.Config
+	if err := im.checkReady(); err != nil {
+		return nil, err
+	}
+
+	im.Logger.Debugf("Scanning %s for video files", cfg.Sonarr.DownloadsFolder)
+
+	started := time.Now()
+	opts := im.walkOptions()
+	if cfg.Parsing.NewFilesFirst {
+		opts.newSince = im.LastScan
+	}
+	if opts.since = im.Options.cutoff(started); !opts.since.IsZero() {
+		im.Logger.Debugf("Leaving files modified before %s alone", opts.since.Format(time.RFC3339))
+	}
+
+	if err := im.checkFileCount(cfg.Sonarr.DownloadsFolder, opts); err != nil {
+		return nil, err
+	}
+
+	limit := im.Options.Limit
+	if limit == 0 {
+		limit = cfg.Parsing.FileLimit
+	}
+	files, walked := scanVideoFiles(ctx, cfg.Sonarr.DownloadsFolder, limit, opts)
+
+	// Files that finish downloading during the scan are picked up by a
+	// second walk at its end, unless the first one did not get through
+	seen := make(map[string]bool)
+	var walk walkResult
+	rescan := func() ([]videoFile, int) {
+		walk = <-walked
+		if walk.err != nil || walk.remaining > 0 || ctx.Err() != nil || !im.rescans() {
+			return nil, 0
+		}
+		fresh, unsettled := im.rescan(ctx, opts, seen)
+		if limit > 0 && len(seen)+len(fresh) > limit {
+			walk.remaining = len(seen) + len(fresh) - limit
+			fresh = fresh[:limit-len(seen)]
+		}
+		return fresh, unsettled
+	}
+	result := im.run(ctx, recordPaths(ctx, files, seen), true, rescan)
+
+	// A failed walk still reports the files processed up to that point
+	if walk.err == nil {
+		im.LastScan = started
+	}
+	result.Remaining = walk.remaining
+	result.TooOld = walk.old
+	result.LimitReached = walk.remaining > 0
+	err := walk.err
+	if err != nil {
+		err = fmt.Errorf("failed to scan for video files: %w", err)
+		result.Error = err.Error()
+	}
+
+	result.LogSummary(im.Logger)
+	im.scanFinished(result)
+	return result, err
+}
+
+// ProcessPaths imports the given files instead of scanning the whole
+// downloads folder. Directories are scanned for video files and other paths
+// without a video extension are ignored.
+func (im *Importer) ProcessPaths(ctx context.Context, paths []string) (*ScanResult, error) {
+	if err := im.checkReady(); err != nil {
+		return nil, err
+	}
+
+	files := make(chan videoFile)
+	go func() {
+		defer close(files)
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err == nil && info.IsDir() {
+				if !im.forwardDir(ctx, path, files) {
+					return
+				}
+				continue
+			}
+			if !IsVideoFile(path) {
+				im.Logger.Debugf("Skipping non-video file: %s", path)
+				continue
+			}
+			file, err := im.walkOptions().filePath(path)
+			if err != nil {
+				im.Logger.Warnf("Skipping symlink %s: %v", path, err)
+				continue
+			}
+			video := videoFile{path: file}
+			if info != nil {
+				video.size, video.modTime = info.Size(), info.ModTime()
+			}
+			select {
+			case files <- video:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	result := im.run(ctx, files, false, nil)
+	result.LogSummary(im.Logger)
+	im.scanFinished(result)
+	return result, nil
+}
+
+// scanStarted tells the step observers about a new scan.
+func (im *Importer) scanStarted(result *ScanResult) {
+	for _, o := range im.Observers {
+		if so, ok := o.(StepObserver); ok {
+			so.ScanStarted(result)
+		}
+	}
+}
+
+// step tells the step observers that the file of result reached step.
+func (im *Importer) step(step Step, result *FileResult) {
+	for _, o := range im.Observers {
+		if so, ok := o.(StepObserver); ok {
+			so.FileStep(step, *result)
+		}
+	}
+}
+
+// scanFinished passes a finished scan to the observers.
+func (im *Importer) scanFinished(result *ScanResult) {
+	for _, o := range im.Observers {
+		o.ScanFinished(result)
+	}
+}
+
+// forwardDir sends the video files below dir on files. It returns false when
+// ctx was cancelled.
+func (im *Importer) forwardDir(ctx context.Context, dir string, files chan<- videoFile) bool {
+	found, walked := scanVideoFiles(ctx, dir, 0, im.walkOptions())
+	for file := range found {
+		select {
+		case files <- file:
+		case <-ctx.Done():
+		}
+	}
+	if err := (<-walked).err; err != nil {
+		im.Logger.Errorf("Failed to scan %s: %v", dir, err)
+	}
+	return ctx.Err() == nil
+}
+
+// checkFileCount refuses to scan root when it holds more video files than
+// parsing.maxFiles. The files are counted before any is processed, leaving
+// out those older than the cutoff of opts.
+func (im *Importer) checkFileCount(root string, opts walkOptions) error {
+	max := im.Config.Parsing.MaxFiles
+	if max <= 0 || im.Options.IgnoreMaxFiles {
+		return nil
+	}
+	n := 0
+	err := walkVideos(root, opts, func(path string, d fs.DirEntry) error {
+		if !opts.since.IsZero() {
+			if file, _ := newVideoFile(path, d); opts.tooOld(file) {
+				return nil
+			}
+		}
+		if n++; n > max {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan for video files: %w", err)
+	}
+	if n > max {
+		return fmt.Errorf("%w: more than %d in %s (parsing.maxFiles), refusing to proceed without -yes", ErrTooManyFiles, max, root)
+	}
+	return nil
+}
+
+// checkReady validates the settings every scan depends on.
+func (im *Importer) checkReady() error {
+	cfg := im.Config
+
+	// Validate configuration
+	if cfg.Sonarr.URL == "" || cfg.Sonarr.APIKey == "" {
+		return fmt.Errorf("Sonarr URL and API key are required")
+	}
+
+	// Check if downloads folder exists, following it when it is a symlink
+	if _, err := os.Stat(cfg.Sonarr.DownloadsFolder); os.IsNotExist(err) {
+		if target, err := os.Readlink(cfg.Sonarr.DownloadsFolder); err == nil {
+			return fmt.Errorf("downloads folder %s is a symlink to %s, which does not exist", cfg.Sonarr.DownloadsFolder, target)
+		}
+		return fmt.Errorf("downloads folder not found: %s", cfg.Sonarr.DownloadsFolder)
+	}
+
+	if _, ok := fileOrders[cfg.Parsing.Order]; !ok && cfg.Parsing.Order != "" {
+		return fmt.Errorf("invalid parsing.order %q, want path, mtime, mtime-desc or size", cfg.Parsing.Order)
+	}
+
+	if _, err := cfg.Dedupe.WindowDuration(); err != nil {
+		return err
+	}
+	if _, err := cfg.Sonarr.LookupCacheDuration(); err != nil {
+		return err
+	}
+
+	if _, err := cfg.Sonarr.FreeSpaceMarginBytes(); err != nil {
+		return fmt.Errorf("invalid sonarr.freeSpaceMargin: %w", err)
+	}
+
+	for name, g := range cfg.Groups {
+		for quality, sonarrQuality := range g.Qualities {
+			if _, ok := sonarr.QualityByName(sonarrQuality); !ok {
+				return fmt.Errorf("invalid groups.%s.qualities.%s: %q is not a Sonarr quality", name, quality, sonarrQuality)
+			}
+		}
+		if _, ok := sonarr.LanguageByName(g.Language); g.Language != "" && !ok {
+			return fmt.Errorf("invalid groups.%s.language: %q is not a Sonarr language", name, g.Language)
+		}
+	}
+
+	return nil
+}
+
+// scanState is what the files of one scan share.
+type scanState struct {
+	id       string
+	series   *seriesTracker
+	space    *spaceBudget
+	episodes *episodeClaims
+	missing  *missingEpisodes
+	paths    *seriesPaths
+	pins     *pinnedDirs
+	previews *importPreviews
+}
+
+func newScanState(id string) *scanState {
+	return &scanState{id: id, series: newSeriesTracker(), space: newSpaceBudget(), episodes: newEpisodeClaims(), missing: newMissingEpisodes(), paths: newSeriesPaths(), pins: newPinnedDirs(), previews: newImportPreviews()}
+}
+
+// run processes every file received on files with the configured number of
+// workers and collects the results. With skip, which full scans set, ignored
+// files and those of the retry queue that are not due are left alone. When
+// rescan is not nil it is called once the files are done, and the files it
+// returns are processed as the second pass of the scan; it also returns the
+// number of files it left for the next scan.
+func (im *Importer) run(ctx context.Context, files <-chan videoFile, skip bool, rescan func() ([]videoFile, int)) *ScanResult {
+	result := newScanResult(im.Config.Sonarr.DownloadsFolder)
+	usage := im.apiUsage()
+	im.scanStarted(result)
+
+	// Cancelling ctx stops new files from being picked up, but a file that is
+	// halfway through its import gets DrainTimeout to finish so a freshly
+	// added series is not left without its episode.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	stopDrain := context.AfterFunc(ctx, func() {
+		im.Logger.Warnf("Shutdown requested, waiting up to %v for in-flight files", im.Options.DrainTimeout)
+		timer := time.NewTimer(im.Options.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelWork()
+		case <-workCtx.Done():
+		}
+	})
+	defer stopDrain()
+
+	workers := im.Config.Parsing.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	loadTorrents := func() {}
+	if im.Torrents != nil {
+		loadTorrents = sync.OnceFunc(func() { im.Torrents.Load(workCtx) })
+	}
+
+	scan := newScanState(result.ID)
+	results := make(chan FileResult)
+	var deferred, ignored, seeding, inRoot atomic.Int64
+	process := func(files <-chan videoFile, second bool) {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for file := range files {
+					if ctx.Err() != nil {
+						return
+					}
+					if skip && im.Ignore != nil && im.Ignore.Ignored(file.path) {
+						ignored.Add(1)
+						continue
+					}
+					if skip && im.Retry != nil && !im.Retry.Due(file.path) {
+						im.Logger.Debugf("Leaving %s for its retry", filepath.Base(file.path))
+						deferred.Add(1)
+						continue
+					}
+					if real, root := im.inRootFolder(file.path); root != "" {
+						im.Logger.Warnf("Skipping %s, its real path %s is inside Sonarr root folder %s", file.path, real, root)
+						inRoot.Add(1)
+						continue
+					}
+					var importMode string
+					if im.Torrents != nil {
+						loadTorrents()
+						if reason := im.Torrents.Busy(file.path); reason != "" {
+							if im.Config.QBittorrent.TorrentAction() != config.TorrentCopy {
+								im.Logger.Infof("Skipping %s, its %s", filepath.Base(file.path), reason)
+								seeding.Add(1)
+								continue
+							}
+							im.Logger.Infof("Importing a copy of %s, its %s", filepath.Base(file.path), reason)
+							importMode = "copy"
+						}
+					}
+					fileResult := im.processFile(workCtx, scan, file, importMode)
+					fileResult.Rescan = second
+					im.logFileResult(fileResult)
+					for _, o := range im.Observers {
+						o.FileProcessed(fileResult)
+					}
+					results <- fileResult
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for fileResult := range results {
+			result.add(fileResult)
+		}
+	}()
+
+	process(files, false)
+	unsettled := 0
+	if rescan != nil {
+		var fresh []videoFile
+		if fresh, unsettled = rescan(); len(fresh) > 0 {
+			process(sendFiles(ctx, fresh), true)
+		}
+	}
+	close(results)
+	<-collected
+	if unsettled > 0 {
+		result.rescan().Unsettled = unsettled
+	}
+	result.Deferred = int(deferred.Load())
+	result.Ignored = int(ignored.Load())
+	result.Seeding = int(seeding.Load())
+	result.InRootFolder = int(inRoot.Load())
+	result.DiskSpace = scan.space.shortageList()
+	result.UnavailablePaths = scan.paths.list()
+	if im.Retry != nil {
+		result.RetryQueue = im.Retry.Len()
+	}
+	result.Interrupted = ctx.Err() != nil
+	result.SonarrAPI = im.usageSince(usage)
+	result.finish()
+	return result
+}
+
+// ProcessAnimeFile parses a single file and imports it into Sonarr, adding the
+// series first when it is not in the library yet. Its size is not known, so
+// it is imported without checking free space.
+func (im *Importer) ProcessAnimeFile(ctx context.Context, filePath string) FileResult {
+	return im.processFile(ctx, newScanState(""), videoFile{path: filePath}, "")
+}
+
+// processFile processes file as part of scan within parsing.fileTimeout. A
+// file that runs out of time fails with ErrFileTimeout, which the retry queue
+// takes as transient. A non-empty importMode overrides the import mode of
+// Sonarr or Radarr.
+func (im *Importer) processFile(ctx context.Context, scan *scanState, file videoFile, importMode string) FileResult {
+	started := time.Now()
+	result := FileResult{Path: file.path, ScanID: scan.id, Size: file.size, ModTime: file.modTime, ImportMode: importMode}
+	fileCtx := ctx
+	timeout, _ := im.Config.Parsing.FileTimeoutDuration()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		fileCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := im.processAnimeFile(fileCtx, scan, &result); err != nil {
+		if ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+			elapsed := time.Since(started)
+			result.Timeout = &Timeout{Limit: timeout, Step: result.step, Elapsed: elapsed}
+			err = fmt.Errorf("%w in %s after %v (parsing.fileTimeout is %v)", ErrFileTimeout, result.step, elapsed.Round(time.Millisecond), timeout)
+		}
+		result.fail(err)
+	}
+	if result.Plan != nil && importMode != "" {
+		result.Plan.ImportMode = importMode
+		result.Plan.Warnings = append(result.Plan.Warnings, "its torrent still needs it, so a copy would be imported")
+	}
+	result.Duration = time.Since(started)
+	if result.Action == ActionImported {
+		result.ImportedAt = time.Now()
+		if !result.ModTime.IsZero() && result.ImportedAt.After(result.ModTime) {
+			result.Latency = result.ImportedAt.Sub(result.ModTime)
+		}
+	}
+	return result
+}
+
+func (im *Importer) processAnimeFile(ctx context.Context, scan *scanState, result *FileResult) error {
+	fileName := filepath.Base(result.Path)
+	im.Logger.Debugf("Processing file: %s", fileName)
+	result.step = "parse"
+	if err := checkReadable(result.Path); err != nil {
+		return err
+	}
+
+	if im.Radarr != nil {
+		if movie, ok := im.Parser.ParseMovie(fileName); ok {
+			if err := checkEncoding(result.Path); err != nil {
+				return err
+			}
+			return im.processMovie(ctx, movie, result)
+		}
+	}
+
+	// Parse anime information from filename
+	anime, err := im.Parser.Parse(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to parse anime info: %w", err)
+	}
+	anime.FilePath = result.Path
+	result.Parsed = anime
+	if err := checkEncoding(result.Path); err != nil {
+		return err
+	}
+	if result.Renumbered = im.renumberCour(anime); result.Renumbered != "" {
+		im.Logger.Infof("Renumbered %s: %s", fileName, result.Renumbered)
+	}
+
+	im.Logger.Infof("Parsed: %s %s", anime.Title, anime.Label())
+	im.step(StepParsed, result)
+
+	inst := im.route(result.Path, anime)
+	if im.MultiInstance() {
+		result.Instance = inst.Name
+		im.Logger.Debugf("Routing %s to Sonarr instance %s", fileName, inst.Name)
+	}
+	inst = im.withSeriesType(inst, anime)
+	inst, result.Folder = im.withFolder(inst, result.Path)
+	if result.Folder != "" {
+		im.Logger.Debugf("Using the settings of folder %s for %s", result.Folder, fileName)
+	}
+	if result.Pin, err = im.pin(scan.pins, result.Path); err != nil {
+		return err
+	}
+	if result.Pin != nil {
+		im.Logger.Debugf("Using series %s of %s for %s", result.Pin, result.Pin.Path, fileName)
+	}
+
+	if im.Options.DryRun {
+		result.step = "plan"
+		if err := im.planImport(ctx, inst, anime, result); err != nil {
+			return err
+		}
+		im.crossCheck(ctx, scan.previews, inst, result)
+		if !result.Plan.NewSeries {
+			if err := im.checkSeriesPath(ctx, scan, inst, result); err != nil {
+				return err
+			}
+			if err := im.checkMissing(ctx, scan.missing, inst, result); err != nil {
+				return err
+			}
+			if err := im.checkFingerprint(ctx, result); err != nil {
+				return err
+			}
+		}
+		if _, err := im.claim(scan.episodes, inst, result.Plan.TvdbID, anime); err != nil {
+			return err
+		}
+		result.Action = ActionDryRun
+		return nil
+	}
+
+	// Step 1: Find or create series in Sonarr, checking that the file fits in
+	// its root folder before a new series is added for it
+	result.step = "series lookup"
+	release := func() {}
+	beforeAdd := func(path string) error {
+		var err error
+		release, err = im.reserve(ctx, scan.space, inst, path, result.Size)
+		return err
+	}
+	series, added, err := im.findOrCreateSeries(ctx, inst, anime, result.Pin, beforeAdd)
+	if err != nil {
+		release()
+		if errors.Is(err, ErrInsufficientSpace) {
+			return err
+		}
+		var apiErr *sonarr.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("failed to find/create series (check the Sonarr API key): %w", err)
+		}
+		var approval *approvalError
+		if errors.As(err, &approval) {
+			result.PendingSeries = &approval.series
+			return err
+		}
+		return fmt.Errorf("failed to find/create series: %w", err)
+	}
+	result.SeriesID = series.ID
+	result.SeriesTitle = series.Title
+	result.SeriesPath = series.Path
+	result.SeriesAdded = added
+	im.inferSeason(ctx, inst, series, anime)
+	im.crossCheck(ctx, scan.previews, inst, result)
+	if added {
+		im.step(StepSeriesAdded, result)
+	} else if err := im.checkSeriesPath(ctx, scan, inst, result); err != nil {
+		return err
+	} else if err := im.checkMissing(ctx, scan.missing, inst, result); err != nil {
+		return err
+	} else if err := im.checkFingerprint(ctx, result); err != nil {
+		return err
+	}
+
+	key := seriesKey{instance: inst.Name, id: series.ID}
+	scan.series.use(key, added)
+	unclaim, err := im.claim(scan.episodes, inst, series.TvdbID, anime)
+	if err == nil && !added {
+		result.step = "space check"
+		release, err = im.reserve(ctx, scan.space, inst, series.Path, result.Size)
+	}
+	if err == nil {
+		err = im.importEpisode(ctx, inst, anime, result)
+	}
+	if err != nil {
+		unclaim()
+		release()
+		im.rollbackSeries(ctx, inst, scan.series, result, err)
+		return err
+	}
+	scan.series.done(key, true, added)
+
+	result.Action = ActionImported
+	return nil
+}
+
+// importEpisode imports the file of result as the episodes of anime into
+// the series of result. A range is only imported when the series has every
+// episode of it.
+func (im *Importer) importEpisode(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, result *FileResult) error {
+	// Step 2: Get episode information
+	result.step = "episode lookup"
+	episodes, err := im.findEpisodes(ctx, inst, result.SeriesID, anime)
+	if errors.Is(err, errNotListedYet) {
+		episodes, err = im.awaitMetadata(ctx, inst, result.SeriesID, anime, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find episode: %w", err)
+	}
+	result.EpisodeID = episodes[0].ID
+	result.Upgrade = hasFile(episodes)
+
+	// Step 3: Import file using manual import
+	result.step = "import"
+	if err := im.manualImport(ctx, inst, anime, result.SeriesID, episodeIDs(episodes), result.ImportMode); err != nil {
+		return fmt.Errorf("failed to import file: %w", err)
+	}
+	return im.verifyImport(ctx, inst, anime, result, episodes)
+}
+
+// findOrCreateSeries returns the library series for anime in inst, adding it
+// from the first lookup result when it is missing. added reports whether the
+// series was created by this call. A non-nil beforeAdd is called with the
+// path of a missing series before it is added, which its error prevents. A
+// non-nil pin picks the series instead of the title of anime.
+func (im *Importer) findOrCreateSeries(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, pin *Pin, beforeAdd func(path string) error) (series *sonarr.Series, added bool, err error) {
+	if pin != nil {
+		series, option, err := im.findPinned(ctx, inst, pin)
+		if err != nil || series != nil {
+			return series, false, err
+		}
+		return im.addPicked(ctx, inst, *option, anime.Season, beforeAdd)
+	}
+	if tvdbID := im.alias(anime.Title); tvdbID != 0 {
+		return im.findOrCreateAliased(ctx, inst, "alias of "+anime.Title, tvdbID, anime.Season, beforeAdd)
+	}
+
+	// First, try to find existing series
+	series, err = im.findExistingSeries(ctx, inst, anime.Title)
+	if err == nil {
+		im.Logger.Infof("Found existing series: %s (ID: %d)", series.Title, series.ID)
+		return series, false, nil
+	}
+	if errors.Is(err, ErrDuplicateSeries) {
+		return nil, false, err
+	}
+	if !errors.Is(err, ErrSeriesNotFound) {
+		// The library could not be read, so adding the series might duplicate it
+		return nil, false, fmt.Errorf("failed to read series library: %w", err)
+	}
+
+	if err := im.cachedMiss(inst, anime.Title); err != nil {
+		return nil, false, err
+	}
+	im.Logger.Infof("Series not found, searching TVDB for: %s", anime.Title)
+
+	// Search for series on TVDB via Sonarr
+	seriesOptions, err := im.lookupSeries(ctx, inst, anime.Title)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search for series: %w", err)
+	}
+
+	if len(seriesOptions) == 0 {
+		im.recordMiss(inst, anime.Title)
+		return nil, false, fmt.Errorf("%w: no lookup results for %s", ErrSeriesNotFound, anime.Title)
+	}
+
+	// Take the best ranked result
+	selectedSeries := seriesOptions[0]
+	im.Logger.Infof("Found series option: %s (%d)", selectedSeries.Title, selectedSeries.Year)
+
+	if inst.Config.ConfirmNewSeries {
+		return nil, false, &approvalError{series: NewSeries{Title: selectedSeries.Title, Year: selectedSeries.Year, TvdbID: selectedSeries.TvdbID}}
+	}
+
+	if beforeAdd != nil {
+		if err := beforeAdd(inst.Config.SeriesPath(selectedSeries.TitleSlug)); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Add series to Sonarr
+	return im.addSeries(ctx, inst, selectedSeries, anime.Season)
+}
+
+// alias returns the TVDB ID that Aliases or else the rules file map title
+// to, or 0.
+func (im *Importer) alias(title string) int {
+	if im.Aliases != nil {
+		if tvdbID := im.Aliases.TvdbID(title); tvdbID != 0 {
+			return tvdbID
+		}
+	}
+	return im.Config.RuleAlias(title)
+}
+
+// findOrCreateAliased returns the series with tvdbID, adding it when it is
+// not in the library yet. source says what picked the series, such as the
+// alias of a title, for the log. season is the season of the file, and
+// beforeAdd is that of findOrCreateSeries.
+func (im *Importer) findOrCreateAliased(ctx context.Context, inst *Instance, source string, tvdbID, season int, beforeAdd func(path string) error) (*sonarr.Series, bool, error) {
+	series, option, err := im.findAliased(ctx, inst, source, tvdbID)
+	if err != nil || series != nil {
+		return series, false, err
+	}
+	return im.addPicked(ctx, inst, *option, season, beforeAdd)
+}
+
+// addPicked adds the series of option, which an alias or a pin picked, for
+// a file of season, calling beforeAdd first when it is not nil.
+func (im *Importer) addPicked(ctx context.Context, inst *Instance, option sonarr.SeriesLookup, season int, beforeAdd func(path string) error) (*sonarr.Series, bool, error) {
+	if beforeAdd != nil {
+		if err := beforeAdd(inst.Config.SeriesPath(option.TitleSlug)); err != nil {
+			return nil, false, err
+		}
+	}
+	return im.addSeries(ctx, inst, option, season)
+}
+
+// findAliased returns the library series with tvdbID or, when it is not in
+// the library yet, the lookup result it would be added from. source is that
+// of findOrCreateAliased.
+func (im *Importer) findAliased(ctx context.Context, inst *Instance, source string, tvdbID int) (*sonarr.Series, *sonarr.SeriesLookup, error) {
+	library, err := inst.Client.GetSeries(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read series library: %w", err)
+	}
+	var candidates []*sonarr.Series
+	for i, s := range library {
+		if s.TvdbID == tvdbID {
+			candidates = append(candidates, &library[i])
+		}
+	}
+	if len(candidates) > 0 {
+		series, err := im.pickSeries(inst, fmt.Sprintf("TVDB ID %d", tvdbID), candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		im.Logger.Infof("Found existing series: %s (ID: %d, %s)", series.Title, series.ID, source)
+		return series, nil, nil
+	}
+
+	results, err := inst.Client.LookupSeries(ctx, fmt.Sprintf("tvdb:%d", tvdbID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search for series: %w", err)
+	}
+	for i, result := range results {
+		if result.TvdbID == tvdbID {
+			im.Logger.Infof("Found series option: %s (%d, %s)", result.Title, result.Year, source)
+			return nil, &results[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: no series with TVDB ID %d (%s)", ErrSeriesNotFound, tvdbID, source)
+}
+
+// findExistingSeries returns the library series of inst called title. Titles
+// are compared in the form of parser.NormalizeTitle, first with the title and
+// sort title of every series and then with their alternate titles, so the
+// alternate title of one series does not shadow the title of another. When
+// several series match, pickSeries decides.
+func (im *Importer) findExistingSeries(ctx context.Context, inst *Instance, title string) (*sonarr.Series, error) {
+	series, err := inst.Client.GetSeries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := parser.NormalizeTitle(title)
+	if normalized == "" {
+		return nil, ErrSeriesNotFound
+	}
+	matched := func(s sonarr.Series, name, kind string) {
+		im.Logger.Debugf("Matched %q (normalized %q) to series %s by its %s %q (normalized %q)",
+			title, normalized, s.Title, kind, name, parser.NormalizeTitle(name))
+	}
+	var candidates []*sonarr.Series
+	for i, s := range series {
+		for _, name := range []string{s.Title, s.SortTitle} {
+			if parser.NormalizeTitle(name) == normalized {
+				matched(s, name, "title")
+				candidates = append(candidates, &series[i])
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		for i, s := range series {
+			for _, alt := range s.AlternateTitles {
+				if parser.NormalizeTitle(alt.Title) == normalized {
+					matched(s, alt.Title, "alternate title")
+					candidates = append(candidates, &series[i])
+					break
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrSeriesNotFound
+	}
+	return im.pickSeries(inst, strconv.Quote(title), candidates)
+}
+
+// lookupSeries searches TVDB through Sonarr for title and for its
+// parser.LookupTerm, when that differs, merging the results, and when both
+// find nothing, for its normalized form. Results whose title matches title
+// once normalized are ranked first; the others keep the order of Sonarr, with
+// those of title before those of its lookup term. The lookup only fails when
+// every term does.
+func (im *Importer) lookupSeries(ctx context.Context, inst *Instance, title string) ([]sonarr.SeriesLookup, error) {
+	terms := []string{title}
+	if term := parser.LookupTerm(title); term != "" && term != title {
+		terms = append(terms, term)
+	}
+	results, err := im.lookupTerms(ctx, inst, terms)
+	if err != nil {
+		return nil, err
+	}
+	normalized := parser.NormalizeTitle(title)
+	if len(results) == 0 && normalized != "" && !slices.ContainsFunc(terms, func(t string) bool { return normalized == strings.ToLower(strings.TrimSpace(t)) }) {
+		im.Logger.Debugf("No lookup results for %q, searching for %q", title, normalized)
+		if results, err = inst.Client.LookupSeries(ctx, normalized); err != nil {
+			return nil, err
+		}
+	}
+
+	exact := func(r sonarr.SeriesLookup) bool { return parser.NormalizeTitle(r.Title) == normalized }
+	sort.SliceStable(results, func(i, j int) bool { return exact(results[i]) && !exact(results[j]) })
+	if len(results) > 0 && exact(results[0]) {
+		im.Logger.Debugf("Lookup result %s matches %q (normalized %q)", results[0].Title, title, normalized)
+	}
+	return results, nil
+}
+
+// lookupTerms looks up every term in order and returns the results, each
+// series once. It fails only when every lookup does.
+func (im *Importer) lookupTerms(ctx context.Context, inst *Instance, terms []string) ([]sonarr.SeriesLookup, error) {
+	var results []sonarr.SeriesLookup
+	var firstErr error
+	failed := 0
+	for i, term := range terms {
+		if i > 0 {
+			im.Logger.Debugf("Also searching for %q", term)
+		}
+		found, err := inst.Client.LookupSeries(ctx, term)
+		if err != nil {
+			im.Logger.Debugf("Lookup of %q failed: %v", term, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		for _, r := range found {
+			if !slices.ContainsFunc(results, func(prev sonarr.SeriesLookup) bool { return sameLookup(prev, r) }) {
+				results = append(results, r)
+			}
+		}
+	}
+	if failed == len(terms) {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// sameLookup reports whether the lookup results a and b are the same series.
+func sameLookup(a, b sonarr.SeriesLookup) bool {
+	if a.TvdbID != 0 || b.TvdbID != 0 {
+		return a.TvdbID == b.TvdbID
+	}
+	return a.TitleSlug == b.TitleSlug
+}
+
+// addSeries adds the series of seriesLookup to inst for a file of season,
+// which decides the monitored seasons unless all of them are. When another
+// file of the scan added the series first, addSeries returns that series and
+// added is false.
+func (im *Importer) addSeries(ctx context.Context, inst *Instance, seriesLookup sonarr.SeriesLookup, season int) (_ *sonarr.Series, added bool, _ error) {
+	if seriesLookup.TvdbID != 0 {
+		defer im.adding.lock(addKey{instance: inst.Name, tvdbID: seriesLookup.TvdbID})()
+		existing, err := im.addedMeanwhile(ctx, inst, seriesLookup.TvdbID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read series library: %w", err)
+		}
+		if existing != nil {
+			im.Logger.Infof("Found existing series: %s (ID: %d, added by another file)", existing.Title, existing.ID)
+			return existing, false, nil
+		}
+	}
+
+	cfg := inst.Config
+	series := sonarr.Series{
+		Title:             seriesLookup.Title,
+		SortTitle:         seriesLookup.SortTitle,
+		Status:            seriesLookup.Status,
+		Overview:          seriesLookup.Overview,
+		Network:           seriesLookup.Network,
+		Images:            seriesLookup.Images,
+		Seasons:           monitorSeasons(cfg.MonitorSeasons, seriesLookup.Seasons, season),
+		Year:              seriesLookup.Year,
+		Path:              im.newSeriesPath(ctx, inst, seriesLookup),
+		QualityProfileID:  cfg.QualityProfile,
+		LanguageProfileID: cfg.LanguageProfile,
+		SeasonFolder:      true,
+		Monitored:         true,
+		UseSceneNumbering: false,
+		SeriesType:        cfg.SeriesType,
+		TvdbID:            seriesLookup.TvdbID,
+		TitleSlug:         seriesLookup.TitleSlug,
+		RootFolderPath:    cfg.RootFolder,
+		Genres:            seriesLookup.Genres,
+		Tags:              append([]int{}, inst.Tags...),
+		AddOptions: sonarr.AddOptions{
+			IgnoreEpisodesWithFiles:    cfg.AddOptions.IgnoreEpisodesWithFiles,
+			IgnoreEpisodesWithoutFiles: cfg.AddOptions.IgnoreEpisodesWithoutFiles,
+			SearchForMissingEpisodes:   cfg.AddOptions.SearchForMissingEpisodes,
+		},
+	}
+
+	addedSeries, err := inst.Client.AddSeries(ctx, series)
+	if err != nil {
+		return nil, false, err
+	}
+
+	im.Logger.Infof("Added new series: %s (ID: %d)", addedSeries.Title, addedSeries.ID)
+	if cfg.MonitorSeasons != "" && cfg.MonitorSeasons != "all" {
+		im.Logger.Infof("Monitoring %s of %s", formatSeasons(monitoredSeasons(series.Seasons)), addedSeries.Title)
+	}
+	return addedSeries, true, nil
+}
+
+// monitorSeasons returns seasons, those of a lookup result, monitoring the
+// seasons that mode picks for a file of season. Modes other than "file" and
+// "fileAndFuture" keep the flags of the lookup. The season of the file is
+// added when the lookup does not list it yet. Specials are only monitored
+// when the file is one.
+func monitorSeasons(mode string, seasons []sonarr.Season, season int) []sonarr.Season {
+	if mode != "file" && mode != "fileAndFuture" {
+		return seasons
+	}
+	out := make([]sonarr.Season, 0, len(seasons)+1)
+	listed := false
+	for _, s := range seasons {
+		listed = listed || s.SeasonNumber == season
+		s.Monitored = s.SeasonNumber == season ||
+			mode == "fileAndFuture" && s.SeasonNumber > season && s.SeasonNumber > 0
+		out = append(out, s)
+	}
+	if !listed {
+		out = append(out, sonarr.Season{SeasonNumber: season, Monitored: true})
+		slices.SortFunc(out, func(a, b sonarr.Season) int { return a.SeasonNumber - b.SeasonNumber })
+	}
+	return out
+}
+
+// monitoredSeasons returns the numbers of the monitored ones of seasons.
+func monitoredSeasons(seasons []sonarr.Season) []int {
+	numbers := []int{}
+	for _, s := range seasons {
+		if s.Monitored {
+			numbers = append(numbers, s.SeasonNumber)
+		}
+	}
+	return numbers
+}
+
+// formatSeasons lists the season numbers, as in "seasons 2, 3", or says
+// that there are none.
+func formatSeasons(numbers []int) string {
+	if len(numbers) == 0 {
+		return "no seasons"
+	}
+	list := make([]string, len(numbers))
+	for i, n := range numbers {
+		list[i] = strconv.Itoa(n)
+	}
+	if len(numbers) == 1 {
+		return "season " + list[0]
+	}
+	return "seasons " + strings.Join(list, ", ")
+}
+
+// findEpisodes returns the episodes of anime in the series with seriesID, in
+// order. It fails with ErrEpisodeNotFound unless the series has every one of
+// them, wrapping errNotListedYet when the season lists fewer episodes than
+// the missing one.
+func (im *Importer) findEpisodes(ctx context.Context, inst *Instance, seriesID int, anime *parser.ParsedAnime) ([]sonarr.Episode, error) {
+	episodes, err := inst.Client.GetEpisodes(ctx, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	if len(episodes) == 0 {
+		return nil, fmt.Errorf("%w: %s: %w", ErrEpisodeNotFound, anime.Label(), errNoEpisodesYet)
+	}
+
+	var found []sonarr.Episode
+	for _, number := range anime.Episodes() {
+		i := slices.IndexFunc(episodes, func(e sonarr.Episode) bool {
+			return e.SeasonNumber == anime.Season && e.EpisodeNumber == number
+		})
+		if i < 0 {
+			err := fmt.Errorf("%w: %s", ErrEpisodeNotFound, anime.Label())
+			if anime.EndEpisode > anime.Episode {
+				err = fmt.Errorf("%w: S%02dE%02d of %s", ErrEpisodeNotFound, anime.Season, number, anime.Label())
+			}
+			if notListedYet(episodes, anime.Season, number) {
+				err = fmt.Errorf("%w: %w", err, errNotListedYet)
+			}
+			return nil, err
+		}
+		found = append(found, episodes[i])
+	}
+	return found, nil
+}
+
+// episodeIDs returns the IDs of episodes.
+func episodeIDs(episodes []sonarr.Episode) []int {
+	ids := make([]int, len(episodes))
+	for i, e := range episodes {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+// hasFile reports whether one of episodes has a file already.
+func hasFile(episodes []sonarr.Episode) bool {
+	return slices.ContainsFunc(episodes, func(e sonarr.Episode) bool { return e.HasFile })
+}
+
+func (im *Importer) manualImport(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, seriesID int, episodeIDs []int, importMode string) error {
+	err := inst.Client.ManualImport(ctx, sonarr.ManualImportRequest{
+		Files:      []sonarr.ManualImportFile{im.importFile(anime, seriesID, episodeIDs)},
+		ImportMode: importMode,
+	})
+	return sonarrFSError(err)
+}
+
+// importFile is the manual import entry sent for anime, with the quality and
+// language of the profile of its release group.
+func (im *Importer) importFile(anime *parser.ParsedAnime, seriesID int, episodeIDs []int) sonarr.ManualImportFile {
+	file := sonarr.ManualImportFile{
+		Path:         anime.FilePath,
+		SeriesID:     seriesID,
+		SeasonNumber: anime.Season,
+		Episodes:     episodeIDs,
+		Quality: sonarr.Quality{
+			ID:   1, // You might want to determine this based on anime.Quality
+			Name: "HDTV-1080p",
+		},
+		Language: sonarr.Language{
+			ID:   1,
+			Name: "English",
+		},
+	}
+	if anime.Profile == "" {
+		return file
+	}
+	group, _ := im.Config.Group(anime.Profile)
+	if quality, ok := sonarr.QualityByName(group.Quality(anime.Quality)); ok {
+		im.Logger.Debugf("Importing %s as %s, the quality the profile of release group %s maps %s to", anime.OriginalFilename, quality.Name, anime.Profile, anime.Quality)
+		file.Quality = quality
+	}
+	if language, ok := sonarr.LanguageByName(group.Language); ok {
+		im.Logger.Debugf("Importing %s in %s, the language of release group %s", anime.OriginalFilename, language.Name, anime.Profile)
+		file.Language = language
+	}
+	return file
+}
@@ -0,0 +1,366 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// newTestImporter returns an importer of the default configuration talking
+// to srv, with an empty downloads folder of its own.
+func newTestImporter(t *testing.T, srv *sonarrtest.Server, opts Options) *Importer {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Sonarr.URL = srv.URL
+	cfg.Sonarr.APIKey = sonarrtest.APIKey
+	cfg.Sonarr.DownloadsFolder = t.TempDir()
+	cfg.StateDir = t.TempDir()
+	if err := cfg.LoadPresets(filepath.Join(cfg.StateDir, "config.json"), nil); err != nil {
+		t.Fatal(err)
+	}
+	return New(&cfg, srv.Client(), logging.New(io.Discard, logging.LevelDebug), opts)
+}
+
+// addFiles creates empty files with the given names in the downloads folder
+// of im.
+func addFiles(t *testing.T, im *Importer, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(im.Config.Sonarr.DownloadsFolder, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scan runs a full scan of im and fails the test when it cannot start.
+func scan(t *testing.T, im *Importer) *ScanResult {
+	t.Helper()
+	result, err := im.ProcessAnimeFiles(context.Background())
+	if result == nil {
+		t.Fatalf("ProcessAnimeFiles: %v", err)
+	}
+	return result
+}
+
+// episodes returns the episodes 1 to n of season 1.
+func episodes(n int) []sonarr.Episode {
+	eps := make([]sonarr.Episode, n)
+	for i := range eps {
+		eps[i] = sonarr.Episode{SeasonNumber: 1, EpisodeNumber: i + 1, Monitored: true}
+	}
+	return eps
+}
+
+// fileResult returns the result of the file called name.
+func fileResult(t *testing.T, result *ScanResult, name string) FileResult {
+	t.Helper()
+	for _, f := range result.Files {
+		if filepath.Base(f.Path) == name {
+			return f
+		}
+	}
+	t.Fatalf("no result for %s in %+v", name, result.Files)
+	return FileResult{}
+}
+
+// frieren is the lookup result of the series of the tests.
+var frieren = sonarr.SeriesLookup{Title: "Frieren", TitleSlug: "frieren", TvdbID: 424536, Seasons: []sonarr.Season{{SeasonNumber: 1}}}
+
+func TestImportersShareNoState(t *testing.T) {
+	dry, live := sonarrtest.New(), sonarrtest.New()
+	defer dry.Close()
+	defer live.Close()
+	dry.AddLookup("Frieren", frieren, episodes(28)...)
+	live.AddLookup("Frieren", frieren, episodes(28)...)
+
+	dryIm := newTestImporter(t, dry, Options{DryRun: true})
+	dryIm.Client.SetReadOnly()
+	liveIm := newTestImporter(t, live, Options{})
+	addFiles(t, dryIm, "[SubsPlease] Frieren - 05 (1080p).mkv")
+	addFiles(t, liveIm, "[SubsPlease] Frieren - 06 (1080p).mkv", "[SubsPlease] Frieren - 07 (1080p).mkv")
+
+	results := make(chan *ScanResult, 2)
+	for _, im := range []*Importer{dryIm, liveIm} {
+		go func(im *Importer) {
+			r, _ := im.ProcessAnimeFiles(context.Background())
+			results <- r
+		}(im)
+	}
+	for i := 0; i < 2; i++ {
+		if r := <-results; r == nil {
+			t.Fatal("a scan could not start")
+		}
+	}
+
+	if n := len(dry.Imports()); n != 0 || len(dry.Series()) != 0 {
+		t.Errorf("dry run changed its Sonarr: %d import(s), %d series", n, len(dry.Series()))
+	}
+	if n := len(live.Imports()); n != 2 {
+		t.Errorf("live run sent %d import(s), want 2", n)
+	}
+	for _, imp := range live.Imports() {
+		if filepath.Dir(imp.Files[0].Path) != liveIm.Config.Sonarr.DownloadsFolder {
+			t.Errorf("live run imported %s from outside its downloads folder", imp.Files[0].Path)
+		}
+	}
+}
+
+const frierenFile = "[SubsPlease] Frieren - 05 (1080p).mkv"
+
+func TestSeriesAddedAndImported(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	if f.Action != ActionImported || !f.SeriesAdded {
+		t.Fatalf("result = %s (added %v), err %v; want an added series and an import", f.Action, f.SeriesAdded, f.Err)
+	}
+
+	series := srv.Series()
+	if len(series) != 1 || series[0].TvdbID != frieren.TvdbID || series[0].ID != f.SeriesID {
+		t.Fatalf("library = %+v, want Frieren as series %d", series, f.SeriesID)
+	}
+	if series[0].Path != "/tv/frieren" {
+		t.Errorf("series path = %q, want /tv/frieren", series[0].Path)
+	}
+	imports := srv.Imports()
+	if len(imports) != 1 || len(imports[0].Files) != 1 {
+		t.Fatalf("imports = %+v, want the one file", imports)
+	}
+	file := imports[0].Files[0]
+	if file.Path != filepath.Join(im.Config.Sonarr.DownloadsFolder, frierenFile) || file.SeriesID != f.SeriesID ||
+		file.SeasonNumber != 1 || len(file.Episodes) != 1 || file.Episodes[0] != f.EpisodeID {
+		t.Errorf("imported %+v, want episode %d of series %d", file, f.EpisodeID, f.SeriesID)
+	}
+
+	// The next scan finds the series in the library
+	addFiles(t, im, "[SubsPlease] Frieren - 06 (1080p).mkv")
+	f = fileResult(t, scan(t, im), "[SubsPlease] Frieren - 06 (1080p).mkv")
+	if f.Action != ActionImported || f.SeriesAdded {
+		t.Errorf("second file = %s (added %v), err %v; want it imported to the existing series", f.Action, f.SeriesAdded, f.Err)
+	}
+	if len(srv.Series()) != 1 {
+		t.Errorf("%d series after the second file, want 1", len(srv.Series()))
+	}
+}
+
+func TestSeriesLookupMiss(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	if f.Action != ActionFailed || !errors.Is(f.Err, ErrSeriesNotFound) || f.Category != CategorySeriesNotFound {
+		t.Errorf("result = %s, %s, %v; want ErrSeriesNotFound", f.Action, f.Category, f.Err)
+	}
+	if f.Transient() {
+		t.Error("a lookup miss is transient")
+	}
+	if len(srv.Series()) != 0 || len(srv.Imports()) != 0 {
+		t.Error("a file of an unknown series reached Sonarr")
+	}
+}
+
+func TestSeriesAddRejected(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	srv.Fail(http.MethodPost, "/api/v3/series", http.StatusBadRequest, 1)
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	var apiErr *sonarr.APIError
+	if f.Action != ActionFailed || !errors.As(f.Err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("result = %s, %v; want the 400 of Sonarr", f.Action, f.Err)
+	}
+	if f.Category != CategoryAPI || f.Transient() {
+		t.Errorf("category %s, transient %v; want a permanent API error", f.Category, f.Transient())
+	}
+	if len(srv.Series()) != 0 || len(srv.Imports()) != 0 {
+		t.Errorf("library %+v, imports %+v after the rejected add; want neither", srv.Series(), srv.Imports())
+	}
+}
+
+func TestManualImportFails(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	srv.Fail(http.MethodPut, "/api/v3/manualimport", http.StatusBadRequest, -1)
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	var apiErr *sonarr.APIError
+	if f.Action != ActionFailed || !errors.As(f.Err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("result = %s, %v; want the 400 of the manual import", f.Action, f.Err)
+	}
+	if f.Transient() {
+		t.Error("a rejected manual import is transient")
+	}
+	if len(srv.Imports()) != 0 {
+		t.Errorf("imports = %+v, want none", srv.Imports())
+	}
+}
+
+// TestServerErrorRetried fails the manual import with a 503 once: the file
+// fails transiently, so the retry queue takes it, and the next scan imports
+// it.
+func TestServerErrorRetried(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	srv.Fail(http.MethodPut, "/api/v3/manualimport", http.StatusServiceUnavailable, 1)
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	if f.Action != ActionFailed || f.Category != CategoryUnreachable || !f.Transient() {
+		t.Fatalf("first scan = %s, %s, %v; want a transient failure", f.Action, f.Category, f.Err)
+	}
+
+	f = fileResult(t, scan(t, im), frierenFile)
+	if f.Action != ActionImported || f.SeriesAdded {
+		t.Fatalf("retry = %s (added %v), %v; want an import to the series added before", f.Action, f.SeriesAdded, f.Err)
+	}
+	if len(srv.Series()) != 1 || len(srv.Imports()) != 1 {
+		t.Errorf("%d series and %d import(s) after the retry, want 1 of each", len(srv.Series()), len(srv.Imports()))
+	}
+}
+
+// TestNewSeriesAddedOnce imports several episodes of a series that is not in
+// the library yet with concurrent workers, which must add it only once.
+func TestNewSeriesAddedOnce(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	im := newTestImporter(t, srv, Options{})
+	im.Config.Parsing.Concurrency = 4
+	names := []string{
+		"[SubsPlease] Frieren - 05 (1080p).mkv",
+		"[SubsPlease] Frieren - 06 (1080p).mkv",
+		"[SubsPlease] Frieren - 07 (1080p).mkv",
+		"[SubsPlease] Frieren - 08 (1080p).mkv",
+	}
+	addFiles(t, im, names...)
+
+	result := scan(t, im)
+	added := 0
+	for _, name := range names {
+		f := fileResult(t, result, name)
+		if f.Action != ActionImported {
+			t.Errorf("%s: %s, %v; want it imported", name, f.Action, f.Err)
+		}
+		if f.SeriesAdded {
+			added++
+		}
+	}
+	if len(srv.Series()) != 1 || added != 1 {
+		t.Errorf("%d series in the library, %d file(s) added one; want 1 and 1", len(srv.Series()), added)
+	}
+	if len(srv.Imports()) != len(names) {
+		t.Errorf("%d import(s), want %d", len(srv.Imports()), len(names))
+	}
+}
+
+func TestLookupSeriesSanitizesTerm(t *testing.T) {
+	fgo := sonarr.SeriesLookup{Title: "Fate/Grand Order: Absolute Demonic Front - Babylonia", TitleSlug: "fate-grand-order-babylonia", TvdbID: 359433}
+	stone := sonarr.SeriesLookup{Title: "Dr. STONE", TitleSlug: "dr-stone", TvdbID: 356007}
+	slump := sonarr.SeriesLookup{Title: "Dr. Slump", TitleSlug: "dr-slump", TvdbID: 76218}
+	kon := sonarr.SeriesLookup{Title: "K-On!", TitleSlug: "k-on", TvdbID: 85249}
+	konMovie := sonarr.SeriesLookup{Title: "K-On! Shorts", TitleSlug: "k-on-shorts", TvdbID: 85250}
+
+	srv := sonarrtest.New()
+	defer srv.Close()
+	// Only the sanitized term finds these two, the raw one skews the results
+	srv.AddLookup("Fate Grand Order", fgo)
+	srv.AddLookup("Dr. STONE", slump)
+	srv.AddLookup("Dr STONE", stone)
+	srv.AddLookup("Dr STONE", slump)
+	// Both terms find K-On!, which is listed once
+	srv.AddLookup("K-On!", kon)
+	srv.AddLookup("K-On", konMovie)
+	srv.AddLookup("K-On", kon)
+	im := newTestImporter(t, srv, Options{})
+
+	tests := []struct {
+		title string
+		terms []string
+		want  []int
+	}{
+		{"Fate/Grand Order", []string{"Fate/Grand Order", "Fate Grand Order"}, []int{fgo.TvdbID}},
+		{"Dr. STONE", []string{"Dr. STONE", "Dr STONE"}, []int{stone.TvdbID, slump.TvdbID}},
+		{"K-On!", []string{"K-On!", "K-On"}, []int{kon.TvdbID, konMovie.TvdbID}},
+	}
+	for _, tt := range tests {
+		before := len(srv.Lookups())
+		results, err := im.lookupSeries(context.Background(), im.instances[0], tt.title)
+		if err != nil {
+			t.Errorf("lookupSeries(%q): %v", tt.title, err)
+			continue
+		}
+		var ids []int
+		for _, r := range results {
+			ids = append(ids, r.TvdbID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("lookupSeries(%q) = %v, want %v", tt.title, ids, tt.want)
+		}
+		if terms := srv.Lookups()[before:]; !slices.Equal(terms, tt.terms) {
+			t.Errorf("lookupSeries(%q) looked up %q, want %q", tt.title, terms, tt.terms)
+		}
+	}
+
+	// The lookup only fails when every term does
+	srv.Fail(http.MethodGet, "/api/v3/series/lookup", http.StatusInternalServerError, 1)
+	if results, err := im.lookupSeries(context.Background(), im.instances[0], "Fate/Grand Order"); err != nil || len(results) != 1 {
+		t.Errorf("with the raw term failing, lookupSeries = %+v, %v; want the result of the sanitized term", results, err)
+	}
+	srv.Fail(http.MethodGet, "/api/v3/series/lookup", http.StatusInternalServerError, 2)
+	if _, err := im.lookupSeries(context.Background(), im.instances[0], "Fate/Grand Order"); err == nil {
+		t.Error("lookupSeries succeeded with every term failing")
+	}
+}
+
+func TestPunctuatedTitlesMatchLibrary(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	stone := srv.AddSeries(sonarr.Series{Title: "Dr. STONE", TvdbID: 356007, Path: "/tv/Dr. STONE", Monitored: true}, episodes(24)...)
+	kon := srv.AddSeries(sonarr.Series{Title: "K-On!", TvdbID: 85249, Path: "/tv/K-On!", Monitored: true}, episodes(14)...)
+	im := newTestImporter(t, srv, Options{})
+	files := map[string]int{
+		"[SubsPlease] Dr STONE - 05 (1080p).mkv": stone.ID,
+		"[SubsPlease] K-ON - 03 (1080p).mkv":     kon.ID,
+	}
+	for name := range files {
+		addFiles(t, im, name)
+	}
+
+	result := scan(t, im)
+	for name, id := range files {
+		if f := fileResult(t, result, name); f.Action != ActionImported || f.SeriesID != id || f.SeriesAdded {
+			t.Errorf("%s: %s to series %d (added %v), %v; want an import to series %d", name, f.Action, f.SeriesID, f.SeriesAdded, f.Err, id)
+		}
+	}
+	if len(srv.Lookups()) != 0 {
+		t.Errorf("looked up %q for series in the library", srv.Lookups())
+	}
+}
@@ -0,0 +1,142 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// Instance is a Sonarr instance that files can be imported into. Every
+// lookup for a file goes to the instance it was routed to.
+type Instance struct {
+	Name   string
+	Config config.SonarrConfig
+	Client *sonarr.Client
+	// Tags are given to the series added to the instance.
+	Tags []int
+}
+
+// route is a compiled config.RouteConfig.
+type route struct {
+	instance *Instance
+	folder   string
+	title    *regexp.Regexp
+	quality  string
+}
+
+// AddInstance makes the Sonarr instance name available to the routes. It
+// must be called before the first scan.
+func (im *Importer) AddInstance(name string, cfg config.SonarrConfig, client *sonarr.Client) {
+	im.instances = append(im.instances, &Instance{Name: name, Config: cfg, Client: client})
+}
+
+// CheckQualityProfiles verifies that the quality profile of every instance,
+// and of every folder override, exists in the instance, so a wrong ID is
+// reported at startup rather than as a rejected add. An instance that cannot
+// be reached is only warned about.
+func (im *Importer) CheckQualityProfiles(ctx context.Context) error {
+	for _, inst := range im.instances {
+		profiles, err := inst.Client.QualityProfiles(ctx)
+		if err != nil {
+			im.Logger.Warnf("Cannot check the quality profiles of Sonarr instance %s: %v", inst.Name, err)
+			continue
+		}
+		has := func(id int) bool {
+			return slices.ContainsFunc(profiles, func(p sonarr.QualityProfile) bool { return p.ID == id })
+		}
+		if !has(inst.Config.QualityProfile) {
+			return fmt.Errorf("Sonarr instance %s has no quality profile %d; valid profiles are %s", inst.Name, inst.Config.QualityProfile, QualityProfileList(profiles))
+		}
+		for _, f := range im.folders {
+			if f.QualityProfile != 0 && !has(f.QualityProfile) {
+				return fmt.Errorf("folder %s: Sonarr instance %s has no quality profile %d; valid profiles are %s", f.dir, inst.Name, f.QualityProfile, QualityProfileList(profiles))
+			}
+		}
+	}
+	return nil
+}
+
+// QualityProfileList lists profiles with their IDs, as in "1 (Any), 4
+// (HD-1080p)".
+func QualityProfileList(profiles []sonarr.QualityProfile) string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = fmt.Sprintf("%d (%s)", p.ID, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// compileRoutes resolves the configured routes against the instances. Routes
+// naming an unknown instance or with an invalid title pattern are skipped;
+// config validation reports them.
+func (im *Importer) compileRoutes() []route {
+	byName := make(map[string]*Instance, len(im.instances))
+	for _, inst := range im.instances {
+		byName[inst.Name] = inst
+	}
+
+	routes := make([]route, 0, len(im.Config.Routes))
+	for i, r := range im.Config.Routes {
+		inst := byName[r.Instance]
+		if inst == nil {
+			im.Logger.Warnf("Ignoring routes[%d]: unknown instance %q", i, r.Instance)
+			continue
+		}
+		var title *regexp.Regexp
+		if r.Title != "" {
+			var err error
+			if title, err = regexp.Compile(r.Title); err != nil {
+				im.Logger.Warnf("Ignoring routes[%d]: %v", i, err)
+				continue
+			}
+		}
+		var folder string
+		if r.Folder != "" {
+			folder = filepath.Join(im.Config.Sonarr.DownloadsFolder, r.Folder)
+		}
+		routes = append(routes, route{instance: inst, folder: folder, title: title, quality: r.Quality})
+	}
+	return routes
+}
+
+// matches reports whether the file at path, parsed as anime, meets every
+// condition of r.
+func (r route) matches(path string, anime *parser.ParsedAnime) bool {
+	if r.folder != "" && !hasPathPrefix(path, r.folder) {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(anime.Title) {
+		return false
+	}
+	return r.quality == "" || strings.EqualFold(r.quality, anime.Quality)
+}
+
+// route returns the instance the file at path belongs to.
+func (im *Importer) route(path string, anime *parser.ParsedAnime) *Instance {
+	im.routesOnce.Do(func() { im.routes = im.compileRoutes() })
+	for _, r := range im.routes {
+		if r.matches(path, anime) {
+			return r.instance
+		}
+	}
+	return im.instances[0]
+}
+
+// MultiInstance reports whether files can go to more than one instance, in
+// which case results name the instance of each file.
+func (im *Importer) MultiInstance() bool {
+	return len(im.instances) > 1
+}
+
+// hasPathPrefix reports whether path is dir or lies below it.
+func hasPathPrefix(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
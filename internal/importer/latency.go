@@ -0,0 +1,56 @@
+package importer
+
+import (
+	"sort"
+	"time"
+)
+
+// LatencyStats are percentiles of the time files sat in the downloads folder
+// before their import, from their modification time to the end of the
+// import.
+type LatencyStats struct {
+	// Files is the number of imported files with a known latency.
+	Files int           `json:"files"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// latencyStats returns the percentiles of the latencies of files, or nil when
+// no file has one.
+func latencyStats(files []FileResult) *LatencyStats {
+	var latencies []time.Duration
+	for _, f := range files {
+		if f.Latency > 0 {
+			latencies = append(latencies, f.Latency)
+		}
+	}
+	if len(latencies) == 0 {
+		return nil
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return &LatencyStats{
+		Files: len(latencies),
+		P50:   percentile(latencies, 50),
+		P90:   percentile(latencies, 90),
+		P99:   percentile(latencies, 99),
+		Max:   latencies[len(latencies)-1],
+	}
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// roundLatency rounds d for the summary: to seconds below an hour and to
+// minutes above.
+func roundLatency(d time.Duration) time.Duration {
+	if d < time.Hour {
+		return d.Round(time.Second)
+	}
+	return d.Round(time.Minute)
+}
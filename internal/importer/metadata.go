@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// errNotListedYet is wrapped by the ErrEpisodeNotFound of an episode that
+// is beyond the episodes Sonarr lists for its season, as when a fansub comes
+// out before TVDB lists the episode.
+var errNotListedYet = errors.New("the season does not list that many episodes yet")
+
+const (
+	// refreshTimeout is how long the refresh of a series for an episode it
+	// does not list yet may take.
+	refreshTimeout = 2 * time.Minute
+	// refreshInterval is the time between two reads of the refresh command.
+	refreshInterval = 2 * time.Second
+)
+
+// notListedYet reports whether episode number of season may be missing from
+// episodes only because TVDB does not list it yet: the season is known but
+// has fewer episodes than number, such as the episode after the last one of
+// an airing season.
+func notListedYet(episodes []sonarr.Episode, season, number int) bool {
+	count := 0
+	for _, e := range episodes {
+		if e.SeasonNumber == season {
+			count++
+		}
+	}
+	return count > 0 && count < number
+}
+
+// awaitMetadata refreshes the series with seriesID after findEpisodes failed
+// with cause because the series does not list an episode of anime yet, and
+// looks the episodes up again. It fails with ErrAwaitingMetadata when the
+// episode is still missing, so the file is retried once TVDB lists it.
+func (im *Importer) awaitMetadata(ctx context.Context, inst *Instance, seriesID int, anime *parser.ParsedAnime, cause error) ([]sonarr.Episode, error) {
+	im.Logger.Infof("%s %s is not listed yet, refreshing the series in Sonarr", anime.Title, anime.Label())
+	if err := im.refreshSeries(ctx, inst, seriesID); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		im.Logger.Warnf("Failed to refresh the series of %s %s: %v", anime.Title, anime.Label(), err)
+		return nil, fmt.Errorf("%w: %w", ErrAwaitingMetadata, cause)
+	}
+	episodes, err := im.findEpisodes(ctx, inst, seriesID, anime)
+	if errors.Is(err, errNotListedYet) {
+		return nil, fmt.Errorf("%w: %w, still missing after a refresh", ErrAwaitingMetadata, err)
+	}
+	return episodes, err
+}
+
+// refreshSeries runs RefreshSeries for the series with seriesID and waits up
+// to refreshTimeout for it to finish.
+func (im *Importer) refreshSeries(ctx context.Context, inst *Instance, seriesID int) error {
+	status, err := inst.Client.Command(ctx, sonarr.Command{Name: "RefreshSeries", SeriesID: seriesID})
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(refreshTimeout)
+	for {
+		switch status.Status {
+		case "completed":
+			return nil
+		case "queued", "started":
+		default:
+			return fmt.Errorf("RefreshSeries %s: %s", status.Status, status.Message)
+		}
+		if time.Now().Add(refreshInterval).After(deadline) {
+			return fmt.Errorf("RefreshSeries did not finish within %v", refreshTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(refreshInterval):
+		}
+		if status, err = inst.Client.GetCommand(ctx, status.ID); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package importer
+
+import (
+	"fmt"
+	"time"
+)
+
+// cachedMiss returns an error wrapping ErrSeriesNotFound and ErrLookupCached
+// when the lookup of title on inst found no series within sonarr.lookupCache,
+// so its files count as unmatched without asking Sonarr again. It returns nil
+// without LookupMisses or with a cache of 0.
+func (im *Importer) cachedMiss(inst *Instance, title string) error {
+	ttl, err := inst.Config.LookupCacheDuration()
+	if im.LookupMisses == nil || err != nil || ttl <= 0 {
+		return nil
+	}
+	at, until, ok := im.LookupMisses.Missed(inst.Name, title)
+	if !ok {
+		return nil
+	}
+	im.lookupCacheHits.Add(1)
+	im.Logger.Debugf("Not looking up %s again, its lookup found no series at %s", title, at.Local().Format(time.TimeOnly))
+	return fmt.Errorf("%w: %w for %s, which found no series at %s and is looked up again after %s",
+		ErrSeriesNotFound, ErrLookupCached, title, at.Local().Format(time.TimeOnly), until.Local().Format(time.TimeOnly))
+}
+
+// recordMiss records that the lookup of title on inst found no series. A dry
+// run records nothing.
+func (im *Importer) recordMiss(inst *Instance, title string) {
+	ttl, err := inst.Config.LookupCacheDuration()
+	if im.LookupMisses == nil || err != nil || ttl <= 0 || im.Options.DryRun {
+		return
+	}
+	im.LookupMisses.Miss(inst.Name, title, ttl)
+}
@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrLibraryComplete is returned with Options.MissingOnly for files of an
+// episode that Sonarr does not miss.
+var ErrLibraryComplete = errors.New("library already complete")
+
+// missingEpisodes holds, for one scan, the episodes each Sonarr instance
+// misses. Every instance's wanted list is read once, the first time a file
+// needs it, and kept per series. A failed read is tried again by the next
+// file.
+type missingEpisodes struct {
+	mu        sync.Mutex
+	instances map[string]*missingList
+}
+
+// missingList is the wanted list of one instance.
+type missingList struct {
+	mu     sync.Mutex
+	series map[int]map[seasonEpisode]bool
+}
+
+// seasonEpisode identifies an episode of a series.
+type seasonEpisode struct {
+	season, episode int
+}
+
+func newMissingEpisodes() *missingEpisodes {
+	return &missingEpisodes{instances: make(map[string]*missingList)}
+}
+
+// checkMissing returns an ErrLibraryComplete error when the series of result
+// in inst has a file for the episode of result already, or for every episode
+// of a multi-episode file. It does nothing
+// unless Options.MissingOnly is set.
+func (im *Importer) checkMissing(ctx context.Context, missing *missingEpisodes, inst *Instance, result *FileResult) error {
+	if !im.Options.MissingOnly || missing == nil {
+		return nil
+	}
+	missing.mu.Lock()
+	list := missing.instances[inst.Name]
+	if list == nil {
+		list = &missingList{}
+		missing.instances[inst.Name] = list
+	}
+	missing.mu.Unlock()
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if list.series == nil {
+		episodes, err := inst.Client.WantedMissing(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the missing episodes: %w", err)
+		}
+		list.series = make(map[int]map[seasonEpisode]bool)
+		for _, e := range episodes {
+			if list.series[e.SeriesID] == nil {
+				list.series[e.SeriesID] = make(map[seasonEpisode]bool)
+			}
+			list.series[e.SeriesID][seasonEpisode{e.SeasonNumber, e.EpisodeNumber}] = true
+		}
+		im.Logger.Infof("Sonarr%s misses %d episode(s) of %d series", instanceSuffix(result.Instance), len(episodes), len(list.series))
+	}
+
+	anime := result.Parsed
+	for _, episode := range anime.Episodes() {
+		if list.series[result.SeriesID][seasonEpisode{anime.Season, episode}] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s is not missing in Sonarr", ErrLibraryComplete, result.SeriesTitle, anime.Label())
+}
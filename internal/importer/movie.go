@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/radarr"
+)
+
+// processMovie hands a file recognised as a movie to Radarr, adding the movie
+// first when it is not in the library yet.
+func (im *Importer) processMovie(ctx context.Context, movie *parser.ParsedMovie, result *FileResult) error {
+	movie.FilePath = result.Path
+	result.Movie = movie
+	im.Logger.Infof("Parsed movie: %s (%d)", movie.Title, movie.Year)
+	im.step(StepParsed, result)
+
+	result.step = "movie lookup"
+	existing, err := im.findExistingMovie(ctx, movie)
+	if err != nil {
+		return fmt.Errorf("failed to read movie library: %w", err)
+	}
+
+	var candidate *radarr.Movie
+	if existing == nil {
+		if candidate, err = im.lookupMovie(ctx, movie); err != nil {
+			return err
+		}
+	}
+
+	if im.Options.DryRun {
+		result.Action = ActionDryRun
+		result.Plan = moviePlan(movie, existing, candidate)
+		if existing != nil {
+			result.MovieID, result.MovieTitle = existing.ID, existing.Title
+		} else {
+			result.MovieTitle = candidate.Title
+		}
+		return nil
+	}
+
+	if existing == nil {
+		im.Logger.Infof("Movie not found, adding: %s (%d)", candidate.Title, candidate.Year)
+		cfg := im.Config.Radarr
+		candidate.QualityProfileID = cfg.QualityProfile
+		candidate.RootFolderPath = cfg.RootFolder
+		candidate.Monitored = true
+		candidate.MinimumAvailability = "released"
+		candidate.AddOptions = &radarr.AddOptions{SearchForMovie: false}
+		if existing, err = im.Radarr.AddMovie(ctx, *candidate); err != nil {
+			return err
+		}
+		result.MovieAdded = true
+		result.MovieID = existing.ID
+		result.MovieTitle = existing.Title
+		im.Logger.Infof("Added new movie: %s (ID: %d)", existing.Title, existing.ID)
+		im.step(StepMovieAdded, result)
+	} else {
+		im.Logger.Infof("Found existing movie: %s (ID: %d)", existing.Title, existing.ID)
+	}
+	result.MovieID = existing.ID
+	result.MovieTitle = existing.Title
+
+	result.step = "import"
+	if err := im.Radarr.ManualImport(ctx, result.ImportMode, []radarr.ManualImportFile{{Path: result.Path, MovieID: existing.ID}}); err != nil {
+		return fmt.Errorf("failed to import file: %w", err)
+	}
+	result.Action = ActionImported
+	return nil
+}
+
+// findExistingMovie returns the library movie with the title and, when
+// parsed, the year of movie, or nil.
+func (im *Importer) findExistingMovie(ctx context.Context, movie *parser.ParsedMovie) (*radarr.Movie, error) {
+	movies, err := im.Radarr.GetMovies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range movies {
+		if movieMatches(m, movie) {
+			return &movies[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// lookupMovie returns the lookup result for movie, preferring one from the
+// parsed year.
+func (im *Importer) lookupMovie(ctx context.Context, movie *parser.ParsedMovie) (*radarr.Movie, error) {
+	term := movie.Title
+	if movie.Year != 0 {
+		term = fmt.Sprintf("%s %d", movie.Title, movie.Year)
+	}
+	results, err := im.Radarr.LookupMovie(ctx, term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for movie: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: no lookup results for %s", ErrMovieNotFound, term)
+	}
+	for i, m := range results {
+		if movie.Year != 0 && m.Year == movie.Year {
+			return &results[i], nil
+		}
+	}
+	return &results[0], nil
+}
+
+// movieMatches reports whether the library movie m is the parsed movie.
+func movieMatches(m radarr.Movie, movie *parser.ParsedMovie) bool {
+	title := parser.NormalizeTitle(movie.Title)
+	if parser.NormalizeTitle(m.Title) != title && parser.NormalizeTitle(m.SortTitle) != title {
+		return false
+	}
+	return movie.Year == 0 || m.Year == movie.Year
+}
+
+// moviePlan describes what a real run would do with a movie file.
+func moviePlan(movie *parser.ParsedMovie, existing, candidate *radarr.Movie) *Plan {
+	plan := &Plan{Movie: true, ImportMode: "auto"}
+	if existing != nil {
+		plan.MovieID = existing.ID
+		plan.MovieTitle = existing.Title
+		plan.TmdbID = existing.TmdbID
+		return plan
+	}
+	plan.NewMovie = true
+	plan.MovieTitle = candidate.Title
+	plan.TmdbID = candidate.TmdbID
+	if movie.Year != 0 && candidate.Year != movie.Year {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("no lookup result from %d, %s (%d) would be added", movie.Year, candidate.Title, candidate.Year))
+	}
+	return plan
+}
@@ -0,0 +1,121 @@
+package importer
+
+import (
+	"errors"
+	"testing"
+
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/radarr/radarrtest"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+const movieFile = "Suzume (2022) [1080p].mkv"
+
+var suzume = radarr.Movie{Title: "Suzume", Year: 2022, TmdbID: 916224, TitleSlug: "suzume-916224"}
+
+// newMovieImporter returns a test importer that hands movies to rsrv.
+func newMovieImporter(t *testing.T, srv *sonarrtest.Server, rsrv *radarrtest.Server, opts Options) *Importer {
+	t.Helper()
+	im := newTestImporter(t, srv, opts)
+	im.Config.Radarr.URL = rsrv.URL
+	im.Config.Radarr.APIKey = radarrtest.APIKey
+	im.Config.Radarr.RootFolder = "/movies"
+	im.Config.Radarr.QualityProfile = 1
+	im.Radarr = rsrv.Client()
+	if opts.DryRun {
+		im.Radarr.SetReadOnly()
+	}
+	return im
+}
+
+func TestMovieAddedAndImported(t *testing.T) {
+	srv, rsrv := sonarrtest.New(), radarrtest.New()
+	defer srv.Close()
+	defer rsrv.Close()
+	rsrv.AddLookup("Suzume 2022", radarr.Movie{Title: "Suzume", Year: 2023, TmdbID: 1})
+	rsrv.AddLookup("Suzume 2022", suzume)
+	im := newMovieImporter(t, srv, rsrv, Options{})
+	addFiles(t, im, movieFile)
+
+	f := fileResult(t, scan(t, im), movieFile)
+	if f.Action != ActionImported || !f.MovieAdded {
+		t.Fatalf("result = %s (added %v), err %v; want an added, imported movie", f.Action, f.MovieAdded, f.Err)
+	}
+
+	movies := rsrv.Movies()
+	if len(movies) != 1 || movies[0].TmdbID != suzume.TmdbID {
+		t.Fatalf("library = %+v, want the lookup result from 2022", movies)
+	}
+	if m := movies[0]; m.RootFolderPath != "/movies" || m.QualityProfileID != 1 || !m.Monitored {
+		t.Errorf("added movie = %+v, want the configured root folder and profile", m)
+	}
+	imports := rsrv.Imports()
+	if len(imports) != 1 || len(imports[0].Files) != 1 || imports[0].Files[0].MovieID != movies[0].ID {
+		t.Errorf("imports = %+v, want the file with movie %d", imports, movies[0].ID)
+	}
+	if len(srv.Imports()) != 0 || len(srv.Series()) != 0 {
+		t.Error("the movie reached Sonarr")
+	}
+}
+
+func TestMovieAlreadyInLibrary(t *testing.T) {
+	srv, rsrv := sonarrtest.New(), radarrtest.New()
+	defer srv.Close()
+	defer rsrv.Close()
+	existing := rsrv.AddMovie(suzume)
+	im := newMovieImporter(t, srv, rsrv, Options{})
+	addFiles(t, im, movieFile)
+
+	f := fileResult(t, scan(t, im), movieFile)
+	if f.Action != ActionImported || f.MovieAdded || f.MovieID != existing.ID {
+		t.Fatalf("result = %s (added %v, movie %d), err %v; want movie %d imported", f.Action, f.MovieAdded, f.MovieID, f.Err, existing.ID)
+	}
+	if len(rsrv.Lookups()) != 0 {
+		t.Errorf("looked up %v for a movie in the library", rsrv.Lookups())
+	}
+}
+
+func TestMovieLookupMiss(t *testing.T) {
+	srv, rsrv := sonarrtest.New(), radarrtest.New()
+	defer srv.Close()
+	defer rsrv.Close()
+	im := newMovieImporter(t, srv, rsrv, Options{})
+	addFiles(t, im, movieFile)
+
+	f := fileResult(t, scan(t, im), movieFile)
+	if f.Action != ActionFailed || !errors.Is(f.Err, ErrMovieNotFound) {
+		t.Fatalf("result = %s, err %v; want ErrMovieNotFound", f.Action, f.Err)
+	}
+	if len(rsrv.Movies()) != 0 || len(rsrv.Imports()) != 0 {
+		t.Error("a movie without lookup results was added or imported")
+	}
+}
+
+func TestMovieDryRun(t *testing.T) {
+	srv, rsrv := sonarrtest.New(), radarrtest.New()
+	defer srv.Close()
+	defer rsrv.Close()
+	rsrv.AddLookup("Suzume 2022", suzume)
+	im := newMovieImporter(t, srv, rsrv, Options{DryRun: true})
+	addFiles(t, im, movieFile)
+
+	f := fileResult(t, scan(t, im), movieFile)
+	if f.Action != ActionDryRun || f.Plan == nil || !f.Plan.NewMovie || f.Plan.TmdbID != suzume.TmdbID {
+		t.Fatalf("result = %s, plan %+v, err %v; want a plan adding the movie", f.Action, f.Plan, f.Err)
+	}
+	if len(rsrv.Movies()) != 0 || len(rsrv.Imports()) != 0 {
+		t.Error("a dry run changed Radarr")
+	}
+}
+
+func TestMoviesIgnoredWithoutRadarr(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	im := newTestImporter(t, srv, Options{})
+	addFiles(t, im, movieFile)
+
+	f := fileResult(t, scan(t, im), movieFile)
+	if f.Movie != nil || f.MovieAdded {
+		t.Errorf("result = %+v, want the file treated as an episode without Radarr", f)
+	}
+}
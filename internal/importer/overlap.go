@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// ErrFolderOverlap is returned when the downloads folder is inside a Sonarr
+// root folder or holds one.
+var ErrFolderOverlap = errors.New("downloads folder overlaps a Sonarr root folder")
+
+// realPath returns path with its symlinks resolved, or just cleaned when it
+// cannot be resolved, as for the root folder of a Sonarr on another host.
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return filepath.Clean(path)
+}
+
+// allRootFolders returns the root folders of every instance, those Sonarr
+// lists and those the config and the folder overrides name, each once.
+func (im *Importer) allRootFolders(ctx context.Context) []string {
+	var roots []string
+	add := func(path string) {
+		if path != "" && !slices.Contains(roots, path) {
+			roots = append(roots, path)
+		}
+	}
+	for _, inst := range im.instances {
+		folders, err := inst.Client.RootFolders(ctx)
+		if err != nil {
+			im.Logger.Warnf("Cannot list the root folders of Sonarr instance %s: %v", inst.Name, err)
+		}
+		for _, folder := range folders {
+			add(folder.Path)
+		}
+		add(inst.Config.RootFolder)
+	}
+	for _, f := range im.folders {
+		add(f.RootFolder)
+	}
+	return roots
+}
+
+// CheckRootFolders verifies, with symlinks resolved, that the downloads
+// folder is neither inside a Sonarr root folder nor holds one: Sonarr would
+// move the files of its own library out from under itself. With
+// Options.AllowOverlap it only warns. The scans skip the files inside the
+// root folders either way.
+func (im *Importer) CheckRootFolders(ctx context.Context) error {
+	downloads := im.Config.Sonarr.DownloadsFolder
+	realDownloads := realPath(downloads)
+	im.roots = im.roots[:0]
+	for _, root := range im.allRootFolders(ctx) {
+		real := realPath(root)
+		im.roots = append(im.roots, real)
+		var err error
+		switch {
+		case hasPathPrefix(realDownloads, real):
+			err = fmt.Errorf("%w: %s%s is inside root folder %s%s", ErrFolderOverlap, downloads, resolved(downloads, realDownloads), root, resolved(root, real))
+		case hasPathPrefix(real, realDownloads):
+			err = fmt.Errorf("%w: root folder %s%s is inside %s%s", ErrFolderOverlap, root, resolved(root, real), downloads, resolved(downloads, realDownloads))
+		default:
+			continue
+		}
+		if !im.Options.AllowOverlap {
+			return fmt.Errorf("%w; pass -allow-overlap to scan anyway", err)
+		}
+		im.Logger.Warnf("%v; scanning anyway as -allow-overlap is given, files inside the root folder are skipped", err)
+	}
+	return nil
+}
+
+// resolved returns the suffix naming real, the real path of path, when they
+// differ.
+func resolved(path, real string) string {
+	if filepath.Clean(path) == real {
+		return ""
+	}
+	return " (" + real + ")"
+}
+
+// inRootFolder returns the real path of the file at path and the root folder
+// it is inside, or "" for the root folder when it is in none.
+func (im *Importer) inRootFolder(path string) (real, root string) {
+	if len(im.roots) == 0 {
+		return path, ""
+	}
+	real = realPath(path)
+	for _, root := range im.roots {
+		if hasPathPrefix(real, root) {
+			return real, root
+		}
+	}
+	return real, ""
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// symlink links name to target, creating the folders of both.
+func symlink(t *testing.T, target, name string) {
+	t.Helper()
+	for _, dir := range []string{filepath.Dir(target), filepath.Dir(name)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(target, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRootFoldersSymlinked(t *testing.T) {
+	tests := []struct {
+		desc string
+		// setup links the downloads folder and the root folder below dir,
+		// returning their configured paths.
+		setup func(t *testing.T, dir string) (downloads, root string)
+		want  string
+	}{
+		{
+			desc: "downloads folder symlinked into the root folder",
+			setup: func(t *testing.T, dir string) (string, string) {
+				root := filepath.Join(dir, "tv")
+				if err := os.MkdirAll(filepath.Join(root, "incoming"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				symlink(t, filepath.Join(root, "incoming"), filepath.Join(dir, "downloads"))
+				return filepath.Join(dir, "downloads"), root
+			},
+			want: "is inside root folder",
+		},
+		{
+			desc: "root folder symlinked into the downloads folder",
+			setup: func(t *testing.T, dir string) (string, string) {
+				downloads := filepath.Join(dir, "downloads")
+				if err := os.MkdirAll(filepath.Join(downloads, "library"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				symlink(t, filepath.Join(downloads, "library"), filepath.Join(dir, "tv"))
+				return downloads, filepath.Join(dir, "tv")
+			},
+			want: "overlaps a Sonarr root folder: root folder ",
+		},
+		{
+			desc: "folders side by side",
+			setup: func(t *testing.T, dir string) (string, string) {
+				for _, sub := range []string{"downloads", "tv"} {
+					if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return filepath.Join(dir, "downloads"), filepath.Join(dir, "tv")
+			},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		downloads, root := tt.setup(t, dir)
+		srv := sonarrtest.New()
+		srv.SetRootFolders(sonarr.RootFolder{ID: 1, Path: root, Accessible: true})
+
+		for _, allow := range []bool{false, true} {
+			im := newTestImporter(t, srv, Options{AllowOverlap: allow})
+			im.Config.Sonarr.DownloadsFolder = downloads
+			err := im.CheckRootFolders(context.Background())
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("%s: CheckRootFolders: %v", tt.desc, err)
+			case tt.want != "" && !allow && (!errors.Is(err, ErrFolderOverlap) || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("%s: CheckRootFolders = %v, want ErrFolderOverlap %q", tt.desc, err, tt.want)
+			case tt.want != "" && !allow && !strings.Contains(err.Error(), "-allow-overlap"):
+				t.Errorf("%s: the error does not name -allow-overlap: %v", tt.desc, err)
+			case allow && err != nil:
+				t.Errorf("%s: CheckRootFolders with AllowOverlap: %v", tt.desc, err)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestScanSkipsSymlinkIntoRootFolder(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	root := filepath.Join(t.TempDir(), "tv")
+	srv.SetRootFolders(sonarr.RootFolder{ID: 1, Path: root, Accessible: true, FreeSpace: 1 << 40})
+	im := newTestImporter(t, srv, Options{})
+
+	// The library file is linked into the downloads folder next to a new one
+	library := filepath.Join(root, "Frieren", "Season 1", "[SubsPlease] Frieren - 04 (1080p).mkv")
+	if err := os.MkdirAll(filepath.Dir(library), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(library, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, library, filepath.Join(im.Config.Sonarr.DownloadsFolder, "[SubsPlease] Frieren - 04 (1080p).mkv"))
+	addFiles(t, im, frierenFile)
+
+	if err := im.CheckRootFolders(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	result := scan(t, im)
+	if result.InRootFolder != 1 {
+		t.Errorf("InRootFolder = %d, want the symlinked library file", result.InRootFolder)
+	}
+	imports := srv.Imports()
+	if len(imports) != 1 || filepath.Base(imports[0].Files[0].Path) != frierenFile {
+		t.Errorf("imports = %+v, want only %s", imports, frierenFile)
+	}
+	for _, f := range result.Files {
+		if strings.Contains(f.Path, "Frieren - 04") {
+			t.Errorf("the symlinked library file was processed: %+v", f)
+		}
+	}
+}
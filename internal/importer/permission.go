@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+var (
+	// ErrPermissionDenied is returned for a file that this tool may not
+	// read or that Sonarr may not read or move, as when the download client
+	// writes it as root:root with a umask that leaves others out.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrReadOnly is returned when Sonarr cannot move a file because the
+	// downloads folder is mounted read-only in its container.
+	ErrReadOnly = errors.New("read-only file system")
+)
+
+// checkReadable fails with ErrPermissionDenied when the file at path cannot
+// be opened for reading. Other errors are left for the later steps to run
+// into, as the file may only exist where Sonarr runs.
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w: cannot read %s; %s", ErrPermissionDenied, path, permissionHint(path))
+	}
+	if err != nil {
+		return nil
+	}
+	return f.Close()
+}
+
+// permissionHint suggests how to make the file or directory at path
+// readable, naming its owner and the user the tool runs as where the
+// platform has them.
+func permissionHint(path string) string {
+	hint := "have the download client write files readable by this tool, such as with a umask of 002 and a group both share, or run both with the same PUID and PGID"
+	info, err := os.Stat(path)
+	if err != nil {
+		return hint
+	}
+	if owner := fileOwner(info); owner != "" {
+		return fmt.Sprintf("it is %s with mode %v and this tool runs as %s; %s", owner, info.Mode().Perm(), processOwner(), hint)
+	}
+	return hint
+}
+
+// sonarrFSError returns err, an error of Sonarr, wrapped in
+// ErrPermissionDenied or ErrReadOnly with a hint when Sonarr reports that it
+// may not read or move a file, and err itself otherwise. Sonarr relays the
+// messages of .NET, such as "Access to the path '/downloads/x.mkv' is
+// denied." or "Read-only file system".
+func sonarrFSError(err error) error {
+	var apiErr *sonarr.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	message := strings.ToLower(apiErr.Message())
+	switch {
+	case strings.Contains(message, "read-only file system"):
+		return fmt.Errorf("%w: %w; mount the downloads folder read-write in the Sonarr container, as Sonarr deletes the files it moves", ErrReadOnly, err)
+	case strings.Contains(message, "access to the path") && strings.Contains(message, "is denied"),
+		strings.Contains(message, "permission denied"):
+		return fmt.Errorf("%w: %w; make the downloads folder readable and writable by the PUID and PGID Sonarr runs as", ErrPermissionDenied, err)
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package importer
+
+import "io/fs"
+
+// fileOwner returns "" where files have no uid and gid.
+func fileOwner(info fs.FileInfo) string {
+	return ""
+}
+
+// processOwner returns "" where processes have no uid and gid.
+func processOwner() string {
+	return ""
+}
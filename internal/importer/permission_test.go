@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+func TestUnreadableFilesAreSkipped(t *testing.T) {
+	skipAsRoot(t)
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", frieren, episodes(28)...)
+	im := newTestImporter(t, srv, Options{})
+	const unreadable, readable = "[SubsPlease] Frieren - 05 (1080p).mkv", "[SubsPlease] Frieren - 06 (1080p).mkv"
+	addFiles(t, im, unreadable, readable, "locked/[SubsPlease] Frieren - 07 (1080p).mkv", "open/[SubsPlease] Frieren - 08 (1080p).mkv")
+	downloads := im.Config.Sonarr.DownloadsFolder
+	if err := os.Chmod(filepath.Join(downloads, unreadable), 0); err != nil {
+		t.Fatal(err)
+	}
+	locked := filepath.Join(downloads, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0o755) })
+
+	result := scan(t, im)
+	f := fileResult(t, result, unreadable)
+	if f.Action != ActionFailed || !errors.Is(f.Err, ErrPermissionDenied) || f.Category != CategoryPermission {
+		t.Fatalf("unreadable file: %s, %s, %v; want a permission failure", f.Action, f.Category, f.Err)
+	}
+	if !strings.Contains(f.Err.Error(), "with mode ----------") || !strings.Contains(f.Err.Error(), "umask") {
+		t.Errorf("no hint in %v", f.Err)
+	}
+	if f.Transient() || f.Category.Unmatched() {
+		t.Error("a permission failure is retried or counted as unmatched")
+	}
+	for _, name := range []string{readable, "[SubsPlease] Frieren - 08 (1080p).mkv"} {
+		if f := fileResult(t, result, name); f.Action != ActionImported {
+			t.Errorf("%s: %s, %v; want the readable file imported", name, f.Action, f.Err)
+		}
+	}
+	if len(result.Files) != 3 {
+		t.Errorf("%d file result(s), want none for the locked directory", len(result.Files))
+	}
+}
+
+func TestSonarrFSError(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"message":"Access to the path '/downloads/x.mkv' is denied."}`, ErrPermissionDenied},
+		{`{"message":"Could not move file: Permission denied"}`, ErrPermissionDenied},
+		{`{"message":"Read-only file system : '/downloads/x.mkv'"}`, ErrReadOnly},
+		{`{"message":"Sequence contains no matching element"}`, nil},
+	}
+	for _, tt := range tests {
+		apiErr := &sonarr.APIError{Method: http.MethodPut, Path: "/api/v3/manualimport", StatusCode: http.StatusInternalServerError, Body: tt.body}
+		err := sonarrFSError(apiErr)
+		var got *sonarr.APIError
+		if !errors.As(err, &got) {
+			t.Errorf("%s: the API error is lost in %v", tt.body, err)
+		}
+		if tt.want == nil {
+			if err != error(apiErr) {
+				t.Errorf("%s: sonarrFSError = %v, want the error unchanged", tt.body, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: sonarrFSError = %v, want %v", tt.body, err, tt.want)
+		}
+	}
+}
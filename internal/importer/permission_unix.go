@@ -0,0 +1,25 @@
+//go:build unix
+
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner of the file of info as "uid 0 gid 0".
+func fileOwner(info fs.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("uid %d gid %d", st.Uid, st.Gid)
+}
+
+// processOwner returns the user and group the process runs as, in the form
+// of fileOwner.
+func processOwner() string {
+	return fmt.Sprintf("uid %d gid %d", os.Getuid(), os.Getgid())
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// PinFileName is the name of the file that pins the files of a download
+// folder, and of the folders below it, to one series.
+const PinFileName = ".sonarr-series"
+
+// ErrInvalidPin is returned for files below a pin file that cannot be read or
+// names no series. They fail rather than fall back to title matching.
+var ErrInvalidPin = errors.New("invalid series pin")
+
+// Pin is a pin file, which names a series by its TVDB ID or by its exact
+// title in Sonarr.
+type Pin struct {
+	// Path is the path of the pin file.
+	Path   string `json:"path"`
+	TvdbID int    `json:"tvdbId,omitempty"`
+	Title  string `json:"title,omitempty"`
+}
+
+func (p *Pin) String() string {
+	if p.TvdbID != 0 {
+		return fmt.Sprintf("tvdb:%d", p.TvdbID)
+	}
+	return strconv.Quote(p.Title)
+}
+
+// pinnedDirs holds, for one scan, the pin that applies to every directory
+// files were found in, or the error of an invalid one.
+type pinnedDirs struct {
+	mu   sync.Mutex
+	dirs map[string]pinLookup
+}
+
+type pinLookup struct {
+	pin *Pin
+	err error
+}
+
+func newPinnedDirs() *pinnedDirs {
+	return &pinnedDirs{dirs: make(map[string]pinLookup)}
+}
+
+// pin returns the pin that applies to the file at path: the pin file in its
+// directory or, up to the downloads folder, in the nearest directory above.
+// It returns nil when there is none. Each directory is looked at once per
+// scan, and an invalid pin file is logged once.
+func (im *Importer) pin(pins *pinnedDirs, path string) (*Pin, error) {
+	if pins == nil {
+		return nil, nil
+	}
+	pins.mu.Lock()
+	defer pins.mu.Unlock()
+	return im.dirPin(pins, filepath.Dir(path))
+}
+
+// dirPin returns the pin of dir, looking at its parent when dir has no pin
+// file and is below the downloads folder. pins.mu is held.
+func (im *Importer) dirPin(pins *pinnedDirs, dir string) (*Pin, error) {
+	if lookup, ok := pins.dirs[dir]; ok {
+		return lookup.pin, lookup.err
+	}
+	pin, err := readPin(filepath.Join(dir, PinFileName))
+	if err != nil {
+		im.Logger.Errorf("Files below %s fail until their %s is fixed: %v", dir, PinFileName, err)
+	}
+	if pin == nil && err == nil {
+		root := filepath.Clean(im.Config.Sonarr.DownloadsFolder)
+		if parent := filepath.Dir(dir); parent != dir && dir != root && hasPathPrefix(parent, root) {
+			pin, err = im.dirPin(pins, parent)
+		}
+	}
+	pins.dirs[dir] = pinLookup{pin, err}
+	return pin, err
+}
+
+// readPin reads the pin file at path, which is either a JSON object with a
+// "tvdbId" or a "title" or a line of plain text: a TVDB ID, optionally
+// written "tvdb:123", or else the title. It returns nil when there is no
+// file at path.
+func readPin(path string) (*Pin, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidPin, path, err)
+	}
+
+	pin := &Pin{Path: path}
+	text := bytes.TrimSpace(data)
+	if bytes.HasPrefix(text, []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(pin); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrInvalidPin, path, err)
+		}
+		pin.Path = path
+		pin.Title = strings.TrimSpace(pin.Title)
+	} else {
+		line, _, _ := strings.Cut(string(text), "\n")
+		line = strings.TrimSpace(line)
+		if id, err := strconv.Atoi(strings.TrimPrefix(line, "tvdb:")); err == nil {
+			pin.TvdbID = id
+		} else {
+			pin.Title = line
+		}
+	}
+
+	switch {
+	case pin.TvdbID == 0 && pin.Title == "":
+		return nil, fmt.Errorf("%w %s: it names no series, want a TVDB ID or a series title", ErrInvalidPin, path)
+	case pin.TvdbID != 0 && pin.Title != "":
+		return nil, fmt.Errorf("%w %s: it names both a TVDB ID and a title, want one of them", ErrInvalidPin, path)
+	case pin.TvdbID < 0:
+		return nil, fmt.Errorf("%w %s: invalid TVDB ID %d", ErrInvalidPin, path, pin.TvdbID)
+	}
+	return pin, nil
+}
+
+// findPinned returns the library series of inst that pin names or, for a
+// TVDB ID that is not in the library yet, the lookup result it would be
+// added from. A pin that names no series fails with ErrInvalidPin.
+func (im *Importer) findPinned(ctx context.Context, inst *Instance, pin *Pin) (*sonarr.Series, *sonarr.SeriesLookup, error) {
+	if pin.TvdbID != 0 {
+		series, option, err := im.findAliased(ctx, inst, fmt.Sprintf("pinned by %s", pin.Path), pin.TvdbID)
+		if errors.Is(err, ErrSeriesNotFound) {
+			return nil, nil, fmt.Errorf("%w %s: %v", ErrInvalidPin, pin.Path, err)
+		}
+		return series, option, err
+	}
+
+	library, err := inst.Client.GetSeries(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read series library: %w", err)
+	}
+	var candidates []*sonarr.Series
+	for i, s := range library {
+		if strings.EqualFold(s.Title, pin.Title) {
+			candidates = append(candidates, &library[i])
+		}
+	}
+	if len(candidates) > 0 {
+		series, err := im.pickSeries(inst, strconv.Quote(pin.Title), candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		im.Logger.Infof("Found existing series: %s (ID: %d, pinned by %s)", series.Title, series.ID, pin.Path)
+		return series, nil, nil
+	}
+	return nil, nil, fmt.Errorf("%w %s: Sonarr has no series titled %q", ErrInvalidPin, pin.Path, pin.Title)
+}
@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// Plan is what a real run would do with a file, worked out by a dry run with
+// read-only Sonarr calls.
+type Plan struct {
+	// NewSeries is set when the series would be added from the lookup.
+	NewSeries   bool   `json:"newSeries"`
+	SeriesID    int    `json:"seriesId,omitempty"`
+	SeriesTitle string `json:"seriesTitle"`
+	TvdbID      int    `json:"tvdbId,omitempty"`
+	// Instance names the Sonarr instance when more than one is configured.
+	Instance string `json:"instance,omitempty"`
+	// Folder is the folder override whose settings applied, if any.
+	Folder string `json:"folder,omitempty"`
+	// Pin is the path of the pin file that picked the series, if any.
+	Pin string `json:"pin,omitempty"`
+	// RootFolder, QualityProfile, SeriesType and Tags are the settings a new
+	// series would be added with.
+	RootFolder string `json:"rootFolder,omitempty"`
+	// SeriesPath is the folder a new series would be added at.
+	SeriesPath     string `json:"seriesPath,omitempty"`
+	QualityProfile int    `json:"qualityProfile,omitempty"`
+	SeriesType     string `json:"seriesType,omitempty"`
+	Tags           []int  `json:"tags,omitempty"`
+	Season         int    `json:"season"`
+	Episode        int    `json:"episode"`
+	// EndEpisode is the last episode of a multi-episode file.
+	EndEpisode int `json:"endEpisode,omitempty"`
+	// EpisodeID is only known for series already in the library, and so are
+	// the EpisodeIDs of every episode of a multi-episode file.
+	EpisodeID  int             `json:"episodeId,omitempty"`
+	EpisodeIDs []int           `json:"episodeIds,omitempty"`
+	Quality    sonarr.Quality  `json:"quality"`
+	Language   sonarr.Language `json:"language"`
+	ImportMode string          `json:"importMode"`
+	Warnings   []string        `json:"warnings,omitempty"`
+	// Renumbered shows the math of a cour that renumbered the episodes.
+	Renumbered string `json:"renumbered,omitempty"`
+	// MonitoredSeasons are the seasons a new series would monitor, and
+	// SearchForMissing tells whether Sonarr would search for their missing
+	// episodes right away.
+	MonitoredSeasons []int `json:"monitoredSeasons,omitempty"`
+	SearchForMissing bool  `json:"searchForMissing,omitempty"`
+
+	// Movie is set for files handed to Radarr, which fill the fields below
+	// instead of the series and episode.
+	Movie      bool   `json:"movie,omitempty"`
+	NewMovie   bool   `json:"newMovie,omitempty"`
+	MovieID    int    `json:"movieId,omitempty"`
+	MovieTitle string `json:"movieTitle,omitempty"`
+	TmdbID     int    `json:"tmdbId,omitempty"`
+}
+
+// planImport fills result.Plan for anime without changing anything in inst.
+// It fails the same way the real import would when the series or episode
+// cannot be found.
+func (im *Importer) planImport(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, result *FileResult) error {
+	file := im.importFile(anime, 0, nil)
+	plan := &Plan{
+		Season:     anime.Season,
+		Episode:    anime.Episode,
+		EndEpisode: anime.EndEpisode,
+		Quality:    file.Quality,
+		Language:   file.Language,
+		ImportMode: "auto",
+		Instance:   result.Instance,
+		Folder:     result.Folder,
+		Renumbered: result.Renumbered,
+	}
+	result.Plan = plan
+	if anime.Quality == "" || anime.Quality == "Unknown" {
+		plan.Warnings = append(plan.Warnings, "quality not recognised in the filename")
+	}
+
+	if result.Pin != nil {
+		plan.Pin = result.Pin.Path
+		series, option, err := im.findPinned(ctx, inst, result.Pin)
+		switch {
+		case err != nil:
+			return err
+		case series != nil:
+			return im.planExisting(ctx, inst, anime, series, result)
+		}
+		im.planNewSeries(ctx, inst, plan, result, *option)
+		plan.Warnings = append(plan.Warnings, "episode not checked because the series is not in the library yet")
+		return nil
+	}
+	if tvdbID := im.alias(anime.Title); tvdbID != 0 {
+		series, option, err := im.findAliased(ctx, inst, "alias of "+anime.Title, tvdbID)
+		switch {
+		case err != nil:
+			return err
+		case series != nil:
+			return im.planExisting(ctx, inst, anime, series, result)
+		}
+		im.planNewSeries(ctx, inst, plan, result, *option)
+		plan.Warnings = append(plan.Warnings, "episode not checked because the series is not in the library yet")
+		return nil
+	}
+
+	series, err := im.findExistingSeries(ctx, inst, anime.Title)
+	switch {
+	case err == nil:
+		return im.planExisting(ctx, inst, anime, series, result)
+
+	case errors.Is(err, ErrDuplicateSeries):
+		return err
+
+	case !errors.Is(err, ErrSeriesNotFound):
+		return fmt.Errorf("failed to read series library: %w", err)
+	}
+
+	if err := im.cachedMiss(inst, anime.Title); err != nil {
+		return err
+	}
+	options, err := im.lookupSeries(ctx, inst, anime.Title)
+	if err != nil {
+		return fmt.Errorf("failed to search for series: %w", err)
+	}
+	if len(options) == 0 {
+		im.recordMiss(inst, anime.Title)
+		return fmt.Errorf("%w: no lookup results for %s", ErrSeriesNotFound, anime.Title)
+	}
+	im.planNewSeries(ctx, inst, plan, result, options[0])
+	if inst.Config.ConfirmNewSeries {
+		plan.Warnings = append(plan.Warnings, "the new series would wait for approval (sonarr.confirmNewSeries)")
+	}
+	if len(options) > 1 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%d lookup results, the first one would be added", len(options)))
+	}
+	plan.Warnings = append(plan.Warnings, "episode not checked because the series is not in the library yet")
+	return nil
+}
+
+// planExisting fills the plan of result for series, which is in the library.
+func (im *Importer) planExisting(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, series *sonarr.Series, result *FileResult) error {
+	plan := result.Plan
+	plan.SeriesID = series.ID
+	plan.SeriesTitle = series.Title
+	plan.TvdbID = series.TvdbID
+	result.SeriesID = series.ID
+	result.SeriesTitle = series.Title
+	result.SeriesPath = series.Path
+
+	warning := im.inferSeason(ctx, inst, series, anime)
+	plan.Season = anime.Season
+	if warning != "" {
+		plan.Warnings = append(plan.Warnings, warning)
+	}
+	episodes, err := im.findEpisodes(ctx, inst, series.ID, anime)
+	if errors.Is(err, errNotListedYet) {
+		// A real run refreshes the series before deferring the file
+		err = fmt.Errorf("%w: %w", ErrAwaitingMetadata, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find episode: %w", err)
+	}
+	plan.EpisodeID = episodes[0].ID
+	if len(episodes) > 1 {
+		plan.EpisodeIDs = episodeIDs(episodes)
+	}
+	result.EpisodeID = episodes[0].ID
+	result.Upgrade = hasFile(episodes)
+	return nil
+}
+
+// planNewSeries fills plan with the series that would be added from option.
+func (im *Importer) planNewSeries(ctx context.Context, inst *Instance, plan *Plan, result *FileResult, option sonarr.SeriesLookup) {
+	plan.NewSeries = true
+	plan.RootFolder = inst.Config.RootFolder
+	plan.SeriesPath = im.newSeriesPath(ctx, inst, option)
+	plan.QualityProfile = inst.Config.QualityProfile
+	plan.SeriesType = inst.Config.SeriesType
+	plan.Tags = inst.Tags
+	plan.MonitoredSeasons = monitoredSeasons(monitorSeasons(inst.Config.MonitorSeasons, option.Seasons, plan.Season))
+	plan.SearchForMissing = inst.Config.AddOptions.SearchForMissingEpisodes
+	plan.SeriesTitle = option.Title
+	plan.TvdbID = option.TvdbID
+	result.SeriesTitle = option.Title
+}
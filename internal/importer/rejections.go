@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// ErrRejected is returned when Sonarr did not import a file for reasons of
+// its own, such as an existing file of a better quality or a quality it
+// cannot parse.
+var ErrRejected = errors.New("rejected by Sonarr")
+
+// rejectionError carries the reasons Sonarr rejected a file for, as Sonarr
+// words them.
+type rejectionError struct {
+	rejections []sonarr.Rejection
+}
+
+func (e *rejectionError) Error() string {
+	reasons := make([]string, len(e.rejections))
+	for i, r := range e.rejections {
+		reasons[i] = r.Reason
+	}
+	return "Rejected by Sonarr: " + strings.Join(reasons, "; ")
+}
+
+func (e *rejectionError) Unwrap() error {
+	return ErrRejected
+}
+
+// temporary reports whether Sonarr marks every reason as temporary, such as
+// a file that is still being unpacked, so a later retry may succeed.
+func (e *rejectionError) temporary() bool {
+	for _, r := range e.rejections {
+		if r.Type != "temporary" {
+			return false
+		}
+	}
+	return true
+}
+
+// rejections returns the reasons Sonarr gives for not importing the file of
+// result, as its manual import preview of the folder of the file lists them
+// after the import. It returns none when the preview cannot be read or does
+// not list the file, as when Sonarr moved it already.
+func (im *Importer) rejections(ctx context.Context, inst *Instance, result *FileResult) []sonarr.Rejection {
+	items, err := inst.Client.ManualImportPreview(ctx, filepath.Dir(result.Path))
+	if err != nil {
+		im.Logger.Debugf("Cannot read the rejections of %s: %v", filepath.Base(result.Path), err)
+		return nil
+	}
+	var named []sonarr.ManualImportItem
+	for _, item := range items {
+		if filepath.Clean(item.Path) == filepath.Clean(result.Path) {
+			return item.Rejections
+		}
+		if filepath.Base(item.Path) == filepath.Base(result.Path) {
+			named = append(named, item)
+		}
+	}
+	// Sonarr may see the folder under another path
+	if len(named) == 1 {
+		return named[0].Rejections
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// rescans reports whether full scans walk the downloads folder once more at
+// their end for the files that appeared while they ran.
+func (im *Importer) rescans() bool {
+	return !im.Config.Parsing.SkipRescan && !im.Options.NoRescan
+}
+
+// recordPaths passes on the files received on files and records their paths
+// in seen, which is complete once the returned channel is closed.
+func recordPaths(ctx context.Context, files <-chan videoFile, seen map[string]bool) <-chan videoFile {
+	out := make(chan videoFile)
+	go func() {
+		defer close(out)
+		for file := range files {
+			seen[file.path] = true
+			select {
+			case out <- file:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// sendFiles sends files on the returned channel until ctx is cancelled.
+func sendFiles(ctx context.Context, files []videoFile) <-chan videoFile {
+	out := make(chan videoFile)
+	go func() {
+		defer close(out)
+		for _, file := range files {
+			select {
+			case out <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// rescan walks the downloads folder again for the video files that are not
+// in seen, the files of the first walk, as downloads that finished while the
+// scan ran. It returns those whose size and modification time stay the same
+// over daemon.watchDebounce, in the order of the scan, and the number of
+// those still being written, which are left for the next scan. Files older
+// than the cutoff of opts are left alone as in the first walk.
+func (im *Importer) rescan(ctx context.Context, opts walkOptions, seen map[string]bool) ([]videoFile, int) {
+	root := im.Config.Sonarr.DownloadsFolder
+	var found []videoFile
+	err := walkVideos(root, opts, func(path string, d fs.DirEntry) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if seen[path] {
+			return nil
+		}
+		if file, err := newVideoFile(path, d); err == nil && !opts.tooOld(file) {
+			found = append(found, file)
+		}
+		return nil
+	})
+	if err != nil {
+		im.Logger.Warnf("Failed to scan %s again for new video files: %v", root, err)
+		return nil, 0
+	}
+	if len(found) == 0 || ctx.Err() != nil {
+		im.Logger.Debugf("No new video files appeared in %s during the scan", root)
+		return nil, 0
+	}
+
+	settle, err := im.Config.Daemon.WatchDebounceDuration()
+	if err != nil {
+		settle = config.DefaultWatchDebounce
+	}
+	im.Logger.Infof("%d video file(s) appeared during the scan, processing those unchanged after %v", len(found), settle)
+	timer := time.NewTimer(settle)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, 0
+	}
+
+	var files []videoFile
+	unsettled := 0
+	for _, file := range found {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			// Gone again, as when the download client moved it
+			continue
+		}
+		if info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			im.Logger.Infof("Leaving %s for the next scan, it is still being written", filepath.Base(file.path))
+			unsettled++
+			continue
+		}
+		files = append(files, file)
+	}
+	sortVideos(files, opts)
+	return files, unsettled
+}
@@ -0,0 +1,550 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// Action is what the importer did with a file.
+type Action string
+
+const (
+	ActionImported Action = "imported"
+	ActionDryRun   Action = "dry-run"
+	ActionFailed   Action = "failed"
+)
+
+// FileResult is the outcome of processing a single file during a scan.
+type FileResult struct {
+	Path string `json:"path"`
+	// ScanID is the ID of the scan that processed the file.
+	ScanID string `json:"scanId,omitempty"`
+	// Rescan is set for the files of the second pass of a scan, which
+	// appeared in the downloads folder while the scan ran.
+	Rescan bool `json:"rescan,omitempty"`
+	// Size is the size of the file in bytes and ModTime its modification
+	// time, as the scan found it.
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+	// Fingerprint identifies the content of the file, as Fingerprint
+	// computes it, when duplicates are checked.
+	Fingerprint string              `json:"fingerprint,omitempty"`
+	Parsed      *parser.ParsedAnime `json:"parsed,omitempty"`
+	// Instance names the Sonarr instance the file was routed to when more
+	// than one is configured.
+	Instance string `json:"instance,omitempty"`
+	// Folder is the folder override whose settings applied, if any.
+	Folder string `json:"folder,omitempty"`
+	// Pin is the pin file that picked the series instead of the parsed
+	// title, if any.
+	Pin         *Pin   `json:"pin,omitempty"`
+	SeriesID    int    `json:"seriesId,omitempty"`
+	SeriesTitle string `json:"seriesTitle,omitempty"`
+	SeriesPath  string `json:"seriesPath,omitempty"`
+	SeriesAdded bool   `json:"seriesAdded,omitempty"`
+	// RolledBack is set when the series this file added was deleted again
+	// because the import failed, as sonarr.rollbackNewSeries allows.
+	RolledBack bool `json:"rolledBack,omitempty"`
+	EpisodeID  int  `json:"episodeId,omitempty"`
+	// Upgrade is set when the episode already had a file, which the import
+	// replaces.
+	Upgrade bool `json:"upgrade,omitempty"`
+	// PendingSeries is the lookup result that would be added for the file,
+	// which waits for its approval because of sonarr.confirmNewSeries.
+	PendingSeries *NewSeries `json:"pendingSeries,omitempty"`
+	// Movie, MovieID, MovieTitle and MovieAdded are set instead of the
+	// series fields for files handed to Radarr.
+	Movie      *parser.ParsedMovie `json:"movie,omitempty"`
+	MovieID    int                 `json:"movieId,omitempty"`
+	MovieTitle string              `json:"movieTitle,omitempty"`
+	MovieAdded bool                `json:"movieAdded,omitempty"`
+	Action     Action              `json:"action"`
+	// ImportMode is set when the file was imported with another mode than
+	// the default one, such as "copy" for the files of a seeding torrent.
+	ImportMode string `json:"importMode,omitempty"`
+	// Plan describes what a real run would do; it is only set in dry runs.
+	Plan     *Plan         `json:"plan,omitempty"`
+	Category ErrorCategory `json:"category,omitempty"`
+	Err      error         `json:"-"`
+	Error    string        `json:"error,omitempty"`
+	// Timeout is set when the file was not finished within
+	// parsing.fileTimeout.
+	Timeout  *Timeout      `json:"timeout,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// ImportedAt is when the import of the file finished, and Latency the
+	// time from ModTime, taken as the time the download completed, to then.
+	ImportedAt time.Time     `json:"importedAt,omitempty"`
+	Latency    time.Duration `json:"latency,omitempty"`
+	// Disagreements tell how Sonarr's manual import preview reads the file
+	// differently with Options.CrossCheck.
+	Disagreements []string `json:"disagreements,omitempty"`
+	// Renumbered tells how a cour of the series rule of the file changed
+	// its season and episodes.
+	Renumbered string `json:"renumbered,omitempty"`
+	// BytesRead is the number of bytes read from the file, as for its
+	// fingerprint.
+	BytesRead int64 `json:"bytesRead,omitempty"`
+	// Rejections are the reasons Sonarr gave for not importing the file, as
+	// it words them.
+	Rejections []sonarr.Rejection `json:"rejections,omitempty"`
+
+	// step is the step the file is in, named when it times out.
+	step string
+}
+
+// NewSeries is a lookup result that a file needs added to Sonarr.
+type NewSeries struct {
+	Title  string `json:"title"`
+	Year   int    `json:"year,omitempty"`
+	TvdbID int    `json:"tvdbId"`
+}
+
+func (s NewSeries) String() string {
+	if s.Year == 0 {
+		return fmt.Sprintf("%s [tvdb:%d]", s.Title, s.TvdbID)
+	}
+	return fmt.Sprintf("%s (%d) [tvdb:%d]", s.Title, s.Year, s.TvdbID)
+}
+
+// Timeout describes a file that ran out of time.
+type Timeout struct {
+	Limit time.Duration `json:"limit"`
+	// Step is what the file was waiting for: parse, series lookup, episode
+	// lookup, movie lookup, plan or import.
+	Step    string        `json:"step"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// fail records err as the reason the file was not imported.
+func (f *FileResult) fail(err error) {
+	f.Action = ActionFailed
+	f.Err = err
+	f.Error = err.Error()
+	f.Category = Categorize(err)
+}
+
+// ScanResult collects the per-file results and counters of one scan.
+type ScanResult struct {
+	// ID identifies the scan in the file results and events.
+	ID          string       `json:"id"`
+	Folder      string       `json:"folder"`
+	StartedAt   time.Time    `json:"startedAt"`
+	FinishedAt  time.Time    `json:"finishedAt"`
+	Files       []FileResult `json:"files"`
+	Total       int          `json:"total"`
+	Imported    int          `json:"imported"`
+	DryRun      int          `json:"dryRun"`
+	Failed      int          `json:"failed"`
+	SeriesAdded int          `json:"seriesAdded"`
+	// RolledBack is the number of added series that were deleted again.
+	RolledBack  int                   `json:"rolledBack,omitempty"`
+	MoviesAdded int                   `json:"moviesAdded,omitempty"`
+	Failures    map[ErrorCategory]int `json:"failures,omitempty"`
+	// Instances counts the files routed to each Sonarr instance when more
+	// than one is configured.
+	Instances map[string]int `json:"instances,omitempty"`
+	// Deferred is the number of files left alone because their retry is not
+	// due, and RetryQueue the number of files waiting for a retry after the
+	// scan.
+	Deferred int `json:"deferred,omitempty"`
+	// Ignored is the number of files skipped because of the ignore list.
+	Ignored int `json:"ignored,omitempty"`
+	// Seeding is the number of files skipped because their torrent is still
+	// downloading or seeding.
+	Seeding int `json:"seeding,omitempty"`
+	// TooOld is the number of files left out of the scan because they were
+	// modified before Options.Since or daemon.maxFileAge.
+	TooOld int `json:"tooOld,omitempty"`
+	// InRootFolder is the number of files skipped because their real path
+	// is inside a Sonarr root folder.
+	InRootFolder int `json:"inRootFolder,omitempty"`
+	// Disagreements is the number of files Sonarr's manual import preview
+	// reads differently with Options.CrossCheck.
+	Disagreements int `json:"disagreements,omitempty"`
+	// BytesRead is the number of bytes read from the files of the scan.
+	BytesRead int64 `json:"bytesRead,omitempty"`
+	// SonarrAPI is what the scan asked of Sonarr, nil for nothing.
+	SonarrAPI *APIUsage `json:"sonarrApi,omitempty"`
+	// DiskSpace lists the root folders that files of the scan did not fit
+	// in, as sonarr.checkFreeSpace found.
+	DiskSpace []DiskSpaceShortage `json:"diskSpace,omitempty"`
+	// UnavailablePaths lists the root folders Sonarr could not reach that
+	// files of the scan would have been imported into.
+	UnavailablePaths []UnavailablePath `json:"unavailablePaths,omitempty"`
+	RetryQueue       int               `json:"retryQueue,omitempty"`
+	LimitReached     bool              `json:"limitReached,omitempty"`
+	// Remaining is the number of files left for a later scan because of the
+	// file limit.
+	Remaining   int  `json:"remaining,omitempty"`
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Rescan counts the second pass over the files that appeared during the
+	// scan, nil when it found none.
+	Rescan *RescanResult `json:"rescan,omitempty"`
+	// Series groups the files by series once the scan has finished.
+	Series []SeriesSummary `json:"series,omitempty"`
+	// Latency sums up the Latency of the imported files.
+	Latency *LatencyStats `json:"latency,omitempty"`
+	// Error is set when the scan stopped early because of an error.
+	Error string `json:"error,omitempty"`
+}
+
+// RescanResult counts the second pass of a scan, which walks the downloads
+// folder once more at its end for the video files the first walk missed.
+type RescanResult struct {
+	// Files is the number of new files the pass processed. They count
+	// towards the totals of the scan as well.
+	Files    int `json:"files"`
+	Imported int `json:"imported"`
+	DryRun   int `json:"dryRun,omitempty"`
+	Skipped  int `json:"skipped,omitempty"`
+	Failed   int `json:"failed"`
+	// Unsettled is the number of new files left for the next scan because
+	// they were still being written.
+	Unsettled int `json:"unsettled,omitempty"`
+}
+
+func newScanResult(folder string) *ScanResult {
+	return &ScanResult{
+		ID:        newScanID(),
+		Folder:    folder,
+		StartedAt: time.Now(),
+		Failures:  make(map[ErrorCategory]int),
+	}
+}
+
+// newScanID returns a unique scan ID that sorts by the time the scan started.
+func newScanID() string {
+	var b [3]byte
+	rand.Read(b[:])
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// add appends a file result and updates the counters.
+func (r *ScanResult) add(f FileResult) {
+	r.Files = append(r.Files, f)
+	r.Total++
+	if f.Instance != "" {
+		if r.Instances == nil {
+			r.Instances = make(map[string]int)
+		}
+		r.Instances[f.Instance]++
+	}
+	if f.SeriesAdded {
+		r.SeriesAdded++
+	}
+	if f.RolledBack {
+		r.RolledBack++
+	}
+	if len(f.Disagreements) > 0 {
+		r.Disagreements++
+	}
+	r.BytesRead += f.BytesRead
+	if f.MovieAdded {
+		r.MoviesAdded++
+	}
+	switch f.Action {
+	case ActionImported:
+		r.Imported++
+	case ActionDryRun:
+		r.DryRun++
+	case ActionFailed:
+		r.Failed++
+		r.Failures[f.Category]++
+	}
+	if f.Rescan {
+		r.rescan().add(f)
+	}
+}
+
+// rescan returns Rescan, creating it.
+func (r *ScanResult) rescan() *RescanResult {
+	if r.Rescan == nil {
+		r.Rescan = &RescanResult{}
+	}
+	return r.Rescan
+}
+
+func (r *RescanResult) add(f FileResult) {
+	r.Files++
+	switch f.Action {
+	case ActionImported:
+		r.Imported++
+	case ActionDryRun:
+		r.DryRun++
+	case ActionFailed:
+		if f.Skipped() {
+			r.Skipped++
+		} else {
+			r.Failed++
+		}
+	}
+}
+
+// finish sorts the file results by path so the summary is stable regardless
+// of the order the workers finished in.
+func (r *ScanResult) finish() {
+	r.FinishedAt = time.Now()
+	sort.Slice(r.Files, func(i, j int) bool {
+		return r.Files[i].Path < r.Files[j].Path
+	})
+	r.Series = r.GroupBySeries()
+	r.Latency = latencyStats(r.Files)
+}
+
+// Succeeded is the number of files that were imported, or would have been in
+// dry-run mode.
+func (r *ScanResult) Succeeded() int {
+	return r.Imported + r.DryRun
+}
+
+// Unmatched is the number of failed files that could not be matched to a
+// series.
+func (r *ScanResult) Unmatched() int {
+	n := 0
+	for category, count := range r.Failures {
+		if category.Unmatched() {
+			n += count
+		}
+	}
+	return n
+}
+
+// logFileResult logs the outcome of a single file as soon as it is known.
+func (im *Importer) logFileResult(f FileResult) {
+	name := filepath.Base(f.Path)
+	switch f.Action {
+	case ActionImported:
+		if f.Movie != nil {
+			im.Logger.Infof("✓ Successfully imported movie: %s (%d)", f.MovieTitle, f.Movie.Year)
+			break
+		}
+		im.Logger.Infof("✓ Successfully imported: %s S%02dE%02d%s", f.Parsed.Title, f.Parsed.Season, f.Parsed.Episode, instanceSuffix(f.Instance))
+	case ActionDryRun:
+		im.logPlan(name, f.Plan)
+	case ActionFailed:
+		if f.PendingSeries != nil {
+			im.Logger.Warnf("Parked %s until new series %s is approved with the approve command", name, f.PendingSeries)
+			break
+		}
+		if f.Category == CategoryDuplicate || f.Category == CategoryComplete {
+			im.Logger.Infof("Skipping %s: %v", name, f.Err)
+			break
+		}
+		if f.Category == CategoryAwaitingMetadata {
+			im.Logger.Infof("Deferring %s until its episode is listed: %v", name, f.Err)
+			break
+		}
+		im.Logger.Repeatf(logging.LevelError, f.Path, string(f.Category), "Failed to process %s: %v", name, f.Err)
+	}
+	im.Logger.Debugf("Finished %s in %v", name, f.Duration.Round(time.Millisecond))
+}
+
+// LogSummary logs the end-of-scan summary.
+func (r *ScanResult) LogSummary(log *logging.Logger) {
+	log.Infof("Found %d video files in %s", r.Total, r.Folder)
+
+	if r.Interrupted {
+		log.Warnf("Scan interrupted, remaining files will be processed in a later scan")
+	}
+
+	if r.Ignored > 0 {
+		log.Infof("%d ignored file(s) skipped", r.Ignored)
+	}
+	if r.Seeding > 0 {
+		log.Infof("%d file(s) left for their torrent to finish seeding", r.Seeding)
+	}
+	if r.TooOld > 0 {
+		log.Infof("%d file(s) modified before the cutoff left alone", r.TooOld)
+	}
+	if r.InRootFolder > 0 {
+		log.Warnf("%d file(s) skipped inside a Sonarr root folder", r.InRootFolder)
+	}
+	if r.Deferred > 0 {
+		log.Infof("%d file(s) left for their retry", r.Deferred)
+	}
+	if r.Rescan != nil && r.Rescan.Unsettled > 0 {
+		log.Infof("%d file(s) that appeared during the scan are still being written and left for the next scan", r.Rescan.Unsettled)
+	}
+	if r.Total == 0 {
+		if r.RetryQueue > 0 {
+			log.Infof("%d file(s) waiting in the retry queue", r.RetryQueue)
+		}
+		log.Infof("No video files to process")
+		return
+	}
+
+	if r.LimitReached {
+		log.Infof("File limit of %d reached, %d more file(s) will be processed in a later scan", r.Total, r.Remaining)
+	}
+
+	verb := "imported"
+	if r.DryRun > 0 && r.Imported == 0 {
+		verb = "to import"
+	}
+	if s := r.Rescan; s != nil && s.Files > 0 {
+		log.Infof("%d file(s) appeared during the scan and were processed in a second pass: %d %s, %d skipped, %d failed", s.Files, s.Imported+s.DryRun, verb, s.Skipped, s.Failed)
+	}
+	skipped := r.Skipped()
+	series := r.Series
+	if series == nil {
+		series = r.GroupBySeries()
+	}
+	if log.JSON() {
+		for _, s := range series {
+			log.InfoFields("Series summary", s.fields())
+		}
+		fields := map[string]any{
+			"total": r.Total, "imported": r.Imported, "dryRun": r.DryRun,
+			"skipped": skipped, "failed": r.Failed - skipped, "failures": r.Failures,
+		}
+		if r.Latency != nil {
+			fields["latency"] = r.Latency
+		}
+		if r.SonarrAPI != nil {
+			fields["sonarrApi"] = r.SonarrAPI
+		}
+		log.InfoFields("Processing complete", fields)
+	} else {
+		log.Infof("Processing complete: %d/%d files %s, %d skipped, %d failed", r.Succeeded(), r.Total, verb, skipped, r.Failed-skipped)
+		logSeriesTable(log, series)
+		if l := r.Latency; l != nil {
+			log.Infof("  time to import: median %v, p90 %v, p99 %v, max %v over %d file(s)",
+				roundLatency(l.P50), roundLatency(l.P90), roundLatency(l.P99), roundLatency(l.Max), l.Files)
+		}
+		if r.SonarrAPI != nil {
+			log.Infof("  Sonarr API: %s", r.SonarrAPI.Summary())
+		}
+	}
+
+	names := make([]string, 0, len(r.Instances))
+	for name := range r.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Infof("  sent to %s: %d", name, r.Instances[name])
+	}
+	if r.RetryQueue > 0 {
+		log.Infof("%d file(s) waiting in the retry queue", r.RetryQueue)
+	}
+	if r.RolledBack > 0 {
+		log.Infof("%d new series rolled back because their first import failed", r.RolledBack)
+	}
+	if r.Disagreements > 0 {
+		log.Warnf("%d file(s) read differently by Sonarr's manual import preview", r.Disagreements)
+	}
+	for _, s := range r.DiskSpace {
+		log.Warnf("%d file(s) (%s) deferred, root folder %s%s has only %s free", s.Files, config.FormatSize(s.Needed), s.RootFolder, instanceSuffix(s.Instance), config.FormatSize(s.Free))
+	}
+	if r.Failed == 0 || log.JSON() {
+		return
+	}
+
+	categories := make([]string, 0, len(r.Failures))
+	for category, n := range r.Failures {
+		categories = append(categories, fmt.Sprintf("%s %d", category, n))
+	}
+	sort.Strings(categories)
+	log.Infof("  totals: %s", strings.Join(categories, ", "))
+}
+
+// logSeriesTable logs series as a table with a row per series, followed by
+// the files of each that were skipped or failed.
+func logSeriesTable(log *logging.Logger, series []SeriesSummary) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIES\tEPISODES\tUPGRADES\tSKIPPED\tFAILED")
+	for _, s := range series {
+		episodes := s.Episodes
+		switch {
+		case s.MovieID != 0 && s.Imported > 0:
+			episodes = "movie"
+		case episodes == "":
+			episodes = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", s.Label(), episodes, s.Upgrades, len(s.Skipped), len(s.Failed))
+	}
+	w.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		log.Infof("  %s", strings.TrimRight(line, " "))
+	}
+
+	for _, s := range series {
+		for _, o := range s.Skipped {
+			log.Infof("  skipped: %s (%s)%s", o.File, o.Reason, instanceSuffix(s.Instance))
+		}
+		for _, o := range s.Failed {
+			log.Infof("  failed: %s (%s)%s", o.File, o.Reason, instanceSuffix(s.Instance))
+		}
+	}
+}
+
+// instanceSuffix names the instance of a file in log lines, if any.
+func instanceSuffix(instance string) string {
+	if instance == "" {
+		return ""
+	}
+	return " on " + instance
+}
+
+// logPlan logs what a real run would do with the file called name.
+func (im *Importer) logPlan(name string, p *Plan) {
+	if p.Movie {
+		movie := fmt.Sprintf("existing movie %s (ID: %d)", p.MovieTitle, p.MovieID)
+		if p.NewMovie {
+			movie = fmt.Sprintf("new movie %s (TMDB: %d) in %s", p.MovieTitle, p.TmdbID, im.Config.Radarr.RootFolder)
+		}
+		im.Logger.Infof("[DRY RUN] %s: would hand to Radarr as %s, mode %s", name, movie, p.ImportMode)
+		for _, w := range p.Warnings {
+			im.Logger.Warnf("[DRY RUN] %s: %s", name, w)
+		}
+		return
+	}
+	series := fmt.Sprintf("existing series %s (ID: %d)", p.SeriesTitle, p.SeriesID)
+	label := (&parser.ParsedAnime{Season: p.Season, Episode: p.Episode, EndEpisode: p.EndEpisode}).Label()
+	episode := fmt.Sprintf("%s (episode ID: %d)", label, p.EpisodeID)
+	if len(p.EpisodeIDs) > 1 {
+		episode = fmt.Sprintf("%s (episode IDs: %v)", label, p.EpisodeIDs)
+	}
+	if p.NewSeries {
+		series = fmt.Sprintf("new series %s (TVDB: %d)", p.SeriesTitle, p.TvdbID)
+		episode = label
+	}
+	if p.NewSeries {
+		series += fmt.Sprintf(" at %s with quality profile %d", p.SeriesPath, p.QualityProfile)
+		if p.SeriesType != "" {
+			series += " and series type " + p.SeriesType
+		}
+		series += ", monitoring " + formatSeasons(p.MonitoredSeasons)
+		if p.SearchForMissing {
+			series += " and searching for their missing episodes"
+		}
+	}
+	series += instanceSuffix(p.Instance)
+	if p.Folder != "" {
+		series += " (settings of folder " + p.Folder + ")"
+	}
+	if p.Pin != "" {
+		series += " (pinned by " + p.Pin + ")"
+	}
+	im.Logger.Infof("[DRY RUN] %s: would import as %s of %s, quality %s, language %s, mode %s",
+		name, episode, series, p.Quality.Name, p.Language.Name, p.ImportMode)
+	if p.Renumbered != "" {
+		im.Logger.Infof("[DRY RUN] %s: renumbered, %s", name, p.Renumbered)
+	}
+	for _, w := range p.Warnings {
+		im.Logger.Warnf("[DRY RUN] %s: %s", name, w)
+	}
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rollbackTimeout bounds the deletion of a series whose first import failed.
+// It does not depend on the file's context, which may be what ran out.
+const rollbackTimeout = 30 * time.Second
+
+// errNoEpisodesYet is wrapped by the ErrEpisodeNotFound of a series Sonarr
+// has not loaded any episodes of, which is normal right after adding it.
+var errNoEpisodesYet = errors.New("the series has no episodes yet")
+
+// seriesTracker follows the series the files of one scan use, so a series
+// the scan added can be rolled back when its first import fails.
+type seriesTracker struct {
+	mu     sync.Mutex
+	series map[seriesKey]*seriesUse
+}
+
+// seriesKey identifies a series of a Sonarr instance.
+type seriesKey struct {
+	instance string
+	id       int
+}
+
+// seriesUse counts the files of the scan that use a series.
+type seriesUse struct {
+	// added is set when a file of the scan added the series.
+	added bool
+	// inFlight is the number of files whose outcome is not known yet.
+	inFlight int
+	imported int
+}
+
+func newSeriesTracker() *seriesTracker {
+	return &seriesTracker{series: make(map[seriesKey]*seriesUse)}
+}
+
+// use records that a file is about to import into the series key, which it
+// added when added is set. The file must call done once its outcome is known.
+func (t *seriesTracker) use(key seriesKey, added bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.series[key]
+	if u == nil {
+		u = &seriesUse{}
+		t.series[key] = u
+	}
+	u.added = u.added || added
+	u.inFlight++
+}
+
+// done records the outcome of a file that used the series key. For a failed
+// file that added the series, it reports whether the series may be rolled
+// back: no file of the scan imported into it and no other file is still
+// using it. The series is then forgotten, so later files add it again.
+func (t *seriesTracker) done(key seriesKey, imported, added bool) (rollback bool, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.series[key]
+	if u == nil {
+		return false, ""
+	}
+	u.inFlight--
+	if imported {
+		u.imported++
+	}
+	switch {
+	case imported || !added:
+		return false, ""
+	case u.imported > 0:
+		return false, fmt.Sprintf("%d other file(s) of this scan were imported into it", u.imported)
+	case u.inFlight > 0:
+		return false, fmt.Sprintf("%d other file(s) of this scan are still using it", u.inFlight)
+	}
+	delete(t.series, key)
+	return true, ""
+}
+
+// rollbackSeries deletes the series that the failed file of result added,
+// when sonarr.rollbackNewSeries is set and no other file of the scan needs
+// it. The files of the series stay on disk.
+func (im *Importer) rollbackSeries(ctx context.Context, inst *Instance, tracker *seriesTracker, result *FileResult, cause error) {
+	key := seriesKey{instance: inst.Name, id: result.SeriesID}
+	rollback, reason := tracker.done(key, false, result.SeriesAdded)
+	if !result.SeriesAdded || !inst.Config.RollbackNewSeries {
+		return
+	}
+	switch {
+	case errors.Is(cause, errNoEpisodesYet):
+		im.Logger.Debugf("Keeping new series %s, Sonarr has not loaded its episodes yet", result.SeriesTitle)
+		return
+	case errors.Is(cause, ErrAwaitingMetadata):
+		im.Logger.Debugf("Keeping new series %s, its episode of %s is not listed yet", result.SeriesTitle, result.Path)
+		return
+	case errors.Is(cause, ErrImportNotVerified):
+		// Sonarr accepted the file, which it may still move into the series
+		im.Logger.Debugf("Keeping new series %s, Sonarr accepted the import of %s", result.SeriesTitle, result.Path)
+		return
+	case !rollback:
+		im.Logger.Infof("Keeping new series %s although the import of %s failed: %s", result.SeriesTitle, result.Path, reason)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	if err := inst.Client.DeleteSeries(ctx, result.SeriesID, false); err != nil {
+		im.Logger.Errorf("Failed to roll back new series %s (ID: %d), remove it in Sonarr: %v", result.SeriesTitle, result.SeriesID, err)
+		return
+	}
+	result.RolledBack = true
+	im.Logger.Warnf("Rolled back new series %s (ID: %d) because its first import failed: %v", result.SeriesTitle, result.SeriesID, cause)
+}
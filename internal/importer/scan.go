@@ -0,0 +1,380 @@
+package importer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// Video file extensions
+var videoExtensions = map[string]bool{
+	".mp4":  true,
+	".mkv":  true,
+	".avi":  true,
+	".m4v":  true,
+	".mov":  true,
+	".wmv":  true,
+	".flv":  true,
+	".webm": true,
+	".ts":   true,
+	".m2ts": true,
+}
+
+// IsVideoFile reports whether path has a known video extension.
+func IsVideoFile(path string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Orders in which a scan processes files.
+const (
+	// OrderPath processes files in lexical path order.
+	OrderPath = "path"
+	// OrderMtime processes the oldest files first.
+	OrderMtime = "mtime"
+	// OrderMtimeDesc processes the newest files first.
+	OrderMtimeDesc = "mtime-desc"
+	// OrderSize processes the smallest files first.
+	OrderSize = "size"
+)
+
+// fileOrders compare two video files in each order. Paths break their ties,
+// so the order is the same on every run.
+var fileOrders = map[string]func(a, b videoFile) int{
+	OrderPath:      func(a, b videoFile) int { return 0 },
+	OrderMtime:     func(a, b videoFile) int { return a.modTime.Compare(b.modTime) },
+	OrderMtimeDesc: func(a, b videoFile) int { return b.modTime.Compare(a.modTime) },
+	OrderSize:      func(a, b videoFile) int { return cmp.Compare(a.size, b.size) },
+}
+
+// sortVideos sorts videos in the order of opts, with the files modified after
+// opts.newSince first when it is set.
+func sortVideos(videos []videoFile, opts walkOptions) {
+	compare, ok := fileOrders[opts.order]
+	if !ok {
+		compare = fileOrders[OrderPath]
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		a, b := videos[i], videos[j]
+		if !opts.newSince.IsZero() {
+			if aNew, bNew := a.modTime.After(opts.newSince), b.modTime.After(opts.newSince); aNew != bNew {
+				return aNew
+			}
+		}
+		if c := compare(a, b); c != 0 {
+			return c < 0
+		}
+		return a.path < b.path
+	})
+}
+
+// videoFile is a video file a scan found, with the size and modification
+// time the walk read so the importer needs no further stat call.
+type videoFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// newVideoFile returns the video file at path, whose directory entry is d.
+// The entry of a symlink describes the link, so its target is read instead.
+func newVideoFile(path string, d fs.DirEntry) (videoFile, error) {
+	var info fs.FileInfo
+	var err error
+	if d.Type()&fs.ModeSymlink != 0 {
+		info, err = os.Stat(path)
+	} else {
+		info, err = d.Info()
+	}
+	if err != nil {
+		return videoFile{path: path}, err
+	}
+	return videoFile{path: path, size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// walkResult is the outcome of a walk once every file has been sent.
+type walkResult struct {
+	// remaining is the number of video files left out because of the limit.
+	remaining int
+	// old is the number of video files left out because they were modified
+	// before opts.since.
+	old int
+	err error
+}
+
+// Ways of importing symlinked video files.
+const (
+	// SymlinkLink imports the file by the path of the link.
+	SymlinkLink = "link"
+	// SymlinkTarget imports the file the link points to.
+	SymlinkTarget = "target"
+)
+
+// walkOptions tell a scan how to treat symlinks.
+type walkOptions struct {
+	order string
+	// newSince, when not zero, puts the files modified after it before the
+	// others.
+	newSince time.Time
+	// since, when not zero, leaves out the files modified before it.
+	since time.Time
+	// followSymlinks descends into symlinked directories.
+	followSymlinks bool
+	// symlinkFiles is SymlinkLink or SymlinkTarget.
+	symlinkFiles string
+	// maxDepth is how many levels of folders below the root are scanned, 0
+	// for all.
+	maxDepth int
+	log      *logging.Logger
+}
+
+// tooOld reports whether file was modified before o.since. Files whose
+// modification time could not be read are kept.
+func (o walkOptions) tooOld(file videoFile) bool {
+	return !o.since.IsZero() && !file.modTime.IsZero() && file.modTime.Before(o.since)
+}
+
+// walkOptions returns the walk settings of the configuration.
+func (im *Importer) walkOptions() walkOptions {
+	p := im.Config.Parsing
+	return walkOptions{order: p.Order, followSymlinks: p.FollowSymlinks, symlinkFiles: p.SymlinkFiles, maxDepth: p.MaxDepth, log: im.Logger}
+}
+
+// filePath returns the path a video file found at path is imported by, which
+// is the target of a symlink with SymlinkTarget.
+func (o walkOptions) filePath(path string) (string, error) {
+	if o.symlinkFiles != SymlinkTarget {
+		return path, nil
+	}
+	if info, err := os.Lstat(path); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return path, nil
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// walkVideos calls fn for every video file below root, with the path the file
+// is imported by and its entry. Files keep paths below root even when root or
+// a followed directory is a symlink. Broken symlinks, folders below the depth
+// limit and symlinked directories that are not followed, or that lead to a
+// directory already scanned, are skipped with a debug message. Directories
+// below root that cannot be read, as for a lack of permission, are skipped
+// with a warning so the rest of the tree is still scanned.
+func walkVideos(root string, opts walkOptions, fn func(path string, d fs.DirEntry) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	visited := map[string]bool{realRoot: true}
+
+	// walk scans the directory real under the name dir
+	var walk func(dir, real string) error
+	walk = func(dir, real string) error {
+		return filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+			name := dir
+			if path != real {
+				rel, _ := filepath.Rel(real, path)
+				name = filepath.Join(dir, rel)
+			}
+			if err != nil {
+				if path == realRoot {
+					return err
+				}
+				skipUnreadable(opts.log, name, err)
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			deep := opts.maxDepth > 0 && depth(root, name) > opts.maxDepth
+			if d.IsDir() {
+				if deep {
+					opts.log.Debugf("Skipping %s, which is deeper than parsing.maxDepth", name)
+					return filepath.SkipDir
+				}
+				if path != real && visited[path] {
+					opts.log.Debugf("Skipping %s, which was already scanned through a symlink", name)
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink == 0 {
+				if !IsVideoFile(path) {
+					return nil
+				}
+				return fn(name, d)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				opts.log.Debugf("Skipping broken symlink %s: %v", name, err)
+				return nil
+			}
+			if !info.IsDir() {
+				if !IsVideoFile(path) {
+					return nil
+				}
+				file, err := opts.filePath(path)
+				if err != nil {
+					opts.log.Debugf("Skipping symlink %s: %v", name, err)
+					return nil
+				}
+				return fn(file, fs.FileInfoToDirEntry(info))
+			}
+			if deep {
+				opts.log.Debugf("Skipping symlink %s, which is deeper than parsing.maxDepth", name)
+				return nil
+			}
+			if !opts.followSymlinks {
+				opts.log.Debugf("Skipping symlinked directory %s; set parsing.followSymlinks to scan it", name)
+				return nil
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				opts.log.Debugf("Skipping symlink %s: %v", name, err)
+				return nil
+			}
+			for v := range visited {
+				if target == v || strings.HasPrefix(target, v+string(filepath.Separator)) {
+					opts.log.Debugf("Skipping symlink %s to %s, which is already scanned", name, target)
+					return nil
+				}
+			}
+			visited[target] = true
+			return walk(name, target)
+		})
+	}
+	return walk(root, realRoot)
+}
+
+// skipUnreadable warns that the walk skips name, a directory or file below
+// the root that it cannot read, with a hint for a permission error. The
+// warning repeats at most once per repeat window while nothing changes.
+func skipUnreadable(log *logging.Logger, name string, err error) {
+	if errors.Is(err, fs.ErrPermission) {
+		log.Repeatf(logging.LevelWarn, name, string(CategoryPermission), "Skipping %s, permission denied; %s", name, permissionHint(name))
+		return
+	}
+	log.Repeatf(logging.LevelWarn, name, "unreadable", "Skipping %s: %v", name, err)
+}
+
+// depth returns how many folders below root the directory dir is.
+func depth(root, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// scanVideoFiles walks rootPath in the background and sends each video file on
+// the returned channel. In path order files are sent as soon as the walk finds
+// them; in the other orders, and when new files go first, the walk completes
+// first and the files are sent sorted. At most limit files are sent when limit
+// is positive, and the walk stops early when ctx is cancelled. The result
+// channel receives the walk result once the file channel has been closed.
+func scanVideoFiles(ctx context.Context, rootPath string, limit int, opts walkOptions) (<-chan videoFile, <-chan walkResult) {
+	files := make(chan videoFile)
+	done := make(chan walkResult, 1)
+
+	go func() {
+		defer close(done)
+		defer close(files)
+
+		if opts.order != "" && opts.order != OrderPath || !opts.newSince.IsZero() {
+			done <- sendSorted(ctx, rootPath, limit, opts, files)
+			return
+		}
+
+		var res walkResult
+		sent := 0
+		res.err = walkVideos(rootPath, opts, func(path string, d fs.DirEntry) error {
+			// Old files do not count toward the limit
+			var file videoFile
+			if !opts.since.IsZero() {
+				if file, _ = newVideoFile(path, d); opts.tooOld(file) {
+					res.old++
+					return nil
+				}
+			}
+			// Past the limit the walk only counts what is left
+			if limit > 0 && sent >= limit {
+				res.remaining++
+				return nil
+			}
+			if file.path == "" {
+				file, _ = newVideoFile(path, d)
+			}
+			select {
+			case files <- file:
+			case <-ctx.Done():
+				return filepath.SkipAll
+			}
+			sent++
+			return nil
+		})
+		done <- res
+	}()
+
+	return files, done
+}
+
+// sendSorted collects every video file below rootPath and sends them in the
+// order of opts.
+func sendSorted(ctx context.Context, rootPath string, limit int, opts walkOptions, files chan<- videoFile) walkResult {
+	var videos []videoFile
+	old := 0
+	err := walkVideos(rootPath, opts, func(path string, d fs.DirEntry) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		video, err := newVideoFile(path, d)
+		if err != nil {
+			// Gone since the directory was read, or not ours to stat
+			skipUnreadable(opts.log, path, err)
+			return nil
+		}
+		if opts.tooOld(video) {
+			old++
+			return nil
+		}
+		videos = append(videos, video)
+		return nil
+	})
+	if err != nil {
+		return walkResult{old: old, err: err}
+	}
+
+	sortVideos(videos, opts)
+	if !opts.newSince.IsZero() {
+		newFiles := 0
+		for _, v := range videos {
+			if v.modTime.After(opts.newSince) {
+				newFiles++
+			}
+		}
+		if newFiles > 0 && newFiles < len(videos) {
+			opts.log.Debugf("Processing %d file(s) modified since the last scan before the %d other(s)", newFiles, len(videos)-newFiles)
+		}
+	}
+
+	res := walkResult{old: old}
+	if limit > 0 && len(videos) > limit {
+		res.remaining = len(videos) - limit
+		videos = videos[:limit]
+	}
+	for _, v := range videos {
+		select {
+		case files <- v:
+		case <-ctx.Done():
+			return res
+		}
+	}
+	return res
+}
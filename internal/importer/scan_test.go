@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// walk returns the base names of the video files scanVideoFiles sends for
+// root in order, and the walk result.
+func walk(t *testing.T, root string, limit int, opts walkOptions) ([]string, walkResult) {
+	t.Helper()
+	files, done := scanVideoFiles(context.Background(), root, limit, opts)
+	var names []string
+	for f := range files {
+		names = append(names, filepath.Base(f.path))
+	}
+	return names, <-done
+}
+
+// writeTree creates the files at the slash-separated paths below root.
+func writeTree(t *testing.T, root string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		path := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// skipAsRoot skips tests of permission errors, which root does not get.
+func skipAsRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+}
+
+func TestWalkSkipsUnstattableFilesInEveryOrder(t *testing.T) {
+	skipAsRoot(t)
+	root := t.TempDir()
+	writeTree(t, root, "a.mkv", "listable/b.mkv")
+	// Without execute permission the entries of a directory can be listed
+	// but not stat'ed
+	listable := filepath.Join(root, "listable")
+	if err := os.Chmod(listable, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(listable, 0o755) })
+
+	for _, order := range []string{OrderPath, OrderMtime, OrderMtimeDesc, OrderSize} {
+		names, res := walk(t, root, 0, walkOptions{order: order})
+		if res.err != nil {
+			t.Errorf("order %s: walk failed: %v", order, res.err)
+		}
+		if !slices.Contains(names, "a.mkv") {
+			t.Errorf("order %s: walk found %q, want a.mkv among them", order, names)
+		}
+	}
+}
+
+func TestWalkSkipsUnreadableDirectory(t *testing.T) {
+	skipAsRoot(t)
+	root := t.TempDir()
+	writeTree(t, root, "a.mkv", "locked/b.mkv", "open/c.mkv", "open/deep/d.mkv", "z.mkv")
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0o755) })
+
+	var out bytes.Buffer
+	names, res := walk(t, root, 0, walkOptions{order: OrderPath, log: logging.New(&out, logging.LevelDebug)})
+	if res.err != nil {
+		t.Fatalf("walk failed: %v", res.err)
+	}
+	if want := []string{"a.mkv", "c.mkv", "d.mkv", "z.mkv"}; !slices.Equal(names, want) {
+		t.Errorf("walk found %q, want %q", names, want)
+	}
+	if !strings.Contains(out.String(), "Skipping "+locked+", permission denied; it is uid ") {
+		t.Errorf("no warning with a hint for the locked directory:\n%s", out.String())
+	}
+
+	// The downloads folder itself being unreadable still fails the scan
+	if err := os.Chmod(root, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(root, 0o755)
+	if _, res := walk(t, root, 0, walkOptions{order: OrderPath}); !errors.Is(res.err, fs.ErrPermission) {
+		t.Errorf("walk of an unreadable root: %v, want a permission error", res.err)
+	}
+}
+
+// writeAged creates a file of size bytes below root for each name, modified
+// at base plus its offset in minutes.
+func writeAged(t *testing.T, root string, base time.Time, files map[string]struct{ minutes, size int }) {
+	t.Helper()
+	for name, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, f.size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		at := base.Add(time.Duration(f.minutes) * time.Minute)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkOrders(t *testing.T) {
+	root := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	writeAged(t, root, base, map[string]struct{ minutes, size int }{
+		"b.mkv":          {minutes: 30, size: 300},
+		"a.mkv":          {minutes: 10, size: 200},
+		"sub/c.mkv":      {minutes: 20, size: 100},
+		"sub/deep/d.mkv": {minutes: 40, size: 400},
+		// Ties are broken by path
+		"e.mkv": {minutes: 10, size: 100},
+	})
+	log := logging.New(io.Discard, logging.LevelDebug)
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"a.mkv", "b.mkv", "e.mkv", "c.mkv", "d.mkv"}},
+		{OrderPath, []string{"a.mkv", "b.mkv", "e.mkv", "c.mkv", "d.mkv"}},
+		{OrderMtime, []string{"a.mkv", "e.mkv", "c.mkv", "b.mkv", "d.mkv"}},
+		{OrderMtimeDesc, []string{"d.mkv", "b.mkv", "c.mkv", "a.mkv", "e.mkv"}},
+		{OrderSize, []string{"e.mkv", "c.mkv", "a.mkv", "b.mkv", "d.mkv"}},
+	}
+	for _, tt := range tests {
+		// The same tree gives the same order on every run
+		for run := 0; run < 3; run++ {
+			names, res := walk(t, root, 0, walkOptions{order: tt.order, log: log})
+			if res.err != nil {
+				t.Fatalf("order %q: %v", tt.order, res.err)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("order %q: got %q, want %q", tt.order, names, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWalkNewFilesFirst(t *testing.T) {
+	root := t.TempDir()
+	lastScan := time.Now().Add(-time.Hour)
+	writeAged(t, root, lastScan, map[string]struct{ minutes, size int }{
+		"backlog/a.mkv": {minutes: -300, size: 100},
+		"backlog/b.mkv": {minutes: -200, size: 300},
+		"backlog/c.mkv": {minutes: -100, size: 200},
+		"new/x.mkv":     {minutes: 20, size: 200},
+		"new/y.mkv":     {minutes: 10, size: 100},
+	})
+	log := logging.New(io.Discard, logging.LevelDebug)
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{OrderPath, []string{"x.mkv", "y.mkv", "a.mkv", "b.mkv", "c.mkv"}},
+		{OrderMtime, []string{"y.mkv", "x.mkv", "a.mkv", "b.mkv", "c.mkv"}},
+		{OrderMtimeDesc, []string{"x.mkv", "y.mkv", "c.mkv", "b.mkv", "a.mkv"}},
+		{OrderSize, []string{"y.mkv", "x.mkv", "a.mkv", "c.mkv", "b.mkv"}},
+	}
+	for _, tt := range tests {
+		names, res := walk(t, root, 0, walkOptions{order: tt.order, newSince: lastScan, log: log})
+		if res.err != nil {
+			t.Fatalf("order %q: %v", tt.order, res.err)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("order %q with new files first: got %q, want %q", tt.order, names, tt.want)
+		}
+	}
+
+	// With a limit the new files are the ones processed
+	names, res := walk(t, root, 2, walkOptions{order: OrderMtime, newSince: lastScan, log: log})
+	if want := []string{"y.mkv", "x.mkv"}; !slices.Equal(names, want) || res.remaining != 3 {
+		t.Errorf("limit 2: got %q with %d remaining, want %q with 3", names, res.remaining, want)
+	}
+}
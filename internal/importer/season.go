@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// inferSeason sets the season of anime, whose name has none, from the
+// episodes of series when sonarr.inferSeason is set: the only season that has
+// its episodes or, when several do and series is still airing, its latest
+// monitored season as long as the episodes have no file there yet. Otherwise
+// the default season stays, and the returned warning says why. Every step is
+// logged at debug level. Reading the episodes failing keeps the default
+// season too, as the episode lookup fails the same way.
+func (im *Importer) inferSeason(ctx context.Context, inst *Instance, series *sonarr.Series, anime *parser.ParsedAnime) string {
+	if !inst.Config.InferSeason || !anime.DefaultSeason {
+		return ""
+	}
+	episodes, err := inst.Client.GetEpisodes(ctx, series.ID)
+	if err != nil {
+		im.Logger.Debugf("Season inference for %s failed, keeping season %d: %v", anime.OriginalFilename, anime.Season, err)
+		return ""
+	}
+	numbers := episodeNumbers(anime)
+	if len(episodes) == 0 {
+		im.Logger.Debugf("Season inference for %s: %s has no episodes yet, keeping season %d", anime.OriginalFilename, series.Title, anime.Season)
+		return ""
+	}
+
+	seasons, latest := seasonsWith(episodes, anime.Episodes()), latestMonitoredSeason(series)
+	im.Logger.Debugf("Season inference for %s: %s is in season(s) %v of %s, which is %s with latest monitored season %d",
+		anime.OriginalFilename, numbers, seasons, series.Title, seriesStatus(series), latest)
+
+	var season int
+	var reason string
+	switch {
+	case len(seasons) == 0:
+		im.Logger.Debugf("Season inference for %s: no season of %s has %s, keeping season %d", anime.OriginalFilename, series.Title, numbers, anime.Season)
+		return ""
+	case len(seasons) == 1:
+		season, reason = seasons[0], "the only season with "+numbers
+	case !strings.EqualFold(series.Status, "continuing"):
+		reason = fmt.Sprintf("%s is in seasons %v and %s is not airing", numbers, seasons, series.Title)
+	case !slices.Contains(seasons, latest):
+		reason = fmt.Sprintf("%s is in seasons %v but not in the latest monitored season %d", numbers, seasons, latest)
+	case hasFile(seasonEpisodes(episodes, latest, anime.Episodes())):
+		reason = fmt.Sprintf("%s is in seasons %v and already has a file in the latest season %d", numbers, seasons, latest)
+	default:
+		season, reason = latest, fmt.Sprintf("the latest season of the airing series, without a file for %s yet", numbers)
+	}
+
+	if season == 0 {
+		im.Logger.Warnf("Season of %s is ambiguous: %s; keeping season %d", anime.OriginalFilename, reason, anime.Season)
+		return fmt.Sprintf("season %d kept because the season is ambiguous: %s", anime.Season, reason)
+	}
+	if season != anime.Season {
+		im.Logger.Infof("Inferred season %d for %s: %s", season, anime.OriginalFilename, reason)
+	} else {
+		im.Logger.Debugf("Season inference for %s: keeping season %d, %s", anime.OriginalFilename, season, reason)
+	}
+	anime.Season = season
+	anime.DefaultSeason = false
+	return ""
+}
+
+// episodeNumbers describes the episode numbers of anime, as in "episode 5"
+// or "episodes 5-7".
+func episodeNumbers(anime *parser.ParsedAnime) string {
+	if anime.EndEpisode > anime.Episode {
+		return fmt.Sprintf("episodes %d-%d", anime.Episode, anime.EndEpisode)
+	}
+	return "episode " + strconv.Itoa(anime.Episode)
+}
+
+// seasonsWith returns the regular seasons, in order, that have an episode of
+// every one of numbers. Specials are left out.
+func seasonsWith(episodes []sonarr.Episode, numbers []int) []int {
+	var seasons []int
+	for _, e := range episodes {
+		if e.SeasonNumber <= 0 || slices.Contains(seasons, e.SeasonNumber) {
+			continue
+		}
+		if len(seasonEpisodes(episodes, e.SeasonNumber, numbers)) == len(numbers) {
+			seasons = append(seasons, e.SeasonNumber)
+		}
+	}
+	slices.Sort(seasons)
+	return seasons
+}
+
+// seasonEpisodes returns the episodes of season with one of numbers.
+func seasonEpisodes(episodes []sonarr.Episode, season int, numbers []int) []sonarr.Episode {
+	var found []sonarr.Episode
+	for _, e := range episodes {
+		if e.SeasonNumber == season && slices.Contains(numbers, e.EpisodeNumber) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// latestMonitoredSeason returns the highest monitored regular season of
+// series, or 0 when none is monitored.
+func latestMonitoredSeason(series *sonarr.Series) int {
+	latest := 0
+	for _, s := range series.Seasons {
+		if s.Monitored && s.SeasonNumber > latest {
+			latest = s.SeasonNumber
+		}
+	}
+	return latest
+}
+
+func seriesStatus(series *sonarr.Series) string {
+	if series.Status == "" {
+		return "of unknown status"
+	}
+	return series.Status
+}
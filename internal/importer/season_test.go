@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// seasonOf returns the episodes 1 to n of season, the first withFile of them
+// with a file.
+func seasonOf(season, n, withFile int) []sonarr.Episode {
+	eps := make([]sonarr.Episode, n)
+	for i := range eps {
+		eps[i] = sonarr.Episode{SeasonNumber: season, EpisodeNumber: i + 1, Monitored: true, HasFile: i < withFile}
+	}
+	return eps
+}
+
+func TestInferSeason(t *testing.T) {
+	seasons := []sonarr.Season{{SeasonNumber: 0}, {SeasonNumber: 1, Monitored: true}, {SeasonNumber: 2, Monitored: true}}
+	tests := []struct {
+		desc     string
+		status   string
+		seasons  []sonarr.Season
+		episodes []sonarr.Episode
+		episode  int
+		end      int
+		want     int
+		// inferred is set when the season was decided rather than kept
+		inferred bool
+		// log is in the output at debug level, and warning in the warning
+		// of an ambiguous season
+		log     string
+		warning string
+	}{
+		{
+			desc: "the only season with the episode", status: "ended", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 24, 0)...), episode: 20, want: 2, inferred: true,
+			log: "Inferred season 2 for Show - 20.mkv: the only season with episode 20",
+		},
+		{
+			desc: "the only season with every episode of a range", status: "ended", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 24, 0)...), episode: 11, end: 13, want: 2, inferred: true,
+			log: "the only season with episodes 11-13",
+		},
+		{
+			desc: "the latest season of an airing series", status: "continuing", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 5, 4)...), episode: 5, want: 2, inferred: true,
+			log: "Inferred season 2 for Show - 05.mkv: the latest season of the airing series, without a file for episode 5 yet",
+		},
+		{
+			desc: "in the first season only", status: "continuing", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 5, 4)...), episode: 8, want: 1, inferred: true,
+			log: "keeping season 1, the only season with episode 8",
+		},
+		{
+			desc: "specials do not count", status: "ended", seasons: seasons,
+			episodes: append(seasonOf(0, 3, 0), seasonOf(2, 3, 0)...), episode: 3, want: 2, inferred: true,
+		},
+		{
+			desc: "ambiguous in an ended series", status: "ended", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 12, 0)...), episode: 5, want: 1,
+			warning: "episode 5 is in seasons [1 2] and Show is not airing",
+		},
+		{
+			desc: "ambiguous with a file in the latest season", status: "continuing", seasons: seasons,
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 6, 6)...), episode: 5, want: 1,
+			warning: "episode 5 is in seasons [1 2] and already has a file in the latest season 2",
+		},
+		{
+			desc: "ambiguous without the latest season monitored", status: "continuing",
+			seasons:  []sonarr.Season{{SeasonNumber: 1, Monitored: true}, {SeasonNumber: 2}, {SeasonNumber: 3, Monitored: true}},
+			episodes: append(seasonOf(1, 12, 12), seasonOf(2, 12, 0)...), episode: 5, want: 1,
+			warning: "episode 5 is in seasons [1 2] but not in the latest monitored season 3",
+		},
+		{
+			desc: "no season has the episode", status: "continuing", seasons: seasons,
+			episodes: seasonOf(1, 12, 0), episode: 13, want: 1,
+			log: "no season of Show has episode 13, keeping season 1",
+		},
+		{
+			desc: "no episodes yet", status: "upcoming", seasons: seasons,
+			episode: 1, want: 1,
+			log: "Show has no episodes yet, keeping season 1",
+		},
+	}
+	for _, tt := range tests {
+		srv := sonarrtest.New()
+		series := srv.AddSeries(sonarr.Series{Title: "Show", Status: tt.status, Seasons: tt.seasons}, tt.episodes...)
+		im := newTestImporter(t, srv, Options{})
+		im.instances[0].Config.InferSeason = true
+		var out bytes.Buffer
+		im.Logger = logging.New(&out, logging.LevelDebug)
+
+		anime := &parser.ParsedAnime{OriginalFilename: episodeFile(tt.episode), Title: "Show", Season: 1, DefaultSeason: true, Episode: tt.episode, EndEpisode: tt.end}
+		warning := im.inferSeason(context.Background(), im.instances[0], &series, anime)
+		srv.Close()
+
+		if anime.Season != tt.want {
+			t.Errorf("%s: season %d, want %d", tt.desc, anime.Season, tt.want)
+		}
+		if anime.DefaultSeason == tt.inferred {
+			t.Errorf("%s: DefaultSeason = %v, want %v", tt.desc, anime.DefaultSeason, !tt.inferred)
+		}
+		if (tt.warning == "") != (warning == "") || !strings.Contains(warning, tt.warning) {
+			t.Errorf("%s: warning %q, want %q", tt.desc, warning, tt.warning)
+		}
+		if tt.warning != "" && !strings.Contains(out.String(), "Season of "+episodeFile(tt.episode)+" is ambiguous: "+tt.warning) {
+			t.Errorf("%s: the ambiguity is not logged:\n%s", tt.desc, out.String())
+		}
+		if !strings.Contains(out.String(), tt.log) {
+			t.Errorf("%s: %q is not logged:\n%s", tt.desc, tt.log, out.String())
+		}
+	}
+}
+
+// episodeFile returns the name of the file of episode in TestInferSeason.
+func episodeFile(episode int) string {
+	return fmt.Sprintf("Show - %02d.mkv", episode)
+}
+
+func TestInferSeasonScan(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	series := srv.AddSeries(sonarr.Series{Title: "Frieren", TvdbID: frieren.TvdbID, Path: "/tv/Frieren", Monitored: true, Status: "continuing",
+		Seasons: []sonarr.Season{{SeasonNumber: 1, Monitored: true}, {SeasonNumber: 2, Monitored: true}}},
+		append(seasonOf(1, 28, 28), seasonOf(2, 6, 0)...)...)
+	im := newTestImporter(t, srv, Options{})
+	im.instances[0].Config.InferSeason = true
+	addFiles(t, im, frierenFile, "[SubsPlease] Frieren - 20 (1080p).mkv")
+
+	result := scan(t, im)
+	if f := fileResult(t, result, frierenFile); f.Action != ActionImported || f.Parsed.Season != 2 {
+		t.Errorf("episode 5: %s to season %d, %v; want an import to the airing season 2", f.Action, f.Parsed.Season, f.Err)
+	}
+	if f := fileResult(t, result, "[SubsPlease] Frieren - 20 (1080p).mkv"); f.Action != ActionImported || f.Parsed.Season != 1 {
+		t.Errorf("episode 20: %s to season %d, %v; want an import to season 1, the only one with it", f.Action, f.Parsed.Season, f.Err)
+	}
+	for _, imp := range srv.Imports() {
+		if imp.Files[0].SeriesID != series.ID {
+			t.Errorf("imported to series %d, want %d", imp.Files[0].SeriesID, series.ID)
+		}
+	}
+
+	// Without the option, the file goes to season 1 as before
+	im.instances[0].Config.InferSeason = false
+	addFiles(t, im, "[SubsPlease] Frieren - 03 (1080p).mkv")
+	if f := fileResult(t, scan(t, im), "[SubsPlease] Frieren - 03 (1080p).mkv"); f.Parsed.Season != 1 || !f.Parsed.DefaultSeason {
+		t.Errorf("episode 3 without inference: season %d (default %v), want the default season 1", f.Parsed.Season, f.Parsed.DefaultSeason)
+	}
+}
@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"context"
+	"sync"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// addKey is a series of the TVDB as added to one Sonarr instance.
+type addKey struct {
+	instance string
+	tvdbID   int
+}
+
+// seriesLocks serializes the adds of each series, so the files of a new
+// series processed at the same time do not all add it.
+type seriesLocks struct {
+	mu    sync.Mutex
+	locks map[addKey]*sync.Mutex
+}
+
+// lock locks the adds of key and returns the function that unlocks them.
+func (l *seriesLocks) lock(key addKey) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[addKey]*sync.Mutex)
+	}
+	m := l.locks[key]
+	if m == nil {
+		m = &sync.Mutex{}
+		l.locks[key] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// addedMeanwhile returns the library series of inst with tvdbID, which
+// another file added since its library was read, or nil.
+func (im *Importer) addedMeanwhile(ctx context.Context, inst *Instance, tvdbID int) (*sonarr.Series, error) {
+	library, err := inst.Client.GetSeries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range library {
+		if s.TvdbID == tvdbID {
+			return &library[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// ErrDuplicateSeries is returned with sonarr.failOnDuplicateSeries for files
+// that match more than one library series, such as a series added twice
+// under different paths or as anime and as standard.
+var ErrDuplicateSeries = errors.New("duplicate library series")
+
+// pickSeries returns the one of candidates, library series that all match
+// what describes them, that files of inst go to. Ties are broken by the
+// series type of inst, then by its root folder and then by the most recent
+// Added time, with the lowest ID last. More than one candidate is logged
+// with all of them, and fails with ErrDuplicateSeries when
+// sonarr.failOnDuplicateSeries is set.
+func (im *Importer) pickSeries(inst *Instance, what string, candidates []*sonarr.Series) (*sonarr.Series, error) {
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	ranked := append([]*sonarr.Series(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if ta, tb := sameSeriesType(inst, a), sameSeriesType(inst, b); ta != tb {
+			return ta
+		}
+		if ra, rb := inRootFolder(inst, a), inRootFolder(inst, b); ra != rb {
+			return ra
+		}
+		if aa, ab := addedTime(a), addedTime(b); !aa.Equal(ab) {
+			return aa.After(ab)
+		}
+		return a.ID < b.ID
+	})
+
+	list := make([]string, len(ranked))
+	for i, s := range ranked {
+		list[i] = fmt.Sprintf("%s (ID: %d, %s, %s)", s.Title, s.ID, seriesTypeName(s.SeriesType), s.Path)
+	}
+	if inst.Config.FailOnDuplicateSeries {
+		return nil, fmt.Errorf("%w: %s matches %d series: %s; remove the duplicates from Sonarr (sonarr.failOnDuplicateSeries is set)",
+			ErrDuplicateSeries, what, len(ranked), strings.Join(list, ", "))
+	}
+	suffix := ""
+	if im.MultiInstance() {
+		suffix = instanceSuffix(inst.Name)
+	}
+	im.Logger.Warnf("DUPLICATE SERIES%s: %s matches %d series: %s; using ID %d %s",
+		suffix, what, len(ranked), strings.Join(list, ", "), ranked[0].ID, pickReason(inst, ranked[0], ranked[1]))
+	return ranked[0], nil
+}
+
+// pickReason names the tiebreak that ranked first over second.
+func pickReason(inst *Instance, first, second *sonarr.Series) string {
+	switch {
+	case sameSeriesType(inst, first) != sameSeriesType(inst, second):
+		return "for its series type " + seriesTypeName(first.SeriesType)
+	case inRootFolder(inst, first) != inRootFolder(inst, second):
+		return "for its root folder " + inst.Config.RootFolder
+	case !addedTime(first).Equal(addedTime(second)):
+		return "as the most recently added"
+	}
+	return "as the lowest ID"
+}
+
+// sameSeriesType reports whether s has the series type files of inst add
+// series with.
+func sameSeriesType(inst *Instance, s *sonarr.Series) bool {
+	return inst.Config.SeriesType != "" && strings.EqualFold(s.SeriesType, inst.Config.SeriesType)
+}
+
+// inRootFolder reports whether s lies in the root folder of inst.
+func inRootFolder(inst *Instance, s *sonarr.Series) bool {
+	root := inst.Config.RootFolder
+	if root == "" {
+		return false
+	}
+	if s.RootFolderPath != "" {
+		return strings.TrimRight(s.RootFolderPath, `/\`) == strings.TrimRight(root, `/\`)
+	}
+	return config.HasRemotePrefix(s.Path, root)
+}
+
+// addedTime returns when s was added, or the zero time when Sonarr did not
+// say.
+func addedTime(s *sonarr.Series) time.Time {
+	t, _ := time.Parse(time.RFC3339, s.Added)
+	return t
+}
+
+func seriesTypeName(seriesType string) string {
+	if seriesType == "" {
+		return "no series type"
+	}
+	return seriesType
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// duplicateRoots are the root folders of the copies of duplicate.
+var duplicateRoots = []sonarr.RootFolder{
+	{ID: 1, Path: "/tv", Accessible: true, FreeSpace: 1 << 40},
+	{ID: 2, Path: "/old", Accessible: true, FreeSpace: 1 << 40},
+}
+
+// duplicate returns a library copy of Frieren with id at path, of
+// seriesType and added at added.
+func duplicate(id int, seriesType, path, added string) sonarr.Series {
+	root := path[:strings.LastIndex(path, "/")]
+	return sonarr.Series{ID: id, Title: "Frieren", TvdbID: frieren.TvdbID, SeriesType: seriesType, Path: path, RootFolderPath: root, Added: added}
+}
+
+func TestDuplicateSeriesTiebreaks(t *testing.T) {
+	tests := []struct {
+		desc       string
+		seriesType string
+		library    []sonarr.Series
+		want       int
+		reason     string
+	}{
+		{
+			desc:       "series type",
+			seriesType: "anime",
+			library: []sonarr.Series{
+				duplicate(101, "standard", "/tv/Frieren", "2024-05-01T00:00:00Z"),
+				duplicate(102, "anime", "/old/Frieren", "2023-05-01T00:00:00Z"),
+			},
+			want: 102, reason: "for its series type anime",
+		},
+		{
+			desc:       "root folder",
+			seriesType: "anime",
+			library: []sonarr.Series{
+				duplicate(101, "anime", "/old/Frieren", "2024-05-01T00:00:00Z"),
+				duplicate(102, "anime", "/tv/Frieren", "2023-05-01T00:00:00Z"),
+			},
+			want: 102, reason: "for its root folder /tv",
+		},
+		{
+			desc:       "most recently added",
+			seriesType: "anime",
+			library: []sonarr.Series{
+				duplicate(101, "anime", "/tv/Frieren", "2023-05-01T00:00:00Z"),
+				duplicate(102, "anime", "/tv/Frieren (2023)", "2024-05-01T00:00:00Z"),
+				duplicate(103, "anime", "/tv/Sousou no Frieren", ""),
+			},
+			want: 102, reason: "as the most recently added",
+		},
+		{
+			desc: "lowest ID",
+			library: []sonarr.Series{
+				duplicate(102, "standard", "/tv/Frieren", "2024-05-01T00:00:00Z"),
+				duplicate(101, "standard", "/tv/Frieren (2023)", "2024-05-01T00:00:00Z"),
+			},
+			want: 101, reason: "as the lowest ID",
+		},
+	}
+	for _, tt := range tests {
+		srv := sonarrtest.New()
+		srv.SetRootFolders(duplicateRoots...)
+		for _, s := range tt.library {
+			srv.AddSeries(s, episodes(28)...)
+		}
+		im := newTestImporter(t, srv, Options{})
+		im.instances[0].Config.SeriesType = tt.seriesType
+		var out bytes.Buffer
+		im.Logger = logging.New(&out, logging.LevelDebug)
+		addFiles(t, im, frierenFile)
+
+		f := fileResult(t, scan(t, im), frierenFile)
+		imports := srv.Imports()
+		srv.Close()
+
+		if f.Action != ActionImported || f.SeriesID != tt.want {
+			t.Errorf("%s: %s to series %d (%v), want an import to %d", tt.desc, f.Action, f.SeriesID, f.Err, tt.want)
+			continue
+		}
+		if len(imports) != 1 || imports[0].Files[0].SeriesID != tt.want {
+			t.Errorf("%s: imports %+v, want one to series %d", tt.desc, imports, tt.want)
+		}
+		log := out.String()
+		if want := fmt.Sprintf("using ID %d %s", tt.want, tt.reason); !strings.Contains(log, "DUPLICATE SERIES") || !strings.Contains(log, want) {
+			t.Errorf("%s: %q is not logged:\n%s", tt.desc, want, log)
+		}
+		for _, s := range tt.library {
+			if want := fmt.Sprintf("(ID: %d, %s, %s)", s.ID, s.SeriesType, s.Path); !strings.Contains(log, want) {
+				t.Errorf("%s: the candidate %q is not logged:\n%s", tt.desc, want, log)
+			}
+		}
+	}
+}
+
+func TestDuplicateSeriesFail(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.SetRootFolders(duplicateRoots...)
+	srv.AddSeries(duplicate(101, "anime", "/tv/Frieren", "2024-05-01T00:00:00Z"), episodes(28)...)
+	srv.AddSeries(duplicate(102, "standard", "/old/Frieren", "2023-05-01T00:00:00Z"), episodes(28)...)
+	im := newTestImporter(t, srv, Options{})
+	im.instances[0].Config.FailOnDuplicateSeries = true
+	addFiles(t, im, frierenFile)
+
+	f := fileResult(t, scan(t, im), frierenFile)
+	if f.Category != CategoryDuplicateSeries || f.Action == ActionImported {
+		t.Fatalf("result = %s (%s), err %v; want a duplicate library series failure", f.Action, f.Category, f.Err)
+	}
+	for _, path := range []string{"/tv/Frieren", "/old/Frieren"} {
+		if !strings.Contains(f.Err.Error(), path) {
+			t.Errorf("the error does not name %s: %v", path, f.Err)
+		}
+	}
+	if n := len(srv.Imports()); n != 0 {
+		t.Errorf("%d import(s) despite the duplicates, want none", n)
+	}
+	if n := len(srv.Series()); n != 2 {
+		t.Errorf("library has %d series, want the 2 duplicates and nothing added", n)
+	}
+}
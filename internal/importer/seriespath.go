@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// ErrPathUnavailable is returned for files of a series whose path lies in a
+// root folder Sonarr cannot reach, as happens when a volume is not mounted
+// in its container. Such imports would only fail later with file system
+// errors.
+var ErrPathUnavailable = errors.New("series path unavailable")
+
+// UnavailablePath describes a root folder that files of a scan were not
+// imported into because Sonarr cannot reach it.
+type UnavailablePath struct {
+	// Instance is set when more than one Sonarr instance is configured.
+	Instance string `json:"instance,omitempty"`
+	// RootFolder is the root folder of the series, or empty when none of the
+	// root folders of Sonarr holds their paths.
+	RootFolder string `json:"rootFolder,omitempty"`
+	// Series lists the paths of the series whose files were skipped.
+	Series []string `json:"series"`
+	Files  int      `json:"files"`
+}
+
+// seriesPaths holds, for one scan, the outcome of the path check of every
+// series files were imported into, and the root folders that failed it.
+type seriesPaths struct {
+	mu          sync.Mutex
+	checked     map[seriesKey]error
+	unavailable map[spaceKey]*UnavailablePath
+	order       []spaceKey
+}
+
+func newSeriesPaths() *seriesPaths {
+	return &seriesPaths{checked: make(map[seriesKey]error), unavailable: make(map[spaceKey]*UnavailablePath)}
+}
+
+// checkSeriesPath returns an ErrPathUnavailable error when the path of the
+// series of result is not below an accessible root folder of inst. Each
+// series is checked once per scan, and the check is skipped when the root
+// folders cannot be read.
+func (im *Importer) checkSeriesPath(ctx context.Context, scan *scanState, inst *Instance, result *FileResult) error {
+	if scan.paths == nil || result.SeriesPath == "" {
+		return nil
+	}
+	key := seriesKey{instance: inst.Name, id: result.SeriesID}
+	scan.paths.mu.Lock()
+	err, checked := scan.paths.checked[key]
+	scan.paths.mu.Unlock()
+	if !checked {
+		err = im.seriesPathError(ctx, scan.space, inst, result.SeriesPath)
+		scan.paths.mu.Lock()
+		scan.paths.checked[key] = err
+		scan.paths.mu.Unlock()
+	}
+	if err != nil {
+		scan.paths.add(im, inst, err, result.SeriesPath)
+	}
+	return err
+}
+
+// pathError is the ErrPathUnavailable error of a series, with the root folder
+// it lies in.
+type pathError struct {
+	rootFolder string
+	path       string
+}
+
+func (e *pathError) Error() string {
+	if e.rootFolder == "" {
+		return fmt.Sprintf("%v: %s is not below any root folder of Sonarr", ErrPathUnavailable, e.path)
+	}
+	return fmt.Sprintf("%v: root folder %s of %s is not accessible in Sonarr, check that it is mounted", ErrPathUnavailable, e.rootFolder, e.path)
+}
+
+func (e *pathError) Unwrap() error {
+	return ErrPathUnavailable
+}
+
+// seriesPathError checks path, the path of a series in Sonarr, against the
+// root folders of inst.
+func (im *Importer) seriesPathError(ctx context.Context, budget *spaceBudget, inst *Instance, path string) error {
+	folders := im.rootFolders(ctx, budget, inst)
+	if len(folders) == 0 {
+		return nil
+	}
+	for _, folder := range folders {
+		if !config.HasRemotePrefix(path, folder.Path) {
+			continue
+		}
+		if !folder.Accessible {
+			return &pathError{rootFolder: folder.Path, path: path}
+		}
+		return nil
+	}
+	return &pathError{path: path}
+}
+
+// add records the file of a series at path that failed the check with err,
+// warning about each root folder the first time.
+func (p *seriesPaths) add(im *Importer, inst *Instance, err error, path string) {
+	var pathErr *pathError
+	if !errors.As(err, &pathErr) {
+		return
+	}
+	key := spaceKey{instance: inst.Name, path: pathErr.rootFolder}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.unavailable[key]
+	if u == nil {
+		u = &UnavailablePath{RootFolder: pathErr.rootFolder}
+		if im.MultiInstance() {
+			u.Instance = inst.Name
+		}
+		p.unavailable[key] = u
+		p.order = append(p.order, key)
+		if pathErr.rootFolder == "" {
+			im.Logger.Warnf("SERIES PATH UNAVAILABLE%s: %s is not below any root folder of Sonarr, files of such series are skipped", instanceSuffix(u.Instance), path)
+		} else {
+			im.Logger.Warnf("SERIES PATH UNAVAILABLE%s: root folder %s is not accessible in Sonarr, files of its series are skipped until it is mounted", instanceSuffix(u.Instance), pathErr.rootFolder)
+		}
+	}
+	u.Files++
+	if !slices.Contains(u.Series, path) {
+		u.Series = append(u.Series, path)
+	}
+}
+
+// list returns the root folders that failed the check, in the order they
+// did.
+func (p *seriesPaths) list() []UnavailablePath {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var list []UnavailablePath
+	for _, key := range p.order {
+		list = append(list, *p.unavailable[key])
+	}
+	return list
+}
@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"testing"
+
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+func TestNewSeriesPathsOfAnotherSystem(t *testing.T) {
+	tests := []struct {
+		name, root, sonarrRoot, sep string
+		adopt                       []sonarr.UnmappedFolder
+		want                        string
+	}{
+		{name: "windows", root: `D:\TV`, sonarrRoot: `D:\TV`, want: `D:\TV\frieren`},
+		{name: "windows with a trailing separator", root: `D:\TV\`, sonarrRoot: `d:\tv\`, want: `D:\TV\frieren`},
+		{name: "unc", root: `\\nas\tv`, sonarrRoot: `\\NAS\TV`, want: `\\nas\tv\frieren`},
+		{name: "explicit separator", root: "D:/TV", sonarrRoot: "D:/TV", sep: `\`, want: `D:/TV\frieren`},
+		{name: "unix", root: "/tv", sonarrRoot: "/tv", want: "/tv/frieren"},
+		{
+			name: "adopted without a path", root: `D:\TV`, sonarrRoot: `D:\TV`,
+			adopt: []sonarr.UnmappedFolder{{Name: "Frieren"}},
+			want:  `D:\TV\Frieren`,
+		},
+		{
+			name: "adopted with a mixed path", root: `D:\TV`, sonarrRoot: `D:\TV`,
+			adopt: []sonarr.UnmappedFolder{{Name: "Frieren", Path: `D:\TV\Frieren`}},
+			want:  `D:\TV\Frieren`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := sonarrtest.New()
+			defer srv.Close()
+			srv.SetRootFolders(sonarr.RootFolder{ID: 1, Path: tt.sonarrRoot, Accessible: true, FreeSpace: 1 << 40, UnmappedFolders: tt.adopt})
+			srv.AddLookup("Frieren", frieren, episodes(28)...)
+			im := newTestImporter(t, srv, Options{})
+			im.Config.Sonarr.RootFolder = tt.root
+			im.Config.Sonarr.PathSeparator = tt.sep
+			im.Config.Sonarr.AdoptExistingFolders = tt.adopt != nil
+			im.instances[0].Config = im.Config.Sonarr
+			addFiles(t, im, "[SubsPlease] Frieren - 05 (1080p).mkv")
+
+			f := fileResult(t, scan(t, im), "[SubsPlease] Frieren - 05 (1080p).mkv")
+			if f.Action != ActionImported {
+				t.Fatalf("result = %s, err %v; want imported", f.Action, f.Err)
+			}
+			series := srv.Series()
+			if len(series) != 1 || series[0].Path != tt.want {
+				t.Errorf("series = %+v, want one at %s", series, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// ErrInsufficientSpace is returned for files that would not fit in the free
+// space of their root folder while sonarr.checkFreeSpace is set.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// DiskSpaceShortage describes a root folder that files of a scan did not fit
+// in.
+type DiskSpaceShortage struct {
+	// Instance is set when more than one Sonarr instance is configured.
+	Instance   string `json:"instance,omitempty"`
+	RootFolder string `json:"rootFolder"`
+	// Free is the free space Sonarr reported when the scan started.
+	Free   int64 `json:"free"`
+	Margin int64 `json:"margin"`
+	// Files is the number of deferred files and Needed their total size.
+	Files  int   `json:"files"`
+	Needed int64 `json:"needed"`
+}
+
+// spaceBudget tracks, for one scan, the free space of the root folders of
+// every Sonarr instance and the part of it that files of the scan reserved.
+// Sonarr reports the free space once per scan, so without the reservations
+// a batch of files could each fit on its own but not together.
+type spaceBudget struct {
+	mu        sync.Mutex
+	folders   map[string][]sonarr.RootFolder
+	reserved  map[spaceKey]int64
+	shortages map[spaceKey]*DiskSpaceShortage
+	order     []spaceKey
+}
+
+// spaceKey identifies a root folder of a Sonarr instance.
+type spaceKey struct {
+	instance string
+	path     string
+}
+
+func newSpaceBudget() *spaceBudget {
+	return &spaceBudget{
+		folders:   make(map[string][]sonarr.RootFolder),
+		reserved:  make(map[spaceKey]int64),
+		shortages: make(map[spaceKey]*DiskSpaceShortage),
+	}
+}
+
+// reserve sets aside size bytes in the root folder of inst that target, a
+// path in Sonarr, lies below. It returns an ErrInsufficientSpace error when
+// the file would not fit. The returned release gives the space back when the
+// import fails and does nothing after an error. The check is skipped, and
+// nothing reserved, when sonarr.checkFreeSpace is off, the size is unknown or
+// the root folders cannot be read.
+func (im *Importer) reserve(ctx context.Context, budget *spaceBudget, inst *Instance, target string, size int64) (release func(), err error) {
+	release = func() {}
+	if !inst.Config.CheckFreeSpace || size <= 0 || budget == nil {
+		return release, nil
+	}
+	margin, err := inst.Config.FreeSpaceMarginBytes()
+	if err != nil {
+		return release, fmt.Errorf("invalid sonarr.freeSpaceMargin: %w", err)
+	}
+
+	folder, ok := im.rootFolder(ctx, budget, inst, target)
+	if !ok {
+		return release, nil
+	}
+	key := spaceKey{instance: inst.Name, path: folder.Path}
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	reserved := budget.reserved[key]
+	if folder.FreeSpace-reserved-margin < size {
+		shortage := budget.shortages[key]
+		if shortage == nil {
+			shortage = &DiskSpaceShortage{RootFolder: folder.Path, Free: folder.FreeSpace, Margin: margin}
+			if im.MultiInstance() {
+				shortage.Instance = inst.Name
+			}
+			budget.shortages[key] = shortage
+			budget.order = append(budget.order, key)
+			im.Logger.Warnf("DISK SPACE LOW: root folder %s has %s free, imports into it that do not fit are deferred (sonarr.freeSpaceMargin is %s)",
+				folder.Path, config.FormatSize(folder.FreeSpace), config.FormatSize(margin))
+		}
+		shortage.Files++
+		shortage.Needed += size
+		return release, fmt.Errorf("%w: the file needs %s, root folder %s has %s free with %s reserved for this scan and a margin of %s",
+			ErrInsufficientSpace, config.FormatSize(size), folder.Path, config.FormatSize(folder.FreeSpace), config.FormatSize(reserved), config.FormatSize(margin))
+	}
+	budget.reserved[key] = reserved + size
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			budget.mu.Lock()
+			defer budget.mu.Unlock()
+			budget.reserved[key] -= size
+		})
+	}, nil
+}
+
+// rootFolders returns the root folders of inst, longest path first, reading
+// them once per scan. A failure is logged and returns none.
+func (im *Importer) rootFolders(ctx context.Context, budget *spaceBudget, inst *Instance) []sonarr.RootFolder {
+	budget.mu.Lock()
+	folders, loaded := budget.folders[inst.Name]
+	budget.mu.Unlock()
+	if loaded {
+		return folders
+	}
+	folders, err := inst.Client.RootFolders(ctx)
+	if err != nil {
+		im.Logger.Warnf("Importing without checking free space and series paths, failed to read the root folders of Sonarr: %v", err)
+		folders = nil
+	}
+	// The longest path is the most specific folder
+	sort.Slice(folders, func(i, j int) bool { return len(folders[i].Path) > len(folders[j].Path) })
+	budget.mu.Lock()
+	budget.folders[inst.Name] = folders
+	budget.mu.Unlock()
+	return folders
+}
+
+// rootFolder returns the accessible root folder of inst that target lies
+// below. Without one the check is skipped.
+func (im *Importer) rootFolder(ctx context.Context, budget *spaceBudget, inst *Instance, target string) (sonarr.RootFolder, bool) {
+	for _, folder := range im.rootFolders(ctx, budget, inst) {
+		if folder.Accessible && config.HasRemotePrefix(target, folder.Path) {
+			return folder, true
+		}
+	}
+	im.Logger.Debugf("No accessible root folder of Sonarr holds %s, importing without checking free space", target)
+	return sonarr.RootFolder{}, false
+}
+
+// shortageList returns the shortages of the scan in the order they occurred.
+func (b *spaceBudget) shortageList() []DiskSpaceShortage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []DiskSpaceShortage
+	for _, key := range b.order {
+		list = append(list, *b.shortages[key])
+	}
+	return list
+}
@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SeriesSummary groups the files of a scan by the series they went to.
+// Files of movies are grouped by movie, and files no series was found for by
+// their parsed title.
+type SeriesSummary struct {
+	// Instance is set when more than one Sonarr instance is configured.
+	Instance string `json:"instance,omitempty"`
+	SeriesID int    `json:"seriesId,omitempty"`
+	MovieID  int    `json:"movieId,omitempty"`
+	// Title is the title of the series or movie, or the parsed title when
+	// there is neither, and empty for files that did not parse.
+	Title string `json:"title"`
+	// Imported counts the files imported, or that would be in a dry run, and
+	// Episodes lists their episodes, such as "S02E05-E08, S02E10".
+	Imported int    `json:"imported"`
+	Episodes string `json:"episodes,omitempty"`
+	Upgrades int    `json:"upgrades,omitempty"`
+	// Skipped lists the files that were left alone on purpose and Failed
+	// those that failed.
+	Skipped []FileOutcome `json:"skipped,omitempty"`
+	Failed  []FileOutcome `json:"failed,omitempty"`
+}
+
+// FileOutcome names a file that was not imported and why.
+type FileOutcome struct {
+	File     string        `json:"file"`
+	Category ErrorCategory `json:"category"`
+	Reason   string        `json:"reason"`
+}
+
+// Skipped reports whether f was left alone on purpose rather than failed:
+// its episode came from a more trusted group or was imported before, Sonarr
+// did not miss it, it waits for its new series to be approved, or for TVDB
+// to list its episode.
+func (f FileResult) Skipped() bool {
+	return f.Action == ActionFailed && (f.PendingSeries != nil || f.Category == CategoryDuplicate || f.Category == CategoryComplete || f.Category == CategoryAwaitingMetadata)
+}
+
+// Skipped is the number of failed files that were skipped on purpose.
+func (r *ScanResult) Skipped() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Skipped() {
+			n++
+		}
+	}
+	return n
+}
+
+// GroupBySeries returns the summaries of the series of the files of r,
+// ordered by title with the files that did not parse last.
+func (r *ScanResult) GroupBySeries() []SeriesSummary {
+	type groupKey struct {
+		instance      string
+		series, movie int
+		title         string
+	}
+	groups := make(map[groupKey]*SeriesSummary)
+	episodes := make(map[groupKey][]seasonEpisode)
+	var order []groupKey
+	for _, f := range r.Files {
+		key := groupKey{instance: f.Instance, series: f.SeriesID, movie: f.MovieID, title: f.summaryTitle()}
+		if key.series != 0 || key.movie != 0 {
+			// Titles can change, IDs do not
+			key.title = ""
+		}
+		s := groups[key]
+		if s == nil {
+			s = &SeriesSummary{Instance: f.Instance, SeriesID: f.SeriesID, MovieID: f.MovieID, Title: f.summaryTitle()}
+			groups[key] = s
+			order = append(order, key)
+		}
+
+		switch {
+		case f.Action == ActionImported || f.Action == ActionDryRun:
+			s.Imported++
+			if f.Upgrade {
+				s.Upgrades++
+			}
+			if f.Parsed != nil && f.Movie == nil {
+				for _, e := range f.Parsed.Episodes() {
+					episodes[key] = append(episodes[key], seasonEpisode{f.Parsed.Season, e})
+				}
+			}
+		case f.Skipped():
+			s.Skipped = append(s.Skipped, f.outcome())
+		default:
+			s.Failed = append(s.Failed, f.outcome())
+		}
+	}
+
+	summaries := make([]SeriesSummary, 0, len(order))
+	for _, key := range order {
+		s := groups[key]
+		s.Episodes = formatEpisodes(episodes[key])
+		summaries = append(summaries, *s)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if (a.Title == "") != (b.Title == "") {
+			return b.Title == ""
+		}
+		if !strings.EqualFold(a.Title, b.Title) {
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+		return a.Instance < b.Instance
+	})
+	return summaries
+}
+
+// summaryTitle is the title f is grouped under.
+func (f FileResult) summaryTitle() string {
+	switch {
+	case f.SeriesTitle != "":
+		return f.SeriesTitle
+	case f.MovieTitle != "":
+		return f.MovieTitle
+	case f.Movie != nil:
+		return f.Movie.Title
+	case f.Parsed != nil:
+		return f.Parsed.Title
+	}
+	return ""
+}
+
+// outcome describes f, which was not imported.
+func (f FileResult) outcome() FileOutcome {
+	o := FileOutcome{File: filepath.Base(f.Path), Category: f.Category, Reason: string(f.Category)}
+	switch {
+	case f.PendingSeries != nil:
+		o.Reason = fmt.Sprintf("new series %s awaits approval", f.PendingSeries)
+	case f.Timeout != nil:
+		o.Reason += " in " + f.Timeout.Step
+	}
+	return o
+}
+
+// formatEpisodes lists episodes by season, merging runs of consecutive
+// episodes: "S01E01-E03, S01E05, S02E01".
+func formatEpisodes(episodes []seasonEpisode) string {
+	sort.Slice(episodes, func(i, j int) bool {
+		if episodes[i].season != episodes[j].season {
+			return episodes[i].season < episodes[j].season
+		}
+		return episodes[i].episode < episodes[j].episode
+	})
+	var parts []string
+	for i := 0; i < len(episodes); {
+		first := episodes[i]
+		last := first
+		for i++; i < len(episodes) && episodes[i].season == first.season && episodes[i].episode <= last.episode+1; i++ {
+			last = episodes[i]
+		}
+		part := fmt.Sprintf("S%02dE%02d", first.season, first.episode)
+		if last.episode > first.episode {
+			part += fmt.Sprintf("-E%02d", last.episode)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Label names s and its instance, if any, in summaries.
+func (s SeriesSummary) Label() string {
+	title := s.Title
+	if title == "" {
+		title = "(not parsed)"
+	}
+	return title + instanceSuffix(s.Instance)
+}
+
+// fields returns s as the fields of a JSON log line, leaving out what is not
+// set.
+func (s SeriesSummary) fields() map[string]any {
+	fields := map[string]any{"title": s.Title, "imported": s.Imported, "skipped": len(s.Skipped), "failed": len(s.Failed)}
+	if s.Instance != "" {
+		fields["instance"] = s.Instance
+	}
+	if s.SeriesID != 0 {
+		fields["seriesId"] = s.SeriesID
+	}
+	if s.MovieID != 0 {
+		fields["movieId"] = s.MovieID
+	}
+	if s.Episodes != "" {
+		fields["episodes"] = s.Episodes
+	}
+	if s.Upgrades > 0 {
+		fields["upgrades"] = s.Upgrades
+	}
+	if len(s.Skipped) > 0 {
+		fields["skippedFiles"] = s.Skipped
+	}
+	if len(s.Failed) > 0 {
+		fields["failedFiles"] = s.Failed
+	}
+	return fields
+}
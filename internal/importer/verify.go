@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// ErrImportNotVerified is returned when Sonarr accepted a manual import but
+// its episodes still have no file afterwards, as when Sonarr cannot read the
+// file or sees it under another path.
+var ErrImportNotVerified = errors.New("import not verified")
+
+const (
+	// verifyTimeout is how long the episodes of an import get to have their
+	// file.
+	verifyTimeout = 30 * time.Second
+	// verifyInterval is the time between two reads of the episodes.
+	verifyInterval = 2 * time.Second
+)
+
+// verifyImport reads episodes back from Sonarr after their import until each
+// of them has a file, or a file other than the one it had for an upgrade,
+// unless sonarr.skipImportVerification is set. It gives up after
+// verifyTimeout with ErrImportNotVerified. When the episodes have no file at
+// the first read, and again before giving up, Sonarr's manual import preview
+// is read for the reasons it rejects the file for, which fail it at once. A
+// file imported in move mode that is still in place afterwards is only
+// warned about, as Sonarr may finish moving it later.
+func (im *Importer) verifyImport(ctx context.Context, inst *Instance, anime *parser.ParsedAnime, result *FileResult, episodes []sonarr.Episode) error {
+	if inst.Config.SkipImportVerification {
+		return nil
+	}
+	result.step = "verify"
+	deadline := time.Now().Add(verifyTimeout)
+	pending := episodes
+	for first := true; ; first = false {
+		var missing []sonarr.Episode
+		for _, before := range pending {
+			after, err := inst.Client.GetEpisode(ctx, before.ID)
+			if err != nil {
+				return fmt.Errorf("failed to verify import: %w", err)
+			}
+			if !after.HasFile || (before.EpisodeFileID != 0 && after.EpisodeFileID == before.EpisodeFileID) {
+				missing = append(missing, before)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		timedOut := time.Now().Add(verifyInterval).After(deadline)
+		if first || timedOut {
+			if rejections := im.rejections(ctx, inst, result); len(rejections) > 0 {
+				result.Rejections = rejections
+				return &rejectionError{rejections: rejections}
+			}
+		}
+		if timedOut {
+			return fmt.Errorf("%w: Sonarr accepted %s but episode S%02dE%02d has no new file after %v; check that Sonarr can read the file and that its path is the same in the Sonarr container (sonarr.skipImportVerification skips this check)",
+				ErrImportNotVerified, anime.OriginalFilename, missing[0].SeasonNumber, missing[0].EpisodeNumber, verifyTimeout)
+		}
+		im.Logger.Debugf("Waiting for Sonarr to import %s: %d episode(s) without their file", anime.OriginalFilename, len(missing))
+		pending = missing
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyInterval):
+		}
+	}
+
+	if result.ImportMode == "move" {
+		if _, err := os.Stat(result.Path); err == nil {
+			im.Logger.Warnf("%s was imported in move mode but is still in place", result.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Escape returns s with its control characters, line separators and bytes
+// that are not valid UTF-8 escaped as in a Go string literal, such as "\n"
+// and "\xe9". A filename with a newline or a terminal escape then cannot
+// break a log line or forge one, and the bytes it had can still be told.
+func Escape(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == 0x7f || c >= utf8.RuneSelf {
+			return escapeFrom(s, i)
+		}
+	}
+	return s
+}
+
+// escapeFrom escapes s from offset i on, where Escape found the first byte
+// that may need it.
+func escapeFrom(s string, i int) string {
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp):
+			quoted := strconv.QuoteRune(r)
+			b.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
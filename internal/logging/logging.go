@@ -0,0 +1,193 @@
+// Package logging provides the leveled logger shared by all packages.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the minimum severity a Logger writes. Higher levels are more
+// detailed.
+type Level int32
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	// LevelTrace adds every HTTP exchange with Sonarr.
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name such as "debug".
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		return LevelWarn, nil
+	}
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, use one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// ParseFormat checks a log format name: "text" or "json".
+func ParseFormat(name string) (json bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown log format %q, use text or json", name)
+}
+
+// Logger writes leveled log lines. A nil *Logger discards everything, so
+// components can be built without one in tests. Messages pass through
+// Escape, so each one stays on its line whatever filenames it holds.
+type Logger struct {
+	out   *log.Logger
+	level atomic.Int32
+	json  atomic.Bool
+	// repeats is set by SetRepeatWindow.
+	repeats atomic.Pointer[repeats]
+}
+
+// New returns a Logger writing messages up to level to w with the standard
+// date and time prefix.
+func New(w io.Writer, level Level) *Logger {
+	l := &Logger{out: log.New(w, "", log.LstdFlags)}
+	l.SetLevel(level)
+	return l
+}
+
+// SetLevel changes the level of l. It is safe to call while l is in use.
+func (l *Logger) SetLevel(level Level) {
+	l.level.Store(int32(level))
+}
+
+// SetJSON switches l between text lines and one JSON object per line.
+func (l *Logger) SetJSON(enabled bool) {
+	l.json.Store(enabled)
+	if enabled {
+		l.out.SetFlags(0)
+	} else {
+		l.out.SetFlags(log.LstdFlags)
+	}
+}
+
+// JSON reports whether l writes JSON objects.
+func (l *Logger) JSON() bool {
+	return l != nil && l.json.Load()
+}
+
+// Level returns the current level of l.
+func (l *Logger) Level() Level {
+	if l == nil {
+		return LevelError
+	}
+	return Level(l.level.Load())
+}
+
+// Enabled reports whether messages at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level <= l.Level()
+}
+
+// Errorf logs an error message.
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelError, format, args...)
+}
+
+// Warnf logs a warning.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelWarn, format, args...)
+}
+
+// Infof logs an informational message.
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, format, args...)
+}
+
+// Debugf logs details that help to understand what the tool is doing.
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// Tracef logs low-level details such as HTTP exchanges.
+func (l *Logger) Tracef(format string, args ...any) {
+	l.logf(LevelTrace, format, args...)
+}
+
+// InfoFields logs an informational message with structured fields. In JSON
+// mode the fields become members of the object, next to time, level and msg,
+// which they cannot replace; in text mode they follow the message as
+// key=value pairs in the order of their keys.
+func (l *Logger) InfoFields(msg string, fields map[string]any) {
+	if !l.Enabled(LevelInfo) {
+		return
+	}
+	if !l.json.Load() {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			msg += fmt.Sprintf(" %s=%v", key, fields[key])
+		}
+		l.logf(LevelInfo, "%s", msg)
+		return
+	}
+
+	line, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().Format(time.RFC3339), LevelInfo.String(), Escape(msg)})
+	extra := make(map[string]any, len(fields))
+	for key, value := range fields {
+		if key != "time" && key != "level" && key != "msg" {
+			extra[key] = value
+		}
+	}
+	if data, err := json.Marshal(extra); err == nil && len(extra) > 0 {
+		line = append(append(line[:len(line)-1], ','), data[1:]...)
+	}
+	l.out.Print(string(line))
+}
+
+func (l *Logger) logf(level Level, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	msg := Escape(fmt.Sprintf(format, args...))
+	if !l.json.Load() {
+		l.out.Print("[" + strings.ToUpper(level.String()) + "] " + msg)
+		return
+	}
+
+	line, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().Format(time.RFC3339), level.String(), msg})
+	l.out.Print(string(line))
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// repeatSummaries is how many summaries of the repeats of a message are
+// written at most per window.
+const repeatSummaries = 4
+
+// repeats remembers the messages written by Repeatf, by subject.
+type repeats struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*repeat
+	pruned  time.Time
+}
+
+// repeat is the last message of a subject: its kind, when it was written in
+// full and how often it was repeated since.
+type repeat struct {
+	kind       string
+	logged     time.Time
+	summarized time.Time
+	last       time.Time
+	// count is the repeats since the last line, total those since the
+	// message was written in full.
+	count, total int
+}
+
+// SetRepeatWindow makes Repeatf write the message of a subject in full only
+// once per window while its kind stays the same; the repeats in between are
+// summarized in short "repeated N time(s)" lines. A window of 0 turns this
+// off, as it is by default, and every message is written in full.
+func (l *Logger) SetRepeatWindow(window time.Duration) {
+	if window <= 0 {
+		l.repeats.Store(nil)
+		return
+	}
+	l.repeats.Store(&repeats{window: window, entries: make(map[string]*repeat)})
+}
+
+// Repeatf logs a message at level about subject, such as the failure of a
+// file, unless the same kind of message about subject was written within the
+// repeat window. The first message about a subject is always written, and
+// so is one of another kind or one after the window expired.
+func (l *Logger) Repeatf(level Level, subject, kind, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	r := l.repeats.Load()
+	if r == nil {
+		l.logf(level, format, args...)
+		return
+	}
+	full, line := r.note(subject, kind, time.Now())
+	switch {
+	case full:
+		l.logf(level, "%s%s", fmt.Sprintf(format, args...), line)
+	case line != "":
+		l.logf(level, "%s", line)
+	}
+}
+
+// note records a message of kind about subject at now. When the message is
+// to be written in full, line is the suffix that counts its earlier repeats;
+// otherwise it is the summary to write instead, if any.
+func (r *repeats) note(subject, kind string, now time.Time) (full bool, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(now)
+
+	e := r.entries[subject]
+	if e == nil || e.kind != kind || now.Sub(e.logged) >= r.window {
+		if e != nil && e.kind == kind && e.total > 0 {
+			line = fmt.Sprintf(" (repeated %d time(s) since %s)", e.total, e.logged.Format("15:04"))
+		}
+		r.entries[subject] = &repeat{kind: kind, logged: now, summarized: now, last: now}
+		return true, line
+	}
+	e.last = now
+	e.count++
+	e.total++
+	if now.Sub(e.summarized) < r.window/repeatSummaries {
+		return false, ""
+	}
+	line = fmt.Sprintf("%s: %s, repeated %d time(s) since %s", subject, kind, e.count, e.summarized.Format("15:04"))
+	e.summarized = now
+	e.count = 0
+	return false, line
+}
+
+// prune forgets the subjects without a message for a whole window, at most
+// once per window.
+func (r *repeats) prune(now time.Time) {
+	if now.Sub(r.pruned) < r.window {
+		return
+	}
+	r.pruned = now
+	for subject, e := range r.entries {
+		if now.Sub(e.last) >= r.window {
+			delete(r.entries, subject)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package mediaserver asks Plex, Jellyfin and Emby to rescan the series that
+// received new episodes, so they show up without waiting for the server's
+// periodic library scan.
+package mediaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// refreshTimeout bounds the refresh requests sent after one scan.
+const refreshTimeout = 30 * time.Second
+
+// Server refreshes the library of one media server.
+type Server interface {
+	// Name identifies the server in log messages.
+	Name() string
+	// Refresh rescans paths, or the whole library when paths is empty.
+	Refresh(ctx context.Context, paths []string) error
+}
+
+// Refresher refreshes every configured server after a scan that imported at
+// least one file. It implements importer.Observer; refreshes run in the
+// background and their failures are only logged, so an unreachable server
+// never affects the import results.
+type Refresher struct {
+	servers []serverConfig
+	log     *logging.Logger
+	wg      sync.WaitGroup
+}
+
+type serverConfig struct {
+	server   Server
+	mappings []config.PathMapping
+}
+
+// New returns a Refresher for cfgs.
+func New(cfgs []config.MediaServerConfig, log *logging.Logger) (*Refresher, error) {
+	r := &Refresher{log: log}
+	for i, cfg := range cfgs {
+		server, err := newServer(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("media server %d: %w", i+1, err)
+		}
+		r.servers = append(r.servers, serverConfig{server: server, mappings: cfg.PathMappings})
+	}
+	return r, nil
+}
+
+func newServer(cfg config.MediaServerConfig) (Server, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", cfg.URL)
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	base := strings.TrimSuffix(cfg.URL, "/")
+
+	switch strings.ToLower(cfg.Type) {
+	case "plex":
+		if cfg.LibrarySection == "" {
+			return nil, fmt.Errorf("librarySection is required for Plex")
+		}
+		return &plex{base: base, token: cfg.Token, section: cfg.LibrarySection}, nil
+	case "jellyfin", "emby":
+		return &jellyfin{kind: strings.ToLower(cfg.Type), base: base, token: cfg.Token}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q, use plex, jellyfin or emby", cfg.Type)
+}
+
+// FileProcessed implements importer.Observer.
+func (r *Refresher) FileProcessed(importer.FileResult) {}
+
+// ScanFinished implements importer.Observer. Each series with an imported
+// file is refreshed once.
+func (r *Refresher) ScanFinished(result *importer.ScanResult) {
+	if len(r.servers) == 0 || result.Imported == 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	unknown := false
+	for _, f := range result.Files {
+		if f.Action != importer.ActionImported {
+			continue
+		}
+		if f.SeriesPath == "" {
+			unknown = true
+			continue
+		}
+		if !seen[f.SeriesPath] {
+			seen[f.SeriesPath] = true
+			paths = append(paths, f.SeriesPath)
+		}
+	}
+	sort.Strings(paths)
+	if unknown {
+		// Without a path only a full library refresh finds the new episode
+		paths = nil
+	}
+
+	for _, s := range r.servers {
+		mapped := make([]string, len(paths))
+		for i, p := range paths {
+			mapped[i] = config.MapPath(s.mappings, p)
+		}
+
+		r.wg.Add(1)
+		go func(s Server, paths []string) {
+			defer r.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+			defer cancel()
+			if err := s.Refresh(ctx, paths); err != nil {
+				r.log.Warnf("Failed to refresh %s: %v", s.Name(), err)
+				return
+			}
+			r.log.Debugf("Refreshed %s for %d series", s.Name(), len(paths))
+		}(s.server, mapped)
+	}
+}
+
+// Wait blocks until the running refreshes are done or timeout has passed.
+func (r *Refresher) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		r.log.Warnf("Gave up waiting for media server refreshes")
+	}
+}
+
+// plex uses the partial scan endpoint of a library section.
+type plex struct {
+	base, token, section string
+}
+
+func (p *plex) Name() string {
+	return "Plex"
+}
+
+func (p *plex) Refresh(ctx context.Context, paths []string) error {
+	endpoint := fmt.Sprintf("%s/library/sections/%s/refresh", p.base, url.PathEscape(p.section))
+	if len(paths) == 0 {
+		return p.get(ctx, endpoint, url.Values{})
+	}
+	for _, path := range paths {
+		if err := p.get(ctx, endpoint, url.Values{"path": {path}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *plex) get(ctx context.Context, endpoint string, query url.Values) error {
+	query.Set("X-Plex-Token", p.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return do(req)
+}
+
+// jellyfin reports changed folders to Jellyfin or Emby, which share the API.
+type jellyfin struct {
+	kind, base, token string
+}
+
+func (j *jellyfin) Name() string {
+	if j.kind == "emby" {
+		return "Emby"
+	}
+	return "Jellyfin"
+}
+
+func (j *jellyfin) Refresh(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.base+"/Library/Refresh", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Emby-Token", j.token)
+		return do(req)
+	}
+
+	type update struct {
+		Path       string `json:"Path"`
+		UpdateType string `json:"UpdateType"`
+	}
+	var body struct {
+		Updates []update `json:"Updates"`
+	}
+	for _, path := range paths {
+		body.Updates = append(body.Updates, update{Path: path, UpdateType: "Modified"})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.base+"/Library/Media/Updated", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Emby-Token", j.token)
+	return do(req)
+}
+
+// do performs req and turns a non-2xx answer into an error.
+func do(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package mediaserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// fakeServer records the requests of a fake media server, which answers
+// them with status.
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newFakeServer(t *testing.T, status int) *fakeServer {
+	f := &fakeServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		f.bodies = append(f.bodies, string(body))
+		f.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) received() ([]*http.Request, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...), append([]string(nil), f.bodies...)
+}
+
+// scanResult returns a scan that imported a file into each of paths, where
+// "" is a file without a series path, and failed one file of /tv/failed.
+func scanResult(paths ...string) *importer.ScanResult {
+	r := &importer.ScanResult{}
+	for _, p := range paths {
+		r.Files = append(r.Files, importer.FileResult{Action: importer.ActionImported, SeriesPath: p})
+		r.Imported++
+	}
+	r.Files = append(r.Files, importer.FileResult{Action: importer.ActionFailed, SeriesPath: "/tv/failed"})
+	r.Failed++
+	return r
+}
+
+func newRefresher(t *testing.T, cfgs ...config.MediaServerConfig) *Refresher {
+	t.Helper()
+	r, err := New(cfgs, logging.New(io.Discard, logging.LevelDebug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPlexRefreshesEachSeriesOnce(t *testing.T) {
+	plex := newFakeServer(t, http.StatusOK)
+	r := newRefresher(t, config.MediaServerConfig{
+		Type: "plex", URL: plex.URL, Token: "plex-token", LibrarySection: "2",
+		PathMappings: []config.PathMapping{{From: "/tv", To: "/data/tv"}},
+	})
+	r.ScanFinished(scanResult("/tv/frieren", "/tv/k-on", "/tv/frieren"))
+	r.Wait(5 * time.Second)
+
+	requests, _ := plex.received()
+	var paths []string
+	for _, req := range requests {
+		if req.Method != http.MethodGet || req.URL.Path != "/library/sections/2/refresh" {
+			t.Errorf("request %s %s, want GET /library/sections/2/refresh", req.Method, req.URL.Path)
+		}
+		if token := req.URL.Query().Get("X-Plex-Token"); token != "plex-token" {
+			t.Errorf("X-Plex-Token = %q, want plex-token", token)
+		}
+		paths = append(paths, req.URL.Query().Get("path"))
+	}
+	if want := []string{"/data/tv/frieren", "/data/tv/k-on"}; !slices.Equal(paths, want) {
+		t.Errorf("refreshed paths %q, want %q", paths, want)
+	}
+}
+
+func TestJellyfinBatchesUpdates(t *testing.T) {
+	jellyfin := newFakeServer(t, http.StatusNoContent)
+	r := newRefresher(t, config.MediaServerConfig{Type: "jellyfin", URL: jellyfin.URL, Token: "api-key"})
+	r.ScanFinished(scanResult("/tv/frieren", "/tv/k-on"))
+	r.Wait(5 * time.Second)
+
+	requests, bodies := jellyfin.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if req := requests[0]; req.Method != http.MethodPost || req.URL.Path != "/Library/Media/Updated" || req.Header.Get("X-Emby-Token") != "api-key" {
+		t.Errorf("request %s %s with token %q, want POST /Library/Media/Updated with api-key", req.Method, req.URL.Path, req.Header.Get("X-Emby-Token"))
+	}
+	var body struct {
+		Updates []struct{ Path, UpdateType string }
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Updates) != 2 || body.Updates[0].Path != "/tv/frieren" || body.Updates[1].Path != "/tv/k-on" {
+		t.Errorf("updates %+v, want /tv/frieren and /tv/k-on", body.Updates)
+	}
+}
+
+func TestFullRefreshWithoutSeriesPath(t *testing.T) {
+	jellyfin := newFakeServer(t, http.StatusNoContent)
+	r := newRefresher(t, config.MediaServerConfig{Type: "emby", URL: jellyfin.URL, Token: "api-key"})
+	r.ScanFinished(scanResult("/tv/frieren", ""))
+	r.Wait(5 * time.Second)
+
+	requests, _ := jellyfin.received()
+	if len(requests) != 1 || requests[0].URL.Path != "/Library/Refresh" {
+		t.Errorf("got %d requests, want one to /Library/Refresh", len(requests))
+	}
+}
+
+func TestNoRefreshWithoutImports(t *testing.T) {
+	plex := newFakeServer(t, http.StatusOK)
+	r := newRefresher(t, config.MediaServerConfig{Type: "plex", URL: plex.URL, Token: "t", LibrarySection: "1"})
+	r.ScanFinished(scanResult())
+	r.Wait(5 * time.Second)
+
+	if requests, _ := plex.received(); len(requests) != 0 {
+		t.Errorf("got %d requests after a scan without imports", len(requests))
+	}
+}
+
+func TestUnavailableServerDoesNotAffectScan(t *testing.T) {
+	broken := newFakeServer(t, http.StatusServiceUnavailable)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	r := newRefresher(t,
+		config.MediaServerConfig{Type: "plex", URL: broken.URL, Token: "t", LibrarySection: "1"},
+		config.MediaServerConfig{Type: "jellyfin", URL: down.URL, Token: "t"},
+	)
+	result := scanResult("/tv/frieren")
+	r.ScanFinished(result)
+	r.Wait(5 * time.Second)
+
+	if result.Imported != 1 || result.Failed != 1 {
+		t.Errorf("scan counters changed to %d imported, %d failed", result.Imported, result.Failed)
+	}
+	if requests, _ := broken.received(); len(requests) != 1 {
+		t.Errorf("got %d requests to the failing server, want 1", len(requests))
+	}
+}
+
+func TestNewRejectsInvalidServers(t *testing.T) {
+	for _, cfg := range []config.MediaServerConfig{
+		{Type: "plex", URL: "http://plex:32400", Token: "t"},
+		{Type: "plex", URL: "plex", Token: "t", LibrarySection: "1"},
+		{Type: "jellyfin", URL: "http://jellyfin:8096"},
+		{Type: "kodi", URL: "http://kodi:8080", Token: "t"},
+	} {
+		if _, err := New([]config.MediaServerConfig{cfg}, nil); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
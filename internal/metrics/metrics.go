@@ -0,0 +1,100 @@
+// Package metrics writes metrics in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Type is the type of a metric family.
+type Type string
+
+const (
+	Counter Type = "counter"
+	Gauge   Type = "gauge"
+)
+
+// Labels are the label names and values of a sample.
+type Labels map[string]string
+
+// Writer writes metric families one after the other. Every family must be
+// declared with Family before its samples are written.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns a Writer that writes to w. Flush must be called once all
+// metrics are written.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Family declares the metric name with its help text and type.
+func (w *Writer) Family(name, help string, typ Type) {
+	w.write("# HELP ", name, " ", strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), "\n")
+	w.write("# TYPE ", name, " ", string(typ), "\n")
+}
+
+// Sample writes a value of the metric name with labels.
+func (w *Writer) Sample(name string, labels Labels, value float64) {
+	w.write(name)
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for n := range labels {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		w.write("{")
+		for i, n := range names {
+			if i > 0 {
+				w.write(",")
+			}
+			w.write(n, `="`, escapeLabel(labels[n]), `"`)
+		}
+		w.write("}")
+	}
+	w.write(" ", strconv.FormatFloat(value, 'g', -1, 64), "\n")
+}
+
+// Metric declares a metric without labels and writes its only sample.
+func (w *Writer) Metric(name, help string, typ Type, value float64) {
+	w.Family(name, help, typ)
+	w.Sample(name, nil, value)
+}
+
+// Flush writes any buffered data and returns the first error that occurred.
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func (w *Writer) write(parts ...string) {
+	for _, p := range parts {
+		if w.err != nil {
+			return
+		}
+		_, w.err = w.w.WriteString(p)
+	}
+}
+
+// escapeLabel escapes a label value as the exposition format requires.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Bool returns 1 for true and 0 for false.
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
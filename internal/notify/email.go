@@ -0,0 +1,311 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// defaultEmailTemplate renders the scans of an email as plain-text tables.
+const defaultEmailTemplate = `{{range .Scans -}}
+Scan of {{.Folder}} at {{.FinishedAt.Format "2006-01-02 15:04"}}: {{.Succeeded}}/{{.Total}} files imported{{if .Interrupted}} (interrupted){{end}}
+{{end}}
+{{- with .Imported}}
+Imported episodes
+{{printf "%-40s %-8s %s" "Series" "Episode" "File"}}
+{{range .}}{{printf "%-40.40s %-8s %s" (series .) (episode .) (base .Path)}}
+{{end}}{{end}}
+{{- with .Skipped}}
+Skipped files (dry run)
+{{printf "%-40s %-8s %s" "Title" "Episode" "File"}}
+{{range .}}{{printf "%-40.40s %-8s %s" (series .) (episode .) (base .Path)}}
+{{end}}{{end}}
+{{- with .Failed}}
+Failures
+{{printf "%-20s %-40s %s" "Reason" "File" "Error"}}
+{{range .}}{{printf "%-20s %-40.40s %s" .Category (base .Path) (escape .Error)}}
+{{end}}{{end}}`
+
+var emailFuncs = template.FuncMap{
+	// base and escape escape control characters and invalid UTF-8, which
+	// filenames may hold
+	"base":   func(path string) string { return logging.Escape(filepath.Base(path)) },
+	"escape": logging.Escape,
+	"series": func(f importer.FileResult) string {
+		switch {
+		case f.SeriesTitle != "":
+			return f.SeriesTitle
+		case f.MovieTitle != "":
+			return f.MovieTitle
+		case f.Parsed != nil:
+			return f.Parsed.Title
+		case f.Movie != nil:
+			return f.Movie.Title
+		}
+		return ""
+	},
+	"episode": func(f importer.FileResult) string {
+		if f.Movie != nil {
+			return "movie"
+		}
+		if f.Parsed == nil {
+			return ""
+		}
+		return fmt.Sprintf("S%02dE%02d", f.Parsed.Season, f.Parsed.Episode)
+	},
+}
+
+// EmailData is what email templates are executed with.
+type EmailData struct {
+	Scans    []*importer.ScanResult
+	Imported []importer.FileResult
+	Skipped  []importer.FileResult
+	Failed   []importer.FileResult
+}
+
+// Email sends scan summaries over SMTP, either one email per scan or a digest
+// over a fixed period.
+type Email struct {
+	cfg    config.EmailConfig
+	tmpl   *template.Template
+	digest time.Duration
+	name   string
+	log    *logging.Logger
+
+	mu      sync.Mutex
+	pending []*importer.ScanResult
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewEmail returns an Email for cfg. With a digest period the email is sent
+// from a background goroutine that runs until Close and logs its failures to
+// log.
+func NewEmail(cfg config.EmailConfig, log *logging.Logger) (*Email, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("host, from and to are required")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("invalid tls mode %q, use starttls, tls or none", cfg.TLS)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == "tls" {
+			cfg.Port = 465
+		}
+	}
+
+	text := defaultEmailTemplate
+	if cfg.Template != "" {
+		data, err := os.ReadFile(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("email").Funcs(emailFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	digest, err := time.ParseDuration(cfg.Digest)
+	if cfg.Digest != "" && err != nil {
+		return nil, fmt.Errorf("invalid digest period %q: %w", cfg.Digest, err)
+	}
+
+	e := &Email{
+		cfg:    cfg,
+		tmpl:   tmpl,
+		digest: digest,
+		name:   "email " + strings.Join(cfg.To, ","),
+		log:    log,
+	}
+	if digest > 0 {
+		e.stop = make(chan struct{})
+		e.stopped = make(chan struct{})
+		go e.runDigest()
+	}
+	return e, nil
+}
+
+// Name implements Notifier.
+func (e *Email) Name() string {
+	return e.name
+}
+
+// Notify implements Notifier. Only scan events are mailed; with a digest
+// period they are collected until the next digest.
+func (e *Email) Notify(ctx context.Context, ev Event) error {
+	if ev.Scan == nil {
+		return nil
+	}
+	if e.digest > 0 && ev.Type != EventTest {
+		e.mu.Lock()
+		e.pending = append(e.pending, ev.Scan)
+		e.mu.Unlock()
+		return nil
+	}
+	return e.send(ctx, []*importer.ScanResult{ev.Scan})
+}
+
+// runDigest mails the collected scans every digest period.
+func (e *Email) runDigest() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.digest)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.flush(); err != nil {
+				e.log.Warnf("Failed to send digest to %s: %v", strings.Join(e.cfg.To, ", "), err)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// flush mails the collected scans, if any.
+func (e *Email) flush() error {
+	e.mu.Lock()
+	scans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(scans) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return e.send(ctx, scans)
+}
+
+// Close sends what the digest has collected so far.
+func (e *Email) Close() error {
+	if e.stop == nil {
+		return nil
+	}
+	close(e.stop)
+	<-e.stopped
+	return e.flush()
+}
+
+// send renders scans and mails them.
+func (e *Email) send(ctx context.Context, scans []*importer.ScanResult) error {
+	data := EmailData{Scans: scans}
+	var imported, total, failed int
+	for _, r := range scans {
+		imported += r.Succeeded()
+		total += r.Total
+		failed += r.Failed
+		for _, f := range r.Files {
+			switch f.Action {
+			case importer.ActionImported:
+				data.Imported = append(data.Imported, f)
+			case importer.ActionDryRun:
+				data.Skipped = append(data.Skipped, f)
+			case importer.ActionFailed:
+				data.Failed = append(data.Failed, f)
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	if err := e.tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	subject := fmt.Sprintf("sonarr-autoimport: %d/%d files imported", imported, total)
+	if len(scans) > 1 {
+		subject = fmt.Sprintf("sonarr-autoimport digest: %d/%d files imported in %d scans", imported, total, len(scans))
+	}
+	if failed > 0 {
+		subject += fmt.Sprintf(", %d failed", failed)
+	}
+
+	return e.deliver(ctx, subject, body.String())
+}
+
+// deliver connects to the SMTP server and sends one message.
+func (e *Email) deliver(ctx context.Context, subject, body string) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if e.cfg.TLS == "tls" {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake with %s failed: %w", addr, err)
+		}
+		conn = tlsConn
+	}
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP greeting from %s failed: %w", addr, err)
+	}
+	defer c.Close()
+
+	if e.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS, set tls to \"tls\" or \"none\"", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", addr, err)
+		}
+	}
+	if e.cfg.Username != "" {
+		auth := smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication as %s failed: %w", e.cfg.Username, err)
+		}
+	}
+
+	if err := c.Mail(e.cfg.From); err != nil {
+		return fmt.Errorf("sender %s rejected: %w", e.cfg.From, err)
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n",
+		e.cfg.From, strings.Join(e.cfg.To, ", "), subject, time.Now().Format(time.RFC1123Z))
+	w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return c.Quit()
+}
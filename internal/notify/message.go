@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// Levels group events for push priorities.
+const (
+	LevelFailure = "failure"
+	LevelSuccess = "success"
+	LevelInfo    = "info"
+)
+
+// Level returns how loudly e should be pushed. A scan with failed files or
+// one that was interrupted counts as a failure. Files awaiting metadata are
+// expected to import later and only count as info.
+func Level(e Event) string {
+	switch e.Type {
+	case EventFileFailed:
+		if e.File != nil && e.File.Category == importer.CategoryAwaitingMetadata {
+			return LevelInfo
+		}
+		return LevelFailure
+	case EventDiskSpace, EventPathUnavailable:
+		return LevelFailure
+	case EventFileImported:
+		return LevelSuccess
+	case EventScanFinished:
+		if e.Scan.Failed > e.Scan.Failures[importer.CategoryAwaitingMetadata] || e.Scan.Interrupted {
+			return LevelFailure
+		}
+		if e.Scan.Imported > 0 {
+			return LevelSuccess
+		}
+	}
+	return LevelInfo
+}
+
+// priority looks up the priority of e in overrides, then in defaults.
+func priority(e Event, overrides, defaults map[string]int) int {
+	level := Level(e)
+	if p, ok := overrides[level]; ok {
+		return p
+	}
+	return defaults[level]
+}
+
+// Message renders e as a short title and a plain-text body. Scan summaries
+// list the individual files below a separator, after the one-line summary
+// that push clients show when the message is collapsed.
+func Message(e Event) (title, body string) {
+	switch {
+	case e.Type == EventTest:
+		_, body = scanMessage(e.Scan)
+		return "Test notification from sonarr-autoimport", body
+	case e.Type == EventApprovalPending && e.File != nil && e.File.PendingSeries != nil:
+		return approvalMessage(e.File)
+	case e.Type == EventDiskSpace && e.Scan != nil:
+		return diskSpaceMessage(e.Scan)
+	case e.Type == EventPathUnavailable && e.Scan != nil:
+		return pathMessage(e.Scan)
+	case e.Scan != nil:
+		return scanMessage(e.Scan)
+	case e.File != nil:
+		return fileMessage(e.File)
+	}
+	return string(e.Type), ""
+}
+
+func fileMessage(f *importer.FileResult) (title, body string) {
+	name := logging.Escape(filepath.Base(f.Path))
+	episode := name
+	if f.Parsed != nil {
+		episode = fmt.Sprintf("%s S%02dE%02d", f.Parsed.Title, f.Parsed.Season, f.Parsed.Episode)
+	} else if f.Movie != nil {
+		episode = fmt.Sprintf("%s (%d)", f.Movie.Title, f.Movie.Year)
+	}
+
+	switch f.Action {
+	case importer.ActionImported:
+		title = "Imported " + episode
+		body = name
+		if f.SeriesAdded {
+			body += "\nAdded new series " + f.SeriesTitle
+		}
+		if f.MovieAdded {
+			body += "\nAdded new movie to Radarr: " + f.MovieTitle
+		}
+		if f.Instance != "" {
+			body += "\nSonarr instance: " + f.Instance
+		}
+	case importer.ActionDryRun:
+		title = "Would import " + episode
+		body = name
+	case importer.ActionFailed:
+		if f.Category == importer.CategoryAwaitingMetadata {
+			title = "Awaiting metadata: " + episode
+			body = name + "\nSonarr does not list the episode yet, the file is retried later"
+			break
+		}
+		fallthrough
+	default:
+		title = "Import failed: " + name
+		body = fmt.Sprintf("%s: %s", f.Category, logging.Escape(f.Error))
+	}
+	return title, body
+}
+
+func approvalMessage(f *importer.FileResult) (title, body string) {
+	name := logging.Escape(filepath.Base(f.Path))
+	if f.Parsed != nil {
+		name = fmt.Sprintf("%s (%s)", f.Parsed.Title, name)
+	}
+	title = "New series awaiting approval: " + f.PendingSeries.Title
+	body = fmt.Sprintf("%s would be added for %s\nRun \"approve\" to approve or reject it", f.PendingSeries, name)
+	return title, body
+}
+
+func diskSpaceMessage(r *importer.ScanResult) (title, body string) {
+	var b strings.Builder
+	files := 0
+	for _, s := range r.DiskSpace {
+		files += s.Files
+		fmt.Fprintf(&b, "%s has %s free", s.RootFolder, config.FormatSize(s.Free))
+		if s.Margin > 0 {
+			fmt.Fprintf(&b, " (margin %s)", config.FormatSize(s.Margin))
+		}
+		fmt.Fprintf(&b, ", %d file(s) of %s deferred", s.Files, config.FormatSize(s.Needed))
+		if s.Instance != "" {
+			fmt.Fprintf(&b, " [%s]", s.Instance)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Free up space in the library; the files are retried by later scans")
+	return fmt.Sprintf("Disk space low: %d file(s) not imported", files), b.String()
+}
+
+func pathMessage(r *importer.ScanResult) (title, body string) {
+	var b strings.Builder
+	files := 0
+	for _, u := range r.UnavailablePaths {
+		files += u.Files
+		if u.RootFolder != "" {
+			fmt.Fprintf(&b, "Root folder %s is not accessible: %d file(s) of %s skipped", u.RootFolder, u.Files, strings.Join(u.Series, ", "))
+		} else {
+			fmt.Fprintf(&b, "No root folder of Sonarr holds %s: %d file(s) skipped", strings.Join(u.Series, ", "), u.Files)
+		}
+		if u.Instance != "" {
+			fmt.Fprintf(&b, " [%s]", u.Instance)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Check that the root folders are mounted in Sonarr; the files are imported by the next scan after that")
+	return fmt.Sprintf("Series path unavailable: %d file(s) not imported", files), b.String()
+}
+
+// seriesLine describes the files of a scan that went to one series:
+// "imported S01E05-E08 (1 upgrade(s)), skipped 1 (duplicate episode)".
+func seriesLine(s importer.SeriesSummary) string {
+	var parts []string
+	if s.Imported > 0 {
+		part := "imported " + s.Episodes
+		switch {
+		case s.MovieID != 0:
+			part = "imported"
+		case s.Episodes == "":
+			part = fmt.Sprintf("imported %d", s.Imported)
+		}
+		if s.Upgrades > 0 {
+			part += fmt.Sprintf(" (%d upgrade(s))", s.Upgrades)
+		}
+		parts = append(parts, part)
+	}
+	if len(s.Skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("skipped %d (%s)", len(s.Skipped), outcomeReasons(s.Skipped)))
+	}
+	if len(s.Failed) > 0 {
+		parts = append(parts, fmt.Sprintf("failed %d (%s)", len(s.Failed), outcomeReasons(s.Failed)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// outcomeReasons lists the distinct reasons of outcomes.
+func outcomeReasons(outcomes []importer.FileOutcome) string {
+	var reasons []string
+	for _, o := range outcomes {
+		if !slices.Contains(reasons, o.Reason) {
+			reasons = append(reasons, o.Reason)
+		}
+	}
+	return strings.Join(reasons, ", ")
+}
+
+func scanMessage(r *importer.ScanResult) (title, body string) {
+	title = fmt.Sprintf("Scan finished: %d/%d files imported", r.Succeeded(), r.Total)
+	if r.Interrupted {
+		title += " (interrupted)"
+	}
+
+	var b strings.Builder
+	if r.Failed > 0 {
+		categories := make([]string, 0, len(r.Failures))
+		for category, n := range r.Failures {
+			categories = append(categories, fmt.Sprintf("%s: %d", category, n))
+		}
+		sort.Strings(categories)
+		fmt.Fprintf(&b, "%d failed (%s)", r.Failed, strings.Join(categories, ", "))
+	} else {
+		fmt.Fprintf(&b, "No failures")
+	}
+	if r.SeriesAdded > 0 {
+		fmt.Fprintf(&b, ", %d new series", r.SeriesAdded)
+	}
+	if r.MoviesAdded > 0 {
+		fmt.Fprintf(&b, ", %d new movie(s)", r.MoviesAdded)
+	}
+
+	series := r.Series
+	if series == nil {
+		series = r.GroupBySeries()
+	}
+	if len(series) > 0 {
+		b.WriteString("\n\n---\n")
+		for _, s := range series {
+			fmt.Fprintf(&b, "\n%s: %s", s.Label(), seriesLine(s))
+		}
+	}
+	return title, b.String()
+}
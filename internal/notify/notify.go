@@ -0,0 +1,281 @@
+// Package notify sends import events to external services.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+// EventType identifies what happened.
+type EventType string
+
+const (
+	EventFileImported EventType = "file.imported"
+	EventFileDryRun   EventType = "file.dry-run"
+	EventFileFailed   EventType = "file.failed"
+	EventScanFinished EventType = "scan.finished"
+	// EventApprovalPending is sent once for every new series that waits for
+	// approval because of sonarr.confirmNewSeries. File is the file that
+	// needs it.
+	EventApprovalPending EventType = "approval.pending"
+	// EventDiskSpace is sent after a scan that deferred files because their
+	// root folder was short of space, as sonarr.checkFreeSpace found. Scan
+	// is the scan.
+	EventDiskSpace EventType = "space.insufficient"
+	// EventPathUnavailable is sent after a scan that skipped files because
+	// the root folder of their series is not accessible in Sonarr. Scan is
+	// the scan.
+	EventPathUnavailable EventType = "path.unavailable"
+	// EventTest is sent by -test-notifications and passes every filter.
+	EventTest EventType = "test"
+)
+
+// Event is the document delivered to notification targets. File is set for
+// file events and Scan for scan events.
+type Event struct {
+	Type      EventType            `json:"type"`
+	Timestamp time.Time            `json:"timestamp"`
+	File      *importer.FileResult `json:"file,omitempty"`
+	Scan      *importer.ScanResult `json:"scan,omitempty"`
+}
+
+// Notifier delivers events to one target.
+type Notifier interface {
+	// Name identifies the target in log messages.
+	Name() string
+	Notify(ctx context.Context, e Event) error
+}
+
+const (
+	// queueSize is the number of events a slow target may fall behind by
+	// before new events are dropped.
+	queueSize = 256
+	// sendTimeout bounds a single delivery attempt.
+	sendTimeout = 10 * time.Second
+	// retryDelay is the wait before the first retry. It doubles with every
+	// further attempt.
+	retryDelay = time.Second
+)
+
+// target is a Notifier with its filter and delivery queue.
+type target struct {
+	notifier Notifier
+	filter   config.EventFilter
+	retries  int
+	queue    chan Event
+
+	// failed counts the failed deliveries since the last scan event, so a
+	// target that is down is reported once per scan instead of per file.
+	failed  int
+	lastErr error
+}
+
+// Dispatcher fans events out to the configured targets. Each target is
+// delivered to in its own goroutine so a slow service never holds up a scan.
+// Dispatcher implements importer.Observer.
+type Dispatcher struct {
+	log     *logging.Logger
+	targets []*target
+	wg      sync.WaitGroup
+}
+
+// New returns a Dispatcher for every target in cfg.
+func New(cfg config.NotificationsConfig, log *logging.Logger) (*Dispatcher, error) {
+	d := &Dispatcher{log: log}
+	for i, w := range cfg.Webhooks {
+		n, err := NewWebhook(w)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+		d.add(n, w.EventFilter, w.Retries)
+	}
+	for i, c := range cfg.Ntfy {
+		n, err := NewNtfy(c)
+		if err != nil {
+			return nil, fmt.Errorf("ntfy %d: %w", i+1, err)
+		}
+		d.add(n, c.EventFilter, c.Retries)
+	}
+	for i, c := range cfg.Gotify {
+		n, err := NewGotify(c)
+		if err != nil {
+			return nil, fmt.Errorf("gotify %d: %w", i+1, err)
+		}
+		d.add(n, c.EventFilter, c.Retries)
+	}
+	for i, c := range cfg.Telegram {
+		n, err := NewTelegram(c)
+		if err != nil {
+			return nil, fmt.Errorf("telegram %d: %w", i+1, err)
+		}
+		d.add(n, c.EventFilter, c.Retries)
+	}
+	for i, c := range cfg.Email {
+		n, err := NewEmail(c, log)
+		if err != nil {
+			return nil, fmt.Errorf("email %d: %w", i+1, err)
+		}
+		d.add(n, c.EventFilter, c.Retries)
+	}
+	return d, nil
+}
+
+// add registers n and starts its delivery goroutine.
+func (d *Dispatcher) add(n Notifier, filter config.EventFilter, retries int) {
+	t := &target{
+		notifier: n,
+		filter:   filter,
+		retries:  retries,
+		queue:    make(chan Event, queueSize),
+	}
+	d.targets = append(d.targets, t)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for e := range t.queue {
+			d.deliver(t, e)
+			if e.Type == EventScanFinished {
+				d.reportFailures(t)
+			}
+		}
+		d.reportFailures(t)
+	}()
+}
+
+// Len returns the number of targets.
+func (d *Dispatcher) Len() int {
+	return len(d.targets)
+}
+
+// Send queues e for every target whose filter accepts it.
+func (d *Dispatcher) Send(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	for _, t := range d.targets {
+		if !Accepts(t.filter, e.Type) {
+			continue
+		}
+		select {
+		case t.queue <- e:
+		default:
+			d.log.Warnf("Notification queue of %s is full, dropping %s event", t.notifier.Name(), e.Type)
+		}
+	}
+}
+
+// FileProcessed sends the file event matching the outcome of f.
+func (d *Dispatcher) FileProcessed(f importer.FileResult) {
+	d.Send(Event{Type: EventType("file." + string(f.Action)), File: &f})
+}
+
+// ScanFinished sends the scan summary, preceded by a disk space warning when
+// the scan deferred files for lack of space and by a warning about the
+// series paths Sonarr could not reach.
+func (d *Dispatcher) ScanFinished(r *importer.ScanResult) {
+	if len(r.DiskSpace) > 0 {
+		d.Send(Event{Type: EventDiskSpace, Scan: r})
+	}
+	if len(r.UnavailablePaths) > 0 {
+		d.Send(Event{Type: EventPathUnavailable, Scan: r})
+	}
+	d.Send(Event{Type: EventScanFinished, Scan: r})
+}
+
+// deliver sends e to t, retrying with an increasing delay.
+func (d *Dispatcher) deliver(t *target, e Event) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := t.notifier.Notify(ctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= t.retries {
+			if t.failed == 0 {
+				d.log.Warnf("Failed to send %s notification to %s: %v", e.Type, t.notifier.Name(), err)
+			}
+			t.failed++
+			t.lastErr = err
+			return
+		}
+		d.log.Debugf("Notification to %s failed (%v), retrying in %v", t.notifier.Name(), err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// reportFailures logs the failures of t that were not logged yet.
+func (d *Dispatcher) reportFailures(t *target) {
+	if t.failed > 1 {
+		d.log.Warnf("%d more notifications to %s failed, last error: %v", t.failed-1, t.notifier.Name(), t.lastErr)
+	}
+	t.failed = 0
+	t.lastErr = nil
+}
+
+// Close delivers the queued events and stops the delivery goroutines. Targets
+// that implement io.Closer, such as email digests, are closed afterwards. It
+// gives up waiting after timeout.
+func (d *Dispatcher) Close(timeout time.Duration) {
+	for _, t := range d.targets {
+		close(t.queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		for _, t := range d.targets {
+			if c, ok := t.notifier.(io.Closer); ok {
+				if err := c.Close(); err != nil {
+					d.log.Warnf("Failed to close %s: %v", t.notifier.Name(), err)
+				}
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		d.log.Warnf("Gave up waiting for pending notifications")
+	}
+}
+
+// Test sends a sample event to every target, ignoring filters and retries,
+// and returns the number of targets that failed.
+func (d *Dispatcher) Test(ctx context.Context) (failed int) {
+	e := SampleEvent()
+	for _, t := range d.targets {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := t.notifier.Notify(sendCtx, e)
+		cancel()
+		if err != nil {
+			d.log.Errorf("%s: %v", t.notifier.Name(), err)
+			failed++
+			continue
+		}
+		d.log.Infof("%s: ok", t.notifier.Name())
+	}
+	return failed
+}
+
+// Accepts reports whether filter lets events of type t through.
+func Accepts(filter config.EventFilter, t EventType) bool {
+	if len(filter.Events) == 0 || t == EventTest {
+		return true
+	}
+	for _, pattern := range filter.Events {
+		if ok, _ := path.Match(pattern, string(t)); ok {
+			return true
+		}
+	}
+	return false
+}
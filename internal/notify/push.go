@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// ntfyPriorities are the default ntfy priorities (1 min to 5 max).
+var ntfyPriorities = map[string]int{
+	LevelFailure: 4,
+	LevelSuccess: 2,
+	LevelInfo:    3,
+}
+
+// gotifyPriorities are the default Gotify priorities (0 to 10).
+var gotifyPriorities = map[string]int{
+	LevelFailure: 8,
+	LevelSuccess: 3,
+	LevelInfo:    5,
+}
+
+// Ntfy publishes events to an ntfy topic.
+type Ntfy struct {
+	cfg    config.NtfyConfig
+	client *http.Client
+	name   string
+}
+
+// NewNtfy returns an Ntfy for cfg.
+func NewNtfy(cfg config.NtfyConfig) (*Ntfy, error) {
+	u, err := parseTargetURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("url %q does not name a topic", cfg.URL)
+	}
+	return &Ntfy{cfg: cfg, client: &http.Client{}, name: "ntfy " + u.Host + u.Path}, nil
+}
+
+// Name implements Notifier.
+func (n *Ntfy) Name() string {
+	return n.name
+}
+
+// Notify implements Notifier.
+func (n *Ntfy) Notify(ctx context.Context, e Event) error {
+	title, body := Message(e)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Priority", strconv.Itoa(priority(e, n.cfg.Priorities, ntfyPriorities)))
+	req.Header.Set("Tags", Level(e))
+	if n.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.cfg.Token)
+	}
+	return send(n.client, req)
+}
+
+// Gotify sends events to a Gotify server.
+type Gotify struct {
+	cfg    config.GotifyConfig
+	client *http.Client
+	name   string
+}
+
+// NewGotify returns a Gotify for cfg.
+func NewGotify(cfg config.GotifyConfig) (*Gotify, error) {
+	u, err := parseTargetURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("application token is required")
+	}
+	return &Gotify{cfg: cfg, client: &http.Client{}, name: "gotify " + u.Host}, nil
+}
+
+// Name implements Notifier.
+func (g *Gotify) Name() string {
+	return g.name
+}
+
+// Notify implements Notifier.
+func (g *Gotify) Notify(ctx context.Context, e Event) error {
+	title, body := Message(e)
+	payload, err := json.Marshal(map[string]any{
+		"title":    title,
+		"message":  body,
+		"priority": priority(e, g.cfg.Priorities, gotifyPriorities),
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(g.cfg.URL, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.cfg.Token)
+	return send(g.client, req)
+}
+
+// parseTargetURL checks that raw is an absolute http(s) URL.
+func parseTargetURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", raw)
+	}
+	return u, nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"time"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/parser"
+)
+
+// SampleEvent returns the test event sent by -test-notifications. It carries
+// a made-up scan with one imported and one failed file so targets can check
+// how every field renders.
+func SampleEvent() Event {
+	now := time.Now()
+	imported := importer.FileResult{
+		Path: "/downloads/Frieren_[05]_[1080p].mkv",
+		Parsed: &parser.ParsedAnime{
+			OriginalFilename: "Frieren_[05]_[1080p].mkv",
+			FilePath:         "/downloads/Frieren_[05]_[1080p].mkv",
+			Title:            "Frieren",
+			Season:           1,
+			Episode:          5,
+			Quality:          "1080p",
+			Group:            "Unknown",
+		},
+		SeriesID:    1,
+		SeriesTitle: "Frieren: Beyond Journey's End",
+		EpisodeID:   42,
+		Action:      importer.ActionImported,
+		Duration:    1200 * time.Millisecond,
+	}
+	failed := importer.FileResult{
+		Path:     "/downloads/Unknown Show - 01.mkv",
+		Action:   importer.ActionFailed,
+		Category: importer.CategoryParse,
+		Error:    "failed to parse anime info: " + parser.ErrParseFailed.Error(),
+	}
+
+	return Event{
+		Type:      EventTest,
+		Timestamp: now,
+		File:      &imported,
+		Scan: &importer.ScanResult{
+			Folder:     "/downloads",
+			StartedAt:  now.Add(-2 * time.Second),
+			FinishedAt: now,
+			Files:      []importer.FileResult{failed, imported},
+			Total:      2,
+			Imported:   1,
+			Failed:     1,
+			Failures:   map[importer.ErrorCategory]int{importer.CategoryParse: 1},
+		},
+	}
+}
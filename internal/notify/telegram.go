@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// telegramAPI is the Bot API endpoint.
+const telegramAPI = "https://api.telegram.org"
+
+// telegramMaxLength is the most characters a Telegram message may have.
+const telegramMaxLength = 4096
+
+// telegramMarks start the messages of each level.
+var telegramMarks = map[string]string{
+	LevelFailure: "❌",
+	LevelSuccess: "✅",
+	LevelInfo:    "ℹ️",
+}
+
+// Telegram posts events to a Telegram chat through a bot: file events as a
+// single compact message and scan summaries as one digest with a line per
+// series, formatted as MarkdownV2.
+type Telegram struct {
+	cfg    config.TelegramConfig
+	silent *config.Window
+	client *http.Client
+	api    string
+	name   string
+}
+
+// NewTelegram returns a Telegram for cfg.
+func NewTelegram(cfg config.TelegramConfig) (*Telegram, error) {
+	if cfg.BotToken == "" {
+		return nil, fmt.Errorf("bot token is required")
+	}
+	if cfg.ChatID == "" {
+		return nil, fmt.Errorf("chat ID is required")
+	}
+	silent, err := config.ParseWindow(cfg.SilentHours, cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid silent hours: %w", err)
+	}
+	return &Telegram{cfg: cfg, silent: silent, client: &http.Client{}, api: telegramAPI, name: "telegram chat " + cfg.ChatID}, nil
+}
+
+// Name implements Notifier.
+func (t *Telegram) Name() string {
+	return t.name
+}
+
+// Notify implements Notifier. Messages sent within the silent hours arrive
+// without a sound.
+func (t *Telegram) Notify(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(map[string]any{
+		"chat_id":                  t.cfg.ChatID,
+		"text":                     telegramMessage(e),
+		"parse_mode":               "MarkdownV2",
+		"disable_notification":     t.silent != nil && t.silent.Contains(time.Now()),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	// The token is part of the URL, which must not end up in the log
+	endpoint := t.api + "/bot" + t.cfg.BotToken + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return errors.New("invalid bot token")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("sendMessage failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var answer struct {
+		Description string `json:"description"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if json.Unmarshal(body, &answer) != nil || answer.Description == "" {
+		answer.Description = strings.TrimSpace(string(body))
+	}
+	return fmt.Errorf("sendMessage returned status %d: %s", resp.StatusCode, answer.Description)
+}
+
+// telegramMessage renders e as MarkdownV2: the title in bold after the mark
+// of its level and the body below it. The files of a scan summary become a
+// bulleted list, cut short to fit into a single message.
+func telegramMessage(e Event) string {
+	title, body := Message(e)
+	head := telegramMarks[Level(e)] + " *" + escapeMarkdown(title) + "*"
+	summary, list, _ := strings.Cut(body, "\n\n---\n")
+
+	var b strings.Builder
+	b.WriteString(head)
+	if summary != "" {
+		b.WriteString("\n" + escapeMarkdown(summary))
+	}
+	lines := strings.Split(strings.TrimSpace(list), "\n")
+	if list == "" {
+		lines = nil
+	}
+	if len(lines) > 0 {
+		b.WriteString("\n")
+	}
+	length := utf8.RuneCountInString(b.String())
+	for i, line := range lines {
+		entry := "\n• " + escapeMarkdown(line)
+		more := fmt.Sprintf("\n… and %d more", len(lines)-i)
+		if length+utf8.RuneCountInString(entry+more) > telegramMaxLength {
+			b.WriteString(more)
+			break
+		}
+		b.WriteString(entry)
+		length += utf8.RuneCountInString(entry)
+	}
+	return b.String()
+}
+
+// escapeMarkdown escapes the characters that MarkdownV2 reserves, so s reads
+// as plain text.
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("_*[]()~`>#+-=|{}.!\\", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// Webhook sends events as JSON to an HTTP endpoint.
+type Webhook struct {
+	cfg    config.NotifyWebhookConfig
+	client *http.Client
+	name   string
+}
+
+// NewWebhook returns a Webhook for cfg.
+func NewWebhook(cfg config.NotifyWebhookConfig) (*Webhook, error) {
+	u, err := parseTargetURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	return &Webhook{
+		cfg:    cfg,
+		client: &http.Client{},
+		name:   "webhook " + u.Host,
+	}, nil
+}
+
+// Name implements Notifier.
+func (w *Webhook) Name() string {
+	return w.name
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	return send(w.client, req)
+}
+
+// send performs req and turns a non-2xx answer into an error.
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %d: %s", req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// episodeCandidate is a number an episode pattern captured, with the score
+// of how likely it is the episode.
+type episodeCandidate struct {
+	episode int
+	// start and end are the offsets of the number in the name.
+	start, end int
+	score      int
+	// why lists what changed the score, for the debug log.
+	why []string
+}
+
+// resolutions are the heights and widths that stand for a resolution rather
+// than an episode when written on their own, as in "[1080]".
+var resolutions = []int{360, 480, 540, 576, 720, 1080, 1440, 1920, 2160, 3840}
+
+var (
+	// resolutionAfter follows the number of a resolution, a bit depth or an
+	// audio layout: "720p", "1080i", "10bit", "5.1", "2ch" or the x of
+	// "1920x1080".
+	resolutionAfter = regexp.MustCompile(`^(?i)(?:[pi]\b|-?bits?\b|\.\d\b|ch\b|x\d)`)
+	// resolutionBefore precedes the second number of "1920x1080", the
+	// codec of "x264" or "H.265" and the audio of "AAC2.0".
+	resolutionBefore = regexp.MustCompile(`(?i)(?:\dx|\b[xh]\.?|\d\.|aac|ddp?|flac|opus)$`)
+	// seasonBefore precedes a number that counts seasons or parts rather
+	// than episodes.
+	seasonBefore = regexp.MustCompile(`(?i)(?:\bs|\bseason|\bpart|\bcour|\bvol\.?|\btv-?)\s*$`)
+	// hexRun matches the CRC32 of a release, "[F1A2B3C4]", and other runs of
+	// hex digits too long for an episode.
+	hexRun = regexp.MustCompile(`(?i)\b[0-9a-f]{6,}\b`)
+)
+
+// captureScore is the score the episode an anime pattern captured starts
+// with before rate adjusts it, which is that of the first episode pattern;
+// every later one starts 5 lower.
+const captureScore = 100
+
+// episodeCandidates returns every number the episode patterns capture in
+// name, scored. Earlier patterns start with a higher score, a number that
+// stands alone in brackets or after " - " gains, and one that looks like a
+// resolution, a bit depth, a CRC, a year, a season or the release group
+// loses.
+func (p *Parser) episodeCandidates(name string) []episodeCandidate {
+	hexes := hexRun.FindAllStringIndex(name, -1)
+	group := leadingGroup.FindStringIndex(name)
+	var candidates []episodeCandidate
+	for i, pattern := range p.cfg.EpisodePatterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil || regex.NumSubexp() < 1 {
+			continue
+		}
+		for _, m := range regex.FindAllStringSubmatchIndex(name, -1) {
+			if m[2] < 0 {
+				continue
+			}
+			episode, err := strconv.Atoi(name[m[2]:m[3]])
+			if err != nil || episode == 0 {
+				continue
+			}
+			if slices.ContainsFunc(candidates, func(c episodeCandidate) bool { return c.start == m[2] && c.end == m[3] }) {
+				// A later pattern found the same number again
+				continue
+			}
+			c := episodeCandidate{episode: episode, start: m[2], end: m[3], score: captureScore - 5*i}
+			c.rate(name, hexes, group)
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// checkCapture returns why the episode an anime pattern captured from start
+// to end in name is not the episode, or "" when it may be. One that looks
+// like a resolution, a CRC, a season or the release group is not when one of
+// the episode patterns captures a more plausible number; a capture that
+// looks like nothing else always wins, so "S01E05" is not second-guessed.
+func (p *Parser) checkCapture(name string, start, end int) string {
+	episode, _ := strconv.Atoi(name[start:end])
+	c := episodeCandidate{episode: episode, start: start, end: end, score: captureScore}
+	c.rate(name, hexRun.FindAllStringIndex(name, -1), leadingGroup.FindStringIndex(name))
+	if c.score >= captureScore {
+		return ""
+	}
+	best, ok := bestCandidate(p.episodeCandidates(name))
+	if !ok || best.score <= c.score || best.start == start {
+		return ""
+	}
+	return fmt.Sprintf("episode %d %v is less plausible than %d", episode, c.why, best.episode)
+}
+
+// rate adjusts the score of c by the text around it in name. hexes are the
+// hex runs of name and group the offsets of its leading release group, if
+// any.
+func (c *episodeCandidate) rate(name string, hexes [][]int, group []int) {
+	before, after := name[:c.start], name[c.end:]
+	number := name[c.start:c.end]
+	adjust := func(points int, why string) {
+		c.score += points
+		c.why = append(c.why, why)
+	}
+
+	if alone(before, after) {
+		adjust(10, "stands alone")
+	}
+	end := tail(before)
+	switch {
+	case resolutionAfter.MatchString(after) || resolutionBefore.MatchString(end):
+		adjust(-60, "resolution, bit depth or audio")
+	case len(number) >= 3 && slices.Contains(resolutions, c.episode):
+		adjust(-40, "resolution value")
+	}
+	if overlaps(hexes, c.start, c.end) {
+		adjust(-80, "hex run")
+	}
+	if yearLike.MatchString(number) {
+		adjust(-40, "year")
+	}
+	if seasonBefore.MatchString(end) {
+		adjust(-30, "season or part")
+	}
+	if group != nil && c.start < group[1] {
+		adjust(-50, "release group")
+	}
+}
+
+// tailContext is how many bytes tail keeps before the trailing spaces,
+// more than the longest word resolutionBefore and seasonBefore look for.
+const tailContext = 16
+
+// tail returns the end of before that resolutionBefore and seasonBefore are
+// matched against: its trailing spaces and the tailContext bytes before
+// them. Matching the whole of it would take time for the text up to every
+// candidate, which adds up for names with many numbers.
+func tail(before string) string {
+	trimmed := strings.TrimRightFunc(before, unicode.IsSpace)
+	return before[max(len(trimmed)-tailContext, 0):]
+}
+
+// alone reports whether the number between before and after stands on its
+// own in brackets, as in "[05]" or "(05v2)", or after a " - ".
+func alone(before, after string) bool {
+	after = strings.TrimLeft(after[len(version.FindString(after)):], " ")
+	switch {
+	case strings.HasSuffix(before, "[") && strings.HasPrefix(after, "]"),
+		strings.HasSuffix(before, "(") && strings.HasPrefix(after, ")"):
+		return true
+	}
+	return strings.HasSuffix(strings.TrimRight(before, " "), " -")
+}
+
+// bestCandidate returns the candidate with the highest score, the last in
+// name of those with the same score, or false when there is none. A title
+// ends in a number, as "Mob Psycho 100" does, more often than the text after
+// the episode starts with one.
+func bestCandidate(candidates []episodeCandidate) (episodeCandidate, bool) {
+	if len(candidates) == 0 {
+		return episodeCandidate{}, false
+	}
+	best := slices.MinFunc(candidates, func(a, b episodeCandidate) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return b.start - a.start
+	})
+	return best, true
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// episodePatterns are the episode patterns of the default configuration.
+var episodePatterns = []string{
+	`\[(\d+)(?:v\d+)?\]`,
+	`#(\d+)[^#]*$`,
+	`E(\d+)`,
+	`Episode\s+(\d+)`,
+	`Ep\s*(\d+)`,
+}
+
+func TestEpisodeCandidates(t *testing.T) {
+	p := New(Config{EpisodePatterns: episodePatterns}, nil)
+	type scored struct {
+		number string
+		score  int
+	}
+	tests := []struct {
+		name string
+		want []scored
+	}{
+		{"[Group] Show [720p] [05] [F1A2B3C4]", []scored{{"05", 110}}},
+		{"[Group] Show [1080] [05]", []scored{{"1080", 70}, {"05", 110}}},
+		{"[Group] Show [2024] [06]", []scored{{"2024", 70}, {"06", 110}}},
+		{"[Group] Show [12345678] [07]", []scored{{"12345678", 30}, {"07", 110}}},
+		{"[12] Show [08]", []scored{{"12", 60}, {"08", 110}}},
+		{"Show #05 [1080p]", []scored{{"05", 95}}},
+		{"Show E05 Episode 05", []scored{{"05", 90}, {"05", 85}}},
+		{"Show [05v2]", []scored{{"05", 110}}},
+		{"Show [0] [00]", nil},
+		{"Show", nil},
+	}
+	for _, tt := range tests {
+		var got []scored
+		for _, c := range p.episodeCandidates(tt.name) {
+			got = append(got, scored{tt.name[c.start:c.end], c.score})
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("episodeCandidates(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name, number string
+		score        int
+		why          []string
+	}{
+		{"Show - 05", "05", 110, []string{"stands alone"}},
+		{"Show (05v2)", "05", 110, []string{"stands alone"}},
+		{"Show 05", "05", 100, nil},
+		{"Show 720p", "720", 40, []string{"resolution, bit depth or audio"}},
+		{"Show 1920x1080", "1920", 0, []string{"resolution, bit depth or audio", "year"}},
+		{"Show 1920x1080", "1080", 40, []string{"resolution, bit depth or audio"}},
+		{"Show 10bit", "10", 40, []string{"resolution, bit depth or audio"}},
+		{"Show H.265", "265", 40, []string{"resolution, bit depth or audio"}},
+		{"Show AAC2.0", "2", 40, []string{"resolution, bit depth or audio"}},
+		{"Show [1080]", "1080", 70, []string{"stands alone", "resolution value"}},
+		{"Show [12345678]", "12345678", 30, []string{"stands alone", "hex run"}},
+		{"Show (2024)", "2024", 70, []string{"stands alone", "year"}},
+		{"Show Season 2", "2", 70, []string{"season or part"}},
+		{"Show Cour 2", "2", 70, []string{"season or part"}},
+		{"[86] Show", "86", 60, []string{"stands alone", "release group"}},
+	}
+	for _, tt := range tests {
+		start := strings.LastIndex(tt.name, tt.number)
+		episode, _ := strconv.Atoi(tt.number)
+		c := episodeCandidate{episode: episode, start: start, end: start + len(tt.number), score: captureScore}
+		c.rate(tt.name, hexRun.FindAllStringIndex(tt.name, -1), leadingGroup.FindStringIndex(tt.name))
+		if c.score != tt.score || !slices.Equal(c.why, tt.why) {
+			t.Errorf("rating %q in %q = %d %q, want %d %q", tt.number, tt.name, c.score, c.why, tt.score, tt.why)
+		}
+	}
+}
+
+func TestBestCandidate(t *testing.T) {
+	if _, ok := bestCandidate(nil); ok {
+		t.Error("bestCandidate(nil) found a candidate")
+	}
+	candidates := []episodeCandidate{
+		{episode: 100, start: 11, score: 100},
+		{episode: 5, start: 15, score: 100},
+		{episode: 720, start: 20, score: 40},
+	}
+	if best, _ := bestCandidate(candidates); best.episode != 5 {
+		t.Errorf("bestCandidate = episode %d, want the later of the tied candidates, 5", best.episode)
+	}
+	candidates[0].score = 110
+	if best, _ := bestCandidate(candidates); best.episode != 100 {
+		t.Errorf("bestCandidate = episode %d, want the highest score, 100", best.episode)
+	}
+}
+
+func TestCheckCapture(t *testing.T) {
+	p := New(Config{EpisodePatterns: episodePatterns}, nil)
+	tests := []struct {
+		name, number string
+		passed       bool
+	}{
+		{"Show S01E05 [12]", "05", false},
+		{"Show - 05 [1080p]", "05", false},
+		{"[Group] Show [1080] [05]", "1080", true},
+		{"[Group] Show [1080]", "1080", false},
+	}
+	for _, tt := range tests {
+		start := strings.Index(tt.name, tt.number)
+		reason := p.checkCapture(tt.name, start, start+len(tt.number))
+		if (reason != "") != tt.passed {
+			t.Errorf("checkCapture(%q, %q) = %q, want passed over: %t", tt.name, tt.number, reason, tt.passed)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// matchName returns name as the patterns and transforms see it: valid UTF-8,
+// read as Latin-1 when it is not, with control characters and line
+// separators as spaces. It fails with ErrInvalidEncoding when name is not
+// UTF-8 and not Latin-1 either.
+func matchName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		latin1, ok := fromLatin1(name)
+		if !ok {
+			return "", fmt.Errorf("%w and not Latin-1 either: %s", ErrInvalidEncoding, logging.Escape(name))
+		}
+		name = latin1
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp) {
+			return ' '
+		}
+		return r
+	}, name), nil
+}
+
+// fromLatin1 decodes name as Latin-1, the encoding of names from older
+// Windows and Samba shares, such as "Pok\xe9mon". It reports false for
+// names that hold valid multi-byte UTF-8 as well, which mix encodings, and
+// for those with bytes that are control codes in Latin-1, which are more
+// likely Shift JIS or another multi-byte encoding.
+func fromLatin1(name string) (string, bool) {
+	var b strings.Builder
+	b.Grow(len(name) * 2)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= utf8.RuneSelf {
+			if _, size := utf8.DecodeRuneInString(name[i:]); size > 1 || c < 0xa0 {
+				return "", false
+			}
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String(), true
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxEpisodeSpan is the number of episodes a range may span when
+// Config.MaxEpisodeSpan is 0.
+const DefaultMaxEpisodeSpan = 3
+
+// episodeRange matches a run of episode numbers such as "01-03", "E01-E03",
+// "S01E01E02E03" or "Ep 01 ~ 02". The first number may not follow a letter
+// or a digit and the last one may only be followed by a version such as
+// "v2", so resolutions, bit depths and the lower digits of years are not
+// read as part of a range.
+var episodeRange = regexp.MustCompile(`(?i)(?:^|[^0-9a-z])(?:s\d{1,2}e|ep?\s*)?(\d{1,4})((?:\s*[-~]\s*(?:ep?\s*)?\d{1,4}|e\d{1,4})+)(?:v\d|[^0-9a-z]|$)`)
+
+// dateLike matches the dates some releases carry, "2024-07" and "2024.07.04",
+// whose parts must not be read as an episode range.
+var dateLike = regexp.MustCompile(`(?:19|20)\d{2}[-.](?:0[1-9]|1[0-2])(?:[-.](?:0[1-9]|[12]\d|3[01]))?`)
+
+// yearLike matches a number that is most likely a year.
+var yearLike = regexp.MustCompile(`^(?:19|20)\d{2}$`)
+
+var digits = regexp.MustCompile(`\d+`)
+
+// dateCapture returns why the episode an anime pattern captured from start to
+// end in name is not an episode, or "": the year or another part of a date,
+// as in "Show - 2024-07-03", or a number that looks like a year on its own.
+func dateCapture(name string, start, end int) string {
+	switch {
+	case overlaps(dateLike.FindAllStringIndex(name, -1), start, end):
+		return "the episode is part of a date"
+	case yearLike.MatchString(name[start:end]):
+		return "the episode looks like a year"
+	}
+	return ""
+}
+
+// Episodes returns the episode numbers of the file, from Episode to
+// EndEpisode.
+func (a *ParsedAnime) Episodes() []int {
+	if a.EndEpisode <= a.Episode {
+		return []int{a.Episode}
+	}
+	episodes := make([]int, 0, a.EndEpisode-a.Episode+1)
+	for e := a.Episode; e <= a.EndEpisode; e++ {
+		episodes = append(episodes, e)
+	}
+	return episodes
+}
+
+// Label formats the season and episodes of the file as "S01E05" or, for a
+// range, "S01E05-E07".
+func (a *ParsedAnime) Label() string {
+	if a.EndEpisode > a.Episode {
+		return fmt.Sprintf("S%02dE%02d-E%02d", a.Season, a.Episode, a.EndEpisode)
+	}
+	return fmt.Sprintf("S%02dE%02d", a.Season, a.Episode)
+}
+
+// maxEpisodeSpan returns the configured maximum span of an episode range.
+func (p *Parser) maxEpisodeSpan() int {
+	if p.cfg.MaxEpisodeSpan > 0 {
+		return p.cfg.MaxEpisodeSpan
+	}
+	return DefaultMaxEpisodeSpan
+}
+
+// matchRange sets anime.EndEpisode from the episode range of name that
+// starts at anime.Episode. The numbers of a range must increase, and a run
+// of more than two must be contiguous, so "01-03" and "E01E02E03" are ranges
+// but "03-01" and "01-02-04" are not; neither is a run inside a date. A
+// range spanning more than the maximum span is not guessed at: matchRange
+// returns an ErrPossibleBatch error for it instead. end is the offset in name
+// right after the range, or 0 without one.
+func (p *Parser) matchRange(name string, anime *ParsedAnime) (end int, err error) {
+	dates := dateLike.FindAllStringIndex(name, -1)
+	for _, m := range episodeRange.FindAllStringSubmatchIndex(name, -1) {
+		start, _ := strconv.Atoi(name[m[2]:m[3]])
+		if start != anime.Episode || overlaps(dates, m[2], m[5]) {
+			continue
+		}
+		numbers := []int{start}
+		for _, n := range digits.FindAllString(name[m[4]:m[5]], -1) {
+			number, _ := strconv.Atoi(n)
+			numbers = append(numbers, number)
+		}
+		if !validRange(numbers) {
+			p.log.Debugf("Not an episode range: %s", strings.TrimSpace(name[m[2]:m[5]]))
+			continue
+		}
+
+		last := numbers[len(numbers)-1]
+		if span := last - start + 1; span > p.maxEpisodeSpan() {
+			return 0, fmt.Errorf("%w: episodes %d to %d span %d episodes, more than parsing.maxEpisodeSpan (%d)",
+				ErrPossibleBatch, start, last, span, p.maxEpisodeSpan())
+		}
+		anime.EndEpisode = last
+		p.log.Debugf("Episode range matched: %s -> Episodes: %d-%d", strings.TrimSpace(name[m[2]:m[5]]), start, last)
+		return m[5], nil
+	}
+	return 0, nil
+}
+
+// validRange reports whether numbers, the episodes of a run, form a range.
+func validRange(numbers []int) bool {
+	for i := 1; i < len(numbers); i++ {
+		if numbers[i] <= numbers[i-1] || len(numbers) > 2 && numbers[i] != numbers[i-1]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether the text from start to end overlaps one of
+// spans, such as the dates of a name.
+func overlaps(spans [][]int, start, end int) bool {
+	for _, d := range spans {
+		if start < d[1] && d[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// finalMarker matches the markers releases put after the last episode of a
+// season, standing on their own or in brackets and followed by nothing but
+// brackets or a separated title, so "Final Battle" is an episode title
+// rather than a marker.
+var finalMarker = regexp.MustCompile(`(?i)^[\s\-_~]*[\[(]?(?:end|fin|final)[\])]?(?:\s*$|\s*[\[(]|\s+-)`)
+
+// version matches the version of a re-released episode, as in "05v2".
+var version = regexp.MustCompile(`^(?i)v\d+\b`)
+
+// bracketed matches the bracketed and parenthesised parts of a name, which
+// hold release information rather than episode titles.
+var bracketed = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\{[^}]*\}`)
+
+// episodeTitle returns the episode title in text, the part of a name after
+// the episode, and whether text marks the episode as the last one. Brackets,
+// including the one closing around the episode as in "[03]", a version such
+// as "v2", separators and quotes around the title are dropped, and text
+// without any letter is no title.
+func episodeTitle(text string) (title string, final bool) {
+	text = strings.TrimLeft(text, " ])}")
+	text = strings.TrimLeft(text[len(version.FindString(text)):], " ])}")
+	if m := finalMarker.FindString(text); m != "" {
+		final = true
+		text = text[len(strings.TrimRight(m, "[(")):]
+	}
+	text = bracketed.ReplaceAllString(text, " ")
+	title = strings.Join(strings.Fields(text), " ")
+	title = strings.Trim(title, " -_~:'\"‘’“”")
+	if !strings.ContainsFunc(title, unicode.IsLetter) {
+		return "", final
+	}
+	return title, final
+}
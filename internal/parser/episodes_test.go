@@ -0,0 +1,154 @@
+package parser_test
+
+import (
+	"errors"
+	"testing"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+func TestParseEpisodeRange(t *testing.T) {
+	p := newDefaultParser(t)
+	tests := []struct {
+		name       string
+		season     int
+		episode    int
+		endEpisode int
+	}{
+		{"[ASW] Show - 01-03 [1080p].mkv", 1, 1, 3},
+		{"[ASW] Show - 01 ~ 03 [1080p].mkv", 1, 1, 3},
+		{"[ASW] Show - 05-06v2 [1080p].mkv", 1, 5, 6},
+		{"[SubsPlease] Show - 11-12 (1080p) [F02B9CEE].mkv", 1, 11, 12},
+		{"Show S01E01-E03.mkv", 1, 1, 3},
+		{"Show S02E01E02E03 [1080p].mkv", 2, 1, 3},
+
+		// Reversed and non-contiguous runs are not ranges
+		{"[ASW] Show - 03-01 [1080p].mkv", 1, 3, 0},
+		{"Show S01E01E02E04.mkv", 1, 1, 0},
+
+		// Nor are the parts of a date, or a bit depth
+		{"[ASW] Show - 04 [2024-04-07] [1080p].mkv", 1, 4, 0},
+		{"[ASW] Show - 07 (2024.07.08) [1080p].mkv", 1, 7, 0},
+		{"[ASW] Show 2024-07 - 05 [1080p].mkv", 1, 5, 0},
+		{"[ASW] Show - 10-bit [1080p] - 10.mkv", 1, 10, 0},
+	}
+	for _, tt := range tests {
+		anime, err := p.Parse(tt.name)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.name, err)
+			continue
+		}
+		if anime.Season != tt.season || anime.Episode != tt.episode || anime.EndEpisode != tt.endEpisode {
+			t.Errorf("Parse(%q) = season %d, episodes %d-%d; want season %d, episodes %d-%d",
+				tt.name, anime.Season, anime.Episode, anime.EndEpisode, tt.season, tt.episode, tt.endEpisode)
+		}
+	}
+}
+
+// TestParseDateNames parses names with a date or a year where the episode
+// would be, which no pattern may read as one.
+func TestParseDateNames(t *testing.T) {
+	p := newDefaultParser(t)
+	for _, name := range []string{
+		"Show - 2024-07-03.mkv",
+		"Show - 2024.07.03.mkv",
+		"Show - 2024-07 [1080p].mkv",
+		"Show - 2024 [1080p].mkv",
+	} {
+		if anime, err := p.Parse(name); !errors.Is(err, parser.ErrParseFailed) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrParseFailed", name, anime, err)
+		}
+	}
+
+	// A date next to the episode leaves it alone
+	anime, err := p.Parse("Show - 05 - 2024-07-03.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anime.Episode != 5 || anime.EndEpisode != 0 {
+		t.Errorf("episodes %d-%d next to a date, want 5", anime.Episode, anime.EndEpisode)
+	}
+}
+
+func TestParseEpisodeRangeSpan(t *testing.T) {
+	p := newDefaultParser(t)
+	for _, name := range []string{
+		"[ASW] Show - 01-04 [1080p].mkv",
+		"[ASW] Show - 01 ~ 12 [1080p].mkv",
+		"Show S01E01-E12.mkv",
+	} {
+		if anime, err := p.Parse(name); !errors.Is(err, parser.ErrPossibleBatch) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrPossibleBatch", name, anime, err)
+		}
+	}
+
+	cfg := defaultConfig(t)
+	cfg.MaxEpisodeSpan = 12
+	anime, err := parser.New(cfg, nil).Parse("[ASW] Show - 01 ~ 12 [1080p].mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anime.Episode != 1 || anime.EndEpisode != 12 {
+		t.Errorf("episodes %d-%d with a span of 12, want 1-12", anime.Episode, anime.EndEpisode)
+	}
+	if len(anime.Episodes()) != 12 || anime.Label() != "S01E01-E12" {
+		t.Errorf("Episodes() = %v, Label() = %q", anime.Episodes(), anime.Label())
+	}
+	if _, err := parser.New(cfg, nil).Parse("[ASW] Show - 01-13 [1080p].mkv"); !errors.Is(err, parser.ErrPossibleBatch) {
+		t.Errorf("a range of 13 with a span of 12: %v, want ErrPossibleBatch", err)
+	}
+}
+
+func TestParseTrailingText(t *testing.T) {
+	p := newDefaultParser(t)
+	tests := []struct {
+		name         string
+		title        string
+		episode      int
+		episodeTitle string
+		final        bool
+		quality      string
+	}{
+		// Markers of the last episode
+		{"[SubsPlease] Show - 12 END (1080p) [F02B9CEE].mkv", "Show", 12, "", true, "1080p"},
+		{"[ASW] Show - 12 FIN [1080p].mkv", "Show", 12, "", true, "1080p"},
+		{"[ASW] Show - 12 FINAL [1080p].mkv", "Show", 12, "", true, "1080p"},
+		{"[ASW] Show - 12 (Final) [1080p].mkv", "Show", 12, "", true, "1080p"},
+		{"[ASW] Show - 12 [END] [1080p].mkv", "Show", 12, "", true, "1080p"},
+		{"Show - 12 END.mkv", "Show", 12, "", true, "Unknown"},
+		{"[Erai-raws] Show - 12 END [1080p][Multiple Subtitle].mkv", "Show", 12, "", true, "1080p"},
+		{"Show - 12 END - Farewell.mkv", "Show", 12, "Farewell", true, "Unknown"},
+
+		// Episode titles, quoted or not
+		{"Show - 05 'The Promise'.mkv", "Show", 5, "The Promise", false, "Unknown"},
+		{`Show - 05 "The Promise" [1080p].mkv`, "Show", 5, "The Promise", false, "1080p"},
+		{"Show - 05 ‘The Promise’.mkv", "Show", 5, "The Promise", false, "Unknown"},
+		{"[ASW] Show - 05 - The Promise [1080p].mkv", "Show", 5, "The Promise", false, "1080p"},
+		{"Show - 05v2 The Promise.mkv", "Show", 5, "The Promise", false, "Unknown"},
+		{"Show S01E05 The Promise [720p].mkv", "Show", 5, "The Promise", false, "720p"},
+		{"Show - 12 Final Battle.mkv", "Show", 12, "Final Battle", false, "Unknown"},
+		{"Show - 12 Endgame.mkv", "Show", 12, "Endgame", false, "Unknown"},
+
+		// Any other text after the episode
+		{"[ASW] Show - 05 some random text 1080p.mkv", "Show", 5, "some random text 1080p", false, "1080p"},
+		{"Show Name_[03]_Some_trailing_text.mkv", "Show Name", 3, "Some trailing text", false, "Unknown"},
+		{"[ASW] Show - 05 [1080p] 12345.mkv", "Show", 5, "", false, "1080p"},
+		{"Show - 05 - 2.mkv", "Show", 5, "", false, "Unknown"},
+	}
+	for _, tt := range tests {
+		anime, err := p.Parse(tt.name)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.name, err)
+			continue
+		}
+		if anime.Title != tt.title || anime.Episode != tt.episode {
+			t.Errorf("Parse(%q) = %q episode %d, want %q episode %d", tt.name, anime.Title, anime.Episode, tt.title, tt.episode)
+		}
+		if anime.EpisodeTitle != tt.episodeTitle || anime.Final != tt.final {
+			t.Errorf("Parse(%q) = episode title %q, final %t; want %q, %t", tt.name, anime.EpisodeTitle, anime.Final, tt.episodeTitle, tt.final)
+		}
+		if anime.Quality != tt.quality {
+			t.Errorf("Parse(%q) = quality %q, want %q", tt.name, anime.Quality, tt.quality)
+		}
+	}
+}
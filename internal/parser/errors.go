@@ -0,0 +1,17 @@
+package parser
+
+import "errors"
+
+// ErrParseFailed is returned when no title or episode could be extracted from
+// a filename.
+var ErrParseFailed = errors.New("could not parse title or episode from filename")
+
+// ErrPossibleBatch is returned when a filename holds an episode range wider
+// than Config.MaxEpisodeSpan, which is more likely a batch of a whole season
+// than a single multi-episode file.
+var ErrPossibleBatch = errors.New("possible batch file")
+
+// ErrInvalidEncoding is returned for a filename that is not valid UTF-8 and
+// cannot be read as Latin-1 either, as a name in Shift JIS or one that mixes
+// encodings, so the patterns cannot be matched against it.
+var ErrInvalidEncoding = errors.New("filename is not valid UTF-8")
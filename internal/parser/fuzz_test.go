@@ -0,0 +1,71 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+// FuzzParse parses arbitrary bytes as filenames with the default patterns.
+// Parsing must not panic, must fail with one of the errors of the parser or
+// return valid UTF-8 without control characters, and must keep the name as
+// it was in OriginalFilename.
+func FuzzParse(f *testing.F) {
+	for _, name := range []string{
+		"[SubsPlease] Frieren - 05 (1080p) [F02B9CEE].mkv",
+		"[Erai-raws] Dandadan 2nd Season - 03 [1080p][Multiple Subtitle][ENG].mkv",
+		"Shangri-La_Frontier_2nd_Season_[09]_[AniLibria].mkv",
+		"Show S01E01E02E03 [1080p].mkv",
+		"[ASW] Show - 01 ~ 03 [1080p].mkv",
+		"Show - 12 END - Farewell.mkv",
+		"Show Name #05 [2024].mkv",
+		"Pok\xe9mon - 05.mkv",
+		"\x82\xa0\x82\xa2 - 01.mkv",
+		"Show\n - 05\x1b[31m.mkv",
+		"Show  - 05.mkv",
+		"ＦＲＩＥＲＥＮ － ０５.mkv",
+		"葬送のフリーレン - 05.mkv",
+		"",
+		"[",
+		"- 0",
+	} {
+		f.Add(name)
+	}
+	p := parser.New(defaultConfig(f), nil)
+
+	f.Fuzz(func(t *testing.T, name string) {
+		anime, err := p.Parse(name)
+		if err != nil {
+			if !errors.Is(err, parser.ErrParseFailed) && !errors.Is(err, parser.ErrPossibleBatch) && !errors.Is(err, parser.ErrInvalidEncoding) {
+				t.Fatalf("Parse(%q) failed with an unexpected error: %v", name, err)
+			}
+			if !utf8.ValidString(err.Error()) {
+				t.Fatalf("Parse(%q): the error is not valid UTF-8: %q", name, err)
+			}
+			return
+		}
+		if anime.OriginalFilename != name {
+			t.Fatalf("Parse(%q) changed OriginalFilename to %q", name, anime.OriginalFilename)
+		}
+		if anime.Episode <= 0 || anime.EndEpisode != 0 && anime.EndEpisode <= anime.Episode {
+			t.Fatalf("Parse(%q) = episodes %d-%d", name, anime.Episode, anime.EndEpisode)
+		}
+		for field, value := range map[string]string{
+			"Title":        anime.Title,
+			"EpisodeTitle": anime.EpisodeTitle,
+			"Group":        anime.Group,
+			"Quality":      anime.Quality,
+		} {
+			if !utf8.ValidString(value) || strings.ContainsFunc(value, unicode.IsControl) {
+				t.Fatalf("Parse(%q) = %s %q, want valid UTF-8 without control characters", name, field, value)
+			}
+		}
+		if strings.TrimSpace(anime.Title) == "" {
+			t.Fatalf("Parse(%q) succeeded without a title", name)
+		}
+	})
+}
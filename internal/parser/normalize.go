@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// foldedRunes are the accented letters of Latin scripts and their base
+// letters, which covers the macrons of romaji such as "ō" in "Shōnen".
+var foldedRunes = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// NormalizeTitle returns the form of title that titles are compared in:
+// lower case, with the diacritics of Latin letters and the full-width forms
+// of ASCII folded, apostrophes dropped, every other run of punctuation and
+// white space turned into a single space, and "&" spelled "and". "Frieren:
+// Beyond Journey's End" and "Frieren Beyond Journeys End" both become
+// "frieren beyond journeys end".
+func NormalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case '！' <= r && r <= '～':
+			r -= '！' - '!'
+		case r == '\u3000':
+			r = ' '
+		}
+		if folded, ok := foldedRunes[r]; ok {
+			b.WriteString(folded)
+			space = false
+			continue
+		}
+		switch {
+		case r == '\'' || r == '’' || r == '‘' || r == '`' || r == '´':
+			continue
+		case r == '&':
+			if b.Len() > 0 && !space {
+				b.WriteByte(' ')
+			}
+			b.WriteString("and ")
+			space = true
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			b.WriteRune(r)
+			space = false
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks of decomposed letters
+		case b.Len() > 0 && !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+// lookupPunctuation is the punctuation LookupTerm strips from the end of
+// words.
+const lookupPunctuation = "!?.,:;~*"
+
+// LookupTerm returns title as a term for the series lookup of Sonarr, whose
+// search trips over some punctuation: slashes become spaces and punctuation
+// at the end of words is dropped, while the letters, their case and inner
+// hyphens and apostrophes stay. "Fate/Grand Order" becomes "Fate Grand
+// Order", "Dr. STONE" "Dr STONE" and "K-On!" "K-On".
+func LookupTerm(title string) string {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return r == '/' || r == '\\' || unicode.IsSpace(r)
+	})
+	term := words[:0]
+	for _, word := range words {
+		if word = strings.TrimRight(word, lookupPunctuation); word != "" {
+			term = append(term, word)
+		}
+	}
+	return strings.Join(term, " ")
+}
@@ -0,0 +1,82 @@
+package parser
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Frieren", "frieren"},
+		{"Frieren: Beyond Journey's End", "frieren beyond journeys end"},
+		{"Frieren Beyond Journeys End", "frieren beyond journeys end"},
+		{"Frieren: Beyond Journey’s End", "frieren beyond journeys end"},
+		{"Sousou no Frieren", "sousou no frieren"},
+		{"Re:Zero kara Hajimeru Isekai Seikatsu", "re zero kara hajimeru isekai seikatsu"},
+		{"Re:ZERO -Starting Life in Another World-", "re zero starting life in another world"},
+		{"Re: Zero", "re zero"},
+		{"K-On!", "k on"},
+		{"K-ON!!", "k on"},
+		{"Kaguya-sama wa Kokurasetai: Tensai-tachi no Renai Zunousen", "kaguya sama wa kokurasetai tensai tachi no renai zunousen"},
+		{"Mob Psycho 100", "mob psycho 100"},
+		{"Kaiju No. 8", "kaiju no 8"},
+		{"Fate/Grand Order", "fate grand order"},
+		{"Dr. STONE", "dr stone"},
+		{"Spy x Family", "spy x family"},
+		{"Jujutsu Kaisen (2020)", "jujutsu kaisen 2020"},
+		{"Kimi ni Todoke  ", "kimi ni todoke"},
+		{"  ...Frieren...", "frieren"},
+		{"Black & White", "black and white"},
+		{"Black&White", "black and white"},
+
+		// Diacritics, precomposed or decomposed
+		{"Shōnen", "shonen"},
+		{"Shōwa Genroku Rakugo Shinjū", "showa genroku rakugo shinju"},
+		{"Pokémon", "pokemon"},
+		{"Poke\u0301mon", "pokemon"},
+		{"Ōkami-san", "okami san"},
+		{"Śāntih", "santih"},
+		{"Straße", "strasse"},
+
+		// Full-width forms of ASCII
+		{"ＦＲＩＥＲＥＮ", "frieren"},
+		{"Ｒｅ：Ｚｅｒｏ", "re zero"},
+		{"Ｋ－Ｏｎ！", "k on"},
+		{"Ｍｏｂ　Ｐｓｙｃｈｏ　１００", "mob psycho 100"},
+
+		// Other scripts stay as they are
+		{"葬送のフリーレン", "葬送のフリーレン"},
+		{"進撃の巨人 Season 2", "進撃の巨人 season 2"},
+
+		{"", ""},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title); got != tt.want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestLookupTerm(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Frieren", "Frieren"},
+		{"Fate/Grand Order", "Fate Grand Order"},
+		{"Fate/stay night: Unlimited Blade Works", "Fate stay night Unlimited Blade Works"},
+		{"Dr. STONE", "Dr STONE"},
+		{"K-On!", "K-On"},
+		{"Kaguya-sama: Love is War", "Kaguya-sama Love is War"},
+		{"Frieren: Beyond Journey's End", "Frieren Beyond Journey's End"},
+		{"Re:Zero", "Re:Zero"},
+		{"Is It Wrong to Pick Up Girls in a Dungeon?", "Is It Wrong to Pick Up Girls in a Dungeon"},
+		{`Shows\Frieren`, "Shows Frieren"},
+		{"  Mob   Psycho  ", "Mob Psycho"},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := LookupTerm(tt.title); got != tt.want {
+			t.Errorf("LookupTerm(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,568 @@
+// Package parser extracts series, season and episode information from anime
+// release filenames.
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// Config holds the patterns and transforms used to parse filenames.
+type Config struct {
+	AnimePatterns   []AnimePattern
+	MoviePatterns   []MoviePattern
+	SeasonPatterns  []string
+	EpisodePatterns []string
+	QualityPatterns []string
+	GroupPatterns   []string
+	// Groups holds the extra anime patterns of the release groups with a
+	// profile, keyed by group name and tried before AnimePatterns.
+	Groups     map[string][]AnimePattern
+	Transforms []Transform
+	// MaxEpisodeSpan is the number of episodes a range such as "01-03" may
+	// span, DefaultMaxEpisodeSpan when 0. Wider ranges fail with
+	// ErrPossibleBatch.
+	MaxEpisodeSpan int
+	// RequireFullMatch holds every anime pattern without a Require of its
+	// own to FullMatch, so a match without an episode or with an unlikely
+	// title falls through to the next pattern.
+	RequireFullMatch bool
+}
+
+// DefaultMaxTitleLength is the longest title, in characters, that FullMatch
+// accepts. Longer ones are most likely a whole filename a loose pattern
+// swallowed.
+const DefaultMaxTitleLength = 100
+
+// FullMatch is the Requirement of parsing.requireFullMatch: an episode and a
+// title of at most DefaultMaxTitleLength characters.
+var FullMatch = Requirement{Episode: true, MaxTitleLength: DefaultMaxTitleLength}
+
+// Requirement is what a match of an anime pattern must yield to be accepted.
+// A match that falls short is passed over as if the pattern did not match.
+type Requirement struct {
+	// Episode and Season require the pattern to capture them.
+	Episode bool `json:"episode,omitempty"`
+	Season  bool `json:"season,omitempty"`
+	// MinTitleLength and MaxTitleLength bound the length of the title in
+	// characters; 0 leaves it unbounded.
+	MinTitleLength int `json:"minTitleLength,omitempty"`
+	MaxTitleLength int `json:"maxTitleLength,omitempty"`
+}
+
+// check returns why a match with title that did or did not capture the
+// season and the episode falls short of r, or "" when it does not.
+func (r Requirement) check(title string, season, episode bool) string {
+	length := utf8.RuneCountInString(title)
+	switch {
+	case r.Episode && !episode:
+		return "no episode"
+	case r.Season && !season:
+		return "no season"
+	case r.MinTitleLength > 0 && length < r.MinTitleLength:
+		return fmt.Sprintf("title of %d characters is shorter than %d", length, r.MinTitleLength)
+	case r.MaxTitleLength > 0 && length > r.MaxTitleLength:
+		return fmt.Sprintf("title of %d characters is longer than %d", length, r.MaxTitleLength)
+	}
+	return ""
+}
+
+// AnimePattern is a regular expression with the capture groups holding the
+// title, season and episode. A group index of 0 means the value is not captured.
+type AnimePattern struct {
+	Pattern      string `json:"pattern"`
+	TitleGroup   int    `json:"titleGroup"`
+	SeasonGroup  int    `json:"seasonGroup"`
+	EpisodeGroup int    `json:"episodeGroup"`
+	// SeriesType, when set, is the Sonarr series type of the files the
+	// pattern matches, such as "standard" for SxxEyy names and "anime" for
+	// fansub releases. Series added for them get it instead of the series
+	// type of their instance.
+	SeriesType string `json:"seriesType,omitempty"`
+	// Require, when set, is what a match must yield for the pattern to win,
+	// instead of FullMatch with Config.RequireFullMatch or nothing without.
+	Require *Requirement `json:"require,omitempty"`
+	// Comment documents the pattern in the configuration file.
+	Comment string `json:"comment,omitempty"`
+	// Name, when set, stands for the pattern in the log.
+	Name string `json:"name,omitempty"`
+	// Enabled set to false skips the pattern without removing it from the
+	// configuration file.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// Disabled reports whether the pattern is turned off.
+func (p AnimePattern) Disabled() bool {
+	return p.Enabled != nil && !*p.Enabled
+}
+
+// Label returns the name of the pattern, or the pattern itself without one.
+func (p AnimePattern) Label() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Pattern
+}
+
+// requirement returns the Requirement of pattern under cfg.
+func (cfg Config) requirement(pattern AnimePattern) Requirement {
+	switch {
+	case pattern.Require != nil:
+		return *pattern.Require
+	case cfg.RequireFullMatch:
+		return FullMatch
+	}
+	return Requirement{}
+}
+
+// MoviePattern is a regular expression recognising movie filenames, with the
+// capture groups holding the title and the year. A YearGroup of 0 means the
+// year is not captured.
+type MoviePattern struct {
+	Pattern    string `json:"pattern"`
+	TitleGroup int    `json:"titleGroup"`
+	YearGroup  int    `json:"yearGroup"`
+	// Comment documents the pattern in the configuration file.
+	Comment string `json:"comment,omitempty"`
+}
+
+// Transform is a search/replace applied to the filename before matching.
+// Replace may refer to the capture groups of Search as $1 or ${1}, and to
+// named groups as ${name}; CheckReplacement finds references that do not
+// resolve.
+type Transform struct {
+	Search  string `json:"search"`
+	Replace string `json:"replace"`
+	// Comment documents the transform in the configuration file.
+	Comment string `json:"comment,omitempty"`
+	// Name, when set, stands for the transform in the log.
+	Name string `json:"name,omitempty"`
+	// Enabled set to false skips the transform without removing it from
+	// the configuration file.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// Disabled reports whether the transform is turned off.
+func (t Transform) Disabled() bool {
+	return t.Enabled != nil && !*t.Enabled
+}
+
+// Label returns the name of the transform, or its search without one.
+func (t Transform) Label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Search
+}
+
+// ParsedAnime is the information extracted from a single filename.
+type ParsedAnime struct {
+	OriginalFilename string `json:"originalFilename"`
+	FilePath         string `json:"filePath"`
+	Title            string `json:"title"`
+	Season           int    `json:"season"`
+	// DefaultSeason is set when no pattern captured the season, so Season
+	// is the default of 1.
+	DefaultSeason bool `json:"defaultSeason,omitempty"`
+	Episode       int  `json:"episode"`
+	// EpisodeTitle is the text following the episode, such as "The Promise"
+	// in "Show - 05 'The Promise'", without brackets, quotes and markers of
+	// the last episode.
+	EpisodeTitle string `json:"episodeTitle,omitempty"`
+	// Final is set when the episode is marked as the last one, as in
+	// "Show - 12 END".
+	Final bool `json:"final,omitempty"`
+	// EndEpisode is the last episode of a file holding a range of episodes
+	// that starts at Episode, and 0 for a single episode.
+	EndEpisode int    `json:"endEpisode,omitempty"`
+	Quality    string `json:"quality"`
+	Group      string `json:"group"`
+	// Profile is the name of the group profile that applied, if any.
+	Profile string `json:"profile,omitempty"`
+	// SeriesType is the series type of the pattern that matched, if any.
+	SeriesType string `json:"seriesType,omitempty"`
+	Year       int    `json:"year,omitempty"`
+}
+
+// ParsedMovie is the information extracted from a movie filename.
+type ParsedMovie struct {
+	OriginalFilename string `json:"originalFilename"`
+	FilePath         string `json:"filePath"`
+	Title            string `json:"title"`
+	Year             int    `json:"year,omitempty"`
+	Quality          string `json:"quality"`
+	Group            string `json:"group"`
+}
+
+// Parser parses filenames according to a Config.
+type Parser struct {
+	cfg Config
+	log *logging.Logger
+}
+
+// New returns a Parser for cfg. Parsing details are logged to log at debug
+// level; log may be nil.
+func New(cfg Config, log *logging.Logger) *Parser {
+	return &Parser{cfg: cfg, log: log}
+}
+
+// Parse extracts the anime information from filename. Season defaults to 1
+// when no pattern captures it. A range of episodes starting at the parsed
+// episode sets EndEpisode. A filename that is not valid UTF-8 is read as
+// Latin-1, or fails with ErrInvalidEncoding; OriginalFilename keeps it as it
+// was.
+func (p *Parser) Parse(filename string) (*ParsedAnime, error) {
+	anime := &ParsedAnime{
+		OriginalFilename: filename,
+		Season:           1, // Default to season 1
+		DefaultSeason:    true,
+	}
+	name, err := matchName(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove file extension
+	nameWithoutExt := plainSpaces(strings.TrimSuffix(name, filepath.Ext(name)))
+
+	// Apply transforms to clean up the filename
+	cleanName := p.ApplyTransforms(nameWithoutExt)
+
+	p.log.Debugf("Cleaned filename: %s", cleanName)
+
+	// The group comes first, as its profile may bring patterns of its own
+	anime.Group = p.ReleaseGroup(name)
+	profile, patterns := p.profile(anime.Group)
+	if profile != "" {
+		anime.Profile = profile
+		p.log.Debugf("Using the profile of release group %s for %s", profile, filename)
+	}
+
+	// Try the patterns of the group, then each anime pattern
+	episodeEnd, ok := p.matchAnime(patterns, cleanName, anime)
+	if !ok {
+		episodeEnd, _ = p.matchAnime(p.cfg.AnimePatterns, cleanName, anime)
+	}
+
+	// If no pattern matched, try to extract title and episode manually
+	if anime.Title == "" {
+		anime.Title = cleanTitle(ExtractTitle(cleanName))
+		anime.Episode = p.ExtractEpisode(cleanName)
+	}
+
+	// Extract additional information
+	anime.Quality = p.ExtractQuality(name)
+
+	if anime.Title == "" || anime.Episode == 0 {
+		return nil, ErrParseFailed
+	}
+	rangeEnd, err := p.matchRange(cleanName, anime)
+	if err != nil {
+		return nil, err
+	}
+
+	// What follows the episode may name it or mark the last one
+	if end := max(episodeEnd, rangeEnd); end > 0 {
+		anime.EpisodeTitle, anime.Final = episodeTitle(cleanName[end:])
+		if anime.EpisodeTitle != "" || anime.Final {
+			p.log.Debugf("Trailing text: %q -> Episode title: %q, Final: %t", cleanName[end:], anime.EpisodeTitle, anime.Final)
+		}
+	}
+
+	return anime, nil
+}
+
+// matchAnime fills anime from the first of patterns that matches name and
+// reports whether one did. Disabled patterns are skipped. end is the offset in name right after the
+// episode, or 0 when the pattern does not capture it. A match whose episode
+// is part of a date or a year, or less plausible than another number of name
+// as checkCapture finds, is passed over like one falling short of its
+// Requirement.
+func (p *Parser) matchAnime(patterns []AnimePattern, name string, anime *ParsedAnime) (end int, ok bool) {
+	for _, pattern := range patterns {
+		if pattern.Disabled() {
+			continue
+		}
+		regex, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			p.log.Errorf("Invalid anime pattern: %s", pattern.Label())
+			continue
+		}
+
+		matches := regex.FindStringSubmatchIndex(name)
+		if len(matches) <= 2*pattern.TitleGroup {
+			continue
+		}
+		group := func(i int) string {
+			if i <= 0 || 2*i >= len(matches) || matches[2*i] < 0 {
+				return ""
+			}
+			return name[matches[2*i]:matches[2*i+1]]
+		}
+
+		title := group(pattern.TitleGroup)
+		if pattern.TitleGroup == 0 {
+			title = name[matches[0]:matches[1]]
+		}
+		title = cleanTitle(title)
+		season, seasonErr := strconv.Atoi(group(pattern.SeasonGroup))
+		episode, episodeErr := strconv.Atoi(group(pattern.EpisodeGroup))
+		reason := p.cfg.requirement(pattern).check(title, seasonErr == nil, episodeErr == nil && episode > 0)
+		if reason == "" && episodeErr == nil && episode > 0 {
+			start, end := matches[2*pattern.EpisodeGroup], matches[2*pattern.EpisodeGroup+1]
+			if reason = dateCapture(name, start, end); reason == "" {
+				reason = p.checkCapture(name, start, end)
+			}
+		}
+		if reason != "" {
+			p.log.Debugf("Pattern passed over: %s -> Title: %s, Season: %d, Episode: %d: %s",
+				pattern.Label(), title, season, episode, reason)
+			continue
+		}
+
+		anime.Title = title
+		anime.SeriesType = pattern.SeriesType
+		if seasonErr == nil {
+			anime.Season = season
+			anime.DefaultSeason = false
+		}
+		if episodeErr == nil {
+			anime.Episode = episode
+			end = matches[2*pattern.EpisodeGroup+1]
+		}
+
+		p.log.Debugf("Pattern matched: %s -> Title: %s, Season: %d, Episode: %d",
+			pattern.Label(), anime.Title, anime.Season, anime.Episode)
+		return end, true
+	}
+	return 0, false
+}
+
+// profile returns the name and the anime patterns of the profile of group,
+// matched ignoring case, or "" when it has none.
+func (p *Parser) profile(group string) (string, []AnimePattern) {
+	if patterns, ok := p.cfg.Groups[group]; ok {
+		return group, patterns
+	}
+	for name, patterns := range p.cfg.Groups {
+		if strings.EqualFold(name, group) {
+			return name, patterns
+		}
+	}
+	return "", nil
+}
+
+// ParseMovie reports whether filename is a movie according to the movie
+// patterns, which are matched against the filename after the transforms, and
+// extracts its title and year. A filename Parse fails to read as UTF-8 is no
+// movie.
+func (p *Parser) ParseMovie(filename string) (*ParsedMovie, bool) {
+	name, err := matchName(filename)
+	if err != nil {
+		return nil, false
+	}
+	cleanName := p.ApplyTransforms(strings.TrimSuffix(name, filepath.Ext(name)))
+	for _, pattern := range p.cfg.MoviePatterns {
+		regex, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			p.log.Errorf("Invalid movie pattern: %s", pattern.Pattern)
+			continue
+		}
+		matches := regex.FindStringSubmatch(cleanName)
+		if matches == nil || len(matches) <= pattern.TitleGroup || len(matches) <= pattern.YearGroup {
+			continue
+		}
+		movie := &ParsedMovie{
+			OriginalFilename: filename,
+			Title:            strings.TrimSpace(matches[pattern.TitleGroup]),
+			Quality:          p.ExtractQuality(name),
+			Group:            p.ReleaseGroup(name),
+		}
+		if pattern.YearGroup > 0 {
+			movie.Year, _ = strconv.Atoi(matches[pattern.YearGroup])
+		}
+		if movie.Title == "" {
+			continue
+		}
+		p.log.Debugf("Movie pattern matched: %s -> Title: %s, Year: %d", pattern.Pattern, movie.Title, movie.Year)
+		return movie, true
+	}
+	return nil, false
+}
+
+// ApplyTransforms runs every enabled transform over input in order.
+func (p *Parser) ApplyTransforms(input string) string {
+	steps := p.TransformSteps(input)
+	if len(steps) == 0 {
+		return input
+	}
+	return steps[len(steps)-1].Result
+}
+
+// TransformSteps runs every enabled transform over input in order and
+// returns the result of each one that changed it.
+func (p *Parser) TransformSteps(input string) []TransformStep {
+	result := input
+	var steps []TransformStep
+
+	for i, transform := range p.cfg.Transforms {
+		if transform.Disabled() {
+			continue
+		}
+		regex, err := regexp.Compile(transform.Search)
+		if err != nil {
+			p.log.Errorf("Invalid regex pattern: %s", transform.Label())
+			continue
+		}
+
+		newResult := regex.ReplaceAllString(result, transform.Replace)
+		if newResult != result {
+			if transform.Name != "" {
+				p.log.Debugf("Transform %s applied: %s -> %s", transform.Name, result, newResult)
+			} else {
+				p.log.Debugf("Transform applied: %s -> %s", result, newResult)
+			}
+			result = newResult
+			steps = append(steps, TransformStep{Index: i, Transform: transform, Result: result})
+		}
+	}
+
+	return steps
+}
+
+// ExtractTitle strips episode indicators and everything after them from
+// filename.
+func ExtractTitle(filename string) string {
+	// Remove common patterns and extract title
+	title := filename
+
+	// Remove episode indicators, the last hash first so one in the title
+	// stays
+	patterns := []string{
+		`\s*(?:[Ee][Pp]\s*)?#\d+[^#]*$`,
+		`\s*\[\d+\].*$`,
+		`\s*[Ee]p?\s*\d+.*$`,
+		`\s*[Ee]pisode\s*\d+.*$`,
+		`\s*S\d+E\d+.*$`,
+	}
+
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		title = regex.ReplaceAllString(title, "")
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// releaseTag matches a bracketed or parenthesised tag of release
+// information, such as "[720p]", "(1080p)", "[1920x1080]", "[x265]", "[BD
+// 1080p FLAC]" or "[Multi-Subs]", that the title a loose pattern captures
+// may run into.
+var releaseTag = regexp.MustCompile(`(?i)\s*[\[(][^\[\]()]*\b(?:\d{3,4}[pi]|\d{3,4}x\d{3,4}|[248]k|uhd|[xh]\.?26[45]|hevc|avc|\d{1,2}-?bits?|aac|flac|opus|bd(?:rip)?|blu-?ray|web(?:-?(?:dl|rip))?|multi[- ]?(?:subs?|audio)|dual[- ]audio|subs?|subtitles?)\b[^\[\]()]*[\])]`)
+
+// wrapped matches a title that is all in one pair of brackets, as in
+// "[Group][Show][05].mkv".
+var wrapped = regexp.MustCompile(`^\[([^\]]+)\]$`)
+
+// cleanTitle returns title without its leading release group and the
+// release tags in it, which loose patterns such as "^(.+?)\[(\d+)\]"
+// capture along with the title of "[Group] Show [720p] [05].mkv". A title
+// that is nothing but those is kept as it is.
+func cleanTitle(title string) string {
+	cleaned := strings.TrimSpace(releaseTag.ReplaceAllString(title, ""))
+	if rest := strings.TrimSpace(leadingGroup.ReplaceAllString(cleaned, "")); rest != "" {
+		cleaned = rest
+	}
+	if m := wrapped.FindStringSubmatch(cleaned); m != nil {
+		cleaned = strings.TrimSpace(m[1])
+	}
+	if cleaned == "" {
+		return strings.TrimSpace(title)
+	}
+	return cleaned
+}
+
+// ExtractEpisode returns the most plausible of the episode numbers the
+// configured episode patterns capture, or 0. Every number they capture is
+// a candidate, so a resolution such as the "720" of "[720p]" or a CRC does
+// not win just because it comes first; of candidates that are as plausible,
+// the one furthest after the title wins. Non-breaking and zero-width spaces,
+// as before the hash of "#05", count as plain spaces.
+func (p *Parser) ExtractEpisode(filename string) int {
+	filename = plainSpaces(filename)
+	candidates := p.episodeCandidates(filename)
+	best, ok := bestCandidate(candidates)
+	if !ok {
+		return 0
+	}
+	if len(candidates) > 1 {
+		for _, c := range candidates {
+			p.log.Debugf("Episode candidate %q at %d: score %d %v", filename[c.start:c.end], c.start, c.score, c.why)
+		}
+		p.log.Debugf("Episode %d picked from %d candidates", best.episode, len(candidates))
+	}
+	return best.episode
+}
+
+// invisibleSpaces turns the non-breaking spaces of web rip names into plain
+// ones and drops the zero-width ones.
+var invisibleSpaces = strings.NewReplacer(
+	"\u00a0", " ", "\u202f", " ",
+	"\u200b", "", "\u2060", "", "\ufeff", "",
+)
+
+// plainSpaces returns name with plain spaces for its invisible ones, so the
+// patterns need not know about them.
+func plainSpaces(name string) string {
+	return invisibleSpaces.Replace(name)
+}
+
+// ExtractQuality returns the first quality pattern contained in filename, or
+// "Unknown".
+func (p *Parser) ExtractQuality(filename string) string {
+	for _, pattern := range p.cfg.QualityPatterns {
+		if strings.Contains(strings.ToLower(filename), strings.ToLower(pattern)) {
+			return pattern
+		}
+	}
+	return "Unknown"
+}
+
+// leadingGroup matches the bracketed release group that fansub releases
+// start their names with.
+var leadingGroup = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+
+// ReleaseGroup returns the release group of filename: the bracketed group it
+// starts with or else the one ExtractGroup finds.
+func (p *Parser) ReleaseGroup(filename string) string {
+	if matches := leadingGroup.FindStringSubmatch(filename); matches != nil {
+		return strings.TrimSpace(matches[1])
+	}
+	return p.ExtractGroup(filename)
+}
+
+// ExtractGroup returns the release group captured by the configured group
+// patterns, or "Unknown".
+func (p *Parser) ExtractGroup(filename string) string {
+	for _, pattern := range p.cfg.GroupPatterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+
+		matches := regex.FindStringSubmatch(filename)
+		if len(matches) >= 2 {
+			return matches[1]
+		}
+	}
+	return "Unknown"
+}
@@ -0,0 +1,162 @@
+package parser_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/parser"
+)
+
+// defaultConfig returns the parser configuration of config.Default, with the
+// patterns of its presets.
+func defaultConfig(t testing.TB) parser.Config {
+	t.Helper()
+	cfg := config.Default()
+	if err := cfg.LoadPresets(filepath.Join(t.TempDir(), "config.json"), nil); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.ParserConfig()
+}
+
+func newDefaultParser(t *testing.T) *parser.Parser {
+	t.Helper()
+	return parser.New(defaultConfig(t), nil)
+}
+
+// TestPatternPrecedence parses names that the loose bracket pattern matches
+// as well, which the stricter patterns tried before it must win.
+func TestPatternPrecedence(t *testing.T) {
+	p := newDefaultParser(t)
+	tests := []struct {
+		name       string
+		title      string
+		season     int
+		episode    int
+		seriesType string
+	}{
+		{"Shangri-La_Frontier_2nd_Season_[09]_[AniLibria].mkv", "Shangri-La Frontier", 2, 9, "anime"},
+		{"Show_Name_Season_2_[08].mkv", "Show Name", 2, 8, "anime"},
+		{"[ASW] Show - 05 [1080p] [12345678].mkv", "Show", 1, 5, "anime"},
+		{"[Erai-raws] Dandadan 2nd Season - 03 [1080p][Multiple Subtitle][ENG].mkv", "Dandadan", 2, 3, "anime"},
+		{"Kaiju No. 8 S01E05 [2024].mkv", "Kaiju No 8", 1, 5, "standard"},
+		{"Show Name #05 [2024].mkv", "Show Name", 1, 5, ""},
+		{"Show Name ep#5.mkv", "Show Name", 1, 5, ""},
+		{"Show #1 Fan #05.mkv", "Show #1 Fan", 1, 5, ""},
+		{"Show Name - 05 [2024].mkv", "Show Name", 1, 5, ""},
+
+		// The bracket pattern still catches what nothing else does
+		{"Ame_to_Kimi_to_[03].mkv", "Ame to Kimi to", 1, 3, "anime"},
+	}
+	for _, tt := range tests {
+		anime, err := p.Parse(tt.name)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.name, err)
+			continue
+		}
+		if anime.Title != tt.title || anime.Season != tt.season || anime.Episode != tt.episode || anime.SeriesType != tt.seriesType {
+			t.Errorf("Parse(%q) = %q S%02dE%02d (%q), want %q S%02dE%02d (%q)", tt.name,
+				anime.Title, anime.Season, anime.Episode, anime.SeriesType, tt.title, tt.season, tt.episode, tt.seriesType)
+		}
+	}
+}
+
+// TestParseMessyNames parses names with several bracketed numbers, of which
+// the resolutions, CRCs and years must not be taken for the episode, nor
+// the release group and tags for part of the title.
+func TestParseMessyNames(t *testing.T) {
+	p := newDefaultParser(t)
+	tests := []struct {
+		name    string
+		title   string
+		season  int
+		episode int
+	}{
+		{"[Group] Show [720p] [05] [F1A2B3C4].mkv", "Show", 1, 5},
+		{"[Group] Show [1080p] [12].mkv", "Show", 1, 12},
+		{"[Judas] Jujutsu Kaisen [1080p][HEVC x265 10bit][Multi-Subs] [08].mkv", "Jujutsu Kaisen", 1, 8},
+		{"[Anime Time] One Piece [1080p][HEVC 10bit x265][AAC][Multi Sub] [1071].mkv", "One Piece", 1, 1071},
+		{"[Cleo] Sousou no Frieren [Dual Audio 10bit 1080p][HEVC-x265] [05].mkv", "Sousou no Frieren", 1, 5},
+		{"[DB] Mob Psycho 100 III [10bit][1080p] [05].mkv", "Mob Psycho 100 III", 1, 5},
+		{"[Kametsu] Bocchi the Rock! (BD 1080p Hi10 FLAC) [03] [D2FF8A3E].mkv", "Bocchi the Rock!", 1, 3},
+		{"[Nep_Blanc] Spy x Family [1080p] [02].mkv", "Spy x Family", 1, 2},
+		{"[Group] 86 Eighty-Six [1080] [05].mkv", "86 Eighty-Six", 1, 5},
+		{"[Group] Show [2160p] [4K] [10].mkv", "Show", 1, 10},
+		{"[Group] Show [1920x1080] [07] [AAC].mkv", "Show", 1, 7},
+		{"[Group] Show [2024] [06] [1080p].mkv", "Show", 1, 6},
+		{"[Group] Show [05v2] [720p] [ABCD1234].mkv", "Show", 1, 5},
+		{"[Group][Show][05][1080p].mkv", "Show", 1, 5},
+		{"Show_[1080p]_[11]_[AAC].mkv", "Show", 1, 11},
+		{"[Group] Show (1080p) [09] (5.1).mkv", "Show", 1, 9},
+		{"[Group] Show [x264 720p AAC] [04] [12345678].mkv", "Show", 1, 4},
+		{"[SubsPlease] Kaiju No. 8 - 05 (1080p) [F02B9CEE].mkv", "Kaiju No 8", 1, 5},
+		{"[Erai-raws] Dandadan - 03 [1080p][Multiple Subtitle][ENG][POR-BR].mkv", "Dandadan", 1, 3},
+		{"[ASW] Bleach - Sennen Kessen-hen - 06 [1080p HEVC x265 10Bit][AAC].mkv", "Bleach - Sennen Kessen-hen", 1, 6},
+		{"[EMBER] Oshi no Ko S02E03 [1080p] [HEVC WEBRip] (Oshi no Ko 2nd Season).mkv", "Oshi no Ko", 2, 3},
+		{"[HorribleSubs] One Punch Man - 12 [720p].mkv", "One Punch Man", 1, 12},
+		{"[Commie] Steins;Gate 0 - 03 [F1A2B3C4].mkv", "Steins;Gate 0", 1, 3},
+		{"Show.Name.S01E05.1080p.WEB-DL.x264-GROUP.mkv", "Show Name", 1, 5},
+	}
+	for _, tt := range tests {
+		anime, err := p.Parse(tt.name)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.name, err)
+			continue
+		}
+		if anime.Title != tt.title || anime.Season != tt.season || anime.Episode != tt.episode {
+			t.Errorf("Parse(%q) = %q S%02dE%02d, want %q S%02dE%02d", tt.name,
+				anime.Title, anime.Season, anime.Episode, tt.title, tt.season, tt.episode)
+		}
+	}
+}
+
+func TestRequireFullMatch(t *testing.T) {
+	loose := parser.AnimePattern{Name: "title only", Pattern: `^(.+?)\s+-`, TitleGroup: 1}
+	dash := parser.AnimePattern{Name: "dash", Pattern: `^(.+?)\s+-\s+(\d+)`, TitleGroup: 1, EpisodeGroup: 2}
+	swallow := parser.AnimePattern{Name: "swallow", Pattern: `^(.+)\s+-\s+(\d+)$`, TitleGroup: 1, EpisodeGroup: 2}
+	// The greedy title of swallow is longer than DefaultMaxTitleLength
+	title := strings.TrimSpace(strings.Repeat("Title ", 16))
+	long := title + " - 05 - 06 - 07.mkv"
+
+	tests := []struct {
+		desc     string
+		patterns []parser.AnimePattern
+		full     bool
+		filename string
+		title    string
+		episode  int
+	}{
+		{"a match without an episode wins", []parser.AnimePattern{loose, dash}, false, "Show - 05.mkv", "", 0},
+		{"a match without an episode is passed over", []parser.AnimePattern{loose, dash}, true, "Show - 05.mkv", "Show", 5},
+		{"a title that is too long is passed over", []parser.AnimePattern{swallow, dash}, true, long, title, 5},
+		{"a title that is too long wins without the option", []parser.AnimePattern{swallow, dash}, false, long, title + " - 05 - 06", 7},
+		{"the Require of a pattern wins over the option", []parser.AnimePattern{withRequire(loose, parser.Requirement{}), dash}, true, "Show - 05.mkv", "", 0},
+		{"the Require of a pattern applies without the option", []parser.AnimePattern{withRequire(loose, parser.Requirement{Episode: true}), dash}, false, "Show - 05.mkv", "Show", 5},
+		{"a required season", []parser.AnimePattern{withRequire(dash, parser.Requirement{Season: true}), swallow}, false, "Dan - Da - 05.mkv", "Dan - Da", 5},
+		{"a minimum title length", []parser.AnimePattern{withRequire(dash, parser.Requirement{MinTitleLength: 5}), swallow}, false, "Dan - Da - 05.mkv", "Dan - Da", 5},
+	}
+	for _, tt := range tests {
+		p := parser.New(parser.Config{AnimePatterns: tt.patterns, RequireFullMatch: tt.full}, nil)
+		anime, err := p.Parse(tt.filename)
+		if tt.episode == 0 {
+			if !errors.Is(err, parser.ErrParseFailed) {
+				t.Errorf("%s: Parse(%q) = %+v, %v; want ErrParseFailed", tt.desc, tt.filename, anime, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Parse(%q): %v", tt.desc, tt.filename, err)
+			continue
+		}
+		if anime.Title != tt.title || anime.Episode != tt.episode {
+			t.Errorf("%s: Parse(%q) = %q episode %d, want %q episode %d", tt.desc, tt.filename, anime.Title, anime.Episode, tt.title, tt.episode)
+		}
+	}
+}
+
+func withRequire(pattern parser.AnimePattern, require parser.Requirement) parser.AnimePattern {
+	pattern.Require = &require
+	return pattern
+}
@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TransformStep is the filename after one of the transforms changed it.
+type TransformStep struct {
+	// Index is the position of the transform in Config.Transforms.
+	Index     int
+	Transform Transform
+	Result    string
+}
+
+// CheckReplacement checks that every group reference in replace, the
+// replacement of a transform searching with re, resolves, so a typo does not
+// silently turn titles into garbage. It returns the references that expand to
+// nothing as errors: groups beyond those of re, unknown group names such as
+// "$l" for "$1", and "$1st", which regexp reads as the group named "1st". A
+// "$" that is not a reference is kept as it is and returned as a warning,
+// since it more likely is a mistyped reference than a dollar sign.
+func CheckReplacement(re *regexp.Regexp, replace string) (errs, warnings []string) {
+	names := make(map[string]bool)
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			names[name] = true
+		}
+	}
+
+	for i := 0; i < len(replace); i++ {
+		if replace[i] != '$' {
+			continue
+		}
+		rest := replace[i+1:]
+		if strings.HasPrefix(rest, "$") {
+			i++
+			continue
+		}
+
+		name, length, braced := groupReference(rest)
+		if name == "" {
+			warnings = append(warnings, fmt.Sprintf("has a literal $ at offset %d; write $$ for a dollar sign or ${1} or ${name} for a group", i))
+			continue
+		}
+		ref := replace[i : i+1+length]
+		i += length
+
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > re.NumSubexp() {
+				errs = append(errs, fmt.Sprintf("%s refers to group %d, but the search has %d group(s)", ref, n, re.NumSubexp()))
+			}
+			continue
+		}
+		switch {
+		case names[name]:
+		case !braced && name[0] >= '0' && name[0] <= '9':
+			end := 0
+			for name[end] >= '0' && name[end] <= '9' {
+				end++
+			}
+			errs = append(errs, fmt.Sprintf("%s is read as the group named %q; write ${%s}%s", ref, name, name[:end], name[end:]))
+		case len(names) == 0:
+			errs = append(errs, fmt.Sprintf("%s refers to group %q, but the search has no named groups", ref, name))
+		default:
+			errs = append(errs, fmt.Sprintf("%s refers to group %q, but the search has no group of that name", ref, name))
+		}
+	}
+	return errs, warnings
+}
+
+// groupReference reads the group reference at the start of s, which follows
+// a "$", the way regexp.Expand does: a run of letters, digits and
+// underscores, or such a run in braces. It returns an empty name when s does
+// not start with a reference.
+func groupReference(s string) (name string, length int, braced bool) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 2 || !isGroupName(s[1:end]) {
+			return "", 0, false
+		}
+		return s[1:end], end + 1, true
+	}
+	end := 0
+	for end < len(s) && isNameByte(s[end]) {
+		end++
+	}
+	return s[:end], end, false
+}
+
+func isGroupName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isNameByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
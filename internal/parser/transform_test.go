@@ -0,0 +1,39 @@
+package parser_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/parser"
+)
+
+func TestCheckReplacement(t *testing.T) {
+	tests := []struct {
+		search, replace string
+		err, warning    string
+	}{
+		{`^(.+) - (\d+)`, "$1 - ${2}", "", ""},
+		{`^(?P<title>.+) - (\d+)`, "${title} $$5", "", ""},
+		{`^(.+) - (\d+)`, "$l", `"l", but the search has no named groups`, ""},
+		{`^(.+) - (\d+)`, "$3", "refers to group 3, but the search has 2 group(s)", ""},
+		{`^(?P<title>.+)`, "${tilte}", `"tilte", but the search has no group of that name`, ""},
+		{`^(.+) (\d+)`, "$1st", `$1st is read as the group named "1st"; write ${1}st`, ""},
+		{`^(.+)`, "$1 costs $ 5", "", "literal $ at offset 9"},
+	}
+	for _, tt := range tests {
+		errs, warnings := parser.CheckReplacement(regexp.MustCompile(tt.search), tt.replace)
+		if !matches(errs, tt.err) || !matches(warnings, tt.warning) {
+			t.Errorf("CheckReplacement(%q, %q) = %q, %q; want %q, %q", tt.search, tt.replace, errs, warnings, tt.err, tt.warning)
+		}
+	}
+}
+
+// matches reports whether msgs is a single message containing want, or none
+// when want is empty.
+func matches(msgs []string, want string) bool {
+	if want == "" {
+		return len(msgs) == 0
+	}
+	return len(msgs) == 1 && strings.Contains(msgs[0], want)
+}
@@ -0,0 +1,255 @@
+// Package qbittorrent asks qBittorrent whether a file still belongs to a
+// torrent that is downloading or seeding, so it is not moved away from under
+// the torrent.
+package qbittorrent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// requestTimeout bounds each request, so an unreachable qBittorrent delays a
+// scan only briefly.
+const requestTimeout = 15 * time.Second
+
+// Torrent is the part of a torrent of /api/v2/torrents/info the check needs.
+type Torrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	ContentPath string  `json:"content_path"`
+	Ratio       float64 `json:"ratio"`
+	// MaxRatio and MaxSeedingTime, in minutes, are the seeding goals in
+	// effect for the torrent; they are negative when there is none.
+	MaxRatio       float64 `json:"max_ratio"`
+	MaxSeedingTime int     `json:"max_seeding_time"`
+	// SeedingTime is in seconds.
+	SeedingTime int `json:"seeding_time"`
+}
+
+// seedingStates are the states of a complete torrent that is still seeding
+// or about to. qBittorrent pauses (stops, since 5.0) a torrent that reached
+// its seeding goals.
+var seedingStates = map[string]bool{
+	"uploading":  true,
+	"stalledUP":  true,
+	"forcedUP":   true,
+	"queuedUP":   true,
+	"checkingUP": true,
+}
+
+// Busy returns why t still needs its files, or "" when they may be moved.
+func (t Torrent) Busy() string {
+	if t.Progress < 1 {
+		return fmt.Sprintf("still downloading (%.0f%%)", t.Progress*100)
+	}
+	if !seedingStates[t.State] {
+		return ""
+	}
+	if t.MaxRatio >= 0 && t.Ratio >= t.MaxRatio ||
+		t.MaxSeedingTime >= 0 && t.SeedingTime >= t.MaxSeedingTime*60 {
+		return ""
+	}
+	return fmt.Sprintf("still seeding (ratio %.2f)", t.Ratio)
+}
+
+// Client talks to the Web API of a qBittorrent instance.
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+	loggedIn   bool
+}
+
+// NewClient returns a Client for the qBittorrent Web UI at baseURL. Requests
+// are traced to log like those of the Sonarr client; log may be nil.
+func NewClient(baseURL, username, password string, log *logging.Logger) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: sonarr.Traced(&http.Client{Timeout: requestTimeout, Jar: jar}, log),
+	}
+}
+
+// BaseURL returns the qBittorrent URL the client was created with, without a
+// trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Version returns the version of qBittorrent.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var version string
+	err := c.get(ctx, "/api/v2/app/version", nil, func(body []byte) error {
+		version = strings.TrimSpace(string(body))
+		return nil
+	})
+	return version, err
+}
+
+// Torrents returns every torrent.
+func (c *Client) Torrents(ctx context.Context) ([]Torrent, error) {
+	var torrents []Torrent
+	err := c.get(ctx, "/api/v2/torrents/info", nil, func(body []byte) error {
+		return json.Unmarshal(body, &torrents)
+	})
+	return torrents, err
+}
+
+// get requests path, logging in first and again once the session expired,
+// and passes the response body to decode.
+func (c *Client) get(ctx context.Context, path string, query url.Values, decode func([]byte) error) error {
+	for attempt := 0; ; attempt++ {
+		if !c.loggedIn && c.username != "" {
+			if err := c.login(ctx); err != nil {
+				return err
+			}
+		}
+
+		endpoint := c.baseURL + path
+		if len(query) > 0 {
+			endpoint += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusForbidden && c.username != "" && attempt == 0 {
+			c.loggedIn = false
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &sonarr.APIError{Method: http.MethodGet, Path: path, StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return decode(body)
+	}
+}
+
+// login starts a session, whose cookie the client keeps.
+func (c *Client) login(ctx context.Context) error {
+	form := url.Values{"username": {c.username}, "password": {c.password}}.Encode()
+	// The body is not replayable, so request tracing cannot log the password
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v2/auth/login", io.NopCloser(strings.NewReader(form)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent refuses logins whose Referer does not match its host
+	req.Header.Set("Referer", c.baseURL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("qBittorrent login failed (status %d): check the username and password", resp.StatusCode)
+	}
+	c.loggedIn = true
+	return nil
+}
+
+// Checker tells the importer which files belong to torrents that still need
+// them. It implements importer.Torrents: the torrents are fetched once per
+// scan, and while qBittorrent is unreachable every file may be imported.
+type Checker struct {
+	client     *Client
+	categories map[string]bool
+	mappings   []config.PathMapping
+	log        *logging.Logger
+
+	mu          sync.Mutex
+	torrents    []Torrent
+	unreachable bool
+}
+
+// NewChecker returns a Checker for the qBittorrent instance of cfg.
+func NewChecker(cfg config.QBittorrentConfig, log *logging.Logger) *Checker {
+	c := &Checker{
+		client:   NewClient(cfg.URL, cfg.Username, cfg.Password, log),
+		mappings: cfg.PathMappings,
+		log:      log,
+	}
+	if len(cfg.Categories) > 0 {
+		c.categories = make(map[string]bool)
+		for _, category := range cfg.Categories {
+			c.categories[category] = true
+		}
+	}
+	return c
+}
+
+// Load implements importer.Torrents. A failure is logged once until
+// qBittorrent answers again.
+func (c *Checker) Load(ctx context.Context) {
+	torrents, err := c.client.Torrents(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if !c.unreachable {
+			c.log.Warnf("qBittorrent at %s is unavailable, importing without checking torrents: %v", c.client.BaseURL(), err)
+		}
+		c.unreachable = true
+		c.torrents = nil
+		return
+	}
+	if c.unreachable {
+		c.log.Infof("qBittorrent is available again")
+		c.unreachable = false
+	}
+
+	c.torrents = c.torrents[:0]
+	for _, t := range torrents {
+		if c.categories != nil && !c.categories[t.Category] {
+			continue
+		}
+		t.ContentPath = filepath.Clean(config.MapPath(c.mappings, t.ContentPath))
+		c.torrents = append(c.torrents, t)
+	}
+	c.log.Debugf("Loaded %d torrent(s) from qBittorrent", len(c.torrents))
+}
+
+// Busy implements importer.Torrents.
+func (c *Checker) Busy(path string) string {
+	path = filepath.Clean(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.torrents {
+		if path != t.ContentPath && !strings.HasPrefix(path, t.ContentPath+string(filepath.Separator)) {
+			continue
+		}
+		if reason := t.Busy(); reason != "" {
+			return fmt.Sprintf("torrent %s is %s", t.Name, reason)
+		}
+	}
+	return ""
+}
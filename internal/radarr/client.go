@@ -0,0 +1,158 @@
+// Package radarr is a minimal client for the Radarr v3 API, used to hand off
+// files recognised as movies.
+package radarr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// maxErrorBody is the number of response bytes kept in an APIError.
+const maxErrorBody = 4096
+
+// Client talks to a single Radarr instance. Errors are reported with the
+// types of the sonarr package, so they are categorised like Sonarr's.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	headers    map[string]string
+	readOnly   bool
+}
+
+// NewClient returns a Client for the Radarr instance at baseURL. If
+// httpClient is nil a client with sonarr.DefaultTimeout is used. Redirects and
+// tracing to log work like those of the Sonarr client; log may be nil.
+func NewClient(baseURL, apiKey string, httpClient *http.Client, log *logging.Logger) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: sonarr.Traced(sonarr.WithRedirectPolicy(httpClient), log),
+	}
+}
+
+// SetReadOnly makes every later request other than GET fail with
+// sonarr.ErrReadOnly without being sent.
+func (c *Client) SetReadOnly() {
+	c.readOnly = true
+}
+
+// SetHeaders adds headers to every later request.
+func (c *Client) SetHeaders(headers map[string]string) {
+	c.headers = headers
+}
+
+// BaseURL returns the Radarr URL the client was created with, without a
+// trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// SystemStatus returns Radarr's version information. Like that of the Sonarr
+// client, it fails for a base URL that Radarr redirects to HTTPS.
+func (c *Client) SystemStatus(ctx context.Context) (*sonarr.SystemStatus, error) {
+	const path = "/api/v3/system/status"
+	var status sonarr.SystemStatus
+	resp, err := c.send(ctx, http.MethodGet, path, nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	if err := sonarr.CheckUpgrade(c.baseURL, path, resp); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetMovies returns every movie in the library.
+func (c *Client) GetMovies(ctx context.Context) ([]Movie, error) {
+	var movies []Movie
+	if err := c.do(ctx, http.MethodGet, "/api/v3/movie", nil, nil, &movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// LookupMovie searches TMDB through Radarr for term.
+func (c *Client) LookupMovie(ctx context.Context, term string) ([]Movie, error) {
+	var results []Movie
+	if err := c.do(ctx, http.MethodGet, "/api/v3/movie/lookup", url.Values{"term": {term}}, nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AddMovie adds movie to the library and returns it as stored by Radarr.
+func (c *Client) AddMovie(ctx context.Context, movie Movie) (*Movie, error) {
+	var added Movie
+	if err := c.do(ctx, http.MethodPost, "/api/v3/movie", nil, movie, &added); err != nil {
+		return nil, fmt.Errorf("failed to add movie: %w", err)
+	}
+	return &added, nil
+}
+
+// ManualImport asks Radarr to import files with its ManualImport command.
+// importMode is "move" or "copy"; Radarr's own setting applies when it is
+// empty.
+func (c *Client) ManualImport(ctx context.Context, importMode string, files []ManualImportFile) error {
+	if importMode == "" {
+		importMode = "auto"
+	}
+	cmd := manualImportCommand{Name: "ManualImport", ImportMode: importMode, Files: files}
+	if err := c.do(ctx, http.MethodPost, "/api/v3/command", nil, cmd, nil); err != nil {
+		return fmt.Errorf("manual import failed: %w", err)
+	}
+	return nil
+}
+
+// do sends a request to path and decodes the JSON response into out when out
+// is not nil. Non-2xx responses are returned as *sonarr.APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	_, err := c.send(ctx, method, path, query, body, out)
+	return err
+}
+
+// send is do, also returning the response, whose body is closed.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body, out any) (*http.Response, error) {
+	if c.readOnly && method != http.MethodGet {
+		return nil, fmt.Errorf("%w: %s %s", sonarr.ErrReadOnly, method, path)
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := sonarr.NewRequest(ctx, method, endpoint, c.apiKey, c.headers, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp, &sonarr.APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+		}
+	}
+
+	if out == nil {
+		return resp, nil
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
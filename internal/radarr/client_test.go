@@ -0,0 +1,144 @@
+package radarr_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/radarr/radarrtest"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+var suzume = radarr.Movie{Title: "Suzume", Year: 2022, TmdbID: 916224, TitleSlug: "suzume-916224"}
+
+func TestSystemStatus(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+
+	status, err := srv.Client().SystemStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.AppName != "Radarr" {
+		t.Errorf("AppName = %q, want Radarr", status.AppName)
+	}
+}
+
+func TestLookupAddAndImport(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Suzume 2022", suzume)
+	client := srv.Client()
+	ctx := context.Background()
+
+	results, err := client.LookupMovie(ctx, "Suzume 2022")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].TmdbID != suzume.TmdbID {
+		t.Fatalf("LookupMovie = %+v, want %s", results, suzume.Title)
+	}
+
+	movie := results[0]
+	movie.RootFolderPath = "/movies"
+	movie.QualityProfileID = 1
+	movie.AddOptions = &radarr.AddOptions{}
+	added, err := client.AddMovie(ctx, movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID == 0 || added.RootFolderPath != "/movies" {
+		t.Errorf("AddMovie = %+v, want an ID and the root folder", added)
+	}
+	movies, err := client.GetMovies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 1 || movies[0].ID != added.ID {
+		t.Errorf("GetMovies = %+v, want the added movie", movies)
+	}
+
+	files := []radarr.ManualImportFile{{Path: "/downloads/Suzume (2022).mkv", MovieID: added.ID}}
+	if err := client.ManualImport(ctx, "", files); err != nil {
+		t.Fatal(err)
+	}
+	imports := srv.Imports()
+	if len(imports) != 1 {
+		t.Fatalf("got %d imports, want 1", len(imports))
+	}
+	if imports[0].ImportMode != "auto" || len(imports[0].Files) != 1 || imports[0].Files[0] != files[0] {
+		t.Errorf("import = %+v, want %+v in mode auto", imports[0], files)
+	}
+}
+
+func TestLookupMiss(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+
+	results, err := srv.Client().LookupMovie(context.Background(), "Nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("LookupMovie = %+v, want no results", results)
+	}
+}
+
+func TestAddExistingMovie(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+	srv.AddMovie(suzume)
+
+	_, err := srv.Client().AddMovie(context.Background(), suzume)
+	var apiErr *sonarr.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("AddMovie of an existing movie: %v, want a 400 APIError", err)
+	}
+	if got := apiErr.Message(); got != "This movie has already been added" {
+		t.Errorf("Message() = %q", got)
+	}
+}
+
+func TestErrorsAreAPIErrors(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+	srv.Fail(http.MethodPost, "/api/v3/command", http.StatusServiceUnavailable, 1)
+
+	err := srv.Client().ManualImport(context.Background(), "move", nil)
+	var apiErr *sonarr.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Path != "/api/v3/command" {
+		t.Fatalf("ManualImport: %v, want a 503 APIError for /api/v3/command", err)
+	}
+	if len(srv.Imports()) != 0 {
+		t.Error("the failed import was recorded")
+	}
+
+	bad := radarr.NewClient(srv.URL, "wrong", nil, nil)
+	if _, err := bad.GetMovies(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GetMovies with a wrong API key: %v, want a 401 APIError", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	srv := radarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Suzume", suzume)
+	client := srv.Client()
+	client.SetReadOnly()
+	ctx := context.Background()
+
+	if _, err := client.LookupMovie(ctx, "Suzume"); err != nil {
+		t.Errorf("LookupMovie in read-only mode: %v", err)
+	}
+	if _, err := client.AddMovie(ctx, suzume); !errors.Is(err, sonarr.ErrReadOnly) {
+		t.Errorf("AddMovie in read-only mode: %v, want ErrReadOnly", err)
+	}
+	if err := client.ManualImport(ctx, "", nil); !errors.Is(err, sonarr.ErrReadOnly) {
+		t.Errorf("ManualImport in read-only mode: %v, want ErrReadOnly", err)
+	}
+	if len(srv.Movies()) != 0 || len(srv.Imports()) != 0 {
+		t.Error("a read-only client changed Radarr")
+	}
+}
@@ -0,0 +1,197 @@
+// Package radarrtest provides a fake Radarr v3 API for exercising the movie
+// hand-off without a real instance, like sonarrtest does for Sonarr.
+package radarrtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"sonarr-autoimport/internal/radarr"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// APIKey is the API key the fake accepts.
+const APIKey = "radarrtest"
+
+// Import is a ManualImport command received by the fake.
+type Import struct {
+	ImportMode string                    `json:"importMode"`
+	Files      []radarr.ManualImportFile `json:"files"`
+}
+
+// Server is a fake Radarr listening on a local port. Close stops it.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	movies   []radarr.Movie
+	lookups  map[string][]radarr.Movie
+	terms    []string
+	imports  []Import
+	failures map[string]*failure
+	nextID   int
+}
+
+// failure makes requests to an endpoint fail with status, every one of them
+// when remaining is negative.
+type failure struct {
+	status    int
+	remaining int
+}
+
+// New starts a fake Radarr with an empty library.
+func New() *Server {
+	s := &Server{
+		lookups:  make(map[string][]radarr.Movie),
+		failures: make(map[string]*failure),
+		nextID:   1,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a client for the fake.
+func (s *Server) Client() *radarr.Client {
+	return radarr.NewClient(s.URL, APIKey, s.Server.Client(), nil)
+}
+
+// AddMovie puts movie into the library, assigning an ID when it has none,
+// and returns it as stored.
+func (s *Server) AddMovie(movie radarr.Movie) radarr.Movie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addMovie(movie)
+}
+
+func (s *Server) addMovie(movie radarr.Movie) radarr.Movie {
+	if movie.ID == 0 {
+		movie.ID = s.nextID
+		s.nextID++
+	}
+	s.movies = append(s.movies, movie)
+	return movie
+}
+
+// AddLookup makes a lookup of term, matched ignoring case, return result.
+func (s *Server) AddLookup(term string, result radarr.Movie) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(term)
+	s.lookups[key] = append(s.lookups[key], result)
+}
+
+// Fail makes the next times requests with method to path, such as "GET" and
+// "/api/v3/movie", fail with status. A negative times fails all of them and
+// a status of 0 stops failing them.
+func (s *Server) Fail(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := method + " " + path
+	if status == 0 {
+		delete(s.failures, key)
+		return
+	}
+	s.failures[key] = &failure{status: status, remaining: times}
+}
+
+// Movies returns the movies in the library.
+func (s *Server) Movies() []radarr.Movie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]radarr.Movie(nil), s.movies...)
+}
+
+// Lookups returns the terms looked up so far.
+func (s *Server) Lookups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.terms...)
+}
+
+// Imports returns the manual imports received so far.
+func (s *Server) Imports() []Import {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Import(nil), s.imports...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Api-Key") != APIKey {
+		http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.failures[r.Method+" "+r.URL.Path]; f != nil && f.remaining != 0 {
+		f.remaining--
+		http.Error(w, fmt.Sprintf(`{"message":"injected failure %d"}`, f.status), f.status)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+	switch {
+	case r.Method == http.MethodGet && path == "/system/status":
+		reply(w, http.StatusOK, sonarr.SystemStatus{AppName: "Radarr", Version: "5.2.6.8376"})
+	case r.Method == http.MethodGet && path == "/movie":
+		reply(w, http.StatusOK, append([]radarr.Movie{}, s.movies...))
+	case r.Method == http.MethodGet && path == "/movie/lookup":
+		term := r.URL.Query().Get("term")
+		s.terms = append(s.terms, term)
+		reply(w, http.StatusOK, append([]radarr.Movie{}, s.lookups[strings.ToLower(term)]...))
+	case r.Method == http.MethodPost && path == "/movie":
+		s.postMovie(w, r)
+	case r.Method == http.MethodPost && path == "/command":
+		var cmd struct {
+			Name string `json:"name"`
+			Import
+		}
+		if !decode(w, r, &cmd) {
+			return
+		}
+		if cmd.Name != "ManualImport" {
+			http.Error(w, fmt.Sprintf(`{"message":"unknown command %s"}`, cmd.Name), http.StatusBadRequest)
+			return
+		}
+		s.imports = append(s.imports, cmd.Import)
+		reply(w, http.StatusCreated, map[string]any{"id": len(s.imports), "name": cmd.Name, "status": "queued"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// postMovie adds the movie in the body of r like Radarr does, refusing a
+// second movie with the same TMDB ID.
+func (s *Server) postMovie(w http.ResponseWriter, r *http.Request) {
+	var movie radarr.Movie
+	if !decode(w, r, &movie) {
+		return
+	}
+	for _, existing := range s.movies {
+		if existing.TmdbID == movie.TmdbID {
+			reply(w, http.StatusBadRequest, []map[string]string{{"propertyName": "TmdbId", "errorMessage": "This movie has already been added"}})
+			return
+		}
+	}
+	movie.ID = 0
+	movie.AddOptions = nil
+	reply(w, http.StatusCreated, s.addMovie(movie))
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message":%q}`, err.Error()), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,38 @@
+package radarr
+
+import "sonarr-autoimport/internal/sonarr"
+
+// Movie is a movie in the Radarr library or a lookup result.
+type Movie struct {
+	ID                  int            `json:"id,omitempty"`
+	Title               string         `json:"title"`
+	SortTitle           string         `json:"sortTitle,omitempty"`
+	Year                int            `json:"year"`
+	TmdbID              int            `json:"tmdbId"`
+	TitleSlug           string         `json:"titleSlug,omitempty"`
+	Images              []sonarr.Image `json:"images,omitempty"`
+	Path                string         `json:"path,omitempty"`
+	QualityProfileID    int            `json:"qualityProfileId,omitempty"`
+	RootFolderPath      string         `json:"rootFolderPath,omitempty"`
+	Monitored           bool           `json:"monitored"`
+	MinimumAvailability string         `json:"minimumAvailability,omitempty"`
+	AddOptions          *AddOptions    `json:"addOptions,omitempty"`
+}
+
+// AddOptions controls what Radarr does right after a movie is added.
+type AddOptions struct {
+	SearchForMovie bool `json:"searchForMovie"`
+}
+
+// ManualImportFile is a single file of a manual import and its movie.
+type ManualImportFile struct {
+	Path    string `json:"path"`
+	MovieID int    `json:"movieId"`
+}
+
+// manualImportCommand is the body of the ManualImport command.
+type manualImportCommand struct {
+	Name       string             `json:"name"`
+	ImportMode string             `json:"importMode"`
+	Files      []ManualImportFile `json:"files"`
+}
@@ -0,0 +1,123 @@
+// Package report writes scan results to JSON files for post-processing.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+)
+
+const (
+	// filePrefix and timeLayout name the reports written to a directory, so
+	// they sort chronologically.
+	filePrefix = "scan-"
+	timeLayout = "20060102-150405.000"
+)
+
+// Writer writes a report after every scan, either always to the same file or
+// to a new timestamped file in a directory. It implements importer.Observer.
+type Writer struct {
+	path   string
+	dir    string
+	retain int
+	log    *logging.Logger
+}
+
+// NewFile returns a Writer that replaces the report at path after each scan.
+func NewFile(path string, log *logging.Logger) *Writer {
+	return &Writer{path: path, log: log}
+}
+
+// NewDir returns a Writer that adds a timestamped report to dir after each
+// scan and keeps only the newest retain reports when retain is positive.
+func NewDir(dir string, retain int, log *logging.Logger) *Writer {
+	return &Writer{dir: dir, retain: retain, log: log}
+}
+
+// FileProcessed implements importer.Observer.
+func (w *Writer) FileProcessed(importer.FileResult) {}
+
+// ScanFinished implements importer.Observer.
+func (w *Writer) ScanFinished(r *importer.ScanResult) {
+	path := w.path
+	if w.dir != "" {
+		if err := os.MkdirAll(w.dir, 0755); err != nil {
+			w.log.Errorf("Failed to create report directory: %v", err)
+			return
+		}
+		path = filepath.Join(w.dir, filePrefix+r.FinishedAt.Format(timeLayout)+".json")
+	}
+
+	if err := Write(path, r); err != nil {
+		w.log.Errorf("Failed to write report: %v", err)
+		return
+	}
+	w.log.Debugf("Wrote report %s", path)
+
+	if w.dir != "" && w.retain > 0 {
+		if err := prune(w.dir, w.retain); err != nil {
+			w.log.Warnf("Failed to prune old reports: %v", err)
+		}
+	}
+}
+
+// Write stores r as JSON at path. The report is written to a temporary file
+// in the same directory and renamed over path, so readers never see a
+// partial report.
+func Write(path string, r *importer.ScanResult) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prune deletes all but the newest retain reports in dir.
+func prune(dir string, retain int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var reports []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, ".json") {
+			reports = append(reports, name)
+		}
+	}
+	if len(reports) <= retain {
+		return nil
+	}
+
+	sort.Strings(reports)
+	for _, name := range reports[:len(reports)-retain] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+// Package sonarr is a minimal client for the Sonarr v3 API.
+package sonarr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// DefaultTimeout is the request timeout of the client created when none is
+// supplied.
+const DefaultTimeout = 60 * time.Second
+
+// Client talks to a single Sonarr instance.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	headers    map[string]string
+	readOnly   bool
+	usage      *usageCounter
+}
+
+// NewClient returns a Client for the Sonarr instance at baseURL. If httpClient
+// is nil a client with DefaultTimeout is used. Redirects follow
+// CheckRedirect, and every request and response is logged to log at trace
+// level; log may be nil.
+func NewClient(baseURL, apiKey string, httpClient *http.Client, log *logging.Logger) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: Traced(WithRedirectPolicy(httpClient), log),
+		usage:      &usageCounter{},
+	}
+}
+
+// Traced returns a copy of httpClient that logs every request and response to
+// log at trace level, with credentials redacted. A nil httpClient stands for
+// one with DefaultTimeout, and a nil log disables the tracing.
+func Traced(httpClient *http.Client, log *logging.Logger) *http.Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if log == nil {
+		return httpClient
+	}
+	traced := *httpClient
+	base := traced.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	traced.Transport = &traceTransport{base: base, log: log}
+	return &traced
+}
+
+// SetReadOnly makes every later request other than GET fail with ErrReadOnly
+// without being sent, which guarantees dry runs change nothing.
+func (c *Client) SetReadOnly() {
+	c.readOnly = true
+}
+
+// SetHeaders adds headers to every later request, such as one a reverse
+// proxy in front of Sonarr needs.
+func (c *Client) SetHeaders(headers map[string]string) {
+	c.headers = headers
+}
+
+// Usage returns what the client asked of Sonarr since it was created.
+func (c *Client) Usage() Usage {
+	return c.usage.snapshot()
+}
+
+// BaseURL returns the Sonarr URL the client was created with, without a
+// trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// SystemStatus returns Sonarr's version information. It is the cheapest call
+// to check that Sonarr is reachable and the API key is valid. A base URL that
+// Sonarr redirects from HTTP to HTTPS fails with a *RedirectError naming the
+// URL to use instead.
+func (c *Client) SystemStatus(ctx context.Context) (*SystemStatus, error) {
+	const path = "/api/v3/system/status"
+	var status SystemStatus
+	resp, err := c.send(ctx, http.MethodGet, path, nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckUpgrade(c.baseURL, path, resp); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// QualityProfiles returns the quality profiles new series can be added with.
+func (c *Client) QualityProfiles(ctx context.Context) ([]QualityProfile, error) {
+	var profiles []QualityProfile
+	if err := c.do(ctx, http.MethodGet, "/api/v3/qualityprofile", nil, nil, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// LanguageProfiles returns the language profiles. Sonarr v4 no longer has
+// them and answers with an APIError.
+func (c *Client) LanguageProfiles(ctx context.Context) ([]LanguageProfile, error) {
+	var profiles []LanguageProfile
+	if err := c.do(ctx, http.MethodGet, "/api/v3/languageprofile", nil, nil, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// RootFolders returns the library folders series can be added to.
+func (c *Client) RootFolders(ctx context.Context) ([]RootFolder, error) {
+	var folders []RootFolder
+	if err := c.do(ctx, http.MethodGet, "/api/v3/rootfolder", nil, nil, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// RootFolder returns the root folder with id, with its unmapped folders.
+func (c *Client) RootFolder(ctx context.Context, id int) (*RootFolder, error) {
+	var folder RootFolder
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/rootfolder/%d", id), nil, nil, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// Tags returns the tags that series can be labelled with.
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	if err := c.do(ctx, http.MethodGet, "/api/v3/tag", nil, nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetSeries returns every series in the library.
+func (c *Client) GetSeries(ctx context.Context) ([]Series, error) {
+	var series []Series
+	if err := c.do(ctx, http.MethodGet, "/api/v3/series", nil, nil, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// LookupSeries searches TVDB through Sonarr for term.
+func (c *Client) LookupSeries(ctx context.Context, term string) ([]SeriesLookup, error) {
+	query := url.Values{"term": {term}}
+
+	var results []SeriesLookup
+	if err := c.do(ctx, http.MethodGet, "/api/v3/series/lookup", query, nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AddSeries adds series to the library and returns it as stored by Sonarr.
+func (c *Client) AddSeries(ctx context.Context, series Series) (*Series, error) {
+	var added Series
+	if err := c.do(ctx, http.MethodPost, "/api/v3/series", nil, series, &added); err != nil {
+		return nil, fmt.Errorf("failed to add series: %w", err)
+	}
+	return &added, nil
+}
+
+// DeleteSeries removes the series with id from the library. With deleteFiles
+// its folder is deleted too.
+func (c *Client) DeleteSeries(ctx context.Context, id int, deleteFiles bool) error {
+	query := url.Values{"deleteFiles": {strconv.FormatBool(deleteFiles)}}
+	if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v3/series/%d", id), query, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete series: %w", err)
+	}
+	return nil
+}
+
+// GetEpisodes returns every episode of the series with seriesID.
+func (c *Client) GetEpisodes(ctx context.Context, seriesID int) ([]Episode, error) {
+	query := url.Values{"seriesId": {fmt.Sprint(seriesID)}}
+
+	var episodes []Episode
+	if err := c.do(ctx, http.MethodGet, "/api/v3/episode", query, nil, &episodes); err != nil {
+		return nil, err
+	}
+	return episodes, nil
+}
+
+// GetEpisode returns the episode with id.
+func (c *Client) GetEpisode(ctx context.Context, id int) (*Episode, error) {
+	var episode Episode
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/episode/%d", id), nil, nil, &episode); err != nil {
+		return nil, err
+	}
+	return &episode, nil
+}
+
+// wantedPageSize is the number of missing episodes requested per page.
+const wantedPageSize = 500
+
+// WantedMissing returns the monitored episodes without a file in the whole
+// library, reading every page of /wanted/missing.
+func (c *Client) WantedMissing(ctx context.Context) ([]Episode, error) {
+	var episodes []Episode
+	for page := 1; ; page++ {
+		query := url.Values{
+			"page":          {strconv.Itoa(page)},
+			"pageSize":      {strconv.Itoa(wantedPageSize)},
+			"sortKey":       {"episodes.airDateUtc"},
+			"sortDirection": {"ascending"},
+			"monitored":     {"true"},
+		}
+		var resp Page[Episode]
+		if err := c.do(ctx, http.MethodGet, "/api/v3/wanted/missing", query, nil, &resp); err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, resp.Records...)
+		if len(resp.Records) == 0 || len(episodes) >= resp.TotalRecords {
+			return episodes, nil
+		}
+	}
+}
+
+// ManualImportPreview returns how Sonarr would import the video files below
+// folder, including those of episodes that have a file already.
+func (c *Client) ManualImportPreview(ctx context.Context, folder string) ([]ManualImportItem, error) {
+	query := url.Values{
+		"folder":              {folder},
+		"filterExistingFiles": {"false"},
+	}
+	var items []ManualImportItem
+	if err := c.do(ctx, http.MethodGet, "/api/v3/manualimport", query, nil, &items); err != nil {
+		return nil, fmt.Errorf("manual import preview failed: %w", err)
+	}
+	return items, nil
+}
+
+// ManualImport asks Sonarr to import the files in req.
+func (c *Client) ManualImport(ctx context.Context, req ManualImportRequest) error {
+	if err := c.do(ctx, http.MethodPut, "/api/v3/manualimport", nil, req, nil); err != nil {
+		return fmt.Errorf("manual import failed: %w", err)
+	}
+	return nil
+}
+
+// Command queues cmd and returns its status.
+func (c *Client) Command(ctx context.Context, cmd Command) (*CommandStatus, error) {
+	var status CommandStatus
+	if err := c.do(ctx, http.MethodPost, "/api/v3/command", nil, cmd, &status); err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmd.Name, err)
+	}
+	return &status, nil
+}
+
+// GetCommand returns the status of the command with id.
+func (c *Client) GetCommand(ctx context.Context, id int) (*CommandStatus, error) {
+	var status CommandStatus
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/command/%d", id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// do sends a request to path and decodes the JSON response into out when out
+// is not nil. A non-nil body is sent as JSON. Non-2xx responses are returned as
+// *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	_, err := c.send(ctx, method, path, query, body, out)
+	return err
+}
+
+// send is do, also returning the response, whose body is closed, to tell
+// where it came from after redirects. Every request sent is counted in the
+// Usage of the client.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body, out any) (*http.Response, error) {
+	if c.readOnly && method != http.MethodGet {
+		return nil, fmt.Errorf("%w: %s %s", ErrReadOnly, method, path)
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := NewRequest(ctx, method, endpoint, c.apiKey, c.headers, body)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	counts := Counts{Requests: 1, BytesSent: max(req.ContentLength, 0)}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		counts.Errors = 1
+		counts.Latency = time.Since(started)
+		c.usage.record(endpointKey(method, path), counts)
+		return nil, err
+	}
+	received := &countingReader{r: resp.Body}
+	defer func() {
+		resp.Body.Close()
+		counts.BytesReceived = received.n
+		counts.Latency = time.Since(started)
+		if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			counts.Errors = 1
+		}
+		c.usage.record(endpointKey(method, path), counts)
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(received, maxErrorBody))
+		return resp, &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+		}
+	}
+
+	if out == nil {
+		return resp, nil
+	}
+	err = json.NewDecoder(received).Decode(out)
+	return resp, err
+}
@@ -0,0 +1,81 @@
+package sonarr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrReadOnly is returned for requests that would change Sonarr on a client
+// in read-only mode.
+var ErrReadOnly = errors.New("refusing to modify Sonarr in read-only mode")
+
+// maxErrorBody is the number of response bytes kept in an APIError.
+const maxErrorBody = 4096
+
+// APIError is returned when Sonarr answers with a non-2xx status. The Radarr
+// client uses it too, since both share the same API conventions.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Body is the raw response body, truncated to a few kilobytes.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s returned status %d", e.Method, e.Path, e.StatusCode)
+	if detail := e.Message(); detail != "" {
+		msg += ": " + detail
+	}
+	return msg
+}
+
+// Message extracts Sonarr's error message from the body. Sonarr either answers
+// with {"message": "..."} or with a list of validation failures.
+func (e *APIError) Message() string {
+	var single struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(e.Body), &single); err == nil && single.Message != "" {
+		return single.Message
+	}
+
+	var failures []struct {
+		PropertyName string `json:"propertyName"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.Unmarshal([]byte(e.Body), &failures); err == nil && len(failures) > 0 {
+		messages := make([]string, 0, len(failures))
+		for _, f := range failures {
+			messages = append(messages, f.ErrorMessage)
+		}
+		return strings.Join(messages, "; ")
+	}
+
+	return strings.TrimSpace(e.Body)
+}
+
+// IsUnreachable reports whether err means Sonarr could not be talked to at
+// all: the connection failed or timed out, or Sonarr answered with a server
+// error. Cancellation of the caller's context and refused redirects do not
+// count.
+func IsUnreachable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	if isRedirect(err) {
+		return false
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
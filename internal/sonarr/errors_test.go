@@ -0,0 +1,66 @@
+package sonarr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"message":"Series not found"}`, "Series not found"},
+		{`[{"propertyName":"TvdbId","errorMessage":"This series has already been added"},{"propertyName":"Path","errorMessage":"Path is in use"}]`, "This series has already been added; Path is in use"},
+		{"  Bad Gateway\n", "Bad Gateway"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		e := &APIError{Body: tt.body}
+		if got := e.Message(); got != tt.want {
+			t.Errorf("Message() of %q = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestClientReturnsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"boom"}`, http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, "key", srv.Client(), nil).GetSeries(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetSeries error = %v, want an *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message() != "boom" {
+		t.Errorf("APIError = %d %q, want 500 %q", apiErr.StatusCode, apiErr.Message(), "boom")
+	}
+	if !IsUnreachable(err) {
+		t.Errorf("IsUnreachable(%v) = false for a server error", err)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("lookup: %w", context.DeadlineExceeded), true},
+		{&APIError{StatusCode: 404}, false},
+		{&APIError{StatusCode: 502}, true},
+		{errors.New("decode"), false},
+	}
+	for _, tt := range tests {
+		if got := IsUnreachable(tt.err); got != tt.want {
+			t.Errorf("IsUnreachable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sonarr
+
+import "strings"
+
+// qualities are the quality definitions built into Sonarr, whose IDs are the
+// same in every installation.
+var qualities = []Quality{
+	{0, "Unknown"},
+	{1, "SDTV"},
+	{2, "DVD"},
+	{3, "WEBDL-1080p"},
+	{4, "HDTV-720p"},
+	{5, "WEBDL-720p"},
+	{6, "Bluray-720p"},
+	{7, "Bluray-1080p"},
+	{8, "WEBDL-480p"},
+	{9, "HDTV-1080p"},
+	{10, "Raw-HD"},
+	{12, "WEBRip-480p"},
+	{13, "Bluray-480p"},
+	{14, "WEBRip-720p"},
+	{15, "WEBRip-1080p"},
+	{16, "HDTV-2160p"},
+	{17, "WEBRip-2160p"},
+	{18, "WEBDL-2160p"},
+	{19, "Bluray-2160p"},
+	{20, "Bluray-1080p Remux"},
+	{21, "Bluray-2160p Remux"},
+	{22, "Bluray-576p"},
+}
+
+// languages are the languages built into Sonarr.
+var languages = []Language{
+	{0, "Unknown"},
+	{1, "English"},
+	{2, "French"},
+	{3, "Spanish"},
+	{4, "German"},
+	{5, "Italian"},
+	{6, "Danish"},
+	{7, "Dutch"},
+	{8, "Japanese"},
+	{9, "Icelandic"},
+	{10, "Chinese"},
+	{11, "Russian"},
+	{12, "Polish"},
+	{13, "Vietnamese"},
+	{14, "Swedish"},
+	{15, "Norwegian"},
+	{16, "Finnish"},
+	{17, "Turkish"},
+	{18, "Portuguese"},
+	{19, "Flemish"},
+	{20, "Greek"},
+	{21, "Korean"},
+	{22, "Hungarian"},
+	{23, "Hebrew"},
+	{24, "Lithuanian"},
+	{25, "Czech"},
+	{26, "Arabic"},
+	{27, "Hindi"},
+}
+
+// QualityByName returns the Sonarr quality called name, ignoring case.
+func QualityByName(name string) (Quality, bool) {
+	for _, q := range qualities {
+		if strings.EqualFold(q.Name, name) {
+			return q, true
+		}
+	}
+	return Quality{}, false
+}
+
+// LanguageByName returns the Sonarr language called name, ignoring case.
+func LanguageByName(name string) (Language, bool) {
+	for _, l := range languages {
+		if strings.EqualFold(l.Name, name) {
+			return l, true
+		}
+	}
+	return Language{}, false
+}
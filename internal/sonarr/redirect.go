@@ -0,0 +1,95 @@
+package sonarr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRedirects is the number of redirects a request follows, as with the
+// default policy of net/http.
+const maxRedirects = 10
+
+// RedirectError is returned for a redirect the client refuses to follow, and
+// by SystemStatus for a base URL that Sonarr redirects to HTTPS.
+type RedirectError struct {
+	Method     string
+	StatusCode int
+	From, To   string
+	// Reason says why the redirect is refused.
+	Reason string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s %s redirected with status %d to %s: %s", e.Method, e.From, e.StatusCode, e.To, e.Reason)
+}
+
+// WithRedirectPolicy returns a copy of httpClient that follows redirects with
+// CheckRedirect unless it has a policy of its own. A nil httpClient stands
+// for one with DefaultTimeout.
+func WithRedirectPolicy(httpClient *http.Client) *http.Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if httpClient.CheckRedirect != nil {
+		return httpClient
+	}
+	c := *httpClient
+	c.CheckRedirect = CheckRedirect
+	return &c
+}
+
+// CheckRedirect is the redirect policy of the clients. 307 and 308 are
+// followed with the body of the request, which net/http sends again, while a
+// 301, 302 or 303 of anything but a GET is refused, as following it would
+// turn the request into a GET without its body. Redirects from HTTPS to HTTP
+// are refused too, so the API key is never sent in the clear.
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	first, prev := via[0], via[len(via)-1]
+	refuse := func(reason string) error {
+		status := 0
+		if req.Response != nil {
+			status = req.Response.StatusCode
+		}
+		return &RedirectError{Method: first.Method, StatusCode: status, From: redactURL(prev.URL), To: redactURL(req.URL), Reason: reason}
+	}
+	if prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return refuse("refusing to downgrade from HTTPS to HTTP")
+	}
+	if first.Method != http.MethodGet && first.Method != http.MethodHead && req.Method != first.Method {
+		return refuse(fmt.Sprintf("the %s would be sent again as a %s without its body; point the URL at where it redirects to", first.Method, req.Method))
+	}
+	return nil
+}
+
+// CheckUpgrade returns a *RedirectError when resp, the response to a GET of
+// path below baseURL, was served after a redirect from HTTP to HTTPS, so
+// baseURL gets updated before a redirected POST fails. It returns nil
+// otherwise.
+func CheckUpgrade(baseURL, path string, resp *http.Response) error {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme != "http" || resp.Request == nil || resp.Request.URL.Scheme != "https" {
+		return nil
+	}
+	final := *resp.Request.URL
+	final.RawQuery = ""
+	to := strings.TrimSuffix(final.String(), path)
+	status := 0
+	if prev := resp.Request.Response; prev != nil {
+		status = prev.StatusCode
+	}
+	return &RedirectError{Method: http.MethodGet, StatusCode: status, From: baseURL, To: to,
+		Reason: "update the configured URL to it"}
+}
+
+// isRedirect reports whether err is a refused redirect, which is a matter of
+// the configured URL rather than of Sonarr being unreachable.
+func isRedirect(err error) bool {
+	var redirect *RedirectError
+	return errors.As(err, &redirect)
+}
@@ -0,0 +1,130 @@
+package sonarr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// movedServer returns a fake Sonarr that redirects every request below /api
+// with status to the same path below /moved, and the requests that reached
+// /moved.
+func movedServer(t *testing.T, status int) (*httptest.Server, *[]*http.Request, *[]Command) {
+	t.Helper()
+	var reached []*http.Request
+	var bodies []Command
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved"+r.URL.Path, status)
+	})
+	mux.HandleFunc("/moved/", func(w http.ResponseWriter, r *http.Request) {
+		reached = append(reached, r)
+		var cmd Command
+		if r.Method == http.MethodPost {
+			json.NewDecoder(r.Body).Decode(&cmd)
+			bodies = append(bodies, cmd)
+		}
+		fmt.Fprint(w, `{"id":1,"status":"queued"}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &reached, &bodies
+}
+
+func TestRedirectResendsBody(t *testing.T) {
+	for _, status := range []int{http.StatusTemporaryRedirect, http.StatusPermanentRedirect} {
+		srv, reached, bodies := movedServer(t, status)
+		c := NewClient(srv.URL, "key", srv.Client(), nil)
+		if _, err := c.Command(context.Background(), Command{Name: "RescanSeries", SeriesID: 5}); err != nil {
+			t.Errorf("POST redirected with %d: %v", status, err)
+			continue
+		}
+		if len(*reached) != 1 || (*reached)[0].Method != http.MethodPost || (*reached)[0].Header.Get("X-Api-Key") != "key" {
+			t.Errorf("POST redirected with %d reached /moved as %v", status, *reached)
+			continue
+		}
+		if got := (*bodies)[0]; got.Name != "RescanSeries" || got.SeriesID != 5 {
+			t.Errorf("POST redirected with %d arrived with body %+v, want the command", status, got)
+		}
+	}
+}
+
+func TestRedirectRefusesPOST(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther} {
+		srv, reached, _ := movedServer(t, status)
+		c := NewClient(srv.URL, "key", srv.Client(), nil)
+		_, err := c.Command(context.Background(), Command{Name: "RescanSeries"})
+		var redirect *RedirectError
+		if !errors.As(err, &redirect) {
+			t.Errorf("POST redirected with %d: %v, want a *RedirectError", status, err)
+			continue
+		}
+		if redirect.Method != http.MethodPost || redirect.StatusCode != status || !strings.HasSuffix(redirect.To, "/moved/api/v3/command") {
+			t.Errorf("POST redirected with %d: %+v", status, redirect)
+		}
+		if IsUnreachable(err) {
+			t.Errorf("a refused redirect counts as Sonarr being unreachable: %v", err)
+		}
+		if len(*reached) != 0 {
+			t.Errorf("POST redirected with %d was sent again as %s", status, (*reached)[0].Method)
+		}
+
+		// A GET follows the same redirect
+		if _, err := c.GetCommand(context.Background(), 1); err != nil {
+			t.Errorf("GET redirected with %d: %v", status, err)
+		}
+	}
+}
+
+func TestRedirectRefusesDowngrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the downgraded request reached %s with API key %q", r.URL, r.Header.Get("X-Api-Key"))
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer secure.Close()
+
+	_, err := NewClient(secure.URL, "key", secure.Client(), nil).GetSeries(context.Background())
+	var redirect *RedirectError
+	if !errors.As(err, &redirect) || !strings.Contains(redirect.Reason, "downgrade") {
+		t.Fatalf("GetSeries redirected from HTTPS to HTTP: %v, want a refused downgrade", err)
+	}
+	if !strings.HasPrefix(redirect.From, "https://") || !strings.HasPrefix(redirect.To, plain.URL) {
+		t.Errorf("RedirectError from %s to %s", redirect.From, redirect.To)
+	}
+}
+
+func TestSystemStatusSuggestsHTTPS(t *testing.T) {
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version":"4.0.0"}`)
+	}))
+	defer secure.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, secure.URL+r.URL.Path, http.StatusMovedPermanently)
+	}))
+	defer plain.Close()
+
+	_, err := NewClient(plain.URL+"/", "key", secure.Client(), nil).SystemStatus(context.Background())
+	var redirect *RedirectError
+	if !errors.As(err, &redirect) {
+		t.Fatalf("SystemStatus redirected to HTTPS: %v, want a *RedirectError", err)
+	}
+	if redirect.From != plain.URL || redirect.To != secure.URL || redirect.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("RedirectError = %+v, want %s to %s with 301", redirect, plain.URL, secure.URL)
+	}
+	if !strings.Contains(err.Error(), "update the configured URL") {
+		t.Errorf("the error does not suggest updating the URL: %v", err)
+	}
+
+	// Configured with HTTPS, the status check passes
+	if _, err := NewClient(secure.URL, "key", secure.Client(), nil).SystemStatus(context.Background()); err != nil {
+		t.Errorf("SystemStatus over HTTPS: %v", err)
+	}
+}
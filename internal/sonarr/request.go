@@ -0,0 +1,57 @@
+package sonarr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"sonarr-autoimport/internal/version"
+)
+
+// UserAgent identifies the tool in the logs of Sonarr, Radarr and the
+// proxies in front of them.
+func UserAgent() string {
+	return "sonarr-autoimport-go/" + version.String()
+}
+
+// NewRequest returns an API request for endpoint with apiKey, the
+// User-Agent, a new X-Request-Id and then headers set, so headers may
+// override the User-Agent. The trace redacts the values of headers. A
+// non-nil body is sent as JSON. The Sonarr and Radarr clients build their
+// requests with it.
+func NewRequest(ctx context.Context, method, endpoint, apiKey string, headers map[string]string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(withConfiguredHeaders(ctx, headers), method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", UserAgent())
+	req.Header.Set("X-Request-Id", newRequestID())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("X-Api-Key", apiKey)
+	return req, nil
+}
+
+// newRequestID returns a random ID that tells a request apart in the logs.
+func newRequestID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,339 @@
+// Package sonarrtest provides a fake Sonarr v3 API for exercising the Sonarr
+// flow without a real instance. The fake keeps its library in memory, records
+// the imports and commands it receives and can be told to fail requests.
+package sonarrtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// APIKey is the API key the fake accepts.
+const APIKey = "sonarrtest"
+
+// Server is a fake Sonarr listening on a local port. Close stops it.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	series      []sonarr.Series
+	episodes    map[int][]sonarr.Episode
+	lookups     map[string][]sonarr.SeriesLookup
+	lookupEps   map[int][]sonarr.Episode
+	terms       []string
+	rootFolders []sonarr.RootFolder
+	imports     []sonarr.ManualImportRequest
+	preview     []sonarr.ManualImportItem
+	commands    []sonarr.Command
+	failures    map[string]*failure
+	nextID      int
+}
+
+// failure makes requests to an endpoint fail with status, every one of them
+// when remaining is negative.
+type failure struct {
+	status    int
+	remaining int
+}
+
+// New starts a fake Sonarr with an empty library and an accessible root
+// folder "/tv" with 1TB free.
+func New() *Server {
+	s := &Server{
+		episodes:    make(map[int][]sonarr.Episode),
+		lookups:     make(map[string][]sonarr.SeriesLookup),
+		lookupEps:   make(map[int][]sonarr.Episode),
+		rootFolders: []sonarr.RootFolder{{ID: 1, Path: "/tv", Accessible: true, FreeSpace: 1 << 40}},
+		failures:    make(map[string]*failure),
+		nextID:      1,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a client for the fake.
+func (s *Server) Client() *sonarr.Client {
+	return sonarr.NewClient(s.URL, APIKey, s.Server.Client(), nil)
+}
+
+// AddSeries puts series into the library with episodes, assigning the IDs
+// that are 0, and returns it as stored.
+func (s *Server) AddSeries(series sonarr.Series, episodes ...sonarr.Episode) sonarr.Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addSeries(series, episodes)
+}
+
+func (s *Server) addSeries(series sonarr.Series, episodes []sonarr.Episode) sonarr.Series {
+	if series.ID == 0 {
+		series.ID = s.id()
+	}
+	s.series = append(s.series, series)
+	for _, e := range episodes {
+		if e.ID == 0 {
+			e.ID = s.id()
+		}
+		e.SeriesID = series.ID
+		s.episodes[series.ID] = append(s.episodes[series.ID], e)
+	}
+	return series
+}
+
+// id returns the next free ID of a series or an episode.
+func (s *Server) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// AddLookup makes a lookup of term, matched ignoring case, return result. A
+// series added from result gets episodes.
+func (s *Server) AddLookup(term string, result sonarr.SeriesLookup, episodes ...sonarr.Episode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(term)
+	s.lookups[key] = append(s.lookups[key], result)
+	s.lookupEps[result.TvdbID] = episodes
+}
+
+// SetRootFolders replaces the root folders the fake reports.
+func (s *Server) SetRootFolders(folders ...sonarr.RootFolder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rootFolders = folders
+}
+
+// SetPreview replaces what the manual import preview of any folder returns,
+// such as items recorded from a real Sonarr. Manual imports leave the files
+// it lists with rejections alone, as Sonarr does.
+func (s *Server) SetPreview(items ...sonarr.ManualImportItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preview = items
+}
+
+// Fail makes the next times requests with method to path, such as "GET" and
+// "/api/v3/series", fail with status. A negative times fails all of them and
+// a status of 0 stops failing them.
+func (s *Server) Fail(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := method + " " + path
+	if status == 0 {
+		delete(s.failures, key)
+		return
+	}
+	s.failures[key] = &failure{status: status, remaining: times}
+}
+
+// Series returns the series in the library.
+func (s *Server) Series() []sonarr.Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sonarr.Series(nil), s.series...)
+}
+
+// Lookups returns the terms looked up so far.
+func (s *Server) Lookups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.terms...)
+}
+
+// Imports returns the manual imports received so far. Imported episodes
+// have a file from then on.
+func (s *Server) Imports() []sonarr.ManualImportRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sonarr.ManualImportRequest(nil), s.imports...)
+}
+
+// Commands returns the commands received so far.
+func (s *Server) Commands() []sonarr.Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sonarr.Command(nil), s.commands...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Api-Key") != APIKey {
+		http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.failures[r.Method+" "+r.URL.Path]; f != nil && f.remaining != 0 {
+		f.remaining--
+		http.Error(w, fmt.Sprintf(`{"message":"injected failure %d"}`, f.status), f.status)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+	switch {
+	case r.Method == http.MethodGet && path == "/system/status":
+		reply(w, http.StatusOK, sonarr.SystemStatus{AppName: "Sonarr", Version: "3.0.10.1567"})
+	case r.Method == http.MethodGet && path == "/qualityprofile":
+		reply(w, http.StatusOK, []sonarr.QualityProfile{{ID: 1, Name: "Any"}})
+	case r.Method == http.MethodGet && path == "/languageprofile":
+		reply(w, http.StatusOK, []sonarr.LanguageProfile{{ID: 1, Name: "English"}})
+	case r.Method == http.MethodGet && path == "/rootfolder":
+		reply(w, http.StatusOK, s.rootFolders)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/rootfolder/"):
+		s.getRootFolder(w, strings.TrimPrefix(path, "/rootfolder/"))
+	case r.Method == http.MethodGet && path == "/tag":
+		reply(w, http.StatusOK, []sonarr.Tag{})
+	case r.Method == http.MethodGet && path == "/series":
+		reply(w, http.StatusOK, s.series)
+	case r.Method == http.MethodGet && path == "/series/lookup":
+		term := r.URL.Query().Get("term")
+		s.terms = append(s.terms, term)
+		reply(w, http.StatusOK, append([]sonarr.SeriesLookup{}, s.lookups[strings.ToLower(term)]...))
+	case r.Method == http.MethodPost && path == "/series":
+		s.postSeries(w, r)
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/series/"):
+		s.deleteSeries(w, strings.TrimPrefix(path, "/series/"))
+	case r.Method == http.MethodGet && path == "/episode":
+		id, _ := strconv.Atoi(r.URL.Query().Get("seriesId"))
+		reply(w, http.StatusOK, append([]sonarr.Episode{}, s.episodes[id]...))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/episode/"):
+		s.getEpisode(w, strings.TrimPrefix(path, "/episode/"))
+	case r.Method == http.MethodGet && path == "/wanted/missing":
+		s.wantedMissing(w)
+	case r.Method == http.MethodGet && path == "/manualimport":
+		reply(w, http.StatusOK, append([]sonarr.ManualImportItem{}, s.preview...))
+	case r.Method == http.MethodPut && path == "/manualimport":
+		var req sonarr.ManualImportRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		s.imports = append(s.imports, req)
+		s.markImported(req)
+		reply(w, http.StatusOK, struct{}{})
+	case r.Method == http.MethodPost && path == "/command":
+		var cmd sonarr.Command
+		if !decode(w, r, &cmd) {
+			return
+		}
+		s.commands = append(s.commands, cmd)
+		reply(w, http.StatusCreated, sonarr.CommandStatus{ID: len(s.commands), Name: cmd.Name, Status: "queued"})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/command/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(path, "/command/"))
+		if id < 1 || id > len(s.commands) {
+			http.NotFound(w, r)
+			return
+		}
+		reply(w, http.StatusOK, sonarr.CommandStatus{ID: id, Name: s.commands[id-1].Name, Status: "completed", Result: "successful"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// markImported gives the episodes of the files of req a file, numbered by
+// the count of imports, unless the preview rejects the file.
+func (s *Server) markImported(req sonarr.ManualImportRequest) {
+	for _, file := range req.Files {
+		if slices.ContainsFunc(s.preview, func(item sonarr.ManualImportItem) bool {
+			return item.Path == file.Path && len(item.Rejections) > 0
+		}) {
+			continue
+		}
+		episodes := s.episodes[file.SeriesID]
+		for i := range episodes {
+			if slices.Contains(file.Episodes, episodes[i].ID) {
+				episodes[i].HasFile = true
+				episodes[i].EpisodeFileID = len(s.imports)
+			}
+		}
+	}
+}
+
+// getEpisode replies with the episode with id, which is not found when no
+// series has it.
+func (s *Server) getEpisode(w http.ResponseWriter, id string) {
+	for _, episodes := range s.episodes {
+		for _, e := range episodes {
+			if strconv.Itoa(e.ID) == id {
+				reply(w, http.StatusOK, e)
+				return
+			}
+		}
+	}
+	http.Error(w, `{"message":"episode not found"}`, http.StatusNotFound)
+}
+
+// getRootFolder replies with the root folder with id.
+func (s *Server) getRootFolder(w http.ResponseWriter, id string) {
+	for _, f := range s.rootFolders {
+		if strconv.Itoa(f.ID) == id {
+			reply(w, http.StatusOK, f)
+			return
+		}
+	}
+	http.Error(w, `{"message":"root folder not found"}`, http.StatusNotFound)
+}
+
+// postSeries adds the series in the body of r like Sonarr does, refusing a
+// second series with the same TVDB ID.
+func (s *Server) postSeries(w http.ResponseWriter, r *http.Request) {
+	var series sonarr.Series
+	if !decode(w, r, &series) {
+		return
+	}
+	for _, existing := range s.series {
+		if existing.TvdbID == series.TvdbID {
+			reply(w, http.StatusBadRequest, []map[string]string{{"propertyName": "TvdbId", "errorMessage": "This series has already been added"}})
+			return
+		}
+	}
+	series.ID = 0
+	reply(w, http.StatusCreated, s.addSeries(series, s.lookupEps[series.TvdbID]))
+}
+
+func (s *Server) deleteSeries(w http.ResponseWriter, id string) {
+	for i, series := range s.series {
+		if strconv.Itoa(series.ID) == id {
+			s.series = append(s.series[:i], s.series[i+1:]...)
+			delete(s.episodes, series.ID)
+			reply(w, http.StatusOK, struct{}{})
+			return
+		}
+	}
+	http.Error(w, `{"message":"series not found"}`, http.StatusNotFound)
+}
+
+// wantedMissing answers with the monitored episodes without a file on a
+// single page.
+func (s *Server) wantedMissing(w http.ResponseWriter) {
+	var missing []sonarr.Episode
+	for _, series := range s.series {
+		for _, e := range s.episodes[series.ID] {
+			if e.Monitored && !e.HasFile {
+				missing = append(missing, e)
+			}
+		}
+	}
+	reply(w, http.StatusOK, sonarr.Page[sonarr.Episode]{Page: 1, PageSize: len(missing), TotalRecords: len(missing), Records: missing})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf(`{"message":%q}`, err.Error()), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,165 @@
+package sonarr
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// maxTraceBody is the number of body bytes shown in a trace line.
+const maxTraceBody = 2048
+
+// redactedHeaders carry credentials and are never logged.
+var redactedHeaders = map[string]bool{
+	"X-Api-Key":           true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// secretSuffixes end the names of headers that are taken for credentials
+// and never logged either, such as X-Plex-Token or X-Gotify-Key, so a header
+// nobody thought of is redacted rather than shown.
+var secretSuffixes = []string{"-Token", "-Key", "-Secret", "-Password", "-Auth", "-Authorization"}
+
+// secretHeader reports whether the header name, in canonical form, carries
+// credentials.
+func secretHeader(name string) bool {
+	if redactedHeaders[name] {
+		return true
+	}
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredHeadersKey is the context key of the names of the headers that
+// NewRequest set from the configuration.
+type configuredHeadersKey struct{}
+
+// withConfiguredHeaders returns ctx with the names of headers, the headers of
+// a request set from the configuration, which the trace redacts as they
+// usually carry the credentials of a proxy.
+func withConfiguredHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	names := make(map[string]bool, len(headers))
+	for name := range headers {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	return context.WithValue(ctx, configuredHeadersKey{}, names)
+}
+
+// traceTransport logs every request and response at trace level. The lines
+// of a request with an X-Request-Id start with the ID, so its response can be
+// told apart from those of concurrent requests.
+type traceTransport struct {
+	base http.RoundTripper
+	log  *logging.Logger
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.log.Enabled(logging.LevelTrace) {
+		return t.base.RoundTrip(req)
+	}
+
+	target := redactURL(req.URL)
+	tag := ""
+	if id := req.Header.Get("X-Request-Id"); id != "" {
+		tag = "[" + id + "] "
+	}
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	t.log.Tracef("%s--> %s %s %s%s", tag, req.Method, target, formatHeaders(req.Header, configuredHeaders(req.Context())), formatBody(reqBody))
+
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		t.log.Tracef("%s<-- %s %s failed after %v: %v", tag, req.Method, target, latency, err)
+		return nil, err
+	}
+
+	// The body is read completely so it can be logged and still be decoded
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if readErr != nil {
+		t.log.Tracef("%s<-- %d %s %s (%v): reading body failed: %v", tag, resp.StatusCode, req.Method, target, latency, readErr)
+		return resp, nil
+	}
+	t.log.Tracef("%s<-- %d %s %s (%v)%s", tag, resp.StatusCode, req.Method, target, latency, formatBody(respBody))
+	return resp, nil
+}
+
+// redactURL hides an API key passed in the query string.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if strings.EqualFold(key, "apikey") {
+			query.Set(key, "REDACTED")
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// configuredHeaders returns the names withConfiguredHeaders added to ctx.
+func configuredHeaders(ctx context.Context) map[string]bool {
+	names, _ := ctx.Value(configuredHeadersKey{}).(map[string]bool)
+	return names
+}
+
+// formatHeaders renders h on one line with credentials and the configured
+// headers redacted.
+func formatHeaders(h http.Header, configured map[string]bool) string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(h[key], ", ")
+		if name := http.CanonicalHeaderKey(key); secretHeader(name) || configured[name] {
+			value = "REDACTED"
+		}
+		parts = append(parts, key+": "+value)
+	}
+	return "[" + strings.Join(parts, "; ") + "]"
+}
+
+// formatBody shortens body for a trace line.
+func formatBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxTraceBody {
+		return " " + string(body[:maxTraceBody]) + "... (" + strconv.Itoa(len(body)) + " bytes)"
+	}
+	return " " + string(body)
+}
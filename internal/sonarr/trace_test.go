@@ -0,0 +1,62 @@
+package sonarr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+func TestTraceRedactsHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version":"4.0.0"}`)
+	}))
+	defer srv.Close()
+	var out bytes.Buffer
+	c := NewClient(srv.URL, "the-api-key", nil, logging.New(&out, logging.LevelTrace))
+	c.SetHeaders(map[string]string{
+		"proxy-authorization": "Basic cHJveHk6cGFzcw==",
+		"X-Auth-User":         "proxy-user",
+		"CF-Access-Client-Id": "client-id",
+	})
+	if _, err := c.SystemStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := out.String()
+	for _, secret := range []string{"the-api-key", "cHJveHk6cGFzcw==", "proxy-user", "client-id"} {
+		if strings.Contains(trace, secret) {
+			t.Errorf("the trace shows %q:\n%s", secret, trace)
+		}
+	}
+	for _, shown := range []string{"Proxy-Authorization: REDACTED", "X-Auth-User: REDACTED", "Cf-Access-Client-Id: REDACTED", "User-Agent: " + UserAgent()} {
+		if !strings.Contains(trace, shown) {
+			t.Errorf("the trace lacks %q:\n%s", shown, trace)
+		}
+	}
+}
+
+func TestFormatHeadersDeniesCredentials(t *testing.T) {
+	h := http.Header{}
+	for _, name := range []string{"X-Api-Key", "Authorization", "Proxy-Authorization", "Cookie", "X-Plex-Token", "X-Gotify-Key", "Cf-Access-Client-Secret", "X-Proxy-Password", "X-Remote-Auth"} {
+		h.Set(name, "secret-"+name)
+	}
+	h.Set("Accept", "application/json")
+	h.Set("X-Request-Id", "0123abcd")
+	h.Set("X-Keyboard", "qwerty")
+
+	line := formatHeaders(h, nil)
+	if strings.Contains(line, "secret-") {
+		t.Errorf("formatHeaders shows a credential: %s", line)
+	}
+	for _, shown := range []string{"Accept: application/json", "X-Request-Id: 0123abcd", "X-Keyboard: qwerty"} {
+		if !strings.Contains(line, shown) {
+			t.Errorf("formatHeaders lacks %q: %s", shown, line)
+		}
+	}
+}
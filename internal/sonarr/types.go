@@ -0,0 +1,219 @@
+package sonarr
+
+// Series is a series in the Sonarr library.
+type Series struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	SortTitle string `json:"sortTitle"`
+	// AlternateTitles are the other names of the series known to Sonarr,
+	// such as its English title.
+	AlternateTitles   []AlternateTitle `json:"alternateTitles,omitempty"`
+	Status            string           `json:"status"`
+	Overview          string           `json:"overview"`
+	Network           string           `json:"network"`
+	AirTime           string           `json:"airTime"`
+	Images            []Image          `json:"images"`
+	Seasons           []Season         `json:"seasons"`
+	Year              int              `json:"year"`
+	Path              string           `json:"path"`
+	QualityProfileID  int              `json:"qualityProfileId"`
+	LanguageProfileID int              `json:"languageProfileId"`
+	SeasonFolder      bool             `json:"seasonFolder"`
+	Monitored         bool             `json:"monitored"`
+	UseSceneNumbering bool             `json:"useSceneNumbering"`
+	Runtime           int              `json:"runtime"`
+	TvdbID            int              `json:"tvdbId"`
+	TvRageID          int              `json:"tvRageId"`
+	TvMazeID          int              `json:"tvMazeId"`
+	FirstAired        string           `json:"firstAired"`
+	SeriesType        string           `json:"seriesType"`
+	CleanTitle        string           `json:"cleanTitle"`
+	ImdbID            string           `json:"imdbId"`
+	TitleSlug         string           `json:"titleSlug"`
+	RootFolderPath    string           `json:"rootFolderPath"`
+	Genres            []string         `json:"genres"`
+	Tags              []int            `json:"tags"`
+	Added             string           `json:"added"`
+	AddOptions        AddOptions       `json:"addOptions"`
+}
+
+// AlternateTitle is another name of a series, for all seasons when
+// SeasonNumber is -1.
+type AlternateTitle struct {
+	Title        string `json:"title"`
+	SeasonNumber int    `json:"seasonNumber"`
+}
+
+// Image is a poster, banner or fanart reference.
+type Image struct {
+	CoverType string `json:"coverType"`
+	URL       string `json:"url"`
+}
+
+// Season is a season entry of a series.
+type Season struct {
+	SeasonNumber int  `json:"seasonNumber"`
+	Monitored    bool `json:"monitored"`
+}
+
+// AddOptions controls what Sonarr does right after a series is added.
+type AddOptions struct {
+	IgnoreEpisodesWithFiles    bool `json:"ignoreEpisodesWithFiles"`
+	IgnoreEpisodesWithoutFiles bool `json:"ignoreEpisodesWithoutFiles"`
+	SearchForMissingEpisodes   bool `json:"searchForMissingEpisodes"`
+}
+
+// SeriesLookup is a search result from /series/lookup.
+type SeriesLookup struct {
+	Title      string   `json:"title"`
+	SortTitle  string   `json:"sortTitle"`
+	Status     string   `json:"status"`
+	Overview   string   `json:"overview"`
+	Network    string   `json:"network"`
+	Images     []Image  `json:"images"`
+	Seasons    []Season `json:"seasons"`
+	Year       int      `json:"year"`
+	TvdbID     int      `json:"tvdbId"`
+	TitleSlug  string   `json:"titleSlug"`
+	Genres     []string `json:"genres"`
+	FirstAired string   `json:"firstAired"`
+}
+
+// ManualImportRequest is the body of a manual import call.
+type ManualImportRequest struct {
+	Files []ManualImportFile `json:"files"`
+	// ImportMode is "move" or "copy". Sonarr's own setting applies when it is
+	// empty.
+	ImportMode string `json:"importMode,omitempty"`
+}
+
+// ManualImportFile is a single file to import and the episodes it contains.
+type ManualImportFile struct {
+	Path         string   `json:"path"`
+	SeriesID     int      `json:"seriesId"`
+	SeasonNumber int      `json:"seasonNumber"`
+	Episodes     []int    `json:"episodes"`
+	Quality      Quality  `json:"quality"`
+	Language     Language `json:"language"`
+}
+
+// ManualImportItem is how Sonarr itself reads a file of a folder, as its
+// manual import screen shows it before anything is imported. Series is nil
+// and Episodes empty when Sonarr cannot tell them, and Rejections tell why
+// Sonarr would not import the file.
+type ManualImportItem struct {
+	Path         string       `json:"path"`
+	RelativePath string       `json:"relativePath"`
+	Name         string       `json:"name"`
+	Series       *Series      `json:"series"`
+	SeasonNumber int          `json:"seasonNumber"`
+	Episodes     []Episode    `json:"episodes"`
+	Quality      QualityModel `json:"quality"`
+	ReleaseGroup string       `json:"releaseGroup"`
+	Rejections   []Rejection  `json:"rejections"`
+}
+
+// QualityModel is a quality as Sonarr attaches it to a file.
+type QualityModel struct {
+	Quality Quality `json:"quality"`
+}
+
+// Rejection is a reason Sonarr gives for not importing a file, such as
+// "Sample" or "Unknown Series". Type is "permanent" or "temporary".
+type Rejection struct {
+	Reason string `json:"reason"`
+	Type   string `json:"type"`
+}
+
+// Quality identifies a Sonarr quality definition.
+type Quality struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Language identifies a Sonarr language.
+type Language struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Episode is an episode of a series.
+type Episode struct {
+	ID            int    `json:"id"`
+	SeriesID      int    `json:"seriesId"`
+	EpisodeNumber int    `json:"episodeNumber"`
+	SeasonNumber  int    `json:"seasonNumber"`
+	Title         string `json:"title"`
+	AirDate       string `json:"airDate"`
+	Overview      string `json:"overview"`
+	HasFile       bool   `json:"hasFile"`
+	EpisodeFileID int    `json:"episodeFileId"`
+	Monitored     bool   `json:"monitored"`
+}
+
+// Page is one page of a paged list such as /wanted/missing.
+type Page[T any] struct {
+	Page         int `json:"page"`
+	PageSize     int `json:"pageSize"`
+	TotalRecords int `json:"totalRecords"`
+	Records      []T `json:"records"`
+}
+
+// SystemStatus is the subset of /system/status the tool uses.
+type SystemStatus struct {
+	AppName string `json:"appName"`
+	Version string `json:"version"`
+}
+
+// QualityProfile is a Sonarr quality profile.
+type QualityProfile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// LanguageProfile is a Sonarr v3 language profile.
+type LanguageProfile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// RootFolder is a library folder configured in Sonarr.
+type RootFolder struct {
+	ID         int    `json:"id"`
+	Path       string `json:"path"`
+	Accessible bool   `json:"accessible"`
+	FreeSpace  int64  `json:"freeSpace"`
+	// UnmappedFolders are the folders in the root folder that no series of
+	// the library uses. Sonarr v4 only lists them for a single root folder.
+	UnmappedFolders []UnmappedFolder `json:"unmappedFolders,omitempty"`
+}
+
+// UnmappedFolder is a folder of a root folder without a series.
+type UnmappedFolder struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Tag is a label that can be attached to series.
+type Tag struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+// Command is a Sonarr command to run, such as RefreshSeries for SeriesID or
+// DownloadedEpisodesScan for Path.
+type Command struct {
+	Name     string `json:"name"`
+	SeriesID int    `json:"seriesId,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+// CommandStatus is the state of a command Sonarr queued. Status goes from
+// "queued" through "started" to "completed" or "failed".
+type CommandStatus struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Result  string `json:"result,omitempty"`
+	Message string `json:"message,omitempty"`
+}
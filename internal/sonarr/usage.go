@@ -0,0 +1,120 @@
+package sonarr
+
+import (
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Endpoints of Usage.Endpoints that summaries single out.
+const (
+	EndpointLookup    = "GET /api/v3/series/lookup"
+	EndpointAddSeries = "POST /api/v3/series"
+)
+
+// Counts are the requests to Sonarr, the bytes sent and received for them
+// and the time they took from sending to reading the last byte.
+type Counts struct {
+	Requests int `json:"requests"`
+	// Errors counts the requests that failed or got a status other than
+	// 2xx.
+	Errors        int           `json:"errors,omitempty"`
+	BytesSent     int64         `json:"bytesSent"`
+	BytesReceived int64         `json:"bytesReceived"`
+	Latency       time.Duration `json:"latency"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Requests += o.Requests
+	c.Errors += o.Errors
+	c.BytesSent += o.BytesSent
+	c.BytesReceived += o.BytesReceived
+	c.Latency += o.Latency
+}
+
+func (c Counts) sub(o Counts) Counts {
+	return Counts{
+		Requests:      c.Requests - o.Requests,
+		Errors:        c.Errors - o.Errors,
+		BytesSent:     c.BytesSent - o.BytesSent,
+		BytesReceived: c.BytesReceived - o.BytesReceived,
+		Latency:       c.Latency - o.Latency,
+	}
+}
+
+// Usage is what a Client asked of Sonarr: the totals and the counts of every
+// endpoint, keyed by method and path with IDs as "{id}", such as
+// "GET /api/v3/episode/{id}".
+type Usage struct {
+	Counts
+	Endpoints map[string]Counts `json:"endpoints,omitempty"`
+}
+
+// Add adds the counts of o to u.
+func (u *Usage) Add(o Usage) {
+	u.Counts.add(o.Counts)
+	for endpoint, c := range o.Endpoints {
+		if u.Endpoints == nil {
+			u.Endpoints = make(map[string]Counts)
+		}
+		sum := u.Endpoints[endpoint]
+		sum.add(c)
+		u.Endpoints[endpoint] = sum
+	}
+}
+
+// Since returns what was asked of Sonarr after before, an earlier Usage of
+// the same clients.
+func (u Usage) Since(before Usage) Usage {
+	out := Usage{Counts: u.Counts.sub(before.Counts)}
+	for endpoint, c := range u.Endpoints {
+		if c = c.sub(before.Endpoints[endpoint]); c.Requests > 0 {
+			if out.Endpoints == nil {
+				out.Endpoints = make(map[string]Counts)
+			}
+			out.Endpoints[endpoint] = c
+		}
+	}
+	return out
+}
+
+// usageCounter counts the requests of a Client as they finish.
+type usageCounter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+// idSegment matches the numeric path segments that endpoint keys replace.
+var idSegment = regexp.MustCompile(`/\d+(/|$)`)
+
+// endpointKey returns the key of the request to path in Usage.Endpoints.
+func endpointKey(method, path string) string {
+	return method + " " + idSegment.ReplaceAllString(path, "/{id}$1")
+}
+
+func (u *usageCounter) record(endpoint string, c Counts) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.usage.Add(Usage{Counts: c, Endpoints: map[string]Counts{endpoint: c}})
+}
+
+func (u *usageCounter) snapshot() Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var out Usage
+	out.Add(u.usage)
+	return out
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
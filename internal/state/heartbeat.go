@@ -0,0 +1,60 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HeartbeatFileName is the name of the heartbeat inside the state directory.
+const HeartbeatFileName = "heartbeat.json"
+
+// Heartbeat records the end of the latest scan cycle of a daemon, for
+// healthchecks of daemons without a status listener.
+type Heartbeat struct {
+	Time    time.Time `json:"time"`
+	Failed  bool      `json:"failed"`
+	Summary string    `json:"summary"`
+	PID     int       `json:"pid"`
+}
+
+// HeartbeatPath returns the heartbeat file of the state directory dir.
+func HeartbeatPath(dir string) string {
+	return filepath.Join(dir, HeartbeatFileName)
+}
+
+// WriteHeartbeat replaces the heartbeat at path. It is written to a temporary
+// file first, so readers never see a partial heartbeat.
+func WriteHeartbeat(path string, hb Heartbeat) error {
+	data, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// ReadHeartbeat reads the heartbeat at path.
+func ReadHeartbeat(path string) (Heartbeat, error) {
+	var hb Heartbeat
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hb, err
+	}
+	err = json.Unmarshal(data, &hb)
+	return hb, err
+}
@@ -0,0 +1,68 @@
+// Package state manages the files the tool keeps in its state directory.
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockFileName is the name of the instance lock inside the state directory.
+const LockFileName = "sonarr-autoimport.lock"
+
+// ErrLocked is returned by AcquireLock when another process holds the lock.
+var ErrLocked = errors.New("another instance is running")
+
+// Lock is an advisory lock on the state directory held for the lifetime of
+// the process.
+type Lock struct {
+	file *os.File
+}
+
+// AcquireLock takes the instance lock in dir without blocking. The lock file
+// records the PID of the holder so the error can name it.
+func AcquireLock(dir string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	path := filepath.Join(dir, LockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errWouldBlock) {
+			if pid := readPID(path); pid != 0 {
+				return nil, fmt.Errorf("%w (pid %d, lock %s)", ErrLocked, pid, path)
+			}
+			return nil, fmt.Errorf("%w (lock %s)", ErrLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{file: file}, nil
+}
+
+// Release drops the lock.
+func (l *Lock) Release() error {
+	unlockFile(l.file)
+	return l.file.Close()
+}
+
+func readPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
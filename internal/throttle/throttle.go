@@ -0,0 +1,130 @@
+// Package throttle limits how hard the local file reads of the tool, such as
+// fingerprinting, load the disks of the downloads folder.
+package throttle
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throttle limits the rate of the reads of the files opened through it and
+// the number of those files open at once, across every goroutine that
+// shares it. A nil *Throttle limits nothing.
+type Throttle struct {
+	// rate is the most bytes per second, 0 for any number.
+	rate int64
+	// slots holds a token per open file; it is nil without a limit.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// next is when the bytes read so far are paid for at rate.
+	next time.Time
+}
+
+// New returns a Throttle reading at most rate bytes per second from at most
+// readers files at once. 0 leaves either unlimited.
+func New(rate int64, readers int) *Throttle {
+	t := &Throttle{rate: max(rate, 0)}
+	if readers > 0 {
+		t.slots = make(chan struct{}, readers)
+	}
+	return t
+}
+
+// Open opens the file at path for reading once fewer than the maximum
+// number of readers have a file open. It fails with the error of ctx when
+// ctx is done first.
+func (t *Throttle) Open(ctx context.Context, path string) (*File, error) {
+	release := func() {}
+	if t != nil && t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+			release = func() { <-t.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &File{file: f, ctx: ctx, throttle: t, release: release}, nil
+}
+
+// wait blocks until n more bytes may be read, or ctx is done.
+func (t *Throttle) wait(ctx context.Context, n int) error {
+	if t == nil || t.rate == 0 || n <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	t.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// File is a file opened through a Throttle. It counts the bytes read from
+// it.
+type File struct {
+	file     *os.File
+	ctx      context.Context
+	throttle *Throttle
+	release  func()
+	read     atomic.Int64
+}
+
+// Read implements io.Reader.
+func (f *File) Read(p []byte) (int, error) {
+	if err := f.throttle.wait(f.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := f.file.Read(p)
+	f.read.Add(int64(n))
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.throttle.wait(f.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := f.file.ReadAt(p, off)
+	f.read.Add(int64(n))
+	return n, err
+}
+
+// Stat returns the FileInfo of the file.
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+// BytesRead returns the number of bytes read from the file so far.
+func (f *File) BytesRead() int64 {
+	return f.read.Load()
+}
+
+// Close closes the file and frees its reader slot.
+func (f *File) Close() error {
+	err := f.file.Close()
+	f.release()
+	f.release = func() {}
+	return err
+}
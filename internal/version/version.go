@@ -0,0 +1,20 @@
+// Package version reports the version of the running binary.
+package version
+
+import "runtime/debug"
+
+// Version can be set at build time with
+// -ldflags "-X sonarr-autoimport/internal/version.Version=v1.2.3".
+var Version = ""
+
+// String returns the build version, falling back to the module version
+// recorded by the Go toolchain and then to "dev".
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
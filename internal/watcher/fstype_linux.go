@@ -0,0 +1,24 @@
+package watcher
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2) for filesystems where inotify only
+// sees changes made by this host.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+}
+
+// networkFilesystem reports whether path is on a network filesystem and its
+// name.
+func networkFilesystem(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystems[uint32(st.Type)]
+	return name, ok
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watcher
+
+// networkFilesystem is only implemented on Linux; elsewhere every filesystem
+// is assumed to deliver notifications.
+func networkFilesystem(path string) (string, bool) {
+	return "", false
+}
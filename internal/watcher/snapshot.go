@@ -0,0 +1,277 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// SnapshotFileName is the name of the index file of snapshot mode in the
+// state directory.
+const SnapshotFileName = "snapshot.json"
+
+// Snapshot reports new and changed files under a directory tree by comparing
+// it with an index of the previous cycle, for network filesystems that do not
+// deliver notifications. Only directories whose modification time changed are
+// read; the others are only stat'ed, like the files that are still changing.
+// A file is reported once its size and modification time stayed the same for
+// a whole cycle. Files rewritten in place in a directory that did not change
+// are missed, which the full rescans make up for.
+type Snapshot struct {
+	root     string
+	interval time.Duration
+	filter   func(path string) bool
+	path     string
+	log      *logging.Logger
+	index    *snapshotIndex
+}
+
+// snapshotIndex is the state of the tree after a cycle, keyed by paths
+// relative to the root.
+type snapshotIndex struct {
+	Dirs  map[string]*snapshotDir  `json:"dirs"`
+	Files map[string]*snapshotFile `json:"files"`
+}
+
+// snapshotDir holds the modification time of a directory and the names of
+// its subdirectories and of the files it has that pass the filter.
+type snapshotDir struct {
+	ModTime int64    `json:"modTime"`
+	Dirs    []string `json:"dirs,omitempty"`
+	Files   []string `json:"files,omitempty"`
+}
+
+type snapshotFile struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"modTime"`
+	// Pending is set for a new or changed file until it is reported.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// snapshotCycle is the state of one cycle: the directories that exist, the
+// files that were recorded by it and, for the debug log, the number of
+// directories stat'ed and read.
+type snapshotCycle struct {
+	seen, fresh   map[string]bool
+	baseline      bool
+	checked, read int
+}
+
+// NewSnapshot returns a Snapshot of root that runs a cycle every interval.
+// Only files for which filter returns true are reported. The index is kept in
+// the file at path, so files that arrived while the daemon was stopped are
+// reported by the first cycle; without a path, or when the file cannot be
+// read, the first cycle only records the tree.
+func NewSnapshot(root string, interval time.Duration, filter func(path string) bool, path string, log *logging.Logger) (*Snapshot, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	s := &Snapshot{root: root, interval: interval, filter: filter, path: path, log: log}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		log.Warnf("Failed to read the snapshot index, starting over: %v", err)
+	default:
+		index := &snapshotIndex{}
+		if err := json.Unmarshal(data, index); err != nil || index.Dirs == nil {
+			log.Warnf("Discarding the invalid snapshot index %s: %v", path, err)
+		} else {
+			if index.Files == nil {
+				index.Files = make(map[string]*snapshotFile)
+			}
+			s.index = index
+		}
+	}
+	return s, nil
+}
+
+// Run delivers batches of new and changed files on out until ctx is
+// cancelled. The first cycle runs right away.
+func (s *Snapshot) Run(ctx context.Context, out chan<- []string) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if ready := s.cycle(); len(ready) > 0 {
+			select {
+			case out <- ready:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// cycle updates the index from the tree and returns the files to report, in
+// order.
+func (s *Snapshot) cycle() []string {
+	started := time.Now()
+	c := &snapshotCycle{seen: make(map[string]bool), fresh: make(map[string]bool), baseline: s.index == nil}
+	if c.baseline {
+		s.index = &snapshotIndex{Dirs: make(map[string]*snapshotDir), Files: make(map[string]*snapshotFile)}
+	}
+	changed := s.walk(".", c)
+	for rel := range s.index.Dirs {
+		if !c.seen[rel] {
+			s.forgetDir(rel)
+			changed = true
+		}
+	}
+
+	var ready []string
+	for rel, f := range s.index.Files {
+		// Files recorded by this cycle wait for the next one to settle
+		if !f.Pending || c.fresh[rel] || !c.seen[filepath.Dir(rel)] {
+			continue
+		}
+		path := filepath.Join(s.root, rel)
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			// Gone since the directory was read; its next change updates it
+			continue
+		case info.Size() == f.Size && info.ModTime().UnixNano() == f.ModTime:
+			ready = append(ready, path)
+			f.Pending = false
+		default:
+			f.Size, f.ModTime = info.Size(), info.ModTime().UnixNano()
+		}
+		changed = true
+	}
+	sort.Strings(ready)
+
+	s.log.Debugf("Snapshot cycle: %d directories checked, %d read, %d file(s) ready in %v",
+		c.checked, c.read, len(ready), time.Since(started).Round(time.Millisecond))
+	if changed {
+		s.save()
+	}
+	return ready
+}
+
+// walk updates the index for the directory rel and those below it and reports
+// whether anything changed. A directory whose modification time is the one in
+// the index keeps its entries, so only its subdirectories are stat'ed. New
+// and changed files are marked pending, except while recording the baseline.
+func (s *Snapshot) walk(rel string, c *snapshotCycle) bool {
+	dir := filepath.Join(s.root, rel)
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	c.seen[rel] = true
+	c.checked++
+
+	entry := s.index.Dirs[rel]
+	changed := false
+	if entry == nil || entry.ModTime != info.ModTime().UnixNano() {
+		entry, changed = s.readDir(rel, dir, info.ModTime().UnixNano(), c), true
+		c.read++
+	}
+	for _, name := range entry.Dirs {
+		if s.walk(filepath.Join(rel, name), c) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// readDir lists the directory rel at dir, records it in the index with
+// modTime and returns its entry. Files that appeared or changed are marked
+// pending, and those that are gone are dropped.
+func (s *Snapshot) readDir(rel, dir string, modTime int64, c *snapshotCycle) *snapshotDir {
+	entry := &snapshotDir{ModTime: modTime}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.log.Warnf("Failed to read %s: %v", dir, err)
+		entry.ModTime = 0 // read it again next cycle
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			entry.Dirs = append(entry.Dirs, e.Name())
+			continue
+		}
+		if !s.filter(path) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entry.Files = append(entry.Files, e.Name())
+		key := filepath.Join(rel, e.Name())
+		size, mtime := info.Size(), info.ModTime().UnixNano()
+		if f := s.index.Files[key]; f != nil && f.Size == size && f.ModTime == mtime {
+			continue
+		}
+		s.index.Files[key] = &snapshotFile{Size: size, ModTime: mtime, Pending: !c.baseline}
+		c.fresh[key] = true
+	}
+
+	if old := s.index.Dirs[rel]; old != nil {
+		for _, name := range old.Files {
+			if !slices.Contains(entry.Files, name) {
+				delete(s.index.Files, filepath.Join(rel, name))
+			}
+		}
+	}
+	s.index.Dirs[rel] = entry
+	return entry
+}
+
+// forgetDir drops the directory rel, which no longer exists, and its files
+// from the index.
+func (s *Snapshot) forgetDir(rel string) {
+	if entry := s.index.Dirs[rel]; entry != nil {
+		for _, name := range entry.Files {
+			delete(s.index.Files, filepath.Join(rel, name))
+		}
+	}
+	delete(s.index.Dirs, rel)
+}
+
+// save writes the index to a temporary file first, so it is never left half
+// written. Failures are logged, as the index only saves work.
+func (s *Snapshot) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.Marshal(s.index)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	}
+	var tmp *os.File
+	if err == nil {
+		tmp, err = os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	}
+	if err == nil {
+		_, err = tmp.Write(data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), s.path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		s.log.Warnf("Failed to save the snapshot index: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package watcher reports finished files under a directory tree using
+// filesystem notifications or, with Snapshot, by comparing the tree with an
+// index of its previous state.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// ErrUnsupported is returned by New when the directory lives on a filesystem
+// that does not deliver change notifications reliably.
+var ErrUnsupported = errors.New("filesystem notifications are not supported")
+
+// Watcher watches a directory tree and batches files that stopped changing.
+type Watcher struct {
+	root     string
+	debounce time.Duration
+	filter   func(path string) bool
+	log      *logging.Logger
+	fsw      *fsnotify.Watcher
+}
+
+// pendingFile is a file seen in an event that has not settled yet.
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	// checked is set once the size has been recorded after the last event.
+	checked bool
+}
+
+// New starts watching root and every directory below it. Only files for which
+// filter returns true are reported.
+func New(root string, debounce time.Duration, filter func(path string) bool, log *logging.Logger) (*Watcher, error) {
+	if name, network := networkFilesystem(root); network {
+		return nil, fmt.Errorf("%w on %s (%s)", ErrUnsupported, root, name)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	w := &Watcher{
+		root:     root,
+		debounce: debounce,
+		filter:   filter,
+		log:      log,
+		fsw:      fsw,
+	}
+	if _, err := w.addTree(root); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// addTree adds dir and its subdirectories to the watch set and returns the
+// matching files already inside them, which matters for directories that are
+// moved in as a whole.
+func (w *Watcher) addTree(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		if w.filter(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Run delivers batches of settled files on out until ctx is cancelled. A file
+// is settled once its directory has been quiet for the debounce period and its
+// size and modification time did not change over another period.
+func (w *Watcher) Run(ctx context.Context, out chan<- []string) error {
+	pending := make(map[string]*pendingFile)
+	timers := make(map[string]*time.Timer)
+	fire := make(chan string)
+
+	arm := func(dir string) {
+		if timer, ok := timers[dir]; ok {
+			timer.Stop()
+		}
+		timers[dir] = time.AfterFunc(w.debounce, func() {
+			select {
+			case fire <- dir:
+			case <-ctx.Done():
+			}
+		})
+	}
+	track := func(path string) {
+		if p, ok := pending[path]; ok {
+			p.checked = false
+		} else {
+			pending[path] = &pendingFile{}
+		}
+		arm(filepath.Dir(path))
+	}
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.handleEvent(event, pending, track)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.log.Warnf("Watch event queue overflowed, some files will only be picked up by the next full scan")
+				continue
+			}
+			w.log.Warnf("Watch error: %v", err)
+
+		case dir := <-fire:
+			delete(timers, dir)
+			ready := w.settle(dir, pending)
+			if _, waiting := timers[dir]; !waiting && w.hasPending(dir, pending) {
+				arm(dir)
+			}
+			if len(ready) == 0 {
+				continue
+			}
+			select {
+			case out <- ready:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(event fsnotify.Event, pending map[string]*pendingFile, track func(string)) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		delete(pending, event.Name)
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if !event.Has(fsnotify.Create) {
+			return
+		}
+		files, err := w.addTree(event.Name)
+		if err != nil {
+			w.log.Warnf("Failed to watch new directory %s: %v", event.Name, err)
+		}
+		w.log.Debugf("Watching new directory: %s", event.Name)
+		for _, file := range files {
+			track(file)
+		}
+		return
+	}
+	if w.filter(event.Name) {
+		track(event.Name)
+	}
+}
+
+// settle returns the pending files in dir that did not change since they were
+// last checked, and records the current size of the others.
+func (w *Watcher) settle(dir string, pending map[string]*pendingFile) []string {
+	var ready []string
+	for path, p := range pending {
+		if filepath.Dir(path) != dir {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(pending, path)
+			continue
+		}
+		if p.checked && info.Size() == p.size && info.ModTime().Equal(p.modTime) {
+			ready = append(ready, path)
+			delete(pending, path)
+			continue
+		}
+		p.size = info.Size()
+		p.modTime = info.ModTime()
+		p.checked = true
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+func (w *Watcher) hasPending(dir string, pending map[string]*pendingFile) bool {
+	for path := range pending {
+		if filepath.Dir(path) == dir {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/notify"
+	"sonarr-autoimport/internal/sonarr"
+	"sonarr-autoimport/internal/sonarr/sonarrtest"
+)
+
+// runCaptured runs the CLI with args and returns its exit status and what it
+// wrote to stdout and stderr.
+func runCaptured(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	capture := func(f **os.File) (restore func() string) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig := *f
+		*f = w
+		var buf bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			io.Copy(&buf, r)
+			close(done)
+		}()
+		return func() string {
+			w.Close()
+			<-done
+			*f = orig
+			return buf.String()
+		}
+	}
+	restoreOut := capture(&os.Stdout)
+	restoreErr := capture(&os.Stderr)
+	code = run(args)
+	return code, restoreOut(), restoreErr()
+}
+
+// writeConfig writes the default configuration for srv, with downloads and
+// state folders of its own, and returns its path.
+func writeConfig(t *testing.T, srv *sonarrtest.Server) string {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Sonarr.URL = srv.URL
+	cfg.Sonarr.APIKey = sonarrtest.APIKey
+	cfg.Sonarr.DownloadsFolder = filepath.Join(dir, "downloads")
+	cfg.StateDir = filepath.Join(dir, "state")
+	for _, d := range []string{cfg.Sonarr.DownloadsFolder, cfg.StateDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "Settings.json")
+	if err := config.Write(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommandUsage(t *testing.T) {
+	for _, cmd := range commands() {
+		t.Run(cmd.name, func(t *testing.T) {
+			code, _, stderr := runCaptured(t, cmd.name, "-h")
+			if code != exitOK {
+				t.Errorf("%s -h exited with %d, want %d", cmd.name, code, exitOK)
+			}
+			if !strings.Contains(stderr, "Usage: ") || !strings.Contains(stderr, " "+cmd.name+" ") || !strings.Contains(stderr, cmd.summary) {
+				t.Errorf("%s -h printed no usage of its own:\n%s", cmd.name, stderr)
+			}
+			// Every command shares the global flags
+			if !strings.Contains(stderr, "-log-format") {
+				t.Errorf("%s -h does not list the global flags:\n%s", cmd.name, stderr)
+			}
+		})
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, stderr := runCaptured(t, "frobnicate")
+	if code != exitFatal || !strings.Contains(stderr, `Unknown command "frobnicate"`) {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
+
+func TestGlobalFlagsBeforeAndAfterCommand(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	path := writeConfig(t, srv)
+	const name = "[SubsPlease] Frieren - 05 (1080p).mkv"
+
+	for _, args := range [][]string{
+		{"-c", path, "parse", "-json", name},
+		{"parse", "-c", path, "-json", name},
+	} {
+		code, stdout, stderr := runCaptured(t, args...)
+		if code != exitOK {
+			t.Errorf("%q exited with %d:\n%s", args, code, stderr)
+		}
+		if !strings.Contains(stdout, `"title": "Frieren"`) {
+			t.Errorf("%q printed no parse result:\n%s", args, stdout)
+		}
+	}
+}
+
+func TestParseFailure(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	code, _, _ := runCaptured(t, "parse", "-c", writeConfig(t, srv), "readme.txt")
+	if code != exitFailed {
+		t.Errorf("parse of an unparseable name exited with %d, want %d", code, exitFailed)
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	srv := sonarrtest.New()
+	path := writeConfig(t, srv)
+	if code, _, stderr := runCaptured(t, "test-connection", "-c", path); code != exitOK {
+		t.Errorf("test-connection exited with %d:\n%s", code, stderr)
+	}
+	srv.Close()
+	if code, _, _ := runCaptured(t, "test-connection", "-c", path); code != exitFatal {
+		t.Errorf("test-connection of a stopped Sonarr exited with %d, want %d", code, exitFatal)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	path := writeConfig(t, srv)
+	if code, _, stderr := runCaptured(t, "config", "validate", "-c", path); code != exitOK {
+		t.Errorf("config validate exited with %d:\n%s", code, stderr)
+	}
+
+	cfg := config.Default()
+	cfg.Daemon.Mode = "sometimes"
+	if err := config.Write(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ := runCaptured(t, "config", "validate", "-c", path); code != exitFatal {
+		t.Errorf("config validate of an invalid config exited with %d, want %d", code, exitFatal)
+	}
+}
+
+func TestScanCommand(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	path := writeConfig(t, srv)
+	if code, _, stderr := runCaptured(t, "scan", "-c", path); code != exitOK {
+		t.Errorf("scan of an empty folder exited with %d:\n%s", code, stderr)
+	}
+}
+
+func TestNoCommandIsDeprecated(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	code, _, stderr := runCaptured(t, "-c", writeConfig(t, srv))
+	if code != exitOK {
+		t.Errorf("run without a command exited with %d:\n%s", code, stderr)
+	}
+	if !strings.Contains(stderr, "Running without a command is deprecated") {
+		t.Errorf("no deprecation notice:\n%s", stderr)
+	}
+}
+
+func TestFirstRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	code, _, stderr := runCaptured(t, "scan", "-c", path)
+	if code != exitFirstRun {
+		t.Errorf("scan without a config exited with %d, want %d:\n%s", code, exitFirstRun, stderr)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("no default config was created: %v", err)
+	}
+	if strings.Contains(stderr, "required") {
+		t.Errorf("the first run went on with the empty config:\n%s", stderr)
+	}
+}
+
+// startDaemon runs the daemon with the config at path, checking for a
+// completed config every 10ms, and returns the channel of its exit status
+// and the function that stops it.
+func startDaemon(t *testing.T, path string) (exited <-chan int, stop func()) {
+	t.Helper()
+	interval := configCheckInterval
+	configCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { configCheckInterval = interval })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	code := make(chan int, 1)
+	go func() { code <- runDaemonContext(ctx, &globals{configPath: path}, importFlags{}) }()
+	return code, cancel
+}
+
+// waitFor fails the test when cond is not true within 10 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestDaemonFirstRun(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	srv.AddLookup("Frieren", sonarr.SeriesLookup{Title: "Frieren", TitleSlug: "frieren", TvdbID: 424536, Seasons: []sonarr.Season{{SeasonNumber: 1}}},
+		sonarr.Episode{SeasonNumber: 1, EpisodeNumber: 5, Monitored: true})
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	exited, stop := startDaemon(t, path)
+	defer stop()
+	waitFor(t, "the default config", func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case code := <-exited:
+		t.Fatalf("the daemon exited with %d instead of waiting for the config", code)
+	default:
+	}
+
+	// Completing the config starts the daemon, without a restart
+	complete := writeConfig(t, srv)
+	cfg, err := config.Load(complete, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Sonarr.DownloadsFolder, "[SubsPlease] Frieren - 05 (1080p).mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(complete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first import", func() bool { return len(srv.Imports()) == 1 })
+
+	stop()
+	select {
+	case code := <-exited:
+		// A scan may have been running when it was stopped
+		if code != exitOK && code != exitInterrupted {
+			t.Errorf("the daemon exited with %d, want %d or %d", code, exitOK, exitInterrupted)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the daemon did not stop")
+	}
+}
+
+func TestDaemonFirstRunInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	exited, stop := startDaemon(t, path)
+	waitFor(t, "the default config", func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	stop()
+	select {
+	case code := <-exited:
+		if code != exitInterrupted {
+			t.Errorf("the daemon waiting for its config exited with %d, want %d", code, exitInterrupted)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the daemon did not stop")
+	}
+}
+
+// TestReloadRereadsNotificationSecrets reloads a session whose webhook URL
+// comes from a file: the new URL in the file takes effect without a restart.
+func TestReloadRereadsNotificationSecrets(t *testing.T) {
+	srv := sonarrtest.New()
+	defer srv.Close()
+	var mu sync.Mutex
+	hits := map[string]int{}
+	hook := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	before, after := hook("before"), hook("after")
+
+	path := writeConfig(t, srv)
+	urlFile := filepath.Join(filepath.Dir(path), "webhook-url")
+	if err := os.WriteFile(urlFile, []byte(before.URL+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Notifications.Webhooks = []config.NotifyWebhookConfig{{URLFile: urlFile}}
+	if err := config.Write(path, *cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &globals{configPath: path, logLevel: "error"}
+	s, err := openSession(g, importFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(urlFile, []byte(after.URL+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := s.reload(g, importFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	observed := false
+	for _, o := range imp.Observers {
+		observed = observed || o == importer.Observer(s.notifier)
+	}
+	if !observed {
+		t.Fatal("the importer of the reloaded session does not notify the new targets")
+	}
+	s.notifier.Send(notify.SampleEvent())
+	s.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["after"] != 1 || hits["before"] != 0 {
+		t.Errorf("webhook deliveries = %v, want one to the URL the file holds after the reload", hits)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// overrides replace config values for one invocation.
+type overrides struct {
+	downloads      string
+	rootFolder     string
+	qualityProfile string
+	seriesType     string
+}
+
+func (o *overrides) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.downloads, "downloads", "", "Override sonarr.downloadsFolder")
+	fs.StringVar(&o.rootFolder, "root-folder", "", "Override sonarr.rootFolder")
+	fs.StringVar(&o.qualityProfile, "quality-profile", "", "Override sonarr.qualityProfile with a profile ID or name")
+	fs.StringVar(&o.seriesType, "series-type", "", "Override sonarr.seriesType: "+strings.Join(config.SeriesTypes, ", "))
+}
+
+// apply sets the overridden values on cfg and returns the names of the
+// settings it changed. Quality profile names need Sonarr and are resolved with
+// client.
+func (o *overrides) apply(ctx context.Context, cfg *config.Config, client *sonarr.Client) (map[string]bool, error) {
+	changed := make(map[string]bool)
+	if o.downloads != "" {
+		cfg.Sonarr.DownloadsFolder = o.downloads
+		changed["downloadsFolder"] = true
+	}
+	if o.rootFolder != "" {
+		cfg.Sonarr.RootFolder = o.rootFolder
+		changed["rootFolder"] = true
+	}
+	if o.seriesType != "" {
+		if err := config.ValidateSeriesType(o.seriesType); err != nil {
+			return nil, fmt.Errorf("invalid -series-type: %w", err)
+		}
+		cfg.Sonarr.SeriesType = o.seriesType
+		changed["seriesType"] = true
+	}
+	if o.qualityProfile != "" {
+		id, err := resolveQualityProfile(ctx, client, o.qualityProfile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -quality-profile: %w", err)
+		}
+		cfg.Sonarr.QualityProfile = id
+		changed["qualityProfile"] = true
+	}
+	return changed, nil
+}
+
+// profileLookupTimeout bounds the request that resolves a profile name.
+const profileLookupTimeout = 15 * time.Second
+
+// resolveQualityProfile returns the ID of the quality profile named by value,
+// which is either an ID or a profile name.
+func resolveQualityProfile(ctx context.Context, client *sonarr.Client, value string) (int, error) {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, profileLookupTimeout)
+	defer cancel()
+	profiles, err := client.QualityProfiles(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quality profiles: %w", err)
+	}
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		if strings.EqualFold(p.Name, value) {
+			return p.ID, nil
+		}
+		names = append(names, p.Name)
+	}
+	return 0, fmt.Errorf("no quality profile named %q, Sonarr has %s", value, strings.Join(names, ", "))
+}
+
+// logEffectiveConfig logs the Sonarr settings in use at debug level, marking
+// the ones overridden on the command line.
+func logEffectiveConfig(log *logging.Logger, cfg *config.Config, changed map[string]bool) {
+	if !log.Enabled(logging.LevelDebug) {
+		return
+	}
+	log.Debugf("Effective configuration:")
+	for _, s := range []struct {
+		name  string
+		value any
+	}{
+		{"url", cfg.Sonarr.URL},
+		{"downloadsFolder", cfg.Sonarr.DownloadsFolder},
+		{"rootFolder", cfg.Sonarr.RootFolder},
+		{"qualityProfile", cfg.Sonarr.QualityProfile},
+		{"languageProfile", cfg.Sonarr.LanguageProfile},
+		{"seriesType", cfg.Sonarr.SeriesType},
+	} {
+		mark := ""
+		if changed[s.name] {
+			mark = " (overridden)"
+		}
+		log.Debugf("  sonarr.%s: %v%s", s.name, s.value, mark)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+func parseCommand() *command {
+	return &command{
+		name:    "parse",
+		args:    "<filename>...",
+		summary: "Show how filenames are parsed, without contacting Sonarr",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			jsonOut := fs.Bool("json", false, "Print the results as JSON")
+			return func(g *globals, args []string) int {
+				return runParse(g, args, *jsonOut)
+			}
+		},
+	}
+}
+
+func runParse(g *globals, files []string, jsonOut bool) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "parse needs at least one filename")
+		return exitFatal
+	}
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	p := parser.New(cfg.ParserConfig(), logger)
+
+	status := exitOK
+	var results []*parser.ParsedAnime
+	for _, file := range files {
+		var steps []parser.TransformStep
+		if !jsonOut {
+			name := filepath.Base(file)
+			steps = p.TransformSteps(strings.TrimSuffix(name, filepath.Ext(name)))
+		}
+		parsed, err := p.Parse(filepath.Base(file))
+		if err != nil {
+			if len(steps) > 0 || len(cfg.DisabledParsing()) > 0 {
+				fmt.Println(logging.Escape(file))
+				printTransformSteps(cfg, steps)
+			}
+			logger.Errorf("%s: %v", file, err)
+			status = exitFailed
+			continue
+		}
+		parsed.FilePath = file
+		if jsonOut {
+			results = append(results, parsed)
+			continue
+		}
+		episode := strconv.Itoa(parsed.Episode)
+		if parsed.EndEpisode > parsed.Episode {
+			episode += "-" + strconv.Itoa(parsed.EndEpisode)
+		}
+		if parsed.EpisodeTitle != "" {
+			episode += fmt.Sprintf(" %q", parsed.EpisodeTitle)
+		}
+		if parsed.Final {
+			episode += " (final)"
+		}
+		season := strconv.Itoa(parsed.Season)
+		if parsed.DefaultSeason {
+			season += " (default)"
+		}
+		fmt.Println(logging.Escape(file))
+		printTransformSteps(cfg, steps)
+		fmt.Printf("  title:   %s\n  season:  %s\n  episode: %s\n  quality: %s\n  group:   %s\n",
+			parsed.Title, season, episode, parsed.Quality, parsed.Group)
+		if parsed.Profile != "" {
+			fmt.Printf("  profile: %s\n", parsed.Profile)
+		}
+		if parsed.SeriesType != "" {
+			fmt.Printf("  type:    %s\n", parsed.SeriesType)
+		}
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return fatal(logger, err)
+		}
+	}
+	return status
+}
+
+// printTransformSteps prints the filename after each transform that changed
+// it, so a transform that mangles names is easy to spot, and then the
+// transforms and patterns that are disabled.
+func printTransformSteps(cfg *config.Config, steps []parser.TransformStep) {
+	for _, step := range steps {
+		path := cfg.TransformPath(step.Index)
+		if step.Transform.Name != "" {
+			path += " (" + step.Transform.Name + ")"
+		}
+		fmt.Printf("  %s: %s\n", path, step.Result)
+	}
+	for _, path := range cfg.DisabledParsing() {
+		fmt.Printf("  %s: disabled\n", path)
+	}
+}
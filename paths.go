@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sonarr-autoimport/internal/logging"
+)
+
+// pathList collects the values of a repeatable flag.
+type pathList []string
+
+func (p *pathList) String() string { return strings.Join(*p, ", ") }
+
+func (p *pathList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// resolvePaths expands "-" into the newline-separated paths read from stdin
+// and makes every path absolute. Paths must exist; paths outside downloads
+// are accepted with a warning.
+func resolvePaths(paths []string, stdin io.Reader, downloads string, log *logging.Logger) ([]string, error) {
+	var expanded []string
+	for _, path := range paths {
+		if path != "-" {
+			expanded = append(expanded, path)
+			continue
+		}
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				expanded = append(expanded, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read paths from stdin: %w", err)
+		}
+	}
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("no paths to process")
+	}
+
+	root, err := filepath.Abs(downloads)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]string, 0, len(expanded))
+	for _, path := range expanded {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(root, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			log.Warnf("%s is outside the downloads folder %s", abs, downloads)
+		}
+		resolved = append(resolved, abs)
+	}
+	return resolved, nil
+}
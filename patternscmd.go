@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"sonarr-autoimport/internal/config"
+)
+
+func patternsCommand() *command {
+	return &command{
+		name:    "patterns",
+		args:    "list",
+		summary: "List the anime patterns in the order they are tried, with the presets they come from",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			jsonOut := fs.Bool("json", false, "Print the patterns as JSON")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "patterns list -json"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				switch {
+				case len(args) == 1 && args[0] == "list":
+					return runPatternsList(g, *jsonOut)
+				case len(args) == 0:
+					fmt.Fprintln(os.Stderr, "patterns needs list")
+					return exitFatal
+				}
+				fmt.Fprintf(os.Stderr, "Unknown patterns command %q\n", strings.Join(args, " "))
+				return exitFatal
+			}
+		},
+	}
+}
+
+// runPatternsList prints the effective anime patterns of the configuration:
+// those of parsing.animePatterns merged with the presets of
+// parsing.presetFiles as parsing.presetMerge says. The patterns of release
+// group profiles are tried before them for the files of their group and are
+// not listed.
+func runPatternsList(g *globals, jsonOut bool) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	patterns := cfg.EffectivePatterns()
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(patterns); err != nil {
+			return fatal(logger, err)
+		}
+		return exitOK
+	}
+
+	for _, preset := range cfg.Presets {
+		line := "preset " + preset.Source
+		if preset.Name != "" && preset.Name != preset.Source {
+			line += " (" + preset.Name + ")"
+		}
+		if preset.Description != "" {
+			line += ": " + preset.Description
+		}
+		if preset.Stale {
+			line += " [cached copy, the URL could not be fetched]"
+		}
+		fmt.Println(line)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tORIGIN\tNAME\tTYPE\tPATTERN")
+	for i, p := range patterns {
+		origin := "config"
+		if p.Preset != "" {
+			origin = p.Preset
+		}
+		name, seriesType := orDash(p.Name), orDash(p.SeriesType)
+		pattern := p.Pattern
+		if p.Disabled() {
+			pattern += " (disabled)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, origin, name, seriesType, pattern)
+	}
+	w.Flush()
+	if len(patterns) == 0 {
+		logger.Warnf("No anime patterns; add some to parsing.animePatterns or name a preset such as %s in parsing.presetFiles", strings.Join(config.BuiltinPresets(), ", "))
+	}
+	return exitOK
+}
+
+// orDash returns s, or "-" when it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
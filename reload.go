@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/mediaserver"
+	"sonarr-autoimport/internal/notify"
+)
+
+// reload reads and validates the config file again and builds the importer
+// for it. The session is left alone when the new configuration has errors.
+// Settings that only apply at startup keep their current values. The
+// notifications and media servers are built again, so the secret files they
+// name are read again, and the old ones finish their deliveries.
+func (s *session) reload(g *globals, f importFlags) (*importer.Importer, error) {
+	cfg, issues, err := checkConfig(g.configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if issue.Severity == config.SeverityError {
+			s.log.Errorf("  %s", issue)
+		} else {
+			s.log.Warnf("  %s", issue)
+		}
+	}
+	if config.HasErrors(issues) {
+		return nil, fmt.Errorf("%s is invalid", g.configPath)
+	}
+
+	for _, path := range cfg.KeepStartupSettings(s.cfg) {
+		s.log.Warnf("%s changed but requires a restart, keeping the current value", path)
+	}
+	imp, changed, err := s.newImporter(g, f, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if f.limit == 0 {
+		imp.Options.Limit = cfg.Daemon.MaxFilesPerScan
+	}
+	imp.Options.MaxAge, _ = cfg.Daemon.MaxFileAgeDuration()
+	imp.Retry = s.imp.Retry
+	imp.Ignore = s.imp.Ignore
+	imp.Aliases = s.imp.Aliases
+	imp.Fingerprints = s.imp.Fingerprints
+	imp.LookupMisses = s.imp.LookupMisses
+	imp.LastScan = s.imp.LastScan
+	if err := g.applyLogLevel(s.log, cfg); err != nil {
+		return nil, err
+	}
+
+	notifier, err := notify.New(cfg.Notifications, s.log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification configuration: %w", err)
+	}
+	refresher, err := mediaserver.New(cfg.MediaServers, s.log)
+	if err != nil {
+		notifier.Close(s.drainTimeout)
+		return nil, fmt.Errorf("invalid media server configuration: %w", err)
+	}
+	imp.Observers = make([]importer.Observer, 0, len(s.imp.Observers))
+	for _, o := range s.imp.Observers {
+		switch o {
+		case importer.Observer(s.notifier):
+			o = notifier
+		case importer.Observer(s.refresher):
+			o = refresher
+		}
+		imp.Observers = append(imp.Observers, o)
+	}
+
+	// The new configuration may match the titles that found no series
+	if err := s.misses.Clear(); err != nil {
+		s.log.Warnf("Failed to clear the lookup misses: %v", err)
+	}
+	oldNotifier, oldRefresher := s.notifier, s.refresher
+	s.cfg, s.imp = cfg, imp
+	s.notifier, s.refresher = notifier, refresher
+	oldRefresher.Wait(s.drainTimeout)
+	oldNotifier.Close(s.drainTimeout)
+	logSources(s.log, cfg)
+	logEffectiveConfig(s.log, cfg, changed)
+	return imp, nil
+}
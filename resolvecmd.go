@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/parser"
+	"sonarr-autoimport/internal/sonarr"
+)
+
+// maxCandidates is how many lookup results resolve offers for a title.
+const maxCandidates = 5
+
+func resolveCommand() *command {
+	return &command{
+		name:    "resolve",
+		args:    "[title]",
+		summary: "List the titles no series was found for, or map one to a series",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			f.registerScan(fs)
+			var opts resolveFlags
+			fs.IntVar(&opts.tvdbID, "tvdb", 0, "Map the title to the series with this TVDB `ID`")
+			fs.IntVar(&opts.pick, "pick", 0, "Map the title to candidate `N` of the last lookup")
+			fs.StringVar(&opts.search, "search", "", "Look the series up with `term` instead of the title")
+			fs.BoolVar(&opts.noImport, "no-import", false, "Only save the alias, leaving the files to the next scan")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the title, as in "resolve 'Some Title' -pick 2"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				switch {
+				case len(args) == 0:
+					return runResolveList(g)
+				case len(args) > 1:
+					fmt.Fprintf(os.Stderr, "Unexpected arguments %q; quote titles with spaces\n", strings.Join(args[1:], " "))
+					return exitFatal
+				case opts.tvdbID != 0 && opts.pick != 0:
+					fmt.Fprintln(os.Stderr, "-tvdb and -pick cannot be combined")
+					return exitFatal
+				case opts.tvdbID != 0 || opts.pick != 0:
+					return runResolve(g, f, args[0], opts)
+				}
+				return runResolveLookup(g, args[0], opts.search)
+			}
+		},
+	}
+}
+
+type resolveFlags struct {
+	tvdbID   int
+	pick     int
+	search   string
+	noImport bool
+}
+
+func runResolveList(g *globals) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	titles, err := history.OpenUnmatched(stateDir(g, cfg), logger).Titles()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if len(titles) == 0 {
+		fmt.Println("No unmatched titles")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TITLE\tFILES\tLAST SEEN\tEXAMPLES")
+	for _, t := range titles {
+		var examples []string
+		for _, path := range t.Files[:min(len(t.Files), 3)] {
+			examples = append(examples, filepath.Base(path))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", t.Title, len(t.Files), t.LastSeen.Local().Format("2006-01-02 15:04"), strings.Join(examples, ", "))
+		for i, c := range t.Candidates {
+			fmt.Fprintf(w, "  %d. %s\t\t\t\n", i+1, candidateName(c))
+		}
+	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println(`Run "resolve <title>" to look a title up, then "resolve <title> -pick N" or "-tvdb ID" to map it`)
+	return exitOK
+}
+
+// runResolveLookup looks title up in Sonarr, prints the candidates and keeps
+// them for -pick.
+func runResolveLookup(g *globals, title, search string) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	unmatched := history.OpenUnmatched(stateDir(g, cfg), logger)
+	t, found, err := unmatched.Get(title)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if found {
+		title = t.Title
+	}
+	if search == "" {
+		search = title
+	}
+
+	client := sonarr.NewClient(cfg.Sonarr.URL, cfg.Sonarr.APIKey, nil, logger)
+	client.SetHeaders(cfg.Sonarr.Headers)
+	client.SetReadOnly()
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	results, err := client.LookupSeries(ctx, search)
+	if err != nil {
+		return fatal(logger, fmt.Errorf("failed to search for series: %w", err))
+	}
+	if len(results) == 0 {
+		fmt.Printf("Sonarr found no series for %q; try -search with another term, or -tvdb ID\n", search)
+		return exitOK
+	}
+
+	var candidates []history.Candidate
+	for _, r := range results[:min(len(results), maxCandidates)] {
+		candidates = append(candidates, history.Candidate{Title: r.Title, Year: r.Year, TvdbID: r.TvdbID})
+	}
+	if found {
+		if err := unmatched.SetCandidates(title, candidates); err != nil {
+			return fatal(logger, fmt.Errorf("failed to save unmatched titles: %w", err))
+		}
+	}
+	fmt.Printf("Candidates for %s:\n", title)
+	for i, c := range candidates {
+		fmt.Printf("  %d. %s\n", i+1, candidateName(c))
+	}
+	if found {
+		fmt.Printf("Run \"resolve %q -pick N\" to map the title to one of them\n", title)
+	} else {
+		fmt.Printf("%s is not an unmatched title; use -tvdb ID to map it anyway\n", title)
+	}
+	return exitOK
+}
+
+// candidateName describes c for the candidate lists.
+func candidateName(c history.Candidate) string {
+	if c.Year == 0 {
+		return fmt.Sprintf("%s [tvdb:%d]", c.Title, c.TvdbID)
+	}
+	return fmt.Sprintf("%s (%d) [tvdb:%d]", c.Title, c.Year, c.TvdbID)
+}
+
+// runResolve maps title to the chosen series and imports its files again.
+func runResolve(g *globals, f importFlags, title string, opts resolveFlags) int {
+	// The session is only needed, and its lock only taken, to import
+	var s *session
+	var err error
+	if opts.noImport {
+		s = &session{}
+		s.log, s.cfg, err = g.load()
+	} else {
+		s, err = openSession(g, f)
+		defer s.close()
+	}
+	if err != nil {
+		return fatal(s.log, err)
+	}
+	dir := stateDir(g, s.cfg)
+	t, found, err := history.OpenUnmatched(dir, s.log).Get(title)
+	if err != nil {
+		return fatal(s.log, err)
+	}
+	if found {
+		title = t.Title
+	}
+
+	tvdbID := opts.tvdbID
+	if opts.pick != 0 {
+		if opts.pick < 1 || opts.pick > len(t.Candidates) {
+			fmt.Fprintf(os.Stderr, "%s has no candidate %d; run \"resolve %q\" to look it up first\n", title, opts.pick, title)
+			return exitFatal
+		}
+		tvdbID = t.Candidates[opts.pick-1].TvdbID
+	}
+	if tvdbID < 0 {
+		fmt.Fprintf(os.Stderr, "invalid TVDB ID %d\n", tvdbID)
+		return exitFatal
+	}
+	if g.dryRun.enabled {
+		// A dry run shows what the alias would do without saving it
+		s.log.Infof("Would map %s to TVDB ID %d", title, tvdbID)
+		if s.imp != nil {
+			s.imp.Aliases = dryRunAliases{}.add(title, tvdbID)
+		}
+	} else {
+		if err := history.OpenAliases(dir, s.log).Set(title, tvdbID); err != nil {
+			return fatal(s.log, fmt.Errorf("failed to save title alias: %w", err))
+		}
+		if err := history.OpenLookupMisses(dir, s.log).Forget(title); err != nil {
+			s.log.Warnf("Failed to forget the lookup miss of %s: %v", title, err)
+		}
+		s.log.Infof("Mapped %s to TVDB ID %d", title, tvdbID)
+	}
+	if opts.noImport || len(t.Files) == 0 {
+		return exitOK
+	}
+
+	s.log.Infof("Importing %d file(s) of %s again", len(t.Files), title)
+	ctx, stop := signalContext()
+	defer stop()
+	result, err := s.imp.ProcessPaths(ctx, t.Files)
+	return exitStatus(result, err, false)
+}
+
+// dryRunAliases are the aliases a dry run of resolve or approve plans with
+// instead of saving them, by normalized title.
+type dryRunAliases map[string]int
+
+// add adds the alias of title and returns a.
+func (a dryRunAliases) add(title string, tvdbID int) dryRunAliases {
+	a[parser.NormalizeTitle(title)] = tvdbID
+	return a
+}
+
+// TvdbID implements importer.Aliases.
+func (a dryRunAliases) TvdbID(title string) int {
+	return a[parser.NormalizeTitle(title)]
+}
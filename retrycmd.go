@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/logging"
+)
+
+func retryCommand() *command {
+	return &command{
+		name:    "retry",
+		summary: "Show the retry queue, or process it right away with -now",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			f.registerScan(fs)
+			now := fs.Bool("now", false, "Retry every queued file immediately, including those given up on")
+			return func(g *globals, args []string) int {
+				if *now {
+					return runRetryNow(g, f)
+				}
+				return runRetryList(g)
+			}
+		},
+	}
+}
+
+// openRetryQueue loads the retry queue of dir with the policy of cfg.
+func openRetryQueue(dir string, cfg config.RetryConfig, logger *logging.Logger) (*history.Queue, error) {
+	policy := history.RetryPolicy{MaxAttempts: cfg.MaxAttempts}
+	var err error
+	if policy.Delay, err = cfg.DelayDuration(); err != nil {
+		return nil, err
+	}
+	if policy.MaxDelay, err = cfg.MaxDelayDuration(); err != nil {
+		return nil, err
+	}
+	if policy.MetadataDelay, err = cfg.MetadataDelayDuration(); err != nil {
+		return nil, err
+	}
+	return history.OpenQueue(dir, policy, logger)
+}
+
+func runRetryList(g *globals) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	queue, err := openRetryQueue(stateDir(g, cfg), cfg.Retry, logger)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	entries := queue.Entries()
+	if len(entries) == 0 {
+		fmt.Println("The retry queue is empty")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+	for _, e := range entries {
+		next := e.NextAttempt.Local().Format("2006-01-02 15:04")
+		switch {
+		case e.GaveUp:
+			next = "given up"
+		case !e.NextAttempt.After(time.Now()):
+			next = "next scan"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s: %s\n", logging.Escape(filepath.Base(e.Path)), e.Attempts, next, e.Category, logging.Escape(e.Error))
+	}
+	w.Flush()
+	return exitOK
+}
+
+// runRetryNow makes every queued file due and imports them like scan -file.
+func runRetryNow(g *globals, f importFlags) int {
+	s, err := openSession(g, f)
+	defer s.close()
+	if err != nil {
+		return fatal(s.log, err)
+	}
+	if s.retry == nil {
+		return fatal(s.log, fmt.Errorf("the retry queue is disabled because retry.maxAttempts is 0"))
+	}
+	paths, err := s.retry.Force()
+	if err != nil {
+		return fatal(s.log, fmt.Errorf("failed to save retry queue: %w", err))
+	}
+	if len(paths) == 0 {
+		s.log.Infof("The retry queue is empty")
+		return exitOK
+	}
+	s.log.Infof("Retrying %d queued file(s)", len(paths))
+
+	ctx, stop := signalContext()
+	defer stop()
+	result, err := s.imp.ProcessPaths(ctx, paths)
+	return exitStatus(result, err, false)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/parser"
+)
+
+func rulesCommand() *command {
+	return &command{
+		name:    "rules",
+		args:    "export | import <file>",
+		summary: "Export the title aliases, transforms and groups, or merge a rules file into rulesFile",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			output := fs.String("o", "", "export: write the rules to `file`, in the format of its extension, instead of stdout")
+			format := fs.String("format", "json", "export: format of the rules on stdout: json, yaml or toml")
+			replace := fs.Bool("replace", false, "import: replace conflicting rules instead of keeping the existing ones")
+			jsonOut := fs.Bool("json", false, "import: print the outcome of every rule as JSON")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "rules import -replace shared.yaml"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				switch {
+				case len(args) == 1 && args[0] == "export":
+					return runRulesExport(g, *output, *format)
+				case len(args) == 2 && args[0] == "import":
+					return runRulesImport(g, args[1], *replace, *jsonOut)
+				case len(args) == 1 && args[0] == "import":
+					fmt.Fprintln(os.Stderr, "rules import needs the rules file to merge")
+					return exitFatal
+				case len(args) == 0:
+					fmt.Fprintln(os.Stderr, "rules needs one of export or import")
+					return exitFatal
+				}
+				fmt.Fprintf(os.Stderr, "Unknown rules command %q\n", strings.Join(args, " "))
+				return exitFatal
+			}
+		},
+	}
+}
+
+// effectiveRules returns the rules cfg applies: the aliases saved in the
+// state directory followed by those of the rules file, the transforms and
+// groups of the configuration merged with the rules file and the series
+// rules of the rules file.
+func effectiveRules(g *globals, cfg *config.Config, logger *logging.Logger) (*config.Rules, error) {
+	saved, err := history.OpenAliases(stateDir(g, cfg), logger).List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read title aliases: %w", err)
+	}
+	rules := &config.Rules{Transforms: cfg.Transforms, Groups: cfg.Groups}
+	seen := make(map[string]bool)
+	for _, a := range saved {
+		rules.Aliases = append(rules.Aliases, config.AliasRule{Title: a.Title, TvdbID: a.TvdbID})
+		seen[parser.NormalizeTitle(a.Title)] = true
+	}
+	if cfg.Rules != nil {
+		for _, a := range cfg.Rules.Aliases {
+			if !seen[parser.NormalizeTitle(a.Title)] {
+				rules.Aliases = append(rules.Aliases, a)
+			}
+		}
+		rules.Series = cfg.Rules.Series
+	}
+	return rules, nil
+}
+
+func runRulesExport(g *globals, output, formatName string) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	rules, err := effectiveRules(g, cfg, logger)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	if output != "" {
+		if err := config.WriteRules(output, rules); err != nil {
+			return fatal(logger, err)
+		}
+		logger.Infof("Exported %d alias(es), %d transform(s) and %d group(s) to %s", len(rules.Aliases), len(rules.Transforms), len(rules.Groups), output)
+		return exitOK
+	}
+	format, err := config.ParseFormat(formatName)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	data, err := config.MarshalRules(rules, format)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	os.Stdout.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		fmt.Println()
+	}
+	return exitOK
+}
+
+func runRulesImport(g *globals, path string, replace, jsonOut bool) int {
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	target := cfg.RulesFilePath(g.configPath)
+	if target == "" {
+		return fatal(logger, errors.New("rules import merges into the rulesFile of the config, which is not set"))
+	}
+	in, err := config.ReadRules(path)
+	if err != nil {
+		return fatal(logger, err)
+	}
+	rules := cfg.Rules
+	if rules == nil {
+		// The rules file does not exist yet
+		rules = &config.Rules{}
+	}
+
+	changes := rules.Merge(in, replace)
+	notes := importNotes(g, cfg, logger, in)
+	conflicts := 0
+	for i, c := range changes {
+		if c.Outcome == config.RuleConflict {
+			conflicts++
+		}
+		if note := notes[c.Kind+"\x00"+c.Name]; note != "" && c.Outcome != config.RuleConflict {
+			changes[i].Detail = note
+		}
+	}
+
+	issues := rules.Validate()
+	for _, issue := range issues {
+		if issue.Severity == config.SeverityError {
+			logger.Errorf("  %s", issue)
+		} else {
+			logger.Warnf("  %s", issue)
+		}
+	}
+	if config.HasErrors(issues) {
+		return fatal(logger, fmt.Errorf("the merged rules are invalid, %s is left unchanged", target))
+	}
+
+	if g.dryRun.enabled {
+		logger.Infof("[DRY RUN] Not writing %s", target)
+	} else if err := config.WriteRules(target, rules); err != nil {
+		return fatal(logger, err)
+	} else {
+		forgetMisses(g, cfg, logger, changes)
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			return fatal(logger, err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tOUTCOME\tDETAIL")
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Kind, c.Name, c.Outcome, c.Detail)
+		}
+		w.Flush()
+	}
+	if conflicts > 0 {
+		logger.Warnf("%d conflicting rule(s) kept their existing value; use -replace to take those of %s", conflicts, path)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// forgetMisses drops the lookup misses of the titles that changes gave an
+// alias, so their files are matched by the next scan.
+func forgetMisses(g *globals, cfg *config.Config, logger *logging.Logger, changes []config.RuleChange) {
+	misses := history.OpenLookupMisses(stateDir(g, cfg), logger)
+	for _, c := range changes {
+		if c.Kind != "alias" || (c.Outcome != config.RuleAdded && c.Outcome != config.RuleReplaced) {
+			continue
+		}
+		if err := misses.Forget(c.Name); err != nil {
+			logger.Warnf("Failed to forget the lookup miss of %s: %v", c.Name, err)
+		}
+	}
+}
+
+// importNotes describes, by kind and name, the rules of in that are merged
+// but do not take effect because the aliases the resolve command saved or
+// the groups of the configuration take precedence.
+func importNotes(g *globals, cfg *config.Config, logger *logging.Logger, in *config.Rules) map[string]string {
+	notes := make(map[string]string)
+	aliases := history.OpenAliases(stateDir(g, cfg), logger)
+	for _, a := range in.Aliases {
+		if id := aliases.TvdbID(a.Title); id != 0 && id != a.TvdbID {
+			notes["alias\x00"+a.Title] = fmt.Sprintf("%s maps it to %d, which takes precedence", history.AliasesFileName, id)
+		}
+	}
+	for name := range in.Groups {
+		if _, ok := cfg.Groups[name]; ok && !cfg.RuleGroup(name) {
+			notes["group\x00"+name] = fmt.Sprintf("groups.%s of the config takes precedence", name)
+		}
+	}
+	return notes
+}
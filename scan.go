@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/daemon"
+	"sonarr-autoimport/internal/history"
+	"sonarr-autoimport/internal/importer"
+	"sonarr-autoimport/internal/logging"
+	"sonarr-autoimport/internal/report"
+	"sonarr-autoimport/internal/state"
+	"sonarr-autoimport/internal/watcher"
+)
+
+func scanCommand() *command {
+	return &command{
+		name:    "scan",
+		summary: "Scan the downloads folder once and import the files found",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			var failOnSkip bool
+			var files pathList
+			f.registerScan(fs)
+			fs.BoolVar(&failOnSkip, "fail-on-skip", false, "Exit with status 3 when files were skipped because no series matched")
+			fs.Var(&files, "file", "Import this file or directory instead of scanning the downloads folder; repeatable, - reads paths from stdin")
+			return func(g *globals, args []string) int {
+				return runScan(g, f, failOnSkip, files)
+			}
+		},
+	}
+}
+
+func daemonCommand() *command {
+	return &command{
+		name:    "daemon",
+		summary: "Keep running and scan every daemon.interval or when files appear",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			f.registerScan(fs)
+			return func(g *globals, args []string) int {
+				return runDaemon(g, f)
+			}
+		},
+	}
+}
+
+func (f *importFlags) registerScan(fs *flag.FlagSet) {
+	fs.BoolVar(&f.force, "force", false, "Run even if another instance holds the state directory lock")
+	fs.StringVar(&f.report, "report", "", "Write a JSON report of each scan to this file")
+	fs.IntVar(&f.limit, "limit", 0, "Attempt at most this many files per scan, overriding parsing.fileLimit")
+	fs.BoolVar(&f.yes, "yes", false, "Scan even when more video files than parsing.maxFiles are found")
+	fs.BoolVar(&f.noDedupe, "no-dedupe", false, "Import files even when the same content was imported into the same episode before")
+	fs.BoolVar(&f.missingOnly, "missing-only", false, "Import only files of episodes Sonarr lists as missing and skip the rest")
+	fs.BoolVar(&f.crossCheck, "cross-check", false, "Compare every file with Sonarr's manual import preview of the downloads folder and flag disagreements")
+	fs.BoolVar(&f.allowOverlap, "allow-overlap", false, "Scan even when the downloads folder is inside a Sonarr root folder or holds one; files inside the root folders are still skipped")
+	fs.Var(&f.since, "since", "Only process files modified since this RFC 3339 time or this long ago, such as 48h; older files are left alone")
+	fs.BoolVar(&f.noRescan, "no-rescan", false, "Leave video files that appear during a scan for the next one instead of processing them in a second pass, like parsing.skipRescan")
+	fs.StringVar(&f.events, "events", "", "Stream events as NDJSON: ndjson for stdout, unix:PATH for a socket or the path of a file to append to")
+	f.overrides.register(fs)
+}
+
+// legacyFlags is the flat flag set of releases before subcommands.
+type legacyFlags struct {
+	importFlags
+	daemon     bool
+	failOnSkip bool
+	testNotify bool
+}
+
+func (l *legacyFlags) register(fs *flag.FlagSet) {
+	l.registerScan(fs)
+	fs.BoolVar(&l.daemon, "daemon", false, "Deprecated, use the daemon command")
+	fs.BoolVar(&l.failOnSkip, "fail-on-skip", false, "Deprecated, use scan -fail-on-skip")
+	fs.BoolVar(&l.testNotify, "test-notifications", false, "Deprecated, use test-connection -notifications")
+}
+
+// run keeps the behavior of running without a command for one release.
+func (l *legacyFlags) run(g *globals) int {
+	// DAEMON_MODE predates the -daemon flag and is kept as a fallback
+	daemonMode := l.daemon
+	if !daemonMode && os.Getenv("DAEMON_MODE") == "true" {
+		fmt.Fprintln(os.Stderr, "DAEMON_MODE is deprecated, use the daemon command instead")
+		daemonMode = true
+	}
+
+	switch {
+	case l.testNotify:
+		fmt.Fprintf(os.Stderr, "Running without a command is deprecated, use %q\n", "test-connection -notifications")
+		logger, cfg, err := g.load()
+		if err != nil {
+			return fatal(logger, err)
+		}
+		return testNotifications(logger, cfg)
+	case daemonMode:
+		fmt.Fprintf(os.Stderr, "Running without a command is deprecated, use %q\n", "daemon")
+		return runDaemon(g, l.importFlags)
+	default:
+		fmt.Fprintf(os.Stderr, "Running without a command is deprecated, use %q\n", "scan")
+		return runScan(g, l.importFlags, l.failOnSkip, nil)
+	}
+}
+
+// signalContext is cancelled by the first SIGINT or SIGTERM; a second one
+// kills the process.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
+
+func runScan(g *globals, f importFlags, failOnSkip bool, files pathList) int {
+	s, err := openSession(g, f)
+	defer s.close()
+	if err != nil {
+		return fatal(s.log, err)
+	}
+
+	var paths []string
+	if len(files) > 0 {
+		if paths, err = resolvePaths(files, os.Stdin, s.cfg.Sonarr.DownloadsFolder, s.log); err != nil {
+			return fatal(s.log, err)
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	var result *importer.ScanResult
+	if paths != nil {
+		result, err = s.imp.ProcessPaths(ctx, paths)
+	} else {
+		result, err = s.imp.ProcessAnimeFiles(ctx)
+	}
+	if s.cfg.Daemon.PingURL != "" && s.cfg.Daemon.PingOneShot {
+		daemon.Ping(s.cfg.Daemon.PingURL, s.cfg.Daemon.PingMethod, daemon.CycleFailed(result, err), daemon.PingSummary(result, err), s.log)
+	}
+	if err != nil {
+		s.log.Errorf("Processing failed: %v", err)
+	}
+	return exitStatus(result, err, failOnSkip)
+}
+
+func runDaemon(g *globals, f importFlags) int {
+	ctx, stop := signalContext()
+	defer stop()
+	return runDaemonContext(ctx, g, f)
+}
+
+// runDaemonContext runs the daemon until ctx is done. On the first run it
+// waits for the default config it created to be completed, so a container
+// does not restart over and over until its mounted config is edited.
+func runDaemonContext(ctx context.Context, g *globals, f importFlags) int {
+	s, err := openSession(g, f)
+	if errors.Is(err, config.ErrDefaultCreated) {
+		if !awaitConfig(ctx, g.configPath, s.log) {
+			return exitInterrupted
+		}
+		s, err = openSession(g, f)
+	}
+	defer s.close()
+	if err != nil {
+		return fatal(s.log, err)
+	}
+
+	opts, err := daemonOptions(s.cfg, s.log)
+	if err != nil {
+		return fatal(s.log, fmt.Errorf("invalid daemon configuration: %w", err))
+	}
+	if f.limit == 0 {
+		s.imp.Options.Limit = s.cfg.Daemon.MaxFilesPerScan
+	}
+	s.imp.Options.MaxAge, _ = s.cfg.Daemon.MaxFileAgeDuration()
+	if s.cfg.Daemon.ReportDir != "" {
+		s.imp.Observers = append(s.imp.Observers, report.NewDir(s.cfg.Daemon.ReportDir, s.cfg.Daemon.ReportRetention, s.log))
+	}
+	if retention, _ := s.cfg.Daemon.HistoryRetentionDuration(); retention > 0 {
+		store := history.Open(stateDir(g, s.cfg))
+		s.imp.Observers = append(s.imp.Observers, history.NewPruner(store, retention, s.log))
+	}
+
+	opts.ConfigPath = g.configPath
+	opts.HeartbeatFile = state.HeartbeatPath(stateDir(g, s.cfg))
+	opts.SnapshotFile = filepath.Join(stateDir(g, s.cfg), watcher.SnapshotFileName)
+	opts.Reload = func() (*importer.Importer, error) { return s.reload(g, f) }
+	opts.Metrics = history.OpenStats(stateDir(g, s.cfg), s.log).WriteMetrics
+
+	if interrupted := daemon.New(s.imp, opts).Run(ctx); interrupted {
+		return exitInterrupted
+	}
+	return exitOK
+}
+
+// configCheckInterval is how often awaitConfig checks the config.
+var configCheckInterval = config.MinInterval
+
+// awaitConfig checks the config at path every configCheckInterval until it
+// loads without validation errors and reports whether it did before ctx was
+// done. The reason the config is not complete yet is logged when it changes.
+func awaitConfig(ctx context.Context, path string, logger *logging.Logger) bool {
+	logger.Infof("Waiting for %s to be edited with your Sonarr settings, checking every %v", path, configCheckInterval)
+	ticker := time.NewTicker(configCheckInterval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		reason := configIncomplete(path)
+		if reason == "" {
+			logger.Infof("%s is complete, starting", path)
+			return true
+		}
+		if reason != last {
+			logger.Infof("%s is not complete yet: %s", path, reason)
+			last = reason
+		}
+	}
+}
+
+// configIncomplete returns why the config at path cannot be run yet: the
+// error of loading it or its first validation error. It returns "" when it
+// can.
+func configIncomplete(path string) string {
+	cfg, err := config.Load(path, nil)
+	if err != nil {
+		return err.Error()
+	}
+	for _, issue := range cfg.Validate() {
+		if issue.Severity == config.SeverityError {
+			return issue.Path + ": " + issue.Message
+		}
+	}
+	return ""
+}
+
+// daemonOptions builds the daemon settings from the config and the deprecated
+// environment variables.
+func daemonOptions(cfg *config.Config, logger *logging.Logger) (daemon.Options, error) {
+	opts := daemon.Options{
+		Mode:       cfg.Daemon.ScanMode(),
+		ListenAddr: cfg.Daemon.ListenAddr,
+		PingURL:    cfg.Daemon.PingURL,
+		PingMethod: cfg.Daemon.PingMethod,
+		PauseFile:  cfg.Daemon.PauseFile,
+		Pprof:      cfg.Daemon.EnablePprof,
+		PprofAddr:  cfg.Daemon.PprofAddr,
+	}
+
+	if err := config.ValidatePprofAddr(opts.PprofAddr); err != nil {
+		return opts, fmt.Errorf("daemon.pprofAddr: %w", err)
+	}
+
+	var err error
+	if opts.Interval, err = daemonInterval(cfg, logger); err != nil {
+		return opts, err
+	}
+	if opts.WatchDebounce, err = cfg.Daemon.WatchDebounceDuration(); err != nil {
+		return opts, err
+	}
+	if opts.RescanInterval, err = cfg.Daemon.RescanIntervalDuration(); err != nil {
+		return opts, err
+	}
+	if opts.LatencyWarning, err = cfg.Daemon.LatencyWarningDuration(); err != nil {
+		return opts, err
+	}
+	if opts.ActiveHours, err = cfg.Daemon.ActiveHoursWindow(); err != nil {
+		return opts, err
+	}
+	if opts.LogRepeatWindow, err = cfg.Daemon.LogRepeatWindowDuration(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// daemonInterval returns the effective scan interval. daemon.interval wins
+// over the deprecated SCAN_INTERVAL environment variable, which accepts plain
+// seconds or a duration string. Intervals below config.MinInterval are raised
+// to it.
+func daemonInterval(cfg *config.Config, logger *logging.Logger) (time.Duration, error) {
+	interval, err := cfg.Daemon.IntervalDuration()
+	if err != nil {
+		return 0, err
+	}
+
+	if envInterval := os.Getenv("SCAN_INTERVAL"); envInterval != "" {
+		if interval != 0 {
+			logger.Warnf("SCAN_INTERVAL is deprecated and ignored because daemon.interval is set")
+		} else {
+			logger.Warnf("SCAN_INTERVAL is deprecated, set daemon.interval in the config instead")
+			interval, err = parseEnvInterval(envInterval)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if interval == 0 {
+		interval = config.DefaultInterval
+	}
+	if interval < config.MinInterval {
+		logger.Warnf("Scan interval %v is below the minimum, using %v", interval, config.MinInterval)
+		interval = config.MinInterval
+	}
+	return interval, nil
+}
+
+// parseEnvInterval parses SCAN_INTERVAL, where a bare number means seconds.
+func parseEnvInterval(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SCAN_INTERVAL %q: %w", value, err)
+	}
+	return interval, nil
+}
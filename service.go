@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultServiceName is the name the Windows service is installed under.
+const defaultServiceName = "sonarr-autoimport"
+
+func serviceCommand() *command {
+	return &command{
+		name:    "service",
+		args:    "install|uninstall|run",
+		summary: "Install the daemon as a Windows service, or run it as one",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var f importFlags
+			f.registerScan(fs)
+			var opts serviceFlags
+			fs.StringVar(&opts.name, "name", defaultServiceName, "Name of the Windows service")
+			fs.StringVar(&opts.logFile, "log-file", "", "Append the log to this file, as a service has no console (install: defaults to sonarr-autoimport.log next to the configuration)")
+			return func(g *globals, args []string) int {
+				// Flags may also follow the action, as in "service install -name anime"
+				if len(args) > 0 {
+					if err := fs.Parse(args[1:]); err != nil {
+						return parseExit(err)
+					}
+					args = append(args[:1], fs.Args()...)
+				}
+				if len(args) != 1 {
+					fmt.Fprintln(os.Stderr, "service needs one of install, uninstall or run")
+					return exitFatal
+				}
+				switch args[0] {
+				case "install":
+					return installService(g, opts, g.forward(fs))
+				case "uninstall":
+					return uninstallService(opts)
+				case "run":
+					return runService(g, f, opts)
+				}
+				fmt.Fprintf(os.Stderr, "Unknown service command %q\n", strings.Join(args, " "))
+				return exitFatal
+			}
+		},
+	}
+}
+
+type serviceFlags struct {
+	name    string
+	logFile string
+}
+
+// forward returns the flags given to install, which the service runs with.
+// Global flags may have been given before the command name, so they are taken
+// from g.
+func (g *globals) forward(fs *flag.FlagSet) []string {
+	var args []string
+	if g.verbose {
+		args = append(args, "-v")
+	}
+	if g.logLevel != "" {
+		args = append(args, "-log-level="+g.logLevel)
+	}
+	if g.logFormat != "text" {
+		args = append(args, "-log-format="+g.logFormat)
+	}
+	if g.dryRun.enabled {
+		args = append(args, "-dry-run="+g.dryRun.String())
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "c", "v", "log-level", "log-format", "dry-run", "name", "log-file":
+		default:
+			args = append(args, fmt.Sprintf("-%s=%s", fl.Name, fl.Value))
+		}
+	})
+	return args
+}
+
+// serviceArgs returns the arguments the service manager starts the service
+// with: service run with the configuration and log file, which must be
+// absolute as services start in the system directory, and forward.
+func serviceArgs(configPath string, opts serviceFlags, forward []string) ([]string, error) {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	logFile := opts.logFile
+	if logFile == "" {
+		logFile = filepath.Join(filepath.Dir(configPath), "sonarr-autoimport.log")
+	}
+	if logFile, err = filepath.Abs(logFile); err != nil {
+		return nil, err
+	}
+	args := []string{"service", "run", "-c=" + configPath, "-name=" + opts.name, "-log-file=" + logFile}
+	return append(args, forward...), nil
+}
+
+// openServiceLog makes path the destination of everything written to stderr,
+// which includes the log.
+func openServiceLog(path string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	os.Stderr = file
+	return nil
+}
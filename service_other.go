@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNoServices = errors.New("the service command is only available on Windows; elsewhere run the daemon command from systemd, launchd or a container")
+
+func installService(*globals, serviceFlags, []string) int {
+	return fatal(nil, errNoServices)
+}
+
+func uninstallService(serviceFlags) int {
+	return fatal(nil, errNoServices)
+}
+
+func runService(*globals, importFlags, serviceFlags) int {
+	return fatal(nil, errNoServices)
+}
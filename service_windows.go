@@ -0,0 +1,129 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"sonarr-autoimport/internal/config"
+)
+
+// installService registers the daemon with the service manager, started
+// automatically with the configuration of g and the flags in forward.
+func installService(g *globals, opts serviceFlags, forward []string) int {
+	exe, err := os.Executable()
+	if err != nil {
+		return fatal(nil, err)
+	}
+	args, err := serviceArgs(config.Locate(g.configPath), opts, forward)
+	if err != nil {
+		return fatal(nil, err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fatal(nil, fmt.Errorf("failed to connect to the service manager, which needs an administrator: %w", err))
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(opts.name); err == nil {
+		s.Close()
+		return fatal(nil, fmt.Errorf("service %s already exists; run service uninstall first", opts.name))
+	}
+	s, err := m.CreateService(opts.name, exe, mgr.Config{
+		DisplayName: "Sonarr Auto Import",
+		Description: "Imports finished anime downloads into Sonarr",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fatal(nil, fmt.Errorf("failed to install service %s: %w", opts.name, err))
+	}
+	defer s.Close()
+	fmt.Printf("Installed service %s, which starts with Windows; start it now with \"sc start %s\"\n", opts.name, opts.name)
+	return exitOK
+}
+
+func uninstallService(opts serviceFlags) int {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fatal(nil, fmt.Errorf("failed to connect to the service manager, which needs an administrator: %w", err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(opts.name)
+	if err != nil {
+		return fatal(nil, fmt.Errorf("service %s is not installed: %w", opts.name, err))
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		if errors.Is(err, windows.ERROR_SERVICE_MARKED_FOR_DELETE) {
+			return fatal(nil, fmt.Errorf("service %s is already being removed", opts.name))
+		}
+		return fatal(nil, fmt.Errorf("failed to uninstall service %s: %w", opts.name, err))
+	}
+	fmt.Printf("Uninstalled service %s\n", opts.name)
+	return exitOK
+}
+
+// runService runs the daemon under the service manager. Started from a
+// console it runs like the daemon command.
+func runService(g *globals, f importFlags, opts serviceFlags) int {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fatal(nil, fmt.Errorf("failed to detect the service manager: %w", err))
+	}
+	if !isService {
+		return runDaemon(g, f)
+	}
+	if err := openServiceLog(opts.logFile); err != nil {
+		return fatal(nil, err)
+	}
+	handler := &serviceHandler{g: g, f: f}
+	if err := svc.Run(opts.name, handler); err != nil {
+		return fatal(nil, fmt.Errorf("service %s failed: %w", opts.name, err))
+	}
+	return handler.status
+}
+
+// serviceHandler runs the daemon until the service manager stops it.
+type serviceHandler struct {
+	g      *globals
+	f      importFlags
+	status int
+}
+
+// Execute implements svc.Handler.
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan int, 1)
+	go func() { done <- runDaemonContext(ctx, h.g, h.f) }()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				// The daemon finishes the running scan, like after SIGTERM
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		case status := <-done:
+			if status == exitInterrupted {
+				status = exitOK
+			}
+			h.status = status
+			changes <- svc.Status{State: svc.Stopped}
+			return status != exitOK, uint32(status)
+		}
+	}
+}
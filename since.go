@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sinceFlag is -since, the time before which full scans leave files alone:
+// an RFC 3339 time or a duration before the moment the flag is parsed, so a
+// daemon keeps the same cutoff across reloads.
+type sinceFlag struct {
+	time.Time
+	value string
+}
+
+func (s *sinceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.value
+}
+
+func (s *sinceFlag) Set(value string) error {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		s.Time, s.value = t, value
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("want an RFC 3339 time such as 2024-05-01T00:00:00Z or a duration such as 48h")
+	}
+	s.Time, s.value = time.Now().Add(-d), value
+	return nil
+}
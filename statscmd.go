@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sonarr-autoimport/internal/config"
+	"sonarr-autoimport/internal/history"
+)
+
+// statsOrders are the -sort keys of the stats command. Every order but title
+// puts the largest value first.
+var statsOrders = map[string]func(a, b history.SeriesStats) bool{
+	"imports":  func(a, b history.SeriesStats) bool { return a.Imports > b.Imports },
+	"upgrades": func(a, b history.SeriesStats) bool { return a.Upgrades > b.Upgrades },
+	"failures": func(a, b history.SeriesStats) bool { return a.Failures > b.Failures },
+	"rate":     func(a, b history.SeriesStats) bool { return a.FailureRate() > b.FailureRate() },
+	"bytes":    func(a, b history.SeriesStats) bool { return a.Bytes > b.Bytes },
+	"wait":     func(a, b history.SeriesStats) bool { return a.AverageWait() > b.AverageWait() },
+	"last":     func(a, b history.SeriesStats) bool { return a.LastImport.After(b.LastImport) },
+	"title": func(a, b history.SeriesStats) bool {
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	},
+}
+
+func statsCommand() *command {
+	return &command{
+		name:    "stats",
+		summary: "Show how many files were imported or failed per series",
+		setup: func(fs *flag.FlagSet) func(*globals, []string) int {
+			var opts statsFlags
+			fs.StringVar(&opts.sort, "sort", "imports", "order the series by `key`: imports, upgrades, failures, rate, bytes, wait, last or title")
+			fs.IntVar(&opts.limit, "n", 0, "show at most `N` series (0 for all)")
+			fs.BoolVar(&opts.json, "json", false, "print the statistics as JSON")
+			return func(g *globals, args []string) int {
+				if len(args) > 0 {
+					fmt.Fprintf(os.Stderr, "Unexpected arguments %q\n", strings.Join(args, " "))
+					return exitFatal
+				}
+				return runStats(g, opts)
+			}
+		},
+	}
+}
+
+type statsFlags struct {
+	sort  string
+	limit int
+	json  bool
+}
+
+func runStats(g *globals, opts statsFlags) int {
+	less, ok := statsOrders[opts.sort]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown -sort %q, use imports, upgrades, failures, rate, bytes, wait, last or title\n", opts.sort)
+		return exitFatal
+	}
+	logger, cfg, err := g.load()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	series, err := history.OpenStats(stateDir(g, cfg), logger).Series()
+	if err != nil {
+		return fatal(logger, err)
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		if less(series[i], series[j]) {
+			return true
+		}
+		if less(series[j], series[i]) {
+			return false
+		}
+		return series[i].SeriesID < series[j].SeriesID
+	})
+	if opts.limit > 0 && len(series) > opts.limit {
+		series = series[:opts.limit]
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if series == nil {
+			series = []history.SeriesStats{}
+		}
+		if err := enc.Encode(series); err != nil {
+			return fatal(logger, err)
+		}
+		return exitOK
+	}
+	if len(series) == 0 {
+		fmt.Println("No statistics yet")
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIES\tIMPORTS\tUPGRADES\tFAILURES\tFAIL %\tSIZE\tAVG WAIT\tLAST IMPORT")
+	for _, st := range series {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.0f%%\t%s\t%s\t%s\n", statsTitle(st), st.Imports, st.Upgrades, st.Failures,
+			st.FailureRate()*100, config.FormatSize(st.Bytes), statsWait(st), statsTime(st.LastImport))
+	}
+	w.Flush()
+	return exitOK
+}
+
+// statsTitle names the series of st with its ID and instance.
+func statsTitle(st history.SeriesStats) string {
+	title := st.Title
+	if title == "" {
+		title = "-"
+	}
+	if st.Instance != "" {
+		return fmt.Sprintf("%s (ID: %d on %s)", title, st.SeriesID, st.Instance)
+	}
+	return fmt.Sprintf("%s (ID: %d)", title, st.SeriesID)
+}
+
+// statsWait is the average wait of st, or "-" when no import measured one.
+func statsWait(st history.SeriesStats) string {
+	if st.WaitCount == 0 {
+		return "-"
+	}
+	wait := st.AverageWait()
+	if wait >= time.Minute {
+		return wait.Round(time.Minute).String()
+	}
+	return wait.Round(time.Second).String()
+}
+
+func statsTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}